@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jonnyzzz/stevedore/internal/stevedore"
+)
+
+// completionCommand describes a top-level command for shell completion.
+type completionCommand struct {
+	name        string
+	subcommands []string
+	// deployment is set when the command itself takes a deployment name
+	deployment bool
+	// deploymentSubcommands take a deployment name as their first argument
+	deploymentSubcommands []string
+}
+
+// completionCommands is the command tree the completion scripts offer.
+// Deployment names are completed at runtime via `stevedore completion deployments`.
+var completionCommands = []completionCommand{
+	{name: "help"},
+	{name: "version"},
+	{name: "doctor"},
+	{name: "backup"},
+	{name: "restore"},
+	{name: "db", subcommands: []string{"status", "rekey"}},
+	{name: "status", deployment: true},
+	{name: "check", deployment: true},
+	{name: "self-update", subcommands: []string{"check-env", "history"}},
+	{name: "repo",
+		subcommands:           []string{"add", "key", "keys", "verify", "rotate-key", "change-branch", "list", "set-depends", "set-schedule", "tag"},
+		deploymentSubcommands: []string{"key", "verify", "rotate-key", "change-branch", "set-depends", "set-schedule", "tag"}},
+	{name: "deploy",
+		subcommands:           []string{"sync", "up", "down", "archive", "unarchive", "scale", "validate", "drift", "describe", "cancel", "history"},
+		deploymentSubcommands: []string{"sync", "up", "down", "archive", "unarchive", "scale", "validate", "drift", "describe", "cancel", "history"}},
+	{name: "logs", deployment: true},
+	{name: "exec", deployment: true},
+	{name: "param",
+		subcommands:           []string{"set", "get", "list", "history", "rollback"},
+		deploymentSubcommands: []string{"set", "get", "list", "history", "rollback"}},
+	{name: "shared", subcommands: []string{"list", "read", "write"}},
+	{name: "services", subcommands: []string{"list"}},
+	{name: "token",
+		subcommands:           []string{"get", "regenerate", "list"},
+		deploymentSubcommands: []string{"get", "regenerate"}},
+	{name: "completion", subcommands: []string{"bash", "zsh", "fish"}},
+	{name: "maintenance", subcommands: []string{"on", "off", "status"}},
+}
+
+func runCompletionTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: completion bash|zsh|fish")
+	}
+
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(w)
+	case "zsh":
+		writeZshCompletion(w)
+	case "fish":
+		writeFishCompletion(w)
+	case "deployments":
+		// Called by the scripts while the user types: print what is known, never fail
+		deployments, _ := instance.ListDeployments()
+		sort.Strings(deployments)
+		for _, d := range deployments {
+			_, _ = fmt.Fprintln(w, d)
+		}
+	default:
+		return fmt.Errorf("completion: unsupported shell: %s (bash, zsh or fish)", args[0])
+	}
+	return nil
+}
+
+func completionCommandNames() string {
+	names := make([]string, len(completionCommands))
+	for i, c := range completionCommands {
+		names[i] = c.name
+	}
+	return strings.Join(names, " ")
+}
+
+func writeBashCompletion(w io.Writer) {
+	var cases strings.Builder
+	for _, c := range completionCommands {
+		if len(c.subcommands) == 0 && !c.deployment {
+			continue
+		}
+		deployment := ""
+		if c.deployment {
+			deployment = "1"
+		}
+		_, _ = fmt.Fprintf(&cases, "    %s) subs=%q; deps=%q; deployment=%q ;;\n",
+			c.name, strings.Join(c.subcommands, " "), strings.Join(c.deploymentSubcommands, " "), deployment)
+	}
+
+	_, _ = fmt.Fprintf(w, `# bash completion for stevedore
+# Install: stevedore completion bash > /etc/bash_completion.d/stevedore
+
+_stevedore_deployments() {
+    stevedore completion deployments 2>/dev/null
+}
+
+_stevedore() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local cmd="${COMP_WORDS[1]}" sub="${COMP_WORDS[2]}"
+    local subs="" deps="" deployment=""
+    COMPREPLY=()
+
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W %q -- "$cur"))
+        return
+    fi
+
+    case "$cmd" in
+%s    esac
+
+    if [ "$COMP_CWORD" -eq 2 ]; then
+        if [ -n "$subs" ]; then
+            COMPREPLY=($(compgen -W "$subs" -- "$cur"))
+        elif [ -n "$deployment" ]; then
+            COMPREPLY=($(compgen -W "$(_stevedore_deployments)" -- "$cur"))
+        fi
+    elif [ "$COMP_CWORD" -eq 3 ] && [[ " $deps " == *" $sub "* ]]; then
+        COMPREPLY=($(compgen -W "$(_stevedore_deployments)" -- "$cur"))
+    fi
+}
+
+complete -F _stevedore stevedore
+`, completionCommandNames(), cases.String())
+}
+
+func writeZshCompletion(w io.Writer) {
+	var cases strings.Builder
+	for _, c := range completionCommands {
+		if len(c.subcommands) == 0 && !c.deployment {
+			continue
+		}
+		deployment := ""
+		if c.deployment {
+			deployment = "1"
+		}
+		_, _ = fmt.Fprintf(&cases, "    %s) subs=(%s); deps=(%s); deployment=%q ;;\n",
+			c.name, strings.Join(c.subcommands, " "), strings.Join(c.deploymentSubcommands, " "), deployment)
+	}
+
+	_, _ = fmt.Fprintf(w, `#compdef stevedore
+# zsh completion for stevedore
+# Install: stevedore completion zsh > "${fpath[1]}/_stevedore"
+
+_stevedore() {
+  local cmd=${words[2]} sub=${words[3]} deployment=""
+  local -a subs deps
+
+  if (( CURRENT == 2 )); then
+    compadd -- %s
+    return
+  fi
+
+  case $cmd in
+%s  esac
+
+  if (( CURRENT == 3 )); then
+    if (( ${#subs} )); then
+      compadd -- $subs
+    elif [[ -n $deployment ]]; then
+      compadd -- ${(f)"$(stevedore completion deployments 2>/dev/null)"}
+    fi
+  elif (( CURRENT == 4 )) && (( ${deps[(Ie)$sub]} )); then
+    compadd -- ${(f)"$(stevedore completion deployments 2>/dev/null)"}
+  fi
+}
+
+compdef _stevedore stevedore
+`, completionCommandNames(), cases.String())
+}
+
+func writeFishCompletion(w io.Writer) {
+	var commands, subcommands []string
+	for _, c := range completionCommands {
+		if c.deployment {
+			commands = append(commands, c.name)
+		}
+		for _, sub := range c.deploymentSubcommands {
+			subcommands = append(subcommands, "'"+c.name+" "+sub+"'")
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, `# fish completion for stevedore
+# Install: stevedore completion fish > ~/.config/fish/completions/stevedore.fish
+
+function __stevedore_deployments
+    stevedore completion deployments 2>/dev/null
+end
+
+# True when the word being completed is a deployment name
+function __stevedore_needs_deployment
+    set -l tokens (commandline -opc)
+    switch (count $tokens)
+        case 2
+            contains -- $tokens[2] %s
+        case 3
+            contains -- "$tokens[2] $tokens[3]" %s
+        case '*'
+            return 1
+    end
+end
+
+complete -c stevedore -f
+complete -c stevedore -n __fish_use_subcommand -a %q
+`, strings.Join(commands, " "), strings.Join(subcommands, " "), completionCommandNames())
+
+	for _, c := range completionCommands {
+		if len(c.subcommands) == 0 {
+			continue
+		}
+		subs := strings.Join(c.subcommands, " ")
+		_, _ = fmt.Fprintf(w, "complete -c stevedore -n '__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s' -a %q\n",
+			c.name, subs, subs)
+	}
+	_, _ = fmt.Fprintln(w, "complete -c stevedore -n __stevedore_needs_deployment -a '(__stevedore_deployments)'")
+}
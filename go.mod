@@ -4,4 +4,4 @@ go 1.26
 
 require github.com/mutecomm/go-sqlcipher/v4 v4.4.2
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,52 @@
+package stevedore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrDeploymentArchived is returned when deploying an archived deployment.
+var ErrDeploymentArchived = errors.New("deployment is archived")
+
+// SetDeploymentArchived archives or unarchives a deployment. An archived
+// deployment is disabled and desired down, so the daemon neither polls,
+// checks nor reconciles it, while its checkout, deploy key and parameters
+// are kept. Unarchiving enables polling again; the containers stay stopped
+// until the next deploy.
+func (i *Instance) SetDeploymentArchived(db *sql.DB, deployment string, archived bool) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+
+	var err error
+	if archived {
+		_, err = db.Exec(`
+			UPDATE repositories
+			SET archived = 1, enabled = 0, desired_state = ?
+			WHERE deployment = ?
+		`, DesiredStateDown, deployment)
+	} else {
+		_, err = db.Exec(`
+			UPDATE repositories
+			SET archived = 0, enabled = 1
+			WHERE deployment = ?
+		`, deployment)
+	}
+	return err
+}
+
+// CheckNotArchived returns ErrDeploymentArchived for an archived deployment.
+func (i *Instance) CheckNotArchived(db *sql.DB, deployment string) error {
+	config, err := i.GetRepoConfig(db, deployment)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if config.Archived {
+		return fmt.Errorf("%w: %s (unarchive it with: stevedore deploy unarchive %s)", ErrDeploymentArchived, deployment, deployment)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package stevedore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetDeploymentArchived(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	for _, name := range []string{"app", "seasonal"} {
+		if _, err := instance.AddRepo(name, RepoSpec{URL: "git@github.com:acme/" + name + ".git"}); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := instance.SetDesiredState(db, "seasonal", DesiredStateUp); err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.SetDeploymentArchived(db, "seasonal", true); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	config, err := instance.GetRepoConfig(db, "seasonal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.Archived || config.Enabled || config.DesiredState != DesiredStateDown {
+		t.Errorf("archived config = %+v, want archived, disabled and down", config)
+	}
+
+	// The daemon neither polls nor checks archived deployments
+	enabled, _ := instance.ListEnabledDeployments(db)
+	disabled, _ := instance.ListDisabledDeployments(db)
+	for _, c := range append(enabled, disabled...) {
+		if c.Deployment == "seasonal" {
+			t.Errorf("archived deployment listed: %+v", c)
+		}
+	}
+	if err := instance.CheckNotArchived(db, "seasonal"); !errors.Is(err, ErrDeploymentArchived) {
+		t.Errorf("CheckNotArchived = %v, want ErrDeploymentArchived", err)
+	}
+	if err := instance.CheckNotArchived(db, "app"); err != nil {
+		t.Errorf("CheckNotArchived(app) = %v", err)
+	}
+
+	if err := instance.SetDeploymentArchived(db, "seasonal", false); err != nil {
+		t.Fatalf("unarchive: %v", err)
+	}
+	config, _ = instance.GetRepoConfig(db, "seasonal")
+	if config.Archived || !config.Enabled {
+		t.Errorf("unarchived config = %+v, want enabled", config)
+	}
+}
@@ -0,0 +1,258 @@
+package stevedore
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BackupOptions controls Backup.
+type BackupOptions struct {
+	// IncludeCheckouts keeps deployments/*/repo/git, which are skipped by
+	// default because `deploy sync` can re-clone them
+	IncludeCheckouts bool
+	// Passphrase encrypts the archive when set
+	Passphrase string
+	// SkipPath is left out of the archive, e.g. the output file when it is
+	// written inside the state directory
+	SkipPath string
+}
+
+// RestoreOptions controls Restore.
+type RestoreOptions struct {
+	// Passphrase decrypts an encrypted archive
+	Passphrase string
+	// Force overwrites an existing state directory
+	Force bool
+}
+
+// BackupSummary describes what was archived or restored.
+type BackupSummary struct {
+	Files     int
+	Bytes     int64
+	Encrypted bool
+}
+
+// Backup writes the state directory (system dir with DB and keys, deployment
+// dirs with SSH keys, shared data) to w as a gzipped tarball. Git checkouts are
+// skipped unless requested. The database WAL is checkpointed first so the
+// archived database file is self-contained.
+func (i *Instance) Backup(w io.Writer, opts BackupOptions) (*BackupSummary, error) {
+	if err := i.EnsureLayout(); err != nil {
+		return nil, err
+	}
+	i.checkpointDB()
+
+	summary := &BackupSummary{Encrypted: opts.Passphrase != ""}
+
+	out := w
+	var enc *encryptingWriter
+	if opts.Passphrase != "" {
+		var err error
+		if enc, err = newEncryptingWriter(w, opts.Passphrase); err != nil {
+			return nil, fmt.Errorf("init encryption: %w", err)
+		}
+		out = enc
+	}
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.WalkDir(i.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(i.Root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if opts.SkipPath != "" && path == opts.SkipPath {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() && !opts.IncludeCheckouts && isCheckoutDir(rel) {
+			return fs.SkipDir
+		}
+		// Sockets, devices and symlinks are runtime artifacts, not state
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(tw, f)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("archive %s: %w", rel, err)
+		}
+		summary.Files++
+		summary.Bytes += n
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("backup %s: %w", i.Root, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+// Restore unpacks a backup produced by Backup into the state directory.
+// Without Force it refuses to overwrite a directory that already has a database.
+func (i *Instance) Restore(r io.Reader, opts RestoreOptions) (*BackupSummary, error) {
+	if !opts.Force {
+		if _, err := os.Stat(i.DBPath()); err == nil {
+			return nil, fmt.Errorf("state directory %s already contains a database; use --force to overwrite", i.Root)
+		}
+	}
+
+	br := bufio.NewReader(r)
+	summary := &BackupSummary{Encrypted: isEncryptedBackup(br)}
+
+	var in io.Reader = br
+	if summary.Encrypted {
+		if opts.Passphrase == "" {
+			return nil, ErrBackupPassphrase
+		}
+		dec, err := newDecryptingReader(br, opts.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		in = dec
+	}
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("open backup: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	if err := os.MkdirAll(i.Root, 0o755); err != nil {
+		return nil, err
+	}
+	// A WAL left from the database being replaced would be replayed into the restored one
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(i.DBPath() + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read backup: %w", err)
+		}
+
+		name := strings.TrimSuffix(header.Name, "/")
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return nil, fmt.Errorf("refusing unsafe path in backup: %q", header.Name)
+		}
+		target := filepath.Join(i.Root, filepath.FromSlash(name))
+		mode := os.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return nil, err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return nil, err
+			}
+			n, err := io.Copy(f, tr)
+			closeErr := f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("restore %s: %w", name, err)
+			}
+			if closeErr != nil {
+				return nil, closeErr
+			}
+			// OpenFile keeps the mode of an existing file; enforce the archived one
+			if err := os.Chmod(target, mode); err != nil {
+				return nil, err
+			}
+			summary.Files++
+			summary.Bytes += n
+		default:
+			// Backup only writes directories and regular files
+			continue
+		}
+	}
+
+	return summary, nil
+}
+
+// isCheckoutDir reports whether rel (slash-separated, relative to the root)
+// is a deployment's git working tree.
+func isCheckoutDir(rel string) bool {
+	parts := strings.Split(rel, "/")
+	return len(parts) == 4 && parts[0] == "deployments" && parts[2] == "repo" && parts[3] == "git"
+}
+
+// checkpointDB folds the WAL into the main database file. Failures are only
+// logged: the -wal file is archived too, so the backup stays usable.
+func (i *Instance) checkpointDB() {
+	if _, err := os.Stat(i.DBPath()); err != nil {
+		return
+	}
+	db, err := i.OpenDB()
+	if err != nil {
+		log.Printf("Warning: could not open database to checkpoint before backup: %v", err)
+		return
+	}
+	defer func() { _ = db.Close() }()
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE);"); err != nil {
+		log.Printf("Warning: database checkpoint before backup failed: %v", err)
+	}
+}
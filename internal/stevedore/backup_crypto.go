@@ -0,0 +1,211 @@
+package stevedore
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted backups are a header followed by AES-256-GCM sealed chunks:
+//
+//	magic | salt (16) | nonce prefix (8) | { final (1) | length (4) | ciphertext }...
+//
+// The key is derived from the passphrase with PBKDF2-SHA256. Each chunk's
+// nonce is the prefix plus a chunk counter, so chunks cannot be reordered,
+// and the final flag is authenticated so truncation is detected.
+const (
+	backupMagic      = "STEVEDORE-BACKUP-ENC1\n"
+	backupSaltSize   = 16
+	backupChunkSize  = 64 * 1024
+	backupKDFRounds  = 600_000
+	backupNonceExtra = 8
+)
+
+// ErrBackupPassphrase is returned when an encrypted backup cannot be opened.
+var ErrBackupPassphrase = errors.New("backup is encrypted: wrong or missing passphrase")
+
+func backupAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, backupKDFRounds, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptingWriter seals everything written to it into backup chunks.
+type encryptingWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  [backupNonceExtra]byte
+	counter uint32
+	buf     []byte
+}
+
+func newEncryptingWriter(w io.Writer, passphrase string) (*encryptingWriter, error) {
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := backupAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encryptingWriter{w: w, aead: aead, buf: make([]byte, 0, backupChunkSize)}
+	if _, err := rand.Read(e.prefix[:]); err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(backupMagic), salt...)
+	header = append(header, e.prefix[:]...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		if len(e.buf) == cap(e.buf) {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close seals the remaining data as the final chunk. It does not close the
+// underlying writer.
+func (e *encryptingWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptingWriter) seal(final bool) error {
+	flag := byte(0)
+	if final {
+		flag = 1
+	}
+	ciphertext := e.aead.Seal(nil, backupNonce(e.prefix, e.counter), e.buf, []byte{flag})
+	e.counter++
+	e.buf = e.buf[:0]
+
+	var header [5]byte
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(ciphertext)))
+	if _, err := e.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(ciphertext)
+	return err
+}
+
+// decryptingReader opens backup chunks produced by encryptingWriter.
+type decryptingReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  [backupNonceExtra]byte
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+func newDecryptingReader(r io.Reader, passphrase string) (*decryptingReader, error) {
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != backupMagic {
+		return nil, errors.New("not an encrypted stevedore backup")
+	}
+	salt := make([]byte, backupSaltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, fmt.Errorf("read backup header: %w", err)
+	}
+
+	d := &decryptingReader{r: r}
+	if _, err := io.ReadFull(r, d.prefix[:]); err != nil {
+		return nil, fmt.Errorf("read backup header: %w", err)
+	}
+
+	aead, err := backupAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	d.aead = aead
+	return d, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptingReader) open() error {
+	var header [5]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		return fmt.Errorf("backup is truncated: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > backupChunkSize+uint32(d.aead.Overhead()) {
+		return errors.New("backup is corrupted: chunk too large")
+	}
+
+	ciphertext := make([]byte, length)
+	if _, err := io.ReadFull(d.r, ciphertext); err != nil {
+		return fmt.Errorf("backup is truncated: %w", err)
+	}
+
+	plain, err := d.aead.Open(nil, backupNonce(d.prefix, d.counter), ciphertext, header[:1])
+	if err != nil {
+		if d.counter == 0 {
+			return ErrBackupPassphrase
+		}
+		return errors.New("backup is corrupted: chunk failed authentication")
+	}
+	d.counter++
+	d.plain = plain
+
+	if header[0] == 1 {
+		d.done = true
+		if n, _ := d.r.Read(make([]byte, 1)); n != 0 {
+			return errors.New("backup is corrupted: data after final chunk")
+		}
+	}
+	return nil
+}
+
+func backupNonce(prefix [backupNonceExtra]byte, counter uint32) []byte {
+	nonce := make([]byte, backupNonceExtra+4)
+	copy(nonce, prefix[:])
+	binary.BigEndian.PutUint32(nonce[backupNonceExtra:], counter)
+	return nonce
+}
+
+// isEncryptedBackup reports whether the buffered stream starts with the encrypted backup magic.
+func isEncryptedBackup(r *bufio.Reader) bool {
+	head, err := r.Peek(len(backupMagic))
+	return err == nil && string(head) == backupMagic
+}
@@ -0,0 +1,167 @@
+package stevedore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newBackupFixture creates a state directory with a deployment, a parameter,
+// an SSH key and a git checkout.
+func newBackupFixture(t *testing.T) *Instance {
+	t.Helper()
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if err := instance.SetParameter("app", "SECRET", []byte("s3cret")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+	gitDir := filepath.Join(instance.DeploymentDir("app"), "repo", "git")
+	if err := os.MkdirAll(gitDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "docker-compose.yaml"), []byte("services: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return instance
+}
+
+func TestBackupRestore_RoundTrip(t *testing.T) {
+	for _, passphrase := range []string{"", "correct horse"} {
+		name := "plain"
+		if passphrase != "" {
+			name = "encrypted"
+		}
+		t.Run(name, func(t *testing.T) {
+			source := newBackupFixture(t)
+
+			var archive bytes.Buffer
+			summary, err := source.Backup(&archive, BackupOptions{Passphrase: passphrase})
+			if err != nil {
+				t.Fatalf("Backup: %v", err)
+			}
+			if summary.Files == 0 || summary.Encrypted != (passphrase != "") {
+				t.Errorf("unexpected backup summary: %+v", summary)
+			}
+
+			target := NewInstance(t.TempDir())
+			restored, err := target.Restore(bytes.NewReader(archive.Bytes()), RestoreOptions{Passphrase: passphrase})
+			if err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			if restored.Files != summary.Files {
+				t.Errorf("restored %d files, backed up %d", restored.Files, summary.Files)
+			}
+
+			value, err := target.GetParameter("app", "SECRET")
+			if err != nil {
+				t.Fatalf("GetParameter on restored state: %v", err)
+			}
+			if string(value) != "s3cret" {
+				t.Errorf("parameter = %q, want s3cret", value)
+			}
+
+			keyPath := filepath.Join(target.DeploymentDir("app"), "repo", "ssh", "id_ed25519")
+			info, err := os.Stat(keyPath)
+			if err != nil {
+				t.Fatalf("SSH key not restored: %v", err)
+			}
+			if info.Mode().Perm() != 0o600 {
+				t.Errorf("SSH key mode = %v, want 0600", info.Mode().Perm())
+			}
+
+			if _, err := os.Stat(filepath.Join(target.DeploymentDir("app"), "repo", "git")); !os.IsNotExist(err) {
+				t.Errorf("git checkout should be excluded by default, stat err = %v", err)
+			}
+		})
+	}
+}
+
+func TestBackup_IncludeCheckouts(t *testing.T) {
+	source := newBackupFixture(t)
+
+	var archive bytes.Buffer
+	if _, err := source.Backup(&archive, BackupOptions{IncludeCheckouts: true}); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+
+	target := NewInstance(t.TempDir())
+	if _, err := target.Restore(&archive, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target.DeploymentDir("app"), "repo", "git", "docker-compose.yaml")); err != nil {
+		t.Errorf("expected checkout to be restored: %v", err)
+	}
+}
+
+func TestRestore_Refusals(t *testing.T) {
+	source := newBackupFixture(t)
+
+	var encrypted bytes.Buffer
+	if _, err := source.Backup(&encrypted, BackupOptions{Passphrase: "secret"}); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+
+	target := NewInstance(t.TempDir())
+	if _, err := target.Restore(bytes.NewReader(encrypted.Bytes()), RestoreOptions{}); !errors.Is(err, ErrBackupPassphrase) {
+		t.Errorf("missing passphrase: got %v", err)
+	}
+	if _, err := target.Restore(bytes.NewReader(encrypted.Bytes()), RestoreOptions{Passphrase: "wrong"}); !errors.Is(err, ErrBackupPassphrase) {
+		t.Errorf("wrong passphrase: got %v", err)
+	}
+
+	truncated := encrypted.Bytes()[:encrypted.Len()-10]
+	if _, err := target.Restore(bytes.NewReader(truncated), RestoreOptions{Passphrase: "secret"}); err == nil {
+		t.Error("expected error for truncated backup")
+	}
+
+	// The source already has a database
+	if _, err := source.Restore(bytes.NewReader(encrypted.Bytes()), RestoreOptions{Passphrase: "secret"}); err == nil ||
+		!strings.Contains(err.Error(), "--force") {
+		t.Errorf("expected refusal to overwrite existing state, got %v", err)
+	}
+	if _, err := source.Restore(bytes.NewReader(encrypted.Bytes()), RestoreOptions{Passphrase: "secret", Force: true}); err != nil {
+		t.Errorf("Restore with Force: %v", err)
+	}
+}
+
+func TestRestore_RejectsPathTraversal(t *testing.T) {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	content := []byte("owned")
+	if err := tw.WriteHeader(&tar.Header{Name: "../escape.txt", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = tw.Write(content)
+	_ = tw.Close()
+	_ = gz.Close()
+
+	root := filepath.Join(t.TempDir(), "root")
+	target := NewInstance(root)
+	if _, err := target.Restore(&archive, RestoreOptions{}); err == nil {
+		t.Fatal("expected unsafe path to be rejected")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escape.txt")); !os.IsNotExist(err) {
+		t.Error("file escaped the state directory")
+	}
+}
+
+func TestIsCheckoutDir(t *testing.T) {
+	if !isCheckoutDir("deployments/app/repo/git") {
+		t.Error("expected deployments/app/repo/git to be a checkout")
+	}
+	for _, rel := range []string{"deployments/app/repo", "deployments/app/repo/ssh", "deployments/app/repo/git/sub", "system/git"} {
+		if isCheckoutDir(rel) {
+			t.Errorf("isCheckoutDir(%q) = true", rel)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ParamBuildArgPrefix marks deployment parameters that are passed to
+// `docker compose build` as build args: STEVEDORE_BUILD_ARG_VERSION=1.2
+// becomes --build-arg VERSION=1.2. They are not exported to the Compose
+// environment.
+const ParamBuildArgPrefix = "STEVEDORE_BUILD_ARG_"
+
+// isBuildArgParam reports whether a parameter is a build arg.
+func isBuildArgParam(name string) bool {
+	return strings.HasPrefix(name, ParamBuildArgPrefix)
+}
+
+// buildArgsFromParams turns STEVEDORE_BUILD_ARG_* parameters into
+// `--build-arg NAME=value` arguments, sorted by name. Each value is a single
+// argv element, so spaces and shell metacharacters need no quoting.
+func buildArgsFromParams(params map[string]string) ([]string, error) {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if isBuildArgParam(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	args := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		arg := strings.TrimPrefix(name, ParamBuildArgPrefix)
+		if arg == "" {
+			return nil, fmt.Errorf("invalid build arg parameter %s: expected %s<NAME>", name, ParamBuildArgPrefix)
+		}
+		args = append(args, "--build-arg", arg+"="+params[name])
+	}
+	return args, nil
+}
+
+// LoadBuildArgs returns the `--build-arg` arguments configured for a deployment.
+func (i *Instance) LoadBuildArgs(deployment string) ([]string, error) {
+	names, err := i.ListEffectiveParameters(deployment)
+	if err != nil {
+		return nil, nil // No parameters (deployment might not exist)
+	}
+
+	params := make(map[string]string)
+	for _, name := range names {
+		if !isBuildArgParam(name) {
+			continue
+		}
+		value, err := i.GetParameter(deployment, name)
+		if err != nil {
+			return nil, fmt.Errorf("read build arg parameter %s: %w", name, err)
+		}
+		params[name] = string(value)
+	}
+
+	return buildArgsFromParams(params)
+}
+
+// composeBuild runs `docker compose build` of the compose files (the
+// entrypoint first) with the given build args and build options, copying its
+// output to output when it is set.
+func (i *Instance) composeBuild(ctx context.Context, composeFiles []string, projectName string, gitDir string, env []string, buildArgs []string, opts BuildOptions, output io.Writer) error {
+	args := composeFileArgs(composeFiles)
+	if len(opts.CacheFrom) > 0 {
+		services, err := resolveComposeServices(ctx, composeFiles, projectName, gitDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve compose services for build cache: %w", err)
+		}
+		override, err := writeCacheFromOverride(services, opts.CacheFrom)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(override) }()
+		args = append(args, "-f", override)
+	}
+	args = append(args, "-p", projectName, "build")
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	args = append(args, buildArgs...)
+
+	cmd := newComposeCommand(ctx, args...)
+	cmd.Dir = gitDir
+	cmd.Env = dockerCommandEnv(append(env, opts.Env()...))
+	var stderr bytes.Buffer
+	cmd.Stdout = output
+	cmd.Stderr = teeOutput(&stderr, output)
+
+	if err := runCommand(cmd); err != nil {
+		return fmt.Errorf("docker compose build failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
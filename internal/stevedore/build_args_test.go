@@ -0,0 +1,59 @@
+package stevedore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildArgsFromParams(t *testing.T) {
+	args, err := buildArgsFromParams(map[string]string{
+		"STEVEDORE_BUILD_ARG_VERSION": "1.2.3",
+		"STEVEDORE_BUILD_ARG_MOTD":    `it's "quoted" & $spaced`,
+		"DATABASE_URL":                "postgres://db",
+		"STEVEDORE_REGISTRY_X_USER":   "bot",
+	})
+	if err != nil {
+		t.Fatalf("buildArgsFromParams: %v", err)
+	}
+
+	// Values are passed verbatim as single argv elements, never through a shell
+	want := []string{
+		"--build-arg", `MOTD=it's "quoted" & $spaced`,
+		"--build-arg", "VERSION=1.2.3",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+
+	if _, err := buildArgsFromParams(map[string]string{"STEVEDORE_BUILD_ARG_": "x"}); err == nil {
+		t.Error("expected error for empty build arg name")
+	}
+}
+
+func TestLoadBuildArgs(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	args, err := instance.LoadBuildArgs("app")
+	if err != nil || len(args) != 0 {
+		t.Fatalf("LoadBuildArgs without params = %q, %v", args, err)
+	}
+
+	if err := instance.SetParameter("app", "STEVEDORE_BUILD_ARG_COMMIT", []byte("abc123")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+	if err := instance.SetParameter("app", "PORT", []byte("8080")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+
+	args, err = instance.LoadBuildArgs("app")
+	if err != nil {
+		t.Fatalf("LoadBuildArgs: %v", err)
+	}
+	if want := []string{"--build-arg", "COMMIT=abc123"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+}
@@ -0,0 +1,150 @@
+package stevedore
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Deployment parameters that control image builds. Like all parameters they
+// can be set globally to apply to every deployment.
+const (
+	// ParamBuildKit forces BuildKit on ("true") or off ("false") for builds
+	// by setting DOCKER_BUILDKIT; unset keeps docker's default.
+	ParamBuildKit = "STEVEDORE_BUILDKIT"
+	// ParamBuildNoCache set to "true" builds without the layer cache (--no-cache).
+	ParamBuildNoCache = "STEVEDORE_BUILD_NO_CACHE"
+	// ParamBuildCacheFrom is a comma-separated list of images used as cache
+	// sources (--cache-from), e.g. "ghcr.io/acme/app:latest".
+	ParamBuildCacheFrom = "STEVEDORE_BUILD_CACHE_FROM"
+)
+
+// BuildOptions controls how images are built.
+type BuildOptions struct {
+	// BuildKit forces DOCKER_BUILDKIT on or off; nil keeps docker's default
+	BuildKit *bool
+	// NoCache builds every layer from scratch
+	NoCache bool
+	// CacheFrom lists images whose layers seed the build cache
+	CacheFrom []string
+}
+
+// tuned reports whether the options change the build itself, which needs an
+// explicit build step: `compose up --build` takes neither --no-cache nor
+// cache sources.
+func (o BuildOptions) tuned() bool {
+	return o.NoCache || len(o.CacheFrom) > 0
+}
+
+// Env returns the variables selecting the builder. COMPOSE_DOCKER_CLI_BUILD
+// makes docker-compose v1 build through the docker CLI, which honors
+// DOCKER_BUILDKIT.
+func (o BuildOptions) Env() []string {
+	if o.BuildKit == nil {
+		return nil
+	}
+	value := "0"
+	if *o.BuildKit {
+		value = "1"
+	}
+	return []string{"DOCKER_BUILDKIT=" + value, "COMPOSE_DOCKER_CLI_BUILD=" + value}
+}
+
+// dockerBuildArgs returns the `docker build` flags for the options.
+func (o BuildOptions) dockerBuildArgs() []string {
+	var args []string
+	if o.NoCache {
+		args = append(args, "--no-cache")
+	}
+	for _, image := range o.CacheFrom {
+		args = append(args, "--cache-from", image)
+	}
+	return args
+}
+
+// buildOptionsFromParams parses the build parameters; invalid values are
+// reported and ignored so a typo cannot block deploys.
+func buildOptionsFromParams(params map[string]string) BuildOptions {
+	var opts BuildOptions
+	if value, ok := params[ParamBuildKit]; ok && strings.TrimSpace(value) != "" {
+		if enabled, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+			log.Printf("Warning: ignoring parameter %s=%q: expected true or false", ParamBuildKit, value)
+		} else {
+			opts.BuildKit = &enabled
+		}
+	}
+	if value, ok := params[ParamBuildNoCache]; ok && strings.TrimSpace(value) != "" {
+		if noCache, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+			log.Printf("Warning: ignoring parameter %s=%q: expected true or false", ParamBuildNoCache, value)
+		} else {
+			opts.NoCache = noCache
+		}
+	}
+	for _, image := range strings.Split(params[ParamBuildCacheFrom], ",") {
+		if image = strings.TrimSpace(image); image != "" {
+			opts.CacheFrom = append(opts.CacheFrom, image)
+		}
+	}
+	return opts
+}
+
+// LoadBuildOptions returns the build options configured for a deployment.
+func (i *Instance) LoadBuildOptions(deployment string) BuildOptions {
+	params := make(map[string]string)
+	for _, name := range []string{ParamBuildKit, ParamBuildNoCache, ParamBuildCacheFrom} {
+		if value, err := i.GetParameter(deployment, name); err == nil {
+			params[name] = string(value)
+		}
+	}
+	return buildOptionsFromParams(params)
+}
+
+// writeCacheFromOverride writes a compose override file adding the cache
+// sources to every service that is built, since `docker compose build` has no
+// --cache-from flag. The caller removes the file.
+func writeCacheFromOverride(services map[string]composeConfigService, cacheFrom []string) (string, error) {
+	type buildSection struct {
+		CacheFrom []string `yaml:"cache_from"`
+	}
+	type serviceSection struct {
+		Build buildSection `yaml:"build"`
+	}
+	override := struct {
+		Services map[string]serviceSection `yaml:"services"`
+	}{Services: make(map[string]serviceSection)}
+
+	names := make([]string, 0, len(services))
+	for name, svc := range services {
+		if svc.Build != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		override.Services[name] = serviceSection{Build: buildSection{CacheFrom: cacheFrom}}
+	}
+
+	data, err := yaml.Marshal(override)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "stevedore-cache-from-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create compose override: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write compose override: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write compose override: %w", err)
+	}
+	return f.Name(), nil
+}
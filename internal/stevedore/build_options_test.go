@@ -0,0 +1,84 @@
+package stevedore
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestBuildOptionsFromParams(t *testing.T) {
+	opts := buildOptionsFromParams(map[string]string{
+		ParamBuildKit:       "true",
+		ParamBuildNoCache:   "1",
+		ParamBuildCacheFrom: "ghcr.io/acme/app:latest, ghcr.io/acme/app:main,",
+	})
+	if opts.BuildKit == nil || !*opts.BuildKit || !opts.NoCache {
+		t.Errorf("opts = %+v, want BuildKit and NoCache", opts)
+	}
+	if want := []string{"DOCKER_BUILDKIT=1", "COMPOSE_DOCKER_CLI_BUILD=1"}; !reflect.DeepEqual(opts.Env(), want) {
+		t.Errorf("Env() = %v, want %v", opts.Env(), want)
+	}
+	want := []string{"--no-cache", "--cache-from", "ghcr.io/acme/app:latest", "--cache-from", "ghcr.io/acme/app:main"}
+	if got := opts.dockerBuildArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("dockerBuildArgs() = %v, want %v", got, want)
+	}
+
+	// Invalid values are ignored rather than blocking the deploy
+	opts = buildOptionsFromParams(map[string]string{ParamBuildKit: "maybe", ParamBuildNoCache: "often"})
+	if opts.BuildKit != nil || opts.NoCache || opts.tuned() || opts.Env() != nil {
+		t.Errorf("opts = %+v, want defaults", opts)
+	}
+}
+
+func TestLoadBuildOptions_GlobalParameter(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if err := instance.SetGlobalParameter(ParamBuildKit, []byte("false")); err != nil {
+		t.Fatalf("SetGlobalParameter: %v", err)
+	}
+	if err := instance.SetParameter("app", ParamBuildCacheFrom, []byte("registry.local/app:cache")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+
+	opts := instance.LoadBuildOptions("app")
+	if opts.BuildKit == nil || *opts.BuildKit {
+		t.Errorf("BuildKit = %v, want false from the global parameter", opts.BuildKit)
+	}
+	if !reflect.DeepEqual(opts.CacheFrom, []string{"registry.local/app:cache"}) || !opts.tuned() {
+		t.Errorf("CacheFrom = %v", opts.CacheFrom)
+	}
+}
+
+func TestWriteCacheFromOverride(t *testing.T) {
+	services := map[string]composeConfigService{
+		"web":   {Build: map[string]any{"context": "."}},
+		"db":    {Image: "postgres:17"},
+		"admin": {Build: map[string]any{"context": "./admin"}},
+	}
+	path, err := writeCacheFromOverride(services, []string{"ghcr.io/acme/app:latest"})
+	if err != nil {
+		t.Fatalf("writeCacheFromOverride: %v", err)
+	}
+	defer func() { _ = os.Remove(path) }()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `services:
+    admin:
+        build:
+            cache_from:
+                - ghcr.io/acme/app:latest
+    web:
+        build:
+            cache_from:
+                - ghcr.io/acme/app:latest
+`
+	if string(data) != want {
+		t.Errorf("override =\n%s\nwant\n%s", data, want)
+	}
+}
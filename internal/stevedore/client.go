@@ -1,12 +1,20 @@
 package stevedore
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -23,6 +31,13 @@ type Client struct {
 	Build string
 	// HTTPClient is the underlying HTTP client (uses default if nil)
 	HTTPClient *http.Client
+	// SocketPath is the daemon's API socket when the client dials it instead
+	// of BaseURL's host
+	SocketPath string
+	// SlowTimeout replaces HTTPClient.Timeout for Check, Sync, Deploy and Exec,
+	// which wait for git or docker compose (default: DefaultAPISlowTimeout).
+	// It should be at least the daemon's STEVEDORE_API_SLOW_TIMEOUT.
+	SlowTimeout time.Duration
 }
 
 // NewClient creates a new client for communicating with the daemon.
@@ -38,6 +53,88 @@ func NewClient(baseURL, adminKey, version, build string) *Client {
 	}
 }
 
+// NewLocalClient creates a client for the daemon on this host listening on
+// listenAddr (DefaultListenAddr when empty). A wildcard address is reached via
+// localhost. With tlsCertFile the client uses HTTPS and trusts that
+// certificate in addition to the system roots.
+func NewLocalClient(listenAddr, tlsCertFile, adminKey, version, build string) (*Client, error) {
+	if listenAddr == "" {
+		listenAddr = DefaultListenAddr
+	}
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %w", listenAddr, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+
+	client := NewClient("http://"+net.JoinHostPort(host, port), adminKey, version, build)
+	if tlsCertFile == "" {
+		return client, nil
+	}
+
+	tlsConfig, err := localTLSConfig(tlsCertFile, host)
+	if err != nil {
+		return nil, err
+	}
+	client.BaseURL = "https://" + net.JoinHostPort(host, port)
+	client.HTTPClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	return client, nil
+}
+
+// NewSocketClient creates a client for the daemon's API socket
+// (STEVEDORE_API_SOCKET). Requests carry the same admin key and version
+// headers as over TCP.
+func NewSocketClient(socketPath, adminKey, version, build string) *Client {
+	client := NewClient("http://stevedore", adminKey, version, build)
+	client.SocketPath = socketPath
+	client.HTTPClient.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return client
+}
+
+// Endpoint describes where the client reaches the daemon, for diagnostics.
+func (c *Client) Endpoint() string {
+	if c.SocketPath != "" {
+		return "unix://" + c.SocketPath
+	}
+	return c.BaseURL
+}
+
+// localTLSConfig trusts the daemon's certificate. Local clients dial localhost,
+// so a certificate issued for the public name is checked against that name.
+func localTLSConfig(certFile string, host string) (*tls.Config, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("read TLS certificate: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM certificate in %s", certFile)
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse TLS certificate: %w", err)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	roots.AppendCertsFromPEM(data)
+
+	config := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	if leaf.VerifyHostname(host) != nil && len(leaf.DNSNames) > 0 {
+		config.ServerName = leaf.DNSNames[0]
+	}
+	return config, nil
+}
+
 // APICheckResult represents the result of a check operation from the API.
 type APICheckResult struct {
 	Deployment    string `json:"deployment"`
@@ -45,6 +142,14 @@ type APICheckResult struct {
 	RemoteCommit  string `json:"remoteCommit"`
 	HasChanges    bool   `json:"hasChanges"`
 	Branch        string `json:"branch"`
+	TagPattern    string `json:"tagPattern,omitempty"`
+	CurrentTag    string `json:"currentTag,omitempty"`
+	RemoteTag     string `json:"remoteTag,omitempty"`
+	// CommitsBehind/CommitsAhead and PendingCommits are set in branch mode
+	// when the histories could be compared
+	CommitsBehind  int      `json:"commitsBehind,omitempty"`
+	CommitsAhead   int      `json:"commitsAhead,omitempty"`
+	PendingCommits []string `json:"pendingCommits,omitempty"`
 }
 
 // APISyncResult represents the result of a sync operation from the API.
@@ -52,16 +157,43 @@ type APISyncResult struct {
 	Deployment string `json:"deployment"`
 	Commit     string `json:"commit"`
 	Branch     string `json:"branch"`
+	Tag        string `json:"tag,omitempty"`
 	Synced     bool   `json:"synced"`
 }
 
 // APIDeployResult represents the result of a deploy operation from the API.
 type APIDeployResult struct {
-	Deployment  string   `json:"deployment"`
-	ProjectName string   `json:"projectName"`
-	ComposeFile string   `json:"composeFile"`
-	Services    []string `json:"services"`
-	Deployed    bool     `json:"deployed"`
+	Deployment  string             `json:"deployment"`
+	ProjectName string             `json:"projectName"`
+	ComposeFile string             `json:"composeFile"`
+	Services    []string           `json:"services"`
+	Hooks       []APIHookResult    `json:"hooks"`
+	Timings     []APIServiceTiming `json:"timings"`
+	Deployed    bool               `json:"deployed"`
+}
+
+// APIServiceTiming represents when a container came up during a deploy,
+// in milliseconds since `docker compose up` began.
+type APIServiceTiming struct {
+	Service   string `json:"service"`
+	Container string `json:"container"`
+	StartedMs int64  `json:"startedMs"`
+	HealthyMs int64  `json:"healthyMs,omitempty"`
+	Unchanged bool   `json:"unchanged,omitempty"`
+}
+
+// APIHookResult represents a lifecycle hook run reported by the API.
+type APIHookResult struct {
+	Name       string `json:"name"`
+	Output     string `json:"output"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// APICancelResult represents the result of a cancel request from the API.
+type APICancelResult struct {
+	Deployment string `json:"deployment"`
+	Cancelled  bool   `json:"cancelled"`
 }
 
 // APIHealthResult represents the result of a health check from the API.
@@ -71,6 +203,19 @@ type APIHealthResult struct {
 	Build   string `json:"build"`
 }
 
+// APIReadyResult represents the readiness of the daemon (GET /readyz).
+type APIReadyResult struct {
+	Status     string          `json:"status"` // "ready" or "not_ready"
+	Version    string          `json:"version"`
+	Build      string          `json:"build"`
+	Subsystems map[string]bool `json:"subsystems"`
+}
+
+// Ready reports whether every subsystem is ready.
+func (r *APIReadyResult) Ready() bool {
+	return r.Status == "ready"
+}
+
 // ClientError represents an error from the daemon API.
 type ClientError struct {
 	StatusCode int
@@ -120,6 +265,41 @@ func (c *Client) Health(ctx context.Context) (*APIHealthResult, error) {
 	return &result, nil
 }
 
+// Readiness returns the readiness of the daemon. A daemon that is up but not
+// ready yet (503) is not an error: check APIReadyResult.Ready. This does not
+// require authentication.
+func (c *Client) Readiness(ctx context.Context) (*APIReadyResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/readyz", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, &ClientError{
+			StatusCode: resp.StatusCode,
+			Message:    string(body),
+		}
+	}
+
+	var result APIReadyResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	return &result, nil
+}
+
 // Check checks for updates for a deployment without modifying files.
 // This is safe to call while the deployment is running.
 func (c *Client) Check(ctx context.Context, deployment string) (*APICheckResult, error) {
@@ -130,7 +310,7 @@ func (c *Client) Check(ctx context.Context, deployment string) (*APICheckResult,
 
 	c.addHeaders(req)
 
-	resp, err := c.httpClient().Do(req)
+	resp, err := c.slowHTTPClient().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -162,7 +342,7 @@ func (c *Client) Sync(ctx context.Context, deployment string) (*APISyncResult, e
 
 	c.addHeaders(req)
 
-	resp, err := c.httpClient().Do(req)
+	resp, err := c.slowHTTPClient().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -194,7 +374,7 @@ func (c *Client) Deploy(ctx context.Context, deployment string) (*APIDeployResul
 
 	c.addHeaders(req)
 
-	resp, err := c.httpClient().Do(req)
+	resp, err := c.slowHTTPClient().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -217,6 +397,182 @@ func (c *Client) Deploy(ctx context.Context, deployment string) (*APIDeployResul
 	return &result, nil
 }
 
+// DeployAsync starts a deploy in the background and returns its job right
+// away; poll it with Job or WaitForJob.
+func (c *Client) DeployAsync(ctx context.Context, deployment string) (*DeployJob, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/deploy/"+deployment+"?async=true", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	c.addHeaders(req)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, c.parseError(resp.StatusCode, body)
+	}
+
+	var job DeployJob
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	return &job, nil
+}
+
+// Job returns the current state of a deploy job.
+func (c *Client) Job(ctx context.Context, id string) (*DeployJob, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/jobs/"+id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	c.addHeaders(req)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.parseError(resp.StatusCode, body)
+	}
+
+	var job DeployJob
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	return &job, nil
+}
+
+// FollowJobOutput copies the compose output of a deploy job to w as the
+// daemon streams it (GET /api/jobs/{id}/output) and returns the job once it
+// has finished.
+func (c *Client) FollowJobOutput(ctx context.Context, id string, w io.Writer) (*DeployJob, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/jobs/"+id+"/output", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	c.addHeaders(req)
+
+	// The stream lasts as long as the deploy, which is bounded by the context
+	client := *c.httpClient()
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read response: %w", err)
+		}
+		return nil, c.parseError(resp.StatusCode, body)
+	}
+
+	var event string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "output":
+			if _, err := fmt.Fprintln(w, strings.TrimPrefix(line, "data: ")); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "data: ") && event == "done":
+			var job DeployJob
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &job); err != nil {
+				return nil, fmt.Errorf("parse response: %w", err)
+			}
+			return &job, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	return nil, errors.New("job output ended before the job finished")
+}
+
+// WaitForJob polls a deploy job every interval until it finishes, calling
+// progress (if set) whenever its status or progress changes.
+func (c *Client) WaitForJob(ctx context.Context, id string, interval time.Duration, progress func(*DeployJob)) (*DeployJob, error) {
+	var last string
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if state := string(job.Status) + job.Progress; progress != nil && state != last {
+			progress(job)
+			last = state
+		}
+		if job.Status.Done() {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Cancel cancels the sync or deploy the daemon is running for a deployment.
+func (c *Client) Cancel(ctx context.Context, deployment string) (*APICancelResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/cancel/"+deployment, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	c.addHeaders(req)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.parseError(resp.StatusCode, body)
+	}
+
+	var result APICancelResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	return &result, nil
+}
+
 // Exec executes a CLI command inside the daemon process.
 // Returns the output, exit code, and any error from the daemon.
 func (c *Client) Exec(ctx context.Context, args []string) (output string, exitCode int, err error) {
@@ -234,7 +590,7 @@ func (c *Client) Exec(ctx context.Context, args []string) (output string, exitCo
 	c.addHeaders(req)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient().Do(req)
+	resp, err := c.slowHTTPClient().Do(req)
 	if err != nil {
 		return "", 1, fmt.Errorf("request failed: %w", err)
 	}
@@ -299,6 +655,20 @@ func (c *Client) httpClient() *http.Client {
 	return http.DefaultClient
 }
 
+// slowHTTPClient returns the HTTP client for requests that wait for git or
+// docker compose: httpClient with its timeout raised to SlowTimeout.
+func (c *Client) slowHTTPClient() *http.Client {
+	client := *c.httpClient()
+	timeout := c.SlowTimeout
+	if timeout <= 0 {
+		timeout = DefaultAPISlowTimeout
+	}
+	if client.Timeout != 0 && client.Timeout < timeout {
+		client.Timeout = timeout
+	}
+	return &client
+}
+
 // parseError parses an error response from the daemon.
 func (c *Client) parseError(statusCode int, body []byte) error {
 	var errResp struct {
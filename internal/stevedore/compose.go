@@ -3,12 +3,16 @@ package stevedore
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -53,6 +57,115 @@ type ComposeConfig struct {
 	// Set to true for deploy-after-sync (source code changed).
 	// Set to false for reconcile restarts (just restart existing images).
 	Build bool
+	// StopTimeout is passed to `docker compose down --timeout`: how long
+	// containers get to shut down before they are killed. Zero falls back to
+	// the deployment's STEVEDORE_STOP_TIMEOUT parameter, then docker's default (10s).
+	StopTimeout time.Duration
+	// ForceRecreate recreates every container (--force-recreate), even when
+	// compose considers it up to date. Used to converge drifted deployments
+	// and by `deploy up --force-recreate`.
+	ForceRecreate bool
+	// NoRecreate only creates and starts missing containers (--no-recreate);
+	// existing ones keep running even if their configuration or image changed.
+	// Set by `deploy up --no-recreate`; excludes ForceRecreate.
+	NoRecreate bool
+	// SkipUnchanged skips the deploy when the rendered compose file,
+	// parameters, build args and commit match the last successful deploy and
+	// all containers are running. Used by manual `deploy up` without --force.
+	SkipUnchanged bool
+	// NoCache rebuilds images without the layer cache (`deploy up --no-cache`),
+	// in addition to the deployment's STEVEDORE_BUILD_NO_CACHE parameter.
+	NoCache bool
+	// RemoveVolumes also removes the project's named and anonymous volumes on
+	// Stop (`docker compose down -v`). Bind mounts such as the deployment's
+	// data directory are not affected. Set by `deploy down --volumes`.
+	RemoveVolumes bool
+	// RemoveImages removes images on Stop (`docker compose down --rmi`):
+	// "local" for images built by the deployment, "all" for every image its
+	// services use. Empty keeps them. Set by `deploy down --rmi`.
+	RemoveImages string
+	// NoRepoEnv ignores the `.env` file committed next to the compose file
+	// (`deploy up --no-repo-env`), in addition to the deployment's
+	// STEVEDORE_NO_REPO_ENV parameter.
+	NoRepoEnv bool
+	// Output receives the output of `docker compose build` and `up` as they
+	// run, with the deployment's secrets redacted, for `deploy up` on a
+	// terminal and GET /api/jobs/{id}/output. Nil keeps it captured only.
+	Output io.Writer
+}
+
+// teeOutput returns buf, also copying to output when it is set.
+func teeOutput(buf *bytes.Buffer, output io.Writer) io.Writer {
+	if output == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, output)
+}
+
+// recreateArgs returns the `docker compose up` flags that choose which
+// containers are recreated; without either, compose recreates changed ones.
+func recreateArgs(config ComposeConfig) []string {
+	switch {
+	case config.ForceRecreate:
+		return []string{"--force-recreate"}
+	case config.NoRecreate:
+		return []string{"--no-recreate"}
+	}
+	return nil
+}
+
+// downArgs returns the `docker compose down` flags that remove volumes and
+// images; without them, down only removes containers and networks.
+func downArgs(config ComposeConfig) ([]string, error) {
+	var args []string
+	if config.RemoveVolumes {
+		args = append(args, "--volumes")
+	}
+	switch config.RemoveImages {
+	case "":
+	case "local", "all":
+		args = append(args, "--rmi", config.RemoveImages)
+	default:
+		return nil, fmt.Errorf("invalid --rmi value %q: expected local or all", config.RemoveImages)
+	}
+	return args, nil
+}
+
+// ParamStopTimeout is the deployment parameter holding the default stop
+// timeout, as a duration ("60s", "2m") or a number of seconds.
+const ParamStopTimeout = "STEVEDORE_STOP_TIMEOUT"
+
+// ParseStopTimeout parses a stop timeout given as a duration or whole seconds.
+func ParseStopTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid stop timeout: %q (expected a duration like 60s or a number of seconds)", value)
+	}
+	return d, nil
+}
+
+// stopTimeout returns the explicit stop timeout or the deployment's default.
+// Zero means docker's default. An invalid parameter only logs a warning so it
+// can never prevent a deployment from being stopped.
+func (i *Instance) stopTimeout(deployment string, config ComposeConfig) time.Duration {
+	if config.StopTimeout > 0 {
+		return config.StopTimeout
+	}
+	value, err := i.GetParameter(deployment, ParamStopTimeout)
+	if err != nil {
+		// Not set (or no parameters at all): use docker's default
+		return 0
+	}
+	d, err := ParseStopTimeout(string(value))
+	if err != nil {
+		log.Printf("Warning: ignoring parameter %s of %s: %v", ParamStopTimeout, deployment, err)
+		return 0
+	}
+	return d
 }
 
 // DefaultComposeConfig returns the default configuration for Compose.
@@ -70,16 +183,63 @@ type DeployResult struct {
 	ProjectName string
 	// Services is the list of services defined
 	Services []string
+	// Hooks holds the pre- and post-deploy hooks that ran, in order
+	Hooks []HookResult
+	// Timings holds each container's start (and health) time in start order,
+	// best-effort
+	Timings []ServiceTiming
+	// Skipped is set when nothing changed since the last deploy (ComposeConfig.SkipUnchanged)
+	Skipped bool
+	// Images lists the digests services were pinned to (ParamPinDigests)
+	Images []ImageDigest
 }
 
-// Deploy runs docker compose up for a deployment.
+// Deploy runs docker compose up for a deployment and records the outcome in
+// its deploy history.
 func (i *Instance) Deploy(ctx context.Context, deployment string, config ComposeConfig) (*DeployResult, error) {
 	if err := ValidateDeploymentName(deployment); err != nil {
 		return nil, err
 	}
+	if config.ForceRecreate && config.NoRecreate {
+		return nil, fmt.Errorf("--force-recreate and --no-recreate are mutually exclusive")
+	}
+
+	if config.Output != nil {
+		output := i.secretRedactor(deployment).writer(config.Output)
+		defer func() { _ = output.Flush() }()
+		config.Output = output
+	}
+
+	startedAt := time.Now()
+	result, err := i.deploy(ctx, deployment, config)
+	// Errors and hook output may quote the rendered compose file or env
+	if err != nil || (result != nil && len(result.Hooks) > 0) {
+		redactor := i.secretRedactor(deployment)
+		err = redactor.error(err)
+		if result != nil {
+			for idx := range result.Hooks {
+				result.Hooks[idx].Output = redactor.text(result.Hooks[idx].Output)
+				result.Hooks[idx].Error = redactor.text(result.Hooks[idx].Error)
+			}
+		}
+	}
+	if err == nil && result.Skipped {
+		return result, nil
+	}
+	var images []ImageDigest
+	if result != nil {
+		images = result.Images
+	}
+	// Every deploy lands in the history, whoever started it
+	if recordErr := i.recordDeploy(deployment, startedAt, time.Now(), images, err); recordErr != nil {
+		log.Printf("Warning: failed to record deploy history for %s: %v", deployment, recordErr)
+	}
+	return result, err
+}
 
+func (i *Instance) deploy(ctx context.Context, deployment string, config ComposeConfig) (*DeployResult, error) {
 	deploymentDir := i.DeploymentDir(deployment)
-	gitDir := filepath.Join(deploymentDir, "repo", "git")
+	gitDir := i.composeDir(deployment)
 
 	// Check if repo exists
 	if _, err := os.Stat(gitDir); err != nil {
@@ -91,6 +251,14 @@ func (i *Instance) Deploy(ctx context.Context, deployment string, config Compose
 	if err != nil {
 		return nil, err
 	}
+	// The profile's override is layered over it
+	composeFiles, err := i.composeFiles(deployment, composePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(composeFiles) > 1 {
+		log.Printf("Applying profile override %s to %s", filepath.Base(composeFiles[1]), deployment)
+	}
 
 	if config.Timeout == 0 {
 		config.Timeout = DefaultComposeConfig().Timeout
@@ -115,55 +283,178 @@ func (i *Instance) Deploy(ctx context.Context, deployment string, config Compose
 		return nil, fmt.Errorf("failed to create shared directory: %w", err)
 	}
 
+	env, err := i.composeEnv(deployment, composePath, config.NoRepoEnv)
+	if err != nil {
+		return nil, err
+	}
+	buildArgs, err := i.LoadBuildArgs(deployment)
+	if err != nil {
+		return nil, err
+	}
+	secretFiles, err := i.LoadSecretFiles(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fingerprint what this deploy applies, so an identical redeploy can be skipped
+	hash, lastHash, err := i.deployHashes(ctx, deployment, composePath, gitDir, env, buildArgs, secretFiles)
+	if err != nil {
+		log.Printf("Warning: cannot compute deploy hash for %s: %v", deployment, err)
+		hash = ""
+	}
+	if config.SkipUnchanged && hash != "" && hash == lastHash && i.containersRunning(ctx, deployment) {
+		services, _ := i.getComposeServices(ctx, composeFiles, projectName, gitDir)
+		return &DeployResult{
+			ComposeFile: filepath.Base(composePath),
+			ProjectName: projectName,
+			Services:    services,
+			Skipped:     true,
+		}, nil
+	}
+
 	// Enforce that every service enables `init: true` (or explicitly opts out
 	// via the `stevedore.init.required=false` label). This makes Docker use
 	// tini as PID 1 inside each container, which reaps orphans that would
 	// otherwise accumulate as zombies and exhaust the cgroup PID limit.
-	if err := i.checkInitRequirement(ctx, composePath, projectName, gitDir); err != nil {
+	if err := i.checkInitRequirement(ctx, composeFiles, projectName, gitDir); err != nil {
 		return nil, err
 	}
 
-	// Run docker compose up
-	args := []string{
-		"compose",
-		"-f", composePath,
-		"-p", projectName,
-		"up", "-d",
+	// An unset ${VAR} would silently become empty in the running containers
+	if err := i.checkComposeVariables(deployment, composeFiles, env); err != nil {
+		return nil, err
+	}
+
+	// Fail early with a clear error instead of a half-finished build on a full disk
+	if err := i.EnsureDiskSpace(ctx); err != nil {
+		return nil, err
+	}
+
+	// Secret files must exist before hooks and compose mount them
+	if err := i.writeSecretFiles(deployment, secretFiles); err != nil {
+		return nil, err
+	}
+
+	// Log in to private registries so compose can pull their images. The
+	// logins live in a docker config of this deploy, passed on through env
+	registryEnv, logout, err := i.registryLoginAll(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+	env = append(env, registryEnv...)
+
+	buildOpts := i.LoadBuildOptions(deployment)
+	if config.NoCache {
+		buildOpts.NoCache = true
 	}
-	if config.Build {
+
+	// `compose up` cannot pass build args, so images are built in a separate
+	// step whenever build args are configured. This also covers the first
+	// deploy, where `up` would otherwise build missing images without them.
+	// Cache options need the same step, but only when a build was asked for.
+	explicitBuild := len(buildArgs) > 0 || (buildOpts.tuned() && (config.Build || config.NoCache))
+	if explicitBuild {
+		if err := i.composeBuild(ctx, composeFiles, projectName, gitDir, env, buildArgs, buildOpts, config.Output); err != nil {
+			return nil, err
+		}
+	}
+
+	var hooks []HookResult
+	preDeploy, err := i.runHook(ctx, deployment, HookPreDeploy, composePath, env)
+	if err != nil {
+		return nil, err
+	}
+	if preDeploy != nil {
+		hooks = append(hooks, *preDeploy)
+		if preDeploy.Error != "" {
+			return nil, fmt.Errorf("%s hook failed: %s: %s", HookPreDeploy, preDeploy.Error, strings.TrimSpace(preDeploy.Output))
+		}
+	}
+
+	// Only services labeled stevedore.api.enabled=true get the query socket
+	queryOverride, queryServices, err := i.querySocketOverride(ctx, deployment, composeFiles, projectName, gitDir)
+	if err != nil {
+		return nil, err
+	}
+	args := composeFileArgs(composeFiles)
+	if queryOverride != "" {
+		defer func() { _ = os.Remove(queryOverride) }()
+		args = append(args, "-f", queryOverride)
+		log.Printf("Query socket mounted into %s services: %s", deployment, strings.Join(queryServices, ", "))
+	}
+
+	// Run registry images by the digest their tag points at right now
+	var images []ImageDigest
+	if envBool(env, ParamPinDigests) {
+		digestOverride, pinned, err := i.pinImageDigests(ctx, composeFiles, projectName, gitDir, env)
+		if err != nil {
+			return nil, err
+		}
+		if digestOverride != "" {
+			defer func() { _ = os.Remove(digestOverride) }()
+			args = append(args, "-f", digestOverride)
+			for _, image := range pinned {
+				log.Printf("Pinned %s of %s to %s", image.Service, deployment, image.Digest)
+			}
+		}
+		images = pinned
+	}
+
+	// Run docker compose up
+	args = append(args, "-p", projectName, "up", "-d")
+	if config.Build && !explicitBuild {
 		// --build ensures images are rebuilt when source code changes (deploy after sync)
 		args = append(args, "--build")
 	}
+	args = append(args, recreateArgs(config)...)
+	// Replica overrides from `deploy scale` survive every redeploy
+	scales, err := i.loadServiceScales(deployment)
+	if err != nil {
+		log.Printf("Warning: ignoring scale overrides of %s: %v", deployment, err)
+	}
+	if len(scales) > 0 {
+		services, err := i.getComposeServices(ctx, composeFiles, projectName, gitDir)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, composeScaleArgs(scales, services)...)
+	}
 	args = append(args, "--remove-orphans")
 
-	cmd := newCommand(ctx, "docker", args...)
+	cmd := newComposeCommand(ctx, args...)
 	cmd.Dir = gitDir
-	cmd.Env = append(os.Environ(),
-		"STEVEDORE_DEPLOYMENT="+deployment,
-		"STEVEDORE_DATA="+dataDir,
-		"STEVEDORE_LOGS="+logsDir,
-		"STEVEDORE_SHARED="+sharedDir,
-	)
-
-	// Add parameters from database as environment variables
-	paramNames, _ := i.ListParameters(deployment)
-	for _, name := range paramNames {
-		value, err := i.GetParameter(deployment, name)
-		if err == nil {
-			cmd.Env = append(cmd.Env, name+"="+string(value))
-		}
-	}
+	cmd.Env = dockerCommandEnv(append(env, buildOpts.Env()...))
 
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd.Stdout = teeOutput(&stdout, config.Output)
+	cmd.Stderr = teeOutput(&stderr, config.Output)
 
+	// Rounded down to tolerate small clock differences with the docker engine
+	upStarted := time.Now().Truncate(time.Second)
 	if err := runCommand(cmd); err != nil {
-		return nil, fmt.Errorf("docker compose up failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		err = fmt.Errorf("docker compose up failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		return nil, i.withStartupLogs(ctx, deployment, nil, err)
+	}
+	timings := i.serviceTimings(ctx, projectName, upStarted)
+
+	if hash != "" {
+		if err := i.recordDeployHash(deployment, hash); err != nil {
+			log.Printf("Warning: failed to record deploy hash for %s: %v", deployment, err)
+		}
+	}
+
+	// The deployment is up: a failing post-deploy hook is reported, not fatal
+	postDeploy, err := i.runHook(ctx, deployment, HookPostDeploy, composePath, env)
+	if err != nil {
+		log.Printf("Warning: %s hook for %s: %v", HookPostDeploy, deployment, err)
+	}
+	if postDeploy != nil {
+		hooks = append(hooks, *postDeploy)
 	}
 
 	// Get list of services
-	services, err := i.getComposeServices(ctx, composePath, projectName, gitDir)
+	services, err := i.getComposeServices(ctx, composeFiles, projectName, gitDir)
 	if err != nil {
 		// Non-fatal - we deployed successfully
 		services = nil
@@ -173,6 +464,9 @@ func (i *Instance) Deploy(ctx context.Context, deployment string, config Compose
 		ComposeFile: filepath.Base(composePath),
 		ProjectName: projectName,
 		Services:    services,
+		Hooks:       hooks,
+		Timings:     timings,
+		Images:      images,
 	}, nil
 }
 
@@ -182,12 +476,22 @@ func (i *Instance) Stop(ctx context.Context, deployment string, config ComposeCo
 		return err
 	}
 
-	deploymentDir := i.DeploymentDir(deployment)
-	gitDir := filepath.Join(deploymentDir, "repo", "git")
+	removeArgs, err := downArgs(config)
+	if err != nil {
+		return err
+	}
+
+	gitDir := i.composeDir(deployment)
+
+	stopTimeout := i.stopTimeout(deployment, config)
 
 	if config.Timeout == 0 {
 		config.Timeout = DefaultComposeConfig().Timeout
 	}
+	// Never cut a graceful shutdown short with the command timeout
+	if minTimeout := stopTimeout + time.Minute; config.Timeout < minTimeout {
+		config.Timeout = minTimeout
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
 	defer cancel()
@@ -197,10 +501,18 @@ func (i *Instance) Stop(ctx context.Context, deployment string, config ComposeCo
 	// Try to find compose file for cleaner shutdown
 	composePath, _ := FindComposeEntrypoint(gitDir)
 
+	// A failing pre-stop hook must not keep the deployment from stopping
+	if env, err := i.deploymentEnv(deployment); err != nil {
+		log.Printf("Warning: skipping %s hook for %s: %v", HookPreStop, deployment, err)
+	} else if hook, err := i.runHook(ctx, deployment, HookPreStop, composePath, env); err != nil {
+		log.Printf("Warning: %s hook for %s: %v", HookPreStop, deployment, err)
+	} else if hook != nil && hook.Error != "" {
+		log.Printf("Warning: %s hook for %s failed: %s\n%s", HookPreStop, deployment, hook.Error, strings.TrimSpace(hook.Output))
+	}
+
 	var args []string
 	if composePath != "" {
 		args = []string{
-			"compose",
 			"-f", composePath,
 			"-p", projectName,
 			"down",
@@ -209,14 +521,17 @@ func (i *Instance) Stop(ctx context.Context, deployment string, config ComposeCo
 	} else {
 		// Fallback: stop by project name only
 		args = []string{
-			"compose",
 			"-p", projectName,
 			"down",
 			"--remove-orphans",
 		}
 	}
+	if stopTimeout > 0 {
+		args = append(args, "--timeout", strconv.Itoa(int(math.Ceil(stopTimeout.Seconds()))))
+	}
+	args = append(args, removeArgs...)
 
-	cmd := newCommand(ctx, "docker", args...)
+	cmd := newComposeCommand(ctx, args...)
 	if composePath != "" {
 		cmd.Dir = gitDir
 	}
@@ -228,19 +543,15 @@ func (i *Instance) Stop(ctx context.Context, deployment string, config ComposeCo
 		return fmt.Errorf("docker compose down failed: %w: %s", err, strings.TrimSpace(stderr.String()))
 	}
 
-	return nil
+	// Secret files only live while the deployment runs
+	return i.removeSecretFiles(deployment)
 }
 
 // getComposeServices returns the list of services in a compose file.
-func (i *Instance) getComposeServices(ctx context.Context, composePath, projectName, workDir string) ([]string, error) {
-	args := []string{
-		"compose",
-		"-f", composePath,
-		"-p", projectName,
-		"config", "--services",
-	}
+func (i *Instance) getComposeServices(ctx context.Context, composeFiles []string, projectName, workDir string) ([]string, error) {
+	args := append(composeFileArgs(composeFiles), "-p", projectName, "config", "--services")
 
-	cmd := newCommand(ctx, "docker", args...)
+	cmd := newComposeCommand(ctx, args...)
 	cmd.Dir = workDir
 
 	var stdout, stderr bytes.Buffer
@@ -261,9 +572,40 @@ func (i *Instance) getComposeServices(ctx context.Context, composePath, projectN
 	return services, nil
 }
 
+// ProjectPrefixEnvVar sets the compose project name prefix of an instance,
+// so several stevedore instances can share one docker engine.
+const ProjectPrefixEnvVar = "STEVEDORE_PROJECT_PREFIX"
+
+// DefaultProjectPrefix is the compose project name prefix unless
+// STEVEDORE_PROJECT_PREFIX sets another.
+const DefaultProjectPrefix = "stevedore-"
+
+// projectPrefixRe matches a compose project name prefix: lowercase letters,
+// digits, `_` and `-`, starting with a letter or digit, as compose requires
+// of project names.
+var projectPrefixRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidateProjectPrefix checks a compose project name prefix.
+func ValidateProjectPrefix(prefix string) error {
+	if !projectPrefixRe.MatchString(prefix) {
+		return fmt.Errorf("invalid %s: %q (lowercase letters, digits, '_' and '-', starting with a letter or digit)", ProjectPrefixEnvVar, prefix)
+	}
+	return nil
+}
+
+// ProjectPrefix returns the compose project name prefix of this instance:
+// STEVEDORE_PROJECT_PREFIX, or DefaultProjectPrefix when it is unset or
+// invalid (the daemon refuses to start with an invalid one).
+func ProjectPrefix() string {
+	if prefix := strings.TrimSpace(os.Getenv(ProjectPrefixEnvVar)); prefix != "" && ValidateProjectPrefix(prefix) == nil {
+		return prefix
+	}
+	return DefaultProjectPrefix
+}
+
 // ComposeProjectName generates the compose project name for a deployment.
 func ComposeProjectName(deployment string) string {
-	return "stevedore-" + deployment
+	return ProjectPrefix() + deployment
 }
 
 // InitEnforceLabel names a Compose service label that opts out of the `init: true`
@@ -278,8 +620,8 @@ const InitEnforceLabel = "stevedore.init.enforce"
 // service has `init: true` set, or opts out via the InitEnforceLabel label set
 // to "false". On failure, returns an error that names the offending services
 // and instructs how to fix them.
-func (i *Instance) checkInitRequirement(ctx context.Context, composePath, projectName, gitDir string) error {
-	services, err := parseComposeServicesJSON(ctx, composePath, projectName, gitDir)
+func (i *Instance) checkInitRequirement(ctx context.Context, composeFiles []string, projectName, gitDir string) error {
+	services, err := resolveComposeServices(ctx, composeFiles, projectName, gitDir)
 	if err != nil {
 		return fmt.Errorf("failed to resolve compose services for init check: %w", err)
 	}
@@ -308,23 +650,22 @@ func (i *Instance) checkInitRequirement(ctx context.Context, composePath, projec
 	)
 }
 
-// composeConfigService is the subset of `docker compose config --format json`
-// output that the init-enforcement check needs.
+// composeConfigService is the subset of the resolved compose configuration
+// (`docker compose config`) that the init-enforcement check, drift detection
+// and build cache sources need.
 type composeConfigService struct {
-	Init   *bool             `json:"init"`
-	Labels map[string]string `json:"labels"`
+	Image  string            `json:"image" yaml:"image"`
+	Init   *bool             `json:"init" yaml:"init"`
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	Build  any               `json:"build" yaml:"build"`
 }
 
-// parseComposeServicesJSON runs `docker compose config --format json` and
-// returns a name → service-config map for use by the init check.
-func parseComposeServicesJSON(ctx context.Context, composePath, projectName, gitDir string) (map[string]composeConfigService, error) {
-	args := []string{
-		"compose",
-		"-f", composePath,
-		"-p", projectName,
-		"config", "--format", "json",
-	}
-	cmd := newCommand(ctx, "docker", args...)
+// resolveComposeServices runs `docker compose config` and returns a
+// name → service-config map for use by the init check and drift detection.
+func resolveComposeServices(ctx context.Context, composeFiles []string, projectName, gitDir string) (map[string]composeConfigService, error) {
+	args := append(composeFileArgs(composeFiles), "-p", projectName)
+	args = append(args, composeConfigArgs(ctx)...)
+	cmd := newComposeCommand(ctx, args...)
 	cmd.Dir = gitDir
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -332,14 +673,7 @@ func parseComposeServicesJSON(ctx context.Context, composePath, projectName, git
 	if err := runCommand(cmd); err != nil {
 		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
 	}
-
-	var parsed struct {
-		Services map[string]composeConfigService `json:"services"`
-	}
-	if err := json.Unmarshal(stdout.Bytes(), &parsed); err != nil {
-		return nil, fmt.Errorf("parse compose config json: %w", err)
-	}
-	return parsed.Services, nil
+	return parseComposeConfigServices(stdout.Bytes())
 }
 
 // servicesMissingInit returns the sorted names of services that neither enable
@@ -0,0 +1,111 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ComposeCLI is the Compose implementation docker compose commands run with:
+// the `docker compose` plugin or, on hosts that have not migrated, the legacy
+// `docker-compose` v1 binary.
+type ComposeCLI struct {
+	// Command is the executable: DockerBinary() or "docker-compose"
+	Command string
+	// Legacy is set for docker-compose v1
+	Legacy bool
+	// Version is the reported version, e.g. "2.29.1"
+	Version string
+}
+
+// String returns how the CLI is invoked, e.g. "docker compose".
+func (c ComposeCLI) String() string {
+	if c.Legacy {
+		return "docker-compose"
+	}
+	return c.Command + " compose"
+}
+
+// args prefixes Compose arguments with the plugin subcommand when needed.
+func (c ComposeCLI) args(args []string) []string {
+	if c.Legacy {
+		return args
+	}
+	return append([]string{"compose"}, args...)
+}
+
+// ErrComposeNotFound is returned when neither the compose plugin nor
+// docker-compose is available.
+var ErrComposeNotFound = errors.New("neither `docker compose` nor `docker-compose` is available")
+
+var (
+	composeCLIMu       sync.Mutex
+	detectedComposeCLI *ComposeCLI
+)
+
+// DetectComposeCLI finds the Compose implementation, preferring the plugin.
+// A successful detection is cached for the process; a failed one is retried
+// on the next call, so installing Compose does not need a daemon restart.
+func DetectComposeCLI(ctx context.Context) (ComposeCLI, error) {
+	composeCLIMu.Lock()
+	defer composeCLIMu.Unlock()
+	if detectedComposeCLI != nil {
+		return *detectedComposeCLI, nil
+	}
+
+	candidates := []ComposeCLI{{Command: DockerBinary()}, {Command: "docker-compose", Legacy: true}}
+	for _, cli := range candidates {
+		if _, err := exec.LookPath(cli.Command); err != nil {
+			continue
+		}
+		cmd := newCommand(ctx, cli.Command, cli.args([]string{"version", "--short"})...)
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		if err := runCommand(cmd); err != nil {
+			continue
+		}
+		cli.Version = strings.TrimPrefix(strings.TrimSpace(stdout.String()), "v")
+		detectedComposeCLI = &cli
+		return cli, nil
+	}
+	return ComposeCLI{}, ErrComposeNotFound
+}
+
+// newComposeCommand builds a Compose command with the detected CLI. When none
+// is found it falls back to the plugin, so the command fails with docker's own
+// error.
+func newComposeCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cli, err := DetectComposeCLI(ctx)
+	if err != nil {
+		cli = ComposeCLI{Command: DockerBinary()}
+	}
+	return newCommand(ctx, cli.Command, cli.args(args)...)
+}
+
+// composeConfigArgs returns the arguments that print the resolved compose
+// configuration: JSON from the plugin, YAML from docker-compose v1, which has
+// no --format. parseComposeConfigServices reads both.
+func composeConfigArgs(ctx context.Context) []string {
+	if cli, err := DetectComposeCLI(ctx); err == nil && cli.Legacy {
+		return []string{"config"}
+	}
+	return []string{"config", "--format", "json"}
+}
+
+// parseComposeConfigServices parses the services of a resolved compose
+// configuration. JSON is valid YAML, so one parser covers both CLIs.
+func parseComposeConfigServices(data []byte) (map[string]composeConfigService, error) {
+	var parsed struct {
+		Services map[string]composeConfigService `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("parse compose config: %w", err)
+	}
+	return parsed.Services, nil
+}
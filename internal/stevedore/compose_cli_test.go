@@ -0,0 +1,88 @@
+package stevedore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectComposeCLI_LegacyFallback(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1 $2\" = \"version --short\" ] && echo 1.29.2\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker-compose"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// No docker binary: only docker-compose v1 is available
+	t.Setenv("PATH", bin)
+	t.Cleanup(func() { detectedComposeCLI = nil })
+
+	cli, err := DetectComposeCLI(context.Background())
+	if err != nil {
+		t.Fatalf("DetectComposeCLI: %v", err)
+	}
+	if !cli.Legacy || cli.Command != "docker-compose" || cli.Version != "1.29.2" {
+		t.Errorf("cli = %+v, want legacy docker-compose 1.29.2", cli)
+	}
+	cmd := newComposeCommand(context.Background(), "-p", "stevedore-app", "up", "-d")
+	if want := []string{"docker-compose", "-p", "stevedore-app", "up", "-d"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("args = %v, want %v", cmd.Args, want)
+	}
+	if got := composeConfigArgs(context.Background()); !reflect.DeepEqual(got, []string{"config"}) {
+		t.Errorf("composeConfigArgs = %v, want [config]", got)
+	}
+}
+
+func TestDetectComposeCLI_NotFound(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	t.Cleanup(func() { detectedComposeCLI = nil })
+
+	if _, err := DetectComposeCLI(context.Background()); err != ErrComposeNotFound {
+		t.Fatalf("DetectComposeCLI error = %v, want ErrComposeNotFound", err)
+	}
+	// Without any CLI, commands fall back to the plugin so docker reports the error
+	cmd := newComposeCommand(context.Background(), "up", "-d")
+	if want := []string{"docker", "compose", "up", "-d"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("args = %v, want %v", cmd.Args, want)
+	}
+}
+
+func TestDetectComposeCLI_Podman(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1 $2 $3\" = \"compose version --short\" ] && echo 1.1.0\n"
+	if err := os.WriteFile(filepath.Join(bin, "podman"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	t.Setenv("STEVEDORE_DOCKER_BIN", "podman")
+	t.Cleanup(func() { detectedComposeCLI = nil })
+
+	cli, err := DetectComposeCLI(context.Background())
+	if err != nil {
+		t.Fatalf("DetectComposeCLI: %v", err)
+	}
+	if cli.Legacy || cli.Command != "podman" || cli.String() != "podman compose" {
+		t.Errorf("cli = %+v, want podman compose", cli)
+	}
+	cmd := newComposeCommand(context.Background(), "up", "-d")
+	if want := []string{"podman", "compose", "up", "-d"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("args = %v, want %v", cmd.Args, want)
+	}
+}
+
+func TestParseComposeConfigServices(t *testing.T) {
+	json := []byte(`{"name":"stevedore-app","services":{"web":{"image":"nginx:1.27","init":true,"labels":{"a":"b"}}}}`)
+	yaml := []byte("name: stevedore-app\nservices:\n  web:\n    image: nginx:1.27\n    init: true\n    labels:\n      a: b\n")
+
+	for name, data := range map[string][]byte{"json": json, "yaml": yaml} {
+		services, err := parseComposeConfigServices(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		web, ok := services["web"]
+		if !ok || web.Image != "nginx:1.27" || web.Init == nil || !*web.Init || web.Labels["a"] != "b" {
+			t.Errorf("%s: services = %+v", name, services)
+		}
+	}
+}
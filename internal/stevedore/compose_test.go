@@ -1,9 +1,13 @@
 package stevedore
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFindComposeEntrypoint_PrefersDockerComposeYAML(t *testing.T) {
@@ -130,3 +134,127 @@ func stringSlicesEqual(a, b []string) bool {
 	}
 	return true
 }
+
+func TestParseStopTimeout(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "60", want: 60 * time.Second},
+		{in: "90s", want: 90 * time.Second},
+		{in: "2m", want: 2 * time.Minute},
+		{in: " 0 ", want: 0},
+		{in: "-5s", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseStopTimeout(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseStopTimeout(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseStopTimeout(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStopTimeout_FallsBackToParameter(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	if got := instance.stopTimeout("app", ComposeConfig{}); got != 0 {
+		t.Errorf("without parameter = %v, want 0 (docker default)", got)
+	}
+
+	if err := instance.SetParameter("app", ParamStopTimeout, []byte("45s")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+	if got := instance.stopTimeout("app", ComposeConfig{}); got != 45*time.Second {
+		t.Errorf("with parameter = %v, want 45s", got)
+	}
+	if got := instance.stopTimeout("app", ComposeConfig{StopTimeout: time.Minute}); got != time.Minute {
+		t.Errorf("explicit timeout = %v, want 1m", got)
+	}
+
+	if err := instance.SetParameter("app", ParamStopTimeout, []byte("later")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+	if got := instance.stopTimeout("app", ComposeConfig{}); got != 0 {
+		t.Errorf("invalid parameter = %v, want 0", got)
+	}
+}
+
+func TestRecreateArgs(t *testing.T) {
+	tests := []struct {
+		config ComposeConfig
+		want   []string
+	}{
+		{ComposeConfig{}, nil},
+		{ComposeConfig{ForceRecreate: true}, []string{"--force-recreate"}},
+		{ComposeConfig{NoRecreate: true}, []string{"--no-recreate"}},
+	}
+	for _, tt := range tests {
+		if got := recreateArgs(tt.config); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("recreateArgs(%+v) = %v, want %v", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestDownArgs(t *testing.T) {
+	tests := []struct {
+		config ComposeConfig
+		want   []string
+	}{
+		{ComposeConfig{}, nil},
+		{ComposeConfig{RemoveVolumes: true}, []string{"--volumes"}},
+		{ComposeConfig{RemoveImages: "local"}, []string{"--rmi", "local"}},
+		{ComposeConfig{RemoveVolumes: true, RemoveImages: "all"}, []string{"--volumes", "--rmi", "all"}},
+	}
+	for _, tt := range tests {
+		got, err := downArgs(tt.config)
+		if err != nil {
+			t.Fatalf("downArgs(%+v): %v", tt.config, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("downArgs(%+v) = %v, want %v", tt.config, got, tt.want)
+		}
+	}
+
+	if _, err := downArgs(ComposeConfig{RemoveImages: "everything"}); err == nil {
+		t.Error("downArgs accepted an invalid --rmi value")
+	}
+}
+
+func TestDeploy_RejectsConflictingRecreateFlags(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	_, err := instance.Deploy(context.Background(), "app", ComposeConfig{ForceRecreate: true, NoRecreate: true})
+	if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("Deploy error = %v, want mutually exclusive", err)
+	}
+}
+
+func TestComposeProjectName_Prefix(t *testing.T) {
+	if got := ComposeProjectName("app"); got != "stevedore-app" {
+		t.Errorf("default ComposeProjectName = %q, want stevedore-app", got)
+	}
+
+	t.Setenv(ProjectPrefixEnvVar, "blue-")
+	if got := ComposeProjectName("app"); got != "blue-app" {
+		t.Errorf("ComposeProjectName with prefix blue- = %q, want blue-app", got)
+	}
+
+	for _, bad := range []string{"Blue-", "-blue", "blue.", "blue prefix"} {
+		if err := ValidateProjectPrefix(bad); err == nil {
+			t.Errorf("ValidateProjectPrefix(%q) = nil, want an error", bad)
+		}
+		t.Setenv(ProjectPrefixEnvVar, bad)
+		if got := ProjectPrefix(); got != DefaultProjectPrefix {
+			t.Errorf("ProjectPrefix with invalid %q = %q, want the default", bad, got)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ComposeValidation is the outcome of checking a deployment's compose file
+// without deploying it.
+type ComposeValidation struct {
+	Deployment  string   `json:"deployment"`
+	ComposeFile string   `json:"compose_file"`
+	Services    []string `json:"services,omitempty"`
+	// UnsetVariables are variables the file interpolates that neither the
+	// deployment's parameters nor the environment define
+	UnsetVariables []string `json:"unset_variables,omitempty"`
+	// MissingInit lists services `deploy up` would reject for lacking `init: true`
+	MissingInit []string `json:"missing_init,omitempty"`
+	// Warnings are other warnings printed by `docker compose config`
+	Warnings []string `json:"warnings,omitempty"`
+	// Error is why `docker compose config` rejected the file
+	Error string `json:"error,omitempty"`
+}
+
+// Valid reports whether the compose file would deploy as written.
+func (v *ComposeValidation) Valid() bool {
+	return v.Error == "" && len(v.UnsetVariables) == 0 && len(v.MissingInit) == 0
+}
+
+// Problems returns one line per issue found, for display.
+func (v *ComposeValidation) Problems() []string {
+	var problems []string
+	if v.Error != "" {
+		problems = append(problems, v.Error)
+	}
+	for _, name := range v.UnsetVariables {
+		problems = append(problems, fmt.Sprintf("variable %s is not set (define it with `param set`)", name))
+	}
+	if len(v.MissingInit) > 0 {
+		problems = append(problems, fmt.Sprintf("init: true is required on every service — missing in: %s", strings.Join(v.MissingInit, ", ")))
+	}
+	return problems
+}
+
+// unsetVariableWarning matches compose's warning for an undefined variable,
+// as `WARN[0000] The "X" variable is not set.`, in logfmt, where the quotes
+// are escaped, and as docker-compose v1 prints it, without quotes.
+var unsetVariableWarning = regexp.MustCompile(`The \\?"?([A-Za-z_][A-Za-z0-9_]*)\\?"? variable is not set`)
+
+// ValidateCompose runs `docker compose config` on the checked-out compose file
+// with the environment `deploy up` would use, and reports syntax and
+// interpolation errors, unset variables and services missing `init: true`.
+// The returned error is for failures to run the check at all.
+func (i *Instance) ValidateCompose(ctx context.Context, deployment string) (*ComposeValidation, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+
+	gitDir := i.composeDir(deployment)
+	if _, err := os.Stat(gitDir); err != nil {
+		return nil, fmt.Errorf("repository not checked out (run deploy sync first): %w", err)
+	}
+	composePath, err := FindComposeEntrypoint(gitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	composeFiles, err := i.composeFiles(deployment, composePath)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := i.composeEnv(deployment, composePath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append(composeFileArgs(composeFiles), "-p", ComposeProjectName(deployment))
+	args = append(args, composeConfigArgs(ctx)...)
+	cmd := newComposeCommand(ctx, args...)
+	cmd.Dir = gitDir
+	cmd.Env = dockerCommandEnv(env)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := runCommand(cmd)
+
+	result := &ComposeValidation{
+		Deployment:  deployment,
+		ComposeFile: filepath.Base(composePath),
+	}
+	// compose quotes interpolated values in its warnings and errors
+	redactor := i.secretRedactor(deployment)
+	unset, warnings, message := parseComposeConfigStderr(stderr.String())
+	result.UnsetVariables = unset
+	for _, warning := range warnings {
+		result.Warnings = append(result.Warnings, redactor.text(warning))
+	}
+	if runErr != nil {
+		if message == "" {
+			message = runErr.Error()
+		}
+		result.Error = redactor.text(message)
+		return result, nil
+	}
+
+	services, err := parseComposeConfigServices(stdout.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	for name := range services {
+		result.Services = append(result.Services, name)
+	}
+	sort.Strings(result.Services)
+	result.MissingInit = servicesMissingInit(services)
+	return result, nil
+}
+
+// parseComposeConfigStderr splits the stderr of `docker compose config` into
+// unset variables, other warnings and the remaining (error) text.
+func parseComposeConfigStderr(stderr string) (unset, warnings []string, message string) {
+	seen := make(map[string]bool)
+	var rest []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if m := unsetVariableWarning.FindStringSubmatch(line); m != nil {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				unset = append(unset, m[1])
+			}
+			continue
+		}
+		if warning, ok := composeWarning(line); ok {
+			warnings = append(warnings, warning)
+			continue
+		}
+		rest = append(rest, line)
+	}
+	sort.Strings(unset)
+	return unset, warnings, strings.Join(rest, "\n")
+}
+
+// composeWarning extracts the message of a compose warning line.
+func composeWarning(line string) (string, bool) {
+	if msg, ok := strings.CutPrefix(line, "WARNING: "); ok {
+		return msg, true
+	}
+	if strings.HasPrefix(line, "WARN[") {
+		if _, msg, ok := strings.Cut(line, "] "); ok {
+			return strings.TrimSpace(msg), true
+		}
+	}
+	if strings.Contains(line, "level=warning") {
+		if _, msg, ok := strings.Cut(line, "msg="); ok {
+			return strings.ReplaceAll(strings.Trim(msg, `"`), `\"`, `"`), true
+		}
+	}
+	return "", false
+}
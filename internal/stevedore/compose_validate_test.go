@@ -0,0 +1,57 @@
+package stevedore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseComposeConfigStderr(t *testing.T) {
+	stderr := `WARN[0000] The "DB_PASSWORD" variable is not set. Defaulting to a blank string.
+time="2026-03-01T12:00:00Z" level=warning msg="The \"API_TOKEN\" variable is not set. Defaulting to a blank string."
+WARN[0000] The "DB_PASSWORD" variable is not set. Defaulting to a blank string.
+WARNING: The SMTP_HOST variable is not set. Defaulting to a blank string.
+time="2026-03-01T12:00:00Z" level=warning msg="/repo/docker-compose.yaml: the attribute ` + "`version`" + ` is obsolete"
+service "web" refers to undefined volume data: invalid compose project
+`
+
+	unset, warnings, message := parseComposeConfigStderr(stderr)
+	if want := []string{"API_TOKEN", "DB_PASSWORD", "SMTP_HOST"}; !reflect.DeepEqual(unset, want) {
+		t.Errorf("unset = %v, want %v", unset, want)
+	}
+	if want := []string{"/repo/docker-compose.yaml: the attribute `version` is obsolete"}; !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %v, want %v", warnings, want)
+	}
+	if want := `service "web" refers to undefined volume data: invalid compose project`; message != want {
+		t.Errorf("message = %q, want %q", message, want)
+	}
+}
+
+func TestComposeValidation_Problems(t *testing.T) {
+	valid := &ComposeValidation{ComposeFile: "docker-compose.yaml", Services: []string{"web"}}
+	if !valid.Valid() || len(valid.Problems()) != 0 {
+		t.Errorf("expected a valid result without problems, got %v", valid.Problems())
+	}
+
+	invalid := &ComposeValidation{
+		ComposeFile:    "docker-compose.yaml",
+		UnsetVariables: []string{"API_TOKEN"},
+		MissingInit:    []string{"web", "worker"},
+	}
+	if invalid.Valid() {
+		t.Fatal("expected unset variables and missing init to be invalid")
+	}
+	want := []string{
+		"variable API_TOKEN is not set (define it with `param set`)",
+		"init: true is required on every service — missing in: web, worker",
+	}
+	if got := invalid.Problems(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Problems() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateCompose_NotCheckedOut(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.ValidateCompose(t.Context(), "app"); err == nil {
+		t.Fatal("expected an error for a deployment that was never synced")
+	}
+}
@@ -0,0 +1,124 @@
+package stevedore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeVariableRef matches compose interpolation: `$$` (a literal dollar),
+// `${NAME}` with an optional modifier (`:-default`, `-default`, `:?error`,
+// `:+alt`, ...), and bare `$NAME`.
+var composeVariableRef = regexp.MustCompile(`\$(?:\$|\{([A-Za-z_][A-Za-z0-9_]*)([^}]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// requiredComposeVariables returns the sorted names of the variables a compose
+// file interpolates without a modifier: they silently become empty when
+// unset. Variables with a default (`${X:-d}`) or an explicit error
+// (`${X:?msg}`, reported by compose itself) are not listed. Comments are
+// ignored.
+func requiredComposeVariables(data []byte) ([]string, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.ScalarNode {
+			for _, m := range composeVariableRef.FindAllStringSubmatch(n.Value, -1) {
+				name := m[1] + m[3]
+				if name != "" && m[2] == "" {
+					seen[name] = true
+				}
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(&root)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// dotEnvNames returns the variable names defined in a compose `.env` file.
+func dotEnvNames(path string) map[string]bool {
+	names := make(map[string]bool)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return names
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		if name, _, ok := strings.Cut(line, "="); ok {
+			names[strings.TrimSpace(name)] = true
+		}
+	}
+	return names
+}
+
+// unresolvedComposeVariables returns the variables the compose file requires
+// that neither env (the deployment's parameters, globals included), the
+// daemon's environment nor the project's `.env` file, unless env ignores it,
+// define.
+func unresolvedComposeVariables(composePath string, env []string) ([]string, error) {
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		return nil, err
+	}
+	required, err := requiredComposeVariables(data)
+	if err != nil || len(required) == 0 {
+		return nil, err
+	}
+
+	defined := make(map[string]bool)
+	if !repoEnvDisabled(env) {
+		defined = dotEnvNames(filepath.Join(filepath.Dir(composePath), ".env"))
+	}
+	for _, kv := range append(os.Environ(), env...) {
+		name, _, _ := strings.Cut(kv, "=")
+		defined[name] = true
+	}
+
+	var missing []string
+	for _, name := range required {
+		if !defined[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// checkComposeVariables fails a deploy whose compose files interpolate
+// variables nothing defines, instead of starting containers with empty values.
+func (i *Instance) checkComposeVariables(deployment string, composeFiles []string, env []string) error {
+	for _, composePath := range composeFiles {
+		missing, err := unresolvedComposeVariables(composePath, env)
+		if err != nil || len(missing) == 0 {
+			// Unreadable or malformed files are left for compose to report
+			continue
+		}
+		return fmt.Errorf("%s references unset variables: %s\n"+
+			"Set them with `stevedore param set %s <NAME> <value>` (or --global), or give a default with ${NAME:-default}",
+			filepath.Base(composePath), strings.Join(missing, ", "), deployment)
+	}
+	return nil
+}
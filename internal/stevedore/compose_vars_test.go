@@ -0,0 +1,62 @@
+package stevedore
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const composeWithVariables = `# ${IN_COMMENT} is not interpolated
+services:
+  web:
+    image: nginx:${NGINX_TAG}
+    init: true
+    environment:
+      API_KEY: ${API_KEY}
+      LOG_LEVEL: ${LOG_LEVEL:-info}
+      REGION: ${REGION-eu}
+      TOKEN: ${TOKEN:?set TOKEN}
+      PRICE: $$5
+      HOME_DIR: $HOME_DIR
+      DATA: ${STEVEDORE_DATA}
+`
+
+func TestRequiredComposeVariables(t *testing.T) {
+	names, err := requiredComposeVariables([]byte(composeWithVariables))
+	if err != nil {
+		t.Fatalf("requiredComposeVariables: %v", err)
+	}
+	want := []string{"API_KEY", "HOME_DIR", "NGINX_TAG", "STEVEDORE_DATA"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
+
+func TestCheckComposeVariables(t *testing.T) {
+	dir := t.TempDir()
+	composePath := filepath.Join(dir, "docker-compose.yaml")
+	if err := os.WriteFile(composePath, []byte(composeWithVariables), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("# defaults\nexport NGINX_TAG=1.27\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME_DIR", "/home/app")
+	instance := NewInstance(t.TempDir())
+
+	env := []string{"STEVEDORE_DATA=/opt/stevedore/deployments/app/data"}
+	err := instance.checkComposeVariables("app", []string{composePath}, env)
+	if err == nil {
+		t.Fatal("expected unset API_KEY to fail the check")
+	}
+	if !strings.Contains(err.Error(), "unset variables: API_KEY\n") || !strings.Contains(err.Error(), "param set app") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// A parameter set to an empty value counts as defined
+	if err := instance.checkComposeVariables("app", []string{composePath}, append(env, "API_KEY=")); err != nil {
+		t.Errorf("expected all variables resolved, got %v", err)
+	}
+}
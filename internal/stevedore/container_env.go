@@ -0,0 +1,184 @@
+package stevedore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ContainerEnvFile is the env file (in the system directory) the stevedore
+// container is started with. The installer writes it; self-update replays it.
+const ContainerEnvFile = "container.env"
+
+// requiredContainerEnvKeys must be present in container.env for self-update
+// to be able to recreate the stevedore container.
+var requiredContainerEnvKeys = []string{"STEVEDORE_CONTAINER_NAME", "STEVEDORE_HOST_ROOT"}
+
+var envKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// containerNameRe matches names docker accepts for containers.
+var containerNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ContainerEnvEntry is one KEY=value line of container.env.
+type ContainerEnvEntry struct {
+	Key   string
+	Value string
+}
+
+// ContainerEnv is the parsed container.env file.
+type ContainerEnv struct {
+	Path    string
+	Entries []ContainerEnvEntry
+}
+
+// ContainerEnvPath returns the path of the container env file.
+func (i *Instance) ContainerEnvPath() string {
+	return filepath.Join(i.SystemDir(), ContainerEnvFile)
+}
+
+// ReadContainerEnv reads and parses container.env.
+func (i *Instance) ReadContainerEnv() (*ContainerEnv, error) {
+	path := i.ContainerEnvPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read container env: %w", err)
+	}
+	entries, err := parseContainerEnv(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse container env %s: %w", path, err)
+	}
+	return &ContainerEnv{Path: path, Entries: entries}, nil
+}
+
+// parseContainerEnv parses KEY=value lines, skipping blanks and comments.
+// The update worker passes each line to `docker run -e` unquoted, so values
+// must not contain whitespace.
+func parseContainerEnv(data []byte) ([]ContainerEnvEntry, error) {
+	var entries []ContainerEnvEntry
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=value", n+1)
+		}
+		if !envKeyRe.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", n+1, key)
+		}
+		if strings.ContainsAny(value, " \t") {
+			return nil, fmt.Errorf("line %d: value of %s must not contain whitespace", n+1, key)
+		}
+		entries = append(entries, ContainerEnvEntry{Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+// Get returns the value of key; the last occurrence wins, as with docker.
+func (e *ContainerEnv) Get(key string) string {
+	value := ""
+	for _, entry := range e.Entries {
+		if entry.Key == key {
+			value = entry.Value
+		}
+	}
+	return value
+}
+
+// Validate checks that the env and the image are enough to recreate the
+// stevedore container. All problems are reported together.
+func (e *ContainerEnv) Validate(image string) error {
+	var problems []string
+	if len(e.Entries) == 0 {
+		problems = append(problems, "no entries")
+	}
+	for _, key := range requiredContainerEnvKeys {
+		if e.Get(key) == "" {
+			problems = append(problems, key+" is not set")
+		}
+	}
+	if name := e.Get("STEVEDORE_CONTAINER_NAME"); name != "" && !containerNameRe.MatchString(name) {
+		problems = append(problems, fmt.Sprintf("STEVEDORE_CONTAINER_NAME is not a valid container name: %q", name))
+	}
+	if root := e.Get("STEVEDORE_HOST_ROOT"); root != "" && !filepath.IsAbs(root) {
+		problems = append(problems, fmt.Sprintf("STEVEDORE_HOST_ROOT is not an absolute path: %q", root))
+	}
+	if image == "" {
+		problems = append(problems, "image is not set")
+	} else if strings.ContainsAny(image, " \t\n") {
+		problems = append(problems, fmt.Sprintf("image is not a valid reference: %q", image))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid container env %s: %s", e.Path, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// PublishedListenAddr is the listen address of the installed daemon
+// container: the installer publishes the API port (-p 42107:42107), which
+// only reaches a daemon listening on every interface of the container.
+const PublishedListenAddr = "0.0.0.0:42107"
+
+// EnsureContainerListenAddr adds STEVEDORE_LISTEN_ADDR=PublishedListenAddr
+// to container.env when it sets no listen address. Installs made before the
+// daemon defaulted to 127.0.0.1 lack it, and the container recreated from the
+// file would no longer answer on its published port. It reports whether the
+// file was changed.
+func (i *Instance) EnsureContainerListenAddr() (bool, error) {
+	env, err := i.ReadContainerEnv()
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range env.Entries {
+		if entry.Key == ListenAddrEnvVar {
+			return false, nil
+		}
+	}
+
+	data, err := os.ReadFile(env.Path)
+	if err != nil {
+		return false, fmt.Errorf("read container env: %w", err)
+	}
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		data = append(data, '\n')
+	}
+	data = append(data, ListenAddrEnvVar+"="+PublishedListenAddr+"\n"...)
+	if err := writeFileAtomic(env.Path, data, 0o600); err != nil {
+		return false, fmt.Errorf("write container env: %w", err)
+	}
+	return true, nil
+}
+
+// IsSecretEnvKey reports whether the value of key should not be displayed.
+// *_FILE variables hold paths, not secrets.
+func IsSecretEnvKey(key string) bool {
+	if strings.HasSuffix(key, "_FILE") {
+		return false
+	}
+	for _, marker := range []string{"KEY", "TOKEN", "SECRET", "PASSWORD"} {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckContainerEnv reads container.env and resolves the image the update
+// would run, exactly as Execute would. The returned env and image are set
+// even when validation fails, so callers can show what is wrong.
+func (s *SelfUpdate) CheckContainerEnv(ctx context.Context) (*ContainerEnv, string, error) {
+	env, err := s.instance.ReadContainerEnv()
+	if err != nil {
+		return nil, "", err
+	}
+	image, err := s.imageTag(ctx)
+	if err != nil {
+		return env, "", err
+	}
+	return env, image, env.Validate(image)
+}
@@ -0,0 +1,119 @@
+package stevedore
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseContainerEnv(t *testing.T) {
+	entries, err := parseContainerEnv([]byte("# written by installer\nSTEVEDORE_ROOT=/opt/stevedore\n\nSTEVEDORE_SOURCE_REF=\nA=b=c\n"))
+	if err != nil {
+		t.Fatalf("parseContainerEnv: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("entries = %v, want 3", entries)
+	}
+	if entries[2] != (ContainerEnvEntry{Key: "A", Value: "b=c"}) {
+		t.Errorf("entries[2] = %v", entries[2])
+	}
+
+	for _, bad := range []string{"NOEQUALS", "1BAD=x", "KEY=two words", "=value"} {
+		if _, err := parseContainerEnv([]byte(bad)); err == nil {
+			t.Errorf("parseContainerEnv(%q): expected error", bad)
+		}
+	}
+}
+
+func TestContainerEnvValidate(t *testing.T) {
+	valid := &ContainerEnv{Path: "container.env", Entries: []ContainerEnvEntry{
+		{Key: "STEVEDORE_CONTAINER_NAME", Value: "stevedore"},
+		{Key: "STEVEDORE_HOST_ROOT", Value: "/opt/stevedore"},
+	}}
+	if err := valid.Validate("stevedore:latest"); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		entries []ContainerEnvEntry
+		image   string
+		want    string
+	}{
+		{"empty", nil, "stevedore:latest", "no entries"},
+		{"missing name", []ContainerEnvEntry{{Key: "STEVEDORE_HOST_ROOT", Value: "/opt/stevedore"}}, "stevedore:latest", "STEVEDORE_CONTAINER_NAME is not set"},
+		{"bad name", []ContainerEnvEntry{{Key: "STEVEDORE_CONTAINER_NAME", Value: "-x"}, {Key: "STEVEDORE_HOST_ROOT", Value: "/opt"}}, "stevedore:latest", "not a valid container name"},
+		{"relative root", []ContainerEnvEntry{{Key: "STEVEDORE_CONTAINER_NAME", Value: "stevedore"}, {Key: "STEVEDORE_HOST_ROOT", Value: "opt"}}, "stevedore:latest", "not an absolute path"},
+		{"no image", valid.Entries, "", "image is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &ContainerEnv{Path: "container.env", Entries: tt.entries}
+			err := env.Validate(tt.image)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelfUpdate_Execute_rejectsInvalidContainerEnv(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	if err := os.MkdirAll(instance.SystemDir(), 0o755); err != nil {
+		t.Fatalf("mkdir system: %v", err)
+	}
+	if err := os.WriteFile(instance.ContainerEnvPath(), []byte("STEVEDORE_ROOT=/opt/stevedore\n"), 0o600); err != nil {
+		t.Fatalf("write container env: %v", err)
+	}
+
+	// Execute must fail before touching docker or scheduling a kill
+	s := NewSelfUpdate(instance, SelfUpdateConfig{ContainerName: "test-stevedore"})
+	err := s.Execute(t.Context(), "stevedore:latest")
+	if err == nil || !strings.Contains(err.Error(), "STEVEDORE_HOST_ROOT is not set") {
+		t.Fatalf("Execute() = %v, want container env error", err)
+	}
+}
+
+func TestEnsureContainerListenAddr(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	if err := os.MkdirAll(instance.SystemDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(instance.ContainerEnvPath(), []byte("STEVEDORE_CONTAINER_NAME=stevedore"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := instance.EnsureContainerListenAddr()
+	if err != nil || !added {
+		t.Fatalf("EnsureContainerListenAddr = %v, %v, want an added entry", added, err)
+	}
+	env, err := instance.ReadContainerEnv()
+	if err != nil {
+		t.Fatalf("ReadContainerEnv: %v", err)
+	}
+	if got := env.Get(ListenAddrEnvVar); got != PublishedListenAddr || env.Get("STEVEDORE_CONTAINER_NAME") != "stevedore" {
+		t.Errorf("container env after adding = %+v", env.Entries)
+	}
+
+	// An address the installer or the user set is left alone
+	if err := os.WriteFile(instance.ContainerEnvPath(), []byte("STEVEDORE_LISTEN_ADDR=none\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if added, err := instance.EnsureContainerListenAddr(); err != nil || added {
+		t.Errorf("EnsureContainerListenAddr with an address = %v, %v", added, err)
+	}
+}
+
+func TestIsSecretEnvKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"STEVEDORE_DB_KEY":         true,
+		"STEVEDORE_DB_KEY_FILE":    false,
+		"STEVEDORE_HOST_ROOT":      false,
+		"GITHUB_TOKEN":             true,
+		"STEVEDORE_CONTAINER_NAME": false,
+	} {
+		if got := IsSecretEnvKey(key); got != want {
+			t.Errorf("IsSecretEnvKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package stevedore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ContainerExecOptions controls how ExecInContainer attaches to the container.
+type ContainerExecOptions struct {
+	// Interactive keeps stdin open (docker exec -i)
+	Interactive bool
+	// TTY allocates a pseudo-terminal (docker exec -t)
+	TTY bool
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// ResolveServiceContainer returns the ID of the single running container for a
+// service of a deployment. It fails when the service has no running container
+// or when several replicas make the choice ambiguous.
+func (i *Instance) ResolveServiceContainer(ctx context.Context, deployment string, service string) (string, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(service) == "" {
+		return "", errors.New("service name is required")
+	}
+
+	containers, err := i.listProjectContainers(ctx, ComposeProjectName(deployment))
+	if err != nil {
+		return "", err
+	}
+
+	container, err := selectServiceContainer(containers, service)
+	if err != nil {
+		return "", fmt.Errorf("deployment %s: %w", deployment, err)
+	}
+	return container.ID, nil
+}
+
+// selectServiceContainer picks the running container for service.
+func selectServiceContainer(containers []ContainerStatus, service string) (ContainerStatus, error) {
+	var matches []ContainerStatus
+	for _, c := range containers {
+		if c.Service == service && c.State.IsRunning() {
+			matches = append(matches, c)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return ContainerStatus{}, fmt.Errorf("no running container for service %q", service)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for idx, c := range matches {
+			names[idx] = c.Name
+		}
+		return ContainerStatus{}, fmt.Errorf("service %q has %d running containers (%s), cannot pick one",
+			service, len(matches), strings.Join(names, ", "))
+	}
+}
+
+// ExecInContainer runs command inside the running container of a deployment's
+// service via `docker exec`, wiring the given streams to the process.
+// A non-zero exit of the command is returned as an *exec.ExitError.
+func (i *Instance) ExecInContainer(ctx context.Context, deployment string, service string, command []string, opts ContainerExecOptions) error {
+	if len(command) == 0 {
+		return errors.New("command is required")
+	}
+
+	containerID, err := i.ResolveServiceContainer(ctx, deployment, service)
+	if err != nil {
+		return err
+	}
+
+	cmd := newDockerCommand(ctx, containerExecArgs(containerID, command, opts)...)
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+
+	return runCommand(cmd)
+}
+
+func containerExecArgs(containerID string, command []string, opts ContainerExecOptions) []string {
+	args := []string{"exec"}
+	if opts.Interactive {
+		args = append(args, "-i")
+	}
+	if opts.TTY {
+		args = append(args, "-t")
+	}
+	args = append(args, containerID)
+	return append(args, command...)
+}
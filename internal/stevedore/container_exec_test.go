@@ -0,0 +1,76 @@
+package stevedore
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectServiceContainer(t *testing.T) {
+	containers := []ContainerStatus{
+		{ID: "aaa", Name: "stevedore-app-web-1", Service: "web", State: StateRunning},
+		{ID: "bbb", Name: "stevedore-app-db-1", Service: "db", State: StateExited},
+		{ID: "ccc", Name: "stevedore-app-worker-1", Service: "worker", State: StateRunning},
+		{ID: "ddd", Name: "stevedore-app-worker-2", Service: "worker", State: StateRunning},
+	}
+
+	got, err := selectServiceContainer(containers, "web")
+	if err != nil {
+		t.Fatalf("selectServiceContainer(web): %v", err)
+	}
+	if got.ID != "aaa" {
+		t.Errorf("ID = %q, want aaa", got.ID)
+	}
+
+	if _, err := selectServiceContainer(containers, "db"); err == nil || !strings.Contains(err.Error(), "no running container") {
+		t.Errorf("expected no running container error for stopped service, got %v", err)
+	}
+
+	if _, err := selectServiceContainer(containers, "missing"); err == nil {
+		t.Error("expected error for unknown service")
+	}
+
+	_, err = selectServiceContainer(containers, "worker")
+	if err == nil {
+		t.Fatal("expected ambiguity error for scaled service")
+	}
+	if !strings.Contains(err.Error(), "stevedore-app-worker-1") || !strings.Contains(err.Error(), "stevedore-app-worker-2") {
+		t.Errorf("ambiguity error should list container names: %v", err)
+	}
+}
+
+func TestContainerExecArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ContainerExecOptions
+		want []string
+	}{
+		{"plain", ContainerExecOptions{}, []string{"exec", "abc", "ls", "-la"}},
+		{"interactive", ContainerExecOptions{Interactive: true}, []string{"exec", "-i", "abc", "ls", "-la"}},
+		{"tty", ContainerExecOptions{Interactive: true, TTY: true}, []string{"exec", "-i", "-t", "abc", "ls", "-la"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := containerExecArgs("abc", []string{"ls", "-la"}, tt.opts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("containerExecArgs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecInContainer_Validation(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	ctx := context.Background()
+
+	if err := instance.ExecInContainer(ctx, "app", "web", nil, ContainerExecOptions{}); err == nil {
+		t.Error("expected error for empty command")
+	}
+	if err := instance.ExecInContainer(ctx, "../bad", "web", []string{"ls"}, ContainerExecOptions{}); err == nil {
+		t.Error("expected error for invalid deployment name")
+	}
+	if err := instance.ExecInContainer(ctx, "app", " ", []string{"ls"}, ContainerExecOptions{}); err == nil {
+		t.Error("expected error for empty service name")
+	}
+}
@@ -0,0 +1,170 @@
+package stevedore
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CrashLoopConfig holds thresholds for crash-loop detection.
+type CrashLoopConfig struct {
+	// MaxRestarts is the number of container restarts within Window that
+	// marks a deployment as crash-looping (default: 5).
+	MaxRestarts int
+	// Window is the sliding time window restarts are counted in (default: 10m).
+	Window time.Duration
+	// AlertInterval is the minimum time between repeated alerts for the same
+	// crash-looping deployment (default: 1h).
+	AlertInterval time.Duration
+}
+
+func (c CrashLoopConfig) withDefaults() CrashLoopConfig {
+	if c.MaxRestarts <= 0 {
+		c.MaxRestarts = 5
+	}
+	if c.Window <= 0 {
+		c.Window = 10 * time.Minute
+	}
+	if c.AlertInterval <= 0 {
+		c.AlertInterval = time.Hour
+	}
+	return c
+}
+
+// CrashLoopState is the persisted crash-loop state of a deployment.
+type CrashLoopState struct {
+	Deployment  string
+	Restarts    int
+	Window      time.Duration
+	DetectedAt  time.Time
+	LastAlertAt time.Time
+}
+
+// restartSample is a container's RestartCount as seen at a point in time.
+type restartSample struct {
+	at    time.Time
+	count int
+}
+
+// crashLoopTracker keeps recent RestartCount samples per container to count
+// restarts within a sliding window. docker only exposes the total count, so
+// the rate has to be derived from successive observations.
+type crashLoopTracker struct {
+	window  time.Duration
+	started time.Time
+
+	mu      sync.Mutex
+	samples map[string]map[string][]restartSample // deployment -> container ID -> samples
+}
+
+func newCrashLoopTracker(window time.Duration) *crashLoopTracker {
+	return &crashLoopTracker{
+		window:  window,
+		started: time.Now(),
+		samples: make(map[string]map[string][]restartSample),
+	}
+}
+
+// warmedUp reports whether the tracker has observed a full window. Before
+// that, a low restart count does not prove a deployment has recovered.
+func (t *crashLoopTracker) warmedUp(now time.Time) bool {
+	return now.Sub(t.started) >= t.window
+}
+
+// observe records the current restart counts of a deployment's containers and
+// returns the highest number of restarts any one container had in the window.
+// Containers that disappeared (e.g. recreated by a deploy) are forgotten.
+func (t *crashLoopTracker) observe(deployment string, containers []ContainerStatus, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous := t.samples[deployment]
+	current := make(map[string][]restartSample, len(containers))
+	maxRestarts := 0
+
+	for _, c := range containers {
+		samples := append(previous[c.ID], restartSample{at: now, count: c.RestartCount})
+		// Keep the newest sample taken at or before the window start as the baseline
+		cutoff := now.Add(-t.window)
+		for len(samples) > 1 && !samples[1].at.After(cutoff) {
+			samples = samples[1:]
+		}
+		current[c.ID] = samples
+
+		if restarts := samples[len(samples)-1].count - samples[0].count; restarts > maxRestarts {
+			maxRestarts = restarts
+		}
+	}
+
+	t.samples[deployment] = current
+	return maxRestarts
+}
+
+// GetCrashLoop returns the crash-loop state of a deployment, or nil when it is
+// not crash-looping.
+func (i *Instance) GetCrashLoop(db *sql.DB, deployment string) (*CrashLoopState, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+
+	state := CrashLoopState{Deployment: deployment}
+	var windowSeconds, detectedAt int64
+	var lastAlertAt sql.NullInt64
+	err := db.QueryRow(`
+		SELECT restarts, window_seconds, detected_at, last_alert_at
+		FROM crash_loops
+		WHERE deployment = ?
+	`, deployment).Scan(&state.Restarts, &windowSeconds, &detectedAt, &lastAlertAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state.Window = time.Duration(windowSeconds) * time.Second
+	state.DetectedAt = time.Unix(detectedAt, 0)
+	if lastAlertAt.Valid {
+		state.LastAlertAt = time.Unix(lastAlertAt.Int64, 0)
+	}
+	return &state, nil
+}
+
+// RecordCrashLoop marks a deployment as crash-looping with the latest restart
+// count. The detection time and last alert time of an existing record are kept.
+func (i *Instance) RecordCrashLoop(db *sql.DB, deployment string, restarts int, window time.Duration, now time.Time) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO crash_loops (deployment, restarts, window_seconds, detected_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(deployment) DO UPDATE SET
+			restarts = excluded.restarts,
+			window_seconds = excluded.window_seconds
+	`, deployment, restarts, int64(window.Seconds()), now.Unix())
+
+	return err
+}
+
+// MarkCrashLoopAlerted records that an alert was sent for a crash-looping deployment.
+func (i *Instance) MarkCrashLoopAlerted(db *sql.DB, deployment string, now time.Time) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`UPDATE crash_loops SET last_alert_at = ? WHERE deployment = ?`, now.Unix(), deployment)
+	return err
+}
+
+// ClearCrashLoop removes the crash-loop state of a deployment.
+func (i *Instance) ClearCrashLoop(db *sql.DB, deployment string) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`DELETE FROM crash_loops WHERE deployment = ?`, deployment)
+	return err
+}
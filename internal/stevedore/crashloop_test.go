@@ -0,0 +1,89 @@
+package stevedore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCrashLoopTracker_CountsRestartsInWindow(t *testing.T) {
+	tracker := newCrashLoopTracker(10 * time.Minute)
+	start := time.Now()
+
+	observe := func(offset time.Duration, counts ...int) int {
+		containers := make([]ContainerStatus, len(counts))
+		for idx, count := range counts {
+			containers[idx] = ContainerStatus{ID: string(rune('a' + idx)), RestartCount: count}
+		}
+		return tracker.observe("app", containers, start.Add(offset))
+	}
+
+	if got := observe(0, 3, 0); got != 0 {
+		t.Errorf("first observation = %d, want 0 (no history yet)", got)
+	}
+	if got := observe(2*time.Minute, 5, 1); got != 2 {
+		t.Errorf("after 2m = %d, want 2", got)
+	}
+	if got := observe(8*time.Minute, 9, 1); got != 6 {
+		t.Errorf("after 8m = %d, want 6", got)
+	}
+	// The 0m sample falls out of the window; the 2m sample becomes the baseline
+	if got := observe(12*time.Minute, 9, 1); got != 4 {
+		t.Errorf("after 12m = %d, want 4", got)
+	}
+	if got := observe(25*time.Minute, 9, 1); got != 0 {
+		t.Errorf("after 25m = %d, want 0", got)
+	}
+
+	// A recreated container starts a new history
+	if got := tracker.observe("app", []ContainerStatus{{ID: "new", RestartCount: 0}}, start.Add(26*time.Minute)); got != 0 {
+		t.Errorf("recreated container = %d, want 0", got)
+	}
+	if len(tracker.samples["app"]) != 1 {
+		t.Errorf("expected forgotten containers to be dropped, got %d", len(tracker.samples["app"]))
+	}
+}
+
+func TestCrashLoopState(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if state, err := instance.GetCrashLoop(db, "app"); err != nil || state != nil {
+		t.Fatalf("GetCrashLoop before detection = %+v, %v; want nil", state, err)
+	}
+
+	detected := time.Unix(1700000000, 0)
+	if err := instance.RecordCrashLoop(db, "app", 6, 10*time.Minute, detected); err != nil {
+		t.Fatalf("RecordCrashLoop: %v", err)
+	}
+	if err := instance.MarkCrashLoopAlerted(db, "app", detected); err != nil {
+		t.Fatalf("MarkCrashLoopAlerted: %v", err)
+	}
+	// A later observation updates the count but keeps detection and alert times
+	if err := instance.RecordCrashLoop(db, "app", 8, 10*time.Minute, detected.Add(time.Minute)); err != nil {
+		t.Fatalf("RecordCrashLoop: %v", err)
+	}
+
+	state, err := instance.GetCrashLoop(db, "app")
+	if err != nil || state == nil {
+		t.Fatalf("GetCrashLoop = %+v, %v", state, err)
+	}
+	if state.Restarts != 8 || state.Window != 10*time.Minute || !state.DetectedAt.Equal(detected) || !state.LastAlertAt.Equal(detected) {
+		t.Errorf("unexpected state: %+v", state)
+	}
+
+	if err := instance.ClearCrashLoop(db, "app"); err != nil {
+		t.Fatalf("ClearCrashLoop: %v", err)
+	}
+	if state, err := instance.GetCrashLoop(db, "app"); err != nil || state != nil {
+		t.Errorf("GetCrashLoop after clear = %+v, %v; want nil", state, err)
+	}
+}
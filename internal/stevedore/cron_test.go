@@ -0,0 +1,94 @@
+package stevedore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronSchedule_Next(t *testing.T) {
+	// Wednesday, 2025-01-15 10:30 UTC
+	base := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 3 * * *", time.Date(2025, 1, 16, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2025, 1, 16, 10, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * mon-fri", time.Date(2025, 1, 15, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * sat,sun", time.Date(2025, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jun *", time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches
+		{"0 0 20 * fri", time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 16 * mon", time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCronSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCronSchedule(%q): %v", tt.expr, err)
+		}
+		if got := schedule.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%s) = %s, want %s", tt.expr, base, got, tt.want)
+		}
+	}
+}
+
+func TestCronSchedule_NextIsStrictlyAfter(t *testing.T) {
+	schedule, err := ParseCronSchedule("0 3 * * *")
+	if err != nil {
+		t.Fatalf("ParseCronSchedule: %v", err)
+	}
+	// A check that ran during the 03:00 minute waits for the next day
+	ran := time.Date(2025, 1, 15, 3, 0, 20, 0, time.UTC)
+	if got, want := schedule.Next(ran), time.Date(2025, 1, 16, 3, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%s) = %s, want %s", ran, got, want)
+	}
+}
+
+func TestParseCronSchedule_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"0 3 * *",
+		"0 3 * * * *",
+		"60 * * * *",
+		"0 24 * * *",
+		"0 0 0 * *",
+		"0 0 * 13 *",
+		"0 0 * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"0 0 * * funday",
+		"@reboot",
+	} {
+		if _, err := ParseCronSchedule(expr); err == nil {
+			t.Errorf("ParseCronSchedule(%q): expected error", expr)
+		}
+	}
+}
+
+func TestRepoConfig_NextSyncAt(t *testing.T) {
+	last := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	interval := RepoConfig{PollIntervalSeconds: 300}
+	if got, _ := interval.NextSyncAt(last); !got.Equal(last.Add(5 * time.Minute)) {
+		t.Errorf("interval NextSyncAt = %s, want last sync + 5m", got)
+	}
+
+	scheduled := RepoConfig{PollIntervalSeconds: 300, Schedule: "0 3 * * *"}
+	if got, _ := scheduled.NextSyncAt(last); !got.Equal(time.Date(2025, 1, 16, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("scheduled NextSyncAt = %s, want the next 03:00", got)
+	}
+	if got, _ := scheduled.NextSyncAt(time.Time{}); !got.IsZero() {
+		t.Errorf("a deployment never checked should be due now, got %s", got)
+	}
+
+	if _, err := (RepoConfig{Schedule: "not a cron"}).NextSyncAt(last); err == nil {
+		t.Error("expected error for an invalid schedule")
+	}
+}
@@ -3,7 +3,10 @@ package stevedore
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,14 +16,25 @@ import (
 type DaemonConfig struct {
 	AdminKey          string
 	ListenAddr        string
+	TLSCertFile       string // Serve the API over HTTPS with this certificate and key
+	TLSKeyFile        string
+	APISocketPath     string        // Also serve the API on this Unix socket (empty: TCP only)
+	EnablePprof       bool          // Mount /debug/pprof/ on the API (admin key required)
+	DisableExec       bool          // Refuse /api/exec with 403
+	ExecRateLimit     int           // /api/exec commands per minute (default: DefaultExecRateLimit)
+	APIWriteTimeout   time.Duration // Write timeout of fast API endpoints (default: DefaultAPIWriteTimeout)
+	APISlowTimeout    time.Duration // Write timeout of check, sync, deploy and exec (default: DefaultAPISlowTimeout)
 	Version           string
-	Build             string        // Git commit or build hash for strict version matching
-	MinPollTime       time.Duration // Minimum time between poll cycles (default: 30s)
-	SyncTimeout       time.Duration // Timeout for sync operations (default: 5m)
-	DeployTimeout     time.Duration // Timeout for deploy operations (default: 10m)
-	ReconcileInterval time.Duration // Interval for reconcile checks (default: 30s)
-	QuerySocketPath   string        // Path for query socket (default: /var/run/stevedore/query.sock)
-	Watchdog          WatchdogConfig // PID-pressure watchdog thresholds and interval
+	Build             string            // Git commit or build hash for strict version matching
+	MinPollTime       time.Duration     // Minimum time between poll cycles (default: 30s)
+	SyncTimeout       time.Duration     // Timeout for sync operations (default: 5m)
+	DeployTimeout     time.Duration     // Timeout for deploy operations (default: 10m)
+	ReconcileInterval time.Duration     // Interval for reconcile checks (default: 30s)
+	QuerySocketPath   string            // Path for query socket (default: /var/run/stevedore/query.sock)
+	Watchdog          WatchdogConfig    // PID-pressure watchdog thresholds and interval
+	CrashLoop         CrashLoopConfig   // Crash-loop detection thresholds
+	HealthAlerts      HealthAlertConfig // Health transition debounce and flap thresholds
+	NotifyWebhookURL  string            // Webhook for alerts such as crash loops (empty: disabled)
 }
 
 // Daemon manages the polling loop and HTTP server.
@@ -30,14 +44,24 @@ type Daemon struct {
 	config      DaemonConfig
 	server      *Server
 	queryServer *QueryServer
+	notifier    *Notifier
+	crashLoops  *crashLoopTracker
+	healthFlaps *healthFlapTracker
+	events      *EventBus // Deploy lifecycle events for GET /api/events
 	mu          sync.Mutex
-	active      map[string]bool // Track deployments currently being processed
+	active      map[string]*activeOperation // Track deployments currently being processed
+	maintenance bool                        // Last seen maintenance state, to log when it changes
+}
+
+// activeOperation is a sync, deploy or restart the daemon is running.
+type activeOperation struct {
+	cancel context.CancelFunc
 }
 
 // NewDaemon creates a new daemon instance.
 func NewDaemon(instance *Instance, db *sql.DB, config DaemonConfig) *Daemon {
 	if config.ListenAddr == "" {
-		config.ListenAddr = ":42107"
+		config.ListenAddr = DefaultListenAddr
 	}
 	if config.MinPollTime == 0 {
 		config.MinPollTime = 30 * time.Second
@@ -54,18 +78,36 @@ func NewDaemon(instance *Instance, db *sql.DB, config DaemonConfig) *Daemon {
 	if config.QuerySocketPath == "" {
 		config.QuerySocketPath = DefaultQuerySocketPath
 	}
+	config.CrashLoop = config.CrashLoop.withDefaults()
+	config.HealthAlerts = config.HealthAlerts.withDefaults()
 
 	d := &Daemon{
-		instance: instance,
-		db:       db,
-		config:   config,
-		active:   make(map[string]bool),
+		instance:    instance,
+		db:          db,
+		config:      config,
+		notifier:    NewNotifier(config.NotifyWebhookURL),
+		crashLoops:  newCrashLoopTracker(config.CrashLoop.Window),
+		healthFlaps: newHealthFlapTracker(config.HealthAlerts.FlapWindow),
+		events:      NewEventBus(100),
+		active:      make(map[string]*activeOperation),
 	}
 
 	d.server = NewServer(instance, db, ServerConfig{
-		AdminKey:   config.AdminKey,
-		ListenAddr: config.ListenAddr,
+		AdminKey:      config.AdminKey,
+		ListenAddr:    config.ListenAddr,
+		TLSCertFile:   config.TLSCertFile,
+		TLSKeyFile:    config.TLSKeyFile,
+		SocketPath:    config.APISocketPath,
+		EnablePprof:   config.EnablePprof,
+		DisableExec:   config.DisableExec,
+		ExecRateLimit: config.ExecRateLimit,
+		WriteTimeout:  config.APIWriteTimeout,
+		SlowTimeout:   config.APISlowTimeout,
 	}, config.Version, config.Build)
+	d.server.SetCanceller(d.CancelOperation)
+	d.server.SetOperationTracker(d.setActive)
+	d.server.SetActiveOperations(d.ActiveOperations)
+	d.server.SetEventBus(d.events)
 
 	d.queryServer = NewQueryServer(instance, config.QuerySocketPath)
 
@@ -111,6 +153,7 @@ func (d *Daemon) runPollLoop(ctx context.Context) {
 	// Use a shorter ticker for checking; actual polls are gated by per-deployment intervals
 	ticker := time.NewTicker(d.config.MinPollTime)
 	defer ticker.Stop()
+	d.server.MarkPollLoopStarted()
 
 	// Run an initial poll immediately
 	d.pollAllDeployments(ctx)
@@ -131,8 +174,10 @@ func (d *Daemon) runReconcileLoop(ctx context.Context) {
 	ticker := time.NewTicker(d.config.ReconcileInterval)
 	defer ticker.Stop()
 
-	// Run an initial reconcile immediately
-	d.reconcileAllDeployments(ctx)
+	// Run an initial reconcile immediately: after a host reboot or a daemon
+	// restart this brings back every deployment whose desired state is up
+	d.logDesiredState()
+	d.startupReconcile(ctx)
 
 	for {
 		select {
@@ -145,8 +190,29 @@ func (d *Daemon) runReconcileLoop(ctx context.Context) {
 	}
 }
 
+// logDesiredState logs which deployments the startup reconcile will keep running.
+func (d *Daemon) logDesiredState() {
+	deployments, err := d.instance.ListEnabledDeployments(d.db)
+	if err != nil {
+		log.Printf("Error listing deployments for startup reconcile: %v", err)
+		return
+	}
+
+	var up []string
+	for _, deployment := range deployments {
+		if deployment.DesiredState == DesiredStateUp && deployment.Deployment != "stevedore" {
+			up = append(up, deployment.Deployment)
+		}
+	}
+	log.Printf("Startup reconcile: %d deployment(s) desired up: %s", len(up), strings.Join(up, ", "))
+}
+
 // pollAllDeployments polls all enabled deployments that are due for sync.
 func (d *Daemon) pollAllDeployments(ctx context.Context) {
+	if d.maintenancePaused() {
+		return
+	}
+
 	deployments, err := d.instance.ListEnabledDeployments(d.db)
 	if err != nil {
 		log.Printf("Error listing deployments: %v", err)
@@ -163,14 +229,23 @@ func (d *Daemon) pollAllDeployments(ctx context.Context) {
 			continue
 		}
 
-		// Calculate next sync time
-		pollInterval := time.Duration(deployment.PollIntervalSeconds) * time.Second
-		nextSync := syncStatus.LastSyncAt.Add(pollInterval)
+		// Calculate next sync time from the cron schedule or the poll interval
+		nextSync, err := deployment.NextSyncAt(syncStatus.LastSyncAt)
+		if err != nil {
+			log.Printf("Invalid schedule for %s, polling every %ds instead: %v",
+				deployment.Deployment, deployment.PollIntervalSeconds, err)
+			deployment.Schedule = ""
+			nextSync, _ = deployment.NextSyncAt(syncStatus.LastSyncAt)
+		}
 
 		if now.Before(nextSync) {
 			// Not due yet
 			continue
 		}
+		if now.Before(syncStatus.NextSyncRetry()) {
+			// Backing off after failed syncs
+			continue
+		}
 
 		// Check if already syncing
 		if d.isActive(deployment.Deployment) {
@@ -180,32 +255,189 @@ func (d *Daemon) pollAllDeployments(ctx context.Context) {
 		// Sync in a goroutine to avoid blocking other deployments
 		go d.syncDeployment(ctx, deployment.Deployment)
 	}
+
+	d.checkDisabledDeployments(ctx, now)
+}
+
+// recordSyncFailure logs and records a failed check or sync of a deployment
+// and when the daemon polls it next. Each consecutive failure doubles the
+// wait (SyncBackoff) until a sync succeeds.
+func (d *Daemon) recordSyncFailure(deployment string, step string, err error) {
+	if recordErr := d.instance.UpdateSyncError(d.db, deployment, err); recordErr != nil {
+		log.Printf("%s failed for %s: %v", step, deployment, err)
+		return
+	}
+	failures := 1
+	if status, statusErr := d.instance.GetSyncStatus(d.db, deployment); statusErr == nil {
+		failures = status.SyncFailures
+	}
+	log.Printf("%s failed for %s (%d in a row, next try in %s): %v",
+		step, deployment, failures, SyncBackoff(failures), err)
+}
+
+// checkDisabledDeployments checks the deployments stopped with `deploy down`
+// for remote updates on their usual schedule, without syncing or deploying.
+func (d *Daemon) checkDisabledDeployments(ctx context.Context, now time.Time) {
+	deployments, err := d.instance.ListDisabledDeployments(d.db)
+	if err != nil {
+		log.Printf("Error listing disabled deployments: %v", err)
+		return
+	}
+
+	for _, deployment := range deployments {
+		syncStatus, err := d.instance.GetSyncStatus(d.db, deployment.Deployment)
+		if err != nil {
+			log.Printf("Error getting sync status for %s: %v", deployment.Deployment, err)
+			continue
+		}
+		nextCheck, err := deployment.NextSyncAt(syncStatus.LastSyncAt)
+		if err != nil {
+			deployment.Schedule = ""
+			nextCheck, _ = deployment.NextSyncAt(syncStatus.LastSyncAt)
+		}
+		if now.Before(nextCheck) || now.Before(syncStatus.NextSyncRetry()) || d.isActive(deployment.Deployment) {
+			continue
+		}
+		go d.checkForUpdate(ctx, deployment.Deployment)
+	}
+}
+
+// checkForUpdate checks a deployment the daemon does not auto-deploy for new
+// remote commits and alerts once per new commit (or tag).
+func (d *Daemon) checkForUpdate(parentCtx context.Context, deployment string) {
+	parentCtx, done := d.setActive(parentCtx, deployment)
+	defer done()
+
+	checkCtx, checkCancel := context.WithTimeout(parentCtx, d.config.SyncTimeout)
+	defer checkCancel()
+
+	checkResult, err := d.instance.GitCheckRemote(checkCtx, deployment)
+	if err != nil {
+		d.recordSyncFailure(deployment, "Check", err)
+		return
+	}
+	if err := d.instance.UpdateSyncStatus(d.db, deployment, checkResult.CurrentCommit); err != nil {
+		log.Printf("Warning: failed to update sync status for %s: %v", deployment, err)
+	}
+
+	remote := ""
+	if checkResult.HasChanges {
+		remote = checkResult.RemoteCommit
+		if checkResult.RemoteTag != "" {
+			remote = checkResult.RemoteTag
+		}
+	}
+	isNew, err := d.instance.RecordUpdateAvailable(d.db, deployment, remote)
+	if err != nil {
+		log.Printf("Warning: failed to record available update for %s: %v", deployment, err)
+		return
+	}
+	if !isNew || remote == "" {
+		return
+	}
+
+	message := fmt.Sprintf("update available: %s -> %s", checkResult.Ref(), shortCommit(checkResult.RemoteCommit))
+	if checkResult.RemoteTag != "" {
+		message = fmt.Sprintf("update available: tag %s", checkResult.RemoteTag)
+	} else if checkResult.CommitsBehind > 0 {
+		message = fmt.Sprintf("update available: %d new commit(s) on %s", checkResult.CommitsBehind, checkResult.Ref())
+	}
+	log.Printf("%s has an %s (auto-deploy is off)", deployment, message)
+
+	details := map[string]string{
+		"commit":  checkResult.RemoteCommit,
+		"current": checkResult.CurrentCommit,
+		"message": message,
+	}
+	if checkResult.RemoteTag != "" {
+		details["tag"] = checkResult.RemoteTag
+	}
+	d.queryServer.PublishEvent(EventDeploymentUpdateAvailable, deployment, details)
+	if err := d.notifier.Send(parentCtx, Event{Type: EventDeploymentUpdateAvailable, Deployment: deployment, Details: details}); err != nil {
+		log.Printf("Warning: update notification for %s failed: %v", deployment, err)
+	}
+}
+
+// maintenancePaused reports whether a maintenance window suppresses automatic
+// syncs and deploys, logging when a window starts or ends.
+func (d *Daemon) maintenancePaused() bool {
+	state, err := d.instance.GetMaintenance(d.db)
+	if err != nil {
+		log.Printf("Error reading maintenance window: %v", err)
+		return false
+	}
+
+	paused := state != nil
+	if paused != d.maintenance {
+		switch {
+		case !paused:
+			log.Printf("Maintenance window ended, resuming automatic syncs and deploys")
+		case state.Until.IsZero():
+			log.Printf("Maintenance window active until turned off, pausing automatic syncs and deploys")
+		default:
+			log.Printf("Maintenance window active until %s, pausing automatic syncs and deploys", state.Until.Format(time.RFC3339))
+		}
+		d.maintenance = paused
+	}
+	return paused
 }
 
 // isActive checks if a deployment is currently being processed.
 func (d *Daemon) isActive(deployment string) bool {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	return d.active[deployment]
+	_, ok := d.active[deployment]
+	return ok
+}
+
+// setActive marks a deployment as being processed and returns a context that
+// CancelOperation cancels, along with a func that must be called when done.
+func (d *Daemon) setActive(ctx context.Context, deployment string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	op := &activeOperation{cancel: cancel}
+	d.mu.Lock()
+	d.active[deployment] = op
+	d.mu.Unlock()
+	return ctx, func() {
+		cancel()
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.active[deployment] == op {
+			delete(d.active, deployment)
+		}
+	}
+}
+
+// CancelOperation cancels the sync, deploy or restart the daemon is running
+// for a deployment and reports whether one was running.
+func (d *Daemon) CancelOperation(deployment string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	op, ok := d.active[deployment]
+	if ok {
+		op.cancel()
+	}
+	return ok
 }
 
-// setActive marks a deployment as active or not.
-func (d *Daemon) setActive(deployment string, active bool) {
+// ActiveOperations lists the deployments with an operation in flight, sorted.
+func (d *Daemon) ActiveOperations() []string {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	if active {
-		d.active[deployment] = true
-	} else {
-		delete(d.active, deployment)
+	deployments := make([]string, 0, len(d.active))
+	for deployment := range d.active {
+		deployments = append(deployments, deployment)
 	}
+	sort.Strings(deployments)
+	return deployments
 }
 
 // syncDeployment performs check, sync, and optional deploy for a single deployment.
 // It first checks for updates using git fetch only (safe while deployment runs),
 // then syncs and deploys only if changes are detected.
 func (d *Daemon) syncDeployment(parentCtx context.Context, deployment string) {
-	d.setActive(deployment, true)
-	defer d.setActive(deployment, false)
+	parentCtx, done := d.setActive(parentCtx, deployment)
+	defer done()
 
 	config, err := d.instance.GetRepoConfig(d.db, deployment)
 	if err != nil {
@@ -225,8 +457,7 @@ func (d *Daemon) syncDeployment(parentCtx context.Context, deployment string) {
 
 	checkResult, err := d.instance.GitCheckRemote(checkCtx, deployment)
 	if err != nil {
-		log.Printf("Check failed for %s: %v", deployment, err)
-		_ = d.instance.UpdateSyncError(d.db, deployment, err)
+		d.recordSyncFailure(deployment, "Check", err)
 		return
 	}
 
@@ -236,13 +467,26 @@ func (d *Daemon) syncDeployment(parentCtx context.Context, deployment string) {
 	}
 
 	if !checkResult.HasChanges {
-		log.Printf("No updates for %s: %s@%s", deployment, checkResult.Branch, shortCommit(checkResult.CurrentCommit))
+		log.Printf("No updates for %s: %s@%s", deployment, checkResult.Ref(), shortCommit(checkResult.CurrentCommit))
 		return
 	}
 
+	// Dependencies (e.g. a database) must be healthy before the dependent
+	// starts. They are awaited before syncing: a synced commit counts as
+	// seen, so postponing after the sync would never deploy it
+	if deployment != "stevedore" {
+		if err := d.instance.WaitForDependencies(parentCtx, d.db, deployment, 0); err != nil {
+			log.Printf("Sync and deploy postponed for %s until the next poll: %v", deployment, err)
+			_ = d.instance.UpdateDeployError(d.db, deployment, err)
+			d.publishDeployEvent(EventDeployFailed, deployment, checkResult.RemoteCommit, err)
+			return
+		}
+	}
+
 	// Step 2: Changes detected - sync the repository (with stale file cleanup)
 	log.Printf("Updates available for %s (current: %s, remote: %s), syncing...",
 		deployment, shortCommit(checkResult.CurrentCommit), shortCommit(checkResult.RemoteCommit))
+	d.publishDeployEvent(EventSyncStarted, deployment, checkResult.RemoteCommit, nil)
 
 	syncCtx, syncCancel := context.WithTimeout(parentCtx, d.config.SyncTimeout)
 	defer syncCancel()
@@ -250,8 +494,8 @@ func (d *Daemon) syncDeployment(parentCtx context.Context, deployment string) {
 	// Use GitSyncClean to sync with stale file removal enabled by default
 	result, err := d.instance.GitSyncClean(syncCtx, deployment, true)
 	if err != nil {
-		log.Printf("Sync failed for %s: %v", deployment, err)
-		_ = d.instance.UpdateSyncError(d.db, deployment, err)
+		d.recordSyncFailure(deployment, "Sync", err)
+		d.publishDeployEvent(EventSyncFailed, deployment, checkResult.RemoteCommit, err)
 		return
 	}
 
@@ -259,8 +503,17 @@ func (d *Daemon) syncDeployment(parentCtx context.Context, deployment string) {
 	if err := d.instance.UpdateSyncStatus(d.db, deployment, result.Commit); err != nil {
 		log.Printf("Warning: failed to update sync status for %s: %v", deployment, err)
 	}
+	if err := d.instance.UpdateSyncCommitInfo(d.db, deployment, result.CommitInfo); err != nil {
+		log.Printf("Warning: failed to record commit metadata for %s: %v", deployment, err)
+	}
+	if result.Tag != "" {
+		if err := d.instance.UpdateSyncTag(d.db, deployment, result.Tag); err != nil {
+			log.Printf("Warning: failed to record synced tag for %s: %v", deployment, err)
+		}
+	}
 
-	log.Printf("Synced %s: %s@%s", deployment, result.Branch, shortCommit(result.Commit))
+	log.Printf("Synced %s: %s@%s", deployment, result.Ref(), shortCommit(result.Commit))
+	d.publishDeployEvent(EventNewCommit, deployment, result.Commit, nil)
 
 	// Step 3: Deploy if this is not a self-update
 	if deployment == "stevedore" {
@@ -269,13 +522,24 @@ func (d *Daemon) syncDeployment(parentCtx context.Context, deployment string) {
 		return
 	}
 
+	// Queue behind other deploys; waiting does not count against the timeout
+	release, err := deploySlots.acquire(parentCtx, deployment)
+	if err != nil {
+		log.Printf("Deploy of %s cancelled while queued: %v", deployment, err)
+		return
+	}
+	defer release()
+
 	// Deploy with timeout
 	deployCtx, deployCancel := context.WithTimeout(parentCtx, d.config.DeployTimeout)
 	defer deployCancel()
 
+	d.publishDeployEvent(EventDeployStarted, deployment, result.Commit, nil)
 	deployResult, err := d.instance.Deploy(deployCtx, deployment, ComposeConfig{Build: true})
 	if err != nil {
 		log.Printf("Deploy failed for %s: %v", deployment, err)
+		_ = d.instance.UpdateDeployError(d.db, deployment, err)
+		d.publishDeployEvent(EventDeployFailed, deployment, result.Commit, err)
 		return
 	}
 
@@ -283,22 +547,36 @@ func (d *Daemon) syncDeployment(parentCtx context.Context, deployment string) {
 	if err := d.instance.UpdateDeployStatus(d.db, deployment); err != nil {
 		log.Printf("Warning: failed to update deploy status for %s: %v", deployment, err)
 	}
+	if err := d.instance.SetDesiredState(d.db, deployment, DesiredStateUp); err != nil {
+		log.Printf("Warning: failed to record desired state for %s: %v", deployment, err)
+	}
 
 	log.Printf("Deployed %s: project=%s, services=%v",
 		deployment, deployResult.ProjectName, deployResult.Services)
+	d.publishDeployEvent(EventDeploySucceeded, deployment, result.Commit, nil)
 
 	// Notify query server of deployment change
-	d.queryServer.NotifyChange()
+	d.queryServer.NotifyChange(deployment)
 }
 
-// reconcileAllDeployments checks deployments and restarts stopped services.
-func (d *Daemon) reconcileAllDeployments(ctx context.Context) {
+// publishDeployEvent publishes a deploy lifecycle event on the admin event bus.
+func (d *Daemon) publishDeployEvent(eventType EventType, deployment string, commit string, err error) {
+	details := map[string]string{"commit": commit}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	d.events.Publish(Event{Type: eventType, Deployment: deployment, Details: details})
+}
+
+// reconcileTargets lists the deployments a reconcile pass should look at.
+func (d *Daemon) reconcileTargets() []string {
 	deployments, err := d.instance.ListEnabledDeployments(d.db)
 	if err != nil {
 		log.Printf("Error listing deployments for reconcile: %v", err)
-		return
+		return nil
 	}
 
+	var targets []string
 	for _, deployment := range deployments {
 		if deployment.Deployment == "stevedore" {
 			continue
@@ -306,61 +584,105 @@ func (d *Daemon) reconcileAllDeployments(ctx context.Context) {
 		if d.isActive(deployment.Deployment) {
 			continue
 		}
-		go d.reconcileDeployment(ctx, deployment.Deployment)
+		targets = append(targets, deployment.Deployment)
 	}
+	return targets
 }
 
-// reconcileDeployment ensures a deployment is running if it was previously deployed.
-func (d *Daemon) reconcileDeployment(parentCtx context.Context, deployment string) {
-	d.setActive(deployment, true)
-	defer d.setActive(deployment, false)
+// reconcileAllDeployments checks deployments and restarts stopped services.
+func (d *Daemon) reconcileAllDeployments(ctx context.Context) {
+	for _, deployment := range d.reconcileTargets() {
+		go d.reconcileDeployment(ctx, deployment)
+	}
+}
+
+// startupReconcile runs the first reconcile pass and waits for it, so the log
+// says which deployments came back after the daemon (re)started.
+func (d *Daemon) startupReconcile(ctx context.Context) {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		recovered []string
+	)
+	for _, deployment := range d.reconcileTargets() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if d.reconcileDeployment(ctx, deployment) {
+				mu.Lock()
+				recovered = append(recovered, deployment)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(recovered)
+	log.Printf("Startup reconcile: brought back %d deployment(s): %s", len(recovered), strings.Join(recovered, ", "))
+}
+
+// reconcileDeployment ensures a deployment is running if it was previously
+// deployed, and reports whether it had to redeploy it.
+func (d *Daemon) reconcileDeployment(parentCtx context.Context, deployment string) bool {
+	parentCtx, done := d.setActive(parentCtx, deployment)
+	defer done()
 
 	config, err := d.instance.GetRepoConfig(d.db, deployment)
 	if err != nil {
 		log.Printf("Error loading repo config for %s: %v", deployment, err)
-		return
+		return false
 	}
 	if !config.Enabled {
-		return
+		return false
 	}
 
-	syncStatus, err := d.instance.GetSyncStatus(d.db, deployment)
-	if err != nil {
-		log.Printf("Error getting sync status for %s: %v", deployment, err)
-		return
-	}
-	if syncStatus.LastDeployAt.IsZero() {
-		return
+	if config.DesiredState != DesiredStateUp {
+		return false
 	}
 
 	status, err := d.getDeploymentStatusWithRetry(parentCtx, deployment)
 	if err != nil {
 		log.Printf("Error getting deployment status for %s: %v", deployment, err)
-		return
+		return false
 	}
+	d.checkCrashLoop(parentCtx, deployment, status)
+	d.checkHealthTransition(parentCtx, deployment, status)
 	if !needsReconcile(status) {
-		return
+		return false
 	}
 
 	config, err = d.instance.GetRepoConfig(d.db, deployment)
 	if err != nil {
 		log.Printf("Error loading repo config for %s: %v", deployment, err)
-		return
+		return false
 	}
-	if !config.Enabled {
-		return
+	if !config.Enabled || config.DesiredState != DesiredStateUp {
+		return false
 	}
 
 	log.Printf("Reconcile: deployment %s not running (%s), restarting...", deployment, status.Message)
 
+	if err := d.instance.WaitForDependencies(parentCtx, d.db, deployment, 0); err != nil {
+		log.Printf("Reconcile postponed for %s: %v", deployment, err)
+		_ = d.instance.UpdateDeployError(d.db, deployment, err)
+		return false
+	}
+
+	release, err := deploySlots.acquire(parentCtx, deployment)
+	if err != nil {
+		log.Printf("Reconcile of %s cancelled while queued: %v", deployment, err)
+		return false
+	}
+	defer release()
+
 	deployCtx, deployCancel := context.WithTimeout(parentCtx, d.config.DeployTimeout)
 	defer deployCancel()
 
 	deployResult, err := d.instance.Deploy(deployCtx, deployment, ComposeConfig{})
 	if err != nil {
 		log.Printf("Reconcile deploy failed for %s: %v", deployment, err)
-		_ = d.instance.UpdateSyncError(d.db, deployment, err)
-		return
+		_ = d.instance.UpdateDeployError(d.db, deployment, err)
+		return false
 	}
 
 	if err := d.instance.UpdateDeployStatus(d.db, deployment); err != nil {
@@ -370,7 +692,111 @@ func (d *Daemon) reconcileDeployment(parentCtx context.Context, deployment strin
 	log.Printf("Reconciled %s: project=%s, services=%v",
 		deployment, deployResult.ProjectName, deployResult.Services)
 
-	d.queryServer.NotifyChange()
+	d.queryServer.NotifyChange(deployment)
+	return true
+}
+
+// checkCrashLoop updates the restart history of a deployment and alerts when
+// its containers restart more than CrashLoop.MaxRestarts times within the window.
+// Alerts for the same deployment are rate-limited by CrashLoop.AlertInterval.
+func (d *Daemon) checkCrashLoop(ctx context.Context, deployment string, status *DeploymentStatus) {
+	cfg := d.config.CrashLoop
+	now := time.Now()
+	restarts := d.crashLoops.observe(deployment, status.Containers, now)
+
+	state, err := d.instance.GetCrashLoop(d.db, deployment)
+	if err != nil {
+		log.Printf("Error reading crash loop state for %s: %v", deployment, err)
+		return
+	}
+
+	if restarts < cfg.MaxRestarts {
+		if state != nil && restarts == 0 && d.crashLoops.warmedUp(now) {
+			log.Printf("Crash loop cleared for %s: no restarts in the last %s", deployment, cfg.Window)
+			if err := d.instance.ClearCrashLoop(d.db, deployment); err != nil {
+				log.Printf("Warning: failed to clear crash loop state for %s: %v", deployment, err)
+			}
+		}
+		return
+	}
+
+	if err := d.instance.RecordCrashLoop(d.db, deployment, restarts, cfg.Window, now); err != nil {
+		log.Printf("Warning: failed to record crash loop for %s: %v", deployment, err)
+		return
+	}
+	if state != nil && !state.LastAlertAt.IsZero() && now.Sub(state.LastAlertAt) < cfg.AlertInterval {
+		return
+	}
+
+	log.Printf("Crash loop detected for %s: %d restarts in the last %s", deployment, restarts, cfg.Window)
+	details := map[string]string{
+		"restarts": strconv.Itoa(restarts),
+		"window":   cfg.Window.String(),
+		"message":  fmt.Sprintf("%d container restarts in the last %s", restarts, cfg.Window),
+	}
+	d.queryServer.PublishEvent(EventDeploymentCrashLoop, deployment, details)
+	if err := d.notifier.Send(ctx, Event{Type: EventDeploymentCrashLoop, Deployment: deployment, Timestamp: now, Details: details}); err != nil {
+		log.Printf("Warning: crash loop notification for %s failed: %v", deployment, err)
+	}
+	if err := d.instance.MarkCrashLoopAlerted(d.db, deployment, now); err != nil {
+		log.Printf("Warning: failed to record crash loop alert for %s: %v", deployment, err)
+	}
+}
+
+// checkHealthTransition compares a deployment's health with the last known
+// one and alerts when it turned healthy or unhealthy and stayed so for
+// HealthAlerts.Debounce. Once a deployment reaches HealthAlerts.FlapTransitions
+// transitions within the flap window, it gets a single flapping alert and
+// further transitions are only published, not POSTed, until it settles.
+func (d *Daemon) checkHealthTransition(ctx context.Context, deployment string, status *DeploymentStatus) {
+	cfg := d.config.HealthAlerts
+	now := time.Now()
+
+	state, err := d.instance.GetHealthState(d.db, deployment)
+	if err != nil {
+		log.Printf("Error reading health state for %s: %v", deployment, err)
+		return
+	}
+	next, changed := evaluateHealth(state, deployment, status.Healthy, now, cfg.Debounce)
+	if err := d.instance.SaveHealthState(d.db, next); err != nil {
+		log.Printf("Warning: failed to record health state for %s: %v", deployment, err)
+	}
+	if !changed {
+		return
+	}
+
+	health := "unhealthy"
+	if next.Healthy {
+		health = "healthy"
+	}
+	message := fmt.Sprintf("%s went %s at %s", deployment, health, next.Since.Format(time.RFC3339))
+	log.Printf("Health: %s (%s)", message, status.Message)
+	details := map[string]string{
+		"healthy": strconv.FormatBool(next.Healthy),
+		"since":   next.Since.Format(time.RFC3339),
+		"status":  status.Message,
+		"message": message,
+	}
+	d.queryServer.PublishEvent(EventDeploymentStatusChanged, deployment, details)
+
+	event := Event{Type: EventDeploymentStatusChanged, Deployment: deployment, Timestamp: now, Details: details}
+	switch transitions := d.healthFlaps.record(deployment, now); {
+	case transitions > cfg.FlapTransitions:
+		return
+	case transitions == cfg.FlapTransitions:
+		log.Printf("Health: %s is flapping: %d transitions in the last %s", deployment, transitions, cfg.FlapWindow)
+		details = map[string]string{
+			"transitions": strconv.Itoa(transitions),
+			"window":      cfg.FlapWindow.String(),
+			"healthy":     strconv.FormatBool(next.Healthy),
+			"message":     fmt.Sprintf("%d health transitions in the last %s, now %s", transitions, cfg.FlapWindow, health),
+		}
+		d.queryServer.PublishEvent(EventDeploymentHealthFlapping, deployment, details)
+		event = Event{Type: EventDeploymentHealthFlapping, Deployment: deployment, Timestamp: now, Details: details}
+	}
+	if err := d.notifier.Send(ctx, event); err != nil {
+		log.Printf("Warning: health notification for %s failed: %v", deployment, err)
+	}
 }
 
 // getDeploymentStatusWithRetry retries GetDeploymentStatus once on transient errors
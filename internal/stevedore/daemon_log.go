@@ -0,0 +1,257 @@
+package stevedore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotation of the log files stevedore writes itself: the daemon log and the
+// self-update worker's update.log.
+const (
+	DefaultLogMaxBytes = 10 << 20
+	DefaultLogKeep     = 3
+)
+
+// LogRotation returns the size at which stevedore's own log files are rotated
+// (STEVEDORE_LOG_MAX_BYTES, 0 disables rotation) and how many rotated files
+// are kept (STEVEDORE_LOG_KEEP).
+func LogRotation() (maxBytes int64, keep int) {
+	maxBytes, keep = DefaultLogMaxBytes, DefaultLogKeep
+	if v, err := strconv.ParseInt(strings.TrimSpace(os.Getenv("STEVEDORE_LOG_MAX_BYTES")), 10, 64); err == nil && v >= 0 {
+		maxBytes = v
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("STEVEDORE_LOG_KEEP"))); err == nil && v >= 0 {
+		keep = v
+	}
+	return maxBytes, keep
+}
+
+// DaemonLogPath returns the file the daemon mirrors its log to.
+func (i *Instance) DaemonLogPath() string {
+	return filepath.Join(i.SystemDir(), "logs", "daemon.log")
+}
+
+// updateLogPath returns the log the self-update worker appends to.
+func (i *Instance) updateLogPath() string {
+	return filepath.Join(i.SystemDir(), "update.log")
+}
+
+// RotatingLog is an append-only log file that is rotated to path.1 ...
+// path.<keep> once it would grow beyond maxBytes. Each write is prefixed with
+// a timestamp, as the daemon logs without one.
+type RotatingLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	keep     int
+	file     *os.File
+	size     int64
+	now      func() time.Time
+}
+
+// OpenDaemonLog opens the daemon log with the configured rotation.
+func (i *Instance) OpenDaemonLog() (*RotatingLog, error) {
+	maxBytes, keep := LogRotation()
+	return OpenRotatingLog(i.DaemonLogPath(), maxBytes, keep)
+}
+
+// OpenRotatingLog opens path for appending, creating it and its directory as
+// needed. A maxBytes of zero disables rotation.
+func OpenRotatingLog(path string, maxBytes int64, keep int) (*RotatingLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	l := &RotatingLog{path: path, maxBytes: maxBytes, keep: keep, now: time.Now}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *RotatingLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// Write appends p with a timestamp prefix, rotating the file first when it
+// would exceed the size limit.
+func (l *RotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	line := append([]byte(l.now().UTC().Format(time.RFC3339)+" "), p...)
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		_ = l.file.Close()
+		if err := rotateLogFile(l.path, l.keep); err != nil {
+			return 0, err
+		}
+		if err := l.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the log file.
+func (l *RotatingLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// rotateLogFile shifts path.N to path.N+1, dropping the ones beyond keep, and
+// moves path to path.1. With keep zero, path is removed.
+func rotateLogFile(path string, keep int) error {
+	if keep <= 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.Remove(fmt.Sprintf("%s.%d", path, keep)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for n := keep - 1; n >= 1; n-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, n), fmt.Sprintf("%s.%d", path, n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// rotateLogIfLarge rotates path when it has reached maxBytes. Used for logs
+// written by other processes, such as the self-update worker's update.log.
+func rotateLogIfLarge(path string, maxBytes int64, keep int) error {
+	if maxBytes <= 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() < maxBytes {
+		return nil
+	}
+	return rotateLogFile(path, keep)
+}
+
+// DaemonLogOptions controls StreamDaemonLog.
+type DaemonLogOptions struct {
+	// Follow keeps streaming new lines until ctx is cancelled, across rotations
+	Follow bool
+	// Tail is the number of last lines to show; negative shows the whole file
+	Tail int
+}
+
+// daemonLogPollInterval is how often a followed daemon log is checked for
+// new lines.
+var daemonLogPollInterval = 500 * time.Millisecond
+
+// StreamDaemonLog writes the daemon log to w.
+func (i *Instance) StreamDaemonLog(ctx context.Context, opts DaemonLogOptions, w io.Writer) error {
+	path := i.DaemonLogPath()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no daemon log at %s (is the daemon running?)", path)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := writeLastLines(f, opts.Tail, w); err != nil {
+		return err
+	}
+	if !opts.Follow {
+		return nil
+	}
+
+	ticker := time.NewTicker(daemonLogPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+		// The daemon rotated the file: drain the old one, then switch over
+		current, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		opened, err := f.Stat()
+		if err != nil || os.SameFile(current, opened) {
+			continue
+		}
+		next, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		_ = f.Close()
+		f = next
+	}
+}
+
+// writeLastLines copies the last tail lines of r to w, or everything when
+// tail is negative, leaving r at its end.
+func writeLastLines(r io.Reader, tail int, w io.Writer) error {
+	if tail < 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	lines := make([]string, 0, tail)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if tail == 0 {
+			continue
+		}
+		if len(lines) == tail {
+			lines = lines[1:]
+		}
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
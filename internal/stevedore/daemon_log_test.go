@@ -0,0 +1,135 @@
+package stevedore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingLog_RotatesAndKeepsLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "daemon.log")
+	l, err := OpenRotatingLog(path, 110, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingLog: %v", err)
+	}
+	l.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	// Each line is 21 bytes of timestamp plus 30 bytes: two fit in 110
+	for n := 0; n < 8; n++ {
+		if _, err := fmt.Fprintf(l, "line %02d %s\n", n, strings.Repeat("x", 21)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.HasPrefix(string(current), "2026-01-02T03:04:05Z line 06") || !strings.Contains(string(current), "line 07") {
+		t.Errorf("current log = %q, want the last two lines with timestamps", current)
+	}
+	previous, err := os.ReadFile(path + ".1")
+	if err != nil || !strings.Contains(string(previous), "line 04") {
+		t.Errorf("daemon.log.1 = %q (%v), want lines 04-05", previous, err)
+	}
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Errorf("expected daemon.log.2: %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 rotated files, stat daemon.log.3: %v", err)
+	}
+}
+
+func TestRotateLogIfLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "update.log")
+	if err := rotateLogIfLarge(path, 10, 1); err != nil {
+		t.Fatalf("missing log: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("short\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := rotateLogIfLarge(path, 10, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("a log under the limit must stay: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("long enough to rotate\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := rotateLogIfLarge(path, 10, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected update.log to be rotated away, got %v", err)
+	}
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "long enough to rotate\n" {
+		t.Errorf("update.log.1 = %q", data)
+	}
+
+	// Zero disables rotation
+	if err := os.WriteFile(path, []byte("long enough to rotate\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := rotateLogIfLarge(path, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("rotation disabled, but update.log is gone: %v", err)
+	}
+}
+
+func TestLogRotation_Env(t *testing.T) {
+	t.Setenv("STEVEDORE_LOG_MAX_BYTES", "")
+	t.Setenv("STEVEDORE_LOG_KEEP", "")
+	if maxBytes, keep := LogRotation(); maxBytes != DefaultLogMaxBytes || keep != DefaultLogKeep {
+		t.Errorf("defaults = %d, %d", maxBytes, keep)
+	}
+
+	t.Setenv("STEVEDORE_LOG_MAX_BYTES", "1024")
+	t.Setenv("STEVEDORE_LOG_KEEP", "-1")
+	if maxBytes, keep := LogRotation(); maxBytes != 1024 || keep != DefaultLogKeep {
+		t.Errorf("LogRotation() = %d, %d, want 1024 and the default keep", maxBytes, keep)
+	}
+}
+
+func TestStreamDaemonLog_Tail(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	var out strings.Builder
+	if err := instance.StreamDaemonLog(context.Background(), DaemonLogOptions{Tail: -1}, &out); err == nil {
+		t.Error("expected an error without a daemon log")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(instance.DaemonLogPath()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(instance.DaemonLogPath(), []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		tail int
+		want string
+	}{
+		{-1, "one\ntwo\nthree\n"},
+		{2, "two\nthree\n"},
+		{0, ""},
+	} {
+		out.Reset()
+		if err := instance.StreamDaemonLog(context.Background(), DaemonLogOptions{Tail: tt.tail}, &out); err != nil {
+			t.Fatalf("StreamDaemonLog: %v", err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("tail %d = %q, want %q", tt.tail, out.String(), tt.want)
+		}
+	}
+}
@@ -3,6 +3,9 @@ package stevedore
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -78,18 +81,69 @@ func TestDaemon_SyncTracking(t *testing.T) {
 	}
 
 	// Set syncing
-	daemon.setActive("test-deployment", true)
+	_, done := daemon.setActive(context.Background(), "test-deployment")
 	if !daemon.isActive("test-deployment") {
-		t.Error("expected deployment to be active after setActive(true)")
+		t.Error("expected deployment to be active after setActive")
 	}
 
 	// Clear syncing
-	daemon.setActive("test-deployment", false)
+	done()
 	if daemon.isActive("test-deployment") {
-		t.Error("expected deployment to not be active after setActive(false)")
+		t.Error("expected deployment to not be active after done")
 	}
 }
 
+func TestDaemon_CancelOperation(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	instance := NewInstance(tmpDir)
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout failed: %v", err)
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	daemon := NewDaemon(instance, db, DaemonConfig{
+		AdminKey: "test-key",
+	})
+
+	if daemon.CancelOperation("test-deployment") {
+		t.Error("expected nothing to cancel when no operation is running")
+	}
+
+	ctx, done := daemon.setActive(context.Background(), "test-deployment")
+	if !daemon.CancelOperation("test-deployment") {
+		t.Error("expected the running operation to be cancelled")
+	}
+	if ctx.Err() == nil {
+		t.Error("expected the operation context to be cancelled")
+	}
+
+	// A finished operation must not drop a newer one for the same deployment
+	_, doneNewer := daemon.setActive(context.Background(), "test-deployment")
+	done()
+	if !daemon.isActive("test-deployment") {
+		t.Error("expected the newer operation to stay active")
+	}
+	doneNewer()
+	if daemon.isActive("test-deployment") {
+		t.Error("expected deployment to not be active after done")
+	}
+
+	_, doneWeb := daemon.setActive(context.Background(), "web")
+	_, doneAPI := daemon.setActive(context.Background(), "api")
+	if got := daemon.ActiveOperations(); len(got) != 2 || got[0] != "api" || got[1] != "web" {
+		t.Errorf("ActiveOperations() = %v, want [api web]", got)
+	}
+	doneWeb()
+	doneAPI()
+}
+
 func TestDaemon_RunWithCancellation(t *testing.T) {
 	tmpDir := t.TempDir()
 	t.Setenv("STEVEDORE_DB_KEY", "test-key")
@@ -224,3 +278,298 @@ func TestShortCommit(t *testing.T) {
 		})
 	}
 }
+
+func TestDesiredState(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	// A new deployment is not brought up by reconcile until it is deployed
+	config, err := instance.GetRepoConfig(db, "app")
+	if err != nil {
+		t.Fatalf("GetRepoConfig: %v", err)
+	}
+	if config.DesiredState != DesiredStateDown {
+		t.Errorf("initial desired state = %q, want %q", config.DesiredState, DesiredStateDown)
+	}
+
+	if err := instance.SetDesiredState(db, "app", DesiredStateUp); err != nil {
+		t.Fatalf("SetDesiredState: %v", err)
+	}
+	configs, err := instance.ListEnabledDeployments(db)
+	if err != nil {
+		t.Fatalf("ListEnabledDeployments: %v", err)
+	}
+	if len(configs) != 1 || configs[0].DesiredState != DesiredStateUp {
+		t.Errorf("unexpected configs: %+v", configs)
+	}
+
+	if err := instance.SetDesiredState(db, "app", "running"); err == nil {
+		t.Error("expected error for invalid desired state")
+	}
+}
+
+func TestDaemon_ReconcileTargets(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	for _, name := range []string{"stevedore", "app", "busy"} {
+		if _, err := instance.AddRepo(name, RepoSpec{URL: "git@github.com:acme/" + name + ".git", Branch: "main"}); err != nil {
+			t.Fatalf("AddRepo: %v", err)
+		}
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	daemon := NewDaemon(instance, db, DaemonConfig{
+		AdminKey: "test-key",
+	})
+
+	_, done := daemon.setActive(context.Background(), "busy")
+	defer done()
+
+	// The daemon's own deployment and busy deployments are left alone
+	if targets := daemon.reconcileTargets(); len(targets) != 1 || targets[0] != "app" {
+		t.Errorf("reconcileTargets() = %v, want [app]", targets)
+	}
+
+	// Desired state down: nothing to bring back, docker is never asked
+	if daemon.reconcileDeployment(context.Background(), "app") {
+		t.Error("expected a deployment that is desired down not to be redeployed")
+	}
+}
+
+func TestSetSchedule(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := instance.SetSchedule(db, "app", " 0 3 * * * "); err != nil {
+		t.Fatalf("SetSchedule: %v", err)
+	}
+	configs, err := instance.ListEnabledDeployments(db)
+	if err != nil {
+		t.Fatalf("ListEnabledDeployments: %v", err)
+	}
+	if len(configs) != 1 || configs[0].Schedule != "0 3 * * *" {
+		t.Errorf("unexpected configs: %+v", configs)
+	}
+
+	if err := instance.SetSchedule(db, "app", "0 25 * * *"); err == nil {
+		t.Error("expected error for an invalid cron expression")
+	}
+	if err := instance.SetSchedule(db, "missing", "@daily"); err == nil {
+		t.Error("expected error for an unknown deployment")
+	}
+
+	if err := instance.SetSchedule(db, "app", ""); err != nil {
+		t.Fatalf("SetSchedule clear: %v", err)
+	}
+	config, err := instance.GetRepoConfig(db, "app")
+	if err != nil {
+		t.Fatalf("GetRepoConfig: %v", err)
+	}
+	if config.Schedule != "" {
+		t.Errorf("schedule = %q, want it cleared", config.Schedule)
+	}
+}
+
+func TestUpdateSyncCommitInfo_ClearedByNewCommit(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := EnsureDeploymentRow(db, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.UpdateSyncStatus(db, "app", "aaa1111222233334444"); err != nil {
+		t.Fatalf("UpdateSyncStatus: %v", err)
+	}
+	info := CommitInfo{Author: "Jane Doe", Date: time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC), Subject: "Fix login redirect"}
+	if err := instance.UpdateSyncCommitInfo(db, "app", info); err != nil {
+		t.Fatalf("UpdateSyncCommitInfo: %v", err)
+	}
+
+	status, err := instance.GetSyncStatus(db, "app")
+	if err != nil {
+		t.Fatalf("GetSyncStatus: %v", err)
+	}
+	if !status.LastCommitInfo.Date.Equal(info.Date) || status.LastCommitInfo.Author != info.Author || status.LastCommitInfo.Subject != info.Subject {
+		t.Errorf("LastCommitInfo = %+v, want %+v", status.LastCommitInfo, info)
+	}
+	if got, want := status.CommitSummary(), "aaa111122223 Fix login redirect (Jane Doe, "+info.Date.Local().Format(time.DateOnly)+")"; got != want {
+		t.Errorf("CommitSummary() = %q, want %q", got, want)
+	}
+
+	// A check that finds the same commit keeps the metadata; a new commit drops it
+	if err := instance.UpdateSyncStatus(db, "app", "aaa1111222233334444"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := instance.GetSyncStatus(db, "app"); status.LastCommitInfo.Subject != info.Subject {
+		t.Errorf("LastCommitInfo after a check = %+v, want it kept", status.LastCommitInfo)
+	}
+	if err := instance.UpdateSyncStatus(db, "app", "bbb2222333344445555"); err != nil {
+		t.Fatal(err)
+	}
+	status, _ = instance.GetSyncStatus(db, "app")
+	if status.LastCommitInfo != (CommitInfo{}) {
+		t.Errorf("LastCommitInfo after a new commit = %+v, want it cleared", status.LastCommitInfo)
+	}
+	if got := status.CommitSummary(); got != "bbb222233334" {
+		t.Errorf("CommitSummary() = %q, want the short commit only", got)
+	}
+}
+
+func TestRecordUpdateAvailable_OncePerCommit(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := EnsureDeploymentRow(db, "manual"); err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.UpdateSyncStatus(db, "manual", "aaa111"); err != nil {
+		t.Fatalf("UpdateSyncStatus: %v", err)
+	}
+
+	steps := []struct {
+		remote string
+		want   bool
+	}{
+		{"bbb222", true},  // first sighting alerts
+		{"bbb222", false}, // every later poll stays quiet
+		{"ccc333", true},  // another push alerts again
+		{"", true},        // up to date again
+		{"", false},
+	}
+	for _, step := range steps {
+		got, err := instance.RecordUpdateAvailable(db, "manual", step.remote)
+		if err != nil {
+			t.Fatalf("RecordUpdateAvailable(%q): %v", step.remote, err)
+		}
+		if got != step.want {
+			t.Errorf("RecordUpdateAvailable(%q) = %v, want %v", step.remote, got, step.want)
+		}
+	}
+
+	// A check that finds the same commit keeps the update; a sync clears it
+	if _, err := instance.RecordUpdateAvailable(db, "manual", "ddd444"); err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.UpdateSyncStatus(db, "manual", "aaa111"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := instance.GetSyncStatus(db, "manual"); status.UpdateAvailable != "ddd444" {
+		t.Errorf("UpdateAvailable after a check = %q, want ddd444", status.UpdateAvailable)
+	}
+	if err := instance.UpdateSyncStatus(db, "manual", "ddd444"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := instance.GetSyncStatus(db, "manual"); status.UpdateAvailable != "" {
+		t.Errorf("UpdateAvailable after a sync = %q, want empty", status.UpdateAvailable)
+	}
+}
+
+func TestDaemon_SyncWaitsForDependenciesBeforeSyncing(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	for _, name := range []string{"db", "api"} {
+		if _, err := instance.AddRepo(name, RepoSpec{URL: "git@github.com:acme/" + name + ".git"}); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer db.Close()
+	if err := instance.SetDependencies(db, "api", []string{"db"}); err != nil {
+		t.Fatalf("SetDependencies: %v", err)
+	}
+	if err := instance.SetDeploymentEnabled(db, "api", true); err != nil {
+		t.Fatalf("SetDeploymentEnabled: %v", err)
+	}
+	// Fail the wait for a stopped db after a second instead of the default timeout
+	for name, value := range map[string]string{ParamHealthInterval: "1", ParamHealthStartPeriod: "1"} {
+		if err := instance.SetParameter("db", name, []byte(value)); err != nil {
+			t.Fatalf("SetParameter: %v", err)
+		}
+	}
+
+	// The db container runs once READY exists; `docker run` (the git worker
+	// that syncs api) is recorded and fails
+	bin := t.TempDir()
+	ready := filepath.Join(bin, "ready")
+	runs := filepath.Join(bin, "runs.log")
+	script := `#!/bin/sh
+case "$1" in
+ps) echo 0123456789abcdef ;;
+inspect)
+  state=exited
+  [ -f READY ] && state=running
+  echo '[{"Id":"0123456789abcdef","Name":"/db-1","State":{"Status":"'$state'"},"Config":{"Labels":{"com.docker.compose.service":"db"}}}]'
+  ;;
+run) echo run >> RUNS; exit 1 ;;
+*) exit 1 ;;
+esac
+`
+	script = strings.NewReplacer("READY", ready, "RUNS", runs).Replace(script)
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	t.Setenv("STEVEDORE_DOCKER_BIN", "")
+
+	daemon := NewDaemon(instance, db, DaemonConfig{AdminKey: "test-key"})
+	synced := func() bool {
+		_, err := os.Stat(runs)
+		return err == nil
+	}
+
+	daemon.syncDeployment(context.Background(), "api")
+	if synced() {
+		t.Fatal("api was synced while its dependency was not ready")
+	}
+	status, err := instance.GetSyncStatus(db, "api")
+	if err != nil || !strings.Contains(status.LastError, "dependency db") {
+		t.Errorf("sync status after the first poll = %+v, %v", status, err)
+	}
+
+	// The next poll still sees the commit as new and syncs it
+	if err := os.WriteFile(ready, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	daemon.syncDeployment(context.Background(), "api")
+	if !synced() {
+		t.Error("api was not synced once its dependency became ready")
+	}
+}
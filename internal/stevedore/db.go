@@ -21,6 +21,11 @@ func (i *Instance) DBKeyPath() string {
 }
 
 func (i *Instance) OpenDB() (*sql.DB, error) {
+	return i.openDB(true)
+}
+
+// openDB opens the encrypted database, optionally applying pending migrations.
+func (i *Instance) openDB(migrate bool) (*sql.DB, error) {
 	if err := i.EnsureLayout(); err != nil {
 		return nil, err
 	}
@@ -46,6 +51,9 @@ func (i *Instance) OpenDB() (*sql.DB, error) {
 		_ = db.Close()
 		return nil, err
 	}
+	if !migrate {
+		return db, nil
+	}
 	if err := migrateDB(db); err != nil {
 		_ = db.Close()
 		return nil, err
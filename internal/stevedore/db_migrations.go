@@ -3,6 +3,7 @@ package stevedore
 import (
 	"database/sql"
 	"fmt"
+	"time"
 )
 
 // Migration represents a database migration with a version and SQL statements.
@@ -10,6 +11,8 @@ type Migration struct {
 	Version     int
 	Description string
 	Up          string
+	// AppliedAt is only set on migrations returned by GetAppliedMigrations
+	AppliedAt time.Time
 }
 
 // Migrations is the ordered list of all database migrations.
@@ -76,6 +79,193 @@ CREATE TABLE IF NOT EXISTS query_tokens (
 	created_at INTEGER NOT NULL DEFAULT (CAST(strftime('%s','now') AS INTEGER)),
 	FOREIGN KEY (deployment) REFERENCES deployments(name) ON DELETE CASCADE
 );
+`,
+	},
+	{
+		Version:     5,
+		Description: "Add tag tracking: repository tag pattern and last synced tag",
+		Up: `
+ALTER TABLE repositories ADD COLUMN tag_pattern TEXT NOT NULL DEFAULT '';
+ALTER TABLE sync_status ADD COLUMN last_tag TEXT;
+`,
+	},
+	{
+		Version:     6,
+		Description: "Add deployment dependencies",
+		Up: `
+CREATE TABLE IF NOT EXISTS deployment_dependencies (
+	deployment TEXT NOT NULL,
+	depends_on TEXT NOT NULL,
+	PRIMARY KEY (deployment, depends_on),
+	FOREIGN KEY (deployment) REFERENCES deployments(name) ON DELETE CASCADE,
+	FOREIGN KEY (depends_on) REFERENCES deployments(name) ON DELETE CASCADE
+);
+`,
+	},
+	{
+		Version:     7,
+		Description: "Add desired state to repositories",
+		Up: `
+ALTER TABLE repositories ADD COLUMN desired_state TEXT NOT NULL DEFAULT 'down';
+UPDATE repositories SET desired_state = 'up'
+WHERE enabled = 1
+  AND deployment IN (SELECT deployment FROM sync_status WHERE last_deploy_at IS NOT NULL);
+`,
+	},
+	{
+		Version:     8,
+		Description: "Add crash loop tracking",
+		Up: `
+CREATE TABLE IF NOT EXISTS crash_loops (
+	deployment TEXT PRIMARY KEY,
+	restarts INTEGER NOT NULL,
+	window_seconds INTEGER NOT NULL,
+	detected_at INTEGER NOT NULL,
+	last_alert_at INTEGER,
+	FOREIGN KEY (deployment) REFERENCES deployments(name) ON DELETE CASCADE
+);
+`,
+	},
+	{
+		Version:     9,
+		Description: "Add parameter history",
+		Up: `
+CREATE TABLE IF NOT EXISTS parameter_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	deployment TEXT NOT NULL,
+	name TEXT NOT NULL,
+	value BLOB NOT NULL,
+	set_at INTEGER NOT NULL,
+	replaced_at INTEGER NOT NULL,
+	FOREIGN KEY (deployment) REFERENCES deployments(name) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_parameter_history_name ON parameter_history(deployment, name, id);
+`,
+	},
+	{
+		Version:     10,
+		Description: "Add deploy hash to sync status",
+		Up: `
+ALTER TABLE sync_status ADD COLUMN last_deploy_hash TEXT;
+`,
+	},
+	{
+		Version:     11,
+		Description: "Add cron schedule to repositories",
+		Up: `
+ALTER TABLE repositories ADD COLUMN schedule TEXT NOT NULL DEFAULT '';
+`,
+	},
+	{
+		Version:     12,
+		Description: "Add maintenance window",
+		Up: `
+CREATE TABLE IF NOT EXISTS maintenance (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	started_at INTEGER NOT NULL,
+	ends_at INTEGER
+);
+`,
+	},
+	{
+		Version:     13,
+		Description: "Add service scale overrides",
+		Up: `
+CREATE TABLE IF NOT EXISTS service_scales (
+	deployment TEXT NOT NULL,
+	service TEXT NOT NULL,
+	replicas INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (deployment, service),
+	FOREIGN KEY (deployment) REFERENCES deployments(name) ON DELETE CASCADE
+);
+`,
+	},
+	{
+		Version:     14,
+		Description: "Record when query tokens were last used",
+		Up: `
+ALTER TABLE query_tokens ADD COLUMN last_used_at INTEGER;
+`,
+	},
+	{
+		Version:     15,
+		Description: "Record updates available to disabled deployments",
+		Up: `
+ALTER TABLE sync_status ADD COLUMN update_available TEXT;
+`,
+	},
+	{
+		Version:     16,
+		Description: "Add deploy history",
+		Up: `
+CREATE TABLE IF NOT EXISTS deploy_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	deployment TEXT NOT NULL,
+	started_at INTEGER NOT NULL,
+	finished_at INTEGER NOT NULL,
+	commit_sha TEXT,
+	success INTEGER NOT NULL,
+	error TEXT,
+	FOREIGN KEY (deployment) REFERENCES deployments(name) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_deploy_history_deployment ON deploy_history(deployment, id);
+`,
+	},
+	{
+		Version:     17,
+		Description: "Add archived deployments",
+		Up: `
+ALTER TABLE repositories ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		Version:     18,
+		Description: "Add commit metadata to sync status",
+		Up: `
+ALTER TABLE sync_status ADD COLUMN last_commit_author TEXT;
+ALTER TABLE sync_status ADD COLUMN last_commit_date INTEGER;
+ALTER TABLE sync_status ADD COLUMN last_commit_subject TEXT;
+`,
+	},
+	{
+		Version:     19,
+		Description: "Add pinned image digests to deploy history",
+		Up: `
+ALTER TABLE deploy_history ADD COLUMN images TEXT;
+`,
+	},
+	{
+		Version:     20,
+		Description: "Add deployment tags",
+		Up: `
+CREATE TABLE IF NOT EXISTS deployment_tags (
+	deployment TEXT NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (deployment, tag),
+	FOREIGN KEY (deployment) REFERENCES deployments(name) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_deployment_tags_tag ON deployment_tags(tag);
+`,
+	},
+	{
+		Version:     21,
+		Description: "Add last known deployment health",
+		Up: `
+CREATE TABLE IF NOT EXISTS health_states (
+	deployment TEXT PRIMARY KEY,
+	healthy INTEGER NOT NULL,
+	since INTEGER NOT NULL,
+	pending_since INTEGER,
+	FOREIGN KEY (deployment) REFERENCES deployments(name) ON DELETE CASCADE
+);
+`,
+	},
+	{
+		Version:     22,
+		Description: "Count consecutive sync failures for poll backoff",
+		Up: `
+ALTER TABLE sync_status ADD COLUMN sync_failures INTEGER NOT NULL DEFAULT 0;
 `,
 	},
 }
@@ -153,7 +343,7 @@ func GetSchemaVersion(db *sql.DB) (int, error) {
 
 // GetAppliedMigrations returns all applied migrations from the database.
 func GetAppliedMigrations(db *sql.DB) ([]Migration, error) {
-	rows, err := db.Query(`SELECT version, description FROM schema_migrations ORDER BY version;`)
+	rows, err := db.Query(`SELECT version, description, applied_at FROM schema_migrations ORDER BY version;`)
 	if err != nil {
 		return nil, err
 	}
@@ -162,9 +352,11 @@ func GetAppliedMigrations(db *sql.DB) ([]Migration, error) {
 	var migrations []Migration
 	for rows.Next() {
 		var m Migration
-		if err := rows.Scan(&m.Version, &m.Description); err != nil {
+		var appliedAt int64
+		if err := rows.Scan(&m.Version, &m.Description, &appliedAt); err != nil {
 			return nil, err
 		}
+		m.AppliedAt = time.Unix(appliedAt, 0)
 		migrations = append(migrations, m)
 	}
 	return migrations, rows.Err()
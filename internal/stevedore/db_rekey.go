@@ -0,0 +1,106 @@
+package stevedore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// RekeyResult reports where the new database key was stored.
+type RekeyResult struct {
+	// KeyFile is the key file that now holds the new key. It is empty when
+	// the key came from STEVEDORE_DB_KEY, which the caller must update.
+	KeyFile string
+}
+
+// RekeyDB re-encrypts the database in place with newKey using SQLCipher's
+// PRAGMA rekey, then verifies that the new key opens it. The key file the
+// current key was read from is updated as well. The daemon must not be
+// running: it holds the database open with the old key.
+func (i *Instance) RekeyDB(newKey string) (*RekeyResult, error) {
+	if newKey == "" || strings.TrimSpace(newKey) != newKey {
+		return nil, errors.New("new database key must be non-empty and have no leading or trailing whitespace")
+	}
+
+	currentKey, err := i.dbKey()
+	if err != nil {
+		return nil, err
+	}
+	if newKey == currentKey {
+		return nil, errors.New("new database key is the same as the current key")
+	}
+
+	keyFile := i.dbKeyFile()
+
+	// Stage the new key next to the key file first: if anything below fails
+	// half-way, the new key is not lost.
+	var stagedKey string
+	if keyFile != "" {
+		stagedKey = keyFile + ".new"
+		if err := os.WriteFile(stagedKey, []byte(newKey+"\n"), 0o600); err != nil {
+			return nil, fmt.Errorf("stage new key: %w", err)
+		}
+	}
+
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+
+	// Fold the WAL into the main file and leave WAL mode so every page is
+	// re-encrypted by the rekey, then restore WAL mode.
+	for _, stmt := range []string{
+		"PRAGMA wal_checkpoint(TRUNCATE);",
+		"PRAGMA journal_mode = DELETE;",
+		fmt.Sprintf("PRAGMA rekey = '%s';", strings.ReplaceAll(newKey, "'", "''")),
+		"PRAGMA journal_mode = WAL;",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("rekey database: %w", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		return nil, fmt.Errorf("close database after rekey: %w", err)
+	}
+
+	if err := i.verifyDBKey(newKey); err != nil {
+		return nil, fmt.Errorf("verify new key (staged at %s): %w", stagedKey, err)
+	}
+
+	if keyFile == "" {
+		return &RekeyResult{}, nil
+	}
+	if err := os.Rename(stagedKey, keyFile); err != nil {
+		return nil, fmt.Errorf("database re-encrypted, but updating %s failed (new key is in %s): %w", keyFile, stagedKey, err)
+	}
+	return &RekeyResult{KeyFile: keyFile}, nil
+}
+
+// dbKeyFile returns the file dbKey reads the key from, or "" when the key is
+// passed directly via STEVEDORE_DB_KEY.
+func (i *Instance) dbKeyFile() string {
+	if strings.TrimSpace(os.Getenv("STEVEDORE_DB_KEY")) != "" {
+		return ""
+	}
+	if keyFile := strings.TrimSpace(os.Getenv("STEVEDORE_DB_KEY_FILE")); keyFile != "" {
+		return keyFile
+	}
+	return i.DBKeyPath()
+}
+
+// verifyDBKey opens the database with key and reads the schema.
+func (i *Instance) verifyDBKey(key string) error {
+	dsn := fmt.Sprintf("file:%s?_pragma_key=%s", i.DBPath(), url.QueryEscape(key))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	var version int
+	return db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`).Scan(&version)
+}
@@ -0,0 +1,96 @@
+package stevedore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRekeyDB_KeyFile(t *testing.T) {
+	root := t.TempDir()
+	instance := NewInstance(root)
+	t.Setenv("STEVEDORE_DB_KEY", "")
+
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(instance.DBKeyPath(), []byte("old-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if err := instance.SetParameter("app", "SECRET", []byte("s3cret")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+
+	result, err := instance.RekeyDB("new-key")
+	if err != nil {
+		t.Fatalf("RekeyDB: %v", err)
+	}
+	if result.KeyFile != instance.DBKeyPath() {
+		t.Errorf("KeyFile = %q, want %q", result.KeyFile, instance.DBKeyPath())
+	}
+
+	b, err := os.ReadFile(instance.DBKeyPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(b)) != "new-key" {
+		t.Errorf("key file = %q, want new-key", b)
+	}
+	if _, err := os.Stat(instance.DBKeyPath() + ".new"); !os.IsNotExist(err) {
+		t.Errorf("staged key should be renamed away, stat err = %v", err)
+	}
+
+	// Data survives and is readable with the new key only
+	value, err := instance.GetParameter("app", "SECRET")
+	if err != nil {
+		t.Fatalf("GetParameter after rekey: %v", err)
+	}
+	if string(value) != "s3cret" {
+		t.Errorf("parameter = %q, want s3cret", value)
+	}
+	if err := instance.verifyDBKey("old-key"); err == nil {
+		t.Error("old key should no longer open the database")
+	}
+}
+
+func TestRekeyDB_EnvKey(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "env-key")
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	_ = db.Close()
+
+	result, err := instance.RekeyDB("rotated")
+	if err != nil {
+		t.Fatalf("RekeyDB: %v", err)
+	}
+	if result.KeyFile != "" {
+		t.Errorf("expected no key file for env key, got %q", result.KeyFile)
+	}
+	if _, err := os.Stat(filepath.Join(instance.SystemDir(), "db.key.new")); !os.IsNotExist(err) {
+		t.Error("no key file should be staged when the key comes from the environment")
+	}
+
+	t.Setenv("STEVEDORE_DB_KEY", "rotated")
+	if _, err := instance.GetDBStatus(); err != nil {
+		t.Fatalf("GetDBStatus with rotated key: %v", err)
+	}
+}
+
+func TestRekeyDB_RejectsBadKeys(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "same")
+
+	for _, key := range []string{"", " padded", "same"} {
+		if _, err := instance.RekeyDB(key); err == nil {
+			t.Errorf("RekeyDB(%q) expected error", key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package stevedore
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// DBStatus describes the schema version and health of the state database.
+type DBStatus struct {
+	Path          string
+	SchemaVersion int
+	LatestVersion int
+	// Applied lists the migrations recorded in schema_migrations
+	Applied []Migration
+	// Pending lists known migrations that have not been applied yet
+	Pending []Migration
+	// Integrity holds the rows returned by PRAGMA integrity_check ("ok" when healthy)
+	Integrity []string
+}
+
+// UpToDate reports whether every known migration has been applied.
+func (s *DBStatus) UpToDate() bool {
+	return len(s.Pending) == 0 && s.SchemaVersion == s.LatestVersion
+}
+
+// IntegrityOK reports whether PRAGMA integrity_check found no problems.
+func (s *DBStatus) IntegrityOK() bool {
+	return len(s.Integrity) == 1 && s.Integrity[0] == "ok"
+}
+
+// GetDBStatus inspects the database without applying migrations, so a
+// database left behind by a failed upgrade can still be examined.
+func (i *Instance) GetDBStatus() (*DBStatus, error) {
+	db, err := i.openDB(false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	status := &DBStatus{
+		Path:          i.DBPath(),
+		LatestVersion: CurrentSchemaVersion(),
+	}
+
+	var hasTable int
+	if err := db.QueryRow(
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations';`,
+	).Scan(&hasTable); err != nil {
+		return nil, fmt.Errorf("read schema: %w", err)
+	}
+
+	if hasTable > 0 {
+		if status.SchemaVersion, err = GetSchemaVersion(db); err != nil {
+			return nil, fmt.Errorf("get schema version: %w", err)
+		}
+		if status.Applied, err = GetAppliedMigrations(db); err != nil {
+			return nil, fmt.Errorf("get applied migrations: %w", err)
+		}
+	}
+
+	for _, m := range Migrations {
+		if m.Version > status.SchemaVersion {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+
+	if status.Integrity, err = checkDBIntegrity(db); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// checkDBIntegrity runs PRAGMA integrity_check and returns its result rows.
+func checkDBIntegrity(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`PRAGMA integrity_check;`)
+	if err != nil {
+		return nil, fmt.Errorf("integrity check: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var result []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("integrity check: %w", err)
+		}
+		result = append(result, line)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,63 @@
+package stevedore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDBStatus_UpToDate(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	_ = db.Close()
+
+	status, err := instance.GetDBStatus()
+	if err != nil {
+		t.Fatalf("GetDBStatus: %v", err)
+	}
+
+	if !status.UpToDate() {
+		t.Errorf("expected up to date, got version %d of %d (pending %d)", status.SchemaVersion, status.LatestVersion, len(status.Pending))
+	}
+	if len(status.Applied) != len(Migrations) {
+		t.Errorf("applied = %d, want %d", len(status.Applied), len(Migrations))
+	}
+	for _, m := range status.Applied {
+		if m.AppliedAt.IsZero() || time.Since(m.AppliedAt) > time.Hour {
+			t.Errorf("migration %d has implausible AppliedAt %v", m.Version, m.AppliedAt)
+		}
+	}
+	if !status.IntegrityOK() {
+		t.Errorf("expected integrity ok, got %v", status.Integrity)
+	}
+}
+
+func TestGetDBStatus_DoesNotMigrate(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	// A database that was never migrated reports everything as pending
+	status, err := instance.GetDBStatus()
+	if err != nil {
+		t.Fatalf("GetDBStatus: %v", err)
+	}
+	if status.SchemaVersion != 0 || len(status.Applied) != 0 {
+		t.Errorf("expected empty schema, got version %d with %d applied", status.SchemaVersion, len(status.Applied))
+	}
+	if len(status.Pending) != len(Migrations) || status.UpToDate() {
+		t.Errorf("expected all %d migrations pending, got %d", len(Migrations), len(status.Pending))
+	}
+
+	// Inspecting must not have applied anything
+	status, err = instance.GetDBStatus()
+	if err != nil {
+		t.Fatalf("GetDBStatus: %v", err)
+	}
+	if status.SchemaVersion != 0 {
+		t.Errorf("GetDBStatus applied migrations: version %d", status.SchemaVersion)
+	}
+}
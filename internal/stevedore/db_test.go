@@ -140,7 +140,7 @@ func TestMigrations_SchemaDetails(t *testing.T) {
 	// Test repositories table columns
 	t.Run("repositories", func(t *testing.T) {
 		columns := getTableColumns(t, db, "repositories")
-		expected := []string{"deployment", "url", "branch", "updated_at"}
+		expected := []string{"deployment", "url", "branch", "updated_at", "desired_state"}
 		for _, col := range expected {
 			if !columns[col] {
 				t.Errorf("missing column %q in repositories", col)
@@ -0,0 +1,312 @@
+package stevedore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfigFile is the optional stevedore settings file next to the compose
+// entrypoint: at the root of a deployment's repository, or of its --subdir.
+const RepoConfigFile = ".stevedore.yaml"
+
+// DefaultDependencyWaitTimeout bounds how long a deploy waits for its
+// dependencies to become healthy.
+const DefaultDependencyWaitTimeout = 5 * time.Minute
+
+// repoConfigFile is the content of .stevedore.yaml.
+type repoConfigFile struct {
+	DependsOn []string `yaml:"depends_on"`
+}
+
+// readRepoDependencies returns the depends_on list from the deployment's
+// checked-out .stevedore.yaml, or nil when the file does not exist.
+func (i *Instance) readRepoDependencies(deployment string) ([]string, error) {
+	path := filepath.Join(i.composeDir(deployment), RepoConfigFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var cfg repoConfigFile
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s of %s: %w", RepoConfigFile, deployment, err)
+	}
+	for _, dep := range cfg.DependsOn {
+		if err := ValidateDeploymentName(dep); err != nil {
+			return nil, fmt.Errorf("%s of %s: %w", RepoConfigFile, deployment, err)
+		}
+	}
+	return cfg.DependsOn, nil
+}
+
+// SetDependencies replaces the dependencies declared for a deployment via the
+// CLI. An empty list clears them. Dependencies must be existing deployments and
+// must not introduce a cycle.
+func (i *Instance) SetDependencies(db *sql.DB, deployment string, dependsOn []string) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+	for _, dep := range dependsOn {
+		if err := ValidateDeploymentName(dep); err != nil {
+			return err
+		}
+		if dep == deployment {
+			return fmt.Errorf("deployment %s cannot depend on itself", deployment)
+		}
+		if _, err := os.Stat(i.DeploymentDir(dep)); err != nil {
+			return fmt.Errorf("dependency %s is not a deployment", dep)
+		}
+	}
+
+	graph, err := i.DependencyGraph(db)
+	if err != nil {
+		return err
+	}
+	repoDeps, err := i.readRepoDependencies(deployment)
+	if err != nil {
+		return err
+	}
+	graph[deployment] = uniqueSorted(append(repoDeps, dependsOn...))
+	if cycle := findDependencyCycle(graph); cycle != nil {
+		return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM deployment_dependencies WHERE deployment = ?`, deployment); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, dep := range dependsOn {
+		if _, err := tx.Exec(
+			`INSERT OR IGNORE INTO deployment_dependencies (deployment, depends_on) VALUES (?, ?)`,
+			deployment, dep,
+		); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDependencies returns the deployments a deployment depends on: the union
+// of the ones declared with `repo set-depends` and the repository's .stevedore.yaml.
+func (i *Instance) GetDependencies(db *sql.DB, deployment string) ([]string, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT depends_on FROM deployment_dependencies WHERE deployment = ?`, deployment)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var deps []string
+	for rows.Next() {
+		var dep string
+		if err := rows.Scan(&dep); err != nil {
+			return nil, err
+		}
+		deps = append(deps, dep)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	repoDeps, err := i.readRepoDependencies(deployment)
+	if err != nil {
+		return nil, err
+	}
+	return uniqueSorted(append(deps, repoDeps...)), nil
+}
+
+// DependencyGraph returns the dependencies of every deployment. Dependencies
+// on deployments that do not exist (possible via .stevedore.yaml) are left
+// out, so nothing waits for or deploys them.
+func (i *Instance) DependencyGraph(db *sql.DB) (map[string][]string, error) {
+	deployments, err := i.ListDeployments()
+	if err != nil {
+		return nil, err
+	}
+
+	graph := make(map[string][]string, len(deployments))
+	for _, deployment := range deployments {
+		deps, err := i.GetDependencies(db, deployment)
+		if err != nil {
+			return nil, err
+		}
+		graph[deployment] = deps
+	}
+	for deployment, deps := range graph {
+		graph[deployment] = slices.DeleteFunc(deps, func(dep string) bool {
+			_, ok := graph[dep]
+			return !ok
+		})
+	}
+	return graph, nil
+}
+
+// DeployOrder returns deployment and everything it transitively depends on,
+// dependencies first. It fails on a dependency cycle.
+func (i *Instance) DeployOrder(db *sql.DB, deployment string) ([]string, error) {
+	graph, err := i.DependencyGraph(db)
+	if err != nil {
+		return nil, err
+	}
+	return dependencyOrder(graph, deployment)
+}
+
+// DeployOrderAll returns every deployment, dependencies before the
+// deployments that need them. It fails on a dependency cycle.
+func (i *Instance) DeployOrderAll(db *sql.DB) ([]string, error) {
+	graph, err := i.DependencyGraph(db)
+	if err != nil {
+		return nil, err
+	}
+	return dependencyOrderAll(graph)
+}
+
+// WaitForDependencies blocks until every direct dependency of deployment is
+// healthy, checking them in order. A dependency cycle is reported as an error.
+func (i *Instance) WaitForDependencies(ctx context.Context, db *sql.DB, deployment string, timeout time.Duration) error {
+	graph, err := i.DependencyGraph(db)
+	if err != nil {
+		return err
+	}
+	if cycle := findDependencyCycle(graph); cycle != nil {
+		return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	if timeout == 0 {
+		timeout = DefaultDependencyWaitTimeout
+	}
+
+	for _, dep := range graph[deployment] {
+		if err := i.WaitForHealthy(ctx, dep, i.HealthWaitOptions(dep, timeout)); err != nil {
+			return fmt.Errorf("dependency %s: %w", dep, err)
+		}
+	}
+	return nil
+}
+
+// dependencyOrder topologically sorts root and its transitive dependencies.
+func dependencyOrder(graph map[string][]string, root string) ([]string, error) {
+	var order []string
+	if cycle := walkDependencies(graph, root, make(map[string]int), nil, &order); cycle != nil {
+		return nil, fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return order, nil
+}
+
+// dependencyOrderAll topologically sorts every deployment in graph, taking
+// independent ones alphabetically. Dependencies missing from graph are left
+// out.
+func dependencyOrderAll(graph map[string][]string) ([]string, error) {
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	state := make(map[string]int)
+	var order []string
+	for _, name := range names {
+		if cycle := walkDependencies(graph, name, state, nil, &order); cycle != nil {
+			return nil, fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	result := make([]string, 0, len(names))
+	for _, name := range order {
+		if _, ok := graph[name]; ok {
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// findDependencyCycle returns a cycle in graph (first node repeated at the
+// end), or nil when there is none.
+func findDependencyCycle(graph map[string][]string) []string {
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	state := make(map[string]int)
+	var order []string
+	for _, name := range names {
+		if cycle := walkDependencies(graph, name, state, nil, &order); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// Depth-first search states for walkDependencies.
+const (
+	depUnvisited = iota
+	depVisiting
+	depDone
+)
+
+// walkDependencies appends name and its dependencies to order in post-order
+// (dependencies first) and returns the first cycle it runs into.
+func walkDependencies(graph map[string][]string, name string, state map[string]int, path []string, order *[]string) []string {
+	switch state[name] {
+	case depDone:
+		return nil
+	case depVisiting:
+		return cycleFrom(path, name)
+	}
+	state[name] = depVisiting
+	path = append(path, name)
+	for _, dep := range graph[name] {
+		if cycle := walkDependencies(graph, dep, state, path, order); cycle != nil {
+			return cycle
+		}
+	}
+	state[name] = depDone
+	*order = append(*order, name)
+	return nil
+}
+
+// cycleFrom returns the part of path starting at name, closed with name again.
+func cycleFrom(path []string, name string) []string {
+	for idx, n := range path {
+		if n == name {
+			cycle := append([]string{}, path[idx:]...)
+			return append(cycle, name)
+		}
+	}
+	return []string{name, name}
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,180 @@
+package stevedore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDependencyOrder(t *testing.T) {
+	graph := map[string][]string{
+		"api":   {"db", "cache"},
+		"cache": nil,
+		"db":    {"volumes"},
+	}
+
+	order, err := dependencyOrder(graph, "api")
+	if err != nil {
+		t.Fatalf("dependencyOrder: %v", err)
+	}
+	want := []string{"volumes", "db", "cache", "api"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestDependencyOrderAll(t *testing.T) {
+	graph := map[string][]string{
+		"web":   {"api"},
+		"api":   {"db", "missing"},
+		"db":    nil,
+		"batch": nil,
+	}
+
+	order, err := dependencyOrderAll(graph)
+	if err != nil {
+		t.Fatalf("dependencyOrderAll: %v", err)
+	}
+	want := []string{"db", "api", "batch", "web"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+
+	if _, err := dependencyOrderAll(map[string][]string{"a": {"b"}, "b": {"a"}}); err == nil {
+		t.Error("expected a cycle error")
+	}
+}
+
+func TestFindDependencyCycle(t *testing.T) {
+	if cycle := findDependencyCycle(map[string][]string{"api": {"db"}, "db": nil}); cycle != nil {
+		t.Errorf("unexpected cycle: %v", cycle)
+	}
+
+	cycle := findDependencyCycle(map[string][]string{
+		"api":   {"db"},
+		"db":    {"cache"},
+		"cache": {"api"},
+	})
+	want := []string{"api", "db", "cache", "api"}
+	if !reflect.DeepEqual(cycle, want) {
+		t.Errorf("cycle = %v, want %v", cycle, want)
+	}
+
+	if _, err := dependencyOrder(map[string][]string{"a": {"a"}}, "a"); err == nil {
+		t.Error("expected self-dependency to be a cycle")
+	}
+}
+
+func TestSetDependencies(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	for _, name := range []string{"api", "db", "cache"} {
+		if _, err := instance.AddRepo(name, RepoSpec{URL: "git@github.com:acme/" + name + ".git", Branch: "main"}); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := instance.SetDependencies(db, "api", []string{"db"}); err != nil {
+		t.Fatalf("SetDependencies: %v", err)
+	}
+
+	// .stevedore.yaml dependencies are merged with the CLI-declared ones
+	repoConfig := filepath.Join(instance.DeploymentDir("api"), "repo", "git", RepoConfigFile)
+	if err := os.WriteFile(repoConfig, []byte("depends_on:\n  - cache\n"), 0o644); err != nil {
+		t.Fatalf("write %s: %v", RepoConfigFile, err)
+	}
+	deps, err := instance.GetDependencies(db, "api")
+	if err != nil {
+		t.Fatalf("GetDependencies: %v", err)
+	}
+	if want := []string{"cache", "db"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("deps = %v, want %v", deps, want)
+	}
+
+	order, err := instance.DeployOrder(db, "api")
+	if err != nil {
+		t.Fatalf("DeployOrder: %v", err)
+	}
+	if want := []string{"cache", "db", "api"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+
+	err = instance.SetDependencies(db, "db", []string{"api"})
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+	if err := instance.SetDependencies(db, "api", []string{"api"}); err == nil {
+		t.Error("expected error for self-dependency")
+	}
+	if err := instance.SetDependencies(db, "api", []string{"missing"}); err == nil {
+		t.Error("expected error for unknown dependency")
+	}
+
+	// An empty list clears the CLI-declared dependencies
+	if err := instance.SetDependencies(db, "api", nil); err != nil {
+		t.Fatalf("SetDependencies(nil): %v", err)
+	}
+	deps, err = instance.GetDependencies(db, "api")
+	if err != nil {
+		t.Fatalf("GetDependencies: %v", err)
+	}
+	if want := []string{"cache"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("deps after clear = %v, want %v", deps, want)
+	}
+}
+
+func TestDependencyGraph_SkipsUnknownDependencies(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	for _, name := range []string{"api", "db"} {
+		if _, err := instance.AddRepo(name, RepoSpec{URL: "git@github.com:acme/" + name + ".git", Branch: "main"}); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	repoConfig := filepath.Join(instance.DeploymentDir("api"), "repo", "git", RepoConfigFile)
+	if err := os.WriteFile(repoConfig, []byte("depends_on:\n  - missing\n"), 0o644); err != nil {
+		t.Fatalf("write %s: %v", RepoConfigFile, err)
+	}
+
+	graph, err := instance.DependencyGraph(db)
+	if err != nil {
+		t.Fatalf("DependencyGraph: %v", err)
+	}
+	if deps := graph["api"]; len(deps) != 0 {
+		t.Errorf("graph[api] = %v, want no dependencies", deps)
+	}
+
+	order, err := instance.DeployOrder(db, "api")
+	if err != nil {
+		t.Fatalf("DeployOrder: %v", err)
+	}
+	if want := []string{"api"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+
+	// Nothing to wait for: returns at once instead of polling until the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := instance.WaitForDependencies(ctx, db, "api", time.Minute); err != nil {
+		t.Errorf("WaitForDependencies: %v", err)
+	}
+}
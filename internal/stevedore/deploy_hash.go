@@ -0,0 +1,149 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// deploymentHash fingerprints everything a deploy applies: the rendered
+// compose configuration, the environment (parameters), the build args, the
+// secret files and the synced commit, which covers build contexts the compose
+// file only points to.
+func deploymentHash(rendered []byte, env []string, buildArgs []string, secretFiles map[string]string, commit string) string {
+	sortedEnv := append([]string(nil), env...)
+	sort.Strings(sortedEnv)
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "commit=%s\n", commit)
+	for _, kv := range sortedEnv {
+		_, _ = fmt.Fprintf(h, "env=%q\n", kv)
+	}
+	for _, arg := range buildArgs {
+		_, _ = fmt.Fprintf(h, "build=%q\n", arg)
+	}
+	fileNames := make([]string, 0, len(secretFiles))
+	for name := range secretFiles {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+	for _, name := range fileNames {
+		_, _ = fmt.Fprintf(h, "file=%q=%q\n", name, secretFiles[name])
+	}
+	_, _ = h.Write(rendered)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// renderComposeConfig returns the compose files as `docker compose config`
+// merges them with the deployment's environment interpolated.
+func renderComposeConfig(ctx context.Context, composeFiles []string, projectName, gitDir string, env []string) ([]byte, error) {
+	cmd := newComposeCommand(ctx, append(composeFileArgs(composeFiles), "-p", projectName, "config")...)
+	cmd.Dir = gitDir
+	cmd.Env = dockerCommandEnv(env)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("docker compose config failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// currentDeploymentHash computes the hash a deploy with this configuration
+// would record.
+func (i *Instance) currentDeploymentHash(ctx context.Context, db *sql.DB, deployment, composePath, gitDir string, env []string, buildArgs []string, secretFiles map[string]string) (string, error) {
+	// A profile override changes what is deployed as much as the compose file
+	composeFiles, err := i.composeFiles(deployment, composePath)
+	if err != nil {
+		return "", err
+	}
+	rendered, err := renderComposeConfig(ctx, composeFiles, ComposeProjectName(deployment), gitDir, env)
+	if err != nil {
+		return "", err
+	}
+	status, err := i.GetSyncStatus(db, deployment)
+	if err != nil {
+		return "", err
+	}
+	return deploymentHash(rendered, env, buildArgs, secretFiles, status.LastCommit), nil
+}
+
+// deployHashes returns the hash a deploy with this configuration records and
+// the hash the last successful deploy recorded.
+func (i *Instance) deployHashes(ctx context.Context, deployment, composePath, gitDir string, env []string, buildArgs []string, secretFiles map[string]string) (current string, last string, err error) {
+	db, err := i.OpenDB()
+	if err != nil {
+		return "", "", err
+	}
+	defer func() { _ = db.Close() }()
+
+	if current, err = i.currentDeploymentHash(ctx, db, deployment, composePath, gitDir, env, buildArgs, secretFiles); err != nil {
+		return "", "", err
+	}
+	if last, err = i.GetDeployHash(db, deployment); err != nil {
+		return "", "", err
+	}
+	return current, last, nil
+}
+
+// recordDeployHash stores the hash of a successful deploy.
+func (i *Instance) recordDeployHash(deployment string, hash string) error {
+	db, err := i.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	return i.UpdateDeployHash(db, deployment, hash)
+}
+
+// containersRunning reports whether the deployment has containers and all of them run.
+func (i *Instance) containersRunning(ctx context.Context, deployment string) bool {
+	containers, err := i.listProjectContainers(ctx, ComposeProjectName(deployment))
+	if err != nil || len(containers) == 0 {
+		return false
+	}
+	for _, c := range containers {
+		if c.State != StateRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// GetDeployHash returns the hash recorded by the last successful deploy, or "".
+func (i *Instance) GetDeployHash(db *sql.DB, deployment string) (string, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return "", err
+	}
+
+	var hash sql.NullString
+	err := db.QueryRow(`SELECT last_deploy_hash FROM sync_status WHERE deployment = ?`, deployment).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return hash.String, nil
+}
+
+// UpdateDeployHash records the hash of a successful deploy.
+func (i *Instance) UpdateDeployHash(db *sql.DB, deployment string, hash string) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO sync_status (deployment, last_deploy_hash)
+		VALUES (?, ?)
+		ON CONFLICT(deployment) DO UPDATE SET
+			last_deploy_hash = excluded.last_deploy_hash
+	`, deployment, hash)
+
+	return err
+}
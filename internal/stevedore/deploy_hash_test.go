@@ -0,0 +1,60 @@
+package stevedore
+
+import "testing"
+
+func TestDeploymentHash(t *testing.T) {
+	rendered := []byte("services:\n  web:\n    image: nginx\n")
+	env := []string{"STEVEDORE_DEPLOYMENT=app", "SMTP_HOST=smtp.example.com"}
+	base := deploymentHash(rendered, env, nil, nil, "abc123")
+
+	// Parameter order does not matter
+	if got := deploymentHash(rendered, []string{env[1], env[0]}, nil, nil, "abc123"); got != base {
+		t.Error("hash should not depend on env order")
+	}
+
+	changes := map[string]string{
+		"compose":   deploymentHash([]byte("services:\n  web:\n    image: nginx:1.27\n"), env, nil, nil, "abc123"),
+		"parameter": deploymentHash(rendered, []string{env[0], "SMTP_HOST=smtp2.example.com"}, nil, nil, "abc123"),
+		"build arg": deploymentHash(rendered, env, []string{"--build-arg", "VERSION=2"}, nil, "abc123"),
+		"file":      deploymentHash(rendered, env, nil, map[string]string{"DB_PASSWORD": "s3cret"}, "abc123"),
+		"commit":    deploymentHash(rendered, env, nil, nil, "def456"),
+	}
+	for change, got := range changes {
+		if got == base {
+			t.Errorf("hash should change with the %s", change)
+		}
+	}
+}
+
+func TestDeployHash_RoundTrip(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+	if err := EnsureDeploymentRow(db, "app"); err != nil {
+		t.Fatalf("EnsureDeploymentRow: %v", err)
+	}
+
+	if hash, err := instance.GetDeployHash(db, "app"); err != nil || hash != "" {
+		t.Fatalf("GetDeployHash before deploy = %q, %v", hash, err)
+	}
+	if err := instance.UpdateSyncStatus(db, "app", "abc123"); err != nil {
+		t.Fatalf("UpdateSyncStatus: %v", err)
+	}
+	if err := instance.UpdateDeployHash(db, "app", "cafe"); err != nil {
+		t.Fatalf("UpdateDeployHash: %v", err)
+	}
+	if hash, err := instance.GetDeployHash(db, "app"); err != nil || hash != "cafe" {
+		t.Errorf("GetDeployHash = %q, %v, want cafe", hash, err)
+	}
+
+	// Recording the hash keeps the sync status
+	status, err := instance.GetSyncStatus(db, "app")
+	if err != nil || status.LastCommit != "abc123" {
+		t.Errorf("GetSyncStatus = %+v, %v", status, err)
+	}
+}
@@ -0,0 +1,142 @@
+package stevedore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DeployHistoryLimit is how many deploys are kept per deployment.
+const DeployHistoryLimit = 100
+
+// DeployRecord is one deploy of a deployment, successful or not. Deploys
+// skipped because nothing changed are not recorded.
+type DeployRecord struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Commit is the checked-out commit the deploy ran from, when known
+	Commit  string `json:"commit,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Images lists the digests the services were pinned to (ParamPinDigests)
+	Images []ImageDigest `json:"images,omitempty"`
+}
+
+// Duration returns how long the deploy took.
+func (r DeployRecord) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// recordDeploy appends a deploy to the history of a deployment and trims it to
+// DeployHistoryLimit entries. The commit is the one the last sync recorded.
+// Deploys of deployments that do not exist are not recorded.
+func (i *Instance) recordDeploy(deployment string, startedAt, finishedAt time.Time, images []ImageDigest, deployErr error) error {
+	if _, err := os.Stat(i.DeploymentDir(deployment)); err != nil {
+		return nil
+	}
+
+	db, err := i.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	return insertDeployRecord(db, deployment, startedAt, finishedAt, images, deployErr)
+}
+
+// insertDeployRecord stores a deploy and drops the oldest ones beyond
+// DeployHistoryLimit.
+func insertDeployRecord(db *sql.DB, deployment string, startedAt, finishedAt time.Time, images []ImageDigest, deployErr error) error {
+	var commit sql.NullString
+	err := db.QueryRow(`SELECT last_commit FROM sync_status WHERE deployment = ?;`, deployment).Scan(&commit)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	var errMsg sql.NullString
+	if deployErr != nil {
+		errMsg = sql.NullString{String: deployErr.Error(), Valid: true}
+	}
+	var imagesJSON sql.NullString
+	if len(images) > 0 {
+		data, err := json.Marshal(images)
+		if err != nil {
+			return err
+		}
+		imagesJSON = sql.NullString{String: string(data), Valid: true}
+	}
+
+	if _, err := db.Exec(
+		`INSERT INTO deploy_history (deployment, started_at, finished_at, commit_sha, success, error, images)
+		 VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		deployment, startedAt.UnixMilli(), finishedAt.UnixMilli(), commit, deployErr == nil, errMsg, imagesJSON,
+	); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		`DELETE FROM deploy_history
+		 WHERE deployment = ? AND id NOT IN (
+			SELECT id FROM deploy_history WHERE deployment = ? ORDER BY id DESC LIMIT ?
+		 );`,
+		deployment, deployment, DeployHistoryLimit,
+	)
+	return err
+}
+
+// DeployHistory returns up to limit recent deploys of a deployment, newest
+// first. A limit of zero or less returns the whole history.
+func (i *Instance) DeployHistory(deployment string, limit int) ([]DeployRecord, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(i.DeploymentDir(deployment)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("deployment not found: %s (run: stevedore repo add ...)", deployment)
+		}
+		return nil, err
+	}
+
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	if limit <= 0 {
+		limit = DeployHistoryLimit
+	}
+	rows, err := db.Query(
+		`SELECT started_at, finished_at, commit_sha, success, error, images FROM deploy_history
+		 WHERE deployment = ? ORDER BY id DESC LIMIT ?;`,
+		deployment, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	records := []DeployRecord{}
+	for rows.Next() {
+		var r DeployRecord
+		var startedAt, finishedAt int64
+		var commit, errMsg, images sql.NullString
+		if err := rows.Scan(&startedAt, &finishedAt, &commit, &r.Success, &errMsg, &images); err != nil {
+			return nil, err
+		}
+		if images.Valid {
+			if err := json.Unmarshal([]byte(images.String), &r.Images); err != nil {
+				return nil, fmt.Errorf("parse pinned images: %w", err)
+			}
+		}
+		r.StartedAt = time.UnixMilli(startedAt)
+		r.FinishedAt = time.UnixMilli(finishedAt)
+		r.Commit = commit.String
+		r.Error = errMsg.String
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,107 @@
+package stevedore
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeployHistory_RecordsOutcomes(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	setupDeployment(t, instance, "app")
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+	if err := EnsureDeploymentRow(db, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1_700_000_000, 0)
+	pinned := []ImageDigest{{Service: "web", Image: "nginx:latest", Digest: "nginx@sha256:abc"}}
+	if err := instance.recordDeploy("app", start, start.Add(3*time.Second), pinned, nil); err != nil {
+		t.Fatalf("recordDeploy: %v", err)
+	}
+	if err := instance.UpdateSyncStatus(db, "app", "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.recordDeploy("app", start.Add(time.Hour), start.Add(time.Hour+time.Second), nil, errors.New("compose up failed")); err != nil {
+		t.Fatalf("recordDeploy: %v", err)
+	}
+
+	records, err := instance.DeployHistory("app", 0)
+	if err != nil {
+		t.Fatalf("DeployHistory: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+
+	latest, first := records[0], records[1]
+	if latest.Success || latest.Error != "compose up failed" || latest.Commit != "abc123" {
+		t.Errorf("latest = %+v, want the failed deploy of abc123", latest)
+	}
+	if !first.Success || first.Error != "" || first.Commit != "" {
+		t.Errorf("first = %+v, want a successful deploy without a known commit", first)
+	}
+	if !reflect.DeepEqual(first.Images, pinned) || latest.Images != nil {
+		t.Errorf("images = %+v and %+v, want the pinned digests on the first deploy only", first.Images, latest.Images)
+	}
+	if first.Duration() != 3*time.Second || !first.StartedAt.Equal(start) {
+		t.Errorf("first started %v and took %v, want %v and 3s", first.StartedAt, first.Duration(), start)
+	}
+
+	if records, _ := instance.DeployHistory("app", 1); len(records) != 1 || records[0].Success {
+		t.Errorf("DeployHistory(limit 1) = %+v, want only the latest deploy", records)
+	}
+}
+
+func TestDeployHistory_KeepsLimit(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	setupDeployment(t, instance, "app")
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+	if err := EnsureDeploymentRow(db, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1_700_000_000, 0)
+	for n := 0; n < DeployHistoryLimit+5; n++ {
+		at := start.Add(time.Duration(n) * time.Minute)
+		if err := insertDeployRecord(db, "app", at, at, nil, nil); err != nil {
+			t.Fatalf("insertDeployRecord: %v", err)
+		}
+	}
+
+	records, err := instance.DeployHistory("app", 0)
+	if err != nil {
+		t.Fatalf("DeployHistory: %v", err)
+	}
+	if len(records) != DeployHistoryLimit {
+		t.Fatalf("got %d records, want %d", len(records), DeployHistoryLimit)
+	}
+	if want := start.Add(time.Duration(DeployHistoryLimit+4) * time.Minute); !records[0].StartedAt.Equal(want) {
+		t.Errorf("newest record started %v, want %v", records[0].StartedAt, want)
+	}
+}
+
+func TestDeployHistory_UnknownDeployment(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if _, err := instance.DeployHistory("missing", 0); err == nil {
+		t.Error("expected an error for a deployment that does not exist")
+	}
+	if err := instance.recordDeploy("missing", time.Now(), time.Now(), nil, nil); err != nil {
+		t.Errorf("recordDeploy for a missing deployment = %v, want it skipped", err)
+	}
+}
@@ -0,0 +1,11 @@
+package stevedore
+
+// DefaultMaxConcurrentDeploys is how many deploys the daemon runs at once
+// when STEVEDORE_MAX_CONCURRENT_DEPLOYS is not set. Syncs and checks have
+// their own, higher limit of git workers (STEVEDORE_GIT_WORKER_CONCURRENCY).
+const DefaultMaxConcurrentDeploys = 2
+
+// deploySlots limits concurrent deploys, so a poll cycle that finds many
+// updated deployments does not run all their builds at once.
+var deploySlots = newConcurrencyLimiter("STEVEDORE_MAX_CONCURRENT_DEPLOYS", DefaultMaxConcurrentDeploys,
+	"%d deploys already running, %s is queued")
@@ -0,0 +1,69 @@
+package stevedore
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// ServiceTiming is when one container of a deploy came up, relative to the
+// start of `docker compose up`.
+type ServiceTiming struct {
+	Service   string
+	Container string
+	// Started is the time until the container started
+	Started time.Duration
+	// Healthy is the time until its first passing health check, or zero when
+	// the container has no health check or is not healthy yet
+	Healthy time.Duration
+	// Unchanged is set when compose left an already running container alone
+	Unchanged bool
+}
+
+// serviceTimings inspects the project's containers after `compose up` and
+// orders them by start time. It is best-effort: failures are logged and
+// yield no timings rather than failing the deploy.
+func (i *Instance) serviceTimings(ctx context.Context, projectName string, upStarted time.Time) []ServiceTiming {
+	containers, err := i.listProjectContainers(ctx, projectName)
+	if err != nil {
+		log.Printf("Warning: cannot collect start timings for %s: %v", projectName, err)
+		return nil
+	}
+	return buildServiceTimings(upStarted, containers)
+}
+
+// buildServiceTimings turns container start and health times into timings
+// sorted by start: recreated containers first, in the order they started,
+// then the ones compose did not touch.
+func buildServiceTimings(upStarted time.Time, containers []ContainerStatus) []ServiceTiming {
+	timings := make([]ServiceTiming, 0, len(containers))
+	for _, c := range containers {
+		if c.StartedAt.IsZero() {
+			continue
+		}
+		timing := ServiceTiming{
+			Service:   c.Service,
+			Container: c.Name,
+			Unchanged: c.StartedAt.Before(upStarted),
+		}
+		if !timing.Unchanged {
+			timing.Started = c.StartedAt.Sub(upStarted)
+			if !c.healthyAt.IsZero() {
+				timing.Healthy = c.healthyAt.Sub(upStarted)
+			}
+		}
+		timings = append(timings, timing)
+	}
+
+	sort.SliceStable(timings, func(a, b int) bool {
+		if timings[a].Unchanged != timings[b].Unchanged {
+			return !timings[a].Unchanged
+		}
+		if timings[a].Started != timings[b].Started {
+			return timings[a].Started < timings[b].Started
+		}
+		return timings[a].Container < timings[b].Container
+	})
+	return timings
+}
@@ -0,0 +1,31 @@
+package stevedore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildServiceTimings(t *testing.T) {
+	up := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	containers := []ContainerStatus{
+		{Name: "app-web-1", Service: "web", StartedAt: up.Add(9 * time.Second)},
+		{Name: "app-cache-1", Service: "cache", StartedAt: up.Add(-time.Hour)},
+		{Name: "app-db-1", Service: "db", StartedAt: up.Add(time.Second), healthyAt: up.Add(8 * time.Second)},
+		{Name: "app-init-1", Service: "init"}, // never started
+	}
+
+	timings := buildServiceTimings(up, containers)
+	want := []ServiceTiming{
+		{Service: "db", Container: "app-db-1", Started: time.Second, Healthy: 8 * time.Second},
+		{Service: "web", Container: "app-web-1", Started: 9 * time.Second},
+		{Service: "cache", Container: "app-cache-1", Unchanged: true},
+	}
+	if len(timings) != len(want) {
+		t.Fatalf("got %d timings, want %d: %+v", len(timings), len(want), timings)
+	}
+	for i := range want {
+		if timings[i] != want[i] {
+			t.Errorf("timings[%d] = %+v, want %+v", i, timings[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package stevedore
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// deploymentTagRe matches a deployment tag: lowercase letters, digits, `.`,
+// `_` and `-`, starting with a letter or digit.
+var deploymentTagRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// ValidateDeploymentTag checks the name of a deployment tag.
+func ValidateDeploymentTag(tag string) error {
+	if !deploymentTagRe.MatchString(tag) {
+		return fmt.Errorf("invalid tag: %q (lowercase letters, digits, '.', '_' and '-')", tag)
+	}
+	return nil
+}
+
+// AddDeploymentTags tags a deployment, e.g. as "frontend", so bulk commands
+// (`deploy up --tag frontend`, `status --tag frontend`) can select it. Tags
+// it already has are kept.
+func (i *Instance) AddDeploymentTags(db *sql.DB, deployment string, tags []string) error {
+	if err := i.checkTagArgs(deployment, tags); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(
+			`INSERT OR IGNORE INTO deployment_tags (deployment, tag) VALUES (?, ?)`,
+			deployment, tag,
+		); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RemoveDeploymentTags removes tags from a deployment. Tags it does not have
+// are ignored.
+func (i *Instance) RemoveDeploymentTags(db *sql.DB, deployment string, tags []string) error {
+	if err := i.checkTagArgs(deployment, tags); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(`DELETE FROM deployment_tags WHERE deployment = ? AND tag = ?`, deployment, tag); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// checkTagArgs validates the deployment and tags of a tag change.
+func (i *Instance) checkTagArgs(deployment string, tags []string) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+	if _, err := os.Stat(i.DeploymentDir(deployment)); err != nil {
+		return fmt.Errorf("deployment not found: %s", deployment)
+	}
+	for _, tag := range tags {
+		if err := ValidateDeploymentTag(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDeploymentTags returns the tags of a deployment, sorted.
+func (i *Instance) GetDeploymentTags(db *sql.DB, deployment string) ([]string, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+	return queryStrings(db, `SELECT tag FROM deployment_tags WHERE deployment = ? ORDER BY tag`, deployment)
+}
+
+// DeploymentsWithTag returns the deployments carrying tag, sorted.
+func (i *Instance) DeploymentsWithTag(db *sql.DB, tag string) ([]string, error) {
+	if err := ValidateDeploymentTag(tag); err != nil {
+		return nil, err
+	}
+	return queryStrings(db, `SELECT deployment FROM deployment_tags WHERE tag = ? ORDER BY deployment`, tag)
+}
+
+// queryStrings returns the single text column of a query's rows.
+func queryStrings(db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
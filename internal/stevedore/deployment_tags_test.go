@@ -0,0 +1,50 @@
+package stevedore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeploymentTags(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	for _, name := range []string{"web", "api", "db"} {
+		if _, err := instance.AddRepo(name, RepoSpec{URL: "git@github.com:acme/" + name + ".git"}); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := instance.AddDeploymentTags(db, "web", []string{"frontend", "public"}); err != nil {
+		t.Fatalf("AddDeploymentTags: %v", err)
+	}
+	// Adding a tag twice is a no-op
+	if err := instance.AddDeploymentTags(db, "api", []string{"public", "public"}); err != nil {
+		t.Fatalf("AddDeploymentTags: %v", err)
+	}
+
+	if tags, err := instance.GetDeploymentTags(db, "web"); err != nil || !reflect.DeepEqual(tags, []string{"frontend", "public"}) {
+		t.Errorf("GetDeploymentTags(web) = %v, %v", tags, err)
+	}
+	if names, err := instance.DeploymentsWithTag(db, "public"); err != nil || !reflect.DeepEqual(names, []string{"api", "web"}) {
+		t.Errorf("DeploymentsWithTag(public) = %v, %v", names, err)
+	}
+
+	if err := instance.RemoveDeploymentTags(db, "web", []string{"public", "unknown"}); err != nil {
+		t.Fatalf("RemoveDeploymentTags: %v", err)
+	}
+	if names, err := instance.DeploymentsWithTag(db, "public"); err != nil || !reflect.DeepEqual(names, []string{"api"}) {
+		t.Errorf("DeploymentsWithTag(public) after removal = %v, %v", names, err)
+	}
+
+	if err := instance.AddDeploymentTags(db, "web", []string{"Front End"}); err == nil {
+		t.Error("expected an invalid tag to be rejected")
+	}
+	if err := instance.AddDeploymentTags(db, "missing", []string{"frontend"}); err == nil {
+		t.Error("expected tagging an unknown deployment to fail")
+	}
+}
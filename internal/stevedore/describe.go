@@ -0,0 +1,138 @@
+package stevedore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DeploymentDescription is the configuration of a deployment as reported by
+// `deploy describe`. It holds no secrets, so it can be pasted into a pull
+// request or an issue: parameters are listed by name only, and a password in
+// the repository URL is redacted. Ingress settings are shown with their
+// values, as they are routing options rather than credentials.
+type DeploymentDescription struct {
+	Deployment string `json:"deployment"`
+	URL        string `json:"url"`
+	Branch     string `json:"branch,omitempty"`
+	TagPattern string `json:"tagPattern,omitempty"`
+	Subdir     string `json:"subdir,omitempty"`
+	// Profile is the environment profile set by `repo add --profile`
+	Profile string `json:"profile,omitempty"`
+	// Depth is the number of commits sync fetches; 0 is the full history
+	Depth               int               `json:"depth"`
+	KeyType             string            `json:"keyType"`
+	PollIntervalSeconds int               `json:"pollIntervalSeconds"`
+	Schedule            string            `json:"schedule,omitempty"`
+	DesiredState        string            `json:"desiredState"`
+	Archived            bool              `json:"archived,omitempty"`
+	Tags                []string          `json:"tags"`
+	DependsOn           []string          `json:"dependsOn"`
+	Ingress             map[string]string `json:"ingress"`
+	// Parameters are the names of the deployment's own parameters, except
+	// the ingress settings; ProfileParameters and GlobalParameters are the
+	// ones it inherits from its profile and the global scope
+	Parameters        []string `json:"parameters"`
+	ProfileParameters []string `json:"profileParameters"`
+	GlobalParameters  []string `json:"globalParameters"`
+}
+
+// DescribeDeployment assembles the configuration of a deployment from its
+// repository files and the database, without secret values. Unlike a backup
+// it cannot restore anything; it is meant for review.
+func (i *Instance) DescribeDeployment(db *sql.DB, deployment string) (*DeploymentDescription, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(i.DeploymentDir(deployment)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("deployment not found: %s", deployment)
+		}
+		return nil, err
+	}
+
+	spec, err := i.readRepoSpec(deployment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository of %s: %w", deployment, err)
+	}
+	desc := &DeploymentDescription{
+		Deployment: deployment,
+		URL:        RedactSecrets(spec.URL, nil),
+		Branch:     spec.Branch,
+		TagPattern: spec.Tag,
+		Subdir:     spec.Subdir,
+		Depth:      spec.depth(),
+		Profile:    spec.Profile,
+		KeyType:    deployKeyType(i.repoKeyPath(deployment)),
+		Ingress:    map[string]string{},
+	}
+
+	config, err := i.GetRepoConfig(db, deployment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration of %s: %w", deployment, err)
+	}
+	desc.PollIntervalSeconds = config.PollIntervalSeconds
+	desc.Schedule = config.Schedule
+	desc.DesiredState = config.DesiredState
+	desc.Archived = config.Archived
+
+	if desc.Tags, err = i.GetDeploymentTags(db, deployment); err != nil {
+		return nil, err
+	}
+	if desc.DependsOn, err = i.GetDependencies(db, deployment); err != nil {
+		return nil, err
+	}
+	sort.Strings(desc.DependsOn)
+
+	names, err := listParameterNames(db, deployment)
+	if err != nil {
+		return nil, err
+	}
+	own := make(map[string]bool, len(names))
+	for _, name := range names {
+		own[name] = true
+		if !strings.HasPrefix(name, ParamIngressPrefix) {
+			desc.Parameters = append(desc.Parameters, name)
+			continue
+		}
+		var value []byte
+		if err := db.QueryRow(`SELECT value FROM parameters WHERE deployment = ? AND name = ?;`, deployment, name).Scan(&value); err != nil {
+			return nil, err
+		}
+		desc.Ingress[name] = string(value)
+	}
+
+	if spec.Profile != "" {
+		profileNames, err := listParameterNames(db, ProfileParameterScope(spec.Profile))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range profileNames {
+			if !own[name] {
+				own[name] = true
+				desc.ProfileParameters = append(desc.ProfileParameters, name)
+			}
+		}
+	}
+
+	globals, err := listParameterNames(db, GlobalParameterScope)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range globals {
+		if !own[name] {
+			desc.GlobalParameters = append(desc.GlobalParameters, name)
+		}
+	}
+
+	// Empty lists are [] in JSON, so a reader can tell "none" from "unknown"
+	for _, list := range []*[]string{&desc.Tags, &desc.DependsOn, &desc.Parameters, &desc.ProfileParameters, &desc.GlobalParameters} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	return desc, nil
+}
@@ -0,0 +1,109 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultMinFreeDiskMB is the free space required before builds and deploys
+// unless STEVEDORE_MIN_FREE_DISK_MB overrides it.
+const DefaultMinFreeDiskMB = 2048
+
+// ErrInsufficientDiskSpace is returned by EnsureDiskSpace when the host is
+// below the configured free space threshold.
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+
+// DiskSpace describes the filesystem that holds docker images and build cache.
+type DiskSpace struct {
+	// Path is the directory that was measured
+	Path       string
+	FreeBytes  uint64
+	TotalBytes uint64
+}
+
+// MinFreeDiskBytes returns the configured free space threshold.
+// STEVEDORE_MIN_FREE_DISK_MB=0 disables the preflight check.
+func MinFreeDiskBytes() uint64 {
+	mb := DefaultMinFreeDiskMB
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("STEVEDORE_MIN_FREE_DISK_MB"))); err == nil && v >= 0 {
+		mb = v
+	}
+	return uint64(mb) * 1024 * 1024
+}
+
+// CheckDiskSpace measures free space on the docker data root. The data root
+// is only visible when it is mounted into the stevedore container, so the
+// state directory is measured instead when it is not.
+func (i *Instance) CheckDiskSpace(ctx context.Context) (DiskSpace, error) {
+	var candidates []string
+	if root, err := dockerRootDir(ctx); err == nil && root != "" {
+		candidates = append(candidates, root)
+	}
+	candidates = append(candidates, i.Root)
+
+	var lastErr error
+	for _, path := range candidates {
+		free, total, err := statfsSpace(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return DiskSpace{Path: path, FreeBytes: free, TotalBytes: total}, nil
+	}
+	return DiskSpace{}, fmt.Errorf("measure disk space: %w", lastErr)
+}
+
+// EnsureDiskSpace is the preflight check run before builds. It returns an
+// error wrapping ErrInsufficientDiskSpace when free space is below
+// MinFreeDiskBytes. If space cannot be measured, the check is skipped.
+func (i *Instance) EnsureDiskSpace(ctx context.Context) error {
+	minFree := MinFreeDiskBytes()
+	if minFree == 0 {
+		return nil
+	}
+
+	space, err := i.CheckDiskSpace(ctx)
+	if err != nil {
+		log.Printf("Warning: skipping disk space preflight: %v", err)
+		return nil
+	}
+
+	if space.FreeBytes < minFree {
+		return fmt.Errorf("%w: %s free on %s, need at least %s (STEVEDORE_MIN_FREE_DISK_MB)",
+			ErrInsufficientDiskSpace, FormatBytes(space.FreeBytes), space.Path, FormatBytes(minFree))
+	}
+	return nil
+}
+
+// dockerRootDir asks the docker daemon where it stores images and layers.
+func dockerRootDir(ctx context.Context) (string, error) {
+	cmd := newDockerCommand(ctx, "info", "--format", "{{.DockerRootDir}}")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := runCommand(cmd); err != nil {
+		return "", fmt.Errorf("docker info failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// FormatBytes renders a byte count with binary units, e.g. "1.5 GiB".
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package stevedore
+
+import "syscall"
+
+// statfsSpace returns the bytes available to unprivileged users and the total
+// size of the filesystem containing path.
+func statfsSpace(path string) (free uint64, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), st.Blocks * uint64(st.Bsize), nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package stevedore
+
+import "errors"
+
+// statfsSpace is not implemented outside Linux; the preflight check is skipped.
+func statfsSpace(_ string) (uint64, uint64, error) {
+	return 0, 0, errors.New("disk space check is not supported on this platform")
+}
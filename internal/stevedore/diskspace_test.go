@@ -0,0 +1,68 @@
+package stevedore
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[uint64]string{
+		0:                      "0 B",
+		512:                    "512 B",
+		1024:                   "1.0 KiB",
+		1536:                   "1.5 KiB",
+		2 * 1024 * 1024 * 1024: "2.0 GiB",
+	}
+	for in, want := range tests {
+		if got := FormatBytes(in); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMinFreeDiskBytes(t *testing.T) {
+	t.Setenv("STEVEDORE_MIN_FREE_DISK_MB", "")
+	if got := MinFreeDiskBytes(); got != DefaultMinFreeDiskMB*1024*1024 {
+		t.Errorf("default MinFreeDiskBytes = %d", got)
+	}
+
+	t.Setenv("STEVEDORE_MIN_FREE_DISK_MB", "100")
+	if got := MinFreeDiskBytes(); got != 100*1024*1024 {
+		t.Errorf("MinFreeDiskBytes = %d, want 100 MiB", got)
+	}
+
+	t.Setenv("STEVEDORE_MIN_FREE_DISK_MB", "-5")
+	if got := MinFreeDiskBytes(); got != DefaultMinFreeDiskMB*1024*1024 {
+		t.Errorf("negative value should fall back to default, got %d", got)
+	}
+}
+
+func TestEnsureDiskSpace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("statfs is only implemented on Linux")
+	}
+	instance := NewInstance(t.TempDir())
+	ctx := context.Background()
+
+	space, err := instance.CheckDiskSpace(ctx)
+	if err != nil {
+		t.Fatalf("CheckDiskSpace: %v", err)
+	}
+	if space.TotalBytes == 0 || space.FreeBytes > space.TotalBytes {
+		t.Errorf("implausible disk space: %+v", space)
+	}
+
+	t.Setenv("STEVEDORE_MIN_FREE_DISK_MB", "0")
+	if err := instance.EnsureDiskSpace(ctx); err != nil {
+		t.Errorf("threshold 0 should disable the check: %v", err)
+	}
+
+	// No host has an exabyte free
+	t.Setenv("STEVEDORE_MIN_FREE_DISK_MB", "1099511627776")
+	err = instance.EnsureDiskSpace(ctx)
+	if !errors.Is(err, ErrInsufficientDiskSpace) {
+		t.Errorf("expected ErrInsufficientDiskSpace, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DefaultDockerBinary is the container CLI stevedore runs unless
+// STEVEDORE_DOCKER_BIN names another docker-compatible one, such as podman.
+const DefaultDockerBinary = "docker"
+
+// DockerBinary returns the container CLI every docker command runs with:
+// deploys, the git worker, health checks, logs and self-update.
+func DockerBinary() string {
+	if bin := strings.TrimSpace(os.Getenv("STEVEDORE_DOCKER_BIN")); bin != "" {
+		return bin
+	}
+	return DefaultDockerBinary
+}
+
+// newDockerCommand builds a command of the container CLI.
+func newDockerCommand(ctx context.Context, args ...string) *exec.Cmd {
+	return newCommand(ctx, DockerBinary(), args...)
+}
+
+// ContainerRuntime is the container CLI found on the host, for doctor.
+type ContainerRuntime struct {
+	// Binary is the configured CLI (DockerBinary)
+	Binary string
+	// Name is "docker" or "podman", as reported by `<binary> --version`;
+	// a podman-docker alias reports podman
+	Name string
+	// Version is the reported version, e.g. "27.1.1"
+	Version string
+}
+
+// DetectContainerRuntime runs `<binary> --version` to tell docker from podman.
+func DetectContainerRuntime(ctx context.Context) (ContainerRuntime, error) {
+	runtime := ContainerRuntime{Binary: DockerBinary()}
+	cmd := newDockerCommand(ctx, "--version")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := runCommand(cmd); err != nil {
+		return runtime, fmt.Errorf("%s --version: %w", runtime.Binary, err)
+	}
+	runtime.Name, runtime.Version = parseRuntimeVersion(stdout.String())
+	return runtime, nil
+}
+
+// parseRuntimeVersion reads "Docker version 27.1.1, build 6312585" or
+// "podman version 5.2.2".
+func parseRuntimeVersion(output string) (name, version string) {
+	fields := strings.Fields(strings.TrimSpace(output))
+	if len(fields) == 0 {
+		return "", ""
+	}
+	name = strings.ToLower(fields[0])
+	if len(fields) >= 3 && fields[1] == "version" {
+		version = strings.TrimSuffix(fields[2], ",")
+	}
+	return name, version
+}
+
+// dockerConnectionVars select the docker engine and how to reach it. Every
+// docker command stevedore runs inherits them from the daemon's environment,
+// so one stevedore talks to one engine.
+var dockerConnectionVars = []string{"DOCKER_HOST", "DOCKER_CONTEXT", "DOCKER_TLS_VERIFY", "DOCKER_CERT_PATH"}
+
+// DockerEngine describes the engine docker commands talk to: DOCKER_HOST (or
+// DOCKER_CONTEXT) when set, otherwise the local socket.
+func DockerEngine() string {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			return host + " (TLS)"
+		}
+		return host
+	}
+	if dockerContext := os.Getenv("DOCKER_CONTEXT"); dockerContext != "" {
+		return "context " + dockerContext
+	}
+	return "unix:///var/run/docker.sock (default)"
+}
+
+// IsRemoteDockerHost reports whether DOCKER_HOST points at an engine reached
+// over the network (tcp://, ssh://) rather than a local socket.
+func IsRemoteDockerHost() bool {
+	host := os.Getenv("DOCKER_HOST")
+	return host != "" && !strings.HasPrefix(host, "unix://") && !strings.HasPrefix(host, "npipe://")
+}
+
+// dockerCommandEnv is the environment for docker commands that also receive
+// deployment variables. Deployment parameters cannot override the docker
+// connection variables: compose and hooks must reach the same engine as
+// status, logs and the git worker.
+func dockerCommandEnv(env []string) []string {
+	result := os.Environ()
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if isDockerConnectionVar(name) {
+			continue
+		}
+		result = append(result, kv)
+	}
+	return result
+}
+
+func isDockerConnectionVar(name string) bool {
+	for _, v := range dockerConnectionVars {
+		if name == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package stevedore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDockerCommandEnv_KeepsDaemonEngine(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "tcp://engine:2376")
+	t.Setenv("DOCKER_TLS_VERIFY", "1")
+
+	env := dockerCommandEnv([]string{"DOCKER_HOST=tcp://other:2375", "DOCKER_TLS_VERIFY=", "APP_MODE=prod"})
+
+	if !slices.Contains(env, "DOCKER_HOST=tcp://engine:2376") || !slices.Contains(env, "DOCKER_TLS_VERIFY=1") {
+		t.Error("expected the daemon's docker connection variables to be passed through")
+	}
+	for _, kv := range []string{"DOCKER_HOST=tcp://other:2375", "DOCKER_TLS_VERIFY="} {
+		if slices.Contains(env, kv) {
+			t.Errorf("deployment variable %q must not override the docker engine", kv)
+		}
+	}
+	if !slices.Contains(env, "APP_MODE=prod") {
+		t.Error("expected deployment variables to be passed through")
+	}
+}
+
+func TestDockerEngine(t *testing.T) {
+	tests := []struct {
+		host, tls, context string
+		want               string
+		remote             bool
+	}{
+		{"", "", "", "unix:///var/run/docker.sock (default)", false},
+		{"unix:///run/user/1000/docker.sock", "", "", "unix:///run/user/1000/docker.sock", false},
+		{"tcp://engine:2376", "1", "", "tcp://engine:2376 (TLS)", true},
+		{"ssh://admin@engine", "", "", "ssh://admin@engine", true},
+		{"", "", "prod", "context prod", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("DOCKER_HOST", tt.host)
+		t.Setenv("DOCKER_TLS_VERIFY", tt.tls)
+		t.Setenv("DOCKER_CONTEXT", tt.context)
+		if got := DockerEngine(); got != tt.want {
+			t.Errorf("DockerEngine() = %q, want %q", got, tt.want)
+		}
+		if got := IsRemoteDockerHost(); got != tt.remote {
+			t.Errorf("IsRemoteDockerHost() with %q = %v, want %v", tt.host, got, tt.remote)
+		}
+	}
+}
+
+func TestDockerBinary(t *testing.T) {
+	t.Setenv("STEVEDORE_DOCKER_BIN", "")
+	if got := DockerBinary(); got != "docker" {
+		t.Errorf("DockerBinary() = %q, want docker", got)
+	}
+
+	t.Setenv("STEVEDORE_DOCKER_BIN", "/usr/bin/podman")
+	if got := newDockerCommand(context.Background(), "ps").Args; !slices.Equal(got, []string{"/usr/bin/podman", "ps"}) {
+		t.Errorf("args = %v, want podman ps", got)
+	}
+}
+
+func TestDetectContainerRuntime(t *testing.T) {
+	bin := t.TempDir()
+	for name, output := range map[string]string{
+		"docker": "Docker version 27.1.1, build 6312585",
+		"podman": "podman version 5.2.2",
+	} {
+		script := "#!/bin/sh\necho '" + output + "'\n"
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		binary string
+		want   ContainerRuntime
+	}{
+		{"", ContainerRuntime{Binary: "docker", Name: "docker", Version: "27.1.1"}},
+		{"podman", ContainerRuntime{Binary: "podman", Name: "podman", Version: "5.2.2"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("STEVEDORE_DOCKER_BIN", tt.binary)
+		runtime, err := DetectContainerRuntime(context.Background())
+		if err != nil {
+			t.Fatalf("DetectContainerRuntime(%q): %v", tt.binary, err)
+		}
+		if runtime != tt.want {
+			t.Errorf("DetectContainerRuntime(%q) = %+v, want %+v", tt.binary, runtime, tt.want)
+		}
+	}
+
+	t.Setenv("STEVEDORE_DOCKER_BIN", "nerdctl")
+	if _, err := DetectContainerRuntime(context.Background()); err == nil {
+		t.Error("expected an error for a missing binary")
+	}
+}
@@ -0,0 +1,84 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MissingLayoutDirs returns the state directories EnsureLayout would create.
+func (i *Instance) MissingLayoutDirs() []string {
+	var missing []string
+	for _, dir := range []string{i.SystemDir(), i.DeploymentsDir()} {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, dir)
+		}
+	}
+	return missing
+}
+
+// AdminKeyMissing reports whether the admin key is absent and can be created
+// without replacing anything: neither STEVEDORE_ADMIN_KEY nor
+// STEVEDORE_ADMIN_KEY_FILE is set and the default key file does not exist.
+func (i *Instance) AdminKeyMissing() bool {
+	if strings.TrimSpace(os.Getenv(AdminKeyEnvVar)) != "" || strings.TrimSpace(os.Getenv(AdminKeyFileEnvVar)) != "" {
+		return false
+	}
+	_, err := os.Stat(i.AdminKeyPath())
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// IsManagedBySystemd reports whether the installer left the systemd sentinel,
+// i.e. systemd (not docker) owns the daemon container's lifecycle.
+func (i *Instance) IsManagedBySystemd() bool {
+	_, err := os.Stat(filepath.Join(i.SystemDir(), ManagedBySystemdSentinel))
+	return err == nil
+}
+
+// DaemonContainerName returns the name of the stevedore daemon container:
+// STEVEDORE_CONTAINER_NAME from the environment or container.env, else "stevedore".
+func (i *Instance) DaemonContainerName() string {
+	if name := os.Getenv("STEVEDORE_CONTAINER_NAME"); name != "" {
+		return name
+	}
+	if env, err := i.ReadContainerEnv(); err == nil {
+		if name := env.Get("STEVEDORE_CONTAINER_NAME"); name != "" {
+			return name
+		}
+	}
+	return "stevedore"
+}
+
+// StartDaemonContainer starts the stopped daemon container and reports whether
+// it did. It only starts an existing container: it never creates, removes or
+// reconfigures one, and leaves systemd-managed containers to systemd.
+func (i *Instance) StartDaemonContainer(ctx context.Context) (bool, error) {
+	name := i.DaemonContainerName()
+
+	cmd := newDockerCommand(ctx, "inspect", "--format", "{{.State.Status}}", name)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		return false, fmt.Errorf("daemon container %s not found: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	if state := ContainerState(strings.TrimSpace(stdout.String())); state.IsRunning() {
+		return false, nil
+	}
+
+	if i.IsManagedBySystemd() {
+		return false, fmt.Errorf("daemon container %s is managed by systemd; run: sudo systemctl restart stevedore", name)
+	}
+
+	cmd = newDockerCommand(ctx, "start", name)
+	stderr.Reset()
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		return false, fmt.Errorf("docker start %s failed: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return true, nil
+}
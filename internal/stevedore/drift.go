@@ -0,0 +1,215 @@
+package stevedore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DriftKind classifies a difference between the running containers and the
+// compose file in the checkout.
+type DriftKind string
+
+const (
+	// DriftWrongImage: a container runs a different image than its service declares.
+	DriftWrongImage DriftKind = "wrong-image"
+	// DriftLabel: a label declared on the service has another value (or is missing) on the container.
+	DriftLabel DriftKind = "label"
+	// DriftMissingService: a service in the compose file has no container.
+	DriftMissingService DriftKind = "missing-service"
+	// DriftExtraContainer: a container of the project belongs to no service in the compose file.
+	DriftExtraContainer DriftKind = "extra-container"
+)
+
+// labelComposeOneOff marks containers created by `docker compose run`.
+const labelComposeOneOff = "com.docker.compose.oneoff"
+
+// Drift is a single difference between declared and running state.
+type Drift struct {
+	Kind      DriftKind `json:"kind"`
+	Service   string    `json:"service"`
+	Container string    `json:"container,omitempty"`
+	// Expected and Actual are the image reference or label value, when applicable
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// String describes the drift in one line.
+func (d Drift) String() string {
+	switch d.Kind {
+	case DriftWrongImage:
+		return fmt.Sprintf("%s: container %s runs image %s, compose file declares %s", d.Service, d.Container, d.Actual, d.Expected)
+	case DriftLabel:
+		actual := d.Actual
+		if actual == "" {
+			actual = "<unset>"
+		}
+		return fmt.Sprintf("%s: container %s has label %s, compose file declares %s", d.Service, d.Container, actual, d.Expected)
+	case DriftMissingService:
+		return fmt.Sprintf("%s: no container for service", d.Service)
+	case DriftExtraContainer:
+		service := d.Service
+		if service == "" {
+			service = "<none>"
+		}
+		return fmt.Sprintf("%s: container %s is not declared in the compose file", service, d.Container)
+	default:
+		return fmt.Sprintf("%s: %s", d.Service, d.Kind)
+	}
+}
+
+// DriftReport is the result of comparing a deployment's containers with its compose file.
+type DriftReport struct {
+	Deployment  string  `json:"deployment"`
+	ProjectName string  `json:"projectName"`
+	ComposeFile string  `json:"composeFile"`
+	Drifts      []Drift `json:"drifts"`
+}
+
+// InSync reports whether the running containers match the compose file.
+func (r *DriftReport) InSync() bool {
+	return len(r.Drifts) == 0
+}
+
+// DetectDrift compares the deployment's containers with the compose file in
+// its checkout and reports wrong images, changed labels, services without a
+// container and containers without a service. Out-of-band changes (a manual
+// `docker run`/`docker rm`, a retagged image) show up here; `Deploy` with
+// ComposeConfig.ForceRecreate converges them.
+func (i *Instance) DetectDrift(ctx context.Context, deployment string) (*DriftReport, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+
+	gitDir := i.composeDir(deployment)
+	if _, err := os.Stat(gitDir); err != nil {
+		return nil, fmt.Errorf("repository not checked out: %w", err)
+	}
+	composePath, err := FindComposeEntrypoint(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	composeFiles, err := i.composeFiles(deployment, composePath)
+	if err != nil {
+		return nil, err
+	}
+
+	projectName := ComposeProjectName(deployment)
+	// Image references and labels are interpolated with the parameters
+	redactor := i.secretRedactor(deployment)
+	services, err := resolveComposeServices(ctx, composeFiles, projectName, gitDir)
+	if err != nil {
+		return nil, redactor.error(fmt.Errorf("failed to resolve compose services: %w", err))
+	}
+	containers, err := i.listProjectContainers(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	// A service scaled to zero with `deploy scale` has no container on purpose
+	if scales, err := i.loadServiceScales(deployment); err == nil {
+		for service, replicas := range scales {
+			if replicas == 0 {
+				delete(services, service)
+			}
+		}
+	}
+
+	drifts := compareDrift(services, containers)
+	for idx := range drifts {
+		drifts[idx].Expected = redactor.text(drifts[idx].Expected)
+		drifts[idx].Actual = redactor.text(drifts[idx].Actual)
+	}
+	return &DriftReport{
+		Deployment:  deployment,
+		ProjectName: projectName,
+		ComposeFile: filepath.Base(composePath),
+		Drifts:      drifts,
+	}, nil
+}
+
+// compareDrift returns the differences between the declared services and the
+// project's containers, ordered by service. One-off `compose run` containers
+// are not part of the declared state and are ignored. Services that are only
+// built (no `image:`) are not checked for their image.
+func compareDrift(services map[string]composeConfigService, containers []ContainerStatus) []Drift {
+	var drifts []Drift
+	seen := make(map[string]bool)
+
+	for _, c := range containers {
+		if strings.EqualFold(c.labels[labelComposeOneOff], "true") {
+			continue
+		}
+		svc, ok := services[c.Service]
+		if !ok {
+			drifts = append(drifts, Drift{Kind: DriftExtraContainer, Service: c.Service, Container: c.Name})
+			continue
+		}
+		seen[c.Service] = true
+
+		if svc.Image != "" && normalizeImageRef(svc.Image) != normalizeImageRef(c.Image) {
+			drifts = append(drifts, Drift{
+				Kind:      DriftWrongImage,
+				Service:   c.Service,
+				Container: c.Name,
+				Expected:  svc.Image,
+				Actual:    c.Image,
+			})
+		}
+
+		keys := make([]string, 0, len(svc.Labels))
+		for key := range svc.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if actual, ok := c.labels[key]; !ok || actual != svc.Labels[key] {
+				drift := Drift{
+					Kind:      DriftLabel,
+					Service:   c.Service,
+					Container: c.Name,
+					Expected:  key + "=" + svc.Labels[key],
+				}
+				if ok {
+					drift.Actual = key + "=" + actual
+				}
+				drifts = append(drifts, drift)
+			}
+		}
+	}
+
+	for name := range services {
+		if !seen[name] {
+			drifts = append(drifts, Drift{Kind: DriftMissingService, Service: name})
+		}
+	}
+
+	sort.SliceStable(drifts, func(a, b int) bool {
+		return drifts[a].Service < drifts[b].Service
+	})
+	return drifts
+}
+
+// normalizeImageRef expands an image reference to its canonical form, so
+// "nginx", "nginx:latest" and "docker.io/library/nginx:latest" compare equal.
+func normalizeImageRef(ref string) string {
+	ref = strings.TrimSpace(ref)
+	ref = strings.TrimPrefix(ref, "docker.io/")
+	ref = strings.TrimPrefix(ref, "index.docker.io/")
+	ref = strings.TrimPrefix(ref, "library/")
+
+	if name, digest, ok := strings.Cut(ref, "@"); ok {
+		// A digest pins the image; a tag next to it is informational only
+		if colon := strings.LastIndex(name, ":"); colon > strings.LastIndex(name, "/") {
+			name = name[:colon]
+		}
+		return name + "@" + digest
+	}
+	if colon := strings.LastIndex(ref, ":"); colon <= strings.LastIndex(ref, "/") {
+		// No tag (a colon before the last slash is a registry port)
+		return ref + ":latest"
+	}
+	return ref
+}
@@ -0,0 +1,72 @@
+package stevedore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeImageRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"nginx", "nginx:latest"},
+		{"nginx:1.27", "nginx:1.27"},
+		{"docker.io/library/nginx:1.27", "nginx:1.27"},
+		{"ghcr.io/acme/app", "ghcr.io/acme/app:latest"},
+		{"registry.local:5000/app", "registry.local:5000/app:latest"},
+		{"registry.local:5000/app:v2", "registry.local:5000/app:v2"},
+		{"nginx:1.27@sha256:abc", "nginx@sha256:abc"},
+	}
+	for _, tt := range tests {
+		if got := normalizeImageRef(tt.ref); got != tt.want {
+			t.Errorf("normalizeImageRef(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestCompareDrift_InSync(t *testing.T) {
+	services := map[string]composeConfigService{
+		"web": {Image: "nginx", Labels: map[string]string{"stevedore.ingress.enabled": "true"}},
+		"app": {}, // build-only service: image is not compared
+	}
+	containers := []ContainerStatus{
+		{Name: "stevedore-demo-web-1", Service: "web", Image: "nginx:latest", labels: map[string]string{
+			"stevedore.ingress.enabled": "true",
+			"com.docker.compose.oneoff": "False",
+		}},
+		{Name: "stevedore-demo-app-1", Service: "app", Image: "stevedore-demo-app"},
+	}
+	if drifts := compareDrift(services, containers); len(drifts) != 0 {
+		t.Errorf("expected no drift, got %v", drifts)
+	}
+}
+
+func TestCompareDrift_ReportsDifferences(t *testing.T) {
+	services := map[string]composeConfigService{
+		"web":    {Image: "nginx:1.27", Labels: map[string]string{"tier": "front", "team": "web"}},
+		"worker": {Image: "acme/worker:2"},
+	}
+	containers := []ContainerStatus{
+		{Name: "stevedore-demo-web-1", Service: "web", Image: "nginx:1.25", labels: map[string]string{"tier": "back"}},
+		{Name: "stevedore-demo-cache-1", Service: "cache", Image: "redis"},
+		{Name: "stevedore-demo-web-run-1", Service: "web", Image: "busybox", labels: map[string]string{labelComposeOneOff: "True"}},
+	}
+
+	drifts := compareDrift(services, containers)
+	want := []Drift{
+		{Kind: DriftExtraContainer, Service: "cache", Container: "stevedore-demo-cache-1"},
+		{Kind: DriftWrongImage, Service: "web", Container: "stevedore-demo-web-1", Expected: "nginx:1.27", Actual: "nginx:1.25"},
+		{Kind: DriftLabel, Service: "web", Container: "stevedore-demo-web-1", Expected: "team=web"},
+		{Kind: DriftLabel, Service: "web", Container: "stevedore-demo-web-1", Expected: "tier=front", Actual: "tier=back"},
+		{Kind: DriftMissingService, Service: "worker"},
+	}
+	if !reflect.DeepEqual(drifts, want) {
+		t.Fatalf("compareDrift =\n%v\nwant\n%v", drifts, want)
+	}
+
+	if s := drifts[2].String(); !strings.Contains(s, "<unset>") {
+		t.Errorf("missing label should be shown as <unset>: %s", s)
+	}
+}
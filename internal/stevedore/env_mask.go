@@ -0,0 +1,39 @@
+package stevedore
+
+import (
+	"sort"
+	"strings"
+)
+
+// EnvVar is a container environment variable with its value withheld: only
+// whether it is non-empty is reported, so secrets never reach the terminal.
+type EnvVar struct {
+	Name string `json:"name"`
+	Set  bool   `json:"set"`
+}
+
+// MaskContainerEnv populates Env of every container in status from the
+// environment docker inspect reported, dropping the values. Status only
+// carries it when asked (status --env) to keep the default output short.
+func MaskContainerEnv(status *DeploymentStatus) {
+	if status == nil {
+		return
+	}
+	for idx := range status.Containers {
+		status.Containers[idx].Env = maskEnv(status.Containers[idx].env)
+	}
+}
+
+// maskEnv turns Config.Env entries ("NAME=value") into EnvVars sorted by name.
+func maskEnv(env []string) []EnvVar {
+	vars := make([]EnvVar, 0, len(env))
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		if name == "" {
+			continue
+		}
+		vars = append(vars, EnvVar{Name: name, Set: value != ""})
+	}
+	sort.Slice(vars, func(a, b int) bool { return vars[a].Name < vars[b].Name })
+	return vars
+}
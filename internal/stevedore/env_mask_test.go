@@ -0,0 +1,36 @@
+package stevedore
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMaskContainerEnv(t *testing.T) {
+	status := &DeploymentStatus{Containers: []ContainerStatus{{
+		Service: "web",
+		env:     []string{"PATH=/usr/bin", "DB_PASSWORD=hunter2", "EMPTY=", "URL=postgres://u:p@db/x?a=b"},
+	}}}
+	MaskContainerEnv(status)
+
+	want := []EnvVar{
+		{Name: "DB_PASSWORD", Set: true},
+		{Name: "EMPTY", Set: false},
+		{Name: "PATH", Set: true},
+		{Name: "URL", Set: true},
+	}
+	if got := status.Containers[0].Env; !reflect.DeepEqual(got, want) {
+		t.Errorf("Env = %+v, want %+v", got, want)
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "postgres://", "/usr/bin"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("status JSON leaks %q: %s", secret, data)
+		}
+	}
+}
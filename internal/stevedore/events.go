@@ -16,9 +16,37 @@ const (
 	// EventDeploymentRemoved is emitted when a deployment is deleted.
 	EventDeploymentRemoved EventType = "deployment.removed"
 	// EventDeploymentStatusChanged is emitted when container health/state changes.
+	// The daemon emits it when a deployment turns healthy or unhealthy, with
+	// the "healthy" detail and the "since" time of the transition.
 	EventDeploymentStatusChanged EventType = "deployment.status_changed"
+	// EventDeploymentHealthFlapping is emitted instead of further health
+	// transition alerts when a deployment keeps turning healthy and unhealthy.
+	EventDeploymentHealthFlapping EventType = "deployment.health_flapping"
 	// EventParamsChanged is emitted when parameters are set or deleted.
 	EventParamsChanged EventType = "params.changed"
+	// EventDeploymentCrashLoop is emitted when a deployment's containers keep restarting.
+	EventDeploymentCrashLoop EventType = "deployment.crash_loop"
+	// EventDeploymentUpdateAvailable is emitted once per new remote commit of
+	// a deployment the daemon does not auto-deploy.
+	EventDeploymentUpdateAvailable EventType = "deployment.update_available"
+)
+
+// Deploy lifecycle events. The daemon publishes them on its admin event bus
+// as it syncs and deploys; GET /api/events streams them. Details carry the
+// "commit" and, for failures, the "error".
+const (
+	// EventSyncStarted is emitted when an update was found and the sync begins.
+	EventSyncStarted EventType = "sync_started"
+	// EventSyncFailed is emitted when syncing the new commit fails.
+	EventSyncFailed EventType = "sync_failed"
+	// EventNewCommit is emitted when the new commit is checked out.
+	EventNewCommit EventType = "new_commit"
+	// EventDeployStarted is emitted before docker compose deploys the commit.
+	EventDeployStarted EventType = "deploy_started"
+	// EventDeploySucceeded is emitted when the deploy finished.
+	EventDeploySucceeded EventType = "deploy_succeeded"
+	// EventDeployFailed is emitted when the deploy failed or its dependencies never became healthy.
+	EventDeployFailed EventType = "deploy_failed"
 )
 
 // Event represents a change event in the system.
@@ -0,0 +1,58 @@
+package stevedore
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultKnownHosts are the git hosts whose keys the worker scans up front.
+var defaultKnownHosts = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
+// repoSSHPort returns the host and port of an `ssh://` repository URL with an
+// explicit port (`ssh://git@host:2222/owner/repo.git`). The port is zero for
+// scp-like `host:path` URLs, which cannot express one, and for other URLs.
+func repoSSHPort(repoURL string) (host string, port int, err error) {
+	repoURL = strings.TrimSpace(repoURL)
+	if !strings.HasPrefix(repoURL, "ssh://") {
+		return "", 0, nil
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid repository URL %q: %w", repoURL, err)
+	}
+	if u.Port() == "" {
+		return u.Hostname(), 0, nil
+	}
+	port, err = strconv.Atoi(u.Port())
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid SSH port %q in repository URL %q: expected 1-65535", u.Port(), repoURL)
+	}
+	return u.Hostname(), port, nil
+}
+
+// ValidateRepoURL checks the SSH port of an `ssh://` repository URL.
+func ValidateRepoURL(repoURL string) error {
+	_, _, err := repoSSHPort(repoURL)
+	return err
+}
+
+// gitSSHSetup returns the shell lines that trust the git hosts' keys and
+// configure GIT_SSH_COMMAND for repoURL, authenticating with ~/.ssh/keyFile.
+// A custom SSH port is scanned and passed to ssh, as known_hosts records keys
+// per host and port.
+func gitSSHSetup(repoURL string, keyFile string) string {
+	var b strings.Builder
+	for _, host := range defaultKnownHosts {
+		fmt.Fprintf(&b, "ssh-keyscan -t ed25519 %s >> ~/.ssh/known_hosts 2>/dev/null || true\n", host)
+	}
+
+	sshCommand := "ssh -o StrictHostKeyChecking=accept-new -i ~/.ssh/" + keyFile
+	if host, port, err := repoSSHPort(repoURL); err == nil && port != 0 && port != 22 {
+		fmt.Fprintf(&b, "ssh-keyscan -t ed25519 -p %d %s >> ~/.ssh/known_hosts 2>/dev/null || true\n", port, shellQuote(host))
+		sshCommand += fmt.Sprintf(" -p %d", port)
+	}
+	fmt.Fprintf(&b, "export GIT_SSH_COMMAND=%q", sshCommand)
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package stevedore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepoSSHPort(t *testing.T) {
+	for _, tt := range []struct {
+		url     string
+		host    string
+		port    int
+		wantErr bool
+	}{
+		{url: "ssh://git@git.example.com:2222/owner/repo.git", host: "git.example.com", port: 2222},
+		{url: "ssh://git@git.example.com/owner/repo.git", host: "git.example.com"},
+		{url: "git@github.com:owner/repo.git"},
+		{url: "https://github.com/owner/repo.git"},
+		{url: "ssh://git@git.example.com:0/owner/repo.git", wantErr: true},
+		{url: "ssh://git@git.example.com:65536/owner/repo.git", wantErr: true},
+		{url: "ssh://git@git.example.com:ssh/owner/repo.git", wantErr: true},
+	} {
+		host, port, err := repoSSHPort(tt.url)
+		if (err != nil) != tt.wantErr || host != tt.host || port != tt.port {
+			t.Errorf("repoSSHPort(%q) = %q, %d, %v", tt.url, host, port, err)
+		}
+	}
+}
+
+func TestGitSSHSetup_CustomPort(t *testing.T) {
+	script := gitSSHSetup("ssh://git@git.example.com:2222/owner/repo.git", "id_ed25519")
+	for _, want := range []string{
+		"ssh-keyscan -t ed25519 github.com",
+		"ssh-keyscan -t ed25519 -p 2222 'git.example.com'",
+		`export GIT_SSH_COMMAND="ssh -o StrictHostKeyChecking=accept-new -i ~/.ssh/id_ed25519 -p 2222"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+
+	script = gitSSHSetup("git@github.com:owner/repo.git", "id_rsa")
+	if strings.Contains(script, "-p ") {
+		t.Errorf("the default port must not be passed:\n%s", script)
+	}
+	if !strings.Contains(script, "-i ~/.ssh/id_rsa") {
+		t.Errorf("script must use the RSA key:\n%s", script)
+	}
+}
+
+func TestAddRepo_RejectsInvalidSSHPort(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "ssh://git@git.example.com:99999/owner/repo.git"}); err == nil {
+		t.Fatal("expected an invalid port to be rejected")
+	}
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "ssh://git@git.example.com:2222/owner/repo.git"}); err != nil {
+		t.Fatalf("AddRepo with a custom port: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package stevedore
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RemoteTag is a tag advertised by the remote together with the commit it points to.
+type RemoteTag struct {
+	// Name is the tag name without the refs/tags/ prefix
+	Name string
+	// Commit is the commit SHA the tag resolves to (peeled for annotated tags)
+	Commit string
+}
+
+// ValidateTagPattern checks that a tag glob is usable with path.Match.
+func ValidateTagPattern(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("tag pattern is required")
+	}
+	if strings.ContainsAny(pattern, " \t\n") {
+		return fmt.Errorf("invalid tag pattern: %q", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid tag pattern: %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// parseLsRemoteTags parses `git ls-remote --tags` output into tag → commit pairs.
+// Annotated tags are listed twice (the tag object and the peeled `^{}` commit);
+// the peeled commit wins so the result is always comparable with HEAD.
+func parseLsRemoteTags(output string) map[string]string {
+	tags := make(map[string]string)
+	peeled := make(map[string]bool)
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "refs/tags/") {
+			continue
+		}
+		sha := fields[0]
+		name := strings.TrimPrefix(fields[1], "refs/tags/")
+
+		if strings.HasSuffix(name, "^{}") {
+			name = strings.TrimSuffix(name, "^{}")
+			tags[name] = sha
+			peeled[name] = true
+			continue
+		}
+		if !peeled[name] {
+			tags[name] = sha
+		}
+	}
+
+	return tags
+}
+
+// selectHighestTag returns the highest version-sorted tag matching pattern,
+// or false when no tag matches.
+func selectHighestTag(tags map[string]string, pattern string) (RemoteTag, bool) {
+	var best RemoteTag
+	found := false
+
+	for name, commit := range tags {
+		if ok, _ := path.Match(pattern, name); !ok {
+			continue
+		}
+		if !found || compareVersionStrings(name, best.Name) > 0 {
+			best = RemoteTag{Name: name, Commit: commit}
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// tagForCommit returns the highest matching tag that points at commit, if any.
+func tagForCommit(tags map[string]string, pattern string, commit string) string {
+	matching := make(map[string]string)
+	for name, c := range tags {
+		if c == commit {
+			matching[name] = c
+		}
+	}
+	tag, _ := selectHighestTag(matching, pattern)
+	return tag.Name
+}
+
+// compareVersionStrings compares two strings the way `sort -V` does: runs of
+// digits are compared numerically, everything else byte-wise. Returns -1, 0 or 1.
+func compareVersionStrings(a, b string) int {
+	for a != "" && b != "" {
+		aDigits := isDigit(a[0])
+		bDigits := isDigit(b[0])
+
+		if aDigits != bDigits {
+			if aDigits {
+				return -1
+			}
+			return 1
+		}
+
+		aChunk, aRest := splitVersionChunk(a, aDigits)
+		bChunk, bRest := splitVersionChunk(b, bDigits)
+
+		if aDigits {
+			aNum := strings.TrimLeft(aChunk, "0")
+			bNum := strings.TrimLeft(bChunk, "0")
+			if len(aNum) != len(bNum) {
+				if len(aNum) < len(bNum) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(aNum, bNum); c != 0 {
+				return c
+			}
+		} else if c := strings.Compare(aChunk, bChunk); c != 0 {
+			return c
+		}
+
+		a, b = aRest, bRest
+	}
+
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+func splitVersionChunk(s string, digits bool) (string, string) {
+	n := 0
+	for n < len(s) && isDigit(s[n]) == digits {
+		n++
+	}
+	return s[:n], s[n:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// shellQuote wraps s in single quotes for safe interpolation into worker scripts.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
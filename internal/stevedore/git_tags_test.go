@@ -0,0 +1,215 @@
+package stevedore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLsRemoteTags_PrefersPeeledCommit(t *testing.T) {
+	output := `1111111111111111111111111111111111111111	refs/tags/v1.0.0
+2222222222222222222222222222222222222222	refs/tags/v1.1.0
+3333333333333333333333333333333333333333	refs/tags/v1.1.0^{}
+4444444444444444444444444444444444444444	refs/heads/main
+STEVEDORE_CURRENT=5555555555555555555555555555555555555555
+`
+	tags := parseLsRemoteTags(output)
+
+	if len(tags) != 2 {
+		t.Fatalf("expected 2 tags, got %d: %v", len(tags), tags)
+	}
+	if tags["v1.0.0"] != "1111111111111111111111111111111111111111" {
+		t.Errorf("lightweight tag commit = %q", tags["v1.0.0"])
+	}
+	if tags["v1.1.0"] != "3333333333333333333333333333333333333333" {
+		t.Errorf("annotated tag should resolve to peeled commit, got %q", tags["v1.1.0"])
+	}
+}
+
+func TestParseLsRemoteTags_PeeledBeforeTagObject(t *testing.T) {
+	output := `3333333333333333333333333333333333333333	refs/tags/v2^{}
+2222222222222222222222222222222222222222	refs/tags/v2
+`
+	tags := parseLsRemoteTags(output)
+	if tags["v2"] != "3333333333333333333333333333333333333333" {
+		t.Errorf("peeled commit must win regardless of order, got %q", tags["v2"])
+	}
+}
+
+func TestSelectHighestTag(t *testing.T) {
+	tags := map[string]string{
+		"v1.2.0":       "a",
+		"v1.10.0":      "b",
+		"v1.9.3":       "c",
+		"release-2.0":  "d",
+		"v2.0.0-rc1":   "e",
+		"nightly-2024": "f",
+	}
+
+	got, ok := selectHighestTag(tags, "v1.*")
+	if !ok {
+		t.Fatal("expected a match for v1.*")
+	}
+	if got.Name != "v1.10.0" || got.Commit != "b" {
+		t.Errorf("selectHighestTag(v1.*) = %+v, want v1.10.0/b", got)
+	}
+
+	got, ok = selectHighestTag(tags, "release-*")
+	if !ok || got.Name != "release-2.0" {
+		t.Errorf("selectHighestTag(release-*) = %+v, %v", got, ok)
+	}
+
+	if _, ok := selectHighestTag(tags, "does-not-match-*"); ok {
+		t.Error("expected no match")
+	}
+}
+
+func TestTagForCommit(t *testing.T) {
+	tags := map[string]string{
+		"v1.0.0": "aaa",
+		"v1.0.1": "aaa",
+		"v1.1.0": "bbb",
+		"other":  "aaa",
+	}
+	if got := tagForCommit(tags, "v*", "aaa"); got != "v1.0.1" {
+		t.Errorf("tagForCommit = %q, want v1.0.1", got)
+	}
+	if got := tagForCommit(tags, "v*", "ccc"); got != "" {
+		t.Errorf("tagForCommit for unknown commit = %q, want empty", got)
+	}
+}
+
+func TestCompareVersionStrings(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "v1.2.4", -1},
+		{"v1.10.0", "v1.9.0", 1},
+		{"v2", "v10", -1},
+		{"v1.0.0", "v1.0.0-rc1", -1},
+		{"v01", "v1", 0},
+		{"a", "b", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_vs_"+tt.b, func(t *testing.T) {
+			if got := compareVersionStrings(tt.a, tt.b); got != tt.want {
+				t.Errorf("compareVersionStrings(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTagPattern(t *testing.T) {
+	for _, valid := range []string{"v*", "release-*", "v[0-9]*", "1.0.0"} {
+		if err := ValidateTagPattern(valid); err != nil {
+			t.Errorf("ValidateTagPattern(%q) unexpected error: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"", "  ", "v[", "v 1"} {
+		if err := ValidateTagPattern(invalid); err == nil {
+			t.Errorf("ValidateTagPattern(%q) expected error", invalid)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote("v1.0"); got != "'v1.0'" {
+		t.Errorf("shellQuote = %q", got)
+	}
+	if got := shellQuote("it's"); got != `'it'"'"'s'` {
+		t.Errorf("shellQuote with quote = %q", got)
+	}
+}
+
+func TestPrepareGitRepo_ReadsTagPattern(t *testing.T) {
+	root := t.TempDir()
+	instance := NewInstance(root)
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatal(err)
+	}
+
+	deployment := "test-tags"
+	setupGitRepoDir(t, root, deployment)
+
+	setup, err := instance.prepareGitRepo(deployment)
+	if err != nil {
+		t.Fatalf("prepareGitRepo: %v", err)
+	}
+	if setup.tagPattern != "" {
+		t.Errorf("expected no tag pattern without tag.txt, got %q", setup.tagPattern)
+	}
+
+	tagFile := filepath.Join(root, "deployments", deployment, "repo", "tag.txt")
+	if err := os.WriteFile(tagFile, []byte("v*\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	setup, err = instance.prepareGitRepo(deployment)
+	if err != nil {
+		t.Fatalf("prepareGitRepo: %v", err)
+	}
+	if setup.tagPattern != "v*" {
+		t.Errorf("tagPattern = %q, want v*", setup.tagPattern)
+	}
+}
+
+func TestAddRepo_StoresTagPattern(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if _, err := instance.AddRepo("tagged", RepoSpec{URL: "git@github.com:acme/app.git", Tag: "v*"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	config, err := instance.GetRepoConfig(db, "tagged")
+	if err != nil {
+		t.Fatalf("GetRepoConfig: %v", err)
+	}
+	if config.TagPattern != "v*" {
+		t.Errorf("TagPattern = %q, want v*", config.TagPattern)
+	}
+
+	if _, err := instance.AddRepo("bad-tag", RepoSpec{URL: "git@github.com:acme/app.git", Tag: "v["}); err == nil {
+		t.Error("expected error for invalid tag pattern")
+	}
+}
+
+func TestUpdateSyncTag_RecordsTag(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := EnsureDeploymentRow(db, "tagged"); err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.UpdateSyncStatus(db, "tagged", "abc123"); err != nil {
+		t.Fatalf("UpdateSyncStatus: %v", err)
+	}
+	if err := instance.UpdateSyncTag(db, "tagged", "v1.2.3"); err != nil {
+		t.Fatalf("UpdateSyncTag: %v", err)
+	}
+
+	status, err := instance.GetSyncStatus(db, "tagged")
+	if err != nil {
+		t.Fatalf("GetSyncStatus: %v", err)
+	}
+	if status.LastTag != "v1.2.3" {
+		t.Errorf("LastTag = %q, want v1.2.3", status.LastTag)
+	}
+	if status.LastCommit != "abc123" {
+		t.Errorf("LastCommit = %q, want abc123", status.LastCommit)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -29,14 +30,89 @@ func DefaultGitWorkerConfig() GitWorkerConfig {
 	}
 }
 
+// ParamGitWorkerImage is a deployment (or global) parameter that overrides the
+// git worker image, e.g. for a mirror of alpine/git in an air-gapped registry.
+const ParamGitWorkerImage = "STEVEDORE_GIT_IMAGE"
+
+// DefaultGitWorkerConcurrency is how many git worker containers may run at
+// once when STEVEDORE_GIT_WORKER_CONCURRENCY is not set.
+const DefaultGitWorkerConcurrency = 4
+
+// gitWorkers limits concurrent git worker containers, so a poll cycle over
+// many deployments does not start dozens of containers at once.
+var gitWorkers = newConcurrencyLimiter("STEVEDORE_GIT_WORKER_CONCURRENCY", DefaultGitWorkerConcurrency,
+	"All %d git workers busy, %s waits for a free one")
+
+// GitWorkerImage returns the image git operations of a deployment run in:
+// the STEVEDORE_GIT_IMAGE parameter, or the default worker image.
+func (i *Instance) GitWorkerImage(deployment string) string {
+	if value, err := i.GetParameter(deployment, ParamGitWorkerImage); err == nil && strings.TrimSpace(string(value)) != "" {
+		return strings.TrimSpace(string(value))
+	}
+	return DefaultGitWorkerConfig().Image
+}
+
 // GitCloneResult holds the result of a git clone operation.
 type GitCloneResult struct {
 	// Commit SHA of the cloned repository
 	Commit string
 	// Branch that was checked out
 	Branch string
+	// Tag is the tag that was checked out (tag-tracking mode only)
+	Tag string
 	// RemovedFiles lists files that were removed during a clean sync
 	RemovedFiles []string
+	// Image is the git worker image the sync ran in
+	Image string
+	// CommitInfo describes the checked-out commit
+	CommitInfo CommitInfo
+}
+
+// CommitInfo is the author, date and subject of a commit.
+type CommitInfo struct {
+	Author  string
+	Date    time.Time
+	Subject string
+}
+
+// gitHeadScript prints the checked-out commit and its metadata for
+// parseGitHead, one STEVEDORE_* line each.
+const gitHeadScript = `echo "STEVEDORE_COMMIT=$(git rev-parse HEAD)"
+git log -1 --format='STEVEDORE_COMMIT_AUTHOR=%an%nSTEVEDORE_COMMIT_DATE=%ct%nSTEVEDORE_COMMIT_SUBJECT=%s'
+`
+
+// parseGitHead reads the output of gitHeadScript.
+func parseGitHead(output string) (string, CommitInfo) {
+	var commit string
+	var info CommitInfo
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "STEVEDORE_COMMIT":
+			commit = value
+		case "STEVEDORE_COMMIT_AUTHOR":
+			info.Author = value
+		case "STEVEDORE_COMMIT_DATE":
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				info.Date = time.Unix(seconds, 0)
+			}
+		case "STEVEDORE_COMMIT_SUBJECT":
+			info.Subject = value
+		}
+	}
+	return commit, info
+}
+
+// Ref returns the tracked ref for display: the tag in tag-tracking mode, otherwise the branch.
+func (r *GitCloneResult) Ref() string {
+	if r.Tag != "" {
+		return r.Tag
+	}
+	return r.Branch
 }
 
 // GitCheckResult holds the result of a git check operation.
@@ -48,8 +124,38 @@ type GitCheckResult struct {
 	RemoteCommit string
 	// HasChanges is true if the remote has new commits
 	HasChanges bool
-	// Branch is the branch being tracked
+	// Branch is the branch being tracked (empty in tag-tracking mode)
 	Branch string
+	// TagPattern is the tag glob being tracked (empty in branch mode)
+	TagPattern string
+	// CurrentTag is the matching tag that points at CurrentCommit, if any
+	CurrentTag string
+	// RemoteTag is the highest remote tag matching TagPattern
+	RemoteTag string
+	// CommitsBehind is the number of remote commits the checkout lacks and
+	// CommitsAhead the number of checked-out commits the remote branch lacks
+	// (after a force push). Both stay zero when unknown: in tag-tracking mode
+	// or when the histories share no commit within checkHistoryDepth.
+	CommitsBehind int
+	CommitsAhead  int
+	// PendingCommits lists the incoming commits as "<sha> <subject>", newest
+	// first, at most maxPendingCommits of them
+	PendingCommits []string
+}
+
+// checkHistoryDepth bounds how much history a check fetches to count the
+// commits between the checkout and the remote branch.
+const checkHistoryDepth = 100
+
+// maxPendingCommits bounds GitCheckResult.PendingCommits.
+const maxPendingCommits = 20
+
+// Ref returns the tracked ref for display: the tag pattern in tag-tracking mode, otherwise the branch.
+func (r *GitCheckResult) Ref() string {
+	if r.TagPattern != "" {
+		return r.TagPattern
+	}
+	return r.Branch
 }
 
 // gitRepoSetup holds the resolved paths and metadata for a git operation.
@@ -61,6 +167,10 @@ type gitRepoSetup struct {
 	privateKeyPath string
 	repoURL        string
 	branch         string
+	tagPattern     string // non-empty when tracking tags instead of a branch
+	subdir         string // non-empty for a sparse checkout of one directory
+	depth          int    // commits to fetch; 0 fetches the full history
+	cacheDir       string // shared clone cache, mounted at /cache (see repo_cache.go)
 	isClone        bool
 }
 
@@ -88,8 +198,30 @@ func (i *Instance) prepareGitRepo(deployment string) (*gitRepoSetup, error) {
 	}
 	branch := strings.TrimSpace(string(branchBytes))
 
+	// Tag tracking is optional: tag.txt only exists for `repo add --tag`
+	var tagPattern string
+	if tagBytes, err := os.ReadFile(filepath.Join(repoDir, "tag.txt")); err == nil {
+		tagPattern = strings.TrimSpace(string(tagBytes))
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read tag pattern: %w", err)
+	}
+
+	spec, err := i.readRepoSpec(deployment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository settings: %w", err)
+	}
+	subdir := spec.Subdir
+
+	var cacheDir string
+	if usesRepoCache(spec) {
+		cacheDir = i.repoCacheDir(repoURL, branch)
+		if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create clone cache: %w", err)
+		}
+	}
+
 	// Check if SSH key exists
-	privateKeyPath := filepath.Join(sshDir, "id_ed25519")
+	privateKeyPath := i.repoKeyPath(deployment)
 	if _, err := os.Stat(privateKeyPath); err != nil {
 		return nil, fmt.Errorf("SSH key not found: %w", err)
 	}
@@ -113,10 +245,41 @@ func (i *Instance) prepareGitRepo(deployment string) (*gitRepoSetup, error) {
 		privateKeyPath: privateKeyPath,
 		repoURL:        repoURL,
 		branch:         branch,
+		tagPattern:     tagPattern,
+		subdir:         subdir,
+		depth:          spec.depth(),
+		cacheDir:       cacheDir,
 		isClone:        isClone,
 	}, nil
 }
 
+// remote returns what the checkout fetches from: the shared clone cache, or
+// the repository's origin.
+func (s *gitRepoSetup) remote() string {
+	if s.cacheDir != "" {
+		return repoCacheRemote
+	}
+	return "origin"
+}
+
+// cloneDepthArg returns the `git clone` option that limits the checkout to
+// the configured depth; empty for the full history.
+func (s *gitRepoSetup) cloneDepthArg() string {
+	if s.depth == 0 {
+		return ""
+	}
+	return fmt.Sprintf("--depth %d", s.depth)
+}
+
+// fetchDepthArg returns the `git fetch` option for the configured depth. For
+// the full history it completes a checkout that is still shallow.
+func (s *gitRepoSetup) fetchDepthArg() string {
+	if s.depth == 0 {
+		return "$([ -f .git/shallow ] && echo --unshallow)"
+	}
+	return fmt.Sprintf("--depth %d", s.depth)
+}
+
 // hostPath translates a container-local path to a host path for docker volume mounts.
 // When stevedore runs inside a container, its Root (e.g. /opt/stevedore) may differ
 // from the host path (set via STEVEDORE_HOST_ROOT). Child containers need host paths.
@@ -143,18 +306,15 @@ func (i *Instance) runGitScript(ctx context.Context, deployment string, script s
 
 	fullScript := fmt.Sprintf(`set -e
 mkdir -p ~/.ssh
-cp /ssh-keys/id_ed25519 ~/.ssh/id_ed25519
-chmod 600 ~/.ssh/id_ed25519
-ssh-keyscan -t ed25519 github.com >> ~/.ssh/known_hosts 2>/dev/null || true
-ssh-keyscan -t ed25519 gitlab.com >> ~/.ssh/known_hosts 2>/dev/null || true
-ssh-keyscan -t ed25519 bitbucket.org >> ~/.ssh/known_hosts 2>/dev/null || true
-export GIT_SSH_COMMAND="ssh -o StrictHostKeyChecking=accept-new -i ~/.ssh/id_ed25519"
+cp /ssh-keys/%[1]s ~/.ssh/%[1]s
+chmod 600 ~/.ssh/%[1]s
+%[2]s
 git config --global --add safe.directory /repo
 cd /repo
-%s
-`, script)
+%[3]s
+`, filepath.Base(setup.privateKeyPath), gitSSHSetup(setup.repoURL, filepath.Base(setup.privateKeyPath)), script)
 
-	image := DefaultGitWorkerConfig().Image
+	image := i.GitWorkerImage(deployment)
 	containerName := fmt.Sprintf("stevedore-git-%s-%d", deployment, time.Now().UnixNano())
 
 	args := []string{
@@ -167,11 +327,19 @@ cd /repo
 		"--label", "com.stevedore.role=git-worker",
 		"-v", i.hostPath(setup.sshDir) + ":/ssh-keys:ro",
 		"-v", i.hostPath(setup.gitDir) + ":/repo",
-		image,
-		"-c", fullScript,
 	}
+	if setup.cacheDir != "" {
+		args = append(args, "-v", i.hostPath(setup.cacheDir)+":"+repoCacheMount)
+	}
+	args = append(args, image, "-c", fullScript)
+
+	release, err := gitWorkers.acquire(ctx, deployment)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 
-	cmd := newCommand(ctx, "docker", args...)
+	cmd := newDockerCommand(ctx, args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -194,46 +362,134 @@ func (i *Instance) GitCheckRemote(ctx context.Context, deployment string) (*GitC
 
 	// If repo doesn't exist yet, there's no current commit
 	if setup.isClone {
-		return &GitCheckResult{
+		result := &GitCheckResult{
 			CurrentCommit: "",
 			RemoteCommit:  "",
 			HasChanges:    true,
 			Branch:        setup.branch,
-		}, nil
+		}
+		if setup.tagPattern != "" {
+			result.Branch = ""
+			result.TagPattern = setup.tagPattern
+		}
+		return result, nil
+	}
+
+	if setup.tagPattern != "" {
+		return i.gitCheckRemoteTag(ctx, deployment, setup)
 	}
 
+	// Checkouts are usually shallow: when the remote moved, fetch enough
+	// history to find the merge base before counting and listing the
+	// incoming commits. Full-history checkouts already have it.
+	deepen := fmt.Sprintf("git fetch --depth %d %s %s >/dev/null 2>&1 || true", checkHistoryDepth, setup.remote(), setup.branch)
+	if setup.depth == 0 || setup.depth >= checkHistoryDepth {
+		deepen = ":"
+	}
 	script := fmt.Sprintf(`
 CURRENT=$(git rev-parse HEAD)
-git fetch --depth 1 origin %s
+git fetch %[5]s %[4]s %[1]s
 REMOTE=$(git rev-parse FETCH_HEAD)
 echo "STEVEDORE_CURRENT=$CURRENT"
 echo "STEVEDORE_REMOTE=$REMOTE"
-`, setup.branch)
+if [ "$CURRENT" != "$REMOTE" ]; then
+  %[2]s
+  if git merge-base "$CURRENT" "$REMOTE" >/dev/null 2>&1; then
+    echo "STEVEDORE_COUNTS=$(git rev-list --left-right --count "$CURRENT...$REMOTE")"
+    git log --format='STEVEDORE_PENDING=%%h %%s' -n %[3]d "$CURRENT..$REMOTE"
+  fi
+fi
+`, setup.branch, deepen, maxPendingCommits, setup.remote(), setup.fetchDepthArg())
+	if setup.cacheDir != "" {
+		script = repoCacheScript(setup.repoURL, setup.branch, checkHistoryDepth) + script
+	}
 
 	output, err := i.runGitScript(ctx, deployment, script)
 	if err != nil {
 		return nil, fmt.Errorf("git check remote failed: %w", err)
 	}
 
-	var currentCommit, remoteCommit string
+	result := parseGitCheckOutput(output)
+	result.Branch = setup.branch
+	return result, nil
+}
+
+// parseGitCheckOutput parses the STEVEDORE_* lines printed by the branch
+// check script.
+func parseGitCheckOutput(output string) *GitCheckResult {
+	result := &GitCheckResult{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "STEVEDORE_CURRENT="):
+			result.CurrentCommit = strings.TrimPrefix(line, "STEVEDORE_CURRENT=")
+		case strings.HasPrefix(line, "STEVEDORE_REMOTE="):
+			result.RemoteCommit = strings.TrimPrefix(line, "STEVEDORE_REMOTE=")
+		case strings.HasPrefix(line, "STEVEDORE_COUNTS="):
+			// `rev-list --left-right --count CURRENT...REMOTE` prints "<ahead>\t<behind>"
+			counts := strings.Fields(strings.TrimPrefix(line, "STEVEDORE_COUNTS="))
+			if len(counts) == 2 {
+				result.CommitsAhead, _ = strconv.Atoi(counts[0])
+				result.CommitsBehind, _ = strconv.Atoi(counts[1])
+			}
+		case strings.HasPrefix(line, "STEVEDORE_PENDING="):
+			result.PendingCommits = append(result.PendingCommits, strings.TrimPrefix(line, "STEVEDORE_PENDING="))
+		}
+	}
+	result.HasChanges = result.CurrentCommit != result.RemoteCommit
+	return result
+}
+
+// gitCheckRemoteTag compares HEAD with the highest remote tag matching the tracked pattern.
+func (i *Instance) gitCheckRemoteTag(ctx context.Context, deployment string, setup *gitRepoSetup) (*GitCheckResult, error) {
+	script := `
+echo "STEVEDORE_CURRENT=$(git rev-parse HEAD)"
+git ls-remote --tags origin
+`
+
+	output, err := i.runGitScript(ctx, deployment, script)
+	if err != nil {
+		return nil, fmt.Errorf("git check remote failed: %w", err)
+	}
+
+	var currentCommit string
 	for _, line := range strings.Split(output, "\n") {
 		line = strings.TrimSpace(line)
 		if strings.HasPrefix(line, "STEVEDORE_CURRENT=") {
 			currentCommit = strings.TrimPrefix(line, "STEVEDORE_CURRENT=")
 		}
-		if strings.HasPrefix(line, "STEVEDORE_REMOTE=") {
-			remoteCommit = strings.TrimPrefix(line, "STEVEDORE_REMOTE=")
-		}
+	}
+
+	tags := parseLsRemoteTags(output)
+	remoteTag, ok := selectHighestTag(tags, setup.tagPattern)
+	if !ok {
+		return nil, fmt.Errorf("no remote tags match %q", setup.tagPattern)
 	}
 
 	return &GitCheckResult{
 		CurrentCommit: currentCommit,
-		RemoteCommit:  remoteCommit,
-		HasChanges:    currentCommit != remoteCommit,
-		Branch:        setup.branch,
+		RemoteCommit:  remoteTag.Commit,
+		HasChanges:    currentCommit != remoteTag.Commit,
+		TagPattern:    setup.tagPattern,
+		CurrentTag:    tagForCommit(tags, setup.tagPattern, currentCommit),
+		RemoteTag:     remoteTag.Name,
 	}, nil
 }
 
+// resolveRemoteTag lists the remote tags and returns the highest one matching the tracked pattern.
+func (i *Instance) resolveRemoteTag(ctx context.Context, deployment string, setup *gitRepoSetup) (RemoteTag, error) {
+	output, err := i.runGitScript(ctx, deployment, "git ls-remote --tags "+shellQuote(setup.repoURL))
+	if err != nil {
+		return RemoteTag{}, fmt.Errorf("git ls-remote failed: %w", err)
+	}
+
+	remoteTag, ok := selectHighestTag(parseLsRemoteTags(output), setup.tagPattern)
+	if !ok {
+		return RemoteTag{}, fmt.Errorf("no remote tags match %q", setup.tagPattern)
+	}
+	return remoteTag, nil
+}
+
 // GitSyncClean performs a git clone or fetch+reset in a worker container,
 // and removes stale/untracked files. All git and ssh processes are isolated
 // inside the container and cleaned up when it exits.
@@ -243,30 +499,64 @@ func (i *Instance) GitSyncClean(ctx context.Context, deployment string, cleanEna
 		return nil, err
 	}
 
+	// In tag-tracking mode the highest matching tag replaces the branch as the ref to check out
+	cloneRef := setup.branch
+	fetchRef := setup.branch
+	var tag string
+	if setup.tagPattern != "" {
+		remoteTag, err := i.resolveRemoteTag(ctx, deployment, setup)
+		if err != nil {
+			return nil, fmt.Errorf("git sync failed: %w", err)
+		}
+		tag = remoteTag.Name
+		cloneRef = shellQuote(tag)
+		fetchRef = shellQuote("refs/tags/" + tag)
+		log.Printf("Resolved tag for %s: %s (pattern %s)", deployment, tag, setup.tagPattern)
+	}
+
+	cloneURL := setup.repoURL
+	if setup.cacheDir != "" {
+		cloneURL = repoCacheRemote
+	}
+
 	var script string
-	if setup.isClone {
+	if setup.isClone && setup.subdir != "" {
+		// Only the subdirectory (and files at the root) is checked out; the
+		// blob filter keeps the rest of a large repository from being downloaded
 		script = fmt.Sprintf(`
-git clone --branch %s --depth 1 --single-branch %s .
-echo "STEVEDORE_COMMIT=$(git rev-parse HEAD)"
-`, setup.branch, setup.repoURL)
+git clone --branch %s %s --single-branch --filter=blob:none --no-checkout %s .
+git sparse-checkout set -- %s
+git checkout
+`, cloneRef, setup.cloneDepthArg(), cloneURL, shellQuote(setup.subdir))
+	} else if setup.isClone {
+		script = fmt.Sprintf(`
+git clone --branch %s %s --single-branch %s .
+`, cloneRef, setup.cloneDepthArg(), setup.repoURL)
 	} else if cleanEnabled {
 		script = fmt.Sprintf(`
-git fetch --depth 1 origin %s
+git fetch %s %s %s
 git reset --hard FETCH_HEAD
-CLEAN_OUTPUT=$(git clean -fd 2>/dev/null || true)
-if [ -n "$CLEAN_OUTPUT" ]; then
-  echo "$CLEAN_OUTPUT" | while IFS= read -r line; do
-    echo "STEVEDORE_CLEAN=$line"
-  done
-fi
-echo "STEVEDORE_COMMIT=$(git rev-parse HEAD)"
-`, setup.branch)
+%s
+`, setup.fetchDepthArg(), setup.remote(), fetchRef, gitCleanScript("-fd"))
 	} else {
 		script = fmt.Sprintf(`
-git fetch --depth 1 origin %s
+git fetch %s %s %s
 git reset --hard FETCH_HEAD
-echo "STEVEDORE_COMMIT=$(git rev-parse HEAD)"
-`, setup.branch)
+`, setup.fetchDepthArg(), setup.remote(), fetchRef)
+	}
+	script += gitHeadScript
+
+	if setup.subdir != "" {
+		// Re-applying the sparse pattern keeps existing checkouts on the
+		// subdirectory; a missing subdirectory fails the sync, not the deploy
+		quoted := shellQuote(setup.subdir)
+		if !setup.isClone {
+			script = "git sparse-checkout set -- " + quoted + "\n" + script
+		}
+		script += fmt.Sprintf("[ -d %s ] || { echo 'subdirectory not found in the repository:' %s >&2; exit 1; }\n", quoted, quoted)
+	}
+	if setup.cacheDir != "" {
+		script = repoCacheScript(setup.repoURL, setup.branch, 1) + script
 	}
 
 	output, err := i.runGitScript(ctx, deployment, script)
@@ -274,30 +564,76 @@ echo "STEVEDORE_COMMIT=$(git rev-parse HEAD)"
 		return nil, fmt.Errorf("git sync failed: %w", err)
 	}
 
-	var commit string
-	var removedFiles []string
-	for _, line := range strings.Split(output, "\n") {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "STEVEDORE_COMMIT=") {
-			commit = strings.TrimPrefix(line, "STEVEDORE_COMMIT=")
-		}
-		if strings.HasPrefix(line, "STEVEDORE_CLEAN=") {
-			cleaned := strings.TrimPrefix(line, "STEVEDORE_CLEAN=")
-			if strings.HasPrefix(cleaned, "Removing ") {
-				f := strings.TrimPrefix(cleaned, "Removing ")
-				removedFiles = append(removedFiles, f)
-				log.Printf("Removed untracked: %s", f)
-			}
-		}
+	commit, info := parseGitHead(output)
+	removedFiles := parseCleanedFiles(output, "Removing ")
+	for _, f := range removedFiles {
+		log.Printf("Removed untracked: %s", f)
 	}
 
 	if commit == "" {
 		return nil, fmt.Errorf("git sync did not return commit SHA")
 	}
 
-	return &GitCloneResult{
+	if err := i.removeRepoKeyBackup(deployment); err != nil {
+		log.Printf("warning: failed to remove previous deploy key of %s: %v", deployment, err)
+	}
+
+	result := &GitCloneResult{
 		Commit:       commit,
 		Branch:       setup.branch,
+		Tag:          tag,
 		RemovedFiles: removedFiles,
-	}, nil
+		Image:        i.GitWorkerImage(deployment),
+		CommitInfo:   info,
+	}
+	if tag != "" {
+		result.Branch = ""
+	}
+	return result, nil
+}
+
+// GitCleanDryRun lists the untracked files and directories of a deployment's
+// checkout that a clean sync would remove, without fetching or deleting
+// anything (`deploy sync --dry-run-clean`).
+func (i *Instance) GitCleanDryRun(ctx context.Context, deployment string) ([]string, error) {
+	setup, err := i.prepareGitRepo(deployment)
+	if err != nil {
+		return nil, err
+	}
+	if setup.isClone {
+		return nil, fmt.Errorf("deployment %s has no checkout yet; run: stevedore deploy sync %s", deployment, deployment)
+	}
+
+	output, err := i.runGitScript(ctx, deployment, gitCleanScript("-nd"))
+	if err != nil {
+		return nil, fmt.Errorf("git clean dry run failed: %w", err)
+	}
+	return parseCleanedFiles(output, "Would remove "), nil
+}
+
+// gitCleanScript runs `git clean` with flags and echoes each line of its
+// output as STEVEDORE_CLEAN=<line>.
+func gitCleanScript(flags string) string {
+	return fmt.Sprintf(`CLEAN_OUTPUT=$(git clean %s 2>/dev/null || true)
+if [ -n "$CLEAN_OUTPUT" ]; then
+  echo "$CLEAN_OUTPUT" | while IFS= read -r line; do
+    echo "STEVEDORE_CLEAN=$line"
+  done
+fi`, flags)
+}
+
+// parseCleanedFiles returns the paths of the STEVEDORE_CLEAN= lines of a git
+// worker's output that start with verb ("Removing " or "Would remove ").
+func parseCleanedFiles(output string, verb string) []string {
+	files := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		cleaned, ok := strings.CutPrefix(strings.TrimSpace(line), "STEVEDORE_CLEAN=")
+		if !ok {
+			continue
+		}
+		if f, ok := strings.CutPrefix(cleaned, verb); ok {
+			files = append(files, f)
+		}
+	}
+	return files
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -180,6 +181,32 @@ func dockerAvailable() bool {
 
 // TestRunGitScript_ExecutesInContainer verifies that runGitScript runs
 // a script inside a docker container and returns stdout.
+func TestParseGitCheckOutput(t *testing.T) {
+	output := "Warning: Permanently added 'github.com' to the list of known hosts.\n" +
+		"STEVEDORE_CURRENT=aaaa\n" +
+		"STEVEDORE_REMOTE=cccc\n" +
+		"STEVEDORE_COUNTS=0\t2\n" +
+		"STEVEDORE_PENDING=cccc Fix the login page\n" +
+		"STEVEDORE_PENDING=bbbb Update docs\n"
+
+	result := parseGitCheckOutput(output)
+	if result.CurrentCommit != "aaaa" || result.RemoteCommit != "cccc" || !result.HasChanges {
+		t.Errorf("commits = %q -> %q (changes %v)", result.CurrentCommit, result.RemoteCommit, result.HasChanges)
+	}
+	if result.CommitsBehind != 2 || result.CommitsAhead != 0 {
+		t.Errorf("behind/ahead = %d/%d, want 2/0", result.CommitsBehind, result.CommitsAhead)
+	}
+	want := []string{"cccc Fix the login page", "bbbb Update docs"}
+	if strings.Join(result.PendingCommits, "|") != strings.Join(want, "|") {
+		t.Errorf("PendingCommits = %q, want %q", result.PendingCommits, want)
+	}
+
+	upToDate := parseGitCheckOutput("STEVEDORE_CURRENT=aaaa\nSTEVEDORE_REMOTE=aaaa\n")
+	if upToDate.HasChanges || upToDate.CommitsBehind != 0 || len(upToDate.PendingCommits) != 0 {
+		t.Errorf("up to date result = %+v", upToDate)
+	}
+}
+
 func TestRunGitScript_ExecutesInContainer(t *testing.T) {
 	if !dockerAvailable() {
 		t.Skip("docker not available")
@@ -473,6 +500,62 @@ func TestGitSyncClean_CleanRemovesUntracked(t *testing.T) {
 	}
 }
 
+func TestParseCleanedFiles(t *testing.T) {
+	output := "STEVEDORE_CLEAN=Removing build/\nSTEVEDORE_CLEAN=Removing debug.log\n" +
+		"STEVEDORE_CLEAN=Would remove tmp.txt\nSTEVEDORE_COMMIT=abc123\nRemoving ignored\n"
+
+	if got := parseCleanedFiles(output, "Removing "); !reflect.DeepEqual(got, []string{"build/", "debug.log"}) {
+		t.Errorf("removed = %q", got)
+	}
+	if got := parseCleanedFiles(output, "Would remove "); !reflect.DeepEqual(got, []string{"tmp.txt"}) {
+		t.Errorf("would remove = %q", got)
+	}
+	// An empty list, not nil, so the API reports "removedFiles": []
+	if got := parseCleanedFiles("STEVEDORE_COMMIT=abc123\n", "Removing "); got == nil || len(got) != 0 {
+		t.Errorf("no files = %#v", got)
+	}
+}
+
+func TestGitHeadScript_ReadsCommitMetadata(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "-c", "user.name=Jane Doe", "-c", "user.email=jane@example.com",
+		"commit", "-q", "-m", "Fix login = redirect", "-m", "Body is not part of the subject")
+
+	cmd := exec.Command("sh", "-c", gitHeadScript)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("gitHeadScript: %v\n%s", err, out)
+	}
+
+	commit, info := parseGitHead("Cloning...\n" + string(out))
+	if commit != getHeadCommit(t, dir) {
+		t.Errorf("commit = %q, want HEAD", commit)
+	}
+	if info.Author != "Jane Doe" || info.Subject != "Fix login = redirect" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.Date.IsZero() {
+		t.Error("expected the commit date")
+	}
+}
+
+func TestGitCleanDryRun_RequiresCheckout(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if _, err := instance.GitCleanDryRun(context.Background(), "app"); err == nil || !strings.Contains(err.Error(), "no checkout yet") {
+		t.Errorf("GitCleanDryRun without a checkout = %v", err)
+	}
+}
+
 // runDockerGit runs a git script in an alpine/git container with the given volumes.
 // It prepends safe.directory config to avoid dubious ownership errors.
 // Returns stdout.
@@ -556,3 +639,27 @@ func getHeadCommit(t *testing.T, dir string) string {
 	t.Helper()
 	return runGit(t, dir, "rev-parse", "HEAD")
 }
+
+func TestGitWorkerImage(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	if got := instance.GitWorkerImage("app"); got != DefaultGitWorkerConfig().Image {
+		t.Errorf("default image = %q", got)
+	}
+	if err := instance.SetGlobalParameter(ParamGitWorkerImage, []byte("mirror.local/alpine/git:2.45")); err != nil {
+		t.Fatalf("SetGlobalParameter: %v", err)
+	}
+	if got := instance.GitWorkerImage("app"); got != "mirror.local/alpine/git:2.45" {
+		t.Errorf("global image = %q", got)
+	}
+	if err := instance.SetParameter("app", ParamGitWorkerImage, []byte(" alpine/git:2.47 ")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+	if got := instance.GitWorkerImage("app"); got != "alpine/git:2.47" {
+		t.Errorf("deployment image = %q", got)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -56,6 +59,11 @@ type ContainerStatus struct {
 	Service string `json:"service"`
 	// Image used
 	Image string `json:"image"`
+	// ImageID is the ID of the image the container runs
+	ImageID string `json:"image_id,omitempty"`
+	// ImageDigest is the repo digest of that image (only populated by
+	// GetDeploymentStatus); empty for images built locally
+	ImageDigest string `json:"image_digest,omitempty"`
 	// Current state
 	State ContainerState `json:"state"`
 	// Health status (if health check is configured)
@@ -66,6 +74,29 @@ type ContainerStatus struct {
 	ExitCode int `json:"exit_code"`
 	// Started at timestamp
 	StartedAt time.Time `json:"started_at"`
+	// Number of times docker restarted the container (restart policy)
+	RestartCount int `json:"restart_count"`
+	// CPU usage percentage (only populated by CollectContainerStats)
+	CPUPercent float64 `json:"cpu_percent,omitempty"`
+	// Memory usage, e.g. "12.5MiB / 1.94GiB" (only populated by CollectContainerStats)
+	MemUsage string `json:"mem_usage,omitempty"`
+	// Memory usage percentage (only populated by CollectContainerStats)
+	MemPercent float64 `json:"mem_percent,omitempty"`
+	// ProbeError is why the stevedore-side health probe failed, if it did
+	ProbeError string `json:"probe_error,omitempty"`
+	// Env lists the container's environment variables without their values
+	// (only populated by MaskContainerEnv)
+	Env []EnvVar `json:"env,omitempty"`
+
+	// probe is the stevedore-side health probe (stevedore.healthcheck.port), if configured
+	probe *probeSpec
+	// labels are the container's labels, used for drift detection
+	labels map[string]string
+	// healthyAt is when the earliest retained passing health check began
+	healthyAt time.Time
+	// env is Config.Env from docker inspect; it holds secrets and is never
+	// serialized, see MaskContainerEnv
+	env []string
 }
 
 // DeploymentStatus holds the overall status of a deployment.
@@ -80,6 +111,22 @@ type DeploymentStatus struct {
 	Healthy bool `json:"healthy"`
 	// Status message
 	Message string `json:"message"`
+	// HealthyCount is how many of the TotalCount containers are running and
+	// not unhealthy
+	HealthyCount int `json:"healthy_count"`
+	TotalCount   int `json:"total_count"`
+	// Services breaks the health down by compose service
+	Services map[string]ServiceHealth `json:"services,omitempty"`
+	// Scale lists the replica overrides set with `deploy scale` and how many
+	// containers of each service run
+	Scale []ServiceScale `json:"scale,omitempty"`
+}
+
+// ServiceHealth is the health of the containers of one compose service.
+type ServiceHealth struct {
+	Healthy      bool `json:"healthy"`
+	HealthyCount int  `json:"healthy_count"`
+	TotalCount   int  `json:"total_count"`
 }
 
 // dockerInspectResult matches the JSON output of docker inspect.
@@ -93,12 +140,40 @@ type dockerInspectResult struct {
 		StartedAt string `json:"StartedAt"`
 		Health    *struct {
 			Status string `json:"Status"`
+			Log    []struct {
+				Start    string `json:"Start"`
+				ExitCode int    `json:"ExitCode"`
+			} `json:"Log"`
 		} `json:"Health,omitempty"`
 	} `json:"State"`
+	Image  string `json:"Image"`
 	Config struct {
 		Image  string            `json:"Image"`
 		Labels map[string]string `json:"Labels"`
+		Env    []string          `json:"Env"`
 	} `json:"Config"`
+	RestartCount    int `json:"RestartCount"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// containerIP returns the container's address on the first network (by name)
+// that assigned one.
+func (r dockerInspectResult) containerIP() string {
+	names := make([]string, 0, len(r.NetworkSettings.Networks))
+	for name := range r.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip := r.NetworkSettings.Networks[name].IPAddress; ip != "" {
+			return ip
+		}
+	}
+	return ""
 }
 
 // GetDeploymentStatus returns the current status of a deployment.
@@ -119,35 +194,74 @@ func (i *Instance) GetDeploymentStatus(ctx context.Context, deployment string) (
 		Deployment:  deployment,
 		ProjectName: projectName,
 		Containers:  containers,
-		Healthy:     true,
 	}
 
-	if len(containers) == 0 {
-		status.Healthy = false
-		status.Message = "No containers found"
-		return status, nil
+	// Status must work without a readable database
+	if scales, err := i.loadServiceScales(deployment); err == nil && len(scales) > 0 {
+		status.Scale = serviceScaleStatus(scales, containers)
 	}
 
-	// Check overall health
+	// Tags are mutable: report what each container actually runs
+	addImageDigests(ctx, containers)
+
+	// Stevedore-side probes complement docker HEALTHCHECKs
+	for idx := range containers {
+		applyProbe(ctx, &containers[idx])
+	}
+
+	summarizeHealth(status)
+	return status, nil
+}
+
+// summarizeHealth sets the overall health, the counts, the per-service
+// breakdown and the message of a status from its containers. A container is
+// healthy when it runs and its health check (if any) does not fail.
+func summarizeHealth(status *DeploymentStatus) {
+	status.TotalCount = len(status.Containers)
+	status.HealthyCount = 0
+	status.Services = make(map[string]ServiceHealth)
+
 	runningCount := 0
-	for _, c := range containers {
+	for _, c := range status.Containers {
+		service := c.Service
+		if service == "" {
+			service = c.Name
+		}
+		sh := status.Services[service]
+		sh.TotalCount++
 		if c.State == StateRunning {
 			runningCount++
-			if c.Health == HealthUnhealthy {
-				status.Healthy = false
+			if c.Health != HealthUnhealthy {
+				sh.HealthyCount++
+				status.HealthyCount++
 			}
-		} else {
-			status.Healthy = false
 		}
+		sh.Healthy = sh.HealthyCount == sh.TotalCount
+		status.Services[service] = sh
 	}
 
-	if status.Healthy {
-		status.Message = fmt.Sprintf("All %d containers healthy", len(containers))
-	} else {
-		status.Message = fmt.Sprintf("%d/%d containers running", runningCount, len(containers))
+	status.Healthy = status.TotalCount > 0 && status.HealthyCount == status.TotalCount
+	switch {
+	case status.TotalCount == 0:
+		status.Message = "No containers found"
+	case status.Healthy:
+		status.Message = fmt.Sprintf("All %d containers healthy", status.TotalCount)
+	default:
+		status.Message = fmt.Sprintf("%d/%d containers running", runningCount, status.TotalCount)
 	}
+}
 
-	return status, nil
+// UnhealthyServices returns the sorted names of the services with a
+// container that is not healthy.
+func (s *DeploymentStatus) UnhealthyServices() []string {
+	var names []string
+	for name, sh := range s.Services {
+		if !sh.Healthy {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 // listProjectContainers lists all containers for a compose project.
@@ -159,7 +273,7 @@ func (i *Instance) listProjectContainers(ctx context.Context, projectName string
 		"--format", "{{.ID}}",
 	}
 
-	cmd := newCommand(ctx, "docker", args...)
+	cmd := newDockerCommand(ctx, args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -191,7 +305,7 @@ func (i *Instance) listProjectContainers(ctx context.Context, projectName string
 
 // inspectContainer gets detailed status for a container.
 func (i *Instance) inspectContainer(ctx context.Context, containerID string) (*ContainerStatus, error) {
-	cmd := newCommand(ctx, "docker", "inspect", containerID)
+	cmd := newDockerCommand(ctx, "inspect", containerID)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -211,11 +325,15 @@ func (i *Instance) inspectContainer(ctx context.Context, containerID string) (*C
 
 	r := results[0]
 	status := &ContainerStatus{
-		ID:       r.ID[:12], // Short ID
-		Name:     strings.TrimPrefix(r.Name, "/"),
-		Image:    r.Config.Image,
-		State:    ContainerState(r.State.Status),
-		ExitCode: r.State.ExitCode,
+		ID:           r.ID[:12], // Short ID
+		Name:         strings.TrimPrefix(r.Name, "/"),
+		Image:        r.Config.Image,
+		ImageID:      r.Image,
+		State:        ContainerState(r.State.Status),
+		ExitCode:     r.State.ExitCode,
+		RestartCount: r.RestartCount,
+		labels:       r.Config.Labels,
+		env:          r.Config.Env,
 	}
 
 	// Extract service name from labels
@@ -230,10 +348,27 @@ func (i *Instance) inspectContainer(ctx context.Context, containerID string) (*C
 		status.Health = HealthNone
 	}
 
+	probe, err := probeSpecFromLabels(r.Config.Labels, r.containerIP())
+	if err != nil {
+		status.ProbeError = err.Error()
+	}
+	status.probe = probe
+
 	// Parse started at time
 	if t, err := time.Parse(time.RFC3339Nano, r.State.StartedAt); err == nil {
 		status.StartedAt = t
 	}
+	if status.Health == HealthHealthy {
+		for _, check := range r.State.Health.Log {
+			t, err := time.Parse(time.RFC3339Nano, check.Start)
+			if err != nil || check.ExitCode != 0 || t.Before(status.StartedAt) {
+				continue
+			}
+			if status.healthyAt.IsZero() || t.Before(status.healthyAt) {
+				status.healthyAt = t
+			}
+		}
+	}
 
 	// Generate status string
 	if r.State.Running {
@@ -249,30 +384,136 @@ func (i *Instance) inspectContainer(ctx context.Context, containerID string) (*C
 	return status, nil
 }
 
-// WaitForHealthy waits for all containers in a deployment to be healthy.
-func (i *Instance) WaitForHealthy(ctx context.Context, deployment string, timeout time.Duration) error {
-	if timeout == 0 {
-		timeout = 5 * time.Minute
+// Deployment parameters that tune WaitForHealthy for slow-starting apps,
+// each a duration ("30s") or a number of seconds.
+const (
+	// ParamHealthInterval is how often the containers are checked (default 2s)
+	ParamHealthInterval = "STEVEDORE_HEALTH_INTERVAL"
+	// ParamHealthInitialDelay is how long to wait before the first check
+	ParamHealthInitialDelay = "STEVEDORE_HEALTH_INITIAL_DELAY"
+	// ParamHealthStartPeriod is how long containers may stay starting or
+	// unhealthy before the wait fails; unset waits until the timeout
+	ParamHealthStartPeriod = "STEVEDORE_HEALTH_START_PERIOD"
+)
+
+// DefaultHealthInterval is how often WaitForHealthy checks the containers.
+const DefaultHealthInterval = 2 * time.Second
+
+// WaitOptions controls WaitForHealthy.
+type WaitOptions struct {
+	// Timeout bounds the whole wait (default 5m)
+	Timeout time.Duration
+	// Interval between checks (default DefaultHealthInterval)
+	Interval time.Duration
+	// InitialDelay postpones the first check
+	InitialDelay time.Duration
+	// StartPeriod is the grace period, counted from the start of the wait,
+	// in which starting and unhealthy containers are not failures yet. Once
+	// it elapses, a container that is still not healthy fails the wait.
+	// Zero waits until the timeout.
+	StartPeriod time.Duration
+}
+
+// HealthWaitOptions returns the wait options for a deployment from its
+// STEVEDORE_HEALTH_* parameters. Invalid values only log a warning.
+func (i *Instance) HealthWaitOptions(deployment string, timeout time.Duration) WaitOptions {
+	opts := WaitOptions{Timeout: timeout}
+	for name, target := range map[string]*time.Duration{
+		ParamHealthInterval:     &opts.Interval,
+		ParamHealthInitialDelay: &opts.InitialDelay,
+		ParamHealthStartPeriod:  &opts.StartPeriod,
+	} {
+		value, err := i.GetParameter(deployment, name)
+		if err != nil {
+			continue
+		}
+		d, err := parseDurationParam(string(value))
+		if err != nil {
+			log.Printf("Warning: ignoring parameter %s of %s: %v", name, deployment, err)
+			continue
+		}
+		*target = d
 	}
+	return opts
+}
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
+// parseDurationParam parses a parameter given as a duration or whole seconds.
+func parseDurationParam(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q (expected a duration like 30s or a number of seconds)", value)
+	}
+	return d, nil
+}
 
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+// notReadyServices returns the sorted services with a container that is not
+// running, or whose health check has not passed yet (starting) or fails.
+// Containers without a health check are ready once running.
+func notReadyServices(status *DeploymentStatus) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, c := range status.Containers {
+		if c.State == StateRunning && (c.Health == HealthHealthy || c.Health == HealthNone || c.Health == "") {
+			continue
+		}
+		service := c.Service
+		if service == "" {
+			service = c.Name
+		}
+		if !seen[service] {
+			seen[service] = true
+			names = append(names, service)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WaitForHealthy waits until every container of a deployment runs and has
+// passed its health check. Starting containers are waited for; with a start
+// period, containers that are still not healthy when it elapses fail the wait
+// early instead of at the timeout.
+func (i *Instance) WaitForHealthy(ctx context.Context, deployment string, opts WaitOptions) error {
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Minute
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultHealthInterval
+	}
 
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	started := time.Now()
+	delay := opts.InitialDelay
+	var notReady []string
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("timeout waiting for deployment to be healthy")
-		case <-ticker.C:
-			status, err := i.GetDeploymentStatus(ctx, deployment)
-			if err != nil {
-				continue
-			}
-			if status.Healthy && len(status.Containers) > 0 {
-				return nil
+			if len(notReady) > 0 {
+				err := fmt.Errorf("timeout waiting for deployment to be healthy (not ready: %s)", strings.Join(notReady, ", "))
+				return i.withStartupLogs(ctx, deployment, notReady, err)
 			}
+			return fmt.Errorf("timeout waiting for deployment to be healthy")
+		case <-time.After(delay):
+		}
+		delay = opts.Interval
+
+		status, err := i.GetDeploymentStatus(ctx, deployment)
+		if err != nil {
+			continue
+		}
+		notReady = notReadyServices(status)
+		if len(status.Containers) > 0 && len(notReady) == 0 {
+			return nil
+		}
+		if opts.StartPeriod > 0 && len(notReady) > 0 && time.Since(started) >= opts.StartPeriod {
+			err := fmt.Errorf("still not healthy when the %s start period elapsed: %s", formatDuration(opts.StartPeriod), strings.Join(notReady, ", "))
+			return i.withStartupLogs(ctx, deployment, notReady, err)
 		}
 	}
 }
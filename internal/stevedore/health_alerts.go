@@ -0,0 +1,153 @@
+package stevedore
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// HealthAlertConfig holds the thresholds for health transition alerts.
+type HealthAlertConfig struct {
+	// Debounce is how long a deployment must stay in its new health state
+	// before the transition is reported (default: 1m).
+	Debounce time.Duration
+	// FlapTransitions is the number of reported transitions within
+	// FlapWindow that marks a deployment as flapping (default: 4). A flapping
+	// deployment gets one flapping alert instead of an alert per transition.
+	FlapTransitions int
+	// FlapWindow is the sliding window transitions are counted in (default: 30m).
+	FlapWindow time.Duration
+}
+
+func (c HealthAlertConfig) withDefaults() HealthAlertConfig {
+	if c.Debounce <= 0 {
+		c.Debounce = time.Minute
+	}
+	if c.FlapTransitions <= 0 {
+		c.FlapTransitions = 4
+	}
+	if c.FlapWindow <= 0 {
+		c.FlapWindow = 30 * time.Minute
+	}
+	return c
+}
+
+// HealthState is the persisted health of a deployment as last reported by
+// the daemon, so a transition is detected across daemon restarts.
+type HealthState struct {
+	Deployment string
+	Healthy    bool
+	// Since is when the deployment was first seen in its current state
+	Since time.Time
+	// PendingSince is when the opposite state was first seen; zero when the
+	// latest observation matched Healthy
+	PendingSince time.Time
+}
+
+// evaluateHealth applies an observation to the last known state of a
+// deployment and reports whether it completes a transition: the opposite
+// state was seen for at least debounce. The first observation of a
+// deployment only records its state.
+func evaluateHealth(state *HealthState, deployment string, healthy bool, now time.Time, debounce time.Duration) (HealthState, bool) {
+	if state == nil {
+		return HealthState{Deployment: deployment, Healthy: healthy, Since: now}, false
+	}
+
+	next := *state
+	if healthy == state.Healthy {
+		next.PendingSince = time.Time{}
+		return next, false
+	}
+	if next.PendingSince.IsZero() {
+		next.PendingSince = now
+	}
+	if now.Sub(next.PendingSince) < debounce {
+		return next, false
+	}
+	return HealthState{Deployment: deployment, Healthy: healthy, Since: next.PendingSince}, true
+}
+
+// healthFlapTracker counts the reported health transitions of each
+// deployment within a sliding window.
+type healthFlapTracker struct {
+	window time.Duration
+
+	mu          sync.Mutex
+	transitions map[string][]time.Time
+}
+
+func newHealthFlapTracker(window time.Duration) *healthFlapTracker {
+	return &healthFlapTracker{
+		window:      window,
+		transitions: make(map[string][]time.Time),
+	}
+}
+
+// record adds a transition of deployment and returns the number of its
+// transitions within the window, including this one.
+func (t *healthFlapTracker) record(deployment string, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := now.Add(-t.window)
+	kept := []time.Time{}
+	for _, at := range t.transitions[deployment] {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	kept = append(kept, now)
+	t.transitions[deployment] = kept
+	return len(kept)
+}
+
+// GetHealthState returns the last known health of a deployment, or nil when
+// the daemon has not observed it yet.
+func (i *Instance) GetHealthState(db *sql.DB, deployment string) (*HealthState, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+
+	state := HealthState{Deployment: deployment}
+	var since int64
+	var pendingSince sql.NullInt64
+	err := db.QueryRow(`
+		SELECT healthy, since, pending_since
+		FROM health_states
+		WHERE deployment = ?
+	`, deployment).Scan(&state.Healthy, &since, &pendingSince)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state.Since = time.Unix(since, 0)
+	if pendingSince.Valid {
+		state.PendingSince = time.Unix(pendingSince.Int64, 0)
+	}
+	return &state, nil
+}
+
+// SaveHealthState stores the last known health of a deployment.
+func (i *Instance) SaveHealthState(db *sql.DB, state HealthState) error {
+	if err := ValidateDeploymentName(state.Deployment); err != nil {
+		return err
+	}
+
+	var pendingSince sql.NullInt64
+	if !state.PendingSince.IsZero() {
+		pendingSince = sql.NullInt64{Int64: state.PendingSince.Unix(), Valid: true}
+	}
+	_, err := db.Exec(`
+		INSERT INTO health_states (deployment, healthy, since, pending_since)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(deployment) DO UPDATE SET
+			healthy = excluded.healthy,
+			since = excluded.since,
+			pending_since = excluded.pending_since
+	`, state.Deployment, state.Healthy, state.Since.Unix(), pendingSince)
+	return err
+}
@@ -0,0 +1,150 @@
+package stevedore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvaluateHealth_DebouncesTransitions(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	debounce := time.Minute
+
+	state, changed := evaluateHealth(nil, "api", true, start, debounce)
+	if changed || !state.Healthy || !state.Since.Equal(start) {
+		t.Fatalf("first observation = %+v, %v; want healthy baseline without a transition", state, changed)
+	}
+
+	// A blip shorter than the debounce is not reported
+	state, changed = evaluateHealth(&state, "api", false, start.Add(10*time.Second), debounce)
+	if changed || !state.Healthy || !state.PendingSince.Equal(start.Add(10*time.Second)) {
+		t.Fatalf("unhealthy blip = %+v, %v", state, changed)
+	}
+	state, changed = evaluateHealth(&state, "api", true, start.Add(40*time.Second), debounce)
+	if changed || !state.PendingSince.IsZero() {
+		t.Fatalf("recovered blip = %+v, %v; want the pending state cleared", state, changed)
+	}
+
+	// Unhealthy for a full minute is a transition dated to when it started
+	unhealthyAt := start.Add(2 * time.Minute)
+	state, _ = evaluateHealth(&state, "api", false, unhealthyAt, debounce)
+	state, changed = evaluateHealth(&state, "api", false, unhealthyAt.Add(30*time.Second), debounce)
+	if changed {
+		t.Fatalf("transition reported before the debounce elapsed: %+v", state)
+	}
+	state, changed = evaluateHealth(&state, "api", false, unhealthyAt.Add(time.Minute), debounce)
+	want := HealthState{Deployment: "api", Healthy: false, Since: unhealthyAt}
+	if !changed || !reflect.DeepEqual(state, want) {
+		t.Errorf("after debounce = %+v, %v; want %+v, true", state, changed, want)
+	}
+}
+
+func TestHealthFlapTracker_CountsTransitionsInWindow(t *testing.T) {
+	tracker := newHealthFlapTracker(30 * time.Minute)
+	start := time.Now()
+
+	for idx, want := range []int{1, 2, 3} {
+		if got := tracker.record("api", start.Add(time.Duration(idx)*10*time.Minute)); got != want {
+			t.Errorf("transition %d = %d, want %d", idx, got, want)
+		}
+	}
+	// The first two transitions fell out of the window
+	if got := tracker.record("api", start.Add(45*time.Minute)); got != 2 {
+		t.Errorf("after 45m = %d, want 2", got)
+	}
+	if got := tracker.record("web", start); got != 1 {
+		t.Errorf("other deployment = %d, want 1", got)
+	}
+}
+
+func TestHealthState_Persisted(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if state, err := instance.GetHealthState(db, "app"); err != nil || state != nil {
+		t.Fatalf("GetHealthState before any observation = %+v, %v; want nil", state, err)
+	}
+
+	for _, want := range []HealthState{
+		{Deployment: "app", Healthy: true, Since: time.Unix(1700000000, 0), PendingSince: time.Unix(1700000060, 0)},
+		{Deployment: "app", Healthy: false, Since: time.Unix(1700000060, 0)},
+	} {
+		if err := instance.SaveHealthState(db, want); err != nil {
+			t.Fatalf("SaveHealthState: %v", err)
+		}
+		state, err := instance.GetHealthState(db, "app")
+		if err != nil || state == nil || !reflect.DeepEqual(*state, want) {
+			t.Errorf("GetHealthState = %+v, %v; want %+v", state, err, want)
+		}
+	}
+}
+
+func TestDaemon_CheckHealthTransition_AlertsAndDetectsFlapping(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("api", RepoSpec{URL: "git@github.com:acme/api.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var mu sync.Mutex
+	var received []Event
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	d := NewDaemon(instance, db, DaemonConfig{
+		NotifyWebhookURL: webhook.URL,
+		HealthAlerts:     HealthAlertConfig{Debounce: time.Nanosecond, FlapTransitions: 2},
+	})
+	observe := func(healthy bool) {
+		d.checkHealthTransition(context.Background(), "api", &DeploymentStatus{Deployment: "api", Healthy: healthy})
+	}
+
+	// Baseline, then each state is seen twice to pass the debounce
+	for _, healthy := range []bool{true, false, false, true, true, false, false} {
+		observe(healthy)
+	}
+
+	var types []EventType
+	for _, event := range received {
+		types = append(types, event.Type)
+	}
+	// The second transition reaches the flap threshold; the third is not POSTed
+	want := []EventType{EventDeploymentStatusChanged, EventDeploymentHealthFlapping}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("webhook events = %v, want %v", types, want)
+	}
+	if got := received[0].Details["healthy"]; got != "false" {
+		t.Errorf("first transition healthy = %q, want false", got)
+	}
+
+	state, err := instance.GetHealthState(db, "api")
+	if err != nil || state == nil || state.Healthy {
+		t.Errorf("persisted state = %+v, %v; want unhealthy", state, err)
+	}
+}
@@ -0,0 +1,92 @@
+package stevedore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSummarizeHealth(t *testing.T) {
+	status := &DeploymentStatus{Containers: []ContainerStatus{
+		{Name: "app-web-1", Service: "web", State: StateRunning, Health: HealthHealthy},
+		{Name: "app-web-2", Service: "web", State: StateRunning, Health: HealthStarting},
+		{Name: "app-worker-1", Service: "worker", State: StateRunning, Health: HealthUnhealthy},
+		{Name: "app-cron-1", Service: "cron", State: StateExited, Health: HealthNone},
+	}}
+	summarizeHealth(status)
+
+	if status.Healthy || status.HealthyCount != 2 || status.TotalCount != 4 {
+		t.Errorf("summary = healthy %v, %d/%d, want false, 2/4", status.Healthy, status.HealthyCount, status.TotalCount)
+	}
+	if status.Message != "3/4 containers running" {
+		t.Errorf("Message = %q, want the existing running summary", status.Message)
+	}
+	want := map[string]ServiceHealth{
+		"web":    {Healthy: true, HealthyCount: 2, TotalCount: 2},
+		"worker": {Healthy: false, HealthyCount: 0, TotalCount: 1},
+		"cron":   {Healthy: false, HealthyCount: 0, TotalCount: 1},
+	}
+	if !reflect.DeepEqual(status.Services, want) {
+		t.Errorf("Services = %+v, want %+v", status.Services, want)
+	}
+	if got := status.UnhealthyServices(); !reflect.DeepEqual(got, []string{"cron", "worker"}) {
+		t.Errorf("UnhealthyServices() = %v", got)
+	}
+
+	status = &DeploymentStatus{Containers: []ContainerStatus{
+		{Service: "web", State: StateRunning, Health: HealthHealthy},
+		{Service: "db", State: StateRunning, Health: HealthNone},
+	}}
+	summarizeHealth(status)
+	if !status.Healthy || status.Message != "All 2 containers healthy" || status.HealthyCount != 2 {
+		t.Errorf("healthy summary = %+v", status)
+	}
+
+	status = &DeploymentStatus{}
+	summarizeHealth(status)
+	if status.Healthy || status.Message != "No containers found" || len(status.Services) != 0 {
+		t.Errorf("empty summary = %+v", status)
+	}
+}
+
+func TestNotReadyServices(t *testing.T) {
+	status := &DeploymentStatus{Containers: []ContainerStatus{
+		{Service: "web", State: StateRunning, Health: HealthHealthy},
+		{Service: "db", State: StateRunning, Health: HealthNone},
+		{Service: "api", State: StateRunning, Health: HealthStarting},
+		{Service: "worker", State: StateRunning, Health: HealthUnhealthy},
+		{Service: "cron", State: StateExited, Health: HealthNone},
+	}}
+	// Unlike the status summary, a starting container is not ready yet
+	if got := notReadyServices(status); !reflect.DeepEqual(got, []string{"api", "cron", "worker"}) {
+		t.Errorf("notReadyServices() = %v", got)
+	}
+}
+
+func TestHealthWaitOptions(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	opts := instance.HealthWaitOptions("app", time.Minute)
+	if opts != (WaitOptions{Timeout: time.Minute}) {
+		t.Errorf("defaults = %+v", opts)
+	}
+
+	for name, value := range map[string]string{
+		ParamHealthInterval:     "5s",
+		ParamHealthInitialDelay: "10",
+		ParamHealthStartPeriod:  "soon",
+	} {
+		if err := instance.SetParameter("app", name, []byte(value)); err != nil {
+			t.Fatalf("SetParameter %s: %v", name, err)
+		}
+	}
+	opts = instance.HealthWaitOptions("app", time.Minute)
+	want := WaitOptions{Timeout: time.Minute, Interval: 5 * time.Second, InitialDelay: 10 * time.Second}
+	if opts != want {
+		t.Errorf("HealthWaitOptions = %+v, want %+v (invalid start period ignored)", opts, want)
+	}
+}
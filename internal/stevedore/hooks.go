@@ -0,0 +1,201 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HookDir is the repository directory holding lifecycle hook scripts.
+const HookDir = ".stevedore"
+
+// Lifecycle hooks, run from <repo>/.stevedore/<hook>.sh when the script exists.
+const (
+	// HookPreDeploy runs before `docker compose up`; a failure aborts the deploy.
+	HookPreDeploy = "pre-deploy"
+	// HookPostDeploy runs after `docker compose up` succeeded.
+	HookPostDeploy = "post-deploy"
+	// HookPreStop runs before `docker compose down`.
+	HookPreStop = "pre-stop"
+)
+
+// DefaultHookImage is the image hook scripts run in. It ships a shell and the
+// docker CLI, so hooks can `docker compose exec` into the deployment.
+const DefaultHookImage = "docker:cli"
+
+// ParamHookImage is a deployment parameter that overrides DefaultHookImage.
+const ParamHookImage = "STEVEDORE_HOOK_IMAGE"
+
+// hookOutputLimit caps the hook output kept in a HookResult; the tail is kept.
+const hookOutputLimit = 64 * 1024
+
+// HookResult is the outcome of one hook run.
+type HookResult struct {
+	Name     string
+	Output   string
+	Duration time.Duration
+	// Error is empty when the hook succeeded
+	Error string
+}
+
+// hookScript returns the path of a hook script in the checkout, or "" when
+// the repository does not define the hook.
+func hookScript(gitDir string, hook string) (string, error) {
+	path := filepath.Join(gitDir, HookDir, hook+".sh")
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s hook is a directory: %s", hook, path)
+	}
+	return path, nil
+}
+
+// deploymentEnv returns the environment the deployment's compose commands and
+// hooks run with: the STEVEDORE_* paths plus the deployment parameters,
+// including inherited global ones, with ${NAME} references between them
+// resolved (interpolateParameters).
+// Registry credentials and build args are consumed by stevedore and left out.
+func (i *Instance) deploymentEnv(deployment string) ([]string, error) {
+	deploymentDir := i.DeploymentDir(deployment)
+	env := []string{
+		"STEVEDORE_DEPLOYMENT=" + deployment,
+		"STEVEDORE_DATA=" + filepath.Join(deploymentDir, "data"),
+		"STEVEDORE_LOGS=" + filepath.Join(deploymentDir, "logs"),
+		"STEVEDORE_SHARED=" + filepath.Join(i.Root, "shared"),
+	}
+	if profile, err := i.DeploymentProfile(deployment); err == nil && profile != "" {
+		env = append(env, "STEVEDORE_PROFILE="+profile)
+	}
+
+	var names []string
+	params := make(map[string]string)
+	paramNames, _ := i.ListEffectiveParameters(deployment)
+	for _, name := range paramNames {
+		if isRegistryParam(name) || isBuildArgParam(name) {
+			// Registry credentials are for docker login only, build args for the build step
+			continue
+		}
+		if isFileParam(name) {
+			// File parameters are exported as the path of their file, not their value
+			if kv, ok := i.secretFileEnv(deployment, name); ok {
+				env = append(env, kv)
+			}
+			continue
+		}
+		value, err := i.GetParameter(deployment, name)
+		if err == nil {
+			names = append(names, name)
+			params[name] = string(value)
+		}
+	}
+
+	resolved, err := interpolateParameters(params, env)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		env = append(env, name+"="+resolved[name])
+	}
+	return env, nil
+}
+
+// runHook runs a lifecycle hook in a worker container and returns its result,
+// or nil when the repository does not define the hook. The checkout (its
+// --subdir, if set) is mounted at /repo (the working directory), the data, logs and shared directories at
+// the paths in STEVEDORE_DATA/LOGS/SHARED, and the docker socket so hooks can
+// reach the deployment's containers. COMPOSE_FILE and COMPOSE_PROJECT_NAME
+// point at the deployment.
+func (i *Instance) runHook(ctx context.Context, deployment string, hook string, composePath string, env []string) (*HookResult, error) {
+	deploymentDir := i.DeploymentDir(deployment)
+	gitDir := i.composeDir(deployment)
+
+	script, err := hookScript(gitDir, hook)
+	if err != nil || script == "" {
+		return nil, err
+	}
+
+	image := DefaultHookImage
+	if value, err := i.GetParameter(deployment, ParamHookImage); err == nil && strings.TrimSpace(string(value)) != "" {
+		image = strings.TrimSpace(string(value))
+	}
+
+	env = append(env, "COMPOSE_PROJECT_NAME="+ComposeProjectName(deployment))
+	if composePath != "" {
+		// The profile override too, so hooks see what compose deploys
+		composeFiles, err := i.composeFiles(deployment, composePath)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(composeFiles))
+		for _, file := range composeFiles {
+			names = append(names, "/repo/"+filepath.Base(file))
+		}
+		env = append(env, "COMPOSE_FILE="+strings.Join(names, ":"))
+	}
+
+	dataDir := filepath.Join(deploymentDir, "data")
+	logsDir := filepath.Join(deploymentDir, "logs")
+	sharedDir := filepath.Join(i.Root, "shared")
+
+	args := []string{
+		"run",
+		"--rm",
+		"--name", fmt.Sprintf("stevedore-hook-%s-%s-%d", deployment, hook, time.Now().UnixNano()),
+		"--entrypoint", "sh",
+		"--label", "com.stevedore.managed=true",
+		"--label", "com.stevedore.deployment=" + deployment,
+		"--label", "com.stevedore.role=hook",
+		"-v", "/var/run/docker.sock:/var/run/docker.sock",
+		"-v", i.hostPath(gitDir) + ":/repo:ro",
+		"-v", i.hostPath(dataDir) + ":" + dataDir,
+		"-v", i.hostPath(logsDir) + ":" + logsDir,
+		"-v", i.hostPath(sharedDir) + ":" + sharedDir,
+		"-w", "/repo",
+	}
+	// Pass variables by name so values (secrets) stay off the command line;
+	// docker reads them from its own environment.
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		args = append(args, "-e", name)
+	}
+	args = append(args, image, "/repo/"+HookDir+"/"+hook+".sh")
+
+	log.Printf("Running %s hook for %s", hook, deployment)
+	start := time.Now()
+
+	cmd := newDockerCommand(ctx, args...)
+	cmd.Env = dockerCommandEnv(env)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	result := &HookResult{Name: hook}
+	runErr := runCommand(cmd)
+	result.Duration = time.Since(start)
+	result.Output = tailString(output.String(), hookOutputLimit)
+	if runErr != nil {
+		result.Error = runErr.Error()
+		log.Printf("%s hook for %s failed after %s: %v", hook, deployment, result.Duration.Round(time.Millisecond), runErr)
+	} else {
+		log.Printf("%s hook for %s finished in %s", hook, deployment, result.Duration.Round(time.Millisecond))
+	}
+	return result, nil
+}
+
+// tailString returns the last limit bytes of s.
+func tailString(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return "...\n" + s[len(s)-limit:]
+}
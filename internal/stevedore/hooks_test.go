@@ -0,0 +1,76 @@
+package stevedore
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHookScript(t *testing.T) {
+	gitDir := t.TempDir()
+
+	path, err := hookScript(gitDir, HookPreDeploy)
+	if err != nil || path != "" {
+		t.Fatalf("hookScript without hook = %q, %v", path, err)
+	}
+
+	want := filepath.Join(gitDir, HookDir, "pre-deploy.sh")
+	if err := os.MkdirAll(filepath.Dir(want), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(want, []byte("echo backup\n"), 0o755); err != nil {
+		t.Fatalf("write hook: %v", err)
+	}
+
+	path, err = hookScript(gitDir, HookPreDeploy)
+	if err != nil || path != want {
+		t.Errorf("hookScript = %q, %v, want %q", path, err, want)
+	}
+	if path, _ := hookScript(gitDir, HookPostDeploy); path != "" {
+		t.Errorf("hookScript(post-deploy) = %q, want none", path)
+	}
+}
+
+func TestDeploymentEnv(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	for name, value := range map[string]string{
+		"DATABASE_URL":                 "postgres://db/app",
+		"STEVEDORE_BUILD_ARG_VERSION":  "1.2",
+		"STEVEDORE_REGISTRY_GHCR_PASS": "secret",
+	} {
+		if err := instance.SetParameter("app", name, []byte(value)); err != nil {
+			t.Fatalf("SetParameter %s: %v", name, err)
+		}
+	}
+
+	env, err := instance.deploymentEnv("app")
+	if err != nil {
+		t.Fatalf("deploymentEnv: %v", err)
+	}
+	if !slices.Contains(env, "DATABASE_URL=postgres://db/app") {
+		t.Errorf("env %q is missing DATABASE_URL", env)
+	}
+	if !slices.Contains(env, "STEVEDORE_DATA="+filepath.Join(instance.DeploymentDir("app"), "data")) {
+		t.Errorf("env %q is missing STEVEDORE_DATA", env)
+	}
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "STEVEDORE_BUILD_ARG_") || strings.HasPrefix(kv, "STEVEDORE_REGISTRY_") {
+			t.Errorf("env must not contain %q", kv)
+		}
+	}
+}
+
+func TestTailString(t *testing.T) {
+	if got := tailString("short", 10); got != "short" {
+		t.Errorf("tailString = %q", got)
+	}
+	if got := tailString("0123456789", 4); got != "...\n6789" {
+		t.Errorf("tailString = %q", got)
+	}
+}
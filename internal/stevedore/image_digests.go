@@ -0,0 +1,170 @@
+package stevedore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ParamPinDigests set to "true" makes deploys pull the registry images of a
+// deployment's services, resolve their tags to digests and run the services
+// by digest. The digests are recorded in the deploy history, so a deploy of a
+// mutable tag such as `:latest` can be reproduced exactly.
+const ParamPinDigests = "STEVEDORE_PIN_DIGESTS"
+
+// ImageDigest is the image a service was deployed with.
+type ImageDigest struct {
+	Service string `json:"service"`
+	// Image is the configured reference, e.g. "nginx:latest"
+	Image string `json:"image"`
+	// Digest is the repo digest it resolved to, e.g. "nginx@sha256:..."
+	Digest string `json:"digest"`
+}
+
+// imageRepository strips the tag and digest from an image reference:
+// "ghcr.io/acme/app:1.2@sha256:..." is "ghcr.io/acme/app". A registry port
+// ("host:5000/app") is not mistaken for a tag.
+func imageRepository(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		image = image[:idx]
+	}
+	return image
+}
+
+// pickRepoDigest returns the repo digest of image among an image's
+// RepoDigests: the one of the same repository, otherwise the first. It is
+// empty for images never pushed to or pulled from a registry.
+func pickRepoDigest(image string, repoDigests []string) string {
+	repo := imageRepository(image)
+	for _, digest := range repoDigests {
+		if imageRepository(digest) == repo {
+			return digest
+		}
+	}
+	if len(repoDigests) > 0 {
+		return repoDigests[0]
+	}
+	return ""
+}
+
+// imageRepoDigests runs one `docker image inspect` for the given image IDs or
+// references and returns their RepoDigests by the argument they were
+// inspected as.
+func imageRepoDigests(ctx context.Context, images []string) (map[string][]string, error) {
+	args := append([]string{"image", "inspect", "--format", "{{json .RepoDigests}}"}, images...)
+	cmd := newDockerCommand(ctx, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("docker image inspect failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// One line per image, in argument order
+	result := make(map[string][]string, len(images))
+	scanner := bufio.NewScanner(&stdout)
+	for idx := 0; idx < len(images) && scanner.Scan(); idx++ {
+		var digests []string
+		if err := json.Unmarshal(scanner.Bytes(), &digests); err != nil {
+			return nil, fmt.Errorf("parse docker image inspect output: %w", err)
+		}
+		result[images[idx]] = digests
+	}
+	return result, scanner.Err()
+}
+
+// addImageDigests sets ImageDigest of each container from the image it runs.
+// It is best-effort: status must not fail because an image was removed.
+func addImageDigests(ctx context.Context, containers []ContainerStatus) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, c := range containers {
+		if c.ImageID != "" && !seen[c.ImageID] {
+			seen[c.ImageID] = true
+			ids = append(ids, c.ImageID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	digests, err := imageRepoDigests(ctx, ids)
+	if err != nil {
+		log.Printf("Warning: cannot read image digests: %v", err)
+		return
+	}
+	for idx := range containers {
+		containers[idx].ImageDigest = pickRepoDigest(containers[idx].Image, digests[containers[idx].ImageID])
+	}
+}
+
+// pinImageDigests pulls the registry image of each service that is not
+// built locally, resolves it to a repo digest and writes a compose override
+// that runs the services by digest. It returns "" when no service uses a
+// registry image. env carries the deploy's registry logins.
+func (i *Instance) pinImageDigests(ctx context.Context, composeFiles []string, projectName, gitDir string, env []string) (string, []ImageDigest, error) {
+	services, err := resolveComposeServices(ctx, composeFiles, projectName, gitDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve compose services to pin digests: %w", err)
+	}
+
+	names := make([]string, 0, len(services))
+	for name, svc := range services {
+		if svc.Image != "" && svc.Build == nil {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", nil, nil
+	}
+	sort.Strings(names)
+
+	resolved := make(map[string]string)
+	for _, name := range names {
+		image := services[name].Image
+		if _, ok := resolved[image]; ok {
+			continue
+		}
+		cmd := newDockerCommand(ctx, "pull", "--quiet", image)
+		cmd.Env = dockerCommandEnv(env)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := runCommand(cmd); err != nil {
+			return "", nil, fmt.Errorf("docker pull %s failed: %w: %s", image, err, strings.TrimSpace(stderr.String()))
+		}
+		digests, err := imageRepoDigests(ctx, []string{image})
+		if err != nil {
+			return "", nil, err
+		}
+		digest := pickRepoDigest(image, digests[image])
+		if digest == "" {
+			return "", nil, fmt.Errorf("image %s has no repo digest to pin", image)
+		}
+		resolved[image] = digest
+	}
+
+	type serviceSection struct {
+		Image string `yaml:"image"`
+	}
+	override := struct {
+		Services map[string]serviceSection `yaml:"services"`
+	}{Services: make(map[string]serviceSection)}
+	images := make([]ImageDigest, 0, len(names))
+	for _, name := range names {
+		image := services[name].Image
+		override.Services[name] = serviceSection{Image: resolved[image]}
+		images = append(images, ImageDigest{Service: name, Image: image, Digest: resolved[image]})
+	}
+
+	path, err := writeComposeOverride("stevedore-digests-*.yaml", override)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, images, nil
+}
@@ -0,0 +1,124 @@
+package stevedore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPickRepoDigest(t *testing.T) {
+	digests := []string{"mirror.local/nginx@sha256:111", "nginx@sha256:222"}
+	tests := []struct {
+		image   string
+		digests []string
+		want    string
+	}{
+		{"nginx:latest", digests, "nginx@sha256:222"},
+		{"nginx", digests, "nginx@sha256:222"},
+		{"mirror.local/nginx:1.27", digests, "mirror.local/nginx@sha256:111"},
+		{"localhost:5000/app", []string{"localhost:5000/app@sha256:333"}, "localhost:5000/app@sha256:333"},
+		// Another name of the same image falls back to its first digest
+		{"docker.io/library/nginx:latest", digests, "mirror.local/nginx@sha256:111"},
+		// Locally built images have none
+		{"app:dev", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := pickRepoDigest(tt.image, tt.digests); got != tt.want {
+			t.Errorf("pickRepoDigest(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+// fakeDockerImages puts a docker binary on PATH that resolves compose config,
+// pulls into pulls.log and reports a repo digest for every image but app:dev.
+func fakeDockerImages(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	script := `#!/bin/sh
+case "$1" in
+compose)
+  case "$*" in
+  *version*) echo 2.29.1 ;;
+  *config*) echo '{"services":{"web":{"image":"nginx:latest"},"cache":{"image":"nginx:latest"},"api":{"image":"app:dev","build":{"context":"."}},"db":{"image":"localhost:5000/pg:16"}}}' ;;
+  esac
+  ;;
+pull) echo "$3" >> PULLS_LOG ;;
+image)
+  shift 4
+  for image; do
+    case "$image" in
+    app:dev|sha256:dev) echo '[]' ;;
+    sha256:*) echo '["nginx@sha256:aaa"]' ;;
+    nginx:latest) echo '["nginx@sha256:ngi"]' ;;
+    *) echo "[\"${image%:*}@sha256:loc\"]" ;;
+    esac
+  done
+  ;;
+esac
+`
+	script = strings.ReplaceAll(script, "PULLS_LOG", filepath.Join(bin, "pulls.log"))
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	t.Setenv("STEVEDORE_DOCKER_BIN", "")
+	t.Cleanup(func() { detectedComposeCLI = nil })
+	return bin
+}
+
+func TestPinImageDigests(t *testing.T) {
+	bin := fakeDockerImages(t)
+	instance := NewInstance(t.TempDir())
+	gitDir := t.TempDir()
+
+	override, images, err := instance.pinImageDigests(context.Background(), []string{filepath.Join(gitDir, "docker-compose.yaml")}, "stevedore-app", gitDir, nil)
+	if err != nil {
+		t.Fatalf("pinImageDigests: %v", err)
+	}
+	defer func() { _ = os.Remove(override) }()
+
+	// The built service keeps its image; nginx is pulled once
+	want := []ImageDigest{
+		{Service: "cache", Image: "nginx:latest", Digest: "nginx@sha256:ngi"},
+		{Service: "db", Image: "localhost:5000/pg:16", Digest: "localhost:5000/pg@sha256:loc"},
+		{Service: "web", Image: "nginx:latest", Digest: "nginx@sha256:ngi"},
+	}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("images = %+v, want %+v", images, want)
+	}
+	pulls, err := os.ReadFile(filepath.Join(bin, "pulls.log"))
+	if err != nil || string(pulls) != "nginx:latest\nlocalhost:5000/pg:16\n" {
+		t.Errorf("pulls = %q, %v", pulls, err)
+	}
+
+	data, err := os.ReadFile(override)
+	if err != nil {
+		t.Fatalf("read override: %v", err)
+	}
+	for _, line := range []string{"web:\n        image: nginx@sha256:ngi", "db:\n        image: localhost:5000/pg@sha256:loc"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("override missing %q:\n%s", line, data)
+		}
+	}
+	if strings.Contains(string(data), "api") {
+		t.Errorf("override must leave the built service alone:\n%s", data)
+	}
+}
+
+func TestAddImageDigests(t *testing.T) {
+	fakeDockerImages(t)
+	containers := []ContainerStatus{
+		{Service: "web", Image: "nginx:latest", ImageID: "sha256:web"},
+		{Service: "api", Image: "app:dev", ImageID: "sha256:dev"},
+		{Service: "gone"},
+	}
+	addImageDigests(context.Background(), containers)
+
+	got := []string{containers[0].ImageDigest, containers[1].ImageDigest, containers[2].ImageDigest}
+	if want := []string{"nginx@sha256:aaa", "", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("digests = %q, want %q", got, want)
+	}
+}
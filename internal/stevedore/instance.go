@@ -1,11 +1,13 @@
 package stevedore
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strings"
 )
 
 const DefaultRoot = "/opt/stevedore"
@@ -13,6 +15,13 @@ const DefaultRoot = "/opt/stevedore"
 var deploymentNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
 var parameterNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
 
+// reservedDeploymentNames are stevedore's own directories under Root.
+var reservedDeploymentNames = []string{"system", "shared", "deployments"}
+
+// ErrReservedDeploymentName is returned for a new deployment whose name
+// shadows stevedore's own state layout.
+var ErrReservedDeploymentName = errors.New("reserved deployment name")
+
 type Instance struct {
 	Root string
 }
@@ -71,6 +80,27 @@ func ValidateDeploymentName(name string) error {
 	return nil
 }
 
+// ValidateNewDeploymentName checks the name of a deployment about to be
+// created. On top of ValidateDeploymentName it rejects stevedore's reserved
+// names and names of directories that already exist under Root. Existing
+// deployments are not re-checked, so they stay manageable.
+func (i *Instance) ValidateNewDeploymentName(name string) error {
+	if err := ValidateDeploymentName(name); err != nil {
+		return err
+	}
+	for _, reserved := range reservedDeploymentNames {
+		if strings.EqualFold(name, reserved) {
+			return fmt.Errorf("%w: %q is stevedore's own %s directory, choose another name",
+				ErrReservedDeploymentName, name, filepath.Join(i.Root, reserved))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(i.Root, name)); err == nil {
+		return fmt.Errorf("%w: %q collides with the existing %s, choose another name",
+			ErrReservedDeploymentName, name, filepath.Join(i.Root, name))
+	}
+	return nil
+}
+
 func ValidateParameterName(name string) error {
 	if !parameterNameRe.MatchString(name) {
 		return fmt.Errorf("invalid parameter name: %q", name)
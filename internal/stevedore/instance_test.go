@@ -0,0 +1,47 @@
+package stevedore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateNewDeploymentName(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(instance.Root, "backups"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	for _, name := range []string{"system", "shared", "deployments", "System", "backups"} {
+		err := instance.ValidateNewDeploymentName(name)
+		if !errors.Is(err, ErrReservedDeploymentName) {
+			t.Errorf("ValidateNewDeploymentName(%q) = %v, want ErrReservedDeploymentName", name, err)
+		}
+	}
+
+	for _, name := range []string{"app", "systemd", "shared-db", "stevedore"} {
+		if err := instance.ValidateNewDeploymentName(name); err != nil {
+			t.Errorf("ValidateNewDeploymentName(%q) = %v, want nil", name, err)
+		}
+	}
+
+	if err := instance.ValidateNewDeploymentName("../app"); err == nil || errors.Is(err, ErrReservedDeploymentName) {
+		t.Errorf("ValidateNewDeploymentName(../app) = %v, want an invalid name error", err)
+	}
+}
+
+func TestAddRepo_RejectsReservedName(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+
+	if _, err := instance.AddRepo("system", RepoSpec{URL: "git@github.com:acme/system.git"}); !errors.Is(err, ErrReservedDeploymentName) {
+		t.Fatalf("AddRepo(system) = %v, want ErrReservedDeploymentName", err)
+	}
+	if _, err := os.Stat(instance.DeploymentDir("system")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("deployment directory should not be created, stat: %v", err)
+	}
+}
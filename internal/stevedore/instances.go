@@ -0,0 +1,197 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// LabelStevedoreRole tells stevedore's own containers apart: the daemon is
+// labeled DaemonContainerRole, workers and hooks have their own roles.
+const (
+	LabelStevedoreRole  = "com.stevedore.role"
+	DaemonContainerRole = "daemon"
+)
+
+// daemonAPIPort is the container port the daemon API listens on by default.
+const daemonAPIPort = "42107/tcp"
+
+// DaemonContainer is a stevedore daemon container found on the docker
+// engine, with the settings that must differ between instances sharing it.
+type DaemonContainer struct {
+	ID    string
+	Name  string
+	Image string
+	// Self is the container of this instance (DaemonContainerName)
+	Self bool
+	// ProjectPrefix is its STEVEDORE_PROJECT_PREFIX, or the default
+	ProjectPrefix string
+	// HostPorts are the host ports its API port is published on
+	HostPorts []string
+	// QuerySocketDir and StateDir are the host directories mounted at the
+	// query socket directory and at STEVEDORE_ROOT
+	QuerySocketDir string
+	StateDir       string
+}
+
+// String names the container in doctor output.
+func (c DaemonContainer) String() string {
+	if c.Self {
+		return c.Name + " (this instance)"
+	}
+	return c.Name
+}
+
+// daemonInspect is the part of `docker inspect` DaemonContainer is built from.
+type daemonInspect struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+	} `json:"NetworkSettings"`
+	Mounts []struct {
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+}
+
+// FindDaemonContainers lists the running stevedore daemon containers on the
+// docker engine, this instance's included. Besides the daemon role label,
+// which older installs lack, a container counts when it publishes the API
+// port or mounts the query socket directory read-write; services that were
+// given query socket access mount it read-only.
+func (i *Instance) FindDaemonContainers(ctx context.Context) ([]DaemonContainer, error) {
+	seen := map[string]bool{}
+	var ids []string
+	for _, filter := range []string{
+		"label=" + LabelStevedoreRole + "=" + DaemonContainerRole,
+		"publish=" + daemonAPIPort,
+		"volume=" + filepath.Dir(DefaultQuerySocketPath),
+	} {
+		cmd := newDockerCommand(ctx, "ps", "-q", "--no-trunc", "--filter", filter)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := runCommand(cmd); err != nil {
+			return nil, fmt.Errorf("failed to list containers: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		for _, id := range strings.Fields(stdout.String()) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cmd := newDockerCommand(ctx, append([]string{"inspect"}, ids...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("docker inspect failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseDaemonContainers(stdout.Bytes(), i.DaemonContainerName())
+}
+
+// parseDaemonContainers builds the daemon containers from `docker inspect`
+// output, dropping containers that only matched the query socket filter
+// through a read-only mount.
+func parseDaemonContainers(data []byte, selfName string) ([]DaemonContainer, error) {
+	var results []daemonInspect
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse docker inspect output: %w", err)
+	}
+
+	socketDir := filepath.Dir(DefaultQuerySocketPath)
+	var containers []DaemonContainer
+	for _, r := range results {
+		env := map[string]string{}
+		for _, kv := range r.Config.Env {
+			if name, value, ok := strings.Cut(kv, "="); ok {
+				env[name] = value
+			}
+		}
+		stateRoot := env["STEVEDORE_ROOT"]
+		if stateRoot == "" {
+			stateRoot = "/opt/stevedore"
+		}
+		prefix := env[ProjectPrefixEnvVar]
+		if prefix == "" || ValidateProjectPrefix(prefix) != nil {
+			prefix = DefaultProjectPrefix
+		}
+
+		c := DaemonContainer{
+			ID:            shortCID(r.ID),
+			Name:          strings.TrimPrefix(r.Name, "/"),
+			Image:         r.Config.Image,
+			ProjectPrefix: prefix,
+		}
+		c.Self = c.Name == selfName
+		for _, binding := range r.NetworkSettings.Ports[daemonAPIPort] {
+			if binding.HostPort != "" && !slices.Contains(c.HostPorts, binding.HostPort) {
+				c.HostPorts = append(c.HostPorts, binding.HostPort)
+			}
+		}
+		sort.Strings(c.HostPorts)
+		for _, m := range r.Mounts {
+			switch {
+			case m.Destination == socketDir && m.RW:
+				c.QuerySocketDir = m.Source
+			case m.Destination == stateRoot:
+				c.StateDir = m.Source
+			}
+		}
+
+		if r.Config.Labels[LabelStevedoreRole] != DaemonContainerRole && len(c.HostPorts) == 0 && c.QuerySocketDir == "" {
+			continue
+		}
+		containers = append(containers, c)
+	}
+	sort.Slice(containers, func(a, b int) bool { return containers[a].Name < containers[b].Name })
+	return containers, nil
+}
+
+// DaemonConflicts describes the settings two daemon containers share and
+// must not: a published API port, overlapping compose project prefixes
+// (each would treat the other's containers as its own), the query socket
+// directory (each replaces the other's socket) and the state directory.
+func DaemonConflicts(containers []DaemonContainer) []string {
+	var conflicts []string
+	for a := 0; a < len(containers); a++ {
+		for b := a + 1; b < len(containers); b++ {
+			x, y := containers[a], containers[b]
+			for _, port := range x.HostPorts {
+				if slices.Contains(y.HostPorts, port) {
+					conflicts = append(conflicts, fmt.Sprintf("%s and %s both publish API port %s", x, y, port))
+				}
+			}
+			if strings.HasPrefix(x.ProjectPrefix, y.ProjectPrefix) || strings.HasPrefix(y.ProjectPrefix, x.ProjectPrefix) {
+				conflicts = append(conflicts, fmt.Sprintf("%s and %s manage overlapping compose project prefixes %q and %q (set %s)",
+					x, y, x.ProjectPrefix, y.ProjectPrefix, ProjectPrefixEnvVar))
+			}
+			if x.QuerySocketDir != "" && x.QuerySocketDir == y.QuerySocketDir {
+				conflicts = append(conflicts, fmt.Sprintf("%s and %s share the query socket directory %s", x, y, x.QuerySocketDir))
+			}
+			if x.StateDir != "" && x.StateDir == y.StateDir {
+				conflicts = append(conflicts, fmt.Sprintf("%s and %s share the state directory %s", x, y, x.StateDir))
+			}
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,66 @@
+package stevedore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDaemonContainers(t *testing.T) {
+	inspect := `[
+	{"Id": "aaaaaaaaaaaaaaaa", "Name": "/stevedore",
+	 "Config": {"Image": "stevedore:latest", "Env": ["STEVEDORE_ROOT=/opt/stevedore"], "Labels": {"com.stevedore.role": "daemon"}},
+	 "NetworkSettings": {"Ports": {"42107/tcp": [{"HostIp": "0.0.0.0", "HostPort": "42107"}, {"HostIp": "::", "HostPort": "42107"}]}},
+	 "Mounts": [
+	  {"Source": "/var/run/stevedore", "Destination": "/var/run/stevedore", "RW": true},
+	  {"Source": "/opt/stevedore", "Destination": "/opt/stevedore", "RW": true}]},
+	{"Id": "bbbbbbbbbbbbbbbb", "Name": "/stevedore-old",
+	 "Config": {"Image": "stevedore:backup-1", "Env": ["STEVEDORE_PROJECT_PREFIX=stevedore-old-"], "Labels": {}},
+	 "NetworkSettings": {"Ports": {}},
+	 "Mounts": [{"Source": "/var/run/stevedore", "Destination": "/var/run/stevedore", "RW": true}]},
+	{"Id": "cccccccccccccccc", "Name": "/stevedore-app-web-1",
+	 "Config": {"Image": "nginx", "Env": [], "Labels": {"com.docker.compose.project": "stevedore-app"}},
+	 "NetworkSettings": {"Ports": {}},
+	 "Mounts": [{"Source": "/var/run/stevedore", "Destination": "/var/run/stevedore", "RW": false}]}
+	]`
+
+	got, err := parseDaemonContainers([]byte(inspect), "stevedore")
+	if err != nil {
+		t.Fatalf("parseDaemonContainers: %v", err)
+	}
+	// The service with read-only query socket access is not a daemon
+	want := []DaemonContainer{
+		{ID: "aaaaaaaaaaaa", Name: "stevedore", Image: "stevedore:latest", Self: true, ProjectPrefix: "stevedore-",
+			HostPorts: []string{"42107"}, QuerySocketDir: "/var/run/stevedore", StateDir: "/opt/stevedore"},
+		{ID: "bbbbbbbbbbbb", Name: "stevedore-old", Image: "stevedore:backup-1", ProjectPrefix: "stevedore-old-",
+			QuerySocketDir: "/var/run/stevedore"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDaemonContainers =\n%+v\nwant\n%+v", got, want)
+	}
+
+	conflicts := DaemonConflicts(got)
+	if len(conflicts) != 2 ||
+		!strings.Contains(conflicts[0], `stevedore (this instance) and stevedore-old manage overlapping compose project prefixes "stevedore-" and "stevedore-old-"`) ||
+		!strings.Contains(conflicts[1], "share the query socket directory /var/run/stevedore") {
+		t.Errorf("DaemonConflicts = %q", conflicts)
+	}
+}
+
+func TestDaemonConflicts_IsolatedInstances(t *testing.T) {
+	containers := []DaemonContainer{
+		{Name: "blue", ProjectPrefix: "blue-", HostPorts: []string{"42107"}, QuerySocketDir: "/var/run/stevedore-blue", StateDir: "/opt/blue"},
+		{Name: "green", ProjectPrefix: "green-", HostPorts: []string{"42108"}, QuerySocketDir: "/var/run/stevedore-green", StateDir: "/opt/green"},
+	}
+	if conflicts := DaemonConflicts(containers); len(conflicts) != 0 {
+		t.Errorf("DaemonConflicts = %q, want none", conflicts)
+	}
+
+	containers[1].HostPorts = []string{"42107"}
+	containers[1].StateDir = "/opt/blue"
+	conflicts := DaemonConflicts(containers)
+	want := []string{"blue and green both publish API port 42107", "blue and green share the state directory /opt/blue"}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("DaemonConflicts = %q, want %q", conflicts, want)
+	}
+}
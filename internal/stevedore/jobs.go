@@ -0,0 +1,210 @@
+package stevedore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobStatus is the state of an asynchronous deploy job.
+type JobStatus string
+
+const (
+	// JobQueued is a job waiting for a deploy slot.
+	JobQueued JobStatus = "queued"
+	// JobRunning is a job whose deploy is in progress.
+	JobRunning JobStatus = "running"
+	// JobSucceeded is a job whose deploy finished.
+	JobSucceeded JobStatus = "succeeded"
+	// JobFailed is a job whose deploy failed.
+	JobFailed JobStatus = "failed"
+)
+
+// Done reports whether the job has finished, successfully or not.
+func (s JobStatus) Done() bool {
+	return s == JobSucceeded || s == JobFailed
+}
+
+// maxRetainedJobs is how many finished jobs the daemon remembers; older
+// ones are dropped as new jobs are started.
+const maxRetainedJobs = 100
+
+// DeployJob is an asynchronous deploy started with
+// POST /api/deploy/{name}?async=true and reported by GET /api/jobs/{id}.
+type DeployJob struct {
+	ID         string     `json:"id"`
+	Deployment string     `json:"deployment"`
+	Status     JobStatus  `json:"status"`
+	Progress   string     `json:"progress"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Result is set when the deploy succeeded, Error and Logs when it failed
+	Result *APIDeployResult `json:"result,omitempty"`
+	Error  string           `json:"error,omitempty"`
+	Logs   []ContainerLog   `json:"logs,omitempty"`
+}
+
+// maxJobOutputLines is how many lines of compose output a job keeps; older
+// lines are dropped first.
+const maxJobOutputLines = 5000
+
+// jobOutput collects the compose output of a deploy job, line by line, for
+// GET /api/jobs/{id}/output. Readers follow it until it is closed.
+type jobOutput struct {
+	mu      sync.Mutex
+	lines   []string
+	dropped int // lines dropped from the front, so line n is lines[n-dropped]
+	partial []byte
+	closed  bool
+	changed chan struct{} // closed and replaced on every change
+}
+
+func newJobOutput() *jobOutput {
+	return &jobOutput{changed: make(chan struct{})}
+}
+
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.partial = append(o.partial, p...)
+	for {
+		end := bytes.IndexByte(o.partial, '\n')
+		if end < 0 {
+			break
+		}
+		// Of a line redrawn with \r, keep what a terminal would show last
+		line := strings.TrimRight(string(o.partial[:end]), "\r")
+		if cr := strings.LastIndexByte(line, '\r'); cr >= 0 {
+			line = line[cr+1:]
+		}
+		o.lines = append(o.lines, line)
+		o.partial = o.partial[end+1:]
+	}
+	if excess := len(o.lines) - maxJobOutputLines; excess > 0 {
+		o.lines = append([]string(nil), o.lines[excess:]...)
+		o.dropped += excess
+	}
+	o.notify()
+	return len(p), nil
+}
+
+// close ends the output once the job has finished.
+func (o *jobOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.partial) > 0 {
+		o.lines = append(o.lines, string(o.partial))
+		o.partial = nil
+	}
+	o.closed = true
+	o.notify()
+}
+
+// notify wakes up the readers waiting for a change; o.mu is held.
+func (o *jobOutput) notify() {
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// read returns the lines from line from on, the number of lines before them
+// that were dropped, the line to read from next time, whether the output is
+// complete, and a channel that is closed on the next change.
+func (o *jobOutput) read(from int) (lines []string, skipped int, next int, closed bool, changed <-chan struct{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if from < o.dropped {
+		skipped = o.dropped - from
+		from = o.dropped
+	}
+	lines = append(lines, o.lines[from-o.dropped:]...)
+	return lines, skipped, o.dropped + len(o.lines), o.closed, o.changed
+}
+
+// jobStore keeps the daemon's deploy jobs in memory; they do not survive a
+// restart.
+type jobStore struct {
+	mu      sync.Mutex
+	jobs    map[string]*DeployJob
+	outputs map[string]*jobOutput
+	order   []string // IDs, oldest first
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{jobs: make(map[string]*DeployJob), outputs: make(map[string]*jobOutput)}
+}
+
+// add registers a queued job for a deployment and returns a copy of it.
+func (js *jobStore) add(deployment string) (DeployJob, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return DeployJob{}, fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	job := &DeployJob{
+		ID:         hex.EncodeToString(bytes),
+		Deployment: deployment,
+		Status:     JobQueued,
+		Progress:   "waiting for a deploy slot",
+		CreatedAt:  time.Now(),
+	}
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.jobs[job.ID] = job
+	js.outputs[job.ID] = newJobOutput()
+	js.order = append(js.order, job.ID)
+	js.prune()
+	return *job, nil
+}
+
+// prune drops the oldest finished jobs beyond maxRetainedJobs. Jobs still
+// queued or running are always kept.
+func (js *jobStore) prune() {
+	excess := len(js.order) - maxRetainedJobs
+	kept := js.order[:0]
+	for _, id := range js.order {
+		if excess > 0 && js.jobs[id].Status.Done() {
+			delete(js.jobs, id)
+			delete(js.outputs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	js.order = kept
+}
+
+// update changes a job under the store's lock.
+func (js *jobStore) update(id string, change func(job *DeployJob)) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if job, ok := js.jobs[id]; ok {
+		change(job)
+	}
+}
+
+// get returns a copy of a job.
+func (js *jobStore) get(id string) (DeployJob, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	job, ok := js.jobs[id]
+	if !ok {
+		return DeployJob{}, false
+	}
+	return *job, true
+}
+
+// output returns the compose output of a job.
+func (js *jobStore) output(id string) (*jobOutput, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	output, ok := js.outputs[id]
+	return output, ok
+}
@@ -0,0 +1,231 @@
+package stevedore
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobStore_PrunesFinishedJobs(t *testing.T) {
+	store := newJobStore()
+
+	running, err := store.add("app")
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	store.update(running.ID, func(j *DeployJob) { j.Status = JobRunning })
+
+	var first DeployJob
+	for n := range maxRetainedJobs {
+		job, err := store.add(fmt.Sprintf("app-%d", n))
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		store.update(job.ID, func(j *DeployJob) { j.Status = JobSucceeded })
+		if n == 0 {
+			first = job
+		}
+	}
+	// Adding the last job dropped the oldest finished one, never the running one
+	if len(store.order) != maxRetainedJobs {
+		t.Errorf("kept %d jobs, want %d", len(store.order), maxRetainedJobs)
+	}
+	if _, ok := store.get(first.ID); ok {
+		t.Error("expected the oldest finished job to be dropped")
+	}
+	if job, ok := store.get(running.ID); !ok || job.Status != JobRunning {
+		t.Errorf("running job = %+v, %v; want it kept", job, ok)
+	}
+}
+
+func TestAPIDeployAsync_ReportsJob(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout failed: %v", err)
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	server := NewServer(instance, db, ServerConfig{
+		AdminKey: "test-admin-key",
+	}, "1.0.0", "test-build")
+	ts := httptest.NewServer(server.server.Handler)
+	defer ts.Close()
+	client := NewClient(ts.URL, "test-admin-key", "1.0.0", "test-build")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	job, err := client.DeployAsync(ctx, "app")
+	if err != nil {
+		t.Fatalf("DeployAsync: %v", err)
+	}
+	if job.ID == "" || job.Deployment != "app" || job.Status.Done() {
+		t.Fatalf("job = %+v, want a pending job for app", job)
+	}
+
+	var seen []JobStatus
+	done, err := client.WaitForJob(ctx, job.ID, 10*time.Millisecond, func(j *DeployJob) {
+		seen = append(seen, j.Status)
+	})
+	if err != nil {
+		t.Fatalf("WaitForJob: %v", err)
+	}
+	// The deployment has no checkout, so the deploy fails
+	if done.Status != JobFailed || done.Error == "" || done.FinishedAt == nil || done.Result != nil {
+		t.Errorf("finished job = %+v, want a failure", done)
+	}
+	if len(seen) == 0 || seen[len(seen)-1] != JobFailed {
+		t.Errorf("progress callbacks = %v, want them to end with failed", seen)
+	}
+
+	if _, err := client.Job(ctx, "missing"); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+}
+
+func TestAPIDeployAsync_CancelQueuedJob(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout failed: %v", err)
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	daemon := NewDaemon(instance, db, DaemonConfig{AdminKey: "test-admin-key", Version: "1.0.0", Build: "test-build"})
+	ts := httptest.NewServer(daemon.server.server.Handler)
+	defer ts.Close()
+	client := NewClient(ts.URL, "test-admin-key", "1.0.0", "test-build")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Take every deploy slot so the job stays queued
+	release, err := deploySlots.acquire(ctx, "test")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	releases := []func(){release}
+	for len(releases) < cap(deploySlots.slots) {
+		release, err := deploySlots.acquire(ctx, "test")
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		releases = append(releases, release)
+	}
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+
+	job, err := client.DeployAsync(ctx, "app")
+	if err != nil {
+		t.Fatalf("DeployAsync: %v", err)
+	}
+	for !daemon.isActive("app") {
+		if ctx.Err() != nil {
+			t.Fatal("queued job was never tracked as an active operation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	result, err := client.Cancel(ctx, "app")
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if !result.Cancelled {
+		t.Error("expected the queued job to be cancelled")
+	}
+
+	done, err := client.WaitForJob(ctx, job.ID, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("WaitForJob: %v", err)
+	}
+	if done.Status != JobFailed || !strings.Contains(done.Error, "cancelled while queued") {
+		t.Errorf("finished job = %+v, want it cancelled while queued", done)
+	}
+	if daemon.isActive("app") {
+		t.Error("expected the cancelled job to no longer be active")
+	}
+}
+
+func TestAPIJobOutput_StreamsUntilDone(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout failed: %v", err)
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	server := NewServer(instance, db, ServerConfig{
+		AdminKey: "test-admin-key",
+	}, "1.0.0", "test-build")
+	ts := httptest.NewServer(server.server.Handler)
+	defer ts.Close()
+	client := NewClient(ts.URL, "test-admin-key", "1.0.0", "test-build")
+
+	job, err := server.jobs.add("app")
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	output, _ := server.jobs.output(job.ID)
+	_, _ = fmt.Fprint(output, "#1 building web\n#2 [1/3] FROM alp")
+
+	// The follower gets the output written before and after it connected
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = fmt.Fprint(output, "ine\n 10%\r 100%\r\n")
+		server.jobs.update(job.ID, func(j *DeployJob) { j.Status = JobSucceeded })
+		output.close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var streamed strings.Builder
+	done, err := client.FollowJobOutput(ctx, job.ID, &streamed)
+	if err != nil {
+		t.Fatalf("FollowJobOutput: %v", err)
+	}
+	if done.ID != job.ID || done.Status != JobSucceeded {
+		t.Errorf("finished job = %+v, want succeeded", done)
+	}
+	if want := "#1 building web\n#2 [1/3] FROM alpine\n 100%\n"; streamed.String() != want {
+		t.Errorf("streamed output = %q, want %q", streamed.String(), want)
+	}
+
+	if _, err := client.FollowJobOutput(ctx, "missing", &streamed); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+}
+
+func TestJobOutput_DropsOldestLines(t *testing.T) {
+	output := newJobOutput()
+	for n := range maxJobOutputLines + 3 {
+		_, _ = fmt.Fprintf(output, "line %d\n", n)
+	}
+
+	lines, skipped, next, closed, _ := output.read(0)
+	if skipped != 3 || len(lines) != maxJobOutputLines || lines[0] != "line 3" || next != maxJobOutputLines+3 || closed {
+		t.Errorf("read(0) = %d lines from %q, skipped %d, next %d, closed %v", len(lines), lines[0], skipped, next, closed)
+	}
+	output.close()
+	if lines, _, _, closed, _ := output.read(next); len(lines) != 0 || !closed {
+		t.Errorf("read after close = %q, closed %v", lines, closed)
+	}
+}
@@ -0,0 +1,56 @@
+package stevedore
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// concurrencyLimiter caps how many operations of one kind run at once. The
+// limit is read from an environment variable on first use and falls back to
+// a default when the variable is unset or not a positive number.
+type concurrencyLimiter struct {
+	envVar       string
+	defaultLimit int
+	// busyFormat is logged with the limit and the name of a caller that has
+	// to wait for a free slot
+	busyFormat string
+
+	once  sync.Once
+	slots chan struct{}
+}
+
+func newConcurrencyLimiter(envVar string, defaultLimit int, busyFormat string) *concurrencyLimiter {
+	return &concurrencyLimiter{envVar: envVar, defaultLimit: defaultLimit, busyFormat: busyFormat}
+}
+
+// limit returns the configured limit.
+func (l *concurrencyLimiter) limit() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(l.envVar))); err == nil && n > 0 {
+		return n
+	}
+	return l.defaultLimit
+}
+
+// acquire blocks until a slot is free or ctx is done. The returned function
+// releases the slot.
+func (l *concurrencyLimiter) acquire(ctx context.Context, name string) (func(), error) {
+	l.once.Do(func() {
+		l.slots = make(chan struct{}, l.limit())
+	})
+
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		log.Printf(l.busyFormat, cap(l.slots), name)
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-l.slots }, nil
+}
@@ -0,0 +1,61 @@
+package stevedore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter_LimitsConcurrency(t *testing.T) {
+	t.Setenv("STEVEDORE_TEST_CONCURRENCY", "3")
+	limiter := newConcurrencyLimiter("STEVEDORE_TEST_CONCURRENCY", 1, "%d busy, %s waits")
+
+	var releases []func()
+	for n := 0; n < 3; n++ {
+		release, err := limiter.acquire(context.Background(), fmt.Sprintf("app%d", n))
+		if err != nil {
+			t.Fatalf("acquire %d: %v", n, err)
+		}
+		releases = append(releases, release)
+	}
+
+	// All slots are taken: the next caller waits until its context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, "overflow"); err == nil {
+		t.Fatal("expected acquire to block while all slots are taken")
+	}
+
+	releases[0]()
+	release, err := limiter.acquire(context.Background(), "overflow")
+	if err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	release()
+	for _, release := range releases[1:] {
+		release()
+	}
+}
+
+func TestConcurrencyLimiter_Limit(t *testing.T) {
+	for _, limiter := range []*concurrencyLimiter{deploySlots, gitWorkers} {
+		t.Setenv(limiter.envVar, "")
+		if got := limiter.limit(); got != limiter.defaultLimit {
+			t.Errorf("%s default = %d, want %d", limiter.envVar, got, limiter.defaultLimit)
+		}
+		t.Setenv(limiter.envVar, "5")
+		if got := limiter.limit(); got != 5 {
+			t.Errorf("%s configured = %d, want 5", limiter.envVar, got)
+		}
+		for _, invalid := range []string{"0", "-1", "many"} {
+			t.Setenv(limiter.envVar, invalid)
+			if got := limiter.limit(); got != limiter.defaultLimit {
+				t.Errorf("%s=%s = %d, want the default", limiter.envVar, invalid, got)
+			}
+		}
+	}
+	if deploySlots.defaultLimit != DefaultMaxConcurrentDeploys || gitWorkers.defaultLimit != DefaultGitWorkerConcurrency {
+		t.Error("limiters do not use their documented defaults")
+	}
+}
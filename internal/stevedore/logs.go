@@ -0,0 +1,219 @@
+package stevedore
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogsOptions controls StreamDeploymentLogs.
+type LogsOptions struct {
+	// Follow keeps streaming new output until ctx is cancelled
+	Follow bool
+	// Since is passed to `docker logs --since` (duration like 10m or a timestamp)
+	Since string
+	// Tail is the number of lines per container to show, or "all"
+	Tail string
+	// Color prefixes each container with a distinct ANSI color
+	Color bool
+}
+
+// logColors cycles through the same palette docker compose uses for service prefixes.
+var logColors = []int{36, 33, 32, 35, 34, 96, 93, 92, 95, 94}
+
+// logLine is a single line read from a container's log stream.
+type logLine struct {
+	source    int
+	timestamp time.Time
+	text      string
+}
+
+// logSource is a container whose logs are being read.
+type logSource struct {
+	id     string
+	prefix string
+	color  int
+}
+
+// ValidateLogsTail checks a --tail value: "all" or a non-negative integer.
+func ValidateLogsTail(tail string) error {
+	if tail == "" || tail == "all" {
+		return nil
+	}
+	if n, err := strconv.Atoi(tail); err != nil || n < 0 {
+		return fmt.Errorf("invalid tail value: %q (expected a number or \"all\")", tail)
+	}
+	return nil
+}
+
+// StreamDeploymentLogs reads the logs of every container of a deployment
+// concurrently and writes them to w, each line prefixed with its container.
+// Without Follow, the lines are merged in timestamp order once all readers
+// finish; with Follow, lines are written as they arrive until ctx is cancelled.
+func (i *Instance) StreamDeploymentLogs(ctx context.Context, deployment string, opts LogsOptions, w io.Writer) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+	if err := ValidateLogsTail(opts.Tail); err != nil {
+		return err
+	}
+
+	projectName := ComposeProjectName(deployment)
+	containers, err := i.listProjectContainers(ctx, projectName)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("no containers found for deployment %s", deployment)
+	}
+
+	sources := logSources(containers, projectName)
+
+	var (
+		mu       sync.Mutex
+		buffered []logLine
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	emit := func(line logLine) {
+		mu.Lock()
+		defer mu.Unlock()
+		if opts.Follow {
+			_, _ = io.WriteString(w, formatLogLine(sources[line.source], line, opts.Color))
+			return
+		}
+		buffered = append(buffered, line)
+	}
+
+	for idx, src := range sources {
+		wg.Add(1)
+		go func(idx int, src logSource) {
+			defer wg.Done()
+			if err := i.readContainerLogs(ctx, idx, src.id, opts, emit); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", strings.TrimSpace(src.prefix), err)
+				}
+				mu.Unlock()
+			}
+		}(idx, src)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		// Interrupted while following: not an error
+		return nil
+	}
+
+	if !opts.Follow {
+		// Each container's lines are already in order; a stable sort keeps
+		// lines with equal timestamps in arrival order.
+		sort.SliceStable(buffered, func(a, b int) bool {
+			return buffered[a].timestamp.Before(buffered[b].timestamp)
+		})
+		for _, line := range buffered {
+			_, _ = io.WriteString(w, formatLogLine(sources[line.source], line, opts.Color))
+		}
+	}
+
+	return firstErr
+}
+
+// readContainerLogs runs `docker logs --timestamps` for one container and
+// passes every line to emit.
+func (i *Instance) readContainerLogs(ctx context.Context, source int, containerID string, opts LogsOptions, emit func(logLine)) error {
+	args := []string{"logs", "--timestamps"}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if opts.Since != "" {
+		args = append(args, "--since", opts.Since)
+	}
+	if opts.Tail != "" {
+		args = append(args, "--tail", opts.Tail)
+	}
+	args = append(args, containerID)
+
+	// docker logs replays the container's stdout and stderr on its own
+	// stdout and stderr; both go through the same pipe and scanner.
+	pr, pw := io.Pipe()
+	cmd := newDockerCommand(ctx, args...)
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := parseTimestampedLogLine(scanner.Text())
+			line.source = source
+			emit(line)
+		}
+		// Drain anything left (e.g. an over-long line) so docker never blocks
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+
+	err := runCommand(cmd)
+	_ = pw.Close()
+	<-done
+
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("docker logs failed: %w", err)
+	}
+	return nil
+}
+
+// parseTimestampedLogLine splits the RFC3339Nano timestamp docker adds with
+// --timestamps from the message. Lines without a timestamp keep the zero time.
+func parseTimestampedLogLine(raw string) logLine {
+	if ts, rest, ok := strings.Cut(raw, " "); ok {
+		if parsed, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return logLine{timestamp: parsed, text: rest}
+		}
+	}
+	return logLine{text: raw}
+}
+
+// logSources assigns each container a padded prefix (service name plus
+// replica number, as in docker compose) and a color.
+func logSources(containers []ContainerStatus, projectName string) []logSource {
+	sources := make([]logSource, len(containers))
+	width := 0
+	for idx, c := range containers {
+		label := strings.TrimPrefix(c.Name, projectName+"-")
+		if label == "" {
+			label = c.Service
+		}
+		if label == "" {
+			label = c.ID
+		}
+		sources[idx] = logSource{id: c.ID, prefix: label, color: logColors[idx%len(logColors)]}
+		if len(label) > width {
+			width = len(label)
+		}
+	}
+	for idx := range sources {
+		sources[idx].prefix = fmt.Sprintf("%-*s", width, sources[idx].prefix)
+	}
+	return sources
+}
+
+func formatLogLine(src logSource, line logLine, color bool) string {
+	prefix := src.prefix + " |"
+	if color {
+		prefix = fmt.Sprintf("\033[%dm%s\033[0m", src.color, prefix)
+	}
+	if line.timestamp.IsZero() {
+		return fmt.Sprintf("%s %s\n", prefix, line.text)
+	}
+	return fmt.Sprintf("%s %s %s\n", prefix, line.timestamp.Format(time.RFC3339), line.text)
+}
@@ -0,0 +1,76 @@
+package stevedore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimestampedLogLine(t *testing.T) {
+	line := parseTimestampedLogLine("2025-01-15T10:30:00.123456789Z GET /healthz 200")
+	want := time.Date(2025, 1, 15, 10, 30, 0, 123456789, time.UTC)
+	if !line.timestamp.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", line.timestamp, want)
+	}
+	if line.text != "GET /healthz 200" {
+		t.Errorf("text = %q", line.text)
+	}
+
+	plain := parseTimestampedLogLine("no timestamp here")
+	if !plain.timestamp.IsZero() || plain.text != "no timestamp here" {
+		t.Errorf("unexpected parse of plain line: %+v", plain)
+	}
+}
+
+func TestLogSources_PrefixesAndColors(t *testing.T) {
+	containers := []ContainerStatus{
+		{ID: "aaa", Name: "stevedore-app-web-1", Service: "web"},
+		{ID: "bbb", Name: "stevedore-app-worker-1", Service: "worker"},
+		{ID: "ccc", Service: "db"},
+	}
+	sources := logSources(containers, "stevedore-app")
+
+	wantPrefixes := []string{"web-1   ", "worker-1", "db      "}
+	for idx, want := range wantPrefixes {
+		if sources[idx].prefix != want {
+			t.Errorf("prefix[%d] = %q, want %q", idx, sources[idx].prefix, want)
+		}
+		if sources[idx].id != containers[idx].ID {
+			t.Errorf("id[%d] = %q", idx, sources[idx].id)
+		}
+	}
+	if sources[0].color == sources[1].color {
+		t.Error("expected distinct colors for different containers")
+	}
+}
+
+func TestFormatLogLine(t *testing.T) {
+	src := logSource{prefix: "web-1", color: 36}
+	line := logLine{timestamp: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC), text: "hello"}
+
+	if got := formatLogLine(src, line, false); got != "web-1 | 2025-01-15T10:30:00Z hello\n" {
+		t.Errorf("formatLogLine = %q", got)
+	}
+
+	colored := formatLogLine(src, line, true)
+	if !strings.HasPrefix(colored, "\033[36mweb-1 |\033[0m") {
+		t.Errorf("expected colored prefix, got %q", colored)
+	}
+
+	if got := formatLogLine(src, logLine{text: "raw"}, false); got != "web-1 | raw\n" {
+		t.Errorf("formatLogLine without timestamp = %q", got)
+	}
+}
+
+func TestValidateLogsTail(t *testing.T) {
+	for _, valid := range []string{"", "all", "0", "100"} {
+		if err := ValidateLogsTail(valid); err != nil {
+			t.Errorf("ValidateLogsTail(%q) unexpected error: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"-1", "ten", "1.5"} {
+		if err := ValidateLogsTail(invalid); err == nil {
+			t.Errorf("ValidateLogsTail(%q) expected error", invalid)
+		}
+	}
+}
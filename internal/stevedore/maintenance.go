@@ -0,0 +1,69 @@
+package stevedore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaintenanceState is an active maintenance window. While it lasts the daemon
+// does not sync or deploy on its own; manual commands still work.
+type MaintenanceState struct {
+	Since time.Time
+	// Until is when the window ends by itself; zero means until turned off.
+	Until time.Time
+}
+
+// GetMaintenance returns the active maintenance window, or nil when automatic
+// deploys are allowed. A window whose Until has passed counts as ended.
+func (i *Instance) GetMaintenance(db *sql.DB) (*MaintenanceState, error) {
+	var startedAt int64
+	var endsAt sql.NullInt64
+	err := db.QueryRow(`SELECT started_at, ends_at FROM maintenance WHERE id = 1`).Scan(&startedAt, &endsAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := MaintenanceState{Since: time.Unix(startedAt, 0)}
+	if endsAt.Valid {
+		state.Until = time.Unix(endsAt.Int64, 0)
+		if !time.Now().Before(state.Until) {
+			return nil, nil
+		}
+	}
+	return &state, nil
+}
+
+// SetMaintenance starts a maintenance window that lasts until until, or until
+// ClearMaintenance when until is zero. Turning it on while a window is active
+// keeps its start and replaces the end time.
+func (i *Instance) SetMaintenance(db *sql.DB, until time.Time) error {
+	now := time.Now()
+	var endsAt sql.NullInt64
+	if !until.IsZero() {
+		if !until.After(now) {
+			return fmt.Errorf("maintenance end %s is in the past", until.Format(time.RFC3339))
+		}
+		endsAt = sql.NullInt64{Int64: until.Unix(), Valid: true}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO maintenance (id, started_at, ends_at)
+		VALUES (1, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			started_at = CASE WHEN ends_at IS NOT NULL AND ends_at <= excluded.started_at
+				THEN excluded.started_at ELSE started_at END,
+			ends_at = excluded.ends_at
+	`, now.Unix(), endsAt)
+	return err
+}
+
+// ClearMaintenance ends the maintenance window, if any.
+func (i *Instance) ClearMaintenance(db *sql.DB) error {
+	_, err := db.Exec(`DELETE FROM maintenance WHERE id = 1`)
+	return err
+}
@@ -0,0 +1,98 @@
+package stevedore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenance_SetGetClear(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if state, err := instance.GetMaintenance(db); err != nil || state != nil {
+		t.Fatalf("GetMaintenance() = %v, %v; want nil, nil", state, err)
+	}
+
+	if err := instance.SetMaintenance(db, time.Time{}); err != nil {
+		t.Fatalf("SetMaintenance: %v", err)
+	}
+	state, err := instance.GetMaintenance(db)
+	if err != nil || state == nil {
+		t.Fatalf("GetMaintenance() = %v, %v; want active window", state, err)
+	}
+	if !state.Until.IsZero() {
+		t.Errorf("Until = %v, want zero", state.Until)
+	}
+	since := state.Since
+
+	// Setting an end keeps the start of the running window
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := instance.SetMaintenance(db, until); err != nil {
+		t.Fatalf("SetMaintenance(until): %v", err)
+	}
+	state, err = instance.GetMaintenance(db)
+	if err != nil || state == nil {
+		t.Fatalf("GetMaintenance() = %v, %v; want active window", state, err)
+	}
+	if !state.Until.Equal(until) || !state.Since.Equal(since) {
+		t.Errorf("state = %+v, want since %v until %v", state, since, until)
+	}
+
+	if err := instance.SetMaintenance(db, time.Now().Add(-time.Minute)); err == nil {
+		t.Error("SetMaintenance with a past end should fail")
+	}
+
+	if err := instance.ClearMaintenance(db); err != nil {
+		t.Fatalf("ClearMaintenance: %v", err)
+	}
+	if state, err := instance.GetMaintenance(db); err != nil || state != nil {
+		t.Fatalf("GetMaintenance() after clear = %v, %v; want nil, nil", state, err)
+	}
+}
+
+func TestMaintenance_ExpiresAtUntil(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	past := time.Now().Add(-time.Hour)
+	if _, err := db.Exec(`INSERT INTO maintenance (id, started_at, ends_at) VALUES (1, ?, ?)`,
+		past.Add(-time.Hour).Unix(), past.Unix()); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if state, err := instance.GetMaintenance(db); err != nil || state != nil {
+		t.Fatalf("GetMaintenance() = %v, %v; want expired window to be inactive", state, err)
+	}
+
+	// A new window after an expired one starts now
+	if err := instance.SetMaintenance(db, time.Time{}); err != nil {
+		t.Fatalf("SetMaintenance: %v", err)
+	}
+	state, err := instance.GetMaintenance(db)
+	if err != nil || state == nil {
+		t.Fatalf("GetMaintenance() = %v, %v; want active window", state, err)
+	}
+	if state.Since.Before(past) {
+		t.Errorf("Since = %v, want the new window's start", state.Since)
+	}
+
+	d := NewDaemon(instance, db, DaemonConfig{})
+	if !d.maintenancePaused() {
+		t.Error("maintenancePaused() = false during a maintenance window")
+	}
+	if err := instance.ClearMaintenance(db); err != nil {
+		t.Fatalf("ClearMaintenance: %v", err)
+	}
+	if d.maintenancePaused() {
+		t.Error("maintenancePaused() = true after the window ended")
+	}
+}
@@ -0,0 +1,66 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// NotifyWebhookEnvVar configures the URL that daemon notifications are POSTed to.
+const NotifyWebhookEnvVar = "STEVEDORE_NOTIFY_WEBHOOK_URL"
+
+// Notifier POSTs events as JSON to a webhook. A Notifier without a URL
+// discards everything, so callers never need to check whether one is configured.
+type Notifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewNotifier returns a notifier for url; an empty url disables notifications.
+func NewNotifier(url string) *Notifier {
+	return &Notifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled reports whether a webhook URL is configured.
+func (n *Notifier) Enabled() bool {
+	return n != nil && n.url != ""
+}
+
+// Send delivers event to the webhook. Non-2xx responses are errors.
+func (n *Notifier) Send(ctx context.Context, event Event) error {
+	if !n.Enabled() {
+		return nil
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "stevedore")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notify webhook: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify webhook: unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package stevedore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotifier_Send(t *testing.T) {
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	event := Event{Type: EventDeploymentCrashLoop, Deployment: "app", Details: map[string]string{"restarts": "6"}}
+	if err := NewNotifier(server.URL).Send(context.Background(), event); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if received.Type != EventDeploymentCrashLoop || received.Deployment != "app" || received.Details["restarts"] != "6" {
+		t.Errorf("unexpected event: %+v", received)
+	}
+	if received.Timestamp.IsZero() {
+		t.Error("expected timestamp to be set")
+	}
+}
+
+func TestNotifier_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := NewNotifier(server.URL).Send(context.Background(), Event{Type: EventDeploymentCrashLoop}); err == nil {
+		t.Error("expected error for 500 response")
+	}
+	if err := NewNotifier("").Send(context.Background(), Event{}); err != nil {
+		t.Errorf("disabled notifier returned %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package stevedore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ParameterHistoryLimit is how many previous values are kept per parameter.
+const ParameterHistoryLimit = 10
+
+// ParameterVersion is a previous value of a parameter. Like parameters, the
+// history lives in the encrypted database.
+type ParameterVersion struct {
+	ID    int64
+	Value []byte
+	// SetAt is when the value was set, ReplacedAt when it was overwritten
+	SetAt      time.Time
+	ReplacedAt time.Time
+}
+
+// Fingerprint identifies the value without revealing it.
+func (v ParameterVersion) Fingerprint() string {
+	sum := sha256.Sum256(v.Value)
+	return fmt.Sprintf("sha256:%x", sum[:6])
+}
+
+// recordParameterHistory saves the current value of a parameter before it is
+// replaced by value, and trims the history to ParameterHistoryLimit entries.
+// Setting the same value again records nothing.
+func recordParameterHistory(tx *sql.Tx, scope string, name string, value []byte) error {
+	var current []byte
+	var updatedAt int64
+	err := tx.QueryRow(`SELECT value, updated_at FROM parameters WHERE deployment = ? AND name = ?;`, scope, name).Scan(&current, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, value) {
+		return nil
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO parameter_history (deployment, name, value, set_at, replaced_at)
+		 VALUES (?, ?, ?, ?, CAST(strftime('%s','now') AS INTEGER));`,
+		scope, name, current, updatedAt,
+	); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`DELETE FROM parameter_history
+		 WHERE deployment = ? AND name = ? AND id NOT IN (
+			SELECT id FROM parameter_history WHERE deployment = ? AND name = ? ORDER BY id DESC LIMIT ?
+		 );`,
+		scope, name, scope, name, ParameterHistoryLimit,
+	)
+	return err
+}
+
+// ParameterHistory returns the previous values of a deployment parameter, newest first.
+func (i *Instance) ParameterHistory(deployment string, name string) ([]ParameterVersion, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+	if err := ValidateParameterName(name); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(i.DeploymentDir(deployment)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("deployment not found: %s (run: stevedore repo add ...)", deployment)
+		}
+		return nil, err
+	}
+
+	return i.parameterHistory(deployment, name)
+}
+
+// GlobalParameterHistory returns the previous values of a global parameter, newest first.
+func (i *Instance) GlobalParameterHistory(name string) ([]ParameterVersion, error) {
+	if err := ValidateParameterName(name); err != nil {
+		return nil, err
+	}
+	return i.parameterHistory(GlobalParameterScope, name)
+}
+
+// ProfileParameterHistory returns the previous values of a profile parameter, newest first.
+func (i *Instance) ProfileParameterHistory(profile string, name string) ([]ParameterVersion, error) {
+	if err := ValidateProfileName(profile); err != nil {
+		return nil, err
+	}
+	if err := ValidateParameterName(name); err != nil {
+		return nil, err
+	}
+	return i.parameterHistory(ProfileParameterScope(profile), name)
+}
+
+func (i *Instance) parameterHistory(scope string, name string) ([]ParameterVersion, error) {
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	rows, err := db.Query(
+		`SELECT id, value, set_at, replaced_at FROM parameter_history
+		 WHERE deployment = ? AND name = ? ORDER BY id DESC;`,
+		scope, name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var versions []ParameterVersion
+	for rows.Next() {
+		var v ParameterVersion
+		var setAt, replacedAt int64
+		if err := rows.Scan(&v.ID, &v.Value, &setAt, &replacedAt); err != nil {
+			return nil, err
+		}
+		v.SetAt = time.Unix(setAt, 0)
+		v.ReplacedAt = time.Unix(replacedAt, 0)
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// RollbackParameter restores the previous value of a deployment parameter and
+// returns the restored version. The restored entry is taken off the history,
+// so repeated rollbacks walk further back.
+func (i *Instance) RollbackParameter(deployment string, name string) (*ParameterVersion, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+	if err := ValidateParameterName(name); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(i.DeploymentDir(deployment)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("deployment not found: %s (run: stevedore repo add ...)", deployment)
+		}
+		return nil, err
+	}
+
+	return i.rollbackParameter(deployment, name)
+}
+
+// RollbackGlobalParameter restores the previous value of a global parameter.
+func (i *Instance) RollbackGlobalParameter(name string) (*ParameterVersion, error) {
+	if err := ValidateParameterName(name); err != nil {
+		return nil, err
+	}
+	return i.rollbackParameter(GlobalParameterScope, name)
+}
+
+// RollbackProfileParameter restores the previous value of a profile parameter.
+func (i *Instance) RollbackProfileParameter(profile string, name string) (*ParameterVersion, error) {
+	if err := ValidateProfileName(profile); err != nil {
+		return nil, err
+	}
+	if err := ValidateParameterName(name); err != nil {
+		return nil, err
+	}
+	return i.rollbackParameter(ProfileParameterScope(profile), name)
+}
+
+func (i *Instance) rollbackParameter(scope string, name string) (*ParameterVersion, error) {
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var v ParameterVersion
+	var setAt, replacedAt int64
+	err = tx.QueryRow(
+		`SELECT id, value, set_at, replaced_at FROM parameter_history
+		 WHERE deployment = ? AND name = ? ORDER BY id DESC LIMIT 1;`,
+		scope, name,
+	).Scan(&v.ID, &v.Value, &setAt, &replacedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no previous value for parameter %s/%s", scope, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.SetAt = time.Unix(setAt, 0)
+	v.ReplacedAt = time.Unix(replacedAt, 0)
+
+	if _, err := tx.Exec(
+		`INSERT INTO parameters (deployment, name, value, updated_at)
+		 VALUES (?, ?, ?, CAST(strftime('%s','now') AS INTEGER))
+		 ON CONFLICT(deployment, name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at;`,
+		scope, name, v.Value,
+	); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM parameter_history WHERE id = ?;`, v.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
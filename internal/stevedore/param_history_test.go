@@ -0,0 +1,82 @@
+package stevedore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParameterHistory_RecordsAndRollsBack(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout: %v", err)
+	}
+	setupDeployment(t, instance, "testapp")
+
+	for _, value := range []string{"v1", "v2", "v2", "typo"} {
+		if err := instance.SetParameter("testapp", "API_KEY", []byte(value)); err != nil {
+			t.Fatalf("SetParameter %s: %v", value, err)
+		}
+	}
+
+	// Setting the same value again records nothing
+	history, err := instance.ParameterHistory("testapp", "API_KEY")
+	if err != nil {
+		t.Fatalf("ParameterHistory: %v", err)
+	}
+	if len(history) != 2 || string(history[0].Value) != "v2" || string(history[1].Value) != "v1" {
+		t.Fatalf("history = %+v, want [v2 v1]", history)
+	}
+
+	restored, err := instance.RollbackParameter("testapp", "API_KEY")
+	if err != nil {
+		t.Fatalf("RollbackParameter: %v", err)
+	}
+	if string(restored.Value) != "v2" {
+		t.Errorf("restored = %q, want v2", restored.Value)
+	}
+	if value, _ := instance.GetParameter("testapp", "API_KEY"); string(value) != "v2" {
+		t.Errorf("GetParameter after rollback = %q, want v2", value)
+	}
+
+	// Rolling back again walks further back, until the history is empty
+	if _, err := instance.RollbackParameter("testapp", "API_KEY"); err != nil {
+		t.Fatalf("second RollbackParameter: %v", err)
+	}
+	if value, _ := instance.GetParameter("testapp", "API_KEY"); string(value) != "v1" {
+		t.Errorf("GetParameter after second rollback = %q, want v1", value)
+	}
+	if _, err := instance.RollbackParameter("testapp", "API_KEY"); err == nil {
+		t.Error("expected error when no previous value is left")
+	}
+}
+
+func TestParameterHistory_Bounded(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout: %v", err)
+	}
+
+	for n := 0; n < ParameterHistoryLimit+5; n++ {
+		if err := instance.SetGlobalParameter("SMTP_HOST", []byte(fmt.Sprintf("smtp%d", n))); err != nil {
+			t.Fatalf("SetGlobalParameter: %v", err)
+		}
+	}
+
+	history, err := instance.GlobalParameterHistory("SMTP_HOST")
+	if err != nil {
+		t.Fatalf("GlobalParameterHistory: %v", err)
+	}
+	if len(history) != ParameterHistoryLimit {
+		t.Fatalf("len(history) = %d, want %d", len(history), ParameterHistoryLimit)
+	}
+	if want := fmt.Sprintf("smtp%d", ParameterHistoryLimit+3); string(history[0].Value) != want {
+		t.Errorf("newest entry = %q, want %q", history[0].Value, want)
+	}
+	if history[0].Fingerprint() == history[1].Fingerprint() {
+		t.Error("different values should have different fingerprints")
+	}
+}
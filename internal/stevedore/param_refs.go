@@ -0,0 +1,159 @@
+package stevedore
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// interpolateParameters resolves ${NAME} references inside parameter values,
+// so DATABASE_URL=postgres://${DB_USER}:${DB_PASS}@${DB_HOST}/app is built
+// from the other parameters of the deployment. A reference names another
+// parameter or a variable of base (the STEVEDORE_* paths), whose values are
+// taken literally. In a value with references, `$$` is a literal `$` and any
+// other `$` is kept as is; a value without references is taken verbatim.
+// Undefined references and reference cycles are errors.
+func interpolateParameters(params map[string]string, base []string) (map[string]string, error) {
+	lookupBase := envLookup(base)
+	resolved := make(map[string]string, len(params))
+
+	var resolve func(name string, path []string) (string, error)
+	resolve = func(name string, path []string) (string, error) {
+		if value, ok := resolved[name]; ok {
+			return value, nil
+		}
+		if idx := slices.Index(path, name); idx >= 0 {
+			return "", fmt.Errorf("parameter reference cycle: %s", strings.Join(append(path[idx:], name), " -> "))
+		}
+		path = append(path, name)
+		value, err := expandParameterRefs(name, params[name], func(ref string) (string, error) {
+			if _, ok := params[ref]; ok {
+				return resolve(ref, path)
+			}
+			if value, ok := lookupBase(ref); ok {
+				return value, nil
+			}
+			return "", fmt.Errorf("parameter %s references undefined parameter %s", name, ref)
+		})
+		if err != nil {
+			return "", err
+		}
+		resolved[name] = value
+		return value, nil
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// expandParameterRefs replaces the ${NAME} references in the value of the
+// parameter name using lookup, and `$$` with `$`. A value without any
+// reference is returned unchanged.
+func expandParameterRefs(name, value string, lookup func(ref string) (string, error)) (string, error) {
+	if len(parameterRefs(value)) == 0 {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for idx := 0; idx < len(value); idx++ {
+		if value[idx] != '$' || idx+1 == len(value) {
+			b.WriteByte(value[idx])
+			continue
+		}
+		switch value[idx+1] {
+		case '$':
+			b.WriteByte('$')
+			idx++
+		case '{':
+			end := strings.IndexByte(value[idx+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("parameter %s: unterminated ${ (write $$ for a literal $)", name)
+			}
+			ref := value[idx+2 : idx+2+end]
+			if !isParameterRefName(ref) {
+				return "", fmt.Errorf("parameter %s: invalid reference ${%s} (write $$ for a literal $)", name, ref)
+			}
+			refValue, err := lookup(ref)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(refValue)
+			idx += 2 + end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+// parameterRefs returns the names of the well-formed ${NAME} references in
+// value, skipping escaped `$${NAME}` ones. Only values with a reference are
+// interpolated, so values stored before references existed (a password with
+// `$$` or a stray `${`) are used exactly as stored.
+func parameterRefs(value string) []string {
+	var refs []string
+	for idx := 0; idx+1 < len(value); idx++ {
+		if value[idx] != '$' {
+			continue
+		}
+		switch value[idx+1] {
+		case '$':
+			idx++
+		case '{':
+			end := strings.IndexByte(value[idx+2:], '}')
+			if end < 0 {
+				return refs
+			}
+			if ref := value[idx+2 : idx+2+end]; isParameterRefName(ref) {
+				if !slices.Contains(refs, ref) {
+					refs = append(refs, ref)
+				}
+				idx += 2 + end
+			}
+		}
+	}
+	return refs
+}
+
+// isParameterRefName reports whether ref is a variable name: letters, digits
+// and underscores, not starting with a digit.
+func isParameterRefName(ref string) bool {
+	if ref == "" || (ref[0] >= '0' && ref[0] <= '9') {
+		return false
+	}
+	for _, r := range ref {
+		if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParameterReferenceWarning returns a note for `param set` when value has
+// ${NAME} references that deploys will resolve, or "" when it has none or
+// the parameter is not interpolated. Values stored before references were
+// resolved may need `$${NAME}` to stay literal.
+func ParameterReferenceWarning(name, value string) string {
+	if isRegistryParam(name) || isBuildArgParam(name) || isFileParam(name) {
+		return ""
+	}
+	var refs []string
+	for _, ref := range parameterRefs(value) {
+		refs = append(refs, "${"+ref+"}")
+	}
+	if len(refs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("parameter %s references %s, resolved on every deploy; write $%s to keep a reference literal",
+		name, strings.Join(refs, ", "), refs[0])
+}
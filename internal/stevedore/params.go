@@ -5,8 +5,61 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// GlobalParameterScope is the reserved deployment key global parameters are
+// stored under in the parameters table. Every deployment inherits them; a
+// deployment's own parameter of the same name takes precedence.
+const GlobalParameterScope = "*"
+
+// DefaultMaxParameterSize is the largest parameter value accepted unless
+// STEVEDORE_MAX_PARAM_BYTES overrides it.
+const DefaultMaxParameterSize = 1 << 20
+
+// ErrParameterTooLarge is returned when a parameter value exceeds
+// MaxParameterSize.
+var ErrParameterTooLarge = errors.New("parameter value too large")
+
+// envStyleNameRe matches conventional environment variable names.
+var envStyleNameRe = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// MaxParameterSize returns the configured limit on parameter values in bytes.
+// STEVEDORE_MAX_PARAM_BYTES=0 disables it.
+func MaxParameterSize() int {
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("STEVEDORE_MAX_PARAM_BYTES"))); err == nil && v >= 0 {
+		return v
+	}
+	return DefaultMaxParameterSize
+}
+
+// validateParameterValue rejects values above MaxParameterSize, which would
+// bloat the encrypted database (e.g. a file piped to `param set --stdin` by
+// mistake). Any bytes are allowed otherwise.
+func validateParameterValue(name string, value []byte) error {
+	if limit := MaxParameterSize(); limit > 0 && len(value) > limit {
+		return fmt.Errorf("%w: %s is %s, the limit is %s (STEVEDORE_MAX_PARAM_BYTES)",
+			ErrParameterTooLarge, name, FormatBytes(uint64(len(value))), FormatBytes(uint64(limit)))
+	}
+	return nil
+}
+
+// ParameterNameWarning returns why name is not a conventional environment
+// variable name (uppercase letters, digits and underscores), or "" if it is.
+// Such names are still accepted.
+func ParameterNameWarning(name string) string {
+	if envStyleNameRe.MatchString(name) {
+		return ""
+	}
+	if envStyleNameRe.MatchString(strings.ToUpper(name)) {
+		return fmt.Sprintf("parameter name %s is not uppercase; environment variables are usually named like %s", name, strings.ToUpper(name))
+	}
+	return fmt.Sprintf("parameter name %s is not an environment variable style name (A-Z, 0-9, _); compose may not be able to reference it", name)
+}
+
 func (i *Instance) SetParameter(deployment string, name string, value []byte) error {
 	if err := ValidateDeploymentName(deployment); err != nil {
 		return err
@@ -14,6 +67,9 @@ func (i *Instance) SetParameter(deployment string, name string, value []byte) er
 	if err := ValidateParameterName(name); err != nil {
 		return err
 	}
+	if err := validateParameterValue(name, value); err != nil {
+		return err
+	}
 	if err := i.EnsureLayout(); err != nil {
 		return err
 	}
@@ -31,19 +87,58 @@ func (i *Instance) SetParameter(deployment string, name string, value []byte) er
 	}
 	defer func() { _ = db.Close() }()
 
-	if err := EnsureDeploymentRow(db, deployment); err != nil {
+	return upsertParameter(db, deployment, name, value)
+}
+
+// SetGlobalParameter stores a parameter inherited by every deployment.
+func (i *Instance) SetGlobalParameter(name string, value []byte) error {
+	if err := ValidateParameterName(name); err != nil {
+		return err
+	}
+	if err := validateParameterValue(name, value); err != nil {
+		return err
+	}
+	if err := i.EnsureLayout(); err != nil {
 		return err
 	}
 
-	_, err = db.Exec(
+	db, err := i.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	return upsertParameter(db, GlobalParameterScope, name, value)
+}
+
+// upsertParameter writes a parameter for a deployment or the global scope,
+// keeping the value it replaces in the parameter history.
+func upsertParameter(db *sql.DB, scope string, name string, value []byte) error {
+	if err := EnsureDeploymentRow(db, scope); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := recordParameterHistory(tx, scope, name, value); err != nil {
+		return fmt.Errorf("record parameter history: %w", err)
+	}
+
+	if _, err := tx.Exec(
 		`INSERT INTO parameters (deployment, name, value, updated_at)
 		 VALUES (?, ?, ?, CAST(strftime('%s','now') AS INTEGER))
 		 ON CONFLICT(deployment, name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at;`,
-		deployment,
+		scope,
 		name,
 		value,
-	)
-	return err
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (i *Instance) GetParameter(deployment string, name string) ([]byte, error) {
@@ -70,8 +165,21 @@ func (i *Instance) GetParameter(deployment string, name string) ([]byte, error)
 	}
 	defer func() { _ = db.Close() }()
 
+	// The deployment's own value wins over its profile's, which wins over a
+	// global one
+	profileScope := GlobalParameterScope
+	if profile, err := i.DeploymentProfile(deployment); err != nil {
+		return nil, err
+	} else if profile != "" {
+		profileScope = ProfileParameterScope(profile)
+	}
 	var value []byte
-	if err := db.QueryRow(`SELECT value FROM parameters WHERE deployment = ? AND name = ?;`, deployment, name).Scan(&value); err != nil {
+	err = db.QueryRow(
+		`SELECT value FROM parameters WHERE deployment IN (?, ?, ?) AND name = ?
+		 ORDER BY deployment = ? DESC, deployment = ? DESC LIMIT 1;`,
+		deployment, profileScope, GlobalParameterScope, name, deployment, profileScope,
+	).Scan(&value)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("parameter not found: %s/%s", deployment, name)
 		}
@@ -81,6 +189,32 @@ func (i *Instance) GetParameter(deployment string, name string) ([]byte, error)
 	return value, nil
 }
 
+// GetGlobalParameter returns a global parameter.
+func (i *Instance) GetGlobalParameter(name string) ([]byte, error) {
+	if err := ValidateParameterName(name); err != nil {
+		return nil, err
+	}
+	if err := i.EnsureLayout(); err != nil {
+		return nil, err
+	}
+
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	var value []byte
+	if err := db.QueryRow(`SELECT value FROM parameters WHERE deployment = ? AND name = ?;`, GlobalParameterScope, name).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("global parameter not found: %s", name)
+		}
+		return nil, err
+	}
+
+	return value, nil
+}
+
 func (i *Instance) ListParameters(deployment string) ([]string, error) {
 	if err := ValidateDeploymentName(deployment); err != nil {
 		return nil, err
@@ -99,7 +233,62 @@ func (i *Instance) ListParameters(deployment string) ([]string, error) {
 	}
 	defer func() { _ = db.Close() }()
 
-	rows, err := db.Query(`SELECT name FROM parameters WHERE deployment = ? ORDER BY name;`, deployment)
+	return listParameterNames(db, deployment)
+}
+
+// ListGlobalParameters returns the names of the global parameters.
+func (i *Instance) ListGlobalParameters() ([]string, error) {
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	return listParameterNames(db, GlobalParameterScope)
+}
+
+// ListEffectiveParameters returns the names of the deployment's own parameters
+// merged with the ones it inherits from its profile and the global scope,
+// sorted. GetParameter resolves each name to the deployment's value, falling
+// back to the profile's and then the global one.
+func (i *Instance) ListEffectiveParameters(deployment string) ([]string, error) {
+	names, err := i.ListParameters(deployment)
+	if err != nil {
+		return nil, err
+	}
+	inherited, err := i.ListGlobalParameters()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := i.DeploymentProfile(deployment)
+	if err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		profileNames, err := i.ListProfileParameters(profile)
+		if err != nil {
+			return nil, err
+		}
+		inherited = append(profileNames, inherited...)
+	}
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, name := range inherited {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// listParameterNames returns the parameter names stored for a deployment or the global scope.
+func listParameterNames(db *sql.DB, scope string) ([]string, error) {
+	rows, err := db.Query(`SELECT name FROM parameters WHERE deployment = ? ORDER BY name;`, scope)
 	if err != nil {
 		return nil, err
 	}
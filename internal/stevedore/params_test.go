@@ -1,6 +1,7 @@
 package stevedore
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -257,6 +258,65 @@ func TestParameters_BinaryValues(t *testing.T) {
 	}
 }
 
+func TestSetParameter_TooLarge(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	t.Setenv("STEVEDORE_MAX_PARAM_BYTES", "16")
+
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout: %v", err)
+	}
+
+	setupDeployment(t, instance, "testapp")
+
+	if err := instance.SetParameter("testapp", "FITS", make([]byte, 16)); err != nil {
+		t.Fatalf("SetParameter at the limit: %v", err)
+	}
+	if err := instance.SetParameter("testapp", "TOO_BIG", make([]byte, 17)); !errors.Is(err, ErrParameterTooLarge) {
+		t.Fatalf("SetParameter over the limit = %v, want ErrParameterTooLarge", err)
+	}
+	if err := instance.SetGlobalParameter("TOO_BIG", make([]byte, 17)); !errors.Is(err, ErrParameterTooLarge) {
+		t.Fatalf("SetGlobalParameter over the limit = %v, want ErrParameterTooLarge", err)
+	}
+
+	t.Setenv("STEVEDORE_MAX_PARAM_BYTES", "0")
+	if err := instance.SetParameter("testapp", "TOO_BIG", make([]byte, 17)); err != nil {
+		t.Fatalf("SetParameter with the limit disabled: %v", err)
+	}
+}
+
+func TestMaxParameterSize(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", DefaultMaxParameterSize},
+		{"2048", 2048},
+		{"0", 0},
+		{"-1", DefaultMaxParameterSize},
+		{"lots", DefaultMaxParameterSize},
+	}
+	for _, tt := range tests {
+		t.Setenv("STEVEDORE_MAX_PARAM_BYTES", tt.env)
+		if got := MaxParameterSize(); got != tt.want {
+			t.Errorf("MaxParameterSize() with %q = %d, want %d", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestParameterNameWarning(t *testing.T) {
+	for _, name := range []string{"DB_PASSWORD", "_PRIVATE", "API_KEY_2"} {
+		if got := ParameterNameWarning(name); got != "" {
+			t.Errorf("ParameterNameWarning(%q) = %q, want none", name, got)
+		}
+	}
+	for _, name := range []string{"db_password", "Api.Key", "2FA_SECRET", "my-token"} {
+		if got := ParameterNameWarning(name); got == "" {
+			t.Errorf("ParameterNameWarning(%q) = none, want a warning", name)
+		}
+	}
+}
+
 // TestParameters_UsedInDeploy verifies that ListParameters and GetParameter
 // work correctly when called from Deploy() to pass env vars to docker-compose.
 // This is a regression test for Issue #4.
@@ -311,3 +371,50 @@ func TestParameters_UsedInDeploy(t *testing.T) {
 		}
 	}
 }
+
+func TestGlobalParameters_InheritedAndOverridden(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout: %v", err)
+	}
+	setupDeployment(t, instance, "testapp")
+
+	if err := instance.SetGlobalParameter("SMTP_HOST", []byte("smtp.example.com")); err != nil {
+		t.Fatalf("SetGlobalParameter: %v", err)
+	}
+	if err := instance.SetGlobalParameter("SMTP_PORT", []byte("25")); err != nil {
+		t.Fatalf("SetGlobalParameter: %v", err)
+	}
+	if err := instance.SetParameter("testapp", "SMTP_PORT", []byte("587")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+
+	// Globals are inherited, the deployment's own value wins
+	if value, err := instance.GetParameter("testapp", "SMTP_HOST"); err != nil || string(value) != "smtp.example.com" {
+		t.Errorf("GetParameter(SMTP_HOST) = %q, %v", value, err)
+	}
+	if value, err := instance.GetParameter("testapp", "SMTP_PORT"); err != nil || string(value) != "587" {
+		t.Errorf("GetParameter(SMTP_PORT) = %q, %v, want 587", value, err)
+	}
+	if value, err := instance.GetGlobalParameter("SMTP_PORT"); err != nil || string(value) != "25" {
+		t.Errorf("GetGlobalParameter(SMTP_PORT) = %q, %v, want 25", value, err)
+	}
+
+	// ListParameters only shows the deployment's own parameters
+	names, err := instance.ListParameters("testapp")
+	if err != nil || len(names) != 1 || names[0] != "SMTP_PORT" {
+		t.Errorf("ListParameters = %v, %v", names, err)
+	}
+	names, err = instance.ListEffectiveParameters("testapp")
+	if err != nil || len(names) != 2 || names[0] != "SMTP_HOST" || names[1] != "SMTP_PORT" {
+		t.Errorf("ListEffectiveParameters = %v, %v", names, err)
+	}
+
+	// Globals are not a deployment
+	deployments, err := instance.ListDeployments()
+	if err != nil || len(deployments) != 1 {
+		t.Errorf("ListDeployments = %v, %v", deployments, err)
+	}
+}
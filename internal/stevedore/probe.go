@@ -0,0 +1,121 @@
+package stevedore
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LabelHealthcheckPort enables a stevedore-side health probe for a service
+// whose image has no HEALTHCHECK. With a stevedore.ingress.healthcheck path
+// the probe is an HTTP GET of that path on this port; without one it is a
+// TCP connect.
+const LabelHealthcheckPort = "stevedore.healthcheck.port"
+
+// probeTimeout bounds a single probe so a hung service cannot stall status.
+const probeTimeout = 5 * time.Second
+
+// probeSpec describes how to probe one container.
+type probeSpec struct {
+	host string
+	port int
+	path string // empty for a TCP probe
+}
+
+func (p probeSpec) String() string {
+	addr := net.JoinHostPort(p.host, strconv.Itoa(p.port))
+	if p.path == "" {
+		return "tcp://" + addr
+	}
+	return "http://" + addr + p.path
+}
+
+// probeSpecFromLabels builds the probe for a container, or nil when no probe
+// is configured or the container has no reachable IP address.
+func probeSpecFromLabels(labels map[string]string, ip string) (*probeSpec, error) {
+	portStr := strings.TrimSpace(labels[LabelHealthcheckPort])
+	if portStr == "" {
+		return nil, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid %s label: %q", LabelHealthcheckPort, portStr)
+	}
+	if ip == "" {
+		return nil, nil
+	}
+
+	spec := &probeSpec{host: ip, port: port}
+	if path := strings.TrimSpace(labels[LabelIngressHealthCheck]); path != "" {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		spec.path = path
+	}
+	return spec, nil
+}
+
+// run performs the probe. HTTP probes succeed on 2xx and 3xx responses.
+func (p probeSpec) run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(p.host, strconv.Itoa(p.port))
+	if p.path == "" {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "stevedore-probe")
+	client := &http.Client{
+		// A redirect already proves the service answers
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// applyProbe runs the container's probe and folds the result into its health.
+// A failing probe marks the container unhealthy; a passing one marks a
+// container without a docker HEALTHCHECK healthy.
+func applyProbe(ctx context.Context, c *ContainerStatus) {
+	if c.probe == nil || c.State != StateRunning {
+		return
+	}
+
+	err := c.probe.run(ctx)
+	previous := c.Health
+	switch {
+	case err != nil:
+		c.Health = HealthUnhealthy
+		c.ProbeError = fmt.Sprintf("%s: %v", c.probe, err)
+	case c.Health == HealthNone:
+		c.Health = HealthHealthy
+	}
+
+	if c.Health != previous {
+		if previous != HealthNone {
+			c.Status = strings.TrimSuffix(c.Status, fmt.Sprintf(" (%s)", previous))
+		}
+		c.Status += fmt.Sprintf(" (%s)", c.Health)
+	}
+}
@@ -0,0 +1,97 @@
+package stevedore
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProbeSpecFromLabels(t *testing.T) {
+	spec, err := probeSpecFromLabels(map[string]string{
+		LabelHealthcheckPort:    "8080",
+		LabelIngressHealthCheck: "health",
+	}, "172.18.0.5")
+	if err != nil || spec == nil {
+		t.Fatalf("probeSpecFromLabels = %v, %v", spec, err)
+	}
+	if spec.String() != "http://172.18.0.5:8080/health" {
+		t.Errorf("spec = %s", spec)
+	}
+
+	spec, _ = probeSpecFromLabels(map[string]string{LabelHealthcheckPort: "5432"}, "172.18.0.6")
+	if spec == nil || spec.String() != "tcp://172.18.0.6:5432" {
+		t.Errorf("tcp spec = %v", spec)
+	}
+
+	// The ingress path alone does not enable a probe
+	if spec, _ := probeSpecFromLabels(map[string]string{LabelIngressHealthCheck: "/health"}, "172.18.0.5"); spec != nil {
+		t.Errorf("expected no probe without port label, got %s", spec)
+	}
+	if _, err := probeSpecFromLabels(map[string]string{LabelHealthcheckPort: "http"}, "172.18.0.5"); err == nil {
+		t.Error("expected error for invalid port")
+	}
+}
+
+func testProbe(t *testing.T, addr string, path string) *probeSpec {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("SplitHostPort: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return &probeSpec{host: host, port: port, path: path}
+}
+
+func TestApplyProbe_HTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	healthy := ContainerStatus{State: StateRunning, Health: HealthNone, Status: "Up 5m", probe: testProbe(t, addr, "/health")}
+	applyProbe(context.Background(), &healthy)
+	if healthy.Health != HealthHealthy || healthy.Status != "Up 5m (healthy)" || healthy.ProbeError != "" {
+		t.Errorf("healthy probe: %+v", healthy)
+	}
+
+	failing := ContainerStatus{State: StateRunning, Health: HealthHealthy, Status: "Up 5m (healthy)", probe: testProbe(t, addr, "/ready")}
+	applyProbe(context.Background(), &failing)
+	if failing.Health != HealthUnhealthy || failing.Status != "Up 5m (unhealthy)" || !strings.Contains(failing.ProbeError, "HTTP 503") {
+		t.Errorf("failing probe: %+v", failing)
+	}
+}
+
+func TestApplyProbe_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	addr := listener.Addr().String()
+
+	c := ContainerStatus{State: StateRunning, Health: HealthNone, probe: testProbe(t, addr, "")}
+	applyProbe(context.Background(), &c)
+	if c.Health != HealthHealthy {
+		t.Errorf("open port: health = %s (%s)", c.Health, c.ProbeError)
+	}
+
+	_ = listener.Close()
+	c = ContainerStatus{State: StateRunning, Health: HealthNone, probe: testProbe(t, addr, "")}
+	applyProbe(context.Background(), &c)
+	if c.Health != HealthUnhealthy || c.ProbeError == "" {
+		t.Errorf("closed port: %+v", c)
+	}
+
+	// Stopped containers are not probed
+	c = ContainerStatus{State: StateExited, Health: HealthNone, probe: testProbe(t, addr, "")}
+	applyProbe(context.Background(), &c)
+	if c.Health != HealthNone {
+		t.Errorf("exited container was probed: %+v", c)
+	}
+}
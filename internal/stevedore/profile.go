@@ -0,0 +1,163 @@
+package stevedore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// profileNameRe matches profile names: they become part of compose file
+// names (docker-compose.<profile>.yaml), so they are kept lowercase.
+var profileNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// profileScopePrefix prefixes the deployment key profile parameters are
+// stored under in the parameters table. Deployment names cannot contain ':',
+// so profile scopes never collide with a deployment.
+const profileScopePrefix = "profile:"
+
+// ValidateProfileName checks the name of an environment profile (e.g.
+// "staging" or "prod").
+func ValidateProfileName(name string) error {
+	if !profileNameRe.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: expected lowercase letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// ProfileParameterScope returns the parameters table key of the parameters
+// of a profile. Deployments with the profile inherit them; their own
+// parameters take precedence, and they take precedence over global ones.
+func ProfileParameterScope(profile string) string {
+	return profileScopePrefix + profile
+}
+
+// DeploymentProfile returns the profile `repo add --profile` set for the
+// deployment, or "" when it has none.
+func (i *Instance) DeploymentProfile(deployment string) (string, error) {
+	spec, err := i.readRepoSpec(deployment)
+	if err != nil {
+		return "", err
+	}
+	return spec.Profile, nil
+}
+
+// profileComposeFile returns the compose override of a profile next to the
+// compose entrypoint, named after it: docker-compose.yaml gets
+// docker-compose.<profile>.yaml (or .yml). It returns "" when the
+// repository has none, so a profile may consist of parameters only.
+func profileComposeFile(composePath, profile string) (string, error) {
+	if profile == "" {
+		return "", nil
+	}
+	stem := strings.TrimSuffix(filepath.Base(composePath), filepath.Ext(composePath))
+	for _, ext := range []string{".yaml", ".yml"} {
+		path := filepath.Join(filepath.Dir(composePath), stem+"."+profile+ext)
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// composeFiles returns the compose files a deploy of deployment applies: the
+// entrypoint, followed by the override of the deployment's profile if the
+// repository has one.
+func (i *Instance) composeFiles(deployment, composePath string) ([]string, error) {
+	profile, err := i.DeploymentProfile(deployment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile of %s: %w", deployment, err)
+	}
+	override, err := profileComposeFile(composePath, profile)
+	if err != nil {
+		return nil, err
+	}
+	if override == "" {
+		return []string{composePath}, nil
+	}
+	return []string{composePath, override}, nil
+}
+
+// composeFileArgs returns the -f flags of docker compose for files.
+func composeFileArgs(files []string) []string {
+	args := make([]string, 0, 2*len(files))
+	for _, file := range files {
+		args = append(args, "-f", file)
+	}
+	return args
+}
+
+// SetProfileParameter stores a parameter inherited by every deployment with
+// the profile.
+func (i *Instance) SetProfileParameter(profile string, name string, value []byte) error {
+	if err := ValidateProfileName(profile); err != nil {
+		return err
+	}
+	if err := ValidateParameterName(name); err != nil {
+		return err
+	}
+	if err := validateParameterValue(name, value); err != nil {
+		return err
+	}
+	if err := i.EnsureLayout(); err != nil {
+		return err
+	}
+
+	db, err := i.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	return upsertParameter(db, ProfileParameterScope(profile), name, value)
+}
+
+// GetProfileParameter returns a parameter of a profile.
+func (i *Instance) GetProfileParameter(profile string, name string) ([]byte, error) {
+	if err := ValidateProfileName(profile); err != nil {
+		return nil, err
+	}
+	if err := ValidateParameterName(name); err != nil {
+		return nil, err
+	}
+	if err := i.EnsureLayout(); err != nil {
+		return nil, err
+	}
+
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	var value []byte
+	if err := db.QueryRow(`SELECT value FROM parameters WHERE deployment = ? AND name = ?;`, ProfileParameterScope(profile), name).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("profile parameter not found: %s/%s", profile, name)
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// ListProfileParameters returns the names of the parameters of a profile.
+func (i *Instance) ListProfileParameters(profile string) ([]string, error) {
+	if err := ValidateProfileName(profile); err != nil {
+		return nil, err
+	}
+
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	return listParameterNames(db, ProfileParameterScope(profile))
+}
@@ -0,0 +1,107 @@
+package stevedore
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestValidateProfileName(t *testing.T) {
+	for _, name := range []string{"prod", "staging", "eu-west_1"} {
+		if err := ValidateProfileName(name); err != nil {
+			t.Errorf("ValidateProfileName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "Prod", "-prod", "prod.eu", "../prod", "prod/x"} {
+		if err := ValidateProfileName(name); err == nil {
+			t.Errorf("ValidateProfileName(%q) accepted", name)
+		}
+	}
+}
+
+func TestProfileComposeFile(t *testing.T) {
+	dir := t.TempDir()
+	composePath := filepath.Join(dir, "docker-compose.yaml")
+	for _, name := range []string{"docker-compose.yaml", "docker-compose.prod.yml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("services: {}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, err := profileComposeFile(composePath, "prod"); err != nil || got != filepath.Join(dir, "docker-compose.prod.yml") {
+		t.Errorf("profileComposeFile(prod) = %q, %v", got, err)
+	}
+	// A profile may have parameters only
+	if got, err := profileComposeFile(composePath, "staging"); err != nil || got != "" {
+		t.Errorf("profileComposeFile(staging) = %q, %v", got, err)
+	}
+	if got, err := profileComposeFile(composePath, ""); err != nil || got != "" {
+		t.Errorf("profileComposeFile without a profile = %q, %v", got, err)
+	}
+}
+
+func TestProfile_ComposeFilesAndParameters(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app-prod", RepoSpec{URL: "git@github.com:acme/app.git", Profile: "prod"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if _, err := instance.AddRepo("app-staging", RepoSpec{URL: "git@github.com:acme/app.git"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if _, err := instance.AddRepo("bad", RepoSpec{URL: "git@github.com:acme/app.git", Profile: "Prod"}); err == nil {
+		t.Error("AddRepo accepted an invalid profile")
+	}
+	if profile, err := instance.DeploymentProfile("app-prod"); err != nil || profile != "prod" {
+		t.Errorf("DeploymentProfile = %q, %v", profile, err)
+	}
+
+	dir := t.TempDir()
+	composePath := filepath.Join(dir, "compose.yaml")
+	for _, name := range []string{"compose.yaml", "compose.prod.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("services: {}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if files, err := instance.composeFiles("app-prod", composePath); err != nil || !slices.Equal(files, []string{composePath, filepath.Join(dir, "compose.prod.yaml")}) {
+		t.Errorf("composeFiles(app-prod) = %v, %v", files, err)
+	}
+	if files, err := instance.composeFiles("app-staging", composePath); err != nil || !slices.Equal(files, []string{composePath}) {
+		t.Errorf("composeFiles(app-staging) = %v, %v", files, err)
+	}
+
+	// Deployment > profile > global
+	for _, set := range []func() error{
+		func() error { return instance.SetGlobalParameter("LOG_LEVEL", []byte("info")) },
+		func() error { return instance.SetGlobalParameter("REPLICAS", []byte("1")) },
+		func() error { return instance.SetProfileParameter("prod", "REPLICAS", []byte("3")) },
+		func() error { return instance.SetProfileParameter("prod", "LOG_LEVEL", []byte("warn")) },
+		func() error { return instance.SetParameter("app-prod", "LOG_LEVEL", []byte("error")) },
+	} {
+		if err := set(); err != nil {
+			t.Fatalf("set parameter: %v", err)
+		}
+	}
+	for _, tt := range []struct{ deployment, name, want string }{
+		{"app-prod", "REPLICAS", "3"},
+		{"app-prod", "LOG_LEVEL", "error"},
+		{"app-staging", "REPLICAS", "1"},
+		{"app-staging", "LOG_LEVEL", "info"},
+	} {
+		if value, err := instance.GetParameter(tt.deployment, tt.name); err != nil || string(value) != tt.want {
+			t.Errorf("GetParameter(%s, %s) = %q, %v, want %q", tt.deployment, tt.name, value, err, tt.want)
+		}
+	}
+	if names, err := instance.ListEffectiveParameters("app-prod"); err != nil || !slices.Equal(names, []string{"LOG_LEVEL", "REPLICAS"}) {
+		t.Errorf("ListEffectiveParameters = %v, %v", names, err)
+	}
+
+	env, err := instance.deploymentEnv("app-prod")
+	if err != nil {
+		t.Fatalf("deploymentEnv: %v", err)
+	}
+	if !slices.Contains(env, "STEVEDORE_PROFILE=prod") || !slices.Contains(env, "REPLICAS=3") {
+		t.Errorf("deploymentEnv = %v", env)
+	}
+}
@@ -0,0 +1,107 @@
+package stevedore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// QueryTokenEnvVar is the variable Deploy sets to the deployment's query token
+// in services labeled stevedore.api.enabled=true.
+const QueryTokenEnvVar = "STEVEDORE_QUERY_TOKEN"
+
+// QuerySocketEnvVar is the variable Deploy sets to the socket path in those
+// services.
+const QuerySocketEnvVar = "STEVEDORE_QUERY_SOCKET"
+
+// apiEnabledServices returns the services that opted into the query socket
+// with the stevedore.api.enabled label, sorted by name.
+func apiEnabledServices(services map[string]composeConfigService) []string {
+	var names []string
+	for name, svc := range services {
+		if labelEnabled(svc.Labels[LabelAPIEnabled]) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeQuerySocketOverride writes a compose override file that mounts the
+// query socket directory read-only into services and sets the query token
+// and socket path. The directory is mounted rather than the socket file, so
+// the containers keep reaching the socket the daemon recreates on restart.
+// The file holds the token; the caller removes it.
+func writeQuerySocketOverride(services []string, token string) (string, error) {
+	type serviceSection struct {
+		Volumes     []string          `yaml:"volumes"`
+		Environment map[string]string `yaml:"environment"`
+	}
+	override := struct {
+		Services map[string]serviceSection `yaml:"services"`
+	}{Services: make(map[string]serviceSection)}
+
+	socketDir := filepath.Dir(DefaultQuerySocketPath)
+	for _, name := range services {
+		override.Services[name] = serviceSection{
+			Volumes: []string{socketDir + ":" + socketDir + ":ro"},
+			Environment: map[string]string{
+				QueryTokenEnvVar:  token,
+				QuerySocketEnvVar: DefaultQuerySocketPath,
+			},
+		}
+	}
+
+	return writeComposeOverride("stevedore-query-socket-*.yaml", override)
+}
+
+// writeComposeOverride writes a compose override file to a temporary file
+// named after pattern and returns its path; the caller removes it.
+func writeComposeOverride(pattern string, override any) (string, error) {
+	data, err := yaml.Marshal(override)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create compose override: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write compose override: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write compose override: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// querySocketOverride returns the compose override giving the deployment's
+// opted-in services query socket access, and those services. It returns ""
+// when no service carries the stevedore.api.enabled label, so the others
+// never see the socket.
+func (i *Instance) querySocketOverride(ctx context.Context, deployment string, composeFiles []string, projectName, gitDir string) (string, []string, error) {
+	services, err := resolveComposeServices(ctx, composeFiles, projectName, gitDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve compose services for the query socket: %w", err)
+	}
+	enabled := apiEnabledServices(services)
+	if len(enabled) == 0 {
+		return "", nil, nil
+	}
+	token, err := i.EnsureQueryToken(deployment)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get query token: %w", err)
+	}
+	override, err := writeQuerySocketOverride(enabled, token)
+	if err != nil {
+		return "", nil, err
+	}
+	return override, enabled, nil
+}
@@ -0,0 +1,47 @@
+package stevedore
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAPIEnabledServices(t *testing.T) {
+	services := map[string]composeConfigService{
+		"dyndns":  {Labels: map[string]string{LabelAPIEnabled: "true"}},
+		"monitor": {Labels: map[string]string{LabelAPIEnabled: "yes"}},
+		"web":     {Labels: map[string]string{LabelIngressEnabled: "true"}},
+		"off":     {Labels: map[string]string{LabelAPIEnabled: "false"}},
+		"db":      {},
+	}
+	if got, want := apiEnabledServices(services), []string{"dyndns", "monitor"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("apiEnabledServices = %v, want %v", got, want)
+	}
+}
+
+func TestWriteQuerySocketOverride(t *testing.T) {
+	path, err := writeQuerySocketOverride([]string{"dyndns"}, "secret-token")
+	if err != nil {
+		t.Fatalf("writeQuerySocketOverride: %v", err)
+	}
+	defer func() { _ = os.Remove(path) }()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `services:
+    dyndns:
+        volumes:
+            - /var/run/stevedore:/var/run/stevedore:ro
+        environment:
+            STEVEDORE_QUERY_SOCKET: /var/run/stevedore/query.sock
+            STEVEDORE_QUERY_TOKEN: secret-token
+`
+	if string(data) != want {
+		t.Errorf("override =\n%s\nwant\n%s", data, want)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm()&0o077 != 0 {
+		t.Errorf("override holding the token is readable by others: %v, %v", info.Mode(), err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -23,8 +24,18 @@ const (
 
 	// LongPollTimeout is the timeout for long-polling requests.
 	LongPollTimeout = 60 * time.Second
+
+	// changeHistorySize is how many recent deployment changes /poll remembers
+	// to tell a reconnecting client which deployments changed.
+	changeHistorySize = 256
 )
 
+// deploymentChange is an entry of the QueryServer's ring buffer of changes.
+type deploymentChange struct {
+	deployment string
+	at         time.Time
+}
+
 // QueryServer handles read-only API queries over a Unix domain socket.
 type QueryServer struct {
 	instance   *Instance
@@ -35,6 +46,10 @@ type QueryServer struct {
 	mu            sync.RWMutex
 	lastChangeAt  time.Time
 	changeWaiters []chan struct{}
+	// changes is a ring buffer of the last changeHistorySize changes;
+	// changeNext is where the next one goes
+	changes    []deploymentChange
+	changeNext int
 
 	// Event bus for change notifications (Issue #10)
 	eventBus *EventBus
@@ -120,13 +135,21 @@ func (qs *QueryServer) Stop() error {
 	return nil
 }
 
-// NotifyChange notifies all long-polling clients of a deployment change.
+// NotifyChange records that deployment changed and notifies all
+// long-polling clients.
 // Deprecated: Use PublishEvent for typed events.
-func (qs *QueryServer) NotifyChange() {
+func (qs *QueryServer) NotifyChange(deployment string) {
 	qs.mu.Lock()
 	defer qs.mu.Unlock()
 
 	qs.lastChangeAt = time.Now()
+	change := deploymentChange{deployment: deployment, at: qs.lastChangeAt}
+	if len(qs.changes) < changeHistorySize {
+		qs.changes = append(qs.changes, change)
+	} else {
+		qs.changes[qs.changeNext] = change
+	}
+	qs.changeNext = (qs.changeNext + 1) % changeHistorySize
 
 	// Notify all waiters
 	for _, ch := range qs.changeWaiters {
@@ -151,7 +174,27 @@ func (qs *QueryServer) PublishEvent(eventType EventType, deployment string, deta
 	qs.eventBus.Publish(event)
 
 	// Also notify legacy long-poll waiters
-	qs.NotifyChange()
+	qs.NotifyChange(deployment)
+}
+
+// changedSince returns the deployments that changed after since, sorted by
+// name. truncated is set when older changes were already dropped from the
+// ring buffer, so the list may miss some: the client should re-query all.
+func (qs *QueryServer) changedSince(since time.Time) (deployments []string, truncated bool) {
+	qs.mu.RLock()
+	defer qs.mu.RUnlock()
+
+	// The oldest remembered change being after since means some were dropped
+	truncated = len(qs.changes) == changeHistorySize && qs.changes[qs.changeNext].at.After(since)
+	seen := map[string]bool{}
+	for _, change := range qs.changes {
+		if change.at.After(since) && change.deployment != "" && !seen[change.deployment] {
+			seen[change.deployment] = true
+			deployments = append(deployments, change.deployment)
+		}
+	}
+	sort.Strings(deployments)
+	return deployments, truncated
 }
 
 // requireAuth wraps handlers with token authentication.
@@ -292,7 +335,7 @@ func (qs *QueryServer) handlePoll(w http.ResponseWriter, r *http.Request) {
 	if !since.IsZero() {
 		events := qs.eventBus.EventsSince(since)
 		if len(events) > 0 {
-			qs.sendPollResponseWithEvents(w, events)
+			qs.sendPollResponseWithEvents(w, events, since)
 			return
 		}
 	}
@@ -301,14 +344,17 @@ func (qs *QueryServer) handlePoll(w http.ResponseWriter, r *http.Request) {
 	qs.mu.RLock()
 	if !since.IsZero() && qs.lastChangeAt.After(since) {
 		qs.mu.RUnlock()
-		qs.sendPollResponse(w)
+		qs.sendPollResponse(w, since)
 		return
 	}
 	qs.mu.RUnlock()
 
-	// Set up long-polling
+	// Set up long-polling; without since, only changes from now on count
 	waiter := make(chan struct{}, 1)
 	qs.mu.Lock()
+	if since.IsZero() {
+		since = time.Now()
+	}
 	qs.changeWaiters = append(qs.changeWaiters, waiter)
 	qs.mu.Unlock()
 
@@ -320,14 +366,12 @@ func (qs *QueryServer) handlePoll(w http.ResponseWriter, r *http.Request) {
 	select {
 	case <-waiter:
 		// Check for events that arrived
-		if !since.IsZero() {
-			events := qs.eventBus.EventsSince(since)
-			if len(events) > 0 {
-				qs.sendPollResponseWithEvents(w, events)
-				return
-			}
+		events := qs.eventBus.EventsSince(since)
+		if len(events) > 0 {
+			qs.sendPollResponseWithEvents(w, events, since)
+			return
 		}
-		qs.sendPollResponse(w)
+		qs.sendPollResponse(w, since)
 	case <-timeout.C:
 		// No change within timeout
 		w.Header().Set("Content-Type", "application/json")
@@ -338,23 +382,33 @@ func (qs *QueryServer) handlePoll(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (qs *QueryServer) sendPollResponse(w http.ResponseWriter) {
+func (qs *QueryServer) sendPollResponse(w http.ResponseWriter, since time.Time) {
 	qs.mu.RLock()
 	changeAt := qs.lastChangeAt.Unix()
 	qs.mu.RUnlock()
 
+	response := PollResponse{
+		Changed:   true,
+		Timestamp: changeAt,
+	}
+	response.Deployments, response.Truncated = qs.changedSince(since)
+
 	w.Header().Set("Content-Type", "application/json")
-	_, _ = fmt.Fprintf(w, `{"changed":true,"timestamp":%d}`, changeAt)
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 // PollResponse represents the response from the /poll endpoint.
 type PollResponse struct {
-	Changed   bool    `json:"changed"`
-	Timestamp int64   `json:"timestamp,omitempty"`
-	Events    []Event `json:"events,omitempty"`
+	Changed   bool  `json:"changed"`
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Deployments changed after the request's since. Truncated means some
+	// changes were too old to remember and the client should re-query all.
+	Deployments []string `json:"deployments,omitempty"`
+	Truncated   bool     `json:"truncated,omitempty"`
+	Events      []Event  `json:"events,omitempty"`
 }
 
-func (qs *QueryServer) sendPollResponseWithEvents(w http.ResponseWriter, events []Event) {
+func (qs *QueryServer) sendPollResponseWithEvents(w http.ResponseWriter, events []Event, since time.Time) {
 	var timestamp int64
 	if len(events) > 0 {
 		timestamp = events[len(events)-1].Timestamp.Unix()
@@ -365,6 +419,7 @@ func (qs *QueryServer) sendPollResponseWithEvents(w http.ResponseWriter, events
 		Timestamp: timestamp,
 		Events:    events,
 	}
+	response.Deployments, response.Truncated = qs.changedSince(since)
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(response)
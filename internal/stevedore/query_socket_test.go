@@ -2,9 +2,11 @@ package stevedore
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -143,7 +145,7 @@ func TestQueryServer_NotifyChange(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 
 	// Notify change
-	qs.NotifyChange()
+	qs.NotifyChange("app")
 
 	// Verify time was updated
 	if !qs.lastChangeAt.After(initialTime) {
@@ -162,7 +164,7 @@ func TestQueryServer_NotifyChangeWakesWaiters(t *testing.T) {
 	qs.mu.Unlock()
 
 	// Notify change
-	qs.NotifyChange()
+	qs.NotifyChange("app")
 
 	// Waiter should receive notification
 	select {
@@ -196,3 +198,47 @@ func TestQueryServer_SocketPath(t *testing.T) {
 		t.Errorf("SocketPath() = %q, want %q", qs2.SocketPath(), customPath)
 	}
 }
+
+func TestQueryServer_ChangedSince(t *testing.T) {
+	qs := NewQueryServer(NewInstance(t.TempDir()), "")
+	start := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	qs.NotifyChange("web")
+	qs.NotifyChange("api")
+	qs.NotifyChange("web")
+
+	deployments, truncated := qs.changedSince(start)
+	if !reflect.DeepEqual(deployments, []string{"api", "web"}) || truncated {
+		t.Errorf("changedSince = %v, %v, want [api web], false", deployments, truncated)
+	}
+	if deployments, _ := qs.changedSince(time.Now()); len(deployments) != 0 {
+		t.Errorf("changedSince(now) = %v, want none", deployments)
+	}
+
+	// Once the ring buffer wrapped, older changes are gone
+	for i := 0; i < changeHistorySize; i++ {
+		qs.NotifyChange("other")
+	}
+	deployments, truncated = qs.changedSince(start)
+	if !reflect.DeepEqual(deployments, []string{"other"}) || !truncated {
+		t.Errorf("changedSince after wrap = %v, %v, want [other], true", deployments, truncated)
+	}
+}
+
+func TestQueryServer_PollReportsChangedDeployments(t *testing.T) {
+	qs := NewQueryServer(NewInstance(t.TempDir()), "")
+	since := time.Now().Add(-time.Minute).Unix()
+	qs.NotifyChange("web")
+
+	rec := httptest.NewRecorder()
+	qs.handlePoll(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/poll?since=%d", since), nil))
+
+	var response PollResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if !response.Changed || !reflect.DeepEqual(response.Deployments, []string{"web"}) || response.Truncated {
+		t.Errorf("poll response = %+v, want web changed", response)
+	}
+}
@@ -6,11 +6,32 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 )
 
 // QueryTokenLength is the length of generated query tokens in bytes.
 const QueryTokenLength = 32
 
+// QueryTokenScopeRead is the scope of every query token: the query socket
+// only serves read-only endpoints.
+const QueryTokenScopeRead = "read"
+
+// queryTokenUseResolution limits how often ValidateQueryToken records a
+// token's use, so polling clients do not write to the database per request.
+const queryTokenUseResolution = time.Minute
+
+// QueryTokenInfo describes a query token for `token list`, without the token.
+type QueryTokenInfo struct {
+	Deployment string    `json:"deployment"`
+	Scope      string    `json:"scope"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// ExpiresAt is nil: query tokens are valid until regenerated
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// LastUsedAt is nil when the token was never used (or not since v14)
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
 // GenerateQueryToken generates a cryptographically secure random token.
 func GenerateQueryToken() (string, error) {
 	bytes := make([]byte, QueryTokenLength)
@@ -114,6 +135,15 @@ func (i *Instance) ValidateQueryToken(token string) (string, error) {
 		return "", err
 	}
 
+	// Recording the use is best-effort: it must not turn a valid token away
+	now := time.Now().Unix()
+	if _, err := db.Exec(
+		`UPDATE query_tokens SET last_used_at = ? WHERE token = ? AND (last_used_at IS NULL OR last_used_at <= ?);`,
+		now, token, now-int64(queryTokenUseResolution/time.Second),
+	); err != nil {
+		log.Printf("warning: failed to record query token use of %s: %v", deployment, err)
+	}
+
 	return deployment, nil
 }
 
@@ -178,3 +208,37 @@ func (i *Instance) ListQueryTokens() (map[string]string, error) {
 
 	return tokens, rows.Err()
 }
+
+// QueryTokenInfos returns the scope, age and last use of every query token,
+// sorted by deployment.
+func (i *Instance) QueryTokenInfos() ([]QueryTokenInfo, error) {
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	rows, err := db.Query(`SELECT deployment, created_at, last_used_at FROM query_tokens ORDER BY deployment;`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var infos []QueryTokenInfo
+	for rows.Next() {
+		var info QueryTokenInfo
+		var createdAt int64
+		var lastUsedAt sql.NullInt64
+		if err := rows.Scan(&info.Deployment, &createdAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		info.Scope = QueryTokenScopeRead
+		info.CreatedAt = time.Unix(createdAt, 0)
+		if lastUsedAt.Valid {
+			lastUsed := time.Unix(lastUsedAt.Int64, 0)
+			info.LastUsedAt = &lastUsed
+		}
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
@@ -3,6 +3,7 @@ package stevedore
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestGenerateQueryToken(t *testing.T) {
@@ -233,3 +234,42 @@ func TestQueryToken_InvalidDeploymentName(t *testing.T) {
 		t.Error("EnsureQueryToken expected error for invalid deployment name")
 	}
 }
+
+func TestQueryTokenInfos_RecordsLastUse(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout: %v", err)
+	}
+	token, err := instance.EnsureQueryToken("used")
+	if err != nil {
+		t.Fatalf("EnsureQueryToken: %v", err)
+	}
+	if _, err := instance.EnsureQueryToken("idle"); err != nil {
+		t.Fatalf("EnsureQueryToken: %v", err)
+	}
+	if _, err := instance.ValidateQueryToken(token); err != nil {
+		t.Fatalf("ValidateQueryToken: %v", err)
+	}
+
+	infos, err := instance.QueryTokenInfos()
+	if err != nil {
+		t.Fatalf("QueryTokenInfos: %v", err)
+	}
+	if len(infos) != 2 || infos[0].Deployment != "idle" || infos[1].Deployment != "used" {
+		t.Fatalf("infos = %+v, want idle and used", infos)
+	}
+	idle, used := infos[0], infos[1]
+	if idle.LastUsedAt != nil {
+		t.Errorf("idle.LastUsedAt = %v, want never", idle.LastUsedAt)
+	}
+	if used.LastUsedAt == nil || time.Since(*used.LastUsedAt) > time.Minute {
+		t.Errorf("used.LastUsedAt = %v, want now", used.LastUsedAt)
+	}
+	for _, info := range infos {
+		if info.Scope != QueryTokenScopeRead || info.ExpiresAt != nil || info.CreatedAt.IsZero() {
+			t.Errorf("info = %+v", info)
+		}
+	}
+}
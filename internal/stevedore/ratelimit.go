@@ -0,0 +1,47 @@
+package stevedore
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket that allows bursts of up to perMinute
+// requests and refills at perMinute requests per minute.
+type rateLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	burst  float64
+	rate   float64 // tokens per second
+	last   time.Time
+	now    func() time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		tokens: float64(perMinute),
+		burst:  float64(perMinute),
+		rate:   float64(perMinute) / 60,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// allow takes a token if one is available. Otherwise it returns how long
+// until the next one is.
+func (l *rateLimiter) allow() (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
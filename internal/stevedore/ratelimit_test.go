@@ -0,0 +1,45 @@
+package stevedore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newRateLimiter(3)
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow(); !ok {
+			t.Fatalf("request %d should be allowed within the burst", i+1)
+		}
+	}
+	ok, wait := l.allow()
+	if ok {
+		t.Fatal("request over the burst should be limited")
+	}
+	if wait != 20*time.Second {
+		t.Errorf("wait = %v, want 20s (3 per minute)", wait)
+	}
+
+	now = now.Add(20 * time.Second)
+	if ok, _ := l.allow(); !ok {
+		t.Error("a token should be refilled after 20s")
+	}
+	if ok, _ := l.allow(); ok {
+		t.Error("only one token should be refilled after 20s")
+	}
+
+	// Refill is capped at the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow(); !ok {
+			t.Fatalf("request %d should be allowed after the refill", i+1)
+		}
+	}
+	if ok, _ := l.allow(); ok {
+		t.Error("refill should not exceed the burst")
+	}
+}
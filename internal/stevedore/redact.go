@@ -0,0 +1,269 @@
+package stevedore
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces secret values in logs and command output.
+const RedactedValue = "<redacted>"
+
+// minRedactedOutputLen is the shortest secret value replaced in command
+// output. Shorter values are too likely to match unrelated text.
+const minRedactedOutputLen = 4
+
+// RedactCommandArgs returns a copy of CLI args with secret values replaced
+// by RedactedValue, for logging. The value of `param set` is a secret.
+func RedactCommandArgs(args []string) []string {
+	redacted := append([]string(nil), args...)
+	for _, i := range secretArgIndexes(args) {
+		redacted[i] = RedactedValue
+	}
+	return redacted
+}
+
+// RedactCommandOutput replaces the secret values of args (see
+// RedactCommandArgs) where they appear in the output of the command.
+func RedactCommandOutput(args []string, output string) string {
+	indexes := secretArgIndexes(args)
+	if len(indexes) == 0 {
+		return output
+	}
+	values := make([]string, len(indexes))
+	for n, i := range indexes {
+		values[n] = args[i]
+	}
+	// runParamTo joins the arguments into one value
+	for _, value := range []string{strings.Join(values, " "), values[0]} {
+		if len(value) >= minRedactedOutputLen {
+			output = strings.ReplaceAll(output, value, RedactedValue)
+		}
+	}
+	return output
+}
+
+// secretArgIndexes returns the positions of the value arguments of
+// `param set [--global | --profile <profile>] [<deployment>] <name> <value>...`.
+// Flags may precede `param`, as the global --json flag can, and runParamTo
+// takes the scope flags anywhere after it.
+func secretArgIndexes(args []string) []int {
+	i := 0
+	for i < len(args) && strings.HasPrefix(args[i], "-") {
+		i++
+	}
+	if i >= len(args) || args[i] != "param" {
+		return nil
+	}
+
+	var words []int
+	scoped := false
+	for i++; i < len(args); i++ {
+		switch {
+		case args[i] == "--global":
+			scoped = true
+		case args[i] == "--profile":
+			scoped = true
+			i++ // the profile name
+		case args[i] == "--include-global" || args[i] == "--json":
+		case len(words) == 0 && strings.HasPrefix(args[i], "-"):
+			// Other flags before the subcommand
+		default:
+			words = append(words, i)
+		}
+	}
+	if len(words) == 0 || args[words[0]] != "set" {
+		return nil
+	}
+	positional := words[1:]
+
+	// The deployment (unless --global or --profile) and the parameter name come first
+	skip := 2
+	if scoped {
+		skip = 1
+	}
+	if len(positional) <= skip {
+		return nil
+	}
+	values := positional[skip:]
+	if len(values) == 1 && args[values[0]] == "--stdin" {
+		return nil
+	}
+	return values
+}
+
+// secretPatterns match credentials that are redacted whether or not they are
+// parameter values: PEM private keys, passwords in URLs and KEY=value (or
+// `key: value`) pairs whose key names a secret.
+var secretPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), RedactedValue},
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`), "${1}" + RedactedValue + "@"},
+	{regexp.MustCompile(`(?i)(\b[a-z0-9_.-]*(?:password|passwd|secret|token|api_?key|private_?key)[a-z0-9_.-]*["']?\s*[=:]\s*)("[^"]*"|'[^']*'|[^\s"',;]+)`), "${1}" + RedactedValue},
+}
+
+// RedactSecrets replaces the secret values, and text that looks like a
+// credential (see secretPatterns), with RedactedValue. Longer secrets are
+// replaced first, so a secret containing another is not left half visible.
+func RedactSecrets(text string, secrets []string) string {
+	sorted := append([]string(nil), secrets...)
+	sort.Slice(sorted, func(a, b int) bool { return len(sorted[a]) > len(sorted[b]) })
+	for _, secret := range sorted {
+		if len(secret) >= minRedactedOutputLen {
+			text = strings.ReplaceAll(text, secret, RedactedValue)
+		}
+	}
+	for _, pattern := range secretPatterns {
+		text = pattern.re.ReplaceAllString(text, pattern.replacement)
+	}
+	return text
+}
+
+// isRedactableValue reports whether a parameter value is worth redacting:
+// flags and numbers such as "true" or "8080" are not secrets, and replacing
+// them would garble unrelated text.
+func isRedactableValue(value string) bool {
+	value = strings.TrimSpace(value)
+	if len(value) < minRedactedOutputLen {
+		return false
+	}
+	if _, err := strconv.ParseBool(value); err == nil {
+		return false
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err != nil
+}
+
+// secretRedactor redacts the parameter values of one deployment.
+type secretRedactor struct {
+	secrets []string
+}
+
+// secretRedactor loads the values of a deployment's parameters, including
+// inherited global ones, registry credentials, build args and secret files.
+func (i *Instance) secretRedactor(deployment string) *secretRedactor {
+	r := &secretRedactor{}
+	names, _ := i.ListEffectiveParameters(deployment)
+	for _, name := range names {
+		value, err := i.GetParameter(deployment, name)
+		if err != nil {
+			continue
+		}
+		for _, secret := range []string{string(value), strings.TrimSpace(string(value))} {
+			if isRedactableValue(secret) {
+				r.secrets = append(r.secrets, secret)
+			}
+		}
+	}
+	return r
+}
+
+// RedactDeploymentSecrets redacts a deployment's parameter values and
+// credential-like text from text shown to users or returned by the API.
+func (i *Instance) RedactDeploymentSecrets(deployment, text string) string {
+	return i.secretRedactor(deployment).text(text)
+}
+
+func (r *secretRedactor) text(text string) string {
+	return RedactSecrets(text, r.secrets)
+}
+
+// error returns err with a redacted message. The original stays in the chain
+// for errors.Is; a *StartupLogsError is rebuilt with redacted log lines.
+func (r *secretRedactor) error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if logsErr, ok := err.(*StartupLogsError); ok {
+		return &StartupLogsError{Err: r.error(logsErr.Err), Logs: r.logs(logsErr.Logs)}
+	}
+	message := r.text(err.Error())
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, message: message}
+}
+
+// logs returns a redacted copy of container logs.
+func (r *secretRedactor) logs(logs []ContainerLog) []ContainerLog {
+	if logs == nil {
+		return nil
+	}
+	redacted := make([]ContainerLog, len(logs))
+	for idx, l := range logs {
+		lines := make([]string, len(l.Lines))
+		for n, line := range l.Lines {
+			lines[n] = r.text(line)
+		}
+		redacted[idx] = ContainerLog{Service: l.Service, Container: l.Container, Lines: lines}
+	}
+	return redacted
+}
+
+// writer returns a writer that passes output on to w a line at a time with
+// the secrets redacted, so a secret split across writes is still found.
+// Flush writes a last line without a newline.
+func (r *secretRedactor) writer(w io.Writer) *lineRedactor {
+	return &lineRedactor{w: w, redactor: r}
+}
+
+// lineRedactor is the writer of secretRedactor.writer. The stdout and
+// stderr of a command may write to it concurrently.
+type lineRedactor struct {
+	w        io.Writer
+	redactor *secretRedactor
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (l *lineRedactor) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.partial = append(l.partial, p...)
+	end := bytes.LastIndexByte(l.partial, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+	lines := string(l.partial[:end+1])
+	l.partial = append(l.partial[:0], l.partial[end+1:]...)
+	if _, err := io.WriteString(l.w, l.redactor.text(lines)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes the unterminated last line, if any.
+func (l *lineRedactor) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.partial) == 0 {
+		return nil
+	}
+	line := string(l.partial) + "\n"
+	l.partial = nil
+	_, err := io.WriteString(l.w, l.redactor.text(line))
+	return err
+}
+
+// redactedError is an error whose message had secrets removed.
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,207 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Parameter names for private registry credentials:
+//
+//	STEVEDORE_REGISTRY_<KEY>_USER  username (required)
+//	STEVEDORE_REGISTRY_<KEY>_PASS  password or token (required)
+//	STEVEDORE_REGISTRY_<KEY>_HOST  registry host (optional)
+//
+// Without _HOST, the host is derived from <KEY> by lowercasing it and turning
+// underscores into dots (GHCR_IO → ghcr.io). Set _HOST for hosts that do not
+// round-trip, e.g. ones with a port or a dash.
+const (
+	ParamRegistryPrefix     = "STEVEDORE_REGISTRY_"
+	paramRegistryUserSuffix = "_USER"
+	paramRegistryPassSuffix = "_PASS"
+	paramRegistryHostSuffix = "_HOST"
+)
+
+// RegistryCredential is a docker login for one registry.
+type RegistryCredential struct {
+	Host     string
+	Username string
+	Password string
+}
+
+// isRegistryParam reports whether a parameter holds registry credentials.
+// These are consumed by stevedore and never passed to docker compose.
+func isRegistryParam(name string) bool {
+	return strings.HasPrefix(name, ParamRegistryPrefix)
+}
+
+// registryCredentialsFromParams groups STEVEDORE_REGISTRY_* parameters into
+// credentials, sorted by host. Other parameters are ignored.
+func registryCredentialsFromParams(params map[string]string) ([]RegistryCredential, error) {
+	type entry struct {
+		user, pass, host       string
+		hasUser, hasPass, seen bool
+	}
+	entries := make(map[string]*entry)
+
+	for name, value := range params {
+		if !isRegistryParam(name) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, ParamRegistryPrefix)
+
+		var key string
+		var field string
+		for _, suffix := range []string{paramRegistryUserSuffix, paramRegistryPassSuffix, paramRegistryHostSuffix} {
+			if strings.HasSuffix(rest, suffix) {
+				key = strings.TrimSuffix(rest, suffix)
+				field = suffix
+				break
+			}
+		}
+		if key == "" {
+			return nil, fmt.Errorf("invalid registry parameter %s: expected %s<KEY>_USER, _PASS or _HOST", name, ParamRegistryPrefix)
+		}
+
+		e := entries[key]
+		if e == nil {
+			e = &entry{}
+			entries[key] = e
+		}
+		switch field {
+		case paramRegistryUserSuffix:
+			e.user, e.hasUser = value, true
+		case paramRegistryPassSuffix:
+			e.pass, e.hasPass = value, true
+		case paramRegistryHostSuffix:
+			e.host = strings.TrimSpace(value)
+		}
+	}
+
+	creds := make([]RegistryCredential, 0, len(entries))
+	for key, e := range entries {
+		if !e.hasUser || !e.hasPass {
+			return nil, fmt.Errorf("registry %s: both %s%s%s and %s%s%s must be set",
+				key, ParamRegistryPrefix, key, paramRegistryUserSuffix, ParamRegistryPrefix, key, paramRegistryPassSuffix)
+		}
+		host := e.host
+		if host == "" {
+			host = strings.ToLower(strings.ReplaceAll(key, "_", "."))
+		}
+		creds = append(creds, RegistryCredential{Host: host, Username: e.user, Password: e.pass})
+	}
+
+	sort.Slice(creds, func(a, b int) bool { return creds[a].Host < creds[b].Host })
+	return creds, nil
+}
+
+// LoadRegistryCredentials returns the private registry logins configured for a deployment.
+func (i *Instance) LoadRegistryCredentials(deployment string) ([]RegistryCredential, error) {
+	names, err := i.ListEffectiveParameters(deployment)
+	if err != nil {
+		return nil, fmt.Errorf("list parameters of %s: %w", deployment, err)
+	}
+
+	params := make(map[string]string)
+	for _, name := range names {
+		if !isRegistryParam(name) {
+			continue
+		}
+		value, err := i.GetParameter(deployment, name)
+		if err != nil {
+			return nil, fmt.Errorf("read registry parameter %s: %w", name, err)
+		}
+		params[name] = string(value)
+	}
+
+	return registryCredentialsFromParams(params)
+}
+
+// dockerConfigDir returns the docker CLI configuration directory stevedore
+// itself uses: DOCKER_CONFIG, or ~/.docker.
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker")
+}
+
+// newDeployDockerConfig creates an empty docker CLI configuration directory
+// for one deploy, so its registry logins neither leak into nor race with
+// other deploys. CLI plugins (docker compose) are linked from the shared
+// directory so they are still found.
+func newDeployDockerConfig() (string, error) {
+	dir, err := os.MkdirTemp("", "stevedore-docker-config-")
+	if err != nil {
+		return "", fmt.Errorf("create docker config directory: %w", err)
+	}
+	if shared := dockerConfigDir(); shared != "" {
+		plugins := filepath.Join(shared, "cli-plugins")
+		if info, err := os.Stat(plugins); err == nil && info.IsDir() {
+			if err := os.Symlink(plugins, filepath.Join(dir, "cli-plugins")); err != nil {
+				_ = os.RemoveAll(dir)
+				return "", fmt.Errorf("link docker CLI plugins: %w", err)
+			}
+		}
+	}
+	return dir, nil
+}
+
+// registryLogin runs `docker login` against the docker configuration in
+// configDir, passing the password on stdin so it never appears in process
+// arguments or logs.
+func (i *Instance) registryLogin(ctx context.Context, configDir string, cred RegistryCredential) error {
+	cmd := newDockerCommand(ctx, "login", "--username", cred.Username, "--password-stdin", cred.Host)
+	cmd.Env = append(os.Environ(), "DOCKER_CONFIG="+configDir)
+	cmd.Stdin = strings.NewReader(cred.Password)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := runCommand(cmd); err != nil {
+		return fmt.Errorf("docker login %s failed: %w: %s", cred.Host, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// registryLoginAll logs in to every registry configured for the deployment in
+// a docker configuration of its own. It returns the environment that points
+// docker commands of the deploy at that configuration (nil when no registry
+// is configured) and a function that deletes it, logins included.
+func (i *Instance) registryLoginAll(ctx context.Context, deployment string) ([]string, func(), error) {
+	creds, err := i.LoadRegistryCredentials(deployment)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	if len(creds) == 0 {
+		return nil, func() {}, nil
+	}
+
+	configDir, err := newDeployDockerConfig()
+	if err != nil {
+		return nil, func() {}, err
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(configDir); err != nil {
+			log.Printf("Warning: failed to remove docker config of %s: %v", deployment, err)
+		}
+	}
+
+	for _, cred := range creds {
+		if err := i.registryLogin(ctx, configDir, cred); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+	}
+
+	return []string{"DOCKER_CONFIG=" + configDir}, cleanup, nil
+}
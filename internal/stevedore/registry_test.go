@@ -0,0 +1,168 @@
+package stevedore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegistryCredentialsFromParams(t *testing.T) {
+	params := map[string]string{
+		"STEVEDORE_REGISTRY_GHCR_IO_USER":  "bot",
+		"STEVEDORE_REGISTRY_GHCR_IO_PASS":  "ghp_secret",
+		"STEVEDORE_REGISTRY_INTERNAL_USER": "deploy",
+		"STEVEDORE_REGISTRY_INTERNAL_PASS": "s3cret",
+		"STEVEDORE_REGISTRY_INTERNAL_HOST": "registry.example.com:5000",
+		"DATABASE_URL":                     "postgres://",
+		"STEVEDORE_INGRESS_WEB_ENABLED":    "true",
+	}
+
+	creds, err := registryCredentialsFromParams(params)
+	if err != nil {
+		t.Fatalf("registryCredentialsFromParams: %v", err)
+	}
+
+	want := []RegistryCredential{
+		{Host: "ghcr.io", Username: "bot", Password: "ghp_secret"},
+		{Host: "registry.example.com:5000", Username: "deploy", Password: "s3cret"},
+	}
+	if !reflect.DeepEqual(creds, want) {
+		t.Errorf("creds = %+v, want %+v", creds, want)
+	}
+}
+
+func TestRegistryCredentialsFromParams_Incomplete(t *testing.T) {
+	_, err := registryCredentialsFromParams(map[string]string{
+		"STEVEDORE_REGISTRY_GHCR_IO_USER": "bot",
+	})
+	if err == nil {
+		t.Fatal("expected error when password is missing")
+	}
+	if !strings.Contains(err.Error(), "STEVEDORE_REGISTRY_GHCR_IO_PASS") {
+		t.Errorf("error should name the missing parameter: %v", err)
+	}
+
+	if _, err := registryCredentialsFromParams(map[string]string{"STEVEDORE_REGISTRY_GHCR_IO_TOKEN": "x"}); err == nil {
+		t.Error("expected error for unknown registry parameter suffix")
+	}
+	if _, err := registryCredentialsFromParams(map[string]string{"STEVEDORE_REGISTRY__USER": "x"}); err == nil {
+		t.Error("expected error for empty registry key")
+	}
+}
+
+func TestLoadRegistryCredentials(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if _, err := instance.AddRepo("private", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	creds, err := instance.LoadRegistryCredentials("private")
+	if err != nil {
+		t.Fatalf("LoadRegistryCredentials: %v", err)
+	}
+	if len(creds) != 0 {
+		t.Fatalf("expected no credentials, got %+v", creds)
+	}
+
+	for name, value := range map[string]string{
+		"STEVEDORE_REGISTRY_GHCR_IO_USER": "bot",
+		"STEVEDORE_REGISTRY_GHCR_IO_PASS": "ghp_secret",
+		"APP_SECRET":                      "unrelated",
+	} {
+		if err := instance.SetParameter("private", name, []byte(value)); err != nil {
+			t.Fatalf("SetParameter(%s): %v", name, err)
+		}
+	}
+
+	creds, err = instance.LoadRegistryCredentials("private")
+	if err != nil {
+		t.Fatalf("LoadRegistryCredentials: %v", err)
+	}
+	if len(creds) != 1 || creds[0].Host != "ghcr.io" || creds[0].Password != "ghp_secret" {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+}
+
+func TestLoadRegistryCredentials_DatabaseError(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	if _, err := instance.AddRepo("private", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	// A deploy must not go ahead without the logins it may need
+	t.Setenv("STEVEDORE_DB_KEY", "wrong-key")
+	if _, err := instance.LoadRegistryCredentials("private"); err == nil {
+		t.Fatal("expected an error when the parameters cannot be read")
+	}
+}
+
+func TestRegistryLoginAll_PerDeployConfig(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	for _, deployment := range []string{"one", "two"} {
+		if _, err := instance.AddRepo(deployment, RepoSpec{URL: "git@github.com:acme/" + deployment + ".git", Branch: "main"}); err != nil {
+			t.Fatalf("AddRepo: %v", err)
+		}
+		for name, value := range map[string]string{
+			"STEVEDORE_REGISTRY_GHCR_IO_USER": deployment,
+			"STEVEDORE_REGISTRY_GHCR_IO_PASS": "secret",
+		} {
+			if err := instance.SetParameter(deployment, name, []byte(value)); err != nil {
+				t.Fatalf("SetParameter: %v", err)
+			}
+		}
+	}
+
+	// `docker login` stores the user in the docker config it is given
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = login ] && echo \"$3\" > \"$DOCKER_CONFIG/config.json\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	t.Setenv("STEVEDORE_DOCKER_BIN", "")
+	shared := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", shared)
+
+	configDir := func(env []string) string {
+		if len(env) != 1 || !strings.HasPrefix(env[0], "DOCKER_CONFIG=") {
+			t.Fatalf("env = %v, want DOCKER_CONFIG", env)
+		}
+		return strings.TrimPrefix(env[0], "DOCKER_CONFIG=")
+	}
+	envOne, cleanupOne, err := instance.registryLoginAll(context.Background(), "one")
+	if err != nil {
+		t.Fatalf("registryLoginAll one: %v", err)
+	}
+	envTwo, cleanupTwo, err := instance.registryLoginAll(context.Background(), "two")
+	if err != nil {
+		t.Fatalf("registryLoginAll two: %v", err)
+	}
+	dirOne, dirTwo := configDir(envOne), configDir(envTwo)
+	if dirOne == dirTwo || dirOne == shared {
+		t.Fatalf("deploys share a docker config: %s, %s (shared %s)", dirOne, dirTwo, shared)
+	}
+	for dir, user := range map[string]string{dirOne: "one", dirTwo: "two"} {
+		data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+		if err != nil || strings.TrimSpace(string(data)) != user {
+			t.Errorf("login in %s = %q, %v, want %s", dir, data, err, user)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(shared, "config.json")); !os.IsNotExist(err) {
+		t.Errorf("login reached the shared docker config: %v", err)
+	}
+
+	cleanupOne()
+	cleanupTwo()
+	for _, dir := range []string{dirOne, dirTwo} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("docker config %s not removed: %v", dir, err)
+		}
+	}
+}
@@ -1,34 +1,178 @@
 package stevedore
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 type RepoSpec struct {
 	URL    string
 	Branch string
+	// Tag is an optional tag glob (e.g. "v*"). When set, sync checks out the
+	// highest matching tag instead of the branch tip.
+	Tag string
+	// Subdir is an optional directory of the repository (e.g. "services/web")
+	// that holds the compose file. Only it is checked out (sparse checkout),
+	// and deploys run from it.
+	Subdir string
+	// Depth is how many commits sync fetches (`repo add --depth`); zero
+	// means the default single commit. FullHistory (`--full`) fetches the
+	// whole history instead, for builds that read git metadata.
+	Depth       int
+	FullHistory bool
+	// KeyType is the type of the generated deploy key (`repo add
+	// --key-type`): KeyTypeEd25519 (default) or KeyTypeRSA. Deployments
+	// sharing a clone reuse the existing key whatever its type.
+	KeyType string
+	// Profile is the environment profile of the deployment (`repo add
+	// --profile`): deploys layer the repository's
+	// docker-compose.<profile>.yaml over the compose file, and the
+	// deployment inherits the profile's parameters.
+	Profile string
 }
 
-func (i *Instance) AddRepo(deployment string, spec RepoSpec) (string, error) {
+// defaultRepoDepth is how many commits a checkout has unless `repo add`
+// asked for more.
+const defaultRepoDepth = 1
+
+// depth returns the number of commits to fetch, or 0 for the full history.
+func (s RepoSpec) depth() int {
+	switch {
+	case s.FullHistory:
+		return 0
+	case s.Depth > 0:
+		return s.Depth
+	}
+	return defaultRepoDepth
+}
+
+// ParseRepoDepth parses a clone depth: a positive number of commits, or
+// "full" for the whole history.
+func ParseRepoDepth(value string) (depth int, full bool, err error) {
+	value = strings.TrimSpace(value)
+	if value == "full" {
+		return 0, true, nil
+	}
+	depth, err = strconv.Atoi(value)
+	if err != nil || depth < 1 {
+		return 0, false, fmt.Errorf("invalid depth %q: expected a positive number of commits or \"full\"", value)
+	}
+	return depth, false, nil
+}
+
+// ValidateRepoSubdir checks a `repo add --subdir` path and returns it in
+// canonical form: relative, slash-separated and inside the repository.
+func ValidateRepoSubdir(subdir string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(strings.TrimSpace(subdir), "\\", "/"))
+	if subdir == "" || cleaned == "." || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid subdirectory %q: expected a relative path inside the repository", subdir)
+	}
+	for _, r := range cleaned {
+		if r < 0x20 || r == 0x7f {
+			return "", fmt.Errorf("invalid subdirectory %q", subdir)
+		}
+	}
+	if cleaned == ".git" || strings.HasPrefix(cleaned, ".git/") {
+		return "", fmt.Errorf("invalid subdirectory %q", subdir)
+	}
+	return cleaned, nil
+}
+
+// RepoSubdir returns the subdirectory a deployment deploys from, or "" for
+// the repository root.
+func (i *Instance) RepoSubdir(deployment string) (string, error) {
 	if err := ValidateDeploymentName(deployment); err != nil {
 		return "", err
 	}
+	data, err := os.ReadFile(filepath.Join(i.DeploymentDir(deployment), "repo", "subdir.txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// composeDir returns the directory of the checkout that holds the compose
+// file, hooks and .stevedore.yaml: the repository root, or the subdirectory
+// set with `repo add --subdir`.
+func (i *Instance) composeDir(deployment string) string {
+	gitDir := filepath.Join(i.DeploymentDir(deployment), "repo", "git")
+	subdir, err := i.RepoSubdir(deployment)
+	if err != nil || subdir == "" {
+		return gitDir
+	}
+	return filepath.Join(gitDir, filepath.FromSlash(subdir))
+}
+
+func (i *Instance) AddRepo(deployment string, spec RepoSpec) (string, error) {
+	if err := i.ValidateNewDeploymentName(deployment); err != nil {
+		return "", err
+	}
 	if spec.URL == "" {
 		return "", fmt.Errorf("repo url is required")
 	}
+	if err := ValidateRepoURL(spec.URL); err != nil {
+		return "", err
+	}
 	if spec.Branch == "" {
 		spec.Branch = "main"
 	}
+	if err := ValidateBranchName(spec.Branch); err != nil {
+		return "", err
+	}
+	if spec.Tag != "" {
+		if err := ValidateTagPattern(spec.Tag); err != nil {
+			return "", err
+		}
+	}
+	if spec.Subdir != "" {
+		subdir, err := ValidateRepoSubdir(spec.Subdir)
+		if err != nil {
+			return "", err
+		}
+		spec.Subdir = subdir
+	}
+	if spec.Depth < 0 || (spec.FullHistory && spec.Depth > 0) {
+		return "", fmt.Errorf("invalid depth %d: expected a positive number of commits or the full history", spec.Depth)
+	}
+	if spec.Profile != "" {
+		if err := ValidateProfileName(spec.Profile); err != nil {
+			return "", err
+		}
+	}
+	if spec.KeyType == "" {
+		spec.KeyType = KeyTypeEd25519
+	}
+	if err := ValidateKeyType(spec.KeyType); err != nil {
+		return "", err
+	}
 	if err := i.EnsureLayout(); err != nil {
 		return "", err
 	}
 
+	// Deployments of the same repository and branch share a clone and a
+	// deploy key, so each needs a subdirectory of its own
+	peers, err := i.repoCachePeers(spec, deployment)
+	if err != nil {
+		return "", err
+	}
+	var keyOwner string
+	for peer, subdir := range peers {
+		if subdir == spec.Subdir {
+			return "", fmt.Errorf("deployment %s already deploys %s of %s", peer, subdir, spec.URL)
+		}
+		if keyOwner == "" || peer < keyOwner {
+			keyOwner = peer
+		}
+	}
+
 	deploymentDir := i.DeploymentDir(deployment)
 	if _, err := os.Stat(deploymentDir); err == nil {
 		return "", fmt.Errorf("deployment already exists: %s", deployment)
@@ -56,14 +200,40 @@ func (i *Instance) AddRepo(deployment string, spec RepoSpec) (string, error) {
 	if err := writeFileAtomic(filepath.Join(repoDir, "branch.txt"), []byte(spec.Branch+"\n"), 0o644); err != nil {
 		return "", err
 	}
+	if spec.Tag != "" {
+		if err := writeFileAtomic(filepath.Join(repoDir, "tag.txt"), []byte(spec.Tag+"\n"), 0o644); err != nil {
+			return "", err
+		}
+	}
+
+	if spec.Subdir != "" {
+		if err := writeFileAtomic(filepath.Join(repoDir, "subdir.txt"), []byte(spec.Subdir+"\n"), 0o644); err != nil {
+			return "", err
+		}
+	}
+
+	if spec.Profile != "" {
+		if err := writeFileAtomic(filepath.Join(repoDir, "profile.txt"), []byte(spec.Profile+"\n"), 0o644); err != nil {
+			return "", err
+		}
+	}
 
-	privateKeyPath := filepath.Join(repoSSHDir, "id_ed25519")
-	cmd := exec.Command("ssh-keygen", "-t", "ed25519", "-N", "", "-C", "stevedore:"+deployment, "-f", privateKeyPath, "-q")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("ssh-keygen failed: %w (%s)", err, strings.TrimSpace(out.String()))
+	if depth := spec.depth(); depth != defaultRepoDepth {
+		value := strconv.Itoa(depth)
+		if depth == 0 {
+			value = "full"
+		}
+		if err := writeFileAtomic(filepath.Join(repoDir, "depth.txt"), []byte(value+"\n"), 0o644); err != nil {
+			return "", err
+		}
+	}
+
+	if keyOwner != "" {
+		if err := i.copyDeployKey(keyOwner, deployment); err != nil {
+			return "", err
+		}
+	} else if err := generateDeployKey(filepath.Join(repoSSHDir, deployKeyFile(spec.KeyType)), deployment, spec.KeyType); err != nil {
+		return "", err
 	}
 
 	db, err := i.OpenDB()
@@ -76,12 +246,13 @@ func (i *Instance) AddRepo(deployment string, spec RepoSpec) (string, error) {
 		return "", err
 	}
 	if _, err := db.Exec(
-		`INSERT INTO repositories (deployment, url, branch, updated_at)
-		 VALUES (?, ?, ?, CAST(strftime('%s','now') AS INTEGER))
-		 ON CONFLICT(deployment) DO UPDATE SET url = excluded.url, branch = excluded.branch, updated_at = excluded.updated_at;`,
+		`INSERT INTO repositories (deployment, url, branch, tag_pattern, updated_at)
+		 VALUES (?, ?, ?, ?, CAST(strftime('%s','now') AS INTEGER))
+		 ON CONFLICT(deployment) DO UPDATE SET url = excluded.url, branch = excluded.branch, tag_pattern = excluded.tag_pattern, updated_at = excluded.updated_at;`,
 		deployment,
 		spec.URL,
 		spec.Branch,
+		spec.Tag,
 	); err != nil {
 		return "", err
 	}
@@ -94,8 +265,7 @@ func (i *Instance) RepoPublicKey(deployment string) (string, error) {
 		return "", err
 	}
 
-	publicKeyPath := filepath.Join(i.DeploymentDir(deployment), "repo", "ssh", "id_ed25519.pub")
-	b, err := os.ReadFile(publicKeyPath)
+	b, err := os.ReadFile(i.repoKeyPath(deployment) + ".pub")
 	if err != nil {
 		return "", err
 	}
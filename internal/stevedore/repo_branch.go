@@ -0,0 +1,113 @@
+package stevedore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateBranchName checks a branch name against git's ref-name rules
+// (git check-ref-format --branch). Names end up in git worker scripts, so
+// shell metacharacters are rejected too.
+func ValidateBranchName(branch string) error {
+	if branch == "" {
+		return fmt.Errorf("branch is required")
+	}
+	invalid := strings.HasPrefix(branch, "-") ||
+		strings.HasPrefix(branch, "/") ||
+		strings.HasSuffix(branch, "/") ||
+		strings.HasSuffix(branch, ".") ||
+		strings.HasSuffix(branch, ".lock") ||
+		strings.Contains(branch, "..") ||
+		strings.Contains(branch, "//") ||
+		strings.Contains(branch, "@{") ||
+		strings.Contains(branch, "/.") ||
+		strings.HasPrefix(branch, ".") ||
+		branch == "@"
+	for _, r := range branch {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\'\"`$;&|<>()", r) {
+			invalid = true
+		}
+	}
+	if invalid {
+		return fmt.Errorf("invalid branch name: %q", branch)
+	}
+	return nil
+}
+
+// ChangeRepoBranch retargets a deployment to another branch and returns what
+// it tracked before. A tag-tracking deployment goes back to tracking the
+// branch. The checkout is discarded, so the next sync clones the new branch
+// from scratch; containers keep running until then.
+func (i *Instance) ChangeRepoBranch(deployment string, branch string) (*RepoSpec, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+	if err := ValidateBranchName(branch); err != nil {
+		return nil, err
+	}
+
+	repoDir := filepath.Join(i.DeploymentDir(deployment), "repo")
+	url, err := os.ReadFile(filepath.Join(repoDir, "url.txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("deployment not found: %s (run: stevedore repo add ...)", deployment)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository URL: %w", err)
+	}
+	previous, err := os.ReadFile(filepath.Join(repoDir, "branch.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read branch: %w", err)
+	}
+	tagPath := filepath.Join(repoDir, "tag.txt")
+	tagPattern, err := os.ReadFile(tagPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read tag pattern: %w", err)
+	}
+	if strings.TrimSpace(string(previous)) == branch && len(tagPattern) == 0 {
+		return nil, fmt.Errorf("deployment %s already tracks branch %s", deployment, branch)
+	}
+
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	if _, err := db.Exec(
+		`UPDATE repositories SET branch = ?, tag_pattern = '', updated_at = CAST(strftime('%s','now') AS INTEGER) WHERE deployment = ?;`,
+		branch, deployment,
+	); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`UPDATE sync_status SET last_tag = NULL WHERE deployment = ?;`, deployment); err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(filepath.Join(repoDir, "branch.txt"), []byte(branch+"\n"), 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(tagPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// Empty the checkout instead of removing it: it may be a mount point
+	gitDir := filepath.Join(repoDir, "git")
+	entries, err := os.ReadDir(gitDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(gitDir, entry.Name())); err != nil {
+			return nil, fmt.Errorf("failed to discard checkout: %w", err)
+		}
+	}
+
+	return &RepoSpec{
+		URL:    strings.TrimSpace(string(url)),
+		Branch: strings.TrimSpace(string(previous)),
+		Tag:    strings.TrimSpace(string(tagPattern)),
+	}, nil
+}
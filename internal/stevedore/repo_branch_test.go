@@ -0,0 +1,249 @@
+package stevedore
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateBranchName(t *testing.T) {
+	for _, branch := range []string{"main", "release/1.2", "feature/foo-bar_baz", "v2.x"} {
+		if err := ValidateBranchName(branch); err != nil {
+			t.Errorf("ValidateBranchName(%q) = %v, want nil", branch, err)
+		}
+	}
+	for _, branch := range []string{"", "-main", "/main", "main/", "a..b", "a//b", "a b", "main.lock", "x@{1}", "a;rm -rf", "$(id)", ".hidden", "a/.b", "@", "a:b"} {
+		if err := ValidateBranchName(branch); err == nil {
+			t.Errorf("ValidateBranchName(%q) = nil, want error", branch)
+		}
+	}
+}
+
+func TestChangeRepoBranch_RetargetsAndDiscardsCheckout(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Tag: "v*"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	gitDir := filepath.Join(instance.DeploymentDir("app"), "repo", "git")
+	if err := os.MkdirAll(filepath.Join(gitDir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, err := instance.ChangeRepoBranch("app", "release/1.2")
+	if err != nil {
+		t.Fatalf("ChangeRepoBranch: %v", err)
+	}
+	if previous.Branch != "main" || previous.Tag != "v*" {
+		t.Errorf("previous = %+v, want branch main with tag v*", previous)
+	}
+
+	if _, err := os.Stat(filepath.Join(gitDir, ".git")); !os.IsNotExist(err) {
+		t.Errorf("expected the checkout to be discarded, got %v", err)
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+	config, err := instance.GetRepoConfig(db, "app")
+	if err != nil {
+		t.Fatalf("GetRepoConfig: %v", err)
+	}
+	if config.Branch != "release/1.2" || config.TagPattern != "" {
+		t.Errorf("config = %+v, want branch release/1.2 without tag pattern", config)
+	}
+
+	// check reports the new branch before any sync
+	result, err := instance.GitCheckRemote(context.Background(), "app")
+	if err != nil {
+		t.Fatalf("GitCheckRemote: %v", err)
+	}
+	if result.Branch != "release/1.2" || !result.HasChanges {
+		t.Errorf("check = %+v, want pending changes on release/1.2", result)
+	}
+
+	if _, err := instance.ChangeRepoBranch("app", "release/1.2"); err == nil {
+		t.Error("expected error when the branch is unchanged")
+	}
+	if _, err := instance.ChangeRepoBranch("app", "bad..branch"); err == nil {
+		t.Error("expected error for invalid branch")
+	}
+	if _, err := instance.ChangeRepoBranch("missing", "main"); err == nil {
+		t.Error("expected error for unknown deployment")
+	}
+}
+
+func TestValidateRepoSubdir(t *testing.T) {
+	for in, want := range map[string]string{"services/web": "services/web", "./web/": "web", "a/../b": "b"} {
+		if got, err := ValidateRepoSubdir(in); err != nil || got != want {
+			t.Errorf("ValidateRepoSubdir(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, subdir := range []string{"", ".", "/etc", "..", "../x", "a/../../x", ".git", ".git/hooks", "a\nb"} {
+		if _, err := ValidateRepoSubdir(subdir); err == nil {
+			t.Errorf("ValidateRepoSubdir(%q) = nil, want error", subdir)
+		}
+	}
+}
+
+func TestAddRepo_SubdirSetsComposeDir(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main", Subdir: "./services/web/"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	subdir, err := instance.RepoSubdir("app")
+	if err != nil || subdir != "services/web" {
+		t.Fatalf("RepoSubdir = %q, %v, want services/web", subdir, err)
+	}
+	want := filepath.Join(instance.DeploymentDir("app"), "repo", "git", "services", "web")
+	if got := instance.composeDir("app"); got != want {
+		t.Errorf("composeDir = %q, want %q", got, want)
+	}
+
+	if _, err := instance.AddRepo("root", RepoSpec{URL: "git@github.com:acme/root.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if got, want := instance.composeDir("root"), filepath.Join(instance.DeploymentDir("root"), "repo", "git"); got != want {
+		t.Errorf("composeDir = %q, want %q", got, want)
+	}
+
+	if _, err := instance.AddRepo("bad", RepoSpec{URL: "git@github.com:acme/bad.git", Subdir: "../etc"}); err == nil {
+		t.Error("AddRepo accepted a subdirectory outside the repository")
+	}
+}
+
+func TestAddRepo_SubdirsShareCloneAndKey(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	url := "git@github.com:acme/monorepo.git"
+	webKey, err := instance.AddRepo("web", RepoSpec{URL: url, Branch: "main", Subdir: "services/web"})
+	if err != nil {
+		t.Fatalf("AddRepo web: %v", err)
+	}
+	apiKey, err := instance.AddRepo("api", RepoSpec{URL: url, Branch: "main", Subdir: "services/api"})
+	if err != nil {
+		t.Fatalf("AddRepo api: %v", err)
+	}
+	if apiKey != webKey {
+		t.Errorf("api got its own deploy key, want the one of web")
+	}
+	if peers, err := instance.RepoCachePeers("api"); err != nil || len(peers) != 1 || peers[0] != "web" {
+		t.Errorf("RepoCachePeers(api) = %v, %v, want [web]", peers, err)
+	}
+
+	if _, err := instance.AddRepo("web2", RepoSpec{URL: url, Branch: "main", Subdir: "services/web/"}); err == nil {
+		t.Error("AddRepo accepted a second deployment of the same subdirectory")
+	}
+
+	// Another branch or tag tracking gets a clone and key of its own
+	stagingKey, err := instance.AddRepo("staging", RepoSpec{URL: url, Branch: "staging", Subdir: "services/web"})
+	if err != nil {
+		t.Fatalf("AddRepo staging: %v", err)
+	}
+	if stagingKey == webKey {
+		t.Error("a deployment of another branch shares the deploy key")
+	}
+	if instance.repoCacheDir(url, "main") == instance.repoCacheDir(url, "staging") {
+		t.Error("branches share a clone cache")
+	}
+	if peers, _ := instance.RepoCachePeers("staging"); len(peers) != 0 {
+		t.Errorf("RepoCachePeers(staging) = %v, want none", peers)
+	}
+}
+
+func TestRepoCacheScript_RequiresFlock(t *testing.T) {
+	// Without flock, deployments sharing the cache would fetch into it at once
+	cmd := exec.Command("/bin/sh", "-c", repoCacheScript("git@github.com:acme/mono.git", "main", 1))
+	cmd.Env = []string{"PATH=" + t.TempDir()}
+	output, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "flock not found") {
+		t.Errorf("script without flock = %v: %s, want a flock error", err, output)
+	}
+}
+
+func TestParseRepoDepth(t *testing.T) {
+	tests := []struct {
+		value    string
+		depth    int
+		full     bool
+		wantFail bool
+	}{
+		{"1", 1, false, false},
+		{"50", 50, false, false},
+		{"full", 0, true, false},
+		{"0", 0, false, true},
+		{"-3", 0, false, true},
+		{"all", 0, false, true},
+	}
+	for _, tt := range tests {
+		depth, full, err := ParseRepoDepth(tt.value)
+		if (err != nil) != tt.wantFail {
+			t.Errorf("ParseRepoDepth(%q) error = %v, want failure %v", tt.value, err, tt.wantFail)
+			continue
+		}
+		if depth != tt.depth || full != tt.full {
+			t.Errorf("ParseRepoDepth(%q) = %d, %v, want %d, %v", tt.value, depth, full, tt.depth, tt.full)
+		}
+	}
+}
+
+func TestAddRepo_DepthReachesGitWorker(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	url := "git@github.com:acme/monorepo.git"
+	specs := map[string]RepoSpec{
+		"shallow": {URL: url, Branch: "main"},
+		"deeper":  {URL: url, Branch: "main", Depth: 50},
+		"full":    {URL: url, Branch: "main", FullHistory: true},
+		"web":     {URL: url, Branch: "main", Subdir: "services/web"},
+		"api":     {URL: url, Branch: "main", Subdir: "services/api", FullHistory: true},
+	}
+	for name, spec := range specs {
+		if _, err := instance.AddRepo(name, spec); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		deployment string
+		clone      string
+		fetch      string
+		cached     bool
+	}{
+		{"shallow", "--depth 1", "--depth 1", false},
+		{"deeper", "--depth 50", "--depth 50", false},
+		{"full", "", "$([ -f .git/shallow ] && echo --unshallow)", false},
+		{"web", "--depth 1", "--depth 1", true},
+		// The shared clone cache is shallow, so full history needs a clone of its own
+		{"api", "", "$([ -f .git/shallow ] && echo --unshallow)", false},
+	}
+	for _, tt := range tests {
+		setup, err := instance.prepareGitRepo(tt.deployment)
+		if err != nil {
+			t.Fatalf("prepareGitRepo %s: %v", tt.deployment, err)
+		}
+		if got := setup.cloneDepthArg(); got != tt.clone {
+			t.Errorf("%s: cloneDepthArg = %q, want %q", tt.deployment, got, tt.clone)
+		}
+		if got := setup.fetchDepthArg(); got != tt.fetch {
+			t.Errorf("%s: fetchDepthArg = %q, want %q", tt.deployment, got, tt.fetch)
+		}
+		if cached := setup.cacheDir != ""; cached != tt.cached {
+			t.Errorf("%s: uses the clone cache = %v, want %v", tt.deployment, cached, tt.cached)
+		}
+	}
+
+	if _, err := instance.AddRepo("bad", RepoSpec{URL: url, Depth: 5, FullHistory: true}); err == nil {
+		t.Error("AddRepo accepted both a depth and the full history")
+	}
+}
@@ -0,0 +1,167 @@
+package stevedore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Deployments that deploy a subdirectory of the same repository and branch
+// share one clone under system/repo-cache/<key>/: the git worker refreshes the
+// bare repository there from the remote, and each deployment's sparse checkout
+// fetches from it instead of the network. Tag-tracking deployments keep their
+// own clone, and so do deployments with a custom clone depth.
+
+// repoCacheMount is where the shared clone cache is mounted in git workers.
+const repoCacheMount = "/cache"
+
+// repoCacheRemote is the URL deployments using the cache fetch from.
+const repoCacheRemote = "file://" + repoCacheMount + "/repo.git"
+
+// repoCacheDir returns the shared clone cache of a repository URL and branch.
+func (i *Instance) repoCacheDir(url, branch string) string {
+	sum := sha256.Sum256([]byte(url + "\x00" + branch))
+	return filepath.Join(i.SystemDir(), "repo-cache", hex.EncodeToString(sum[:8]))
+}
+
+// usesRepoCache reports whether a deployment syncs through the shared clone
+// cache.
+func usesRepoCache(spec RepoSpec) bool {
+	return spec.Subdir != "" && spec.Tag == "" && spec.depth() == defaultRepoDepth
+}
+
+// readRepoSpec reads the repository settings `repo add` stored for a deployment.
+func (i *Instance) readRepoSpec(deployment string) (RepoSpec, error) {
+	repoDir := filepath.Join(i.DeploymentDir(deployment), "repo")
+	read := func(name string) (string, error) {
+		data, err := os.ReadFile(filepath.Join(repoDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return strings.TrimSpace(string(data)), err
+	}
+
+	var spec RepoSpec
+	var err error
+	if spec.URL, err = read("url.txt"); err != nil {
+		return RepoSpec{}, err
+	}
+	if spec.Branch, err = read("branch.txt"); err != nil {
+		return RepoSpec{}, err
+	}
+	if spec.Tag, err = read("tag.txt"); err != nil {
+		return RepoSpec{}, err
+	}
+	if spec.Subdir, err = read("subdir.txt"); err != nil {
+		return RepoSpec{}, err
+	}
+	if spec.Profile, err = read("profile.txt"); err != nil {
+		return RepoSpec{}, err
+	}
+	depth, err := read("depth.txt")
+	if err != nil {
+		return RepoSpec{}, err
+	}
+	if depth != "" {
+		if spec.Depth, spec.FullHistory, err = ParseRepoDepth(depth); err != nil {
+			return RepoSpec{}, fmt.Errorf("depth.txt: %w", err)
+		}
+	}
+	return spec, nil
+}
+
+// repoCachePeers returns the deployments other than exclude that share the
+// clone cache of spec, mapped to the subdirectory each deploys.
+func (i *Instance) repoCachePeers(spec RepoSpec, exclude string) (map[string]string, error) {
+	peers := map[string]string{}
+	if !usesRepoCache(spec) {
+		return peers, nil
+	}
+	deployments, err := i.ListDeployments()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return peers, nil
+		}
+		return nil, err
+	}
+	for _, deployment := range deployments {
+		if deployment == exclude {
+			continue
+		}
+		other, err := i.readRepoSpec(deployment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read repository of %s: %w", deployment, err)
+		}
+		if usesRepoCache(other) && other.URL == spec.URL && other.Branch == spec.Branch {
+			peers[deployment] = other.Subdir
+		}
+	}
+	return peers, nil
+}
+
+// RepoCachePeers returns the other deployments that share the clone of
+// deployment's repository, sorted by name. It is empty unless the deployment
+// was added with --subdir.
+func (i *Instance) RepoCachePeers(deployment string) ([]string, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+	spec, err := i.readRepoSpec(deployment)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := i.repoCachePeers(spec, deployment)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(peers))
+	for name := range peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// copyDeployKey gives a deployment the deploy key of another one, so
+// deployments sharing a clone need a single key on the git host.
+func (i *Instance) copyDeployKey(from, to string) error {
+	privateKeyPath := i.repoKeyPath(from)
+	targetPath := filepath.Join(i.repoSSHDir(to), filepath.Base(privateKeyPath))
+	for path, perm := range map[string]os.FileMode{"": 0o600, ".pub": 0o644} {
+		data, err := os.ReadFile(privateKeyPath + path)
+		if err != nil {
+			return fmt.Errorf("failed to read deploy key of %s: %w", from, err)
+		}
+		if err := writeFileAtomic(targetPath+path, data, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repoCacheScript refreshes the shared clone cache from the remote, fetching
+// depth commits of branch. It holds a lock on the cache until the worker
+// exits, so deployments sharing it sync one at a time. A worker image without
+// flock fails instead of touching the cache unlocked.
+func repoCacheScript(url, branch string, depth int) string {
+	return fmt.Sprintf(`
+if ! command -v flock >/dev/null 2>&1; then
+  echo 'flock not found in the git worker image; it is required to lock the shared repository cache' >&2
+  exit 1
+fi
+exec 9>%[1]s/lock
+flock 9
+git config --global --add safe.directory %[1]s/repo.git
+if [ ! -f %[1]s/repo.git/HEAD ]; then
+  rm -rf %[1]s/repo.git
+  git init --bare -q %[1]s/repo.git
+fi
+git -C %[1]s/repo.git config uploadpack.allowFilter true
+git -C %[1]s/repo.git fetch --depth %[4]d %[2]s %[3]s
+`, repoCacheMount, shellQuote(url), shellQuote("+refs/heads/"+branch+":refs/heads/"+branch), depth)
+}
@@ -0,0 +1,167 @@
+package stevedore
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ParamNoRepoEnv set to "true" makes deploys ignore the `.env` file committed
+// next to the compose file, like `deploy up --no-repo-env`.
+const ParamNoRepoEnv = "STEVEDORE_NO_REPO_ENV"
+
+// composeDisableEnvFile stops docker compose from loading `.env` itself.
+const composeDisableEnvFile = "COMPOSE_DISABLE_ENV_FILE"
+
+// composeEnv returns the environment a deploy runs compose and hooks with.
+// The repository's `.env` (next to the compose file) is the base layer and
+// the deployment's parameters are layered on top, so a parameter always wins
+// over a committed value. Variables of the daemon's own environment also
+// win, as in compose. With noRepoEnv or the STEVEDORE_NO_REPO_ENV parameter
+// the `.env` file is ignored, by stevedore and by compose.
+func (i *Instance) composeEnv(deployment, composePath string, noRepoEnv bool) ([]string, error) {
+	env, err := i.deploymentEnv(deployment)
+	if err != nil {
+		return nil, err
+	}
+	if noRepoEnv || envBool(env, ParamNoRepoEnv) {
+		return append(env, composeDisableEnvFile+"=true"), nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(composePath), ".env"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: ignoring .env of %s: %v", deployment, err)
+		}
+		return env, nil
+	}
+	return layerEnv(parseDotEnv(data, envLookup(env)), env), nil
+}
+
+// repoEnvDisabled reports whether env ignores the repository's `.env`.
+func repoEnvDisabled(env []string) bool {
+	return envBool(env, composeDisableEnvFile)
+}
+
+// envBool reports whether env sets name to a true value.
+func envBool(env []string, name string) bool {
+	value, ok := envLookup(env)(name)
+	if !ok {
+		return false
+	}
+	enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+	return err == nil && enabled
+}
+
+// envLookup returns a lookup of KEY=value entries, the last one winning.
+func envLookup(env []string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		for idx := len(env) - 1; idx >= 0; idx-- {
+			if key, value, ok := strings.Cut(env[idx], "="); ok && key == name {
+				return value, true
+			}
+		}
+		return "", false
+	}
+}
+
+// layerEnv returns base with the entries overridden by top or the daemon's
+// environment removed, followed by top.
+func layerEnv(base, top []string) []string {
+	overridden := make(map[string]bool, len(top))
+	for _, kv := range top {
+		name, _, _ := strings.Cut(kv, "=")
+		overridden[name] = true
+	}
+
+	result := make([]string, 0, len(base)+len(top))
+	for _, kv := range base {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, inDaemonEnv := os.LookupEnv(name); overridden[name] || inDaemonEnv {
+			continue
+		}
+		result = append(result, kv)
+	}
+	return append(result, top...)
+}
+
+// parseDotEnv parses a compose `.env` file into KEY=value entries. Like
+// compose, it skips comments and blank lines, accepts an `export ` prefix,
+// strips quotes, and interpolates $NAME, ${NAME}, ${NAME:-default} and
+// ${NAME-default} in unquoted and double-quoted values from lookup, the
+// daemon's environment and earlier entries. Single-quoted values are literal.
+func parseDotEnv(data []byte, lookup func(string) (string, bool)) []string {
+	var entries []string
+	defined := map[string]string{}
+	// Parameters and the daemon's environment win here too
+	resolve := func(name string) (string, bool) {
+		if value, ok := lookup(name); ok {
+			return value, true
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+		value, ok := defined[name]
+		return value, ok
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+			value = expandDotEnvValue(value, resolve)
+		default:
+			if idx := strings.Index(value, " #"); idx >= 0 {
+				value = strings.TrimSpace(value[:idx])
+			}
+			value = expandDotEnvValue(value, resolve)
+		}
+
+		defined[name] = value
+		entries = append(entries, name+"="+value)
+	}
+	return entries
+}
+
+// expandDotEnvValue interpolates variables in a `.env` value; `$$` is a
+// literal dollar.
+func expandDotEnvValue(value string, resolve func(string) (string, bool)) string {
+	return os.Expand(value, func(ref string) string {
+		if ref == "$" {
+			return "$"
+		}
+		if name, fallback, ok := strings.Cut(ref, ":-"); ok {
+			if v, _ := resolve(name); v != "" {
+				return v
+			}
+			return fallback
+		}
+		if name, fallback, ok := strings.Cut(ref, "-"); ok {
+			if v, set := resolve(name); set {
+				return v
+			}
+			return fallback
+		}
+		v, _ := resolve(ref)
+		return v
+	})
+}
@@ -0,0 +1,97 @@
+package stevedore
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	t.Setenv("STEVEDORE_TEST_HOST", "db.internal")
+	data := []byte(`# committed defaults
+export LOG_LEVEL=info
+PORT = 8080   # inline comment
+GREETING="hello\nworld"
+LITERAL='${PORT} stays'
+URL=http://${STEVEDORE_TEST_HOST}:${PORT}
+API=${API_URL:-https://api.example.com}
+EMPTY=${UNSET_VALUE-}
+PRICE=$$5
+not a variable
+`)
+	lookup := envLookup([]string{"PORT=9090"})
+
+	got := parseDotEnv(data, lookup)
+	want := []string{
+		"LOG_LEVEL=info",
+		"PORT=8080",
+		"GREETING=hello\nworld",
+		"LITERAL=${PORT} stays",
+		// The parameter wins over the earlier .env entry
+		"URL=http://db.internal:9090",
+		"API=https://api.example.com",
+		"EMPTY=",
+		"PRICE=$5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDotEnv =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestComposeEnv_ParametersWinOverRepoEnv(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	t.Setenv("STEVEDORE_TEST_DAEMON_VAR", "daemon")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if err := instance.SetParameter("app", "IMAGE_TAG", []byte("2.0")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+
+	dir := t.TempDir()
+	composePath := filepath.Join(dir, "docker-compose.yaml")
+	dotEnv := "IMAGE_TAG=1.0\nREPLICA_NAME=primary\nSTEVEDORE_TEST_DAEMON_VAR=repo\n"
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(dotEnv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := instance.composeEnv("app", composePath, false)
+	if err != nil {
+		t.Fatalf("composeEnv: %v", err)
+	}
+	lookup := envLookup(env)
+	if v, _ := lookup("IMAGE_TAG"); v != "2.0" {
+		t.Errorf("IMAGE_TAG = %q, want the parameter", v)
+	}
+	if slices.Contains(env, "IMAGE_TAG=1.0") {
+		t.Errorf("env %q still contains the overridden .env value", env)
+	}
+	if v, _ := lookup("REPLICA_NAME"); v != "primary" {
+		t.Errorf("REPLICA_NAME = %q, want the .env value", v)
+	}
+	if _, ok := lookup("STEVEDORE_TEST_DAEMON_VAR"); ok {
+		t.Error("the daemon's environment must win over .env")
+	}
+	if repoEnvDisabled(env) {
+		t.Error("the .env file must be used by default")
+	}
+
+	// --no-repo-env ignores the file, also for compose itself
+	if env, err = instance.composeEnv("app", composePath, true); err != nil {
+		t.Fatalf("composeEnv: %v", err)
+	}
+	if _, ok := envLookup(env)("REPLICA_NAME"); ok || !repoEnvDisabled(env) {
+		t.Errorf("expected .env to be ignored, got %q", env)
+	}
+
+	// ... as does the parameter
+	if err := instance.SetParameter("app", ParamNoRepoEnv, []byte("true")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+	if env, err := instance.composeEnv("app", composePath, false); err != nil || !repoEnvDisabled(env) {
+		t.Errorf("expected %s to ignore .env, got %q", ParamNoRepoEnv, env)
+	}
+}
@@ -0,0 +1,220 @@
+package stevedore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// repoKeyBackupSuffix marks the previous deploy key kept by RotateRepoKey.
+const repoKeyBackupSuffix = ".old"
+
+// Deploy key types for `repo add --key-type`. ed25519 is the default; rsa is
+// for git hosts that do not accept ed25519 keys.
+const (
+	KeyTypeEd25519 = "ed25519"
+	KeyTypeRSA     = "rsa"
+)
+
+// deployKeyFiles are the private key file names under repo/ssh, by key type,
+// in the order repoKeyPath looks for them.
+var deployKeyFiles = []struct {
+	keyType string
+	name    string
+}{
+	{KeyTypeEd25519, "id_ed25519"},
+	{KeyTypeRSA, "id_rsa"},
+}
+
+// ValidateKeyType checks a deploy key type.
+func ValidateKeyType(keyType string) error {
+	if deployKeyFile(keyType) == "" {
+		return fmt.Errorf("invalid key type: %q (expected %s or %s)", keyType, KeyTypeEd25519, KeyTypeRSA)
+	}
+	return nil
+}
+
+// deployKeyFile returns the private key file name for keyType, or "" for an
+// unknown type.
+func deployKeyFile(keyType string) string {
+	for _, f := range deployKeyFiles {
+		if f.keyType == keyType {
+			return f.name
+		}
+	}
+	return ""
+}
+
+// deployKeyType returns the key type of a private key path, going by its
+// file name.
+func deployKeyType(privateKeyPath string) string {
+	for _, f := range deployKeyFiles {
+		if filepath.Base(privateKeyPath) == f.name {
+			return f.keyType
+		}
+	}
+	return KeyTypeEd25519
+}
+
+// repoKeyPath returns the private deploy key of a deployment: whichever of
+// id_ed25519 and id_rsa exists (or is backed up by a rotation), id_ed25519
+// when neither does.
+func (i *Instance) repoKeyPath(deployment string) string {
+	sshDir := i.repoSSHDir(deployment)
+	for _, f := range deployKeyFiles {
+		path := filepath.Join(sshDir, f.name)
+		for _, candidate := range []string{path, path + repoKeyBackupSuffix} {
+			if _, err := os.Stat(candidate); err == nil {
+				return path
+			}
+		}
+	}
+	return filepath.Join(sshDir, deployKeyFiles[0].name)
+}
+
+// RepoKeyRotation describes a rotated deploy key.
+type RepoKeyRotation struct {
+	URL          string // Repository URL the key is for
+	PublicKey    string // New public key to add to the git host
+	OldPublicKey string // Replaced public key to remove from the git host
+	BackupPath   string // Previous private key, kept until the next successful sync
+}
+
+// generateDeployKey creates a passphrase-less keypair of keyType at
+// privateKeyPath. RSA keys are 4096 bits.
+func generateDeployKey(privateKeyPath string, deployment string, keyType string) error {
+	args := []string{"-t", keyType}
+	if keyType == KeyTypeRSA {
+		args = append(args, "-b", "4096")
+	}
+	args = append(args, "-N", "", "-C", "stevedore:"+deployment, "-f", privateKeyPath, "-q")
+	cmd := exec.Command("ssh-keygen", args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ssh-keygen failed: %w (%s)", err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
+
+func (i *Instance) repoSSHDir(deployment string) string {
+	return filepath.Join(i.DeploymentDir(deployment), "repo", "ssh")
+}
+
+// RotateRepoKey replaces the deployment's SSH deploy key with a fresh keypair
+// of the same type. The previous keypair is kept next to it (id_ed25519.old or
+// id_rsa.old) until the next successful sync, so RestoreRepoKey can bring it
+// back. It refuses to rotate again while that backup exists, since it is the
+// last key known to work.
+func (i *Instance) RotateRepoKey(deployment string) (*RepoKeyRotation, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+
+	privateKeyPath := i.repoKeyPath(deployment)
+	oldPublicKey, err := i.RepoPublicKey(deployment)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("deployment has no deploy key: %s (run: stevedore repo add ...)", deployment)
+		}
+		return nil, err
+	}
+	urlBytes, err := os.ReadFile(filepath.Join(i.DeploymentDir(deployment), "repo", "url.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository URL: %w", err)
+	}
+	for _, path := range []string{privateKeyPath, privateKeyPath + ".pub"} {
+		if _, err := os.Stat(path + repoKeyBackupSuffix); err == nil {
+			return nil, fmt.Errorf("the previous deploy key of %s is still kept at %s until the next successful sync; sync or run: stevedore repo rotate-key %s --rollback", deployment, path+repoKeyBackupSuffix, deployment)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	// Generate first so a failing ssh-keygen leaves the current key in place
+	newKeyPath := privateKeyPath + ".new"
+	for _, path := range []string{newKeyPath, newKeyPath + ".pub"} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if err := generateDeployKey(newKeyPath, deployment, deployKeyType(privateKeyPath)); err != nil {
+		return nil, err
+	}
+
+	if err := renameAll([][2]string{
+		{privateKeyPath, privateKeyPath + repoKeyBackupSuffix},
+		{privateKeyPath + ".pub", privateKeyPath + ".pub" + repoKeyBackupSuffix},
+		{newKeyPath, privateKeyPath},
+		{newKeyPath + ".pub", privateKeyPath + ".pub"},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to replace deploy key: %w", err)
+	}
+
+	publicKey, err := i.RepoPublicKey(deployment)
+	if err != nil {
+		return nil, err
+	}
+	return &RepoKeyRotation{
+		URL:          strings.TrimSpace(string(urlBytes)),
+		PublicKey:    publicKey,
+		OldPublicKey: oldPublicKey,
+		BackupPath:   privateKeyPath + repoKeyBackupSuffix,
+	}, nil
+}
+
+// renameAll performs the renames in order. When one fails, the renames done
+// so far are undone, so the files are left as they were.
+func renameAll(renames [][2]string) error {
+	for n, rename := range renames {
+		if err := os.Rename(rename[0], rename[1]); err != nil {
+			for k := n - 1; k >= 0; k-- {
+				if undoErr := os.Rename(renames[k][1], renames[k][0]); undoErr != nil {
+					return fmt.Errorf("%w (undoing the rename of %s also failed: %v)", err, renames[k][0], undoErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreRepoKey puts back the deploy key replaced by RotateRepoKey and
+// returns its public key. It fails when no backup is left.
+func (i *Instance) RestoreRepoKey(deployment string) (string, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return "", err
+	}
+
+	privateKeyPath := i.repoKeyPath(deployment)
+	if _, err := os.Stat(privateKeyPath + repoKeyBackupSuffix); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("no previous deploy key for %s (backups are removed after the next successful sync)", deployment)
+		}
+		return "", err
+	}
+
+	for _, path := range []string{privateKeyPath, privateKeyPath + ".pub"} {
+		if err := os.Rename(path+repoKeyBackupSuffix, path); err != nil {
+			return "", fmt.Errorf("failed to restore deploy key: %w", err)
+		}
+	}
+	return i.RepoPublicKey(deployment)
+}
+
+// removeRepoKeyBackup drops the previous deploy key once a sync proved the
+// current one works.
+func (i *Instance) removeRepoKeyBackup(deployment string) error {
+	privateKeyPath := i.repoKeyPath(deployment)
+	for _, path := range []string{privateKeyPath + repoKeyBackupSuffix, privateKeyPath + ".pub" + repoKeyBackupSuffix} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package stevedore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotateRepoKey_ReplacesAndRestoresKey(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	oldKey, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git"})
+	if err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	rotation, err := instance.RotateRepoKey("app")
+	if err != nil {
+		t.Fatalf("RotateRepoKey: %v", err)
+	}
+	if rotation.PublicKey == oldKey || !strings.HasPrefix(rotation.PublicKey, "ssh-ed25519 ") {
+		t.Errorf("expected a fresh ed25519 key, got %q", rotation.PublicKey)
+	}
+	if rotation.OldPublicKey != oldKey {
+		t.Errorf("OldPublicKey = %q, want %q", rotation.OldPublicKey, oldKey)
+	}
+	if rotation.URL != "git@github.com:acme/app.git" {
+		t.Errorf("URL = %q", rotation.URL)
+	}
+	if current, _ := instance.RepoPublicKey("app"); current != rotation.PublicKey {
+		t.Errorf("stored key = %q, want the new key", current)
+	}
+	if _, err := os.Stat(rotation.BackupPath); err != nil {
+		t.Errorf("expected the old private key to be backed up: %v", err)
+	}
+
+	restored, err := instance.RestoreRepoKey("app")
+	if err != nil {
+		t.Fatalf("RestoreRepoKey: %v", err)
+	}
+	if restored != oldKey {
+		t.Errorf("restored key = %q, want %q", restored, oldKey)
+	}
+	if _, err := instance.RestoreRepoKey("app"); err == nil {
+		t.Error("expected error when no backup is left")
+	}
+}
+
+func TestRemoveRepoKeyBackup(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	rotation, err := instance.RotateRepoKey("app")
+	if err != nil {
+		t.Fatalf("RotateRepoKey: %v", err)
+	}
+
+	if err := instance.removeRepoKeyBackup("app"); err != nil {
+		t.Fatalf("removeRepoKeyBackup: %v", err)
+	}
+	if _, err := os.Stat(rotation.BackupPath); !os.IsNotExist(err) {
+		t.Errorf("expected backup to be removed, got %v", err)
+	}
+	if _, err := instance.RotateRepoKey("missing"); err == nil {
+		t.Error("expected error for unknown deployment")
+	}
+}
+
+func TestAddRepo_RSAKeyType(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	if _, err := instance.AddRepo("bad", RepoSpec{URL: "git@github.com:acme/bad.git", KeyType: "dsa"}); err == nil || !strings.Contains(err.Error(), "invalid key type") {
+		t.Errorf("AddRepo with key type dsa = %v, want an invalid key type error", err)
+	}
+
+	publicKey, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", KeyType: KeyTypeRSA})
+	if err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if !strings.HasPrefix(publicKey, "ssh-rsa ") {
+		t.Errorf("public key = %q, want an RSA key", publicKey)
+	}
+	sshDir := instance.repoSSHDir("app")
+	if _, err := os.Stat(filepath.Join(sshDir, "id_ed25519")); !os.IsNotExist(err) {
+		t.Errorf("expected no ed25519 key, stat = %v", err)
+	}
+	if got := instance.repoKeyPath("app"); got != filepath.Join(sshDir, "id_rsa") {
+		t.Errorf("repoKeyPath = %q, want id_rsa", got)
+	}
+
+	// Rotation keeps the key type
+	rotation, err := instance.RotateRepoKey("app")
+	if err != nil {
+		t.Fatalf("RotateRepoKey: %v", err)
+	}
+	if !strings.HasPrefix(rotation.PublicKey, "ssh-rsa ") || rotation.BackupPath != filepath.Join(sshDir, "id_rsa.old") {
+		t.Errorf("rotation = %+v, want a fresh RSA key with id_rsa backed up", rotation)
+	}
+}
+
+func TestRotateRepoKey_KeepsPendingBackup(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	oldKey, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git"})
+	if err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	rotation, err := instance.RotateRepoKey("app")
+	if err != nil {
+		t.Fatalf("RotateRepoKey: %v", err)
+	}
+
+	// A second rotation before a sync would overwrite the last working key
+	if _, err := instance.RotateRepoKey("app"); err == nil || !strings.Contains(err.Error(), "--rollback") {
+		t.Fatalf("second RotateRepoKey = %v, want an error pointing at --rollback", err)
+	}
+	if current, _ := instance.RepoPublicKey("app"); current != rotation.PublicKey {
+		t.Errorf("stored key = %q, want the key of the first rotation", current)
+	}
+	if restored, err := instance.RestoreRepoKey("app"); err != nil || restored != oldKey {
+		t.Errorf("RestoreRepoKey = %q, %v, want the original key", restored, err)
+	}
+}
+
+func TestRenameAll_UndoesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(key, []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := renameAll([][2]string{
+		{key, key + ".old"},
+		{filepath.Join(dir, "missing"), key},
+	})
+	if err == nil {
+		t.Fatal("expected an error for the missing file")
+	}
+	if data, err := os.ReadFile(key); err != nil || string(data) != "key" {
+		t.Errorf("key after a failed rename = %q, %v, want it back in place", data, err)
+	}
+	if _, err := os.Stat(key + ".old"); !os.IsNotExist(err) {
+		t.Errorf("expected the backup rename to be undone, stat = %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package stevedore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoManifest lists deployments for `repo add --from`, so a host can be
+// bootstrapped from one file:
+//
+//	deployments:
+//	  - name: homepage
+//	    url: git@github.com:acme/homepage.git
+//	    branch: main
+//	    profile: prod
+//	    interval: 10m
+type RepoManifest struct {
+	Deployments []RepoManifestEntry `yaml:"deployments"`
+}
+
+// RepoManifestEntry is one deployment of a RepoManifest. Branch, Tag, Subdir,
+// Depth (a number of commits or "full") and Profile mean the same as in `repo add`;
+// Interval (a duration, at least 1m) and Schedule (a cron expression) are optional.
+type RepoManifestEntry struct {
+	Name     string `yaml:"name"`
+	URL      string `yaml:"url"`
+	Branch   string `yaml:"branch,omitempty"`
+	Tag      string `yaml:"tag,omitempty"`
+	Subdir   string `yaml:"subdir,omitempty"`
+	Depth    string `yaml:"depth,omitempty"`
+	Profile  string `yaml:"profile,omitempty"`
+	Interval string `yaml:"interval,omitempty"`
+	Schedule string `yaml:"schedule,omitempty"`
+}
+
+// ReadRepoManifest reads and validates a manifest file.
+func ReadRepoManifest(path string) (*RepoManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := ParseRepoManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// ParseRepoManifest parses and validates a manifest. Unknown keys are
+// rejected, so a typo does not silently drop a setting.
+func ParseRepoManifest(data []byte) (*RepoManifest, error) {
+	var manifest RepoManifest
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if len(manifest.Deployments) == 0 {
+		return nil, errors.New("manifest lists no deployments")
+	}
+
+	seen := make(map[string]bool, len(manifest.Deployments))
+	for _, entry := range manifest.Deployments {
+		if err := entry.validate(); err != nil {
+			return nil, err
+		}
+		if seen[entry.Name] {
+			return nil, fmt.Errorf("deployment %s is listed twice", entry.Name)
+		}
+		seen[entry.Name] = true
+	}
+	return &manifest, nil
+}
+
+func (e RepoManifestEntry) validate() error {
+	if err := ValidateDeploymentName(e.Name); err != nil {
+		return err
+	}
+	if e.URL == "" {
+		return fmt.Errorf("deployment %s: url is required", e.Name)
+	}
+	if e.Branch != "" && e.Tag != "" {
+		return fmt.Errorf("deployment %s: branch and tag are mutually exclusive", e.Name)
+	}
+	if e.Branch != "" {
+		if err := ValidateBranchName(e.Branch); err != nil {
+			return fmt.Errorf("deployment %s: %w", e.Name, err)
+		}
+	}
+	if e.Tag != "" {
+		if err := ValidateTagPattern(e.Tag); err != nil {
+			return fmt.Errorf("deployment %s: %w", e.Name, err)
+		}
+	}
+	if e.Subdir != "" {
+		if _, err := ValidateRepoSubdir(e.Subdir); err != nil {
+			return fmt.Errorf("deployment %s: %w", e.Name, err)
+		}
+	}
+	if e.Depth != "" {
+		if _, _, err := ParseRepoDepth(e.Depth); err != nil {
+			return fmt.Errorf("deployment %s: %w", e.Name, err)
+		}
+	}
+	if e.Profile != "" {
+		if err := ValidateProfileName(e.Profile); err != nil {
+			return fmt.Errorf("deployment %s: %w", e.Name, err)
+		}
+	}
+	if e.Interval != "" {
+		interval, err := time.ParseDuration(e.Interval)
+		if err != nil || interval < time.Minute {
+			return fmt.Errorf("deployment %s: interval must be a duration of at least 1m, got %q", e.Name, e.Interval)
+		}
+	}
+	if e.Schedule != "" {
+		if _, err := ParseCronSchedule(e.Schedule); err != nil {
+			return fmt.Errorf("deployment %s: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// Spec returns the repository settings of the entry for AddRepo.
+func (e RepoManifestEntry) Spec() RepoSpec {
+	spec := RepoSpec{URL: e.URL, Branch: e.Branch, Tag: e.Tag, Subdir: e.Subdir, Profile: e.Profile}
+	if e.Depth != "" {
+		spec.Depth, spec.FullHistory, _ = ParseRepoDepth(e.Depth)
+	}
+	return spec
+}
+
+// PollInterval returns the entry's poll interval, or zero when it has none.
+func (e RepoManifestEntry) PollInterval() time.Duration {
+	interval, _ := time.ParseDuration(e.Interval)
+	return interval
+}
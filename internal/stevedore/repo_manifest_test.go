@@ -0,0 +1,64 @@
+package stevedore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRepoManifest(t *testing.T) {
+	manifest, err := ParseRepoManifest([]byte(`
+deployments:
+  - name: homepage
+    url: git@github.com:acme/homepage.git
+    profile: prod
+    interval: 10m
+  - name: api
+    url: git@github.com:acme/api.git
+    tag: "v*"
+    subdir: services/api
+    depth: full
+    schedule: "0 3 * * *"
+`))
+	if err != nil {
+		t.Fatalf("ParseRepoManifest: %v", err)
+	}
+	if len(manifest.Deployments) != 2 {
+		t.Fatalf("got %d deployments, want 2", len(manifest.Deployments))
+	}
+	homepage, api := manifest.Deployments[0], manifest.Deployments[1]
+	if homepage.Name != "homepage" || homepage.Spec().Profile != "prod" || homepage.PollInterval() != 10*time.Minute {
+		t.Errorf("homepage = %+v", homepage)
+	}
+	if spec := api.Spec(); spec.Tag != "v*" || spec.Branch != "" || spec.Subdir != "services/api" || !spec.FullHistory || api.PollInterval() != 0 {
+		t.Errorf("api = %+v", api)
+	}
+}
+
+func TestParseRepoManifest_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		wantErr  string
+	}{
+		{"empty", ``, "no deployments"},
+		{"unknown key", "deployments:\n  - name: a\n    url: u\n    brnach: main\n", "brnach"},
+		{"missing url", "deployments:\n  - name: a\n", "url is required"},
+		{"bad name", "deployments:\n  - name: ../a\n    url: u\n", "invalid deployment name"},
+		{"duplicate", "deployments:\n  - name: a\n    url: u\n  - name: a\n    url: u\n", "listed twice"},
+		{"branch and tag", "deployments:\n  - name: a\n    url: u\n    branch: main\n    tag: v*\n", "mutually exclusive"},
+		{"bad subdir", "deployments:\n  - name: a\n    url: u\n    subdir: ../x\n", "invalid subdirectory"},
+		{"bad depth", "deployments:\n  - name: a\n    url: u\n    depth: 0\n", "invalid depth"},
+		{"short interval", "deployments:\n  - name: a\n    url: u\n    interval: 10s\n", "at least 1m"},
+		{"bad profile", "deployments:\n  - name: a\n    url: u\n    profile: Prod\n", "invalid profile name"},
+		{"bad schedule", "deployments:\n  - name: a\n    url: u\n    schedule: nope\n", "invalid cron expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRepoManifest([]byte(tt.manifest))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseRepoManifest() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package stevedore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrRepoAuth means the git host rejected the deploy key or the repository is
+// not visible to it.
+var ErrRepoAuth = errors.New("repository access denied: is the deploy key added to the git host?")
+
+// ErrRefNotFound means the repository is reachable but has no such branch, or
+// no tag matching the pattern.
+var ErrRefNotFound = errors.New("ref not found on the remote")
+
+// repoAuthFailures are ssh/git messages that mean the key is not accepted.
+// GitHub and GitLab answer "Repository not found" for repositories the key
+// cannot see, so a typo in the URL looks like a missing key.
+var repoAuthFailures = []string{
+	"Permission denied",
+	"Could not read from remote repository",
+	"Repository not found",
+	"repository not found",
+	"does not appear to be a git repository",
+	"Host key verification failed",
+	"Authentication failed",
+}
+
+// VerifyRepoAccess checks with `git ls-remote` in a git worker that the deploy
+// key can read the repository and that the tracked branch (or a tag matching
+// the pattern) exists. Failures wrap ErrRepoAuth or ErrRefNotFound.
+func (i *Instance) VerifyRepoAccess(ctx context.Context, deployment string) error {
+	setup, err := i.prepareGitRepo(deployment)
+	if err != nil {
+		return err
+	}
+
+	script := "git ls-remote --heads " + shellQuote(setup.repoURL) + " " + shellQuote("refs/heads/"+setup.branch)
+	if setup.tagPattern != "" {
+		script = "git ls-remote --tags " + shellQuote(setup.repoURL)
+	}
+
+	output, err := i.runGitScript(ctx, deployment, script)
+	if err != nil {
+		return classifyLsRemoteError(setup.repoURL, err)
+	}
+
+	if setup.tagPattern != "" {
+		if _, ok := selectHighestTag(parseLsRemoteTags(output), setup.tagPattern); !ok {
+			return fmt.Errorf("%w: no tags match %q in %s", ErrRefNotFound, setup.tagPattern, setup.repoURL)
+		}
+		return nil
+	}
+	if strings.TrimSpace(output) == "" {
+		return fmt.Errorf("%w: branch %q does not exist in %s", ErrRefNotFound, setup.branch, setup.repoURL)
+	}
+	return nil
+}
+
+// classifyLsRemoteError wraps ErrRepoAuth around ls-remote failures caused by
+// the key or the repository URL.
+func classifyLsRemoteError(repoURL string, err error) error {
+	for _, msg := range repoAuthFailures {
+		if strings.Contains(err.Error(), msg) {
+			return fmt.Errorf("%w (%s): %v", ErrRepoAuth, repoURL, err)
+		}
+	}
+	return fmt.Errorf("git ls-remote failed: %w", err)
+}
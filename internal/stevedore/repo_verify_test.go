@@ -0,0 +1,24 @@
+package stevedore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyLsRemoteError(t *testing.T) {
+	tests := []struct {
+		stderr string
+		auth   bool
+	}{
+		{"git@github.com: Permission denied (publickey).\nfatal: Could not read from remote repository.", true},
+		{"ERROR: Repository not found.\nfatal: Could not read from remote repository.", true},
+		{"Host key verification failed.", true},
+		{"ssh: Could not resolve hostname gihub.com: Name does not resolve", false},
+	}
+	for _, tt := range tests {
+		err := classifyLsRemoteError("git@github.com:acme/app.git", errors.New("exit status 128: "+tt.stderr))
+		if got := errors.Is(err, ErrRepoAuth); got != tt.auth {
+			t.Errorf("classifyLsRemoteError(%q): auth = %v, want %v (%v)", tt.stderr, got, tt.auth, err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package stevedore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServiceScale is the replica count stored for a service with
+// `deploy scale`, and how many of its containers run.
+type ServiceScale struct {
+	Service string `json:"service"`
+	// Replicas is the stored override passed as `--scale service=n`
+	Replicas int `json:"replicas"`
+	// Running is the number of the service's containers that are running
+	Running int `json:"running"`
+}
+
+// ParseServiceScale parses a `<service>=<n>` argument of `deploy scale`.
+func ParseServiceScale(arg string) (string, int, error) {
+	service, count, ok := strings.Cut(arg, "=")
+	service = strings.TrimSpace(service)
+	if !ok || service == "" {
+		return "", 0, fmt.Errorf("invalid scale %q: expected <service>=<n>", arg)
+	}
+	replicas, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || replicas < 0 {
+		return "", 0, fmt.Errorf("invalid scale %q: replicas must be a non-negative number", arg)
+	}
+	return service, replicas, nil
+}
+
+// SetServiceScales stores replica overrides for services of a deployment,
+// keeping the ones stored for other services. Every service must exist in the
+// checked-out compose file. The overrides apply from the next deploy on.
+func (i *Instance) SetServiceScales(ctx context.Context, db *sql.DB, deployment string, scales map[string]int) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+
+	gitDir := i.composeDir(deployment)
+	if _, err := os.Stat(gitDir); err != nil {
+		return fmt.Errorf("repository not checked out: %w", err)
+	}
+	composePath, err := FindComposeEntrypoint(gitDir)
+	if err != nil {
+		return err
+	}
+	composeFiles, err := i.composeFiles(deployment, composePath)
+	if err != nil {
+		return err
+	}
+	services, err := i.getComposeServices(ctx, composeFiles, ComposeProjectName(deployment), gitDir)
+	if err != nil {
+		return err
+	}
+	var unknown []string
+	for service := range scales {
+		if !slices.Contains(services, service) {
+			unknown = append(unknown, service)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown service(s) in %s: %s (services: %s)",
+			filepath.Base(composePath), strings.Join(unknown, ", "), strings.Join(services, ", "))
+	}
+
+	if err := EnsureDeploymentRow(db, deployment); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for service, replicas := range scales {
+		if _, err := tx.Exec(`
+			INSERT INTO service_scales (deployment, service, replicas, updated_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(deployment, service) DO UPDATE SET
+				replicas = excluded.replicas,
+				updated_at = excluded.updated_at
+		`, deployment, service, replicas, now); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetServiceScales returns the replica overrides stored for a deployment.
+func (i *Instance) GetServiceScales(db *sql.DB, deployment string) (map[string]int, error) {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT service, replicas FROM service_scales WHERE deployment = ?`, deployment)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	scales := make(map[string]int)
+	for rows.Next() {
+		var service string
+		var replicas int
+		if err := rows.Scan(&service, &replicas); err != nil {
+			return nil, err
+		}
+		scales[service] = replicas
+	}
+	return scales, rows.Err()
+}
+
+// ClearServiceScales removes the replica overrides of a deployment, so the
+// next deploy uses the counts of the compose file again.
+func (i *Instance) ClearServiceScales(db *sql.DB, deployment string) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+	_, err := db.Exec(`DELETE FROM service_scales WHERE deployment = ?`, deployment)
+	return err
+}
+
+// loadServiceScales opens the database and returns the stored replica
+// overrides of a deployment.
+func (i *Instance) loadServiceScales(deployment string) (map[string]int, error) {
+	db, err := i.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+	return i.GetServiceScales(db, deployment)
+}
+
+// composeScaleArgs returns the `--scale service=n` arguments for the
+// overrides, sorted by service. Overrides for services the compose file no
+// longer declares are skipped, since compose rejects them.
+func composeScaleArgs(scales map[string]int, services []string) []string {
+	names := make([]string, 0, len(scales))
+	for service := range scales {
+		if slices.Contains(services, service) {
+			names = append(names, service)
+		}
+	}
+	sort.Strings(names)
+
+	args := make([]string, 0, 2*len(names))
+	for _, service := range names {
+		args = append(args, "--scale", service+"="+strconv.Itoa(scales[service]))
+	}
+	return args
+}
+
+// serviceScaleStatus reports each override with the number of running
+// containers of its service, sorted by service.
+func serviceScaleStatus(scales map[string]int, containers []ContainerStatus) []ServiceScale {
+	var result []ServiceScale
+	for service, replicas := range scales {
+		scale := ServiceScale{Service: service, Replicas: replicas}
+		for _, c := range containers {
+			if c.Service == service && c.State == StateRunning {
+				scale.Running++
+			}
+		}
+		result = append(result, scale)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].Service < result[b].Service
+	})
+	return result
+}
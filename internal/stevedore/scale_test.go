@@ -0,0 +1,82 @@
+package stevedore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseServiceScale(t *testing.T) {
+	service, replicas, err := ParseServiceScale("worker=3")
+	if err != nil || service != "worker" || replicas != 3 {
+		t.Errorf("ParseServiceScale(worker=3) = %q, %d, %v", service, replicas, err)
+	}
+	for _, arg := range []string{"worker", "=3", "worker=", "worker=-1", "worker=two"} {
+		if _, _, err := ParseServiceScale(arg); err == nil {
+			t.Errorf("ParseServiceScale(%q) should fail", arg)
+		}
+	}
+}
+
+func TestComposeScaleArgs(t *testing.T) {
+	scales := map[string]int{"worker": 3, "cron": 0, "removed": 2}
+	got := composeScaleArgs(scales, []string{"web", "worker", "cron"})
+	want := []string{"--scale", "cron=0", "--scale", "worker=3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("composeScaleArgs = %v, want %v", got, want)
+	}
+}
+
+func TestServiceScaleStatus(t *testing.T) {
+	containers := []ContainerStatus{
+		{Service: "worker", State: StateRunning},
+		{Service: "worker", State: StateRunning},
+		{Service: "worker", State: StateExited},
+		{Service: "web", State: StateRunning},
+	}
+	got := serviceScaleStatus(map[string]int{"worker": 3, "cron": 0}, containers)
+	want := []ServiceScale{
+		{Service: "cron", Replicas: 0, Running: 0},
+		{Service: "worker", Replicas: 3, Running: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("serviceScaleStatus = %+v, want %+v", got, want)
+	}
+}
+
+func TestServiceScales_GetAndClear(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	for _, d := range []string{"app", "other"} {
+		if err := EnsureDeploymentRow(db, d); err != nil {
+			t.Fatalf("EnsureDeploymentRow: %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO service_scales (deployment, service, replicas, updated_at) VALUES (?, 'worker', 3, 0)`, d); err != nil {
+			t.Fatalf("insert scale: %v", err)
+		}
+	}
+
+	scales, err := instance.GetServiceScales(db, "app")
+	if err != nil {
+		t.Fatalf("GetServiceScales: %v", err)
+	}
+	if !reflect.DeepEqual(scales, map[string]int{"worker": 3}) {
+		t.Errorf("scales = %v", scales)
+	}
+
+	if err := instance.ClearServiceScales(db, "app"); err != nil {
+		t.Fatalf("ClearServiceScales: %v", err)
+	}
+	if scales, _ := instance.GetServiceScales(db, "app"); len(scales) != 0 {
+		t.Errorf("scales after clear = %v", scales)
+	}
+	if scales, _ := instance.GetServiceScales(db, "other"); len(scales) != 1 {
+		t.Errorf("clearing app removed other's scales: %v", scales)
+	}
+}
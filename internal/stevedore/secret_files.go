@@ -0,0 +1,107 @@
+package stevedore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ParamFilePrefix marks deployment parameters that are written to files
+// instead of exported as variables: STEVEDORE_FILE_DB_PASSWORD=s3cret is
+// written to secrets/DB_PASSWORD in the deployment directory (mode 0600) and
+// the Compose environment gets DB_PASSWORD_FILE with the path of that file,
+// e.g. for a top-level `secrets:` entry or a bind mount.
+const ParamFilePrefix = "STEVEDORE_FILE_"
+
+// isFileParam reports whether a parameter is materialized as a file.
+func isFileParam(name string) bool {
+	return strings.HasPrefix(name, ParamFilePrefix)
+}
+
+// SecretsDir returns the directory holding a deployment's secret files.
+func (i *Instance) SecretsDir(deployment string) string {
+	return filepath.Join(i.DeploymentDir(deployment), "secrets")
+}
+
+// secretFileName returns the file name for a STEVEDORE_FILE_* parameter.
+func secretFileName(param string) (string, error) {
+	name := strings.TrimPrefix(param, ParamFilePrefix)
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid file parameter %s: expected %s<NAME>", param, ParamFilePrefix)
+	}
+	return name, nil
+}
+
+// secretFileEnv returns the NAME_FILE=<path> variable that points the Compose
+// environment at the file of a STEVEDORE_FILE_* parameter.
+func (i *Instance) secretFileEnv(deployment, param string) (string, bool) {
+	name, err := secretFileName(param)
+	if err != nil {
+		return "", false
+	}
+	return name + "_FILE=" + filepath.Join(i.SecretsDir(deployment), name), true
+}
+
+// LoadSecretFiles returns the deployment's STEVEDORE_FILE_* parameters as a
+// file name → content map.
+func (i *Instance) LoadSecretFiles(deployment string) (map[string]string, error) {
+	names, err := i.ListEffectiveParameters(deployment)
+	if err != nil {
+		return nil, nil // No parameters (deployment might not exist)
+	}
+
+	files := make(map[string]string)
+	for _, param := range names {
+		if !isFileParam(param) {
+			continue
+		}
+		name, err := secretFileName(param)
+		if err != nil {
+			return nil, err
+		}
+		value, err := i.GetParameter(deployment, param)
+		if err != nil {
+			return nil, fmt.Errorf("read file parameter %s: %w", param, err)
+		}
+		files[name] = string(value)
+	}
+	return files, nil
+}
+
+// writeSecretFiles replaces the deployment's secrets directory with one 0600
+// file per entry, so files of removed parameters do not linger.
+func (i *Instance) writeSecretFiles(deployment string, files map[string]string) error {
+	if err := i.removeSecretFiles(deployment); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	dir := i.SecretsDir(deployment)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o600); err != nil {
+			return fmt.Errorf("failed to write secret file %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// removeSecretFiles deletes the deployment's secrets directory.
+func (i *Instance) removeSecretFiles(deployment string) error {
+	if err := os.RemoveAll(i.SecretsDir(deployment)); err != nil {
+		return fmt.Errorf("failed to remove secrets directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package stevedore
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestLoadSecretFiles(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if err := instance.SetParameter("app", "STEVEDORE_FILE_DB_PASSWORD", []byte("s3cret\n")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+	if err := instance.SetParameter("app", "SMTP_HOST", []byte("smtp.example.com")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+
+	files, err := instance.LoadSecretFiles("app")
+	if err != nil {
+		t.Fatalf("LoadSecretFiles: %v", err)
+	}
+	if want := map[string]string{"DB_PASSWORD": "s3cret\n"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+
+	// The environment points at the file and never carries the value
+	env, err := instance.deploymentEnv("app")
+	if err != nil {
+		t.Fatalf("deploymentEnv: %v", err)
+	}
+	path := filepath.Join(instance.SecretsDir("app"), "DB_PASSWORD")
+	if !slices.Contains(env, "DB_PASSWORD_FILE="+path) {
+		t.Errorf("env %v lacks DB_PASSWORD_FILE", env)
+	}
+	for _, kv := range env {
+		if kv == "STEVEDORE_FILE_DB_PASSWORD=s3cret\n" {
+			t.Errorf("env exports the secret value: %q", kv)
+		}
+	}
+}
+
+func TestWriteSecretFiles(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	dir := instance.SecretsDir("app")
+
+	if err := instance.writeSecretFiles("app", map[string]string{"DB_PASSWORD": "s3cret", "OLD": "x"}); err != nil {
+		t.Fatalf("writeSecretFiles: %v", err)
+	}
+	// A second deploy drops files of removed parameters
+	if err := instance.writeSecretFiles("app", map[string]string{"DB_PASSWORD": "rotated"}); err != nil {
+		t.Fatalf("writeSecretFiles: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "DB_PASSWORD"))
+	if err != nil {
+		t.Fatalf("read secret file: %v", err)
+	}
+	if string(data) != "rotated" {
+		t.Errorf("content = %q, want %q", data, "rotated")
+	}
+	info, err := os.Stat(filepath.Join(dir, "DB_PASSWORD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mode = %o, want 600", perm)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "OLD")); !os.IsNotExist(err) {
+		t.Errorf("expected stale secret file to be removed, got %v", err)
+	}
+
+	if err := instance.removeSecretFiles("app"); err != nil {
+		t.Fatalf("removeSecretFiles: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected secrets directory to be removed, got %v", err)
+	}
+}
+
+func TestSecretFileName(t *testing.T) {
+	for _, param := range []string{"STEVEDORE_FILE_", "STEVEDORE_FILE_a/b", "STEVEDORE_FILE_.."} {
+		if _, err := secretFileName(param); err == nil {
+			t.Errorf("secretFileName(%q): expected error", param)
+		}
+	}
+	if name, err := secretFileName("STEVEDORE_FILE_DB_PASSWORD"); err != nil || name != "DB_PASSWORD" {
+		t.Errorf("secretFileName = %q, %v", name, err)
+	}
+}
@@ -3,11 +3,13 @@ package stevedore
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,12 +19,25 @@ type SelfUpdateConfig struct {
 	ContainerName string        // Name of the running stevedore container
 	ImageTag      string        // Tag for the new image (if empty, uses current container's image)
 	BuildTimeout  time.Duration // Timeout for image build (default: 15m)
+	// Number of backup-<timestamp> image tags to keep after an update
+	// (default: STEVEDORE_SELF_UPDATE_KEEP_BACKUPS or 3; at least 1 is
+	// always kept, negative keeps all)
+	BackupRetention int
+	// Run `docker image prune -f` after an update to drop dangling layers
+	// left by the rebuild. Off unless set here or by
+	// STEVEDORE_SELF_UPDATE_PRUNE_DANGLING=true
+	PruneDangling bool
 }
 
+// DefaultBackupRetention is the number of self-update backup images kept by default.
+const DefaultBackupRetention = 3
+
 // SelfUpdate handles updating the stevedore container itself.
 type SelfUpdate struct {
 	instance *Instance
 	config   SelfUpdateConfig
+	// backupTag is the tag BuildNewImage saved the previous image as
+	backupTag string
 }
 
 // NewSelfUpdate creates a new SelfUpdate instance.
@@ -36,6 +51,15 @@ func NewSelfUpdate(instance *Instance, config SelfUpdateConfig) *SelfUpdate {
 	if config.BuildTimeout == 0 {
 		config.BuildTimeout = 15 * time.Minute
 	}
+	if config.BackupRetention == 0 {
+		config.BackupRetention = DefaultBackupRetention
+		if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("STEVEDORE_SELF_UPDATE_KEEP_BACKUPS"))); err == nil {
+			config.BackupRetention = v
+		}
+	}
+	if !config.PruneDangling {
+		config.PruneDangling = strings.TrimSpace(os.Getenv("STEVEDORE_SELF_UPDATE_PRUNE_DANGLING")) == "true"
+	}
 
 	return &SelfUpdate{
 		instance: instance,
@@ -81,7 +105,7 @@ func (s *SelfUpdate) NeedsSelfUpdate(ctx context.Context, currentCommit string)
 
 // getCurrentImageTag gets the image tag of the currently running stevedore container.
 func (s *SelfUpdate) getCurrentImageTag(ctx context.Context) (string, error) {
-	cmd := newCommand(ctx, "docker", "inspect", "--format", "{{.Config.Image}}", s.config.ContainerName)
+	cmd := newDockerCommand(ctx, "inspect", "--format", "{{.Config.Image}}", s.config.ContainerName)
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
 	if err := runCommand(cmd); err != nil {
@@ -97,7 +121,7 @@ func (s *SelfUpdate) tagImageAsBackup(ctx context.Context, currentImage string)
 	baseName := parts[0]
 	backupTag := fmt.Sprintf("%s:backup-%d", baseName, time.Now().Unix())
 
-	cmd := newCommand(ctx, "docker", "tag", currentImage, backupTag)
+	cmd := newDockerCommand(ctx, "tag", currentImage, backupTag)
 	if err := runCommand(cmd); err != nil {
 		return "", fmt.Errorf("tag backup image: %w", err)
 	}
@@ -106,8 +130,199 @@ func (s *SelfUpdate) tagImageAsBackup(ctx context.Context, currentImage string)
 	return backupTag, nil
 }
 
-// BuildNewImage builds a new stevedore image from the deployment checkout.
-func (s *SelfUpdate) BuildNewImage(ctx context.Context) (string, error) {
+// backupTagPrefix marks image tags created by tagImageAsBackup.
+const backupTagPrefix = "backup-"
+
+// Image labels stamped on self-update builds, read back by `self-update history`.
+const (
+	// ImageRevisionLabel holds the git commit the image was built from
+	ImageRevisionLabel = "org.opencontainers.image.revision"
+	// ImageCreatedLabel holds the build time (RFC 3339)
+	ImageCreatedLabel = "org.opencontainers.image.created"
+)
+
+// backupRef is a backup-<timestamp> tag of the stevedore image.
+type backupRef struct {
+	ref string
+	ts  int64
+}
+
+// backupRefs returns the backup-<timestamp> tags of baseName, newest first.
+// refs are "repository:tag" strings as printed by `docker images`.
+func backupRefs(refs []string, baseName string) []backupRef {
+	var backups []backupRef
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		repo, tag, ok := strings.Cut(ref, ":")
+		if !ok || repo != baseName || !strings.HasPrefix(tag, backupTagPrefix) {
+			continue
+		}
+		ts, err := strconv.ParseInt(strings.TrimPrefix(tag, backupTagPrefix), 10, 64)
+		if err != nil {
+			continue // Not one of ours
+		}
+		backups = append(backups, backupRef{ref: ref, ts: ts})
+	}
+	sort.Slice(backups, func(a, b int) bool { return backups[a].ts > backups[b].ts })
+	return backups
+}
+
+// backupTagsToPrune returns the backup-<timestamp> tags of baseName that fall
+// outside the keep most recent ones. A negative keep prunes nothing, and the
+// newest backup (the image the update replaced) is always kept for rollback.
+func backupTagsToPrune(refs []string, baseName string, keep int) []string {
+	if keep < 0 {
+		return nil
+	}
+	if keep < 1 {
+		keep = 1
+	}
+
+	backups := backupRefs(refs, baseName)
+	if len(backups) <= keep {
+		return nil
+	}
+
+	prune := make([]string, 0, len(backups)-keep)
+	for _, b := range backups[keep:] {
+		prune = append(prune, b.ref)
+	}
+	return prune
+}
+
+// listImageRefs returns the "repository:tag" references of baseName.
+func listImageRefs(ctx context.Context, baseName string) ([]string, error) {
+	cmd := newDockerCommand(ctx, "images", "--format", "{{.Repository}}:{{.Tag}}", baseName)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Split(strings.TrimSpace(stdout.String()), "\n"), nil
+}
+
+// BackupImage is an image self-update kept for rollback.
+type BackupImage struct {
+	// Ref is the backup tag, e.g. stevedore:backup-1703456789
+	Ref string `json:"ref"`
+	// BackedUpAt is when the image was replaced by an update (from the tag)
+	BackedUpAt time.Time `json:"backed_up_at"`
+	// ImageID is the docker image ID
+	ImageID string `json:"image_id,omitempty"`
+	// Commit is the git commit the image was built from, when it carries
+	// the ImageRevisionLabel
+	Commit string `json:"commit,omitempty"`
+	// BuiltAt is the ImageCreatedLabel, when present
+	BuiltAt string `json:"built_at,omitempty"`
+}
+
+// BackupImages lists the backup-<timestamp> images of the stevedore image,
+// newest first, with the commit and build time from their labels. Images
+// built before the labels were stamped have no commit.
+func (s *SelfUpdate) BackupImages(ctx context.Context) ([]BackupImage, error) {
+	imageTag, err := s.imageTag(ctx)
+	if err != nil {
+		return nil, err
+	}
+	baseName := strings.Split(imageTag, ":")[0]
+
+	refs, err := listImageRefs(ctx, baseName)
+	if err != nil {
+		return nil, fmt.Errorf("list backup images: %w", err)
+	}
+	backups := backupRefs(refs, baseName)
+	images := make([]BackupImage, 0, len(backups))
+	for _, b := range backups {
+		image := BackupImage{Ref: b.ref, BackedUpAt: time.Unix(b.ts, 0)}
+		image.ImageID, image.Commit, image.BuiltAt = inspectImageLabels(ctx, b.ref)
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// inspectImageLabels returns the ID and build labels of an image. The labels
+// are optional, so failures yield empty values.
+func inspectImageLabels(ctx context.Context, ref string) (id, commit, builtAt string) {
+	cmd := newDockerCommand(ctx, "image", "inspect", "--format",
+		"{{.Id}}\t{{index .Config.Labels \""+ImageRevisionLabel+"\"}}\t{{index .Config.Labels \""+ImageCreatedLabel+"\"}}", ref)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := runCommand(cmd); err != nil {
+		return "", "", ""
+	}
+	return parseImageLabels(stdout.String())
+}
+
+// parseImageLabels parses the tab-separated output of inspectImageLabels.
+// Docker prints "<no value>" for labels an image does not have.
+func parseImageLabels(output string) (id, commit, builtAt string) {
+	fields := strings.Split(strings.TrimSpace(output), "\t")
+	for len(fields) < 3 {
+		fields = append(fields, "")
+	}
+	for n, field := range fields {
+		if field == "<no value>" {
+			fields[n] = ""
+		}
+	}
+	return fields[0], fields[1], fields[2]
+}
+
+// pruneScript returns the update worker commands that remove backup tags
+// beyond the retention limit and, when enabled, dangling images. Workers run
+// them only once the new container answers /readyz, so an update that does
+// not come up keeps its backup for rollback. Failures are logged and never
+// fail the update.
+func (s *SelfUpdate) pruneScript(ctx context.Context, imageTag string) string {
+	baseName := strings.Split(imageTag, ":")[0]
+
+	var script strings.Builder
+	if refs, err := listImageRefs(ctx, baseName); err != nil {
+		log.Printf("Self-update: could not list backup images: %v", err)
+	} else {
+		for _, ref := range backupTagsToPrune(refs, baseName, s.config.BackupRetention) {
+			fmt.Fprintf(&script, `  if docker rmi '%[1]s' > /dev/null 2>> "$LOG_FILE"; then
+    log "Removed old backup image %[1]s"
+  else
+    log "Warning: could not remove old backup image %[1]s"
+  fi
+`, ref)
+		}
+	}
+
+	if s.config.PruneDangling {
+		script.WriteString(`  if PRUNED=$(docker image prune -f 2>> "$LOG_FILE"); then
+    log "Pruned dangling images: $(echo "$PRUNED" | grep '^Total reclaimed space:')"
+  else
+    log "Warning: docker image prune failed"
+  fi
+`)
+	}
+	return strings.TrimRight(script.String(), "\n")
+}
+
+// imageTag returns the tag the new image is built as.
+func (s *SelfUpdate) imageTag(ctx context.Context) (string, error) {
+	if s.config.ImageTag != "" {
+		return s.config.ImageTag, nil
+	}
+	// Use the same tag as the current container
+	imageTag, err := s.getCurrentImageTag(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get current image tag: %w", err)
+	}
+	if imageTag == "" {
+		imageTag = "stevedore:latest"
+	}
+	return imageTag, nil
+}
+
+// BuildNewImage builds a new stevedore image from the deployment checkout,
+// labeled with the commit it was built from (ImageRevisionLabel) and the
+// build time (ImageCreatedLabel) so `self-update history` can map backups to
+// commits.
+func (s *SelfUpdate) BuildNewImage(ctx context.Context, commit string) (string, error) {
 	deployment := "stevedore"
 	gitDir := filepath.Join(s.instance.DeploymentDir(deployment), "repo", "git")
 
@@ -117,18 +332,13 @@ func (s *SelfUpdate) BuildNewImage(ctx context.Context) (string, error) {
 		return "", fmt.Errorf("Dockerfile not found in stevedore checkout: %s", dockerfilePath)
 	}
 
-	// Determine the image tag to use
-	imageTag := s.config.ImageTag
-	if imageTag == "" {
-		// Use the same tag as the current container
-		var err error
-		imageTag, err = s.getCurrentImageTag(ctx)
-		if err != nil {
-			return "", fmt.Errorf("get current image tag: %w", err)
-		}
-		if imageTag == "" {
-			imageTag = "stevedore:latest"
-		}
+	if err := s.instance.EnsureDiskSpace(ctx); err != nil {
+		return "", err
+	}
+
+	imageTag, err := s.imageTag(ctx)
+	if err != nil {
+		return "", err
 	}
 
 	// Tag the current image as backup before overwriting
@@ -137,6 +347,7 @@ func (s *SelfUpdate) BuildNewImage(ctx context.Context) (string, error) {
 		log.Printf("Warning: could not create backup tag: %v", err)
 	} else {
 		log.Printf("Backup image available for rollback: %s", backupTag)
+		s.backupTag = backupTag
 	}
 
 	log.Printf("Building new stevedore image: %s", imageTag)
@@ -144,8 +355,12 @@ func (s *SelfUpdate) BuildNewImage(ctx context.Context) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.config.BuildTimeout)
 	defer cancel()
 
-	cmd := newCommand(ctx, "docker", "build", "-t", imageTag, ".")
+	opts := s.instance.LoadBuildOptions(deployment)
+	args := append([]string{"build", "-t", imageTag}, imageLabelArgs(commit, time.Now())...)
+	args = append(args, opts.dockerBuildArgs()...)
+	cmd := newDockerCommand(ctx, append(args, ".")...)
 	cmd.Dir = gitDir
+	cmd.Env = append(os.Environ(), opts.Env()...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -158,6 +373,65 @@ func (s *SelfUpdate) BuildNewImage(ctx context.Context) (string, error) {
 	return imageTag, nil
 }
 
+// imageLabelArgs returns the `docker build --label` flags stamping the
+// commit (when known) and build time onto a self-update image.
+func imageLabelArgs(commit string, builtAt time.Time) []string {
+	args := []string{"--label", ImageCreatedLabel + "=" + builtAt.UTC().Format(time.RFC3339)}
+	if commit != "" {
+		args = append(args, "--label", ImageRevisionLabel+"="+commit)
+	}
+	return args
+}
+
+// imageVerifyTimeout bounds the smoke test of a freshly built image.
+const imageVerifyTimeout = time.Minute
+
+// VerifyImage runs `/app/stevedore version` from the new image in a
+// throwaway container and checks that it exits cleanly and reports
+// expectedCommit. A build that compiles but cannot start (missing library,
+// wrong entrypoint, crash on init) fails here instead of after the running
+// container has been replaced.
+func (s *SelfUpdate) VerifyImage(ctx context.Context, imageTag string, expectedCommit string) error {
+	ctx, cancel := context.WithTimeout(ctx, imageVerifyTimeout)
+	defer cancel()
+
+	cmd := newDockerCommand(ctx, "run", "--rm",
+		"--label", "com.stevedore.managed=true",
+		"--label", "com.stevedore.role=update-verify",
+		imageTag, "/app/stevedore", "version")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		return fmt.Errorf("new image %s does not run: %w: %s", imageTag, err,
+			strings.TrimSpace(stdout.String()+"\n"+stderr.String()))
+	}
+
+	output := strings.TrimSpace(stdout.String())
+	if expectedCommit != "" && !strings.Contains(output, shortCommit(expectedCommit)) {
+		return fmt.Errorf("new image %s reports %q, expected commit %s", imageTag, output, shortCommit(expectedCommit))
+	}
+	log.Printf("Self-update: verified new image %s: %s", imageTag, output)
+	return nil
+}
+
+// restoreBackup points imageTag back at the image saved by BuildNewImage, so
+// a later restart does not pick up a build that failed verification.
+func (s *SelfUpdate) restoreBackup(ctx context.Context, imageTag string) {
+	if s.backupTag == "" {
+		log.Printf("Warning: no backup image to restore %s from", imageTag)
+		return
+	}
+	cmd := newDockerCommand(ctx, "tag", s.backupTag, imageTag)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		log.Printf("Warning: could not restore %s from %s: %v: %s", imageTag, s.backupTag, err, strings.TrimSpace(stderr.String()))
+		return
+	}
+	log.Printf("Self-update: restored %s from backup %s", imageTag, s.backupTag)
+}
+
 // ManagedBySystemdSentinel is written by the installer when stevedore's
 // container is started by a systemd unit. Its presence tells self-update to
 // short-circuit the worker+docker-run dance and simply exit the process — the
@@ -169,9 +443,7 @@ const ManagedBySystemdSentinel = "managed_by.systemd"
 // IsManagedBySystemd returns true when self-update should defer to systemd
 // rather than recreating the container via a worker + docker run.
 func (s *SelfUpdate) IsManagedBySystemd() bool {
-	sentinel := filepath.Join(s.instance.SystemDir(), ManagedBySystemdSentinel)
-	_, err := os.Stat(sentinel)
-	return err == nil
+	return s.instance.IsManagedBySystemd()
 }
 
 // Execute performs the self-update. If the container is managed by systemd
@@ -183,29 +455,56 @@ func (s *SelfUpdate) IsManagedBySystemd() bool {
 func (s *SelfUpdate) Execute(ctx context.Context, newImageTag string) error {
 	containerName := s.config.ContainerName
 
+	// Validate the container env before stopping anything: the replacement
+	// container (or systemd's restart) is started from it, and a bad file
+	// would leave the host without a running stevedore.
+	if added, err := s.instance.EnsureContainerListenAddr(); err != nil {
+		return err
+	} else if added {
+		log.Printf("Self-update: added %s=%s to %s so the published API port keeps working",
+			ListenAddrEnvVar, PublishedListenAddr, s.instance.ContainerEnvPath())
+	}
+	env, err := s.instance.ReadContainerEnv()
+	if err != nil {
+		return err
+	}
+	if err := env.Validate(newImageTag); err != nil {
+		return err
+	}
+	log.Printf("Self-update: loaded %d env entries from %s", len(env.Entries), env.Path)
+
+	// The swap below (and systemd's restart) happens on the engine that hosts
+	// this container; a remote DOCKER_HOST would replace the wrong container
+	if IsRemoteDockerHost() {
+		log.Printf("Warning: self-update replaces container %s on DOCKER_HOST=%s; it must be the engine running this stevedore", containerName, os.Getenv("DOCKER_HOST"))
+	}
+
+	// Each worker appends to update.log; cap it so repeated updates do not
+	// grow it forever
+	maxBytes, keep := LogRotation()
+	if err := rotateLogIfLarge(s.instance.updateLogPath(), maxBytes, keep); err != nil {
+		log.Printf("Warning: rotate update log: %v", err)
+	}
+
 	if s.IsManagedBySystemd() {
+		// Old images are pruned by a worker that outlives this container and
+		// waits for the one systemd restarts. Without it they are kept.
+		if err := s.spawnPruneWorker(ctx, newImageTag); err != nil {
+			log.Printf("Warning: self-update keeps old images: %v", err)
+		}
 		return s.executeSystemdManaged(newImageTag)
 	}
 
 	log.Printf("Self-update: preparing to replace container %s with image %s", containerName, newImageTag)
 
-	// Get the current container's mount for /opt/stevedore (HOST path)
-	mountsCmd := newCommand(ctx, "docker", "inspect", "--format",
-		"{{range .Mounts}}{{if eq .Destination \"/opt/stevedore\"}}{{.Source}}{{end}}{{end}}",
-		containerName)
-	var mountsOut bytes.Buffer
-	mountsCmd.Stdout = &mountsOut
-	if err := runCommand(mountsCmd); err != nil {
-		return fmt.Errorf("inspect container mounts: %w", err)
-	}
-	hostRoot := strings.TrimSpace(mountsOut.String())
-	if hostRoot == "" {
-		hostRoot = "/opt/stevedore"
+	hostRoot, err := s.hostRoot(ctx)
+	if err != nil {
+		return err
 	}
 	log.Printf("Self-update: using host root: %s", hostRoot)
 
 	// Get restart policy
-	policyCmd := newCommand(ctx, "docker", "inspect", "--format",
+	policyCmd := newDockerCommand(ctx, "inspect", "--format",
 		"{{.HostConfig.RestartPolicy.Name}}", containerName)
 	var policyOut bytes.Buffer
 	policyCmd.Stdout = &policyOut
@@ -220,27 +519,6 @@ func (s *SelfUpdate) Execute(ctx context.Context, newImageTag string) error {
 	// Host paths (for docker run command which runs on the host)
 	hostSystemDir := hostRoot + "/system"
 
-	// Ensure the container env file is present and has entries before stopping anything.
-	envPath := filepath.Join(s.instance.SystemDir(), "container.env")
-	envData, err := os.ReadFile(envPath)
-	if err != nil {
-		return fmt.Errorf("read container env: %w", err)
-	}
-	envCount := 0
-	for _, line := range strings.Split(string(envData), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		if strings.Contains(line, "=") {
-			envCount++
-		}
-	}
-	if envCount == 0 {
-		return fmt.Errorf("container env is empty: %s", envPath)
-	}
-	log.Printf("Self-update: loaded %d env entries from %s", envCount, envPath)
-
 	// Create the update script
 	// IMPORTANT: This script runs inside the worker container, which mounts:
 	//   hostSystemDir -> /worker-data (read-write)
@@ -320,6 +598,8 @@ if docker run -d \
   --restart "%s" \
   $ENV_ARGS \
   -p 42107:42107 \
+  --label com.stevedore.managed=true \
+  --label com.stevedore.role=daemon \
   --cgroupns=host \
   -v /var/run/docker.sock:/var/run/docker.sock \
   -v /var/run/stevedore:/var/run/stevedore \
@@ -333,22 +613,127 @@ else
   exit 1
 fi
 
+# Wait until the new daemon answers /readyz (database open, admin key loaded,
+# poll loop started), not just until the container runs. "stevedore ready"
+# reaches it however the container env configures the API (port, TLS, socket)
+log "Waiting for the new container to become ready..."
+READY=0
+ATTEMPT=0
+while [ "$ATTEMPT" -lt %d ]; do
+  if docker exec "%s" /app/stevedore ready > /dev/null 2>&1; then
+    READY=1
+    break
+  fi
+  ATTEMPT=$((ATTEMPT + 1))
+  sleep 2
+done
+if [ "$READY" -eq 1 ]; then
+  log "New container is ready"
+%s
+else
+  log "Warning: new container not ready after $((ATTEMPT * 2))s; check: docker logs %s"
+  log "Keeping old backup images for rollback"
+fi
+
 log "Update complete!"
 `,
 		containerName, newImageTag, hostRoot, restartPolicy,
 		containerName, containerName,
 		containerName,
-		newImageTag, containerName, restartPolicy, hostRoot, newImageTag)
+		newImageTag, containerName, restartPolicy, hostRoot, newImageTag,
+		selfUpdateReadyAttempts, containerName, s.pruneScript(ctx, newImageTag), containerName)
 
-	// Write the update script to our system directory
-	// The worker will mount this directory and read the script
-	scriptPath := filepath.Join(s.instance.SystemDir(), "update-script.sh")
-	if err := os.WriteFile(scriptPath, []byte(updateScript), 0755); err != nil {
-		return fmt.Errorf("write update script: %w", err)
+	workerName := fmt.Sprintf("stevedore-update-%d", time.Now().Unix())
+	if err := s.spawnWorker(ctx, hostSystemDir, workerName, "update-script.sh", updateScript); err != nil {
+		return err
+	}
+	log.Printf("Self-update initiated. This container will be replaced shortly.")
+
+	return nil
+}
+
+// hostRoot returns the host path mounted as /opt/stevedore into the current
+// container, for the docker commands workers run on the host.
+func (s *SelfUpdate) hostRoot(ctx context.Context) (string, error) {
+	mountsCmd := newDockerCommand(ctx, "inspect", "--format",
+		"{{range .Mounts}}{{if eq .Destination \"/opt/stevedore\"}}{{.Source}}{{end}}{{end}}",
+		s.config.ContainerName)
+	var mountsOut bytes.Buffer
+	mountsCmd.Stdout = &mountsOut
+	if err := runCommand(mountsCmd); err != nil {
+		return "", fmt.Errorf("inspect container mounts: %w", err)
+	}
+	hostRoot := strings.TrimSpace(mountsOut.String())
+	if hostRoot == "" {
+		hostRoot = "/opt/stevedore"
+	}
+	return hostRoot, nil
+}
+
+// spawnPruneWorker starts a worker that waits until systemd has replaced the
+// current container and the new one answers /readyz, then prunes old images.
+func (s *SelfUpdate) spawnPruneWorker(ctx context.Context, newImageTag string) error {
+	containerName := s.config.ContainerName
+	idCmd := newDockerCommand(ctx, "inspect", "--format", "{{.Id}}", containerName)
+	var idOut bytes.Buffer
+	idCmd.Stdout = &idOut
+	if err := runCommand(idCmd); err != nil {
+		return fmt.Errorf("inspect container id: %w", err)
+	}
+	oldID := strings.TrimSpace(idOut.String())
+	if oldID == "" {
+		return fmt.Errorf("container %s has no id", containerName)
+	}
+	hostRoot, err := s.hostRoot(ctx)
+	if err != nil {
+		return err
+	}
+
+	pruneScript := fmt.Sprintf(`#!/bin/sh
+LOG_FILE="/worker-data/update.log"
+
+log() {
+  echo "$@"
+  echo "$(date '+%%Y-%%m-%%d %%H:%%M:%%S') $@" >> "$LOG_FILE" 2>/dev/null || true
+}
+
+# Wait for systemd to restart %[1]s: ready means a different container
+# than the one that started this worker answers /readyz ("stevedore ready")
+log "Prune worker waiting for the restarted container %[1]s..."
+OLD_ID="%[2]s"
+READY=0
+ATTEMPT=0
+while [ "$ATTEMPT" -lt %[3]d ]; do
+  ID=$(docker inspect --format '{{.Id}}' "%[1]s" 2>/dev/null)
+  if [ -n "$ID" ] && [ "$ID" != "$OLD_ID" ] && \
+    docker exec "%[1]s" /app/stevedore ready > /dev/null 2>&1; then
+    READY=1
+    break
+  fi
+  ATTEMPT=$((ATTEMPT + 1))
+  sleep 2
+done
+if [ "$READY" -eq 1 ]; then
+  log "Restarted container is ready"
+%[4]s
+else
+  log "Warning: restarted container not ready after $((ATTEMPT * 2))s; keeping old backup images for rollback"
+fi
+`, containerName, oldID, selfUpdateReadyAttempts, s.pruneScript(ctx, newImageTag))
+
+	workerName := fmt.Sprintf("stevedore-update-prune-%d", time.Now().Unix())
+	return s.spawnWorker(ctx, hostRoot+"/system", workerName, "prune-script.sh", pruneScript)
+}
+
+// spawnWorker writes script to the system directory and runs it in a
+// detached docker:cli container that survives the current one.
+func (s *SelfUpdate) spawnWorker(ctx context.Context, hostSystemDir, workerName, scriptName, script string) error {
+	// The worker mounts the system directory and reads the script from it
+	scriptPath := filepath.Join(s.instance.SystemDir(), scriptName)
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		return fmt.Errorf("write %s: %w", scriptName, err)
 	}
 
-	// Run the update worker container
-	workerName := fmt.Sprintf("stevedore-update-%d", time.Now().Unix())
 	log.Printf("Spawning update worker: %s", workerName)
 
 	// Worker mounts:
@@ -363,10 +748,10 @@ log "Update complete!"
 		"--label", "com.stevedore.managed=true",
 		"--label", "com.stevedore.role=update-worker",
 		"docker:cli",
-		"sh", "-c", "sh /worker-data/update-script.sh",
+		"sh", "-c", "sh /worker-data/" + scriptName,
 	}
 
-	cmd := newCommand(ctx, "docker", args...)
+	cmd := newDockerCommand(ctx, args...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
@@ -375,11 +760,13 @@ log "Update complete!"
 	}
 
 	log.Printf("Update worker spawned: %s", workerName)
-	log.Printf("Self-update initiated. This container will be replaced shortly.")
-
 	return nil
 }
 
+// selfUpdateReadyAttempts is how many times, 2s apart, the update worker
+// polls /readyz of the new container before giving up with a warning.
+const selfUpdateReadyAttempts = 60
+
 // systemdExitDelay is the grace period between the HTTP response being sent
 // and the kill. Long enough for the HTTP client to read the response, short
 // enough that the user feels the restart promptly.
@@ -395,8 +782,7 @@ var systemdExitDelay = 2 * time.Second
 // `docker kill` terminates the container regardless of who called it, which
 // then fires systemd's Restart=always with the new stevedore:latest.
 var killSelfContainerFn = func(containerName string) error {
-	cmd := exec.Command("docker", "kill", containerName)
-	return cmd.Run()
+	return runCommand(newDockerCommand(context.Background(), "kill", containerName))
 }
 
 // exitProcessFn is an injection seam for os.Exit so tests can observe the
@@ -409,12 +795,15 @@ var exitProcessFn = os.Exit
 func (s *SelfUpdate) executeSystemdManaged(newImageTag string) error {
 	log.Printf("Self-update: systemd-managed — image %s tagged, killing container %s in %s so systemd restarts us",
 		newImageTag, s.config.ContainerName, systemdExitDelay)
+	// Resolve the seams now: tests swap them, and a goroutine left over from
+	// one test must not pick up the next test's fakes
+	delay, kill, exit := systemdExitDelay, killSelfContainerFn, exitProcessFn
 	go func() {
-		time.Sleep(systemdExitDelay)
+		time.Sleep(delay)
 		log.Printf("Self-update: docker kill %s — expect systemd to restart within RestartSec", s.config.ContainerName)
-		if err := killSelfContainerFn(s.config.ContainerName); err != nil {
+		if err := kill(s.config.ContainerName); err != nil {
 			log.Printf("Self-update: docker kill failed: %v — falling back to process exit (may not restart if called from docker exec)", err)
-			exitProcessFn(1)
+			exit(1)
 			return
 		}
 		// Belt-and-suspenders: if we were running as the daemon (PID 1), the
@@ -422,11 +811,16 @@ func (s *SelfUpdate) executeSystemdManaged(newImageTag string) error {
 		// `docker exec` subprocess, the daemon dies but our subprocess is still
 		// alive briefly — so give a short grace period, then exit too.
 		time.Sleep(500 * time.Millisecond)
-		exitProcessFn(0)
+		exit(0)
 	}()
 	return nil
 }
 
+// ErrSelfDeployment is returned when the self-deployment is deployed through
+// the generic compose path, which replaces the running daemon container
+// instead of handing over to the self-update worker.
+var ErrSelfDeployment = errors.New("stevedore is the self-deployment")
+
 // IsStevedoreDeployment returns true if the deployment is the stevedore self-deployment.
 func IsStevedoreDeployment(name string) bool {
 	return name == "stevedore"
@@ -450,7 +844,7 @@ func (i *Instance) TriggerSelfUpdate(ctx context.Context, currentCommit string)
 	if err != nil {
 		return false, fmt.Errorf("sync stevedore deployment: %w", err)
 	}
-	log.Printf("Self-update: synced to %s@%s", result.Branch, shortCommit(result.Commit))
+	log.Printf("Self-update: synced to %s@%s", result.Ref(), shortCommit(result.Commit))
 
 	// Check if update is needed
 	selfUpdate := NewSelfUpdate(i, SelfUpdateConfig{})
@@ -467,11 +861,18 @@ func (i *Instance) TriggerSelfUpdate(ctx context.Context, currentCommit string)
 	log.Printf("Self-update: update available (%s -> %s)", shortCommit(currentCommit), shortCommit(newCommit))
 
 	// Build new image
-	newImage, err := selfUpdate.BuildNewImage(ctx)
+	newImage, err := selfUpdate.BuildNewImage(ctx, newCommit)
 	if err != nil {
 		return false, fmt.Errorf("build new image: %w", err)
 	}
 
+	// Never swap to an image that cannot start: the current container keeps running
+	if err := selfUpdate.VerifyImage(ctx, newImage, newCommit); err != nil {
+		log.Printf("Self-update: aborted, keeping the current container: %v", err)
+		selfUpdate.restoreBackup(ctx, newImage)
+		return false, fmt.Errorf("verify new image: %w", err)
+	}
+
 	// Execute update (this spawns a worker that will replace our container)
 	if err := selfUpdate.Execute(ctx, newImage); err != nil {
 		return false, fmt.Errorf("execute self-update: %w", err)
@@ -1,8 +1,12 @@
 package stevedore
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -149,3 +153,183 @@ func TestSelfUpdate_executeSystemdManaged_fallsBackToExitWhenKillFails(t *testin
 type errForTest string
 
 func (e errForTest) Error() string { return string(e) }
+
+func TestBackupTagsToPrune(t *testing.T) {
+	refs := []string{
+		"stevedore:latest",
+		"stevedore:backup-1700000100",
+		"stevedore:backup-1700000300",
+		"stevedore:backup-1700000200",
+		"stevedore:backup-1700000400",
+		"stevedore:backup-manual",
+		"other:backup-1600000000",
+		"",
+	}
+
+	got := backupTagsToPrune(refs, "stevedore", 2)
+	want := []string{"stevedore:backup-1700000200", "stevedore:backup-1700000100"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("backupTagsToPrune(keep=2) = %v, want %v", got, want)
+	}
+
+	if got := backupTagsToPrune(refs, "stevedore", 4); len(got) != 0 {
+		t.Errorf("expected nothing to prune within retention, got %v", got)
+	}
+	if got := backupTagsToPrune(refs, "stevedore", -1); len(got) != 0 {
+		t.Errorf("expected negative retention to keep all, got %v", got)
+	}
+	// The image the update replaced is always kept for rollback
+	if got := backupTagsToPrune(refs, "stevedore", 0); len(got) != 3 || got[0] != "stevedore:backup-1700000300" {
+		t.Errorf("expected the newest backup kept with keep=0, got %v", got)
+	}
+}
+
+func TestSelfUpdate_PruneScript(t *testing.T) {
+	bin := t.TempDir()
+	script := `#!/bin/sh
+[ "$1" = images ] && printf 'stevedore:latest\nstevedore:backup-1700000100\nstevedore:backup-1700000200\n'
+`
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	t.Setenv("STEVEDORE_DOCKER_BIN", "")
+
+	s := NewSelfUpdate(NewInstance(t.TempDir()), SelfUpdateConfig{BackupRetention: 1})
+	got := s.pruneScript(context.Background(), "stevedore:latest")
+	if !strings.Contains(got, "docker rmi 'stevedore:backup-1700000100'") {
+		t.Errorf("prune script does not remove the old backup:\n%s", got)
+	}
+	if strings.Contains(got, "backup-1700000200") || strings.Contains(got, "image prune") {
+		t.Errorf("prune script removes more than the old backup:\n%s", got)
+	}
+
+	s.config.PruneDangling = true
+	if got := s.pruneScript(context.Background(), "stevedore:latest"); !strings.Contains(got, "docker image prune -f") {
+		t.Errorf("prune script does not prune dangling images:\n%s", got)
+	}
+}
+
+func TestNewSelfUpdate_BackupRetentionDefaults(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+
+	s := NewSelfUpdate(instance, SelfUpdateConfig{})
+	if s.config.BackupRetention != DefaultBackupRetention {
+		t.Errorf("BackupRetention = %d, want %d", s.config.BackupRetention, DefaultBackupRetention)
+	}
+	if s.config.PruneDangling {
+		t.Error("expected dangling image pruning to be off by default")
+	}
+
+	t.Setenv("STEVEDORE_SELF_UPDATE_KEEP_BACKUPS", "5")
+	t.Setenv("STEVEDORE_SELF_UPDATE_PRUNE_DANGLING", "true")
+	s = NewSelfUpdate(instance, SelfUpdateConfig{})
+	if s.config.BackupRetention != 5 {
+		t.Errorf("BackupRetention from env = %d, want 5", s.config.BackupRetention)
+	}
+	if !s.config.PruneDangling {
+		t.Error("expected dangling image pruning enabled from env")
+	}
+
+	s = NewSelfUpdate(instance, SelfUpdateConfig{BackupRetention: 1})
+	if s.config.BackupRetention != 1 {
+		t.Errorf("explicit BackupRetention = %d, want 1", s.config.BackupRetention)
+	}
+}
+
+// fakeDockerVersion puts a docker binary on PATH that logs its arguments and
+// answers `docker run` with output, exiting with code.
+func fakeDockerVersion(t *testing.T, output string, code int) string {
+	t.Helper()
+	bin := t.TempDir()
+	argsLog := filepath.Join(bin, "args.log")
+	script := "#!/bin/sh\necho \"$@\" >> " + argsLog + "\n" +
+		"[ \"$1\" = run ] && echo '" + output + "'\nexit " + strconv.Itoa(code) + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	return argsLog
+}
+
+func TestSelfUpdate_VerifyImage(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	s := NewSelfUpdate(NewInstance(t.TempDir()), SelfUpdateConfig{ContainerName: "stevedore"})
+
+	fakeDockerVersion(t, "stevedore 0.11.0 (github.com/jonnyzzz/stevedore@0123456789ab)", 0)
+	if err := s.VerifyImage(context.Background(), "stevedore:latest", commit); err != nil {
+		t.Errorf("VerifyImage with the expected commit: %v", err)
+	}
+
+	fakeDockerVersion(t, "stevedore 0.11.0 (github.com/jonnyzzz/stevedore@fedcba987654)", 0)
+	if err := s.VerifyImage(context.Background(), "stevedore:latest", commit); err == nil || !strings.Contains(err.Error(), "expected commit 0123456789ab") {
+		t.Errorf("VerifyImage with another commit: %v", err)
+	}
+
+	fakeDockerVersion(t, "exec /app/stevedore: no such file or directory", 127)
+	if err := s.VerifyImage(context.Background(), "stevedore:latest", commit); err == nil || !strings.Contains(err.Error(), "does not run") {
+		t.Errorf("VerifyImage with a broken image: %v", err)
+	}
+}
+
+func TestSelfUpdate_restoreBackup(t *testing.T) {
+	argsLog := fakeDockerVersion(t, "", 0)
+	s := NewSelfUpdate(NewInstance(t.TempDir()), SelfUpdateConfig{ContainerName: "stevedore"})
+	s.backupTag = "stevedore:backup-1700000000"
+
+	s.restoreBackup(context.Background(), "stevedore:latest")
+
+	data, err := os.ReadFile(argsLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "tag stevedore:backup-1700000000 stevedore:latest" {
+		t.Errorf("docker called with %q", got)
+	}
+}
+
+func TestSelfUpdate_BackupImages(t *testing.T) {
+	bin := t.TempDir()
+	script := `#!/bin/sh
+case "$1 $2" in
+"images --format") printf 'stevedore:latest\nstevedore:backup-1700000000\nstevedore:backup-1700086400\n' ;;
+"image inspect")
+  case "$5" in
+  stevedore:backup-1700086400) printf 'sha256:new\t0123456789abcdef\t2023-11-15T22:00:00Z\n' ;;
+  *) printf 'sha256:old\t<no value>\t<no value>\n' ;;
+  esac ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	s := NewSelfUpdate(NewInstance(t.TempDir()), SelfUpdateConfig{ImageTag: "stevedore:latest"})
+	images, err := s.BackupImages(context.Background())
+	if err != nil {
+		t.Fatalf("BackupImages: %v", err)
+	}
+	want := []BackupImage{
+		{Ref: "stevedore:backup-1700086400", BackedUpAt: time.Unix(1700086400, 0), ImageID: "sha256:new", Commit: "0123456789abcdef", BuiltAt: "2023-11-15T22:00:00Z"},
+		{Ref: "stevedore:backup-1700000000", BackedUpAt: time.Unix(1700000000, 0), ImageID: "sha256:old"},
+	}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("BackupImages =\n%+v\nwant\n%+v", images, want)
+	}
+}
+
+func TestImageLabelArgs(t *testing.T) {
+	builtAt := time.Date(2026, 10, 16, 12, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	got := imageLabelArgs("0123456789abcdef", builtAt)
+	want := []string{
+		"--label", "org.opencontainers.image.created=2026-10-16T10:30:00Z",
+		"--label", "org.opencontainers.image.revision=0123456789abcdef",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("imageLabelArgs = %v, want %v", got, want)
+	}
+	if got := imageLabelArgs("", builtAt); len(got) != 2 {
+		t.Errorf("expected only the created label without a commit, got %v", got)
+	}
+}
@@ -2,13 +2,24 @@ package stevedore
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,81 +29,289 @@ const (
 	HeaderStevedoreBuild   = "X-Stevedore-Build"
 )
 
+// Daemon API listen settings. The API only listens on loopback unless an
+// address is configured explicitly, so the admin API is not exposed by accident.
+const (
+	DefaultListenAddr = "127.0.0.1:42107"
+	ListenAddrEnvVar  = "STEVEDORE_LISTEN_ADDR"
+	TLSCertEnvVar     = "STEVEDORE_TLS_CERT"
+	TLSKeyEnvVar      = "STEVEDORE_TLS_KEY"
+	APISocketEnvVar   = "STEVEDORE_API_SOCKET"
+	// ListenAddrNone turns the TCP listener off, leaving only the API socket.
+	ListenAddrNone = "none"
+)
+
 // ServerConfig holds configuration for the HTTP server.
 type ServerConfig struct {
 	AdminKey   string
-	ListenAddr string
+	ListenAddr string // TCP address, or ListenAddrNone to serve on SocketPath only
+	// SocketPath is a Unix domain socket the API is served on in addition to
+	// ListenAddr. It serves plain HTTP and is only accessible to its owner.
+	SocketPath  string
+	TLSCertFile string // Serve HTTPS when both TLSCertFile and TLSKeyFile are set
+	TLSKeyFile  string
+	EnablePprof bool // Mount /debug/pprof/ behind the admin key
+	DisableExec bool // Answer /api/exec with 403 Forbidden
+	// ExecRateLimit is how many /api/exec commands may run per minute
+	// (default: DefaultExecRateLimit)
+	ExecRateLimit int
+	// WriteTimeout bounds the fast endpoints such as status and health
+	// (default: DefaultAPIWriteTimeout)
+	WriteTimeout time.Duration
+	// SlowTimeout bounds the endpoints that run git or docker compose: check,
+	// sync, deploy and exec (default: DefaultAPISlowTimeout)
+	SlowTimeout time.Duration
 }
 
+// DefaultExecRateLimit is the default number of /api/exec commands per minute.
+const DefaultExecRateLimit = 30
+
+// Write timeouts of the admin API. A deploy that builds a large image takes
+// far longer than a status request; clients use the same split (see
+// Client.SlowTimeout).
+const (
+	DefaultAPIWriteTimeout = 60 * time.Second
+	DefaultAPISlowTimeout  = 30 * time.Minute
+)
+
 // CommandExecutor executes CLI commands inside the daemon process.
 // This is set by main.go to provide access to the full CLI functionality.
 type CommandExecutor func(args []string) (output string, exitCode int, err error)
 
+// OperationCanceller cancels the operation the daemon runs for a deployment
+// and reports whether one was running.
+type OperationCanceller func(deployment string) bool
+
+// OperationTracker marks a deployment as having an operation in flight, so the
+// daemon leaves it alone and an OperationCanceller can cancel the returned
+// context. The returned func must be called when the operation is done.
+type OperationTracker func(ctx context.Context, deployment string) (context.Context, func())
+
+// ActiveOperationsLister lists the deployments the daemon is currently
+// syncing, deploying or reconciling.
+type ActiveOperationsLister func() []string
+
 // Server provides the HTTP API for Stevedore.
 type Server struct {
-	instance *Instance
-	db       *sql.DB
-	config   ServerConfig
-	server   *http.Server
-	version  string
-	build    string          // Git commit or build hash for strict version matching
-	executor CommandExecutor // Executes CLI commands
+	instance  *Instance
+	db        *sql.DB
+	config    ServerConfig
+	server    *http.Server
+	version   string
+	build     string             // Git commit or build hash for strict version matching
+	executor  CommandExecutor    // Executes CLI commands
+	canceller OperationCanceller // Cancels in-flight daemon operations
+	tracker   OperationTracker   // Registers API deploys as daemon operations
+	active    ActiveOperationsLister
+	events    *EventBus    // Deploy lifecycle events for /api/events
+	execLimit *rateLimiter // Throttles /api/exec
+	jobs      *jobStore    // Deploys started with ?async=true
+	startedAt time.Time
+	// pollLoopStarted is set by the daemon once it polls repositories; until
+	// then /readyz answers 503
+	pollLoopStarted atomic.Bool
 }
 
 // NewServer creates a new HTTP server instance.
 func NewServer(instance *Instance, db *sql.DB, config ServerConfig, version, build string) *Server {
 	if config.ListenAddr == "" {
-		config.ListenAddr = ":42107"
+		config.ListenAddr = DefaultListenAddr
+	}
+	if config.ExecRateLimit <= 0 {
+		config.ExecRateLimit = DefaultExecRateLimit
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = DefaultAPIWriteTimeout
+	}
+	if config.SlowTimeout <= 0 {
+		config.SlowTimeout = DefaultAPISlowTimeout
 	}
 
 	s := &Server{
-		instance: instance,
-		db:       db,
-		config:   config,
-		version:  version,
-		build:    build,
+		instance:  instance,
+		db:        db,
+		config:    config,
+		version:   version,
+		build:     build,
+		execLimit: newRateLimiter(config.ExecRateLimit),
+		jobs:      newJobStore(),
+		startedAt: time.Now(),
+	}
+	if config.DisableExec {
+		log.Printf("API command execution disabled: /api/exec answers 403")
 	}
 
 	mux := http.NewServeMux()
 
-	// Health endpoint - unauthenticated
+	// Liveness and readiness endpoints - unauthenticated
 	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
 
 	// API endpoints - authenticated with version verification
 	mux.HandleFunc("/api/status", s.requireAuth(s.requireVersion(s.handleAPIStatus)))
 	mux.HandleFunc("/api/status/", s.requireAuth(s.requireVersion(s.handleAPIStatusDeployment)))
-	mux.HandleFunc("/api/sync/", s.requireAuth(s.requireVersion(s.handleAPISync)))
-	mux.HandleFunc("/api/deploy/", s.requireAuth(s.requireVersion(s.handleAPIDeploy)))
-	mux.HandleFunc("/api/check/", s.requireAuth(s.requireVersion(s.handleAPICheck)))
-	mux.HandleFunc("/api/exec", s.requireAuth(s.requireVersion(s.handleAPIExec)))
+	mux.HandleFunc("/api/deployments", s.requireAuth(s.requireVersion(s.handleAPIDeployments)))
+	mux.HandleFunc("/api/history/", s.requireAuth(s.requireVersion(s.handleAPIHistory)))
+	mux.HandleFunc("/api/sync/", s.requireAuth(s.requireVersion(s.slow(s.handleAPISync))))
+	mux.HandleFunc("/api/deploy/", s.requireAuth(s.requireVersion(s.slow(s.handleAPIDeploy))))
+	mux.HandleFunc("/api/check/", s.requireAuth(s.requireVersion(s.slow(s.handleAPICheck))))
+	mux.HandleFunc("/api/jobs/", s.requireAuth(s.requireVersion(s.handleAPIJob)))
+	mux.HandleFunc("/api/cancel/", s.requireAuth(s.requireVersion(s.handleAPICancel)))
+	mux.HandleFunc("/api/exec", s.requireAuth(s.requireVersion(s.slow(s.handleAPIExec))))
+	mux.HandleFunc("/api/debug", s.requireAuth(s.requireVersion(s.handleAPIDebug)))
+	// No version headers, so dashboards and curl can subscribe
+	mux.HandleFunc("/api/events", s.requireAuth(s.handleAPIEvents))
+
+	// Profiling is opt-in. No version headers, so curl can fetch profiles
+	if config.EnablePprof {
+		log.Printf("Profiling enabled: /debug/pprof/ (admin key required)")
+		mux.HandleFunc("/debug/pprof/", s.requireAuth(pprof.Index))
+		mux.HandleFunc("/debug/pprof/cmdline", s.requireAuth(pprof.Cmdline))
+		mux.HandleFunc("/debug/pprof/profile", s.requireAuth(pprof.Profile))
+		mux.HandleFunc("/debug/pprof/symbol", s.requireAuth(pprof.Symbol))
+		mux.HandleFunc("/debug/pprof/trace", s.requireAuth(pprof.Trace))
+	}
 
 	s.server = &http.Server{
 		Addr:         config.ListenAddr,
 		Handler:      mux,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 60 * time.Second,
+		WriteTimeout: config.WriteTimeout,
 		IdleTimeout:  120 * time.Second,
 	}
 
 	return s
 }
 
+// slow extends the write deadline of a handler that runs git or docker
+// compose from the server's WriteTimeout to its SlowTimeout, so a long build
+// is not cut off while it still runs.
+func (s *Server) slow(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(s.config.SlowTimeout))
+		next(w, r)
+	}
+}
+
 // SetExecutor sets the command executor for the /api/exec endpoint.
 func (s *Server) SetExecutor(executor CommandExecutor) {
 	s.executor = executor
 }
 
-// Start starts the HTTP server in a goroutine.
+// SetCanceller sets the canceller for the /api/cancel endpoint.
+func (s *Server) SetCanceller(canceller OperationCanceller) {
+	s.canceller = canceller
+}
+
+// SetOperationTracker sets the tracker API deploys run under.
+func (s *Server) SetOperationTracker(tracker OperationTracker) {
+	s.tracker = tracker
+}
+
+// SetActiveOperations sets the lister for the /api/debug endpoint.
+func (s *Server) SetActiveOperations(active ActiveOperationsLister) {
+	s.active = active
+}
+
+// MarkPollLoopStarted records that the daemon's poll loop runs, the last
+// subsystem /readyz waits for.
+func (s *Server) MarkPollLoopStarted() {
+	s.pollLoopStarted.Store(true)
+}
+
+// SetEventBus sets the deploy event bus the /api/events endpoint streams.
+func (s *Server) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// Start binds the listen address and the API socket, if configured, and
+// serves them in goroutines. Bind and certificate errors are returned instead
+// of logged, so a misconfigured daemon fails at startup.
 func (s *Server) Start() error {
-	go func() {
-		log.Printf("HTTP server listening on %s", s.config.ListenAddr)
-		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Printf("HTTP server error: %v", err)
+	scheme := "http"
+	if s.config.TLSCertFile != "" || s.config.TLSKeyFile != "" {
+		if s.config.TLSCertFile == "" || s.config.TLSKeyFile == "" {
+			return errors.New("TLS needs both a certificate and a key")
 		}
-	}()
+		cert, err := tls.LoadX509KeyPair(s.config.TLSCertFile, s.config.TLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("load TLS certificate: %w", err)
+		}
+		s.server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		scheme = "https"
+	}
+
+	tcpEnabled := s.config.ListenAddr != ListenAddrNone
+	if !tcpEnabled && s.config.SocketPath == "" {
+		return fmt.Errorf("listen address %q needs an API socket", ListenAddrNone)
+	}
+
+	var socket net.Listener
+	if s.config.SocketPath != "" {
+		var err error
+		if socket, err = listenAPISocket(s.config.SocketPath); err != nil {
+			return err
+		}
+	}
+
+	if tcpEnabled {
+		listener, err := net.Listen("tcp", s.config.ListenAddr)
+		if err != nil {
+			if socket != nil {
+				_ = socket.Close()
+			}
+			return fmt.Errorf("listen on %s: %w", s.config.ListenAddr, err)
+		}
+		go func() {
+			log.Printf("HTTP server listening on %s://%s", scheme, listener.Addr())
+			var err error
+			if s.server.TLSConfig != nil {
+				err = s.server.ServeTLS(listener, "", "")
+			} else {
+				err = s.server.Serve(listener)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("HTTP server error: %v", err)
+			}
+		}()
+	}
+
+	if socket != nil {
+		go func() {
+			log.Printf("HTTP server listening on unix://%s", s.config.SocketPath)
+			if err := s.server.Serve(socket); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("HTTP server error: %v", err)
+			}
+		}()
+	}
 	return nil
 }
 
+// listenAPISocket binds the admin API socket, replacing a stale one left by
+// a previous daemon. Only the daemon's user may connect: the socket carries
+// the full admin API, so it must not be placed in the query socket directory
+// that deployments mount.
+func listenAPISocket(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create API socket directory: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("remove stale API socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("set API socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
 // Shutdown gracefully shuts down the HTTP server.
 func (s *Server) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
@@ -168,6 +387,36 @@ func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, http.StatusOK, response)
 }
 
+// handleReadyz handles GET /readyz: whether the daemon is ready to serve,
+// unlike /healthz, which only tells the process responds. It lists each
+// subsystem (database open, admin key loaded, poll loop started) and answers
+// 503 Service Unavailable until all of them are.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	subsystems := map[string]bool{
+		"database": s.db != nil && s.db.PingContext(r.Context()) == nil,
+		"adminKey": s.config.AdminKey != "",
+		"pollLoop": s.pollLoopStarted.Load(),
+	}
+	status, code := "ready", http.StatusOK
+	for _, ready := range subsystems {
+		if !ready {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+
+	s.jsonResponse(w, code, map[string]interface{}{
+		"status":     status,
+		"version":    s.version,
+		"build":      s.build,
+		"subsystems": subsystems,
+	})
+}
+
 // handleAPIStatus handles GET /api/status - list all deployments.
 func (s *Server) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -185,46 +434,315 @@ func (s *Server) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
 
 	var results []map[string]interface{}
 	for _, d := range deployments {
-		status, err := s.instance.GetDeploymentStatus(ctx, d)
+		results = append(results, s.deploymentSummary(ctx, d))
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"deployments": results,
+	})
+}
+
+// serviceHealthJSON renders the per-service health of a status in the API's
+// camelCase style.
+func serviceHealthJSON(services map[string]ServiceHealth) map[string]interface{} {
+	result := make(map[string]interface{}, len(services))
+	for name, sh := range services {
+		result[name] = map[string]interface{}{
+			"healthy":      sh.Healthy,
+			"healthyCount": sh.HealthyCount,
+			"totalCount":   sh.TotalCount,
+		}
+	}
+	return result
+}
+
+// deploymentSummary is the per-deployment entry of /api/status and
+// /api/deployments. Status errors are reported in the entry, not as a failure.
+func (s *Server) deploymentSummary(ctx context.Context, d string) map[string]interface{} {
+	status, err := s.instance.GetDeploymentStatus(ctx, d)
+	if err != nil {
+		return map[string]interface{}{
+			"deployment": d,
+			"error":      err.Error(),
+		}
+	}
+
+	syncStatus, _ := s.instance.GetSyncStatus(s.db, d)
+
+	result := map[string]interface{}{
+		"deployment":  d,
+		"healthy":     status.Healthy,
+		"message":     status.Message,
+		"containers":  len(status.Containers),
+		"projectName": status.ProjectName,
+	}
+
+	if syncStatus != nil && syncStatus.LastCommit != "" {
+		result["lastCommit"] = syncStatus.LastCommit
+		addCommitInfo(result, syncStatus.LastCommitInfo)
+		if syncStatus.LastTag != "" {
+			result["lastTag"] = syncStatus.LastTag
+		}
+		if !syncStatus.LastSyncAt.IsZero() {
+			result["lastSyncAt"] = syncStatus.LastSyncAt.Format(time.RFC3339)
+		}
+		if !syncStatus.LastDeployAt.IsZero() {
+			result["lastDeployAt"] = syncStatus.LastDeployAt.Format(time.RFC3339)
+		}
+		if syncStatus.LastError != "" {
+			result["lastError"] = syncStatus.LastError
+		}
+		if retry := syncStatus.NextSyncRetry(); !retry.IsZero() {
+			result["syncFailures"] = syncStatus.SyncFailures
+			result["nextSyncRetryAt"] = retry.Format(time.RFC3339)
+		}
+		if syncStatus.UpdateAvailable != "" {
+			result["updateAvailable"] = syncStatus.UpdateAvailable
+		}
+	}
+	if tags, _ := s.instance.GetDeploymentTags(s.db, d); len(tags) > 0 {
+		result["tags"] = tags
+	}
+	return result
+}
+
+// handleAPIDeployments handles GET /api/deployments - a filtered, paginated
+// deployment list. Query parameters: prefix (name prefix), tag, healthy (true
+// or false), limit and offset. Status is computed only for deployments that can
+// end up in the page: all prefix matches when filtering by health, otherwise
+// just the requested page.
+func (s *Server) handleAPIDeployments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+
+	var healthy *bool
+	if value := query.Get("healthy"); value != "" {
+		parsed, err := strconv.ParseBool(value)
 		if err != nil {
-			results = append(results, map[string]interface{}{
-				"deployment": d,
-				"error":      err.Error(),
-			})
-			continue
+			s.jsonError(w, http.StatusBadRequest, fmt.Sprintf("invalid healthy: %q (true or false)", value))
+			return
 		}
+		healthy = &parsed
+	}
 
-		syncStatus, _ := s.instance.GetSyncStatus(s.db, d)
+	limit, err := nonNegativeQueryInt(query, "limit")
+	if err != nil {
+		s.jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, err := nonNegativeQueryInt(query, "offset")
+	if err != nil {
+		s.jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
 
-		result := map[string]interface{}{
-			"deployment":  d,
-			"healthy":     status.Healthy,
-			"message":     status.Message,
-			"containers":  len(status.Containers),
-			"projectName": status.ProjectName,
+	var deployments []string
+	if tag := query.Get("tag"); tag != "" {
+		if err := ValidateDeploymentTag(tag); err != nil {
+			s.jsonError(w, http.StatusBadRequest, err.Error())
+			return
 		}
+		deployments, err = s.instance.DeploymentsWithTag(s.db, tag)
+	} else {
+		deployments, err = s.instance.ListDeployments()
+	}
+	if err != nil {
+		s.jsonError(w, http.StatusInternalServerError, fmt.Sprintf("list deployments: %v", err))
+		return
+	}
+	sort.Strings(deployments)
 
-		if syncStatus != nil && syncStatus.LastCommit != "" {
-			result["lastCommit"] = syncStatus.LastCommit
-			if !syncStatus.LastSyncAt.IsZero() {
-				result["lastSyncAt"] = syncStatus.LastSyncAt.Format(time.RFC3339)
-			}
-			if !syncStatus.LastDeployAt.IsZero() {
-				result["lastDeployAt"] = syncStatus.LastDeployAt.Format(time.RFC3339)
-			}
-			if syncStatus.LastError != "" {
-				result["lastError"] = syncStatus.LastError
+	var names []string
+	for _, d := range deployments {
+		if strings.HasPrefix(d, prefix) {
+			names = append(names, d)
+		}
+	}
+
+	var matched []map[string]interface{}
+	if healthy != nil {
+		for _, d := range names {
+			// Deployments whose status cannot be read count as unhealthy
+			summary := s.deploymentSummary(ctx, d)
+			if isHealthy, _ := summary["healthy"].(bool); isHealthy == *healthy {
+				matched = append(matched, summary)
 			}
 		}
+	}
 
-		results = append(results, result)
+	total := len(names)
+	if healthy != nil {
+		total = len(matched)
+	}
+	start := min(offset, total)
+	end := total
+	if limit > 0 {
+		end = min(start+limit, total)
+	}
+
+	results := []map[string]interface{}{}
+	if healthy != nil {
+		results = append(results, matched[start:end]...)
+	} else {
+		for _, d := range names[start:end] {
+			results = append(results, s.deploymentSummary(ctx, d))
+		}
 	}
 
 	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
 		"deployments": results,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
+// addCommitInfo adds the metadata of the last synced commit, when known, to
+// a status response.
+func addCommitInfo(result map[string]interface{}, info CommitInfo) {
+	if info.Subject != "" {
+		result["lastCommitSubject"] = info.Subject
+	}
+	if info.Author != "" {
+		result["lastCommitAuthor"] = info.Author
+	}
+	if !info.Date.IsZero() {
+		result["lastCommitDate"] = info.Date.Format(time.RFC3339)
+	}
+}
+
+// nonNegativeQueryInt parses an optional non-negative integer query parameter;
+// a missing parameter is 0.
+func nonNegativeQueryInt(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %q (non-negative integer)", name, value)
+	}
+	return n, nil
+}
+
+// handleAPIDebug handles GET /api/debug - runtime counters for diagnosing a
+// long-running daemon: goroutines, memory and the operations in flight.
+func (s *Server) handleAPIDebug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	active := []string{}
+	if s.active != nil {
+		active = append(active, s.active()...)
+	}
+
+	memory := map[string]interface{}{
+		"allocBytes":      mem.Alloc,
+		"totalAllocBytes": mem.TotalAlloc,
+		"sysBytes":        mem.Sys,
+		"heapInuseBytes":  mem.HeapInuse,
+		"heapObjects":     mem.HeapObjects,
+		"numGC":           mem.NumGC,
+		"gcPauseTotalNs":  mem.PauseTotalNs,
+	}
+	if mem.LastGC != 0 {
+		memory["lastGC"] = time.Unix(0, int64(mem.LastGC)).UTC().Format(time.RFC3339)
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"goVersion":        runtime.Version(),
+		"startedAt":        s.startedAt.UTC().Format(time.RFC3339),
+		"uptimeSeconds":    int64(time.Since(s.startedAt).Seconds()),
+		"goroutines":       runtime.NumGoroutine(),
+		"memory":           memory,
+		"activeOperations": active,
+		"pprof":            s.config.EnablePprof,
 	})
 }
 
+// eventsKeepAlive is how often /api/events writes a comment to keep idle
+// connections (and proxies in between) from timing out.
+const eventsKeepAlive = 30 * time.Second
+
+// handleAPIEvents handles GET /api/events - a Server-Sent Events stream of
+// deploy lifecycle events. ?since=<unix seconds> first replays the buffered
+// events newer than that, so a reconnecting client does not miss any.
+func (s *Server) handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.events == nil {
+		s.jsonError(w, http.StatusServiceUnavailable, "event stream not available")
+		return
+	}
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			s.jsonError(w, http.StatusBadRequest, "since must be a unix timestamp")
+			return
+		}
+		since = time.Unix(seconds, 0)
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	ch := s.events.Subscribe()
+	defer s.events.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if !since.IsZero() {
+		for _, event := range s.events.EventsSince(since) {
+			writeServerSentEvent(w, event)
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-ch:
+			writeServerSentEvent(w, event)
+		case <-keepAlive.C:
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeServerSentEvent writes one event in text/event-stream format.
+func writeServerSentEvent(w io.Writer, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
 // handleAPIStatusDeployment handles GET /api/status/{name} - get specific deployment status.
 func (s *Server) handleAPIStatusDeployment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -251,31 +769,79 @@ func (s *Server) handleAPIStatusDeployment(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Resource usage is opt-in: docker stats is slow compared to inspect
+	withStats := r.URL.Query().Get("stats") == "true"
+	if withStats {
+		if err := s.instance.CollectContainerStats(ctx, status); err != nil {
+			s.jsonError(w, http.StatusInternalServerError, fmt.Sprintf("get stats: %v", err))
+			return
+		}
+	}
+
 	syncStatus, _ := s.instance.GetSyncStatus(s.db, deployment)
 
 	containers := make([]map[string]interface{}, len(status.Containers))
 	for i, c := range status.Containers {
 		containers[i] = map[string]interface{}{
-			"id":      c.ID,
-			"name":    c.Name,
-			"service": c.Service,
-			"image":   c.Image,
-			"state":   string(c.State),
-			"health":  string(c.Health),
-			"status":  c.Status,
+			"id":       c.ID,
+			"name":     c.Name,
+			"service":  c.Service,
+			"image":    c.Image,
+			"state":    string(c.State),
+			"health":   string(c.Health),
+			"status":   c.Status,
+			"restarts": c.RestartCount,
+		}
+		if c.ImageID != "" {
+			containers[i]["imageId"] = c.ImageID
+		}
+		if c.ImageDigest != "" {
+			containers[i]["imageDigest"] = c.ImageDigest
+		}
+		if c.ProbeError != "" {
+			containers[i]["probeError"] = c.ProbeError
+		}
+		if withStats && c.State == StateRunning {
+			containers[i]["cpuPercent"] = c.CPUPercent
+			containers[i]["memUsage"] = c.MemUsage
+			containers[i]["memPercent"] = c.MemPercent
 		}
 	}
 
 	result := map[string]interface{}{
-		"deployment":  deployment,
-		"projectName": status.ProjectName,
-		"healthy":     status.Healthy,
-		"message":     status.Message,
-		"containers":  containers,
+		"deployment":   deployment,
+		"projectName":  status.ProjectName,
+		"healthy":      status.Healthy,
+		"message":      status.Message,
+		"healthyCount": status.HealthyCount,
+		"totalCount":   status.TotalCount,
+		"services":     serviceHealthJSON(status.Services),
+		"containers":   containers,
+	}
+
+	if config, err := s.instance.GetRepoConfig(s.db, deployment); err == nil {
+		result["desiredState"] = config.DesiredState
+		if config.Archived {
+			result["archived"] = true
+		}
+		if config.Schedule != "" {
+			result["schedule"] = config.Schedule
+		}
+	}
+	if crash, err := s.instance.GetCrashLoop(s.db, deployment); err == nil && crash != nil {
+		result["crashLoop"] = map[string]interface{}{
+			"restarts":   crash.Restarts,
+			"window":     crash.Window.String(),
+			"detectedAt": crash.DetectedAt.Format(time.RFC3339),
+		}
 	}
 
 	if syncStatus != nil {
 		result["lastCommit"] = syncStatus.LastCommit
+		addCommitInfo(result, syncStatus.LastCommitInfo)
+		if syncStatus.LastTag != "" {
+			result["lastTag"] = syncStatus.LastTag
+		}
 		if !syncStatus.LastSyncAt.IsZero() {
 			result["lastSyncAt"] = syncStatus.LastSyncAt.Format(time.RFC3339)
 		}
@@ -288,11 +854,59 @@ func (s *Server) handleAPIStatusDeployment(w http.ResponseWriter, r *http.Reques
 				result["lastErrorAt"] = syncStatus.LastErrorAt.Format(time.RFC3339)
 			}
 		}
+		if retry := syncStatus.NextSyncRetry(); !retry.IsZero() {
+			result["syncFailures"] = syncStatus.SyncFailures
+			result["nextSyncRetryAt"] = retry.Format(time.RFC3339)
+		}
+		if syncStatus.UpdateAvailable != "" {
+			result["updateAvailable"] = syncStatus.UpdateAvailable
+		}
 	}
 
 	s.jsonResponse(w, http.StatusOK, result)
 }
 
+// handleAPIHistory handles GET /api/history/{name} - recent deploys of a
+// deployment, newest first. The limit query parameter caps the entries.
+func (s *Server) handleAPIHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	deployment := strings.TrimPrefix(r.URL.Path, "/api/history/")
+	if deployment == "" {
+		s.jsonError(w, http.StatusBadRequest, "missing deployment name")
+		return
+	}
+
+	if err := ValidateDeploymentName(deployment); err != nil {
+		s.jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := os.Stat(s.instance.DeploymentDir(deployment)); err != nil {
+		s.jsonError(w, http.StatusNotFound, fmt.Sprintf("deployment not found: %s", deployment))
+		return
+	}
+
+	limit, err := nonNegativeQueryInt(r.URL.Query(), "limit")
+	if err != nil {
+		s.jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, err := s.instance.DeployHistory(deployment, limit)
+	if err != nil {
+		s.jsonError(w, http.StatusInternalServerError, fmt.Sprintf("deploy history: %v", err))
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"deployment": deployment,
+		"deploys":    records,
+	})
+}
+
 // handleAPISync handles POST /api/sync/{name} - trigger sync for a deployment.
 func (s *Server) handleAPISync(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -325,13 +939,27 @@ func (s *Server) handleAPISync(w http.ResponseWriter, r *http.Request) {
 	if err := s.instance.UpdateSyncStatus(s.db, deployment, result.Commit); err != nil {
 		log.Printf("warning: failed to update sync status: %v", err)
 	}
+	if err := s.instance.UpdateSyncCommitInfo(s.db, deployment, result.CommitInfo); err != nil {
+		log.Printf("warning: failed to record commit metadata: %v", err)
+	}
+	if result.Tag != "" {
+		if err := s.instance.UpdateSyncTag(s.db, deployment, result.Tag); err != nil {
+			log.Printf("warning: failed to record synced tag: %v", err)
+		}
+	}
 
-	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
-		"deployment": deployment,
-		"commit":     result.Commit,
-		"branch":     result.Branch,
-		"synced":     true,
-	})
+	response := map[string]interface{}{
+		"deployment":   deployment,
+		"commit":       result.Commit,
+		"branch":       result.Branch,
+		"removedFiles": result.RemovedFiles,
+		"synced":       true,
+	}
+	if result.Tag != "" {
+		response["tag"] = result.Tag
+	}
+
+	s.jsonResponse(w, http.StatusOK, response)
 }
 
 // handleAPIDeploy handles POST /api/deploy/{name} - trigger deploy for a deployment.
@@ -354,29 +982,257 @@ func (s *Server) handleAPIDeploy(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
+	if err := s.instance.CheckNotArchived(s.db, deployment); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrDeploymentArchived) {
+			status = http.StatusConflict
+		}
+		s.jsonError(w, status, err.Error())
+		return
+	}
+
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		s.startDeployJob(w, deployment)
+		return
+	}
+
 	log.Printf("API: triggering deploy for %s", deployment)
 
-	result, err := s.instance.Deploy(ctx, deployment, ComposeConfig{Build: true})
+	result, status, err := s.deployAndEnable(ctx, deployment, nil, nil)
 	if err != nil {
-		s.jsonError(w, http.StatusInternalServerError, fmt.Sprintf("deploy failed: %v", err))
+		message, logs := s.deployFailure(deployment, err)
+		if logs != nil {
+			s.jsonResponse(w, status, map[string]interface{}{
+				"error": message,
+				"logs":  logs,
+			})
+			return
+		}
+		s.jsonError(w, status, message)
 		return
 	}
 
+	s.jsonResponse(w, http.StatusOK, result)
+}
+
+// deployAndEnable deploys a deployment once a deploy slot is free, calling
+// started (if set) when it begins and copying the compose output to output
+// (if set), and marks the deployment enabled and desired up. While queued and
+// running, the deploy is tracked as the deployment's daemon operation, so
+// `deploy cancel` stops it and the poll loop does not deploy it concurrently.
+// A failure comes with the HTTP status to report it with; a failed deploy
+// keeps its StartupLogsError in the chain.
+func (s *Server) deployAndEnable(ctx context.Context, deployment string, started func(), output io.Writer) (*APIDeployResult, int, error) {
+	if s.tracker != nil {
+		var done func()
+		ctx, done = s.tracker(ctx, deployment)
+		defer done()
+	}
+
+	release, err := deploySlots.acquire(ctx, deployment)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("deploy cancelled while queued: %w", err)
+	}
+	defer release()
+	if started != nil {
+		started()
+	}
+
+	result, err := s.instance.Deploy(ctx, deployment, ComposeConfig{Build: true, Output: output})
+	if err != nil {
+		_ = s.instance.UpdateDeployError(s.db, deployment, err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("deploy failed: %w", err)
+	}
+
 	if err := s.instance.SetDeploymentEnabled(s.db, deployment, true); err != nil {
-		s.jsonError(w, http.StatusInternalServerError, fmt.Sprintf("enable deployment: %v", err))
-		return
+		return nil, http.StatusInternalServerError, fmt.Errorf("enable deployment: %w", err)
+	}
+	if err := s.instance.SetDesiredState(s.db, deployment, DesiredStateUp); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("set desired state: %w", err)
 	}
 	if err := s.instance.UpdateDeployStatus(s.db, deployment); err != nil {
 		log.Printf("warning: failed to update deploy status: %v", err)
 	}
 
-	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
-		"deployment":  deployment,
-		"projectName": result.ProjectName,
-		"composeFile": result.ComposeFile,
-		"services":    result.Services,
-		"deployed":    true,
-	})
+	return &APIDeployResult{
+		Deployment:  deployment,
+		ProjectName: result.ProjectName,
+		ComposeFile: result.ComposeFile,
+		Services:    result.Services,
+		Hooks:       apiHookResults(result.Hooks),
+		Timings:     apiServiceTimings(result.Timings),
+		Deployed:    true,
+	}, http.StatusOK, nil
+}
+
+// deployFailure returns the error message and container logs a failed deploy
+// is reported with in the API, with the deployment's secrets redacted.
+func (s *Server) deployFailure(deployment string, err error) (string, []ContainerLog) {
+	redactor := s.instance.secretRedactor(deployment)
+	var logsErr *StartupLogsError
+	if errors.As(err, &logsErr) {
+		return redactor.text(fmt.Sprintf("deploy failed: %v", logsErr.Err)), redactor.logs(logsErr.Logs)
+	}
+	return redactor.text(err.Error()), nil
+}
+
+// startDeployJob answers POST /api/deploy/{name}?async=true with 202 and a
+// job ID, and deploys in the background. The deploy is bounded by the slow
+// API timeout instead of the request, which ends right away, and is cancelled
+// with `deploy cancel`.
+func (s *Server) startDeployJob(w http.ResponseWriter, deployment string) {
+	job, err := s.jobs.add(deployment)
+	if err != nil {
+		s.jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("API: triggering deploy for %s (job %s)", deployment, job.ID)
+	output, _ := s.jobs.output(job.ID)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.SlowTimeout)
+		defer cancel()
+		// Closed after the final job state is stored, which followers then read
+		defer output.close()
+
+		result, _, err := s.deployAndEnable(ctx, deployment, func() {
+			s.jobs.update(job.ID, func(j *DeployJob) {
+				now := time.Now()
+				j.Status = JobRunning
+				j.Progress = "deploying"
+				j.StartedAt = &now
+			})
+		}, output)
+
+		s.jobs.update(job.ID, func(j *DeployJob) {
+			now := time.Now()
+			j.FinishedAt = &now
+			if err != nil {
+				j.Status = JobFailed
+				j.Progress = "failed"
+				j.Error, j.Logs = s.deployFailure(deployment, err)
+				return
+			}
+			j.Status = JobSucceeded
+			j.Progress = "deployed"
+			j.Result = result
+		})
+		if err != nil {
+			log.Printf("API: deploy job %s for %s failed: %v", job.ID, deployment, err)
+		}
+	}()
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	s.jsonResponse(w, http.StatusAccepted, job)
+}
+
+// handleAPIJob handles GET /api/jobs/{id} - the status, progress and result
+// of an asynchronous deploy - and GET /api/jobs/{id}/output.
+func (s *Server) handleAPIJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+	if id == "" {
+		s.jsonError(w, http.StatusBadRequest, "missing job ID")
+		return
+	}
+	if id, ok := strings.CutSuffix(id, "/output"); ok {
+		s.handleAPIJobOutput(w, r, id)
+		return
+	}
+
+	job, ok := s.jobs.get(id)
+	if !ok {
+		s.jsonError(w, http.StatusNotFound, fmt.Sprintf("unknown job: %s (jobs are kept in memory until the daemon restarts)", id))
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, job)
+}
+
+// handleAPIJobOutput handles GET /api/jobs/{id}/output - a Server-Sent
+// Events stream of the job's `docker compose build` and `up` output: an
+// `output` event per line, from the first one, and a `done` event with the
+// finished job.
+func (s *Server) handleAPIJobOutput(w http.ResponseWriter, r *http.Request, id string) {
+	output, ok := s.jobs.output(id)
+	if !ok {
+		s.jsonError(w, http.StatusNotFound, fmt.Sprintf("unknown job: %s (jobs are kept in memory until the daemon restarts)", id))
+		return
+	}
+
+	// The stream lasts as long as the deploy
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	next := 0
+	for {
+		lines, skipped, n, closed, changed := output.read(next)
+		next = n
+		if skipped > 0 {
+			_, _ = fmt.Fprintf(w, "event: output\ndata: ... %d earlier line(s) dropped\n\n", skipped)
+		}
+		for _, line := range lines {
+			_, _ = fmt.Fprintf(w, "event: output\ndata: %s\n\n", line)
+		}
+		if closed {
+			if job, ok := s.jobs.get(id); ok {
+				if data, err := json.Marshal(job); err == nil {
+					_, _ = fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+				}
+			}
+			_ = rc.Flush()
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-keepAlive.C:
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		}
+	}
+}
+
+// apiHookResults converts hook results for an API response.
+func apiHookResults(hooks []HookResult) []APIHookResult {
+	results := make([]APIHookResult, 0, len(hooks))
+	for _, h := range hooks {
+		results = append(results, APIHookResult{
+			Name:       h.Name,
+			Output:     h.Output,
+			DurationMs: h.Duration.Milliseconds(),
+			Error:      h.Error,
+		})
+	}
+	return results
+}
+
+// apiServiceTimings converts deploy start timings for an API response.
+func apiServiceTimings(timings []ServiceTiming) []APIServiceTiming {
+	results := make([]APIServiceTiming, 0, len(timings))
+	for _, t := range timings {
+		results = append(results, APIServiceTiming{
+			Service:   t.Service,
+			Container: t.Container,
+			StartedMs: t.Started.Milliseconds(),
+			HealthyMs: t.Healthy.Milliseconds(),
+			Unchanged: t.Unchanged,
+		})
+	}
+	return results
 }
 
 // handleAPICheck handles POST /api/check/{name} - check for updates without modifying files.
@@ -408,12 +1264,59 @@ func (s *Server) handleAPICheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+	response := map[string]interface{}{
 		"deployment":    deployment,
 		"currentCommit": result.CurrentCommit,
 		"remoteCommit":  result.RemoteCommit,
 		"hasChanges":    result.HasChanges,
 		"branch":        result.Branch,
+	}
+	if result.TagPattern != "" {
+		response["tagPattern"] = result.TagPattern
+		response["currentTag"] = result.CurrentTag
+		response["remoteTag"] = result.RemoteTag
+	}
+	if result.CommitsBehind > 0 || result.CommitsAhead > 0 {
+		response["commitsBehind"] = result.CommitsBehind
+		response["commitsAhead"] = result.CommitsAhead
+		response["pendingCommits"] = result.PendingCommits
+	}
+
+	s.jsonResponse(w, http.StatusOK, response)
+}
+
+// handleAPICancel handles POST /api/cancel/{name} - cancel the sync or deploy
+// the daemon is running for a deployment.
+func (s *Server) handleAPICancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	deployment := strings.TrimPrefix(r.URL.Path, "/api/cancel/")
+	if deployment == "" {
+		s.jsonError(w, http.StatusBadRequest, "missing deployment name")
+		return
+	}
+
+	if err := ValidateDeploymentName(deployment); err != nil {
+		s.jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.canceller == nil {
+		s.jsonError(w, http.StatusServiceUnavailable, "operation canceller not configured")
+		return
+	}
+
+	cancelled := s.canceller(deployment)
+	if cancelled {
+		log.Printf("API: cancelled in-flight operation for %s", deployment)
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"deployment": deployment,
+		"cancelled":  cancelled,
 	})
 }
 
@@ -437,10 +1340,21 @@ func (s *Server) handleAPIExec(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.config.DisableExec {
+		s.jsonError(w, http.StatusForbidden, "command execution is disabled on this daemon (STEVEDORE_DISABLE_EXEC)")
+		return
+	}
 	if s.executor == nil {
 		s.jsonError(w, http.StatusServiceUnavailable, "command executor not configured")
 		return
 	}
+	if ok, wait := s.execLimit.allow(); !ok {
+		seconds := int(wait.Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		s.jsonError(w, http.StatusTooManyRequests,
+			fmt.Sprintf("too many commands: limit is %d per minute, retry in %ds", s.config.ExecRateLimit, seconds))
+		return
+	}
 
 	var req ExecRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -448,16 +1362,17 @@ func (s *Server) handleAPIExec(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("API: executing command: %v", req.Args)
+	// Parameter values are secrets: keep them out of the log and the response
+	log.Printf("API: executing command: %v", RedactCommandArgs(req.Args))
 
 	output, exitCode, err := s.executor(req.Args)
 
 	resp := ExecResponse{
-		Output:   output,
+		Output:   RedactCommandOutput(req.Args, output),
 		ExitCode: exitCode,
 	}
 	if err != nil {
-		resp.Error = err.Error()
+		resp.Error = RedactCommandOutput(req.Args, err.Error())
 	}
 
 	s.jsonResponse(w, http.StatusOK, resp)
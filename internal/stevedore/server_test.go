@@ -1,10 +1,27 @@
 package stevedore
 
 import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHealthz_ReturnsOK(t *testing.T) {
@@ -79,6 +96,57 @@ func TestHealthz_MethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestReadyz_WaitsForPollLoop(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	instance := NewInstance(t.TempDir())
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout failed: %v", err)
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	server := NewServer(instance, db, ServerConfig{AdminKey: "test-admin-key"}, "1.0.0", "test-build")
+	ts := httptest.NewServer(server.server.Handler)
+	defer ts.Close()
+	client := NewClient(ts.URL, "", "1.0.0", "test-build")
+
+	ready, err := client.Readiness(context.Background())
+	if err != nil {
+		t.Fatalf("Readiness: %v", err)
+	}
+	want := map[string]bool{"database": true, "adminKey": true, "pollLoop": false}
+	if ready.Ready() || !reflect.DeepEqual(ready.Subsystems, want) {
+		t.Errorf("before the poll loop: %+v, want not ready with %v", ready, want)
+	}
+	resp, err := http.Get(ts.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", resp.StatusCode)
+	}
+	// Liveness does not wait for readiness
+	if _, err := client.Health(context.Background()); err != nil {
+		t.Errorf("Health: %v", err)
+	}
+
+	server.MarkPollLoopStarted()
+	ready, err = client.Readiness(context.Background())
+	if err != nil || !ready.Ready() || ready.Version != "1.0.0" {
+		t.Errorf("after the poll loop started: %+v, %v; want ready", ready, err)
+	}
+
+	_ = db.Close()
+	if ready, err := client.Readiness(context.Background()); err != nil || ready.Ready() || ready.Subsystems["database"] {
+		t.Errorf("with the database closed: %+v, %v; want database not ready", ready, err)
+	}
+}
+
 func TestRequireAuth_ValidKey(t *testing.T) {
 	tmpDir := t.TempDir()
 	t.Setenv("STEVEDORE_DB_KEY", "test-key")
@@ -263,6 +331,148 @@ func TestAPIStatus_ListsDeployments(t *testing.T) {
 	}
 }
 
+func TestAPIDeployments_FiltersAndPaginates(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	instance := NewInstance(tmpDir)
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout failed: %v", err)
+	}
+	for _, name := range []string{"web-b", "api", "web-a", "web-c"} {
+		if _, err := instance.AddRepo(name, RepoSpec{URL: "git@github.com:acme/" + name + ".git"}); err != nil {
+			t.Fatalf("AddRepo failed: %v", err)
+		}
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+	for _, name := range []string{"web-a", "api"} {
+		if err := instance.AddDeploymentTags(db, name, []string{"frontend"}); err != nil {
+			t.Fatalf("AddDeploymentTags failed: %v", err)
+		}
+	}
+
+	server := NewServer(instance, db, ServerConfig{
+		AdminKey: "test-admin-key",
+	}, "1.0.0", "test-build")
+
+	type page struct {
+		Deployments []struct {
+			Deployment string `json:"deployment"`
+		} `json:"deployments"`
+		Total int `json:"total"`
+	}
+	get := func(query string) (int, page) {
+		req := httptest.NewRequest(http.MethodGet, "/api/deployments"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleAPIDeployments(w, req)
+		var response page
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+		}
+		return w.Code, response
+	}
+	names := func(p page) string {
+		var out []string
+		for _, d := range p.Deployments {
+			out = append(out, d.Deployment)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		query string
+		names string
+		total int
+	}{
+		{"", "api,web-a,web-b,web-c", 4},
+		{"?prefix=web-", "web-a,web-b,web-c", 3},
+		{"?prefix=web-&limit=2", "web-a,web-b", 3},
+		{"?prefix=web-&limit=2&offset=2", "web-c", 3},
+		{"?offset=10", "", 4},
+		// Nothing runs in tests, so every deployment is unhealthy
+		{"?healthy=true", "", 0},
+		{"?healthy=false&limit=1&offset=1", "web-a", 4},
+		{"?tag=frontend", "api,web-a", 2},
+		{"?tag=frontend&prefix=web-", "web-a", 1},
+		{"?tag=backend", "", 0},
+	}
+	for _, tt := range tests {
+		code, response := get(tt.query)
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", tt.query, http.StatusOK, code)
+		}
+		if got := names(response); got != tt.names || response.Total != tt.total {
+			t.Errorf("%s: got [%s] total %d, want [%s] total %d", tt.query, got, response.Total, tt.names, tt.total)
+		}
+	}
+
+	for _, query := range []string{"?limit=-1", "?offset=x", "?healthy=maybe", "?tag=Front%20End"} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func TestAPICancel_ReportsWhetherRunning(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	instance := NewInstance(tmpDir)
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatalf("EnsureLayout failed: %v", err)
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	server := NewServer(instance, db, ServerConfig{
+		AdminKey: "test-admin-key",
+	}, "1.0.0", "test-build")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/cancel/web", nil)
+	w := httptest.NewRecorder()
+	server.handleAPICancel(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d without a canceller, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	running := map[string]bool{"web": true}
+	server.SetCanceller(func(deployment string) bool { return running[deployment] })
+
+	for _, tt := range []struct {
+		deployment string
+		want       bool
+	}{
+		{"web", true},
+		{"api", false},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/cancel/"+tt.deployment, nil)
+		w := httptest.NewRecorder()
+		server.handleAPICancel(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var response APICancelResult
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if response.Deployment != tt.deployment || response.Cancelled != tt.want {
+			t.Errorf("cancel %s = %+v, want cancelled=%v", tt.deployment, response, tt.want)
+		}
+	}
+}
+
 func TestSecureCompare(t *testing.T) {
 	tests := []struct {
 		a, b string
@@ -287,3 +497,478 @@ func TestSecureCompare(t *testing.T) {
 		})
 	}
 }
+
+func TestNewLocalClient_BaseURL(t *testing.T) {
+	tests := []struct {
+		listenAddr string
+		want       string
+	}{
+		{"", "http://127.0.0.1:42107"},
+		{":42107", "http://localhost:42107"},
+		{"0.0.0.0:8080", "http://localhost:8080"},
+		{"10.0.0.5:42107", "http://10.0.0.5:42107"},
+	}
+	for _, tt := range tests {
+		client, err := NewLocalClient(tt.listenAddr, "", "key", "1.0.0", "test-build")
+		if err != nil {
+			t.Fatalf("NewLocalClient(%q): %v", tt.listenAddr, err)
+		}
+		if client.BaseURL != tt.want {
+			t.Errorf("NewLocalClient(%q).BaseURL = %q, want %q", tt.listenAddr, client.BaseURL, tt.want)
+		}
+	}
+
+	if _, err := NewLocalClient("42107", "", "key", "1.0.0", "test-build"); err == nil {
+		t.Error("expected error for a listen address without a port")
+	}
+}
+
+func TestClient_SlowHTTPClient(t *testing.T) {
+	client := NewClient("http://localhost:42107", "key", "1.0.0", "test-build")
+	if got := client.slowHTTPClient().Timeout; got != DefaultAPISlowTimeout {
+		t.Errorf("slow timeout = %v, want %v", got, DefaultAPISlowTimeout)
+	}
+	if got := client.httpClient().Timeout; got != 60*time.Second {
+		t.Errorf("fast timeout = %v, want it unchanged", got)
+	}
+
+	client.SlowTimeout = 10 * time.Minute
+	if got := client.slowHTTPClient().Timeout; got != 10*time.Minute {
+		t.Errorf("slow timeout = %v, want the configured one", got)
+	}
+
+	// A longer or disabled HTTPClient timeout is kept
+	client.HTTPClient.Timeout = time.Hour
+	if got := client.slowHTTPClient().Timeout; got != time.Hour {
+		t.Errorf("slow timeout = %v, want the longer HTTPClient timeout", got)
+	}
+	client.HTTPClient.Timeout = 0
+	if got := client.slowHTTPClient().Timeout; got != 0 {
+		t.Errorf("slow timeout = %v, want no timeout", got)
+	}
+}
+
+func TestServerStart_ServesTLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, tmpDir, "stevedore.example.com")
+
+	// Reserve a free port; the server binds it again below
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	server := NewServer(NewInstance(tmpDir), nil, ServerConfig{
+		AdminKey:    "test-admin-key",
+		ListenAddr:  addr,
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+	}, "1.0.0", "test-build")
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = server.Shutdown(context.Background()) }()
+
+	// The certificate names the public host only; the local client dials 127.0.0.1
+	client, err := NewLocalClient(addr, certFile, "test-admin-key", "1.0.0", "test-build")
+	if err != nil {
+		t.Fatalf("NewLocalClient: %v", err)
+	}
+	if !strings.HasPrefix(client.BaseURL, "https://") {
+		t.Errorf("expected an https URL, got %q", client.BaseURL)
+	}
+	health, err := client.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health over TLS: %v", err)
+	}
+	if health.Status != "ok" {
+		t.Errorf("health status = %q, want ok", health.Status)
+	}
+}
+
+func TestServerStart_RejectsIncompleteTLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	certFile, _ := writeTestCertificate(t, tmpDir, "localhost")
+
+	for _, config := range []ServerConfig{
+		{ListenAddr: "127.0.0.1:0", TLSCertFile: certFile},
+		{ListenAddr: "127.0.0.1:0", TLSCertFile: certFile, TLSKeyFile: filepath.Join(tmpDir, "missing.key")},
+	} {
+		server := NewServer(NewInstance(tmpDir), nil, config, "1.0.0", "test-build")
+		if err := server.Start(); err == nil {
+			_ = server.Shutdown(context.Background())
+			t.Errorf("expected Start to fail for %+v", config)
+		}
+	}
+}
+
+func TestServerStart_ServesAPISocket(t *testing.T) {
+	tmpDir := t.TempDir()
+	socketPath := filepath.Join(tmpDir, "run", "api.sock")
+
+	server := NewServer(NewInstance(tmpDir), nil, ServerConfig{
+		AdminKey:   "test-admin-key",
+		ListenAddr: ListenAddrNone,
+		SocketPath: socketPath,
+	}, "1.0.0", "test-build")
+	server.SetCanceller(func(deployment string) bool { return deployment == "web" })
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = server.Shutdown(context.Background()) }()
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %o, want 600", info.Mode().Perm())
+	}
+
+	client := NewSocketClient(socketPath, "test-admin-key", "1.0.0", "test-build")
+	if client.Endpoint() != "unix://"+socketPath {
+		t.Errorf("Endpoint() = %q", client.Endpoint())
+	}
+	result, err := client.Cancel(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Cancel over the socket: %v", err)
+	}
+	if !result.Cancelled {
+		t.Errorf("expected the operation to be cancelled, got %+v", result)
+	}
+
+	// Version headers are still enforced over the socket
+	stale := NewSocketClient(socketPath, "test-admin-key", "1.0.0", "other-build")
+	_, err = stale.Cancel(context.Background(), "web")
+	var clientErr *ClientError
+	if !errors.As(err, &clientErr) || clientErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected a version mismatch, got %v", err)
+	}
+}
+
+func TestServerStart_ListenNoneNeedsSocket(t *testing.T) {
+	server := NewServer(NewInstance(t.TempDir()), nil, ServerConfig{ListenAddr: ListenAddrNone}, "1.0.0", "test-build")
+	if err := server.Start(); err == nil {
+		_ = server.Shutdown(context.Background())
+		t.Error("expected Start to fail without a TCP address or socket")
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for dnsName and its key.
+func writeTestCertificate(t *testing.T, dir string, dnsName string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: dnsName},
+		DNSNames:              []string{dnsName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "api.crt")
+	keyFile = filepath.Join(dir, "api.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestAPIDebug_ReportsRuntime(t *testing.T) {
+	server := NewServer(NewInstance(t.TempDir()), nil, ServerConfig{
+		AdminKey: "test-admin-key",
+	}, "1.0.0", "test-build")
+	server.SetActiveOperations(func() []string { return []string{"web"} })
+
+	req := httptest.NewRequest(http.MethodGet, "/api/debug", nil)
+	w := httptest.NewRecorder()
+	server.handleAPIDebug(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Goroutines       int                    `json:"goroutines"`
+		Memory           map[string]interface{} `json:"memory"`
+		ActiveOperations []string               `json:"activeOperations"`
+		Pprof            bool                   `json:"pprof"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.Goroutines <= 0 {
+		t.Errorf("goroutines = %d, want > 0", response.Goroutines)
+	}
+	if _, ok := response.Memory["heapInuseBytes"]; !ok {
+		t.Errorf("expected memory stats, got %v", response.Memory)
+	}
+	if len(response.ActiveOperations) != 1 || response.ActiveOperations[0] != "web" {
+		t.Errorf("activeOperations = %v, want [web]", response.ActiveOperations)
+	}
+	if response.Pprof {
+		t.Error("expected pprof to be reported as disabled")
+	}
+}
+
+func TestPprof_OptInAndAuthenticated(t *testing.T) {
+	get := func(server *Server, auth string) int {
+		req := httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		w := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	disabled := NewServer(NewInstance(t.TempDir()), nil, ServerConfig{
+		AdminKey: "test-admin-key",
+	}, "1.0.0", "test-build")
+	if code := get(disabled, "test-admin-key"); code != http.StatusNotFound {
+		t.Errorf("pprof disabled: expected status %d, got %d", http.StatusNotFound, code)
+	}
+
+	enabled := NewServer(NewInstance(t.TempDir()), nil, ServerConfig{
+		AdminKey:    "test-admin-key",
+		EnablePprof: true,
+	}, "1.0.0", "test-build")
+	if code := get(enabled, ""); code != http.StatusUnauthorized {
+		t.Errorf("pprof without key: expected status %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := get(enabled, "test-admin-key"); code != http.StatusOK {
+		t.Errorf("pprof with key: expected status %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestAPIEvents_StreamsDeployEvents(t *testing.T) {
+	server := NewServer(NewInstance(t.TempDir()), nil, ServerConfig{
+		AdminKey: "test-admin-key",
+	}, "1.0.0", "test-build")
+	events := NewEventBus(10)
+	server.SetEventBus(events)
+	events.Publish(Event{Type: EventSyncStarted, Deployment: "web", Details: map[string]string{"commit": "abc123"}})
+
+	ts := httptest.NewServer(server.server.Handler)
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/events?since=0", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer test-admin-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/events: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() (string, Event) {
+		t.Helper()
+		var name string
+		var event Event
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read event: %v", err)
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+					t.Fatalf("parse event data: %v", err)
+				}
+			case line == "" && name != "":
+				return name, event
+			}
+		}
+	}
+
+	// Buffered events newer than ?since are replayed first
+	name, event := readEvent()
+	if name != "sync_started" || event.Deployment != "web" || event.Details["commit"] != "abc123" {
+		t.Errorf("replayed event = %s %+v", name, event)
+	}
+
+	events.Publish(Event{Type: EventDeployFailed, Deployment: "web",
+		Details: map[string]string{"commit": "abc123", "error": "compose up failed"}})
+	name, event = readEvent()
+	if name != "deploy_failed" || event.Details["error"] != "compose up failed" {
+		t.Errorf("live event = %s %+v", name, event)
+	}
+}
+
+func TestAPIEvents_RequiresAuth(t *testing.T) {
+	server := NewServer(NewInstance(t.TempDir()), nil, ServerConfig{
+		AdminKey: "test-admin-key",
+	}, "1.0.0", "test-build")
+	server.SetEventBus(NewEventBus(10))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/events", nil)
+	w := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAPIExec_RedactsParamValues(t *testing.T) {
+	server := NewServer(NewInstance(t.TempDir()), nil, ServerConfig{
+		AdminKey: "test-admin-key",
+	}, "1.0.0", "test-build")
+	server.SetExecutor(func(args []string) (string, int, error) {
+		return "set " + strings.Join(args, " ") + "\n", 0, nil
+	})
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	body := `{"args": ["param", "set", "app", "DB_PASSWORD", "hunter22"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/exec", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.handleAPIExec(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if strings.Contains(logs.String(), "hunter22") || !strings.Contains(logs.String(), "DB_PASSWORD") {
+		t.Errorf("log should name the parameter but not its value: %q", logs.String())
+	}
+	var resp ExecResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if strings.Contains(resp.Output, "hunter22") {
+		t.Errorf("output leaks the value: %q", resp.Output)
+	}
+}
+
+func TestAPIExec_Disabled(t *testing.T) {
+	server := NewServer(NewInstance(t.TempDir()), nil, ServerConfig{
+		AdminKey:    "test-admin-key",
+		DisableExec: true,
+	}, "1.0.0", "test-build")
+	called := false
+	server.SetExecutor(func(args []string) (string, int, error) {
+		called = true
+		return "", 0, nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/exec", strings.NewReader(`{"args": ["status"]}`))
+	w := httptest.NewRecorder()
+	server.handleAPIExec(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if called {
+		t.Error("executor should not run when exec is disabled")
+	}
+}
+
+func TestAPIExec_RateLimited(t *testing.T) {
+	server := NewServer(NewInstance(t.TempDir()), nil, ServerConfig{
+		AdminKey:      "test-admin-key",
+		ExecRateLimit: 2,
+	}, "1.0.0", "test-build")
+	server.SetExecutor(func(args []string) (string, int, error) {
+		return "ok\n", 0, nil
+	})
+
+	exec := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/exec", strings.NewReader(`{"args": ["status"]}`))
+		w := httptest.NewRecorder()
+		server.handleAPIExec(w, req)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := exec(); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status %d, got %d", i+1, http.StatusOK, w.Code)
+		}
+	}
+	w := exec()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+}
+
+func TestSlow_ExtendsWriteDeadline(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+
+	instance := NewInstance(tmpDir)
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	server := NewServer(instance, db, ServerConfig{
+		AdminKey:     "test-admin-key",
+		WriteTimeout: 50 * time.Millisecond,
+		SlowTimeout:  5 * time.Second,
+	}, "1.0.0", "test-build")
+	if server.server.WriteTimeout != 50*time.Millisecond {
+		t.Fatalf("WriteTimeout = %v, want the configured one", server.server.WriteTimeout)
+	}
+
+	build := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		server.jsonResponse(w, http.StatusOK, map[string]string{"status": "deployed"})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fast", build)
+	mux.HandleFunc("/slow", server.slow(build))
+
+	ts := httptest.NewUnstartedServer(mux)
+	ts.Config.WriteTimeout = server.server.WriteTimeout
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/slow")
+	if err != nil {
+		t.Fatalf("slow endpoint: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("slow endpoint status = %d", resp.StatusCode)
+	}
+
+	// Without the wrapper the response is cut off by WriteTimeout
+	if resp, err := http.Get(ts.URL + "/fast"); err == nil {
+		resp.Body.Close()
+		t.Error("expected the fast endpoint to exceed its write timeout")
+	}
+}
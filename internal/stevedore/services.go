@@ -52,6 +52,10 @@ const (
 	LabelIngressPort        = "stevedore.ingress.port"
 	LabelIngressWebSocket   = "stevedore.ingress.websocket"
 	LabelIngressHealthCheck = "stevedore.ingress.healthcheck"
+
+	// LabelAPIEnabled opts a service into the query socket: Deploy mounts it
+	// and injects the deployment's query token
+	LabelAPIEnabled = "stevedore.api.enabled"
 )
 
 // Parameter-based ingress configuration constants (Issue #9)
@@ -135,14 +139,14 @@ func (i *Instance) ListIngressServices(ctx context.Context) ([]Service, error) {
 
 // listStevedoreContainerIDs returns IDs of all containers belonging to stevedore projects.
 func (i *Instance) listStevedoreContainerIDs(ctx context.Context) ([]string, error) {
-	// Find all containers with project names starting with "stevedore-"
+	// Find all containers with project names starting with the project prefix
 	args := []string{
 		"ps", "-a",
 		"--filter", "label=" + LabelComposeProject,
 		"--format", "{{.ID}}\t{{.Label \"" + LabelComposeProject + "\"}}",
 	}
 
-	cmd := newCommand(ctx, "docker", args...)
+	cmd := newDockerCommand(ctx, args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -151,6 +155,7 @@ func (i *Instance) listStevedoreContainerIDs(ctx context.Context) ([]string, err
 		return nil, fmt.Errorf("failed to list containers: %w: %s", err, strings.TrimSpace(stderr.String()))
 	}
 
+	prefix := ProjectPrefix()
 	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
 	var ids []string
 	for _, line := range lines {
@@ -163,8 +168,8 @@ func (i *Instance) listStevedoreContainerIDs(ctx context.Context) ([]string, err
 		}
 		id := parts[0]
 		project := parts[1]
-		// Only include stevedore-managed projects
-		if strings.HasPrefix(project, "stevedore-") {
+		// Only include projects of this stevedore instance
+		if strings.HasPrefix(project, prefix) {
 			ids = append(ids, id)
 		}
 	}
@@ -180,7 +185,7 @@ func (i *Instance) inspectService(ctx context.Context, containerID string) (*Ser
 // inspectServiceWithParams gets service info from a container with parameter-based ingress support.
 // The deploymentParams cache is used to avoid repeated DB queries for the same deployment.
 func (i *Instance) inspectServiceWithParams(ctx context.Context, containerID string, deploymentParamsCache map[string]map[string]string) (*Service, error) {
-	cmd := newCommand(ctx, "docker", "inspect", containerID)
+	cmd := newDockerCommand(ctx, "inspect", containerID)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -201,9 +206,9 @@ func (i *Instance) inspectServiceWithParams(ctx context.Context, containerID str
 	r := results[0]
 	labels := r.Config.Labels
 
-	// Extract deployment name from project (stevedore-{deployment})
+	// Extract deployment name from project ({prefix}{deployment})
 	project := labels[LabelComposeProject]
-	deployment := strings.TrimPrefix(project, "stevedore-")
+	deployment := strings.TrimPrefix(project, ProjectPrefix())
 	serviceName := labels[LabelComposeService]
 
 	svc := &Service{
@@ -238,6 +243,11 @@ func (i *Instance) inspectServiceWithParams(ctx context.Context, containerID str
 	return svc, nil
 }
 
+// labelEnabled parses the value of an on/off stevedore label or parameter.
+func labelEnabled(value string) bool {
+	return value == "true" || value == "1" || value == "yes"
+}
+
 // parseIngressLabels extracts ingress configuration from container labels.
 func parseIngressLabels(labels map[string]string) *IngressConfig {
 	enabledStr := labels[LabelIngressEnabled]
@@ -245,10 +255,8 @@ func parseIngressLabels(labels map[string]string) *IngressConfig {
 		return nil
 	}
 
-	enabled := enabledStr == "true" || enabledStr == "1" || enabledStr == "yes"
-
 	config := &IngressConfig{
-		Enabled:     enabled,
+		Enabled:     labelEnabled(enabledStr),
 		Subdomain:   labels[LabelIngressSubdomain],
 		HealthCheck: labels[LabelIngressHealthCheck],
 	}
@@ -294,10 +302,8 @@ func parseIngressFromParams(params map[string]string, serviceName string) *Ingre
 		return nil
 	}
 
-	enabled := enabledStr == "true" || enabledStr == "1" || enabledStr == "yes"
-
 	config := &IngressConfig{
-		Enabled:     enabled,
+		Enabled:     labelEnabled(enabledStr),
 		Subdomain:   params[servicePrefix+"SUBDOMAIN"],
 		HealthCheck: params[servicePrefix+"HEALTHCHECK"],
 	}
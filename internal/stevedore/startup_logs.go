@@ -0,0 +1,92 @@
+package stevedore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// startupLogTail is how many log lines of each container a failed deploy or
+// health wait captures.
+const startupLogTail = 200
+
+// startupLogTimeout bounds capturing the logs, which runs after the deploy's
+// own context may have expired.
+const startupLogTimeout = 30 * time.Second
+
+// ContainerLog is the end of one container's log.
+type ContainerLog struct {
+	Service   string   `json:"service"`
+	Container string   `json:"container"`
+	Lines     []string `json:"lines"`
+}
+
+// StartupLogsError is a failed deploy or health wait with the last log lines
+// of the deployment's containers, so a failed auto-deploy can be debugged
+// from its recorded error without running `docker logs` on the host.
+type StartupLogsError struct {
+	Err  error
+	Logs []ContainerLog
+}
+
+func (e *StartupLogsError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Err.Error())
+	for _, l := range e.Logs {
+		fmt.Fprintf(&b, "\n--- %s (%s): last %d log lines ---", l.Service, l.Container, len(l.Lines))
+		for _, line := range l.Lines {
+			b.WriteString("\n" + line)
+		}
+	}
+	return b.String()
+}
+
+func (e *StartupLogsError) Unwrap() error {
+	return e.Err
+}
+
+// withStartupLogs wraps err with the last log lines of the deployment's
+// containers, or of the given services only. err is returned unchanged when
+// there are no logs to add.
+func (i *Instance) withStartupLogs(ctx context.Context, deployment string, services []string, err error) error {
+	logs := i.captureStartupLogs(ctx, deployment, services)
+	if len(logs) == 0 {
+		return err
+	}
+	return &StartupLogsError{Err: err, Logs: logs}
+}
+
+// captureStartupLogs reads `docker logs --tail 200` of each container of a
+// deployment, limited to services unless it is empty. Failures are logged
+// and skipped: the logs only add detail to an error being reported.
+func (i *Instance) captureStartupLogs(ctx context.Context, deployment string, services []string) []ContainerLog {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), startupLogTimeout)
+	defer cancel()
+
+	containers, err := i.listProjectContainers(ctx, ComposeProjectName(deployment))
+	if err != nil {
+		log.Printf("Warning: cannot capture container logs of %s: %v", deployment, err)
+		return nil
+	}
+
+	var logs []ContainerLog
+	for _, c := range containers {
+		if len(services) > 0 && !slices.Contains(services, c.Service) {
+			continue
+		}
+		var lines []string
+		opts := LogsOptions{Tail: strconv.Itoa(startupLogTail)}
+		if err := i.readContainerLogs(ctx, 0, c.ID, opts, func(line logLine) {
+			lines = append(lines, line.text)
+		}); err != nil {
+			log.Printf("Warning: cannot capture logs of %s: %v", c.Name, err)
+			continue
+		}
+		logs = append(logs, ContainerLog{Service: c.Service, Container: c.Name, Lines: lines})
+	}
+	return logs
+}
@@ -0,0 +1,76 @@
+package stevedore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDockerProject puts a docker binary on PATH that lists one container per
+// service of the app project and prints two log lines for each.
+func fakeDockerProject(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	script := `#!/bin/sh
+case "$1" in
+ps) printf 'aaaaaaaaaaaa1111\nbbbbbbbbbbbb2222\n' ;;
+inspect)
+  case "$2" in
+  aaaa*) svc=web ;;
+  *) svc=worker ;;
+  esac
+  printf '[{"Id":"%s","Name":"/stevedore-app-%s-1","Config":{"Image":"app","Labels":{"com.docker.compose.service":"%s"}},"State":{"Status":"exited","ExitCode":1}}]' "$2" "$svc" "$svc"
+  ;;
+logs)
+  for id; do :; done
+  echo "2026-01-02T03:04:05.000000000Z starting $id"
+  echo "2026-01-02T03:04:06.000000000Z panic: missing DATABASE_URL" >&2
+  ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+}
+
+func TestWithStartupLogs(t *testing.T) {
+	fakeDockerProject(t)
+	instance := NewInstance(t.TempDir())
+	cause := errors.New("docker compose up failed")
+
+	err := instance.withStartupLogs(context.Background(), "app", nil, cause)
+	var logsErr *StartupLogsError
+	if !errors.As(err, &logsErr) || !errors.Is(err, cause) {
+		t.Fatalf("withStartupLogs = %v, want a StartupLogsError wrapping the cause", err)
+	}
+	if len(logsErr.Logs) != 2 || logsErr.Logs[0].Service != "web" || logsErr.Logs[0].Container != "stevedore-app-web-1" {
+		t.Fatalf("Logs = %+v", logsErr.Logs)
+	}
+	if got := logsErr.Logs[1].Lines; len(got) != 2 || got[1] != "panic: missing DATABASE_URL" {
+		t.Errorf("worker lines = %q", got)
+	}
+	for _, want := range []string{
+		"docker compose up failed\n--- web (stevedore-app-web-1): last 2 log lines ---\nstarting ",
+		"panic: missing DATABASE_URL",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %q:\n%s", want, err)
+		}
+	}
+
+	// Only the services that are not ready
+	err = instance.withStartupLogs(context.Background(), "app", []string{"worker"}, cause)
+	if !errors.As(err, &logsErr) || len(logsErr.Logs) != 1 || logsErr.Logs[0].Service != "worker" {
+		t.Errorf("filtered logs = %v", err)
+	}
+
+	// Without containers the error is returned as is
+	t.Setenv("PATH", t.TempDir())
+	if err := instance.withStartupLogs(context.Background(), "app", nil, cause); err != cause {
+		t.Errorf("without docker = %v, want the cause", err)
+	}
+}
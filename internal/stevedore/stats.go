@@ -0,0 +1,102 @@
+package stevedore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dockerStatsLine matches one line of `docker stats --no-stream --format '{{json .}}'`.
+type dockerStatsLine struct {
+	ID       string `json:"ID"`
+	CPUPerc  string `json:"CPUPerc"`
+	MemUsage string `json:"MemUsage"`
+	MemPerc  string `json:"MemPerc"`
+}
+
+// containerStats is the parsed resource usage for a single container.
+type containerStats struct {
+	CPUPercent float64
+	MemUsage   string
+	MemPercent float64
+}
+
+// CollectContainerStats populates CPU and memory usage for the running containers
+// in status. It issues a single `docker stats --no-stream` call, which takes
+// about a second, so callers should only use it when explicitly requested.
+func (i *Instance) CollectContainerStats(ctx context.Context, status *DeploymentStatus) error {
+	if status == nil {
+		return nil
+	}
+
+	var ids []string
+	for _, c := range status.Containers {
+		if c.State == StateRunning {
+			ids = append(ids, c.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := append([]string{"stats", "--no-stream", "--format", "{{json .}}"}, ids...)
+	cmd := newDockerCommand(ctx, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := runCommand(cmd); err != nil {
+		return fmt.Errorf("docker stats failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	stats := parseDockerStats(stdout.String())
+	for idx := range status.Containers {
+		c := &status.Containers[idx]
+		if s, ok := stats[shortCID(c.ID)]; ok {
+			c.CPUPercent = s.CPUPercent
+			c.MemUsage = s.MemUsage
+			c.MemPercent = s.MemPercent
+		}
+	}
+
+	return nil
+}
+
+// parseDockerStats parses `docker stats` JSON lines into a map keyed by short container ID.
+// Lines that cannot be parsed are skipped.
+func parseDockerStats(output string) map[string]containerStats {
+	result := make(map[string]containerStats)
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var parsed dockerStatsLine
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil || parsed.ID == "" {
+			continue
+		}
+
+		result[shortCID(parsed.ID)] = containerStats{
+			CPUPercent: parsePercent(parsed.CPUPerc),
+			MemUsage:   strings.TrimSpace(parsed.MemUsage),
+			MemPercent: parsePercent(parsed.MemPerc),
+		}
+	}
+
+	return result
+}
+
+// parsePercent converts docker's "12.34%" notation to a float, returning 0 for "--" or garbage.
+func parsePercent(s string) float64 {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "%")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
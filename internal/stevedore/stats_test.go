@@ -0,0 +1,64 @@
+package stevedore
+
+import "testing"
+
+func TestParseDockerStats(t *testing.T) {
+	output := `{"BlockIO":"0B / 0B","CPUPerc":"12.50%","Container":"abc","ID":"0123456789abcdef","MemPerc":"3.25%","MemUsage":"64MiB / 1.94GiB","Name":"stevedore-app-web-1","NetIO":"1kB / 0B","PIDs":"5"}
+{"CPUPerc":"--","ID":"fedcba987654","MemPerc":"--","MemUsage":"-- / --"}
+not json
+`
+	stats := parseDockerStats(output)
+
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %v", len(stats), stats)
+	}
+
+	web, ok := stats["0123456789ab"]
+	if !ok {
+		t.Fatal("expected entry keyed by short container ID")
+	}
+	if web.CPUPercent != 12.5 {
+		t.Errorf("CPUPercent = %v, want 12.5", web.CPUPercent)
+	}
+	if web.MemUsage != "64MiB / 1.94GiB" {
+		t.Errorf("MemUsage = %q", web.MemUsage)
+	}
+	if web.MemPercent != 3.25 {
+		t.Errorf("MemPercent = %v, want 3.25", web.MemPercent)
+	}
+
+	if stopped := stats["fedcba987654"]; stopped.CPUPercent != 0 || stopped.MemPercent != 0 {
+		t.Errorf("expected zero usage for unparseable values, got %+v", stopped)
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+	tests := map[string]float64{
+		"0.00%":   0,
+		"99.9%":   99.9,
+		" 150% ":  150,
+		"--":      0,
+		"":        0,
+		"garbage": 0,
+	}
+	for in, want := range tests {
+		if got := parsePercent(in); got != want {
+			t.Errorf("parsePercent(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestCollectContainerStats_NoRunningContainers(t *testing.T) {
+	instance := NewInstance(t.TempDir())
+	status := &DeploymentStatus{
+		Containers: []ContainerStatus{{ID: "0123456789ab", State: StateExited}},
+	}
+
+	// No running containers means no docker call is needed at all
+	if err := instance.CollectContainerStats(t.Context(), status); err != nil {
+		t.Fatalf("CollectContainerStats: %v", err)
+	}
+	if status.Containers[0].MemUsage != "" {
+		t.Error("expected stopped container to have no stats")
+	}
+}
@@ -3,6 +3,9 @@ package stevedore
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -10,10 +13,100 @@ import (
 type SyncStatus struct {
 	Deployment   string
 	LastCommit   string
+	LastTag      string
 	LastSyncAt   time.Time
 	LastDeployAt time.Time
 	LastError    string
 	LastErrorAt  time.Time
+	// UpdateAvailable is the remote commit (or tag) the daemon found for a
+	// deployment it does not auto-deploy; empty when it is up to date.
+	UpdateAvailable string
+	// LastCommitInfo describes LastCommit; it is empty until a sync records
+	// it (migration v18)
+	LastCommitInfo CommitInfo
+	// SyncFailures counts the checks and syncs that failed in a row since the
+	// last successful one; the daemon backs off while it is non-zero
+	SyncFailures int
+}
+
+// Poll backoff after failed syncs: the first retry waits SyncBackoffBase,
+// and each further failure doubles the wait up to SyncBackoffMax.
+const (
+	SyncBackoffBase       = time.Minute
+	DefaultSyncBackoffMax = 30 * time.Minute
+)
+
+// SyncBackoffMax is the longest wait between retries of a failing sync:
+// STEVEDORE_SYNC_BACKOFF_MAX (a Go duration), or DefaultSyncBackoffMax.
+func SyncBackoffMax() time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("STEVEDORE_SYNC_BACKOFF_MAX"))); err == nil && d >= SyncBackoffBase {
+		return d
+	}
+	return DefaultSyncBackoffMax
+}
+
+// SyncBackoff returns how long the daemon waits after the last of failures
+// consecutive failed syncs before it tries again; zero without failures.
+func SyncBackoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	maxBackoff := SyncBackoffMax()
+	backoff := SyncBackoffBase
+	for n := 1; n < failures && backoff < maxBackoff; n++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// NextSyncRetry returns the earliest time the daemon polls a deployment
+// whose syncs keep failing, or zero when the last sync succeeded.
+func (s *SyncStatus) NextSyncRetry() time.Time {
+	if s.SyncFailures == 0 || s.LastErrorAt.IsZero() {
+		return time.Time{}
+	}
+	return s.LastErrorAt.Add(SyncBackoff(s.SyncFailures))
+}
+
+// BackoffSummary describes the poll backoff for status output, e.g.
+// "backing off after 3 failed syncs, next try in 4m"; empty when the daemon
+// is not backing off at now.
+func (s *SyncStatus) BackoffSummary(now time.Time) string {
+	retry := s.NextSyncRetry()
+	if !now.Before(retry) {
+		return ""
+	}
+	wait := retry.Sub(now)
+	next := fmt.Sprintf("%ds", int(wait.Round(time.Second)/time.Second))
+	if wait >= time.Minute {
+		next = fmt.Sprintf("%dm", int(wait.Round(time.Minute)/time.Minute))
+	}
+	syncs := "syncs"
+	if s.SyncFailures == 1 {
+		syncs = "sync"
+	}
+	return fmt.Sprintf("backing off after %d failed %s, next try in %s", s.SyncFailures, syncs, next)
+}
+
+// CommitSummary describes the last commit for status output, e.g.
+// "1a2b3c4d5e6f Fix login redirect (Jane Doe, 2026-01-15)".
+func (s *SyncStatus) CommitSummary() string {
+	summary := shortCommit(s.LastCommit)
+	info := s.LastCommitInfo
+	if info.Subject != "" {
+		summary += " " + info.Subject
+	}
+	var details []string
+	if info.Author != "" {
+		details = append(details, info.Author)
+	}
+	if !info.Date.IsZero() {
+		details = append(details, info.Date.Format(time.DateOnly))
+	}
+	if len(details) > 0 {
+		summary += " (" + strings.Join(details, ", ") + ")"
+	}
+	return summary
 }
 
 // GetSyncStatus retrieves the sync status for a deployment.
@@ -23,20 +116,27 @@ func (i *Instance) GetSyncStatus(db *sql.DB, deployment string) (*SyncStatus, er
 	}
 
 	var status SyncStatus
-	var lastCommit, lastError sql.NullString
-	var lastSyncAt, lastDeployAt, lastErrorAt sql.NullInt64
+	var lastCommit, lastTag, lastError, updateAvailable, commitAuthor, commitSubject sql.NullString
+	var lastSyncAt, lastDeployAt, lastErrorAt, commitDate sql.NullInt64
 
 	err := db.QueryRow(`
-		SELECT deployment, last_commit, last_sync_at, last_deploy_at, last_error, last_error_at
+		SELECT deployment, last_commit, last_tag, last_sync_at, last_deploy_at, last_error, last_error_at, update_available,
+			last_commit_author, last_commit_date, last_commit_subject, sync_failures
 		FROM sync_status
 		WHERE deployment = ?
 	`, deployment).Scan(
 		&status.Deployment,
 		&lastCommit,
+		&lastTag,
 		&lastSyncAt,
 		&lastDeployAt,
 		&lastError,
 		&lastErrorAt,
+		&updateAvailable,
+		&commitAuthor,
+		&commitDate,
+		&commitSubject,
+		&status.SyncFailures,
 	)
 
 	if errors.Is(err, sql.ErrNoRows) {
@@ -50,6 +150,9 @@ func (i *Instance) GetSyncStatus(db *sql.DB, deployment string) (*SyncStatus, er
 	if lastCommit.Valid {
 		status.LastCommit = lastCommit.String
 	}
+	if lastTag.Valid {
+		status.LastTag = lastTag.String
+	}
 	if lastSyncAt.Valid {
 		status.LastSyncAt = time.Unix(lastSyncAt.Int64, 0)
 	}
@@ -62,11 +165,21 @@ func (i *Instance) GetSyncStatus(db *sql.DB, deployment string) (*SyncStatus, er
 	if lastErrorAt.Valid {
 		status.LastErrorAt = time.Unix(lastErrorAt.Int64, 0)
 	}
+	if updateAvailable.Valid {
+		status.UpdateAvailable = updateAvailable.String
+	}
+	status.LastCommitInfo.Author = commitAuthor.String
+	status.LastCommitInfo.Subject = commitSubject.String
+	if commitDate.Valid {
+		status.LastCommitInfo.Date = time.Unix(commitDate.Int64, 0)
+	}
 
 	return &status, nil
 }
 
-// UpdateSyncStatus updates the sync status after a successful sync.
+// UpdateSyncStatus updates the sync status after a successful sync and ends
+// any poll backoff. A new commit clears the available update recorded for it
+// and the metadata of the previous commit (see UpdateSyncCommitInfo).
 func (i *Instance) UpdateSyncStatus(db *sql.DB, deployment string, commit string) error {
 	if err := ValidateDeploymentName(deployment); err != nil {
 		return err
@@ -79,12 +192,87 @@ func (i *Instance) UpdateSyncStatus(db *sql.DB, deployment string, commit string
 			last_commit = excluded.last_commit,
 			last_sync_at = excluded.last_sync_at,
 			last_error = NULL,
-			last_error_at = NULL
+			last_error_at = NULL,
+			sync_failures = 0,
+			update_available = CASE WHEN sync_status.last_commit = excluded.last_commit
+				THEN sync_status.update_available ELSE NULL END,
+			last_commit_author = CASE WHEN sync_status.last_commit = excluded.last_commit
+				THEN sync_status.last_commit_author ELSE NULL END,
+			last_commit_date = CASE WHEN sync_status.last_commit = excluded.last_commit
+				THEN sync_status.last_commit_date ELSE NULL END,
+			last_commit_subject = CASE WHEN sync_status.last_commit = excluded.last_commit
+				THEN sync_status.last_commit_subject ELSE NULL END
 	`, deployment, commit)
 
 	return err
 }
 
+// RecordUpdateAvailable stores the remote commit or tag available to a
+// deployment (empty clears it) and reports whether it differs from the one
+// recorded before, so each new update is announced once.
+func (i *Instance) RecordUpdateAvailable(db *sql.DB, deployment string, remote string) (bool, error) {
+	status, err := i.GetSyncStatus(db, deployment)
+	if err != nil {
+		return false, err
+	}
+	if status.UpdateAvailable == remote {
+		return false, nil
+	}
+
+	var value sql.NullString
+	if remote != "" {
+		value = sql.NullString{String: remote, Valid: true}
+	}
+	if _, err := db.Exec(`
+		INSERT INTO sync_status (deployment, update_available)
+		VALUES (?, ?)
+		ON CONFLICT(deployment) DO UPDATE SET
+			update_available = excluded.update_available
+	`, deployment, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateSyncTag records the tag checked out by the last sync (tag-tracking mode).
+func (i *Instance) UpdateSyncTag(db *sql.DB, deployment string, tag string) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO sync_status (deployment, last_tag)
+		VALUES (?, ?)
+		ON CONFLICT(deployment) DO UPDATE SET
+			last_tag = excluded.last_tag
+	`, deployment, tag)
+
+	return err
+}
+
+// UpdateSyncCommitInfo records the author, date and subject of the commit
+// checked out by the last sync.
+func (i *Instance) UpdateSyncCommitInfo(db *sql.DB, deployment string, info CommitInfo) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+
+	var date sql.NullInt64
+	if !info.Date.IsZero() {
+		date = sql.NullInt64{Int64: info.Date.Unix(), Valid: true}
+	}
+	_, err := db.Exec(`
+		INSERT INTO sync_status (deployment, last_commit_author, last_commit_date, last_commit_subject)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(deployment) DO UPDATE SET
+			last_commit_author = excluded.last_commit_author,
+			last_commit_date = excluded.last_commit_date,
+			last_commit_subject = excluded.last_commit_subject
+	`, deployment, info.Author, date, info.Subject)
+
+	return err
+}
+
 // UpdateDeployStatus updates the deploy timestamp after a successful deploy.
 func (i *Instance) UpdateDeployStatus(db *sql.DB, deployment string) error {
 	if err := ValidateDeploymentName(deployment); err != nil {
@@ -101,35 +289,65 @@ func (i *Instance) UpdateDeployStatus(db *sql.DB, deployment string) error {
 	return err
 }
 
-// UpdateSyncError records an error that occurred during sync.
+// UpdateSyncError records an error that occurred during a check or sync and
+// counts it as one more consecutive sync failure (see SyncBackoff).
 func (i *Instance) UpdateSyncError(db *sql.DB, deployment string, syncErr error) error {
+	return recordError(db, deployment, syncErr, true)
+}
+
+// UpdateDeployError records an error of a deploy that follows a sync. Unlike
+// UpdateSyncError it does not count towards the poll backoff: the repository
+// was reachable, and a fix pushed to it should be picked up on schedule.
+func (i *Instance) UpdateDeployError(db *sql.DB, deployment string, deployErr error) error {
+	return recordError(db, deployment, deployErr, false)
+}
+
+// recordError stores the last error of a deployment, counting it as a sync
+// failure when syncFailure is set.
+func recordError(db *sql.DB, deployment string, recorded error, syncFailure bool) error {
 	if err := ValidateDeploymentName(deployment); err != nil {
 		return err
 	}
 
 	errMsg := ""
-	if syncErr != nil {
-		errMsg = syncErr.Error()
+	if recorded != nil {
+		errMsg = recorded.Error()
+	}
+	failures := 0
+	if syncFailure {
+		failures = 1
 	}
 
 	_, err := db.Exec(`
-		INSERT INTO sync_status (deployment, last_error, last_error_at)
-		VALUES (?, ?, CAST(strftime('%s','now') AS INTEGER))
+		INSERT INTO sync_status (deployment, last_error, last_error_at, sync_failures)
+		VALUES (?, ?, CAST(strftime('%s','now') AS INTEGER), ?)
 		ON CONFLICT(deployment) DO UPDATE SET
 			last_error = excluded.last_error,
-			last_error_at = excluded.last_error_at
-	`, deployment, errMsg)
+			last_error_at = excluded.last_error_at,
+			sync_failures = sync_status.sync_failures + excluded.sync_failures
+	`, deployment, errMsg, failures)
 
 	return err
 }
 
+// Desired states of a deployment. The daemon brings "up" deployments back
+// when their containers are missing, e.g. after a host reboot.
+const (
+	DesiredStateUp   = "up"
+	DesiredStateDown = "down"
+)
+
 // RepoConfig holds repository configuration including poll settings.
 type RepoConfig struct {
 	Deployment          string
 	URL                 string
 	Branch              string
+	TagPattern          string
 	PollIntervalSeconds int
+	Schedule            string // Cron expression; empty polls every PollIntervalSeconds
 	Enabled             bool
+	DesiredState        string
+	Archived            bool // Stopped with `deploy archive`; never polled
 }
 
 // GetRepoConfig retrieves repository configuration for a deployment.
@@ -139,18 +357,22 @@ func (i *Instance) GetRepoConfig(db *sql.DB, deployment string) (*RepoConfig, er
 	}
 
 	var config RepoConfig
-	var enabled int
+	var enabled, archived int
 
 	err := db.QueryRow(`
-		SELECT deployment, url, branch, poll_interval_seconds, enabled
+		SELECT deployment, url, branch, tag_pattern, poll_interval_seconds, schedule, enabled, desired_state, archived
 		FROM repositories
 		WHERE deployment = ?
 	`, deployment).Scan(
 		&config.Deployment,
 		&config.URL,
 		&config.Branch,
+		&config.TagPattern,
 		&config.PollIntervalSeconds,
+		&config.Schedule,
 		&enabled,
+		&config.DesiredState,
+		&archived,
 	)
 
 	if err != nil {
@@ -158,17 +380,35 @@ func (i *Instance) GetRepoConfig(db *sql.DB, deployment string) (*RepoConfig, er
 	}
 
 	config.Enabled = enabled != 0
+	config.Archived = archived != 0
 	return &config, nil
 }
 
 // ListEnabledDeployments returns all enabled deployments with their poll intervals.
 func (i *Instance) ListEnabledDeployments(db *sql.DB) ([]RepoConfig, error) {
+	return listRepoConfigs(db, true)
+}
+
+// ListDisabledDeployments returns the deployments the daemon does not
+// auto-deploy (stopped with `deploy down`) with their poll intervals.
+// Archived deployments are not included.
+func (i *Instance) ListDisabledDeployments(db *sql.DB) ([]RepoConfig, error) {
+	return listRepoConfigs(db, false)
+}
+
+// listRepoConfigs returns the unarchived deployments whose enabled flag is
+// wantEnabled.
+func listRepoConfigs(db *sql.DB, wantEnabled bool) ([]RepoConfig, error) {
+	enabledValue := 0
+	if wantEnabled {
+		enabledValue = 1
+	}
 	rows, err := db.Query(`
-		SELECT deployment, url, branch, poll_interval_seconds, enabled
+		SELECT deployment, url, branch, tag_pattern, poll_interval_seconds, schedule, enabled, desired_state
 		FROM repositories
-		WHERE enabled = 1
+		WHERE enabled = ? AND archived = 0
 		ORDER BY deployment
-	`)
+	`, enabledValue)
 	if err != nil {
 		return nil, err
 	}
@@ -182,8 +422,11 @@ func (i *Instance) ListEnabledDeployments(db *sql.DB) ([]RepoConfig, error) {
 			&config.Deployment,
 			&config.URL,
 			&config.Branch,
+			&config.TagPattern,
 			&config.PollIntervalSeconds,
+			&config.Schedule,
 			&enabled,
+			&config.DesiredState,
 		); err != nil {
 			return nil, err
 		}
@@ -214,6 +457,25 @@ func (i *Instance) SetDeploymentEnabled(db *sql.DB, deployment string, enabled b
 	return err
 }
 
+// SetDesiredState records whether a deployment should be running
+// (DesiredStateUp) or stopped (DesiredStateDown).
+func (i *Instance) SetDesiredState(db *sql.DB, deployment string, state string) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+	if state != DesiredStateUp && state != DesiredStateDown {
+		return fmt.Errorf("invalid desired state: %q", state)
+	}
+
+	_, err := db.Exec(`
+		UPDATE repositories
+		SET desired_state = ?
+		WHERE deployment = ?
+	`, state, deployment)
+
+	return err
+}
+
 // SetPollInterval sets the poll interval for a deployment in seconds.
 func (i *Instance) SetPollInterval(db *sql.DB, deployment string, seconds int) error {
 	if err := ValidateDeploymentName(deployment); err != nil {
@@ -232,3 +494,51 @@ func (i *Instance) SetPollInterval(db *sql.DB, deployment string, seconds int) e
 
 	return err
 }
+
+// SetSchedule sets the cron expression that decides when the daemon checks a
+// deployment for updates. An empty expression goes back to interval polling.
+func (i *Instance) SetSchedule(db *sql.DB, deployment string, expr string) error {
+	if err := ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+	expr = strings.TrimSpace(expr)
+	if expr != "" {
+		if _, err := ParseCronSchedule(expr); err != nil {
+			return err
+		}
+	}
+
+	result, err := db.Exec(`
+		UPDATE repositories
+		SET schedule = ?
+		WHERE deployment = ?
+	`, expr, deployment)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("deployment not found: %s", deployment)
+	}
+	return nil
+}
+
+// NextSyncAt returns when the daemon should next check the deployment: the
+// next cron match after the last check, or the last check plus the poll
+// interval. A deployment that was never checked is due immediately.
+func (c RepoConfig) NextSyncAt(lastSyncAt time.Time) (time.Time, error) {
+	if c.Schedule == "" {
+		return lastSyncAt.Add(time.Duration(c.PollIntervalSeconds) * time.Second), nil
+	}
+	schedule, err := ParseCronSchedule(c.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if lastSyncAt.IsZero() {
+		return lastSyncAt, nil
+	}
+	next := schedule.Next(lastSyncAt)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("schedule %q never matches", c.Schedule)
+	}
+	return next, nil
+}
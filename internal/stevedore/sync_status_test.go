@@ -0,0 +1,92 @@
+package stevedore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSyncBackoff(t *testing.T) {
+	for failures, want := range map[int]time.Duration{
+		0:  0,
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		6:  30 * time.Minute,
+		50: 30 * time.Minute,
+	} {
+		if got := SyncBackoff(failures); got != want {
+			t.Errorf("SyncBackoff(%d) = %v, want %v", failures, got, want)
+		}
+	}
+
+	t.Setenv("STEVEDORE_SYNC_BACKOFF_MAX", "5m")
+	if got := SyncBackoff(4); got != 5*time.Minute {
+		t.Errorf("SyncBackoff(4) with a 5m cap = %v", got)
+	}
+}
+
+func TestSyncFailures_CountedUntilSuccess(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", RepoSpec{URL: "git@github.com:acme/app.git"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	failures := func() int {
+		t.Helper()
+		status, err := instance.GetSyncStatus(db, "app")
+		if err != nil {
+			t.Fatalf("GetSyncStatus: %v", err)
+		}
+		return status.SyncFailures
+	}
+
+	for range 2 {
+		if err := instance.UpdateSyncError(db, "app", errors.New("connection refused")); err != nil {
+			t.Fatalf("UpdateSyncError: %v", err)
+		}
+	}
+	if got := failures(); got != 2 {
+		t.Errorf("after two sync errors: %d failures, want 2", got)
+	}
+
+	// A failed deploy does not slow down polling
+	if err := instance.UpdateDeployError(db, "app", errors.New("compose failed")); err != nil {
+		t.Fatalf("UpdateDeployError: %v", err)
+	}
+	status, err := instance.GetSyncStatus(db, "app")
+	if err != nil || status.SyncFailures != 2 || status.LastError != "compose failed" {
+		t.Errorf("after a deploy error: %+v, %v", status, err)
+	}
+
+	if err := instance.UpdateSyncStatus(db, "app", "abc123"); err != nil {
+		t.Fatalf("UpdateSyncStatus: %v", err)
+	}
+	if got := failures(); got != 0 {
+		t.Errorf("after a successful sync: %d failures, want 0", got)
+	}
+}
+
+func TestSyncStatus_BackoffSummary(t *testing.T) {
+	failedAt := time.Unix(1700000000, 0)
+	status := SyncStatus{SyncFailures: 3, LastErrorAt: failedAt}
+
+	if got := status.NextSyncRetry(); !got.Equal(failedAt.Add(4 * time.Minute)) {
+		t.Errorf("NextSyncRetry = %v, want 4m after the failure", got)
+	}
+	if got, want := status.BackoffSummary(failedAt.Add(10*time.Second)), "backing off after 3 failed syncs, next try in 4m"; got != want {
+		t.Errorf("BackoffSummary = %q, want %q", got, want)
+	}
+	if got := status.BackoffSummary(failedAt.Add(5 * time.Minute)); got != "" {
+		t.Errorf("BackoffSummary after the retry time = %q, want empty", got)
+	}
+	if got := (&SyncStatus{LastErrorAt: failedAt}).BackoffSummary(failedAt); got != "" {
+		t.Errorf("BackoffSummary without failures = %q, want empty", got)
+	}
+}
@@ -261,8 +261,16 @@ func (w *Watchdog) restart(ctx context.Context, deployment string) {
 	w.lastRestart[deployment] = time.Now()
 	w.mu.Unlock()
 
-	w.daemon.setActive(deployment, true)
-	defer w.daemon.setActive(deployment, false)
+	ctx, done := w.daemon.setActive(ctx, deployment)
+	defer done()
+
+	// Taken before the stop, so the deployment is not left down while queued
+	release, err := deploySlots.acquire(ctx, deployment)
+	if err != nil {
+		log.Printf("Watchdog: restart of %s cancelled while queued: %v", deployment, err)
+		return
+	}
+	defer release()
 
 	stopCtx, stopCancel := context.WithTimeout(ctx, w.daemon.config.DeployTimeout)
 	defer stopCancel()
@@ -371,7 +379,7 @@ func (i *Instance) listProjectContainerIDs(ctx context.Context, projectName stri
 		"ps", "-aq", "--no-trunc",
 		"--filter", "label=com.docker.compose.project=" + projectName,
 	}
-	cmd := newCommand(ctx, "docker", args...)
+	cmd := newDockerCommand(ctx, args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
@@ -37,14 +42,27 @@ func main() {
 	}
 
 	if args[0] == "-d" || args[0] == "--daemon" {
-		if len(args) != 1 {
-			log.Printf("ERROR: -d/--daemon cannot be combined with other arguments")
+		listen, err := daemonListenConfig(args[1:])
+		if err != nil {
+			log.Printf("ERROR: %v", err)
 			os.Exit(2)
 		}
-		runDaemon(instance)
+		runDaemon(instance, listen)
 		return
 	}
 
+	stdoutIsTerminal = isTerminal(os.Stdout)
+
+	// --json output is always buffered, so it never streams to the terminal
+	if jsonOutput, _ := consumeJSONFlag(args); !jsonOutput {
+		if exitCode, ok := runAttached(instance, args); ok {
+			if exitCode != 0 {
+				os.Exit(exitCode)
+			}
+			return
+		}
+	}
+
 	// Execute command and handle exit code
 	output, exitCode := executeCommand(instance, args)
 	if output != "" {
@@ -55,9 +73,99 @@ func main() {
 	}
 }
 
+// runAttached runs the commands that stream to the terminal until they finish
+// or are interrupted. executeCommand buffers all output, so these bypass it.
+func runAttached(instance *stevedore.Instance, args []string) (exitCode int, handled bool) {
+	switch args[0] {
+	case "status":
+		if !hasFlag(args[1:], "--watch") {
+			return 0, false
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runStatusWatch(ctx, instance, args[1:], os.Stdout); err != nil {
+			log.Printf("ERROR: %v", err)
+			return 1, true
+		}
+		return 0, true
+
+	case "logs":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runLogs(ctx, instance, args[1:], os.Stdout, stdoutIsTerminal && os.Getenv("NO_COLOR") == ""); err != nil {
+			log.Printf("ERROR: %v", err)
+			return 1, true
+		}
+		return 0, true
+
+	case "exec":
+		return runExecAttached(instance, args[1:]), true
+
+	case "repo":
+		// repo add waits for the user to add the deploy key before verifying it,
+		// and `repo add --from -` reads the manifest from stdin
+		if len(args) < 2 || args[1] != "add" {
+			return 0, false
+		}
+		fromStdin := false
+		if from, _, err := consumeStringFlag(args[2:], "--from", ""); err == nil {
+			fromStdin = from == "-"
+		}
+		if !fromStdin && (hasFlag(args[2:], "--no-verify") || !isTerminal(os.Stdin)) {
+			return 0, false
+		}
+		if err := runRepoAddTo(instance, args[2:], os.Stdin, os.Stdout); err != nil {
+			log.Printf("ERROR: %v", err)
+			return 1, true
+		}
+		return 0, true
+
+	case "deploy":
+		// deploy up streams the compose build and up output as it happens
+		if len(args) < 2 || args[1] != "up" {
+			return 0, false
+		}
+		if err := runDeployTo(instance, args[1:], liveOutput{os.Stdout}); err != nil {
+			log.Printf("ERROR: %v", err)
+			return 1, true
+		}
+		return 0, true
+
+	case "backup", "restore":
+		// The archive itself goes through stdout/stdin; messages go to stderr
+		if !hasFlag(args[1:], "-") {
+			return 0, false
+		}
+		var err error
+		if args[0] == "backup" {
+			err = runBackupTo(instance, args[1:], os.Stdout, os.Stderr)
+		} else {
+			err = runRestoreTo(instance, args[1:], os.Stdin, os.Stderr)
+		}
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// liveOutput is the writer of an attached command: `deploy up` also streams
+// the docker compose build and up output to it, which a buffered command
+// would only show once the deploy is over.
+type liveOutput struct{ io.Writer }
+
+// errUnknownCommand is returned by runCommandTo for commands it does not know.
+var errUnknownCommand = errors.New("unknown command")
+
 // executeCommand executes a CLI command and returns output and exit code.
 // This is used both by main() for direct execution and by the daemon for remote execution.
 func executeCommand(instance *stevedore.Instance, args []string) (output string, exitCode int) {
+	if jsonOutput, rest := consumeJSONFlag(args); jsonOutput {
+		return executeCommandJSON(instance, rest)
+	}
+
 	var buf strings.Builder
 
 	if len(args) == 0 {
@@ -65,98 +173,481 @@ func executeCommand(instance *stevedore.Instance, args []string) (output string,
 		return buf.String(), 0
 	}
 
+	if err := runCommandTo(instance, args, &buf); err != nil {
+		if errors.Is(err, errUnknownCommand) {
+			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
+			printUsageTo(&buf)
+			return buf.String(), 2
+		}
+		var pal palette
+		switch args[0] {
+		case "deploy", "status", "check":
+			pal, _ = newPalette(args[1:])
+		}
+		buf.WriteString(pal.bad(fmt.Sprintf("ERROR: %v", err)) + "\n")
+		return buf.String(), 1
+	}
+	return buf.String(), 0
+}
+
+// consumeJSONFlag removes the global --json flag from args. Arguments after
+// "--" belong to the command `exec` runs and are left alone.
+func consumeJSONFlag(args []string) (bool, []string) {
+	found := false
+	rest := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if arg == "--json" {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return found, rest
+}
+
+// errNoJSONResult is returned by commandResult for commands without a
+// structured result; their text output is wrapped in jsonText instead.
+var errNoJSONResult = errors.New("no structured result")
+
+// jsonError is the --json output of a failed command.
+type jsonError struct {
+	Error  string `json:"error"`
+	Output string `json:"output,omitempty"`
+}
+
+// jsonText is the --json output of commands without a structured result.
+type jsonText struct {
+	Output string `json:"output"`
+}
+
+// executeCommandJSON runs a command for --json: the structured result when the
+// command has one, {"output": ...} with its text otherwise, and
+// {"error": ...} on failure. A result that reports per-item errors (check
+// --all, repo keys) is printed as is and the exit code is 1.
+func executeCommandJSON(instance *stevedore.Instance, args []string) (output string, exitCode int) {
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+
+	var text strings.Builder
+	result, err := commandResult(instance, args)
+	if errors.Is(err, errNoJSONResult) {
+		err = runCommandTo(instance, args, &text)
+		result = jsonText{Output: text.String()}
+	}
+	if err != nil {
+		exitCode = 1
+		if errors.Is(err, errUnknownCommand) {
+			exitCode = 2
+		}
+		switch result.(type) {
+		case []checkAllEntry, []repoKeyEntry, *stevedore.ComposeValidation:
+			// Partial results carry per-item errors
+		default:
+			result = jsonError{Error: err.Error(), Output: text.String()}
+		}
+	}
+
+	// Output is read by programs, not browsers: keep <, > and & as they are
+	var out strings.Builder
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		data, _ := json.Marshal(jsonError{Error: err.Error()})
+		return string(data) + "\n", 1
+	}
+	return out.String(), exitCode
+}
+
+// versionResult is the --json output of `version`.
+type versionResult struct {
+	Version string `json:"version"`
+	Build   string `json:"build"`
+	Summary string `json:"summary"`
+}
+
+// paramEntry is an item of the --json output of `param list`.
+type paramEntry struct {
+	Name   string `json:"name"`
+	Global bool   `json:"global"`
+	// Profile is the profile an inherited parameter comes from
+	Profile string `json:"profile,omitempty"`
+}
+
+// statusEntry is an item of the --json output of `status` without a deployment.
+type statusEntry struct {
+	*stevedore.DeploymentStatus
+	Error string `json:"error,omitempty"`
+}
+
+// commandResult returns the structured --json result of the commands that
+// have one, or errNoJSONResult.
+func commandResult(instance *stevedore.Instance, args []string) (interface{}, error) {
+	ctx := context.Background()
+	sub := ""
+	if len(args) > 1 {
+		sub = args[1]
+	}
+
+	switch {
+	case args[0] == "version":
+		return versionResult{Version: Version, Build: GitCommit, Summary: buildInfoSummary()}, nil
+
+	case args[0] == "deploy" && sub == "history":
+		deployment, limit, err := parseDeployHistoryArgs(args[2:])
+		if err != nil {
+			return nil, err
+		}
+		return instance.DeployHistory(deployment, limit)
+
+	case args[0] == "token" && sub == "list" && len(args) == 2:
+		tokens, err := instance.QueryTokenInfos()
+		if err != nil {
+			return nil, err
+		}
+		return append([]stevedore.QueryTokenInfo{}, tokens...), nil
+
+	case args[0] == "status" && !hasFlag(args[1:], "--watch"):
+		tag, rest, err := consumeStringFlag(args[1:], "--tag", "")
+		if err != nil {
+			return nil, err
+		}
+		withStats := hasFlag(rest, "--stats")
+		withEnv := hasFlag(rest, "--env")
+		var positional []string
+		for _, arg := range rest {
+			if arg != "--stats" && arg != "--env" && arg != "--no-color" {
+				positional = append(positional, arg)
+			}
+		}
+		switch {
+		case len(positional) == 0:
+			deployments, err := listDeployments(instance, tag)
+			if err != nil {
+				return nil, err
+			}
+			entries := make([]statusEntry, 0, len(deployments))
+			for _, d := range deployments {
+				status, err := instance.GetDeploymentStatus(ctx, d)
+				if err != nil {
+					entries = append(entries, statusEntry{DeploymentStatus: &stevedore.DeploymentStatus{Deployment: d}, Error: err.Error()})
+					continue
+				}
+				entries = append(entries, statusEntry{DeploymentStatus: status})
+			}
+			return entries, nil
+		case len(positional) == 1 && tag == "":
+			status, err := instance.GetDeploymentStatus(ctx, positional[0])
+			if err != nil {
+				return nil, err
+			}
+			if withStats {
+				if err := instance.CollectContainerStats(ctx, status); err != nil {
+					return nil, err
+				}
+			}
+			if withEnv {
+				stevedore.MaskContainerEnv(status)
+			}
+			return status, nil
+		}
+
+	case args[0] == "check" && hasFlag(args[1:], "--all"):
+		entries, failed, err := checkAll(instance)
+		if err != nil {
+			return nil, err
+		}
+		if failed > 0 {
+			return entries, fmt.Errorf("%d of %d deployments could not be checked", failed, len(entries))
+		}
+		return entries, nil
+
+	case args[0] == "check" && len(args) == 2:
+		result, err := instance.GitCheckRemote(ctx, args[1])
+		if err != nil {
+			return nil, err
+		}
+		return stevedore.APICheckResult{
+			Deployment:     args[1],
+			CurrentCommit:  result.CurrentCommit,
+			RemoteCommit:   result.RemoteCommit,
+			HasChanges:     result.HasChanges,
+			Branch:         result.Branch,
+			TagPattern:     result.TagPattern,
+			CurrentTag:     result.CurrentTag,
+			RemoteTag:      result.RemoteTag,
+			CommitsBehind:  result.CommitsBehind,
+			CommitsAhead:   result.CommitsAhead,
+			PendingCommits: result.PendingCommits,
+		}, nil
+
+	case args[0] == "deploy" && sub == "validate" && len(args) == 3:
+		result, err := instance.ValidateCompose(ctx, args[2])
+		if err != nil {
+			return nil, err
+		}
+		if !result.Valid() {
+			return result, fmt.Errorf("%s is invalid", result.ComposeFile)
+		}
+		return result, nil
+
+	case args[0] == "deploy" && sub == "describe" && len(args) == 3:
+		db, err := instance.OpenDB()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = db.Close() }()
+		return instance.DescribeDeployment(db, args[2])
+
+	case args[0] == "self-update" && sub == "history" && len(args) == 2:
+		images, err := stevedore.NewSelfUpdate(instance, stevedore.SelfUpdateConfig{}).BackupImages(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return images, nil
+
+	case args[0] == "repo" && sub == "keys" && len(args) == 2:
+		entries, failed, err := repoKeys(instance)
+		if err != nil {
+			return nil, err
+		}
+		if failed > 0 {
+			return entries, fmt.Errorf("%d of %d deployment keys could not be read", failed, len(entries))
+		}
+		return entries, nil
+
+	case args[0] == "repo" && sub == "list" && (len(args) == 2 || (len(args) == 4 && args[2] == "--tag")):
+		tag := ""
+		if len(args) == 4 {
+			tag = args[3]
+		}
+		deployments, err := listDeployments(instance, tag)
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{}, deployments...), nil
+
+	case args[0] == "param" && sub == "list":
+		global, includeGlobal := hasFlag(args[2:], "--global"), hasFlag(args[2:], "--include-global")
+		var positional []string
+		for _, arg := range args[2:] {
+			if arg != "--global" && arg != "--include-global" {
+				positional = append(positional, arg)
+			}
+		}
+		profile, positional, err := consumeStringFlag(positional, "--profile", "")
+		if err != nil {
+			return nil, err
+		}
+		var own, inherited []string
+		var fromProfile map[string]bool
+		switch {
+		case global && profile == "" && len(positional) == 0:
+			inherited, err = instance.ListGlobalParameters()
+		case !global && profile != "" && len(positional) == 0:
+			own, err = instance.ListProfileParameters(profile)
+		case !global && profile == "" && len(positional) == 1:
+			if own, err = instance.ListParameters(positional[0]); err == nil && includeGlobal {
+				if inherited, err = instance.ListEffectiveParameters(positional[0]); err == nil {
+					profile, fromProfile, err = profileParameterNames(instance, positional[0])
+				}
+			}
+		default:
+			return nil, errNoJSONResult
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]paramEntry, 0, len(own)+len(inherited))
+		seen := make(map[string]bool, len(own))
+		for _, n := range own {
+			entries = append(entries, paramEntry{Name: n})
+			seen[n] = true
+		}
+		for _, n := range inherited {
+			switch {
+			case seen[n]:
+			case fromProfile[n]:
+				entries = append(entries, paramEntry{Name: n, Profile: profile})
+			default:
+				entries = append(entries, paramEntry{Name: n, Global: true})
+			}
+		}
+		return entries, nil
+
+	case args[0] == "services" && sub == "list":
+		var services []stevedore.Service
+		var err error
+		if hasFlag(args[2:], "--ingress") {
+			services, err = instance.ListIngressServices(ctx)
+		} else {
+			services, err = instance.ListServices(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append([]stevedore.Service{}, services...), nil
+	}
+	return nil, errNoJSONResult
+}
+
+// runCommandTo runs a CLI command, writing its human-readable output to w.
+func runCommandTo(instance *stevedore.Instance, args []string, w io.Writer) error {
 	switch args[0] {
 	case "help", "-h", "--help":
-		printUsageTo(&buf)
-		return buf.String(), 0
+		printUsageTo(w)
+		return nil
 
 	case "version":
-		buf.WriteString(fmt.Sprintf("stevedore %s\n", buildInfoSummary()))
-		return buf.String(), 0
+		_, _ = fmt.Fprintf(w, "stevedore %s\n", buildInfoSummary())
+		return nil
 
 	case "doctor":
-		if err := runDoctorTo(instance, &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runDoctorTo(instance, args[1:], w)
+
+	case "ready":
+		return runReadyTo(instance, args[1:], w)
 
 	case "repo":
-		if err := runRepoTo(instance, args[1:], &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runRepoTo(instance, args[1:], w)
 
 	case "param":
-		if err := runParamTo(instance, args[1:], &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runParamTo(instance, args[1:], w)
 
 	case "deploy":
-		if err := runDeployTo(instance, args[1:], &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runDeployTo(instance, args[1:], w)
 
 	case "status":
-		if err := runStatusTo(instance, args[1:], &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runStatusTo(instance, args[1:], w)
 
 	case "check":
-		if err := runCheckTo(instance, args[1:], &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runCheckTo(instance, args[1:], w)
 
 	case "self-update":
-		if err := runSelfUpdateTo(instance, &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runSelfUpdateTo(instance, args[1:], w)
 
 	case "shared":
-		if err := runSharedTo(instance, args[1:], &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runSharedTo(instance, args[1:], w)
 
 	case "services":
-		if err := runServicesTo(instance, args[1:], &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runServicesTo(instance, args[1:], w)
+
+	case "logs":
+		return runLogsTo(instance, args[1:], w)
+
+	case "exec":
+		return runExecTo(instance, args[1:], w)
+
+	case "backup":
+		return runBackupTo(instance, args[1:], nil, w)
+
+	case "restore":
+		return runRestoreTo(instance, args[1:], nil, w)
+
+	case "db":
+		return runDBTo(instance, args[1:], w)
 
 	case "token":
-		if err := runTokenTo(instance, args[1:], &buf); err != nil {
-			buf.WriteString(fmt.Sprintf("ERROR: %v\n", err))
-			return buf.String(), 1
-		}
-		return buf.String(), 0
+		return runTokenTo(instance, args[1:], w)
+
+	case "completion":
+		return runCompletionTo(instance, args[1:], w)
+
+	case "maintenance":
+		return runMaintenanceTo(instance, args[1:], w)
 
 	default:
-		buf.WriteString(fmt.Sprintf("ERROR: unknown command: %s\n", args[0]))
-		printUsageTo(&buf)
-		return buf.String(), 2
+		return fmt.Errorf("%w: %s", errUnknownCommand, args[0])
+	}
+}
+
+// daemonListenConfig reads the API listen address, TLS files and socket from
+// the --listen, --tls-cert, --tls-key and --socket flags, falling back to the
+// environment.
+// The result is exported back to the environment so CLI commands the daemon
+// runs itself (/api/exec) reach it the same way.
+func daemonListenConfig(args []string) (stevedore.ServerConfig, error) {
+	var config stevedore.ServerConfig
+	var err error
+	if config.ListenAddr, args, err = consumeStringFlag(args, "--listen", getEnvDefault(stevedore.ListenAddrEnvVar, stevedore.DefaultListenAddr)); err != nil {
+		return config, err
+	}
+	if config.TLSCertFile, args, err = consumeStringFlag(args, "--tls-cert", getEnvDefault(stevedore.TLSCertEnvVar, "")); err != nil {
+		return config, err
+	}
+	if config.TLSKeyFile, args, err = consumeStringFlag(args, "--tls-key", getEnvDefault(stevedore.TLSKeyEnvVar, "")); err != nil {
+		return config, err
+	}
+	if config.SocketPath, args, err = consumeStringFlag(args, "--socket", getEnvDefault(stevedore.APISocketEnvVar, "")); err != nil {
+		return config, err
+	}
+	if len(args) != 0 {
+		return config, errors.New("usage: stevedore -d [--listen <addr>|none] [--tls-cert <file> --tls-key <file>] [--socket <path>]")
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return config, errors.New("--tls-cert and --tls-key must be set together")
+	}
+	if config.ListenAddr == stevedore.ListenAddrNone && config.SocketPath == "" {
+		return config, errors.New("--listen none needs --socket")
+	}
+
+	for name, value := range map[string]string{
+		stevedore.ListenAddrEnvVar: config.ListenAddr,
+		stevedore.TLSCertEnvVar:    config.TLSCertFile,
+		stevedore.TLSKeyEnvVar:     config.TLSKeyFile,
+		stevedore.APISocketEnvVar:  config.SocketPath,
+	} {
+		if err := os.Setenv(name, value); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// newDaemonClient creates a client for the local daemon: over the API socket
+// when STEVEDORE_API_SOCKET is set, otherwise over TCP, using HTTPS when
+// STEVEDORE_TLS_CERT is set.
+func newDaemonClient(adminKey string) (*stevedore.Client, error) {
+	if socketPath := getEnvDefault(stevedore.APISocketEnvVar, ""); socketPath != "" {
+		return stevedore.NewSocketClient(socketPath, adminKey, Version, GitCommit), nil
 	}
+	if getEnvDefault(stevedore.ListenAddrEnvVar, "") == stevedore.ListenAddrNone {
+		return nil, fmt.Errorf("%s=%s needs %s", stevedore.ListenAddrEnvVar, stevedore.ListenAddrNone, stevedore.APISocketEnvVar)
+	}
+	return stevedore.NewLocalClient(
+		getEnvDefault(stevedore.ListenAddrEnvVar, ""),
+		getEnvDefault(stevedore.TLSCertEnvVar, ""),
+		adminKey, Version, GitCommit)
 }
 
-func runDaemon(instance *stevedore.Instance) {
+func runDaemon(instance *stevedore.Instance, listen stevedore.ServerConfig) {
 	if err := instance.EnsureLayout(); err != nil {
 		log.Printf("ERROR: %v", err)
 		os.Exit(1)
 	}
 
+	// An invalid prefix would fall back to the default one and manage the
+	// containers of another instance
+	if prefix := os.Getenv(stevedore.ProjectPrefixEnvVar); prefix != "" {
+		if err := stevedore.ValidateProjectPrefix(prefix); err != nil {
+			log.Printf("ERROR: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	// Mirror the log to system/logs/daemon.log for `stevedore logs daemon`
+	if daemonLog, err := instance.OpenDaemonLog(); err != nil {
+		log.Printf("Warning: daemon log file disabled: %v", err)
+	} else {
+		log.SetOutput(io.MultiWriter(os.Stderr, daemonLog))
+		defer func() { _ = daemonLog.Close() }()
+	}
+
 	// Ensure admin key exists
 	if err := instance.EnsureAdminKey(); err != nil {
 		log.Printf("ERROR: %v", err)
@@ -179,7 +670,7 @@ func runDaemon(instance *stevedore.Instance) {
 
 	printUpstreamWarning()
 
-	log.Printf("Stevedore daemon started (%s), root=%s", buildInfoSummary(), instance.Root)
+	log.Printf("Stevedore daemon started (%s), root=%s, project prefix=%s", buildInfoSummary(), instance.Root, stevedore.ProjectPrefix())
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -191,7 +682,15 @@ func runDaemon(instance *stevedore.Instance) {
 
 	daemon := stevedore.NewDaemon(instance, db, stevedore.DaemonConfig{
 		AdminKey:          adminKey,
-		ListenAddr:        getEnvDefault("STEVEDORE_LISTEN_ADDR", ":42107"),
+		ListenAddr:        listen.ListenAddr,
+		TLSCertFile:       listen.TLSCertFile,
+		TLSKeyFile:        listen.TLSKeyFile,
+		APISocketPath:     listen.SocketPath,
+		EnablePprof:       getEnvBool("STEVEDORE_ENABLE_PPROF", false),
+		DisableExec:       getEnvBool("STEVEDORE_DISABLE_EXEC", false),
+		ExecRateLimit:     getEnvInt("STEVEDORE_EXEC_RATE_LIMIT", stevedore.DefaultExecRateLimit),
+		APIWriteTimeout:   getEnvDuration("STEVEDORE_API_WRITE_TIMEOUT", stevedore.DefaultAPIWriteTimeout),
+		APISlowTimeout:    getEnvDuration("STEVEDORE_API_SLOW_TIMEOUT", stevedore.DefaultAPISlowTimeout),
 		Version:           Version,
 		Build:             GitCommit,
 		ReconcileInterval: getEnvDuration("STEVEDORE_RECONCILE_INTERVAL", 30*time.Second),
@@ -202,6 +701,17 @@ func runDaemon(instance *stevedore.Instance) {
 			MinRestartGap:   getEnvDuration("STEVEDORE_WATCHDOG_MIN_RESTART_GAP", 10*time.Minute),
 			SummarizeEveryN: getEnvInt("STEVEDORE_WATCHDOG_SUMMARIZE_EVERY", 10),
 		},
+		CrashLoop: stevedore.CrashLoopConfig{
+			MaxRestarts:   getEnvInt("STEVEDORE_CRASHLOOP_RESTARTS", 5),
+			Window:        getEnvDuration("STEVEDORE_CRASHLOOP_WINDOW", 10*time.Minute),
+			AlertInterval: getEnvDuration("STEVEDORE_CRASHLOOP_ALERT_INTERVAL", time.Hour),
+		},
+		HealthAlerts: stevedore.HealthAlertConfig{
+			Debounce:        getEnvDuration("STEVEDORE_HEALTH_ALERT_DEBOUNCE", time.Minute),
+			FlapTransitions: getEnvInt("STEVEDORE_HEALTH_FLAP_TRANSITIONS", 4),
+			FlapWindow:      getEnvDuration("STEVEDORE_HEALTH_FLAP_WINDOW", 30*time.Minute),
+		},
+		NotifyWebhookURL: strings.TrimSpace(os.Getenv(stevedore.NotifyWebhookEnvVar)),
 	})
 
 	// Set the executor so API can run CLI commands
@@ -221,54 +731,195 @@ func runDaemon(instance *stevedore.Instance) {
 	log.Printf("Stevedore daemon stopped")
 }
 
-func runDoctorTo(instance *stevedore.Instance, w io.Writer) error {
-	if err := instance.EnsureLayout(); err != nil {
-		return err
+// runReadyTo asks the daemon's /readyz whether it is ready, reaching it the way
+// every CLI command does (API socket, listen address, TLS). The self-update
+// workers run it in the new container to tell when old images can go.
+func runReadyTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	if len(args) != 0 {
+		return errors.New("usage: ready")
 	}
-
-	db, err := instance.OpenDB()
+	// /readyz needs no admin key; a missing one is what it reports
+	adminKey, _ := instance.GetAdminKey()
+	client, err := newDaemonClient(adminKey)
 	if err != nil {
 		return err
 	}
-	_ = db.Close()
 
-	deployments, err := instance.ListDeployments()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ready, err := client.Readiness(ctx)
 	if err != nil {
-		return err
+		return fmt.Errorf("daemon at %s: %w", client.Endpoint(), err)
 	}
-
-	_, _ = fmt.Fprintf(w, "stevedore %s\n", buildInfoSummary())
-	_, _ = fmt.Fprintf(w, "root: %s\n", instance.Root)
-	_, _ = fmt.Fprintf(w, "db: %s\n", instance.DBPath())
-	_, _ = fmt.Fprintf(w, "deployments: %d\n", len(deployments))
-
-	// Check if daemon is running and verify version
-	adminKey, err := instance.GetAdminKey()
-	if err != nil {
-		_, _ = fmt.Fprintf(w, "daemon: cannot read admin key (%v)\n", err)
-		return nil
+	if !ready.Ready() {
+		var waiting []string
+		for name, ok := range ready.Subsystems {
+			if !ok {
+				waiting = append(waiting, name)
+			}
+		}
+		slices.Sort(waiting)
+		return fmt.Errorf("daemon not ready yet (waiting for: %s)", strings.Join(waiting, ", "))
 	}
+	_, _ = fmt.Fprintf(w, "daemon: ready (version %s, build %s)\n", ready.Version, ready.Build)
+	return nil
+}
 
-	client := stevedore.NewClient(
-		"http://localhost:42107",
-		adminKey,
-		Version,
-		GitCommit,
-	)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// runDoctorTo reports the health of the installation. With --fix it also
+// repairs what can be repaired without touching existing state: it recreates
+// missing state directories and a missing admin key, and starts a stopped
+// daemon container. Every repair is printed as a "fix:" line. Without --fix
+// nothing is changed: missing state directories are reported with a hint and
+// the checks that need them are skipped.
+func runDoctorTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	fix := false
+	for _, arg := range args {
+		if arg != "--fix" {
+			return errors.New("usage: doctor [--fix]")
+		}
+		fix = true
+	}
 
-	health, err := client.Health(ctx)
-	if err != nil {
-		_, _ = fmt.Fprintf(w, "daemon: not running or unreachable\n")
-		return nil
+	missing := instance.MissingLayoutDirs()
+	if len(missing) > 0 && fix {
+		if err := instance.EnsureLayout(); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "fix: recreated state directories: %s\n", strings.Join(missing, ", "))
+		missing = nil
 	}
 
-	_, _ = fmt.Fprintf(w, "daemon: running (version %s, build %s)\n", health.Version, health.Build)
+	if instance.AdminKeyMissing() && fix {
+		if err := instance.EnsureAdminKey(); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "fix: generated a new admin key at %s\n", instance.AdminKeyPath())
+	}
 
-	// Check version compatibility
-	if health.Version != Version || health.Build != GitCommit {
+	// Opening the database would create the missing directories
+	var deployments []string
+	if len(missing) == 0 {
+		db, err := instance.OpenDB()
+		if err != nil {
+			return err
+		}
+		_ = db.Close()
+
+		if deployments, err = instance.ListDeployments(); err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "stevedore %s\n", buildInfoSummary())
+	_, _ = fmt.Fprintf(w, "root: %s\n", instance.Root)
+	_, _ = fmt.Fprintf(w, "db: %s\n", instance.DBPath())
+	if len(missing) > 0 {
+		_, _ = fmt.Fprintf(w, "deployments: unknown (state layout incomplete)\n")
+		_, _ = fmt.Fprintf(w, "\n⚠️  STATE LAYOUT INCOMPLETE\n")
+		_, _ = fmt.Fprintf(w, "   Missing: %s\n", strings.Join(missing, ", "))
+		_, _ = fmt.Fprintf(w, "   Run: stevedore doctor --fix\n\n")
+	} else {
+		_, _ = fmt.Fprintf(w, "deployments: %d\n", len(deployments))
+	}
+	_, _ = fmt.Fprintf(w, "docker: %s\n", stevedore.DockerEngine())
+	_, _ = fmt.Fprintf(w, "runtime: %s\n", runtimeSummary())
+	_, _ = fmt.Fprintf(w, "compose: %s\n", composeSummary())
+	if len(missing) == 0 {
+		_, _ = fmt.Fprintf(w, "maintenance: %s\n", maintenanceSummary(maintenanceState(instance)))
+	} else {
+		_, _ = fmt.Fprintf(w, "maintenance: unknown (state layout incomplete)\n")
+	}
+
+	diskCtx, diskCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	space, err := instance.CheckDiskSpace(diskCtx)
+	diskCancel()
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "disk: unknown (%v)\n", err)
+	} else {
+		_, _ = fmt.Fprintf(w, "disk: %s free of %s (%s)\n",
+			stevedore.FormatBytes(space.FreeBytes), stevedore.FormatBytes(space.TotalBytes), space.Path)
+		if minFree := stevedore.MinFreeDiskBytes(); space.FreeBytes < minFree {
+			_, _ = fmt.Fprintf(w, "\n⚠️  LOW DISK SPACE: below the %s deploy threshold (STEVEDORE_MIN_FREE_DISK_MB)\n", stevedore.FormatBytes(minFree))
+			_, _ = fmt.Fprintf(w, "   Builds and deploys will be refused until space is freed.\n\n")
+		}
+	}
+
+	instancesCtx, instancesCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	daemons, err := instance.FindDaemonContainers(instancesCtx)
+	instancesCancel()
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "instances: unknown (%v)\n", err)
+	} else {
+		names := make([]string, 0, len(daemons))
+		for _, d := range daemons {
+			names = append(names, d.String())
+		}
+		_, _ = fmt.Fprintf(w, "instances: %d stevedore daemon container(s) on this engine", len(daemons))
+		if len(names) > 0 {
+			_, _ = fmt.Fprintf(w, " (%s)", strings.Join(names, ", "))
+		}
+		_, _ = fmt.Fprintln(w)
+		if conflicts := stevedore.DaemonConflicts(daemons); len(conflicts) > 0 {
+			_, _ = fmt.Fprintf(w, "\n⚠️  STEVEDORE INSTANCES CONFLICT\n")
+			for _, conflict := range conflicts {
+				_, _ = fmt.Fprintf(w, "   %s\n", conflict)
+			}
+			_, _ = fmt.Fprintf(w, "   Instances sharing a docker engine need their own port, %s, query socket and state directories.\n\n", stevedore.ProjectPrefixEnvVar)
+		}
+	}
+
+	// Check if daemon is running and verify version
+	adminKey, err := instance.GetAdminKey()
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "daemon: cannot read admin key (%v)\n", err)
+		return nil
+	}
+
+	client, err := newDaemonClient(adminKey)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "daemon: %v\n", err)
+		return nil
+	}
+	_, _ = fmt.Fprintf(w, "api: %s\n", client.Endpoint())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	health, err := client.Health(ctx)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "daemon: not running or unreachable\n")
+		if !fix {
+			return nil
+		}
+		started, err := instance.StartDaemonContainer(ctx)
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "fix: cannot start the daemon: %v\n", err)
+			return nil
+		}
+		if started {
+			_, _ = fmt.Fprintf(w, "fix: started daemon container %s\n", instance.DaemonContainerName())
+		} else {
+			_, _ = fmt.Fprintf(w, "daemon: container %s is running but the API does not answer; check: docker logs %s\n",
+				instance.DaemonContainerName(), instance.DaemonContainerName())
+		}
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(w, "daemon: running (version %s, build %s)\n", health.Version, health.Build)
+	// An older daemon has no /readyz; only report what it answers
+	if ready, err := client.Readiness(ctx); err == nil && !ready.Ready() {
+		var waiting []string
+		for name, ok := range ready.Subsystems {
+			if !ok {
+				waiting = append(waiting, name)
+			}
+		}
+		slices.Sort(waiting)
+		_, _ = fmt.Fprintf(w, "daemon: not ready yet (waiting for: %s)\n", strings.Join(waiting, ", "))
+	}
+
+	// Check version compatibility
+	if health.Version != Version || health.Build != GitCommit {
 		_, _ = fmt.Fprintf(w, "\n⚠️  VERSION MISMATCH DETECTED\n")
 		_, _ = fmt.Fprintf(w, "   CLI:    version=%s, build=%s\n", Version, GitCommit)
 		_, _ = fmt.Fprintf(w, "   Daemon: version=%s, build=%s\n", health.Version, health.Build)
@@ -283,51 +934,18 @@ func runDoctorTo(instance *stevedore.Instance, w io.Writer) error {
 
 func runRepoTo(instance *stevedore.Instance, args []string, w io.Writer) error {
 	if len(args) == 0 {
-		return errors.New("repo: missing subcommand (add|key|list)")
+		return errors.New("repo: missing subcommand (add|key|keys|verify|rotate-key|change-branch|list|set-depends|set-schedule|tag)")
 	}
 
 	switch args[0] {
 	case "add":
-		branch, remaining, err := consumeStringFlag(args[1:], "--branch", "main")
-		if err != nil {
-			return err
-		}
-		if len(remaining) != 2 {
-			return errors.New("usage: repo add <deployment> <git-url> [--branch <branch>]")
-		}
-		deployment := remaining[0]
-		url := remaining[1]
-
-		publicKey, err := instance.AddRepo(deployment, stevedore.RepoSpec{
-			URL:    url,
-			Branch: branch,
-		})
-		if err != nil {
-			return err
-		}
-
-		_, _ = fmt.Fprintf(w, "Repository registered: %s\n", deployment)
-		_, _ = fmt.Fprintf(w, "\nAdd this public key as a read-only Deploy Key:\n\n%s\n\n", publicKey)
+		return runRepoAddTo(instance, args[1:], nil, w)
 
-		publicKeyLine := strings.TrimSpace(publicKey)
-
-		// Show GitHub deploy key URL if it's a GitHub repository
-		if repoSlug := githubRepoSlug(url); repoSlug != "" {
-			_, _ = fmt.Fprintf(w, "GitHub Deploy Keys URL:\n  %s\n\n", githubDeployKeyURLFromSlug(repoSlug))
-			_, _ = fmt.Fprintf(w, "GitHub CLI (read-only):\n")
-			_, _ = fmt.Fprintf(w, "  gh api -X POST repos/%s/keys \\\n", repoSlug)
-			_, _ = fmt.Fprintf(w, "    -f title=\"stevedore-%s\" \\\n", deployment)
-			_, _ = fmt.Fprintf(w, "    -f key=\"%s\" \\\n", publicKeyLine)
-			_, _ = fmt.Fprintf(w, "    -F read_only=true\n\n")
-			_, _ = fmt.Fprintf(w, "Steps:\n")
-			_, _ = fmt.Fprintf(w, "  1. Open the URL above in your browser\n")
-			_, _ = fmt.Fprintf(w, "  2. Click 'Add deploy key'\n")
-			_, _ = fmt.Fprintf(w, "  3. Title: stevedore-%s\n", deployment)
-			_, _ = fmt.Fprintf(w, "  4. Paste the public key above\n")
-			_, _ = fmt.Fprintf(w, "  5. Leave 'Allow write access' unchecked (read-only)\n")
-			_, _ = fmt.Fprintf(w, "  6. Click 'Add key'\n")
+	case "verify":
+		if len(args) != 2 {
+			return errors.New("usage: repo verify <deployment>")
 		}
-		return nil
+		return runRepoVerifyTo(instance, args[1], w)
 
 	case "key":
 		if len(args) != 2 {
@@ -340,171 +958,2438 @@ func runRepoTo(instance *stevedore.Instance, args []string, w io.Writer) error {
 		_, _ = fmt.Fprintln(w, publicKey)
 		return nil
 
-	case "list":
+	case "keys":
 		if len(args) != 1 {
-			return errors.New("usage: repo list")
+			return errors.New("usage: repo keys [--json]")
+		}
+		return runRepoKeysTo(instance, w)
+
+	case "change-branch":
+		confirmed := hasFlag(args[1:], "--yes")
+		var positional []string
+		for _, arg := range args[1:] {
+			if arg != "--yes" {
+				positional = append(positional, arg)
+			}
+		}
+		if len(positional) != 2 {
+			return errors.New("usage: repo change-branch <deployment> <branch> --yes")
+		}
+		deployment, branch := positional[0], positional[1]
+		if err := stevedore.ValidateBranchName(branch); err != nil {
+			return err
+		}
+		if !confirmed {
+			_, _ = fmt.Fprintf(w, "This retargets %s to branch %s and discards its checkout;\n", deployment, branch)
+			_, _ = fmt.Fprintln(w, "the next sync clones the new branch and the next deploy runs it.")
+			return fmt.Errorf("confirm with: stevedore repo change-branch %s %s --yes", deployment, branch)
 		}
-		deployments, err := instance.ListDeployments()
+
+		previous, err := instance.ChangeRepoBranch(deployment, branch)
 		if err != nil {
 			return err
 		}
-		for _, d := range deployments {
-			_, _ = fmt.Fprintln(w, d)
+		from := "branch " + previous.Branch
+		if previous.Tag != "" {
+			from = "tags matching " + previous.Tag
 		}
+		_, _ = fmt.Fprintf(w, "Branch changed: %s now tracks %s (was %s)\n", deployment, branch, from)
+		_, _ = fmt.Fprintf(w, "Run: stevedore deploy sync %s && stevedore deploy up %s\n", deployment, deployment)
 		return nil
 
-	default:
-		return fmt.Errorf("repo: unknown subcommand: %s", args[0])
-	}
-}
-
-func runDeployTo(instance *stevedore.Instance, args []string, w io.Writer) error {
-	if len(args) == 0 {
-		return errors.New("deploy: missing subcommand (sync|up|down)")
-	}
-
-	ctx := context.Background()
-
-	switch args[0] {
-	case "sync":
-		// Parse --no-clean flag
-		cleanEnabled := true
-		remaining := args[1:]
-		var deployment string
-		for _, arg := range remaining {
-			if arg == "--no-clean" {
-				cleanEnabled = false
-			} else {
-				deployment = arg
+	case "rotate-key":
+		rollback := hasFlag(args[1:], "--rollback")
+		var positional []string
+		for _, arg := range args[1:] {
+			if arg != "--rollback" {
+				positional = append(positional, arg)
 			}
 		}
-		if deployment == "" {
-			return errors.New("usage: deploy sync <deployment> [--no-clean]")
+		if len(positional) != 1 {
+			return errors.New("usage: repo rotate-key <deployment> [--rollback]")
 		}
+		deployment := positional[0]
 
-		_, _ = fmt.Fprintf(w, "Syncing repository for %s...\n", deployment)
-		result, err := instance.GitSyncClean(ctx, deployment, cleanEnabled)
+		if rollback {
+			publicKey, err := instance.RestoreRepoKey(deployment)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(w, "Restored the previous deploy key of %s:\n\n%s\n\n", deployment, publicKey)
+			_, _ = fmt.Fprintln(w, "Make sure this key is registered on the git host again.")
+			return nil
+		}
+
+		rotation, err := instance.RotateRepoKey(deployment)
 		if err != nil {
 			return err
 		}
-		_, _ = fmt.Fprintf(w, "Repository synced: %s@%s\n", result.Branch, shortCommit(result.Commit))
+		_, _ = fmt.Fprintf(w, "Deploy key rotated: %s\n", deployment)
+		printDeployKeyInstructions(w, deployment, rotation.URL, rotation.PublicKey)
+		_, _ = fmt.Fprintf(w, "WARNING: add the new key and remove the old one from the git host before the next sync:\n  old key: %s\n", rotation.OldPublicKey)
+		_, _ = fmt.Fprintf(w, "The old private key is kept at %s until the next successful sync;\n", rotation.BackupPath)
+		_, _ = fmt.Fprintf(w, "to go back to it, run: stevedore repo rotate-key %s --rollback\n", deployment)
 		return nil
 
-	case "up":
-		if len(args) != 2 {
-			return errors.New("usage: deploy up <deployment>")
+	case "list":
+		tag, remaining, err := consumeStringFlag(args[1:], "--tag", "")
+		if err != nil {
+			return err
 		}
-		deployment := args[1]
-
-		_, _ = fmt.Fprintf(w, "Deploying %s...\n", deployment)
-		result, err := instance.Deploy(ctx, deployment, stevedore.ComposeConfig{})
+		if len(remaining) != 0 {
+			return errors.New("usage: repo list [--tag <tag>]")
+		}
+		deployments, err := listDeployments(instance, tag)
 		if err != nil {
 			return err
 		}
+		for _, d := range deployments {
+			_, _ = fmt.Fprintln(w, d)
+		}
+		return nil
+
+	case "set-depends":
+		if len(args) < 2 {
+			return errors.New("usage: repo set-depends <deployment> [<dependency>...]")
+		}
+		deployment := args[1]
+		dependsOn := args[2:]
+
 		db, err := instance.OpenDB()
 		if err != nil {
 			return err
 		}
 		defer func() { _ = db.Close() }()
-		if err := instance.SetDeploymentEnabled(db, deployment, true); err != nil {
+		if err := instance.SetDependencies(db, deployment, dependsOn); err != nil {
 			return err
 		}
-		if err := instance.UpdateDeployStatus(db, deployment); err != nil {
+		deps, err := instance.GetDependencies(db, deployment)
+		if err != nil {
 			return err
 		}
-		_, _ = fmt.Fprintf(w, "Deployed: %s (compose file: %s)\n", result.ProjectName, result.ComposeFile)
-		if len(result.Services) > 0 {
-			_, _ = fmt.Fprintf(w, "Services: %s\n", strings.Join(result.Services, ", "))
+		if len(deps) == 0 {
+			_, _ = fmt.Fprintf(w, "%s has no dependencies\n", deployment)
+		} else {
+			_, _ = fmt.Fprintf(w, "%s depends on: %s\n", deployment, strings.Join(deps, ", "))
 		}
 		return nil
 
-	case "down":
-		if len(args) != 2 {
-			return errors.New("usage: deploy down <deployment>")
+	case "tag":
+		remove := hasFlag(args[1:], "--remove")
+		var positional []string
+		for _, arg := range args[1:] {
+			if arg != "--remove" {
+				positional = append(positional, arg)
+			}
+		}
+		if len(positional) == 0 || (remove && len(positional) < 2) {
+			return errors.New("usage: repo tag <deployment> [<tag>...] [--remove]")
+		}
+		return runRepoTagTo(instance, positional[0], positional[1:], remove, w)
+
+	case "set-schedule":
+		if len(args) < 3 {
+			return errors.New("usage: repo set-schedule <deployment> \"<cron expression>\" | --clear")
+		}
+		return runRepoSetScheduleTo(instance, args[1], strings.Join(args[2:], " "), w)
+
+	default:
+		return fmt.Errorf("repo: unknown subcommand: %s", args[0])
+	}
+}
+
+// runRepoTagTo adds (or with remove, removes) tags of a deployment and
+// prints the tags it ends up with. Without tags it only prints them.
+func runRepoTagTo(instance *stevedore.Instance, deployment string, tags []string, remove bool, w io.Writer) error {
+	db, err := instance.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	if remove {
+		err = instance.RemoveDeploymentTags(db, deployment, tags)
+	} else {
+		err = instance.AddDeploymentTags(db, deployment, tags)
+	}
+	if err != nil {
+		return err
+	}
+
+	current, err := instance.GetDeploymentTags(db, deployment)
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		_, _ = fmt.Fprintf(w, "%s has no tags\n", deployment)
+	} else {
+		_, _ = fmt.Fprintf(w, "%s tags: %s\n", deployment, strings.Join(current, ", "))
+	}
+	return nil
+}
+
+// listDeployments returns every deployment, or with a tag only the ones
+// carrying it.
+func listDeployments(instance *stevedore.Instance, tag string) ([]string, error) {
+	if tag == "" {
+		return instance.ListDeployments()
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+	return instance.DeploymentsWithTag(db, tag)
+}
+
+// runRepoSetScheduleTo sets or clears (--clear) the cron schedule of a deployment.
+func runRepoSetScheduleTo(instance *stevedore.Instance, deployment string, expr string, w io.Writer) error {
+	if expr == "--clear" {
+		expr = ""
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := instance.SetSchedule(db, deployment, expr); err != nil {
+		return err
+	}
+	config, err := instance.GetRepoConfig(db, deployment)
+	if err != nil {
+		return err
+	}
+	if config.Schedule == "" {
+		_, _ = fmt.Fprintf(w, "%s: schedule cleared, polling every %s\n",
+			deployment, time.Duration(config.PollIntervalSeconds)*time.Second)
+		return nil
+	}
+
+	schedule, err := stevedore.ParseCronSchedule(config.Schedule)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "%s: checking for updates on schedule %q\n", deployment, config.Schedule)
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		_, _ = fmt.Fprintf(w, "Next check: %s\n", next.Format("2006-01-02 15:04 MST"))
+	}
+	return nil
+}
+
+// runRepoAddTo registers a repository and prints its deploy key. With an
+// interactive in, it waits until the user added the key and verifies access;
+// otherwise it prints the `repo verify` command to run afterwards.
+func runRepoAddTo(instance *stevedore.Instance, args []string, in io.Reader, w io.Writer) error {
+	noVerify := hasFlag(args, "--no-verify")
+	update := hasFlag(args, "--update")
+	full := hasFlag(args, "--full")
+	var flags []string
+	for _, arg := range args {
+		if arg != "--no-verify" && arg != "--update" && arg != "--full" {
+			flags = append(flags, arg)
+		}
+	}
+	manifestPath, flags, err := consumeStringFlag(flags, "--from", "")
+	if err != nil {
+		return err
+	}
+	if manifestPath != "" {
+		if len(flags) != 0 {
+			return errors.New("usage: repo add --from <manifest.yaml|-> [--update]")
+		}
+		return runRepoAddFromTo(instance, manifestPath, update, in, w)
+	}
+	if update {
+		return errors.New("repo add: --update requires --from <manifest.yaml>")
+	}
+	branch, remaining, err := consumeStringFlag(flags, "--branch", "main")
+	if err != nil {
+		return err
+	}
+	tag, remaining, err := consumeStringFlag(remaining, "--tag", "")
+	if err != nil {
+		return err
+	}
+	subdir, remaining, err := consumeStringFlag(remaining, "--subdir", "")
+	if err != nil {
+		return err
+	}
+	depthStr, remaining, err := consumeStringFlag(remaining, "--depth", "")
+	if err != nil {
+		return err
+	}
+	keyType, remaining, err := consumeStringFlag(remaining, "--key-type", stevedore.KeyTypeEd25519)
+	if err != nil {
+		return err
+	}
+	profile, remaining, err := consumeStringFlag(remaining, "--profile", "")
+	if err != nil {
+		return err
+	}
+	if len(remaining) != 2 {
+		return errors.New("usage: repo add <deployment> <git-url> [--branch <branch> | --tag <glob>] [--subdir <path>] [--depth <n> | --full] [--key-type ed25519|rsa] [--profile <name>] [--no-verify]")
+	}
+	if tag != "" && hasFlag(args, "--branch") {
+		return errors.New("repo add: --branch and --tag are mutually exclusive")
+	}
+	var depth int
+	if depthStr != "" {
+		if full {
+			return errors.New("repo add: --depth and --full are mutually exclusive")
+		}
+		if depth, full, err = stevedore.ParseRepoDepth(depthStr); err != nil {
+			return err
+		}
+	}
+	deployment := remaining[0]
+	url := remaining[1]
+
+	publicKey, err := instance.AddRepo(deployment, stevedore.RepoSpec{
+		URL:         url,
+		Branch:      branch,
+		Tag:         tag,
+		Subdir:      subdir,
+		Depth:       depth,
+		FullHistory: full,
+		KeyType:     keyType,
+		Profile:     profile,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(w, "Repository registered: %s\n", deployment)
+	if tag != "" {
+		_, _ = fmt.Fprintf(w, "Tracking tags matching: %s\n", tag)
+	}
+	if subdir != "" {
+		_, _ = fmt.Fprintf(w, "Deploying from subdirectory: %s (sparse checkout)\n", subdir)
+		if peers, err := instance.RepoCachePeers(deployment); err == nil && len(peers) > 0 {
+			_, _ = fmt.Fprintf(w, "Sharing the clone and deploy key with: %s\n", strings.Join(peers, ", "))
+		}
+	}
+	if profile != "" {
+		_, _ = fmt.Fprintf(w, "Profile: %s (docker-compose.%s.yaml and the %s profile parameters apply)\n", profile, profile, profile)
+	}
+	if full {
+		_, _ = fmt.Fprintln(w, "Cloning the full history")
+	} else if depth > 1 {
+		_, _ = fmt.Fprintf(w, "Cloning the last %d commits\n", depth)
+	}
+	printDeployKeyInstructions(w, deployment, url, publicKey)
+
+	if noVerify {
+		return nil
+	}
+	if in == nil {
+		_, _ = fmt.Fprintf(w, "\nOnce the key is added, check access with: stevedore repo verify %s\n", deployment)
+		return nil
+	}
+
+	_, _ = fmt.Fprint(w, "\nPress Enter once the deploy key is added to verify access (Ctrl-C to skip)... ")
+	if _, err := bufio.NewReader(in).ReadString('\n'); err != nil {
+		_, _ = fmt.Fprintf(w, "\nSkipped verification; run later: stevedore repo verify %s\n", deployment)
+		return nil
+	}
+	return runRepoVerifyTo(instance, deployment, w)
+}
+
+// runRepoVerifyTo checks that the deploy key can read the repository and the
+// tracked branch or tag exists, telling key problems from missing refs.
+// runRepoAddFromTo registers every deployment of a manifest ("-" reads it
+// from in) and prints the new deploy keys at the end. Existing deployments
+// are skipped, or with update get the manifest's branch, interval and
+// schedule. A failing entry is reported and the rest are still applied.
+func runRepoAddFromTo(instance *stevedore.Instance, manifestPath string, update bool, in io.Reader, w io.Writer) error {
+	var manifest *stevedore.RepoManifest
+	var err error
+	if manifestPath == "-" {
+		if in == nil {
+			return errors.New("repo add --from -: the manifest must be piped to stdin")
+		}
+		data, readErr := io.ReadAll(in)
+		if readErr != nil {
+			return readErr
+		}
+		manifest, err = stevedore.ParseRepoManifest(data)
+	} else {
+		manifest, err = stevedore.ReadRepoManifest(manifestPath)
+	}
+	if err != nil {
+		return err
+	}
+	if err := instance.EnsureLayout(); err != nil {
+		return err
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	added := make(map[string]bool)
+	var failed []string
+	for _, entry := range manifest.Deployments {
+		_, statErr := os.Stat(instance.DeploymentDir(entry.Name))
+		exists := statErr == nil
+
+		switch {
+		case exists && !update:
+			_, _ = fmt.Fprintf(w, "Skipped: %s already exists (--update applies the manifest to it)\n", entry.Name)
+			continue
+		case exists:
+			err = updateRepoFromManifest(instance, db, entry, w)
+		default:
+			if _, err = instance.AddRepo(entry.Name, entry.Spec()); err == nil {
+				added[entry.Name] = true
+				if _, err = applyRepoManifestSettings(instance, db, entry, nil); err == nil {
+					_, _ = fmt.Fprintf(w, "Added: %s (%s)\n", entry.Name, manifestRef(entry))
+				}
+			}
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "Failed: %s: %v\n", entry.Name, err)
+			failed = append(failed, entry.Name)
+		}
+	}
+
+	if len(added) > 0 {
+		entries, _, err := repoKeys(instance)
+		if err != nil {
+			return err
+		}
+		var newKeys []repoKeyEntry
+		for _, e := range entries {
+			if added[e.Deployment] {
+				newKeys = append(newKeys, e)
+			}
+		}
+		_, _ = fmt.Fprint(w, "\nAdd these public keys as read-only deploy keys:\n\n")
+		printRepoKeyEntries(w, newKeys)
+		_, _ = fmt.Fprintln(w, "\nOnce the keys are added, check access with: stevedore repo verify <deployment>")
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d manifest deployment(s) failed: %s",
+			len(failed), len(manifest.Deployments), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// updateRepoFromManifest applies a manifest entry to an existing deployment.
+// The URL and tag pattern cannot be changed in place.
+func updateRepoFromManifest(instance *stevedore.Instance, db *sql.DB, entry stevedore.RepoManifestEntry, w io.Writer) error {
+	config, err := instance.GetRepoConfig(db, entry.Name)
+	if err != nil {
+		return err
+	}
+	if entry.URL != config.URL {
+		return fmt.Errorf("registered with %s; a different url needs a new deployment", config.URL)
+	}
+	if entry.Tag != config.TagPattern && entry.Tag != "" {
+		return fmt.Errorf("tracks %s; changing the tag pattern is not supported", manifestRef(stevedore.RepoManifestEntry{Branch: config.Branch, Tag: config.TagPattern}))
+	}
+
+	var changes []string
+	branch := entry.Branch
+	if branch == "" {
+		branch = "main"
+	}
+	if entry.Tag == "" && (branch != config.Branch || config.TagPattern != "") {
+		if _, err := instance.ChangeRepoBranch(entry.Name, branch); err != nil {
+			return err
+		}
+		changes = append(changes, "branch "+branch+" (next sync clones it)")
+	}
+	settings, err := applyRepoManifestSettings(instance, db, entry, config)
+	if err != nil {
+		return err
+	}
+	changes = append(changes, settings...)
+
+	if len(changes) == 0 {
+		_, _ = fmt.Fprintf(w, "Unchanged: %s\n", entry.Name)
+		return nil
+	}
+	_, _ = fmt.Fprintf(w, "Updated: %s: %s\n", entry.Name, strings.Join(changes, ", "))
+	return nil
+}
+
+// applyRepoManifestSettings sets the poll interval and schedule an entry
+// specifies and that differ from current (nil for a new deployment). It
+// returns what changed.
+func applyRepoManifestSettings(instance *stevedore.Instance, db *sql.DB, entry stevedore.RepoManifestEntry, current *stevedore.RepoConfig) ([]string, error) {
+	var changes []string
+	if interval := entry.PollInterval(); interval > 0 {
+		seconds := int(interval / time.Second)
+		if current == nil || current.PollIntervalSeconds != seconds {
+			if err := instance.SetPollInterval(db, entry.Name, seconds); err != nil {
+				return nil, err
+			}
+			changes = append(changes, "interval "+interval.String())
+		}
+	}
+	if entry.Schedule != "" && (current == nil || current.Schedule != entry.Schedule) {
+		if err := instance.SetSchedule(db, entry.Name, entry.Schedule); err != nil {
+			return nil, err
+		}
+		changes = append(changes, fmt.Sprintf("schedule %q", entry.Schedule))
+	}
+	return changes, nil
+}
+
+// manifestRef describes what a manifest entry tracks.
+func manifestRef(entry stevedore.RepoManifestEntry) string {
+	if entry.Tag != "" {
+		return "tags matching " + entry.Tag
+	}
+	if entry.Branch == "" {
+		return "branch main"
+	}
+	return "branch " + entry.Branch
+}
+
+func runRepoVerifyTo(instance *stevedore.Instance, deployment string, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	err := instance.VerifyRepoAccess(ctx, deployment)
+	switch {
+	case err == nil:
+		_, _ = fmt.Fprintf(w, "Access verified: %s\n", deployment)
+		return nil
+	case errors.Is(err, stevedore.ErrRepoAuth):
+		_, _ = fmt.Fprintf(w, "The git host rejected the deploy key of %s, or the URL is wrong.\n", deployment)
+		_, _ = fmt.Fprintf(w, "Check the URL and that this key is added: stevedore repo key %s\n", deployment)
+	case errors.Is(err, stevedore.ErrRefNotFound):
+		_, _ = fmt.Fprintf(w, "The deploy key works, but the tracked ref is missing; fix it with: stevedore repo change-branch %s <branch> --yes\n", deployment)
+	}
+	return fmt.Errorf("verify failed: %w", err)
+}
+
+// repoKeyEntry is a deployment's public deploy key, as listed by `repo keys`.
+type repoKeyEntry struct {
+	Deployment   string `json:"deployment"`
+	URL          string `json:"url,omitempty"`
+	PublicKey    string `json:"publicKey,omitempty"`
+	Provider     string `json:"provider,omitempty"`
+	DeployKeyURL string `json:"deployKeyUrl,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// repoKeys returns the public deploy key of every deployment. A deployment
+// whose key cannot be read is reported with its error.
+func repoKeys(instance *stevedore.Instance) ([]repoKeyEntry, int, error) {
+	deployments, err := instance.ListDeployments()
+	if err != nil {
+		return nil, 0, err
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = db.Close() }()
+
+	entries := make([]repoKeyEntry, 0, len(deployments))
+	failed := 0
+	for _, deployment := range deployments {
+		entry := repoKeyEntry{Deployment: deployment}
+		if config, err := instance.GetRepoConfig(db, deployment); err == nil {
+			entry.URL = config.URL
+			entry.Provider, entry.DeployKeyURL = deployKeyURL(config.URL)
+		}
+		if entry.PublicKey, err = instance.RepoPublicKey(deployment); err != nil {
+			entry.Error = err.Error()
+			failed++
+		}
+		entries = append(entries, entry)
+	}
+	return entries, failed, nil
+}
+
+// runRepoKeysTo prints every deployment with its public deploy key, for
+// registering all of them on the git hosts at once.
+func runRepoKeysTo(instance *stevedore.Instance, w io.Writer) error {
+	entries, failed, err := repoKeys(instance)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		_, _ = fmt.Fprintln(w, "No deployments found")
+		return nil
+	}
+
+	printRepoKeyEntries(w, entries)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deployment keys could not be read", failed, len(entries))
+	}
+	return nil
+}
+
+// printRepoKeyEntries prints deployments with their public deploy keys.
+func printRepoKeyEntries(w io.Writer, entries []repoKeyEntry) {
+	for i, e := range entries {
+		if i > 0 {
+			_, _ = fmt.Fprintln(w)
+		}
+		_, _ = fmt.Fprintf(w, "%s", e.Deployment)
+		if e.URL != "" {
+			_, _ = fmt.Fprintf(w, " (%s)", e.URL)
+		}
+		_, _ = fmt.Fprintln(w)
+		if e.Error != "" {
+			_, _ = fmt.Fprintf(w, "  ERROR: %s\n", e.Error)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "  %s\n", e.PublicKey)
+		if e.DeployKeyURL != "" {
+			_, _ = fmt.Fprintf(w, "  %s Deploy Keys URL: %s\n", e.Provider, e.DeployKeyURL)
+		}
+	}
+}
+
+// printDeployKeyInstructions prints the public key to register as a read-only
+// deploy key, with the deploy keys URL and steps of the repository's git host
+// for GitHub, GitLab and Bitbucket.
+func printDeployKeyInstructions(w io.Writer, deployment string, url string, publicKey string) {
+	keyType := ""
+	if label := deployKeyTypeLabel(publicKey); label != "" {
+		keyType = label + " "
+	}
+	_, _ = fmt.Fprintf(w, "\nAdd this %spublic key as a read-only Deploy Key:\n\n%s\n\n", keyType, publicKey)
+
+	publicKeyLine := strings.TrimSpace(publicKey)
+
+	provider, keysURL := deployKeyURL(url)
+	if provider == "" {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "%s Deploy Keys URL:\n  %s\n\n", provider, keysURL)
+
+	switch provider {
+	case providerGitHub:
+		_, _ = fmt.Fprintf(w, "GitHub CLI (read-only):\n")
+		_, _ = fmt.Fprintf(w, "  gh api -X POST repos/%s/keys \\\n", githubRepoSlug(url))
+		_, _ = fmt.Fprintf(w, "    -f title=\"stevedore-%s\" \\\n", deployment)
+		_, _ = fmt.Fprintf(w, "    -f key=\"%s\" \\\n", publicKeyLine)
+		_, _ = fmt.Fprintf(w, "    -F read_only=true\n\n")
+		_, _ = fmt.Fprintf(w, "Steps:\n")
+		_, _ = fmt.Fprintf(w, "  1. Open the URL above in your browser\n")
+		_, _ = fmt.Fprintf(w, "  2. Click 'Add deploy key'\n")
+		_, _ = fmt.Fprintf(w, "  3. Title: stevedore-%s\n", deployment)
+		_, _ = fmt.Fprintf(w, "  4. Paste the public key above\n")
+		_, _ = fmt.Fprintf(w, "  5. Leave 'Allow write access' unchecked (read-only)\n")
+		_, _ = fmt.Fprintf(w, "  6. Click 'Add key'\n")
+	case providerGitLab:
+		_, _ = fmt.Fprintf(w, "Steps:\n")
+		_, _ = fmt.Fprintf(w, "  1. Open the URL above in your browser (Settings > Repository > Deploy keys)\n")
+		_, _ = fmt.Fprintf(w, "  2. Click 'Add new key'\n")
+		_, _ = fmt.Fprintf(w, "  3. Title: stevedore-%s\n", deployment)
+		_, _ = fmt.Fprintf(w, "  4. Paste the public key above\n")
+		_, _ = fmt.Fprintf(w, "  5. Leave 'Grant write permissions to this key' unchecked (read-only)\n")
+		_, _ = fmt.Fprintf(w, "  6. Click 'Add key'\n")
+	case providerBitbucket:
+		_, _ = fmt.Fprintf(w, "Steps:\n")
+		_, _ = fmt.Fprintf(w, "  1. Open the URL above in your browser (Repository settings > Access keys)\n")
+		_, _ = fmt.Fprintf(w, "  2. Click 'Add key'\n")
+		_, _ = fmt.Fprintf(w, "  3. Label: stevedore-%s\n", deployment)
+		_, _ = fmt.Fprintf(w, "  4. Paste the public key above\n")
+		_, _ = fmt.Fprintf(w, "  5. Click 'Add SSH key' (access keys are always read-only)\n")
+	}
+}
+
+// deployKeyTypeLabel names the type of an OpenSSH public key ("ED25519",
+// "RSA"), or returns "" for other types.
+func deployKeyTypeLabel(publicKey string) string {
+	switch {
+	case strings.HasPrefix(publicKey, "ssh-ed25519 "):
+		return "ED25519"
+	case strings.HasPrefix(publicKey, "ssh-rsa "):
+		return "RSA"
+	}
+	return ""
+}
+
+func runDeployTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	pal, args := newPalette(args)
+	if len(args) == 0 {
+		return errors.New("deploy: missing subcommand (sync|up|down|archive|unarchive|scale|validate|drift|describe|cancel|history)")
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "sync":
+		return runDeploySyncTo(ctx, instance, args[1:], pal, w)
+
+	case "up":
+		tag, remaining, err := consumeStringFlag(args[1:], "--tag", "")
+		if err != nil {
+			return err
+		}
+		withDeps := hasFlag(remaining, "--with-deps")
+		force := hasFlag(remaining, "--force")
+		all := hasFlag(remaining, "--all")
+		includeSelf := hasFlag(remaining, "--include-self")
+		noCache := hasFlag(remaining, "--no-cache")
+		forceRecreate := hasFlag(remaining, "--force-recreate")
+		noRecreate := hasFlag(remaining, "--no-recreate")
+		noRepoEnv := hasFlag(remaining, "--no-repo-env")
+		positional, err := deployPositionals("up", remaining,
+			"--with-deps", "--force", "--all", "--include-self", "--no-cache", "--force-recreate", "--no-recreate", "--no-repo-env")
+		if err != nil {
+			return err
+		}
+		if forceRecreate && noRecreate {
+			return errors.New("deploy up: --force-recreate and --no-recreate are mutually exclusive")
+		}
+		// --no-cache rebuilds and --force-recreate restarts everything, so
+		// neither skips an unchanged deployment
+		config := stevedore.ComposeConfig{
+			SkipUnchanged: !force && !noCache && !forceRecreate,
+			NoCache:       noCache,
+			ForceRecreate: forceRecreate,
+			NoRecreate:    noRecreate,
+			NoRepoEnv:     noRepoEnv,
+		}
+		if live, ok := w.(liveOutput); ok {
+			config.Output = live
+		}
+		if all || tag != "" {
+			if len(positional) != 0 || withDeps || (all && tag != "") {
+				return errors.New("usage: deploy up --all | --tag <tag> [--force] [--no-cache] [--force-recreate | --no-recreate] [--no-repo-env] [--include-self]")
+			}
+			return runDeployAllTo(ctx, instance, true, includeSelf, tag, config, pal, w)
+		}
+		if len(positional) != 1 {
+			return errors.New("usage: deploy up <deployment> [--with-deps] [--force] [--no-cache] [--force-recreate | --no-recreate] [--no-repo-env] [--include-self] | deploy up --all | --tag <tag> [--force] [--no-cache] [--force-recreate | --no-recreate] [--no-repo-env] [--include-self]")
+		}
+		deployment := positional[0]
+
+		db, err := instance.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = db.Close() }()
+
+		order := []string{deployment}
+		if withDeps {
+			if order, err = instance.DeployOrder(db, deployment); err != nil {
+				return err
+			}
+		}
+		// Checked before deploying anything, so --with-deps does not deploy
+		// half of the order first
+		if !includeSelf {
+			for _, name := range order {
+				if stevedore.IsStevedoreDeployment(name) {
+					return fmt.Errorf("%w: deploy up would replace the running daemon outside the self-update worker; update it with: stevedore self-update (or pass --include-self to deploy it through docker compose anyway)", stevedore.ErrSelfDeployment)
+				}
+			}
+		}
+
+		for _, name := range order {
+			if err := deployUpTo(ctx, instance, db, name, config, pal, w); err != nil {
+				return err
+			}
+			if name != deployment {
+				_, _ = fmt.Fprintf(w, "Waiting for %s to become healthy...\n", name)
+				if err := instance.WaitForHealthy(ctx, name, instance.HealthWaitOptions(name, stevedore.DefaultDependencyWaitTimeout)); err != nil {
+					return fmt.Errorf("dependency %s: %w", name, err)
+				}
+			}
+		}
+		return nil
+
+	case "down":
+		timeoutStr, remaining, err := consumeStringFlag(args[1:], "--timeout", "")
+		if err != nil {
+			return err
+		}
+		rmi, remaining, err := consumeStringFlag(remaining, "--rmi", "")
+		if err != nil {
+			return err
+		}
+		tag, remaining, err := consumeStringFlag(remaining, "--tag", "")
+		if err != nil {
+			return err
+		}
+		all := hasFlag(remaining, "--all")
+		includeSelf := hasFlag(remaining, "--include-self")
+		volumes := hasFlag(remaining, "--volumes")
+		positional, err := deployPositionals("down", remaining, "--all", "--include-self", "--volumes")
+		if err != nil {
+			return err
+		}
+		config := stevedore.ComposeConfig{RemoveVolumes: volumes, RemoveImages: rmi}
+		if timeoutStr != "" {
+			if config.StopTimeout, err = stevedore.ParseStopTimeout(timeoutStr); err != nil {
+				return err
+			}
+		}
+		if all || tag != "" {
+			if len(positional) != 0 || (all && tag != "") {
+				return errors.New("usage: deploy down --all | --tag <tag> [--include-self] [--timeout <duration>]")
+			}
+			// Wiping the data of every deployment at once is never what a
+			// teardown of one test deployment meant
+			if volumes || rmi != "" {
+				return errors.New("--volumes and --rmi apply to a single deployment, not --all or --tag")
+			}
+			return runDeployAllTo(ctx, instance, false, includeSelf, tag, config, pal, w)
+		}
+		if len(positional) != 1 || includeSelf {
+			return errors.New("usage: deploy down <deployment> [--timeout <duration>] [--volumes] [--rmi local|all] | deploy down --all | --tag <tag> [--include-self]")
+		}
+
+		db, err := instance.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = db.Close() }()
+		return deployDownTo(ctx, instance, db, positional[0], config, pal, w)
+
+	case "archive", "unarchive":
+		positional, err := deployPositionals(args[0], args[1:])
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: deploy %s <deployment>", args[0])
+		}
+		db, err := instance.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = db.Close() }()
+		if args[0] == "unarchive" {
+			return deployUnarchiveTo(instance, db, positional[0], pal, w)
+		}
+		return deployArchiveTo(ctx, instance, db, positional[0], pal, w)
+
+	case "scale":
+		reset := hasFlag(args[1:], "--reset")
+		positional, err := deployPositionals("scale", args[1:], "--reset")
+		if err != nil {
+			return err
+		}
+		if len(positional) == 0 || (reset && len(positional) != 1) {
+			return errors.New("usage: deploy scale <deployment> <service>=<n>... | deploy scale <deployment> [--reset]")
+		}
+		return runDeployScaleTo(ctx, instance, positional[0], positional[1:], reset, pal, w)
+
+	case "validate":
+		positional, err := deployPositionals("validate", args[1:])
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return errors.New("usage: deploy validate <deployment>")
+		}
+		return runDeployValidateTo(ctx, instance, positional[0], pal, w)
+
+	case "drift":
+		apply := hasFlag(args[1:], "--apply")
+		positional, err := deployPositionals("drift", args[1:], "--apply")
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return errors.New("usage: deploy drift <deployment> [--apply]")
+		}
+		return runDeployDriftTo(ctx, instance, positional[0], apply, pal, w)
+
+	case "describe":
+		positional, err := deployPositionals("describe", args[1:], "--json")
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return errors.New("usage: deploy describe <deployment> [--json]")
+		}
+		return runDeployDescribeTo(instance, positional[0], w)
+
+	case "cancel":
+		positional, err := deployPositionals("cancel", args[1:])
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return errors.New("usage: deploy cancel <deployment>")
+		}
+		return runDeployCancelTo(ctx, instance, positional[0], w)
+
+	case "history":
+		deployment, limit, err := parseDeployHistoryArgs(args[1:])
+		if err != nil {
+			return err
+		}
+		return runDeployHistoryTo(instance, deployment, limit, pal, w)
+
+	default:
+		return fmt.Errorf("deploy: unknown subcommand: %s", args[0])
+	}
+}
+
+// deployPositionals returns the positional arguments of a deploy
+// subcommand, skipping the boolean flags it accepts. Any other argument that
+// starts with "-" is an error: a mistyped flag is not taken for the
+// deployment name, and a name that looks like a flag is refused up front.
+func deployPositionals(subcommand string, args []string, flags ...string) ([]string, error) {
+	var positional []string
+	for _, arg := range args {
+		if slices.Contains(flags, arg) {
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			return nil, fmt.Errorf("deploy %s: unknown flag %s (deployment names cannot start with '-')", subcommand, arg)
+		}
+		positional = append(positional, arg)
+	}
+	return positional, nil
+}
+
+// deploySyncResult is the `deploy sync --json` output, matching the fields of
+// `POST /api/sync/{name}`.
+type deploySyncResult struct {
+	Deployment   string   `json:"deployment"`
+	Commit       string   `json:"commit,omitempty"`
+	Branch       string   `json:"branch,omitempty"`
+	Tag          string   `json:"tag,omitempty"`
+	RemovedFiles []string `json:"removedFiles"`
+	DryRun       bool     `json:"dryRun,omitempty"`
+}
+
+// runDeploySyncTo syncs a deployment's checkout and lists the untracked files
+// the clean step removed. With --dry-run-clean it only lists what a clean
+// sync would remove from the current checkout.
+func runDeploySyncTo(ctx context.Context, instance *stevedore.Instance, args []string, pal palette, w io.Writer) error {
+	cleanEnabled := !hasFlag(args, "--no-clean")
+	verbose := hasFlag(args, "--verbose") || hasFlag(args, "-v")
+	jsonOutput := hasFlag(args, "--json")
+	dryRunClean := hasFlag(args, "--dry-run-clean")
+	positional, err := deployPositionals("sync", args, "--no-clean", "--verbose", "-v", "--json", "--dry-run-clean")
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || (dryRunClean && !cleanEnabled) {
+		return errors.New("usage: deploy sync <deployment> [--no-clean | --dry-run-clean] [--json] [--verbose]")
+	}
+	deployment := positional[0]
+
+	if dryRunClean {
+		files, err := instance.GitCleanDryRun(ctx, deployment)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return printSyncJSON(w, deploySyncResult{Deployment: deployment, RemovedFiles: files, DryRun: true})
+		}
+		if len(files) == 0 {
+			_, _ = fmt.Fprintf(w, "Clean would remove nothing from %s\n", deployment)
+		}
+		for _, f := range files {
+			_, _ = fmt.Fprintf(w, "Would remove untracked: %s\n", f)
+		}
+		return nil
+	}
+
+	if !jsonOutput {
+		_, _ = fmt.Fprintf(w, "Syncing repository for %s...\n", deployment)
+		if verbose {
+			_, _ = fmt.Fprintf(w, "Git worker image: %s\n", instance.GitWorkerImage(deployment))
+		}
+	}
+	result, err := instance.GitSyncClean(ctx, deployment, cleanEnabled)
+	if err != nil {
+		return err
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	if err := instance.UpdateSyncStatus(db, deployment, result.Commit); err != nil {
+		return err
+	}
+	if err := instance.UpdateSyncCommitInfo(db, deployment, result.CommitInfo); err != nil {
+		return err
+	}
+	if result.Tag != "" {
+		if err := instance.UpdateSyncTag(db, deployment, result.Tag); err != nil {
+			return err
+		}
+	}
+
+	if jsonOutput {
+		return printSyncJSON(w, deploySyncResult{
+			Deployment:   deployment,
+			Commit:       result.Commit,
+			Branch:       result.Branch,
+			Tag:          result.Tag,
+			RemovedFiles: result.RemovedFiles,
+		})
+	}
+	_, _ = fmt.Fprintln(w, pal.ok(fmt.Sprintf("Repository synced: %s@%s", result.Ref(), shortCommit(result.Commit))))
+	for _, f := range result.RemovedFiles {
+		_, _ = fmt.Fprintf(w, "Removed untracked: %s\n", f)
+	}
+	return nil
+}
+
+// printSyncJSON prints a `deploy sync --json` result.
+func printSyncJSON(w io.Writer, result deploySyncResult) error {
+	if result.RemovedFiles == nil {
+		result.RemovedFiles = []string{}
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(w, string(data))
+	return nil
+}
+
+// parseDeployHistoryArgs parses `deploy history <deployment> [--limit <n>]`.
+func parseDeployHistoryArgs(args []string) (string, int, error) {
+	limitStr, remaining, err := consumeStringFlag(args, "--limit", "20")
+	if err != nil {
+		return "", 0, err
+	}
+	positional, err := deployPositionals("history", remaining)
+	if err != nil {
+		return "", 0, err
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return "", 0, fmt.Errorf("invalid --limit %q: expected a positive number", limitStr)
+	}
+	if len(positional) != 1 {
+		return "", 0, errors.New("usage: deploy history <deployment> [--limit <n>]")
+	}
+	return positional[0], limit, nil
+}
+
+// runDeployHistoryTo prints the recent deploys of a deployment, newest first.
+// The container logs captured with the newest failure are printed below it.
+func runDeployHistoryTo(instance *stevedore.Instance, deployment string, limit int, pal palette, w io.Writer) error {
+	records, err := instance.DeployHistory(deployment, limit)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		_, _ = fmt.Fprintln(w, "No deploys recorded")
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(w, "%-25s  %-9s  %-12s  %s\n", "STARTED", "DURATION", "COMMIT", "RESULT")
+	shownLogs := false
+	for _, r := range records {
+		result := pal.ok("ok")
+		message, logs, _ := strings.Cut(r.Error, "\n")
+		if !r.Success {
+			result = pal.bad("failed: " + message)
+		}
+		commit := shortCommit(r.Commit)
+		if commit == "" {
+			commit = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%-25s  %-9s  %-12s  %s\n", r.StartedAt.Format(time.RFC3339),
+			r.Duration().Round(time.Second/10), commit, result)
+		for _, image := range r.Images {
+			_, _ = fmt.Fprintf(w, "    %s: %s\n", image.Service, image.Digest)
+		}
+		if logs != "" && !shownLogs {
+			shownLogs = true
+			for _, line := range strings.Split(logs, "\n") {
+				_, _ = fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+	}
+	return nil
+}
+
+// runDeployCancelTo asks the daemon to cancel the sync or deploy it is running
+// for a deployment and reports whether one was running.
+// deployUpTo deploys one deployment and marks it enabled and desired up.
+func deployUpTo(ctx context.Context, instance *stevedore.Instance, db *sql.DB, name string, config stevedore.ComposeConfig, pal palette, w io.Writer) error {
+	if err := instance.CheckNotArchived(db, name); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "Deploying %s...\n", name)
+	result, err := instance.Deploy(ctx, name, config)
+	if err != nil {
+		return err
+	}
+	if err := instance.SetDeploymentEnabled(db, name, true); err != nil {
+		return err
+	}
+	if err := instance.SetDesiredState(db, name, stevedore.DesiredStateUp); err != nil {
+		return err
+	}
+	if result.Skipped {
+		_, _ = fmt.Fprintln(w, pal.warn(fmt.Sprintf("No changes, skipped: %s is up to date (use --force to redeploy)", result.ProjectName)))
+		return nil
+	}
+	if err := instance.UpdateDeployStatus(db, name); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(w, pal.ok(fmt.Sprintf("Deployed: %s (compose file: %s)", result.ProjectName, result.ComposeFile)))
+	if len(result.Services) > 0 {
+		_, _ = fmt.Fprintf(w, "Services: %s\n", strings.Join(result.Services, ", "))
+	}
+	printServiceTimings(w, result.Timings)
+	printHookResults(w, pal, result.Hooks)
+	return nil
+}
+
+// deployDownTo stops one deployment and marks it disabled and desired down,
+// restoring both when the stop fails.
+func deployDownTo(ctx context.Context, instance *stevedore.Instance, db *sql.DB, deployment string, config stevedore.ComposeConfig, pal palette, w io.Writer) error {
+	_, _ = fmt.Fprintf(w, "Stopping %s...\n", deployment)
+	previous, err := instance.GetRepoConfig(db, deployment)
+	if err != nil {
+		return err
+	}
+	if err := instance.SetDeploymentEnabled(db, deployment, false); err != nil {
+		return err
+	}
+	if err := instance.SetDesiredState(db, deployment, stevedore.DesiredStateDown); err != nil {
+		return err
+	}
+	if err := instance.Stop(ctx, deployment, config); err != nil {
+		if reenableErr := instance.SetDeploymentEnabled(db, deployment, true); reenableErr != nil {
+			return fmt.Errorf("stop failed: %w (failed to re-enable deployment: %v)", err, reenableErr)
+		}
+		if restoreErr := instance.SetDesiredState(db, deployment, previous.DesiredState); restoreErr != nil {
+			return fmt.Errorf("stop failed: %w (failed to restore desired state: %v)", err, restoreErr)
+		}
+		return err
+	}
+	_, _ = fmt.Fprintln(w, pal.ok("Stopped: "+deployment))
+	if config.RemoveVolumes {
+		_, _ = fmt.Fprintln(w, "Removed the volumes of "+deployment)
+	}
+	if config.RemoveImages != "" {
+		_, _ = fmt.Fprintf(w, "Removed the images of %s (%s)\n", deployment, config.RemoveImages)
+	}
+	return nil
+}
+
+// deployArchiveTo stops a deployment like `deploy down` and archives it, so
+// the daemon no longer polls it. The checkout, deploy key and parameters stay.
+func deployArchiveTo(ctx context.Context, instance *stevedore.Instance, db *sql.DB, deployment string, pal palette, w io.Writer) error {
+	if err := deployDownTo(ctx, instance, db, deployment, stevedore.ComposeConfig{}, pal, w); err != nil {
+		return err
+	}
+	if err := instance.SetDeploymentArchived(db, deployment, true); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(w, pal.ok("Archived: "+deployment))
+	_, _ = fmt.Fprintf(w, "The daemon no longer polls it; restore it with: stevedore deploy unarchive %s\n", deployment)
+	return nil
+}
+
+// deployUnarchiveTo re-enables polling of an archived deployment. Its
+// containers stay stopped until the next deploy.
+func deployUnarchiveTo(instance *stevedore.Instance, db *sql.DB, deployment string, pal palette, w io.Writer) error {
+	config, err := instance.GetRepoConfig(db, deployment)
+	if err != nil {
+		return fmt.Errorf("deployment %s: %w", deployment, err)
+	}
+	if !config.Archived {
+		return fmt.Errorf("deployment %s is not archived", deployment)
+	}
+	if err := instance.SetDeploymentArchived(db, deployment, false); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(w, pal.ok("Unarchived: "+deployment))
+	_, _ = fmt.Fprintf(w, "The daemon polls it again; start it now with: stevedore deploy up %s\n", deployment)
+	return nil
+}
+
+// runDeployAllTo starts (up) or stops every deployment: dependencies first when
+// starting, dependents first when stopping. A failure is reported and the rest
+// still run; a deployment whose dependency failed to start or was skipped is
+// not started.
+// The self-deployment is skipped unless includeSelf is set. With a tag, only
+// the deployments carrying it are included.
+func runDeployAllTo(ctx context.Context, instance *stevedore.Instance, up bool, includeSelf bool, tag string, config stevedore.ComposeConfig, pal palette, w io.Writer) error {
+	db, err := instance.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	graph, err := instance.DependencyGraph(db)
+	if err != nil {
+		return err
+	}
+	order, err := instance.DeployOrderAll(db)
+	if err != nil {
+		return err
+	}
+	if tag != "" {
+		tagged, err := instance.DeploymentsWithTag(db, tag)
+		if err != nil {
+			return err
+		}
+		order = slices.DeleteFunc(order, func(name string) bool {
+			return !slices.Contains(tagged, name)
+		})
+	}
+	if !up {
+		slices.Reverse(order)
+	}
+	if len(order) == 0 {
+		if tag != "" {
+			_, _ = fmt.Fprintf(w, "No deployments tagged %s\n", tag)
+			return nil
+		}
+		_, _ = fmt.Fprintln(w, "No deployments found")
+		return nil
+	}
+
+	failed := make(map[string]bool)
+	skipped := make(map[string]bool)
+	var failedNames []string
+	succeeded := 0
+	for _, name := range order {
+		if stevedore.IsStevedoreDeployment(name) && !includeSelf {
+			_, _ = fmt.Fprintf(w, "Skipping %s (self-deployment, use --include-self)\n", name)
+			skipped[name] = true
+			continue
+		}
+		if up && deploymentArchived(instance, name) {
+			_, _ = fmt.Fprintf(w, "Skipping %s (archived)\n", name)
+			skipped[name] = true
+			continue
+		}
+
+		if up {
+			err = nil
+			for _, dep := range graph[name] {
+				if failed[dep] {
+					err = fmt.Errorf("dependency %s failed", dep)
+					break
+				}
+				if skipped[dep] {
+					err = fmt.Errorf("dependency %s skipped", dep)
+					break
+				}
+			}
+			if err == nil {
+				err = instance.WaitForDependencies(ctx, db, name, 0)
+			}
+			if err == nil {
+				err = deployUpTo(ctx, instance, db, name, config, pal, w)
+			}
+		} else {
+			err = deployDownTo(ctx, instance, db, name, config, pal, w)
+		}
+
+		if err != nil {
+			_, _ = fmt.Fprintln(w, pal.bad(fmt.Sprintf("Failed: %s: %v", name, err)))
+			failed[name] = true
+			failedNames = append(failedNames, name)
+			continue
+		}
+		succeeded++
+	}
+
+	_, _ = fmt.Fprintf(w, "\n%d succeeded, %d failed\n", succeeded, len(failedNames))
+	if len(failedNames) > 0 {
+		return fmt.Errorf("%d deployment(s) failed: %s", len(failedNames), strings.Join(failedNames, ", "))
+	}
+	return nil
+}
+
+func runDeployCancelTo(ctx context.Context, instance *stevedore.Instance, deployment string, w io.Writer) error {
+	if err := stevedore.ValidateDeploymentName(deployment); err != nil {
+		return err
+	}
+
+	adminKey, err := instance.GetAdminKey()
+	if err != nil {
+		return fmt.Errorf("cannot read admin key: %w", err)
+	}
+	client, err := newDaemonClient(adminKey)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := client.Cancel(ctx, deployment)
+	if err != nil {
+		return fmt.Errorf("cancel failed: %w", err)
+	}
+	if !result.Cancelled {
+		_, _ = fmt.Fprintf(w, "No operation running for %s\n", deployment)
+		return nil
+	}
+	_, _ = fmt.Fprintf(w, "Cancelled the in-progress operation for %s\n", deployment)
+	return nil
+}
+
+// runDeployDriftTo reports how the running containers differ from the compose
+// file in the checkout. With apply, a drifted deployment is redeployed with
+// recreated containers; without it, drift is an error so scripts can detect it.
+// runDeployScaleTo stores replica overrides for services and redeploys, so
+// later deploys keep them. Without overrides it lists the stored ones; reset
+// drops them and redeploys with the compose file's counts.
+func runDeployScaleTo(ctx context.Context, instance *stevedore.Instance, deployment string, args []string, reset bool, pal palette, w io.Writer) error {
+	db, err := instance.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	if len(args) == 0 && !reset {
+		scales, err := instance.GetServiceScales(db, deployment)
+		if err != nil {
+			return err
+		}
+		if len(scales) == 0 {
+			_, _ = fmt.Fprintf(w, "No scale overrides for %s\n", deployment)
+			return nil
+		}
+		services := make([]string, 0, len(scales))
+		for service := range scales {
+			services = append(services, service)
+		}
+		slices.Sort(services)
+		for _, service := range services {
+			_, _ = fmt.Fprintf(w, "%s=%d\n", service, scales[service])
+		}
+		return nil
+	}
+
+	if reset {
+		if err := instance.ClearServiceScales(db, deployment); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "Scale overrides of %s removed\n", deployment)
+	} else {
+		scales := make(map[string]int)
+		for _, arg := range args {
+			service, replicas, err := stevedore.ParseServiceScale(arg)
+			if err != nil {
+				return err
+			}
+			scales[service] = replicas
+		}
+		if err := instance.SetServiceScales(ctx, db, deployment, scales); err != nil {
+			return err
+		}
+	}
+
+	if err := deployUpTo(ctx, instance, db, deployment, stevedore.ComposeConfig{}, pal, w); err != nil {
+		return err
+	}
+	status, err := instance.GetDeploymentStatus(ctx, deployment)
+	if err != nil {
+		return err
+	}
+	for _, scale := range status.Scale {
+		_, _ = fmt.Fprintf(w, "Scale: %s %d/%d running\n", scale.Service, scale.Running, scale.Replicas)
+	}
+	return nil
+}
+
+// runDeployValidateTo checks a deployment's compose file with `docker compose
+// config` and fails when it would not deploy.
+func runDeployValidateTo(ctx context.Context, instance *stevedore.Instance, deployment string, pal palette, w io.Writer) error {
+	result, err := instance.ValidateCompose(ctx, deployment)
+	if err != nil {
+		return err
+	}
+	for _, warning := range result.Warnings {
+		_, _ = fmt.Fprintln(w, pal.warn("warning: "+warning))
+	}
+	if result.Valid() {
+		_, _ = fmt.Fprintln(w, pal.ok(fmt.Sprintf("%s is valid: %d service(s) (%s)",
+			result.ComposeFile, len(result.Services), strings.Join(result.Services, ", "))))
+		return nil
+	}
+
+	problems := result.Problems()
+	_, _ = fmt.Fprintln(w, pal.bad(fmt.Sprintf("%s is invalid:", result.ComposeFile)))
+	for _, problem := range problems {
+		_, _ = fmt.Fprintf(w, "  %s\n", problem)
+	}
+	return fmt.Errorf("%s: %d problem(s) found", result.ComposeFile, len(problems))
+}
+
+// runDeployDescribeTo prints the configuration of a deployment without
+// secret values, for pasting into a review.
+func runDeployDescribeTo(instance *stevedore.Instance, deployment string, w io.Writer) error {
+	db, err := instance.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	desc, err := instance.DescribeDeployment(db, deployment)
+	if err != nil {
+		return err
+	}
+
+	list := func(values []string) string {
+		if len(values) == 0 {
+			return "(none)"
+		}
+		return strings.Join(values, ", ")
+	}
+	depth := "full history"
+	if desc.Depth > 0 {
+		depth = fmt.Sprintf("%d commit(s)", desc.Depth)
+	}
+	polling := fmt.Sprintf("every %s", time.Duration(desc.PollIntervalSeconds)*time.Second)
+	if desc.Schedule != "" {
+		polling = fmt.Sprintf("schedule %q", desc.Schedule)
+	}
+	state := desc.DesiredState
+	if desc.Archived {
+		state += " (archived)"
+	}
+
+	_, _ = fmt.Fprintf(w, "Deployment: %s\n", desc.Deployment)
+	_, _ = fmt.Fprintf(w, "URL:        %s\n", desc.URL)
+	if desc.TagPattern != "" {
+		_, _ = fmt.Fprintf(w, "Tag:        %s\n", desc.TagPattern)
+	} else {
+		_, _ = fmt.Fprintf(w, "Branch:     %s\n", desc.Branch)
+	}
+	if desc.Subdir != "" {
+		_, _ = fmt.Fprintf(w, "Subdir:     %s\n", desc.Subdir)
+	}
+	if desc.Profile != "" {
+		_, _ = fmt.Fprintf(w, "Profile:    %s\n", desc.Profile)
+	}
+	_, _ = fmt.Fprintf(w, "Depth:      %s\n", depth)
+	_, _ = fmt.Fprintf(w, "Deploy key: %s\n", desc.KeyType)
+	_, _ = fmt.Fprintf(w, "Polling:    %s\n", polling)
+	_, _ = fmt.Fprintf(w, "State:      %s\n", state)
+	_, _ = fmt.Fprintf(w, "Tags:       %s\n", list(desc.Tags))
+	_, _ = fmt.Fprintf(w, "Depends on: %s\n", list(desc.DependsOn))
+
+	if len(desc.Ingress) == 0 {
+		_, _ = fmt.Fprintln(w, "Ingress:    (none)")
+	} else {
+		_, _ = fmt.Fprintln(w, "Ingress:")
+		names := make([]string, 0, len(desc.Ingress))
+		for name := range desc.Ingress {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			_, _ = fmt.Fprintf(w, "  %s=%s\n", name, desc.Ingress[name])
+		}
+	}
+	_, _ = fmt.Fprintf(w, "Parameters: %s\n", list(desc.Parameters))
+	if desc.Profile != "" {
+		_, _ = fmt.Fprintf(w, "From profile: %s\n", list(desc.ProfileParameters))
+	}
+	_, _ = fmt.Fprintf(w, "Global:     %s\n", list(desc.GlobalParameters))
+	return nil
+}
+
+func runDeployDriftTo(ctx context.Context, instance *stevedore.Instance, deployment string, apply bool, pal palette, w io.Writer) error {
+	report, err := instance.DetectDrift(ctx, deployment)
+	if err != nil {
+		return err
+	}
+	if report.InSync() {
+		_, _ = fmt.Fprintln(w, pal.ok(fmt.Sprintf("%s matches %s: no drift", deployment, report.ComposeFile)))
+		return nil
+	}
+
+	_, _ = fmt.Fprintln(w, pal.warn(fmt.Sprintf("%s differs from %s:", deployment, report.ComposeFile)))
+	for _, d := range report.Drifts {
+		_, _ = fmt.Fprintf(w, "  %s  %s\n", pal.warn(fmt.Sprintf("%-15s", d.Kind)), d)
+	}
+	if !apply {
+		return fmt.Errorf("%d difference(s) found; run with --apply to redeploy", len(report.Drifts))
+	}
+
+	_, _ = fmt.Fprintf(w, "Redeploying %s...\n", deployment)
+	result, err := instance.Deploy(ctx, deployment, stevedore.ComposeConfig{ForceRecreate: true})
+	if err != nil {
+		return err
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	if err := instance.UpdateDeployStatus(db, deployment); err != nil {
+		return err
+	}
+	printHookResults(w, pal, result.Hooks)
+
+	report, err = instance.DetectDrift(ctx, deployment)
+	if err != nil {
+		return err
+	}
+	if !report.InSync() {
+		return fmt.Errorf("%d difference(s) remain after redeploy", len(report.Drifts))
+	}
+	_, _ = fmt.Fprintln(w, pal.ok(fmt.Sprintf("Converged: %s matches %s", deployment, report.ComposeFile)))
+	return nil
+}
+
+func runStatusTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	if hasFlag(args, "--watch") {
+		// executeCommand buffers output, so live updates only work when main()
+		// streams to the terminal (see runStatusWatch).
+		return errors.New("status --watch requires an interactive terminal")
+	}
+	pal, args := newPalette(args)
+	return renderStatusTo(context.Background(), instance, args, pal, w)
+}
+
+// runStatusWatch clears the screen and re-renders status every interval until ctx is cancelled.
+func runStatusWatch(ctx context.Context, instance *stevedore.Instance, args []string, w io.Writer) error {
+	pal, args := newPalette(args)
+	intervalStr, args, err := consumeStringFlag(args, "--interval", "2s")
+	if err != nil {
+		return err
+	}
+	interval, err := time.ParseDuration(intervalStr)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid --interval: %q", intervalStr)
+	}
+
+	statusArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "--watch" {
+			statusArgs = append(statusArgs, arg)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Render into a buffer first so the screen is cleared and redrawn in one write
+		var buf strings.Builder
+		buf.WriteString("\033[H\033[2J")
+		_, _ = fmt.Fprintf(&buf, "Every %s: stevedore status %s    %s\n\n",
+			interval, strings.Join(statusArgs, " "), time.Now().Format(time.RFC3339))
+		if err := renderStatusTo(ctx, instance, statusArgs, pal, &buf); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			_, _ = fmt.Fprintf(&buf, "ERROR: %v\n", err)
+		}
+		_, _ = io.WriteString(w, buf.String())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func renderStatusTo(ctx context.Context, instance *stevedore.Instance, args []string, pal palette, w io.Writer) error {
+	tag, args, err := consumeStringFlag(args, "--tag", "")
+	if err != nil {
+		return err
+	}
+	withStats := false
+	withEnv := false
+	var positional []string
+	for _, arg := range args {
+		switch arg {
+		case "--stats":
+			withStats = true
+		case "--env":
+			withEnv = true
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) > 1 || (tag != "" && len(positional) != 0) {
+		return errors.New("usage: status [<deployment> | --tag <tag>] [--stats] [--env] [--watch [--interval 2s]]")
+	}
+	if withStats && len(positional) == 0 {
+		return errors.New("status: --stats requires a deployment name")
+	}
+	if withEnv && len(positional) == 0 {
+		return errors.New("status: --env requires a deployment name")
+	}
+	args = positional
+
+	if state := maintenanceState(instance); state != nil {
+		_, _ = fmt.Fprintln(w, pal.warn("Maintenance: "+maintenanceSummary(state)+", automatic deploys paused"))
+		_, _ = fmt.Fprintln(w)
+	}
+
+	if len(args) == 0 {
+		// List all deployments (or the tagged ones) with status
+		deployments, err := listDeployments(instance, tag)
+		if err != nil {
+			return err
+		}
+		if len(deployments) == 0 {
+			if tag != "" {
+				_, _ = fmt.Fprintf(w, "No deployments tagged %s\n", tag)
+				return nil
+			}
+			_, _ = fmt.Fprintln(w, "No deployments found")
+			return nil
+		}
+
+		for _, d := range deployments {
+			status, err := instance.GetDeploymentStatus(ctx, d)
+			if err != nil {
+				_, _ = fmt.Fprintf(w, "%-20s  %s\n", d, pal.bad(fmt.Sprintf("ERROR: %v", err)))
+				continue
+			}
+			healthMark := pal.ok("✓")
+			if !status.Healthy {
+				healthMark = pal.bad("✗")
+			}
+			crashInfo := ""
+			if crash := crashLoopState(instance, d); crash != nil {
+				crashInfo = "  " + pal.bad("[CRASH LOOP]")
+			}
+			if availableUpdate(instance, d) != "" {
+				crashInfo += "  " + pal.warn("[UPDATE AVAILABLE]")
+			}
+			if deploymentArchived(instance, d) {
+				crashInfo += "  " + pal.warn("[ARCHIVED]")
+			}
+			_, _ = fmt.Fprintf(w, "%-20s  %s  %s%s\n", d, healthMark, status.Message, crashInfo)
+		}
+		return nil
+	}
+
+	// Show detailed status for specific deployment
+	deployment := args[0]
+	status, err := instance.GetDeploymentStatus(ctx, deployment)
+	if err != nil {
+		return err
+	}
+	if withStats {
+		if err := instance.CollectContainerStats(ctx, status); err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "Deployment: %s\n", status.Deployment)
+	_, _ = fmt.Fprintf(w, "Project:    %s\n", status.ProjectName)
+	healthy := pal.ok("true")
+	if !status.Healthy {
+		healthy = pal.bad("false")
+	}
+	if status.TotalCount > 0 {
+		healthy += fmt.Sprintf(" (%d/%d healthy", status.HealthyCount, status.TotalCount)
+		if unhealthy := status.UnhealthyServices(); len(unhealthy) > 0 {
+			healthy += "; unhealthy: " + strings.Join(unhealthy, ", ")
+		}
+		healthy += ")"
+	}
+	_, _ = fmt.Fprintf(w, "Healthy:    %s\n", healthy)
+	_, _ = fmt.Fprintf(w, "Status:     %s\n", status.Message)
+	sync := syncStatus(instance, deployment)
+	if sync != nil && sync.LastCommit != "" {
+		_, _ = fmt.Fprintf(w, "Commit:     %s\n", sync.CommitSummary())
+	}
+	if sync != nil {
+		if backoff := sync.BackoffSummary(time.Now()); backoff != "" {
+			_, _ = fmt.Fprintln(w, pal.warn("Sync:       "+backoff))
+		}
+	}
+	if tags := deploymentTags(instance, deployment); len(tags) > 0 {
+		_, _ = fmt.Fprintf(w, "Tags:       %s\n", strings.Join(tags, ", "))
+	}
+	for _, scale := range status.Scale {
+		_, _ = fmt.Fprintf(w, "Scale:      %s %d/%d running\n", scale.Service, scale.Running, scale.Replicas)
+	}
+	if crash := crashLoopState(instance, deployment); crash != nil {
+		_, _ = fmt.Fprintln(w, pal.bad(fmt.Sprintf("Crash loop: %d restarts in %s (since %s)",
+			crash.Restarts, crash.Window, crash.DetectedAt.Format(time.RFC3339))))
+	}
+	if update := availableUpdate(instance, deployment); update != "" {
+		_, _ = fmt.Fprintln(w, pal.warn(fmt.Sprintf("Update:     %s available (auto-deploy is off; deploy sync + deploy up to apply)", update)))
+	}
+	if deploymentArchived(instance, deployment) {
+		_, _ = fmt.Fprintln(w, pal.warn("Archived:   not polled (deploy unarchive to restore)"))
+	}
+
+	if len(status.Containers) > 0 {
+		_, _ = fmt.Fprintln(w, "\nContainers:")
+		for _, c := range status.Containers {
+			healthInfo := ""
+			switch c.Health {
+			case stevedore.HealthNone:
+			case stevedore.HealthHealthy:
+				healthInfo = " " + pal.ok(fmt.Sprintf("[%s]", c.Health))
+			case stevedore.HealthUnhealthy:
+				healthInfo = " " + pal.bad(fmt.Sprintf("[%s]", c.Health))
+			default:
+				healthInfo = " " + pal.warn(fmt.Sprintf("[%s]", c.Health))
+			}
+			statsInfo := ""
+			if withStats && c.State == stevedore.StateRunning {
+				statsInfo = fmt.Sprintf("  cpu %.2f%%  mem %s (%.2f%%)", c.CPUPercent, c.MemUsage, c.MemPercent)
+			}
+			restartInfo := ""
+			if c.RestartCount > 0 {
+				restartInfo = fmt.Sprintf("  restarts %d", c.RestartCount)
+			}
+			_, _ = fmt.Fprintf(w, "  %-20s  %-12s  %s%s%s%s\n", c.Service, c.ID, c.Status, healthInfo, restartInfo, statsInfo)
+			if c.ImageDigest != "" {
+				_, _ = fmt.Fprintf(w, "  %-20s  image %s\n", "", c.ImageDigest)
+			}
+			if c.ProbeError != "" {
+				_, _ = fmt.Fprintf(w, "  %-20s  %s\n", "", pal.bad("probe failed: "+c.ProbeError))
+			}
+		}
+	}
+
+	if withEnv {
+		// Only names are printed: the values are often secrets
+		stevedore.MaskContainerEnv(status)
+		_, _ = fmt.Fprintln(w, "\nEnvironment (values hidden):")
+		for _, c := range status.Containers {
+			_, _ = fmt.Fprintf(w, "  %s (%s):\n", c.Service, c.ID)
+			for _, v := range c.Env {
+				value := "set"
+				if !v.Set {
+					value = pal.warn("empty")
+				}
+				_, _ = fmt.Fprintf(w, "    %-30s  %s\n", v.Name, value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// crashLoopState returns the daemon-recorded crash-loop state of a deployment.
+// Status must work without a readable database, so errors are treated as "none".
+func crashLoopState(instance *stevedore.Instance, deployment string) *stevedore.CrashLoopState {
+	db, err := instance.OpenDB()
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = db.Close() }()
+	state, err := instance.GetCrashLoop(db, deployment)
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// availableUpdate returns the remote commit or tag the daemon found for a
+// deployment it does not auto-deploy. Like crashLoopState it treats an
+// unreadable database as "none".
+func availableUpdate(instance *stevedore.Instance, deployment string) string {
+	if status := syncStatus(instance, deployment); status != nil {
+		return status.UpdateAvailable
+	}
+	return ""
+}
+
+// syncStatus returns the recorded sync status of a deployment, or nil when
+// the database cannot be read.
+func syncStatus(instance *stevedore.Instance, deployment string) *stevedore.SyncStatus {
+	db, err := instance.OpenDB()
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = db.Close() }()
+	status, err := instance.GetSyncStatus(db, deployment)
+	if err != nil {
+		return nil
+	}
+	return status
+}
+
+// deploymentArchived reports whether a deployment is archived. Like
+// availableUpdate it treats an unreadable database as "no".
+func deploymentArchived(instance *stevedore.Instance, deployment string) bool {
+	db, err := instance.OpenDB()
+	if err != nil {
+		return false
+	}
+	defer func() { _ = db.Close() }()
+	config, err := instance.GetRepoConfig(db, deployment)
+	return err == nil && config.Archived
+}
+
+// deploymentTags returns the tags of a deployment. Like deploymentArchived it
+// treats an unreadable database as "none".
+func deploymentTags(instance *stevedore.Instance, deployment string) []string {
+	db, err := instance.OpenDB()
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = db.Close() }()
+	tags, _ := instance.GetDeploymentTags(db, deployment)
+	return tags
+}
+
+// maintenanceState returns the active maintenance window, if any. Like
+// crashLoopState it treats an unreadable database as "none".
+func maintenanceState(instance *stevedore.Instance) *stevedore.MaintenanceState {
+	db, err := instance.OpenDB()
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = db.Close() }()
+	state, err := instance.GetMaintenance(db)
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// maintenanceSummary describes a maintenance window for status and doctor.
+func maintenanceSummary(state *stevedore.MaintenanceState) string {
+	switch {
+	case state == nil:
+		return "off"
+	case state.Until.IsZero():
+		return fmt.Sprintf("on since %s until turned off", state.Since.Format("2006-01-02 15:04 MST"))
+	default:
+		return fmt.Sprintf("on since %s until %s",
+			state.Since.Format("2006-01-02 15:04 MST"), state.Until.Format("2006-01-02 15:04 MST"))
+	}
+}
+
+// runMaintenanceTo turns the maintenance window on or off, or shows it.
+func runMaintenanceTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	untilValue, args, err := consumeStringFlag(args, "--until", "")
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 || (untilValue != "" && (len(args) == 0 || args[0] != "on")) {
+		return errors.New("usage: maintenance [on [--until <time>] | off | status]")
+	}
+	command := "status"
+	if len(args) == 1 {
+		command = args[0]
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	switch command {
+	case "on":
+		var until time.Time
+		if untilValue != "" {
+			if until, err = parseMaintenanceUntil(untilValue, time.Now()); err != nil {
+				return err
+			}
+		}
+		if err := instance.SetMaintenance(db, until); err != nil {
+			return err
+		}
+	case "off":
+		if err := instance.ClearMaintenance(db); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(w, "Maintenance: off, automatic syncs and deploys resume with the next poll")
+		return nil
+	case "status":
+	default:
+		return fmt.Errorf("maintenance: unknown subcommand: %s", command)
+	}
+
+	state, err := instance.GetMaintenance(db)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "Maintenance: %s\n", maintenanceSummary(state))
+	if state != nil {
+		_, _ = fmt.Fprintln(w, "The daemon does not sync or deploy on its own; manual deploy commands still work.")
+	}
+	return nil
+}
+
+// parseMaintenanceUntil reads a --until value: a duration from now (2h30m),
+// an RFC 3339 timestamp, a local "2006-01-02 15:04", or a local "15:04"
+// (the next time the clock shows it).
+func parseMaintenanceUntil(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("--until duration must be positive: %s", value)
+		}
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if clock, err := time.Parse("15:04", value); err == nil {
+		t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --until %q: use a duration (2h), \"2006-01-02 15:04\", \"15:04\" or RFC 3339", value)
+}
+
+// runLogsTo prints the merged logs of a deployment without following.
+// Used for remote execution, where output is buffered until the command exits.
+func runLogsTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	if hasFlag(args, "--follow") || hasFlag(args, "-f") {
+		return errors.New("logs --follow requires an interactive terminal")
+	}
+	return runLogs(context.Background(), instance, args, w, false)
+}
+
+func runLogs(ctx context.Context, instance *stevedore.Instance, args []string, w io.Writer, color bool) error {
+	since, args, err := consumeStringFlag(args, "--since", "")
+	if err != nil {
+		return err
+	}
+	tail, args, err := consumeStringFlag(args, "--tail", "")
+	if err != nil {
+		return err
+	}
+
+	opts := stevedore.LogsOptions{Since: since, Tail: tail, Color: color}
+	var positional []string
+	for _, arg := range args {
+		switch arg {
+		case "--follow", "-f":
+			opts.Follow = true
+		case "--no-color":
+			opts.Color = false
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown flag: %s", arg)
+			}
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: logs <deployment>|daemon [--follow] [--since <duration|timestamp>] [--tail <n>] [--no-color]")
+	}
+
+	if positional[0] == "daemon" {
+		if _, err := os.Stat(instance.DeploymentDir("daemon")); errors.Is(err, os.ErrNotExist) {
+			return runDaemonLog(ctx, instance, opts, w)
+		}
+	}
+	return instance.StreamDeploymentLogs(ctx, positional[0], opts, w)
+}
+
+// runDaemonLog prints the daemon's own log, `logs daemon`. A deployment
+// named "daemon" takes precedence.
+func runDaemonLog(ctx context.Context, instance *stevedore.Instance, opts stevedore.LogsOptions, w io.Writer) error {
+	if opts.Since != "" {
+		return errors.New("logs daemon does not support --since")
+	}
+	if err := stevedore.ValidateLogsTail(opts.Tail); err != nil {
+		return err
+	}
+	tail := -1
+	if opts.Tail != "" && opts.Tail != "all" {
+		tail, _ = strconv.Atoi(opts.Tail)
+	}
+	return instance.StreamDaemonLog(ctx, stevedore.DaemonLogOptions{Follow: opts.Follow, Tail: tail}, w)
+}
+
+// stdoutIsTerminal is set by main() when stdout is a terminal. Commands the
+// daemon executes for /api/exec leave it false and print plain text.
+var stdoutIsTerminal bool
+
+// palette colors CLI output for terminals; the zero value prints plain text.
+type palette struct {
+	enabled bool
+}
+
+// newPalette removes --no-color from args and enables colors only when stdout
+// is a terminal and NO_COLOR is not set (https://no-color.org).
+func newPalette(args []string) (palette, []string) {
+	rest := make([]string, 0, len(args))
+	noColor := os.Getenv("NO_COLOR") != ""
+	for _, arg := range args {
+		if arg == "--no-color" {
+			noColor = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return palette{enabled: stdoutIsTerminal && !noColor}, rest
+}
+
+func (p palette) paint(code string, s string) string {
+	if !p.enabled {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+func (p palette) ok(s string) string   { return p.paint("32", s) }
+func (p palette) bad(s string) string  { return p.paint("31", s) }
+func (p palette) warn(s string) string { return p.paint("33", s) }
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// execRequest is a parsed `exec [-i] [-t] <deployment> <service> -- <cmd...>` invocation.
+type execRequest struct {
+	deployment string
+	service    string
+	command    []string
+	opts       stevedore.ContainerExecOptions
+}
+
+func parseExecArgs(args []string) (execRequest, error) {
+	const usage = "usage: exec [-it] <deployment> <service> -- <command> [args...]"
+	var req execRequest
+	var positional []string
+
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+		if arg == "--" {
+			req.command = args[idx+1:]
+			break
+		}
+		if len(positional) == 2 {
+			// Without "--", everything after the service is the command
+			req.command = args[idx:]
+			break
+		}
+		switch arg {
+		case "-i", "--interactive":
+			req.opts.Interactive = true
+		case "-t", "--tty":
+			req.opts.TTY = true
+		case "-it", "-ti":
+			req.opts.Interactive = true
+			req.opts.TTY = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return execRequest{}, fmt.Errorf("unknown flag: %s", arg)
+			}
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) != 2 || len(req.command) == 0 {
+		return execRequest{}, errors.New(usage)
+	}
+	req.deployment = positional[0]
+	req.service = positional[1]
+	return req, nil
+}
+
+// runExecTo runs a non-interactive command in a deployment container and
+// captures its output. Used for remote execution, where there is no terminal.
+func runExecTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	req, err := parseExecArgs(args)
+	if err != nil {
+		return err
+	}
+	if req.opts.Interactive || req.opts.TTY {
+		return errors.New("exec -i/-t requires an interactive terminal")
+	}
+
+	req.opts.Stdout = w
+	req.opts.Stderr = w
+	return instance.ExecInContainer(context.Background(), req.deployment, req.service, req.command, req.opts)
+}
+
+// runExecAttached runs a command in a deployment container with this process's
+// stdin/stdout/stderr attached and returns the exit code to propagate.
+func runExecAttached(instance *stevedore.Instance, args []string) int {
+	req, err := parseExecArgs(args)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return 2
+	}
+
+	req.opts.Stdin = os.Stdin
+	req.opts.Stdout = os.Stdout
+	req.opts.Stderr = os.Stderr
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = instance.ExecInContainer(ctx, req.deployment, req.service, req.command, req.opts)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func runDBTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("db: missing subcommand (status|rekey)")
+	}
+
+	switch args[0] {
+	case "status":
+		if len(args) != 1 {
+			return errors.New("usage: db status")
+		}
+		return runDBStatusTo(instance, w)
+
+	case "rekey":
+		if len(args) != 2 || args[1] != "--stdin" {
+			return errors.New("usage: db rekey --stdin   # new key is read from stdin")
+		}
+		return runDBRekeyTo(instance, os.Stdin, w)
+
+	default:
+		return fmt.Errorf("unknown db subcommand: %s", args[0])
+	}
+}
+
+func runDBRekeyTo(instance *stevedore.Instance, stdin io.Reader, w io.Writer) error {
+	// The daemon keeps the database open with the old key; rekeying under it
+	// would leave it unable to read or write.
+	if daemonReachable() {
+		return errors.New("daemon is running; stop it before rotating the database key (see docs/SECRETS.md)")
+	}
+
+	b, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+	newKey := strings.TrimSpace(string(b))
+
+	result, err := instance.RekeyDB(newKey)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(w, "Database re-encrypted with the new key and verified.")
+	if result.KeyFile != "" {
+		_, _ = fmt.Fprintf(w, "Updated key file: %s\n", result.KeyFile)
+	} else {
+		_, _ = fmt.Fprintln(w, "The key was read from STEVEDORE_DB_KEY: update it wherever it is configured (e.g. container.env) before restarting the daemon.")
+	}
+	return nil
+}
+
+// daemonReachable reports whether a daemon answers the unauthenticated health probe.
+func daemonReachable() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, err := newDaemonClient("")
+	if err != nil {
+		return false
+	}
+	_, err = client.Health(ctx)
+	return err == nil
+}
+
+// backupPassphrase reads the archive passphrase from --passphrase-file or
+// STEVEDORE_BACKUP_PASSPHRASE. An empty result means no encryption.
+func backupPassphrase(args []string) (string, []string, error) {
+	passphraseFile, args, err := consumeStringFlag(args, "--passphrase-file", "")
+	if err != nil {
+		return "", nil, err
+	}
+	if passphraseFile == "" {
+		return os.Getenv("STEVEDORE_BACKUP_PASSPHRASE"), args, nil
+	}
+	b, err := os.ReadFile(passphraseFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("read passphrase file: %w", err)
+	}
+	passphrase := strings.TrimRight(string(b), "\r\n")
+	if passphrase == "" {
+		return "", nil, fmt.Errorf("passphrase file is empty: %s", passphraseFile)
+	}
+	return passphrase, args, nil
+}
+
+// runBackupTo archives the state directory to a file, or to stdio when the
+// path is "-" and stdio is available (nil when output is buffered).
+func runBackupTo(instance *stevedore.Instance, args []string, stdio io.Writer, w io.Writer) error {
+	const usage = "usage: backup <out.tar.gz|-> [--include-checkouts] [--passphrase-file <path>]"
+	passphrase, args, err := backupPassphrase(args)
+	if err != nil {
+		return err
+	}
+	opts := stevedore.BackupOptions{Passphrase: passphrase}
+	var positional []string
+	for _, arg := range args {
+		switch {
+		case arg == "--include-checkouts":
+			opts.IncludeCheckouts = true
+		case arg != "-" && strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown flag: %s", arg)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 1 {
+		return errors.New(usage)
+	}
+
+	out := stdio
+	var file *os.File
+	target := positional[0]
+	if target == "-" {
+		if stdio == nil {
+			return errors.New("backup to stdout requires running the CLI directly")
+		}
+	} else {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			return err
+		}
+		// The archive contains private keys and the database key
+		file, err = os.OpenFile(abs, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+		out = file
+		opts.SkipPath = abs
+	}
+
+	summary, err := instance.Backup(out, opts)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+
+	encrypted := "unencrypted"
+	if summary.Encrypted {
+		encrypted = "encrypted"
+	}
+	_, _ = fmt.Fprintf(w, "Backed up %d files (%s, %s) from %s to %s\n",
+		summary.Files, stevedore.FormatBytes(uint64(summary.Bytes)), encrypted, instance.Root, target)
+	if !summary.Encrypted {
+		_, _ = fmt.Fprintln(w, "The archive contains db.key and SSH private keys: store it securely.")
+	}
+	return nil
+}
+
+// runRestoreTo rehydrates the state directory from a file, or from stdio
+// when the path is "-" and stdio is available (nil when input is not attached).
+func runRestoreTo(instance *stevedore.Instance, args []string, stdio io.Reader, w io.Writer) error {
+	const usage = "usage: restore <in.tar.gz|-> [--force] [--passphrase-file <path>]"
+	passphrase, args, err := backupPassphrase(args)
+	if err != nil {
+		return err
+	}
+	opts := stevedore.RestoreOptions{Passphrase: passphrase}
+	var positional []string
+	for _, arg := range args {
+		switch {
+		case arg == "--force":
+			opts.Force = true
+		case arg != "-" && strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown flag: %s", arg)
+		default:
+			positional = append(positional, arg)
 		}
-		deployment := args[1]
+	}
+	if len(positional) != 1 {
+		return errors.New(usage)
+	}
 
-		_, _ = fmt.Fprintf(w, "Stopping %s...\n", deployment)
-		db, err := instance.OpenDB()
-		if err != nil {
-			return err
-		}
-		defer func() { _ = db.Close() }()
-		if err := instance.SetDeploymentEnabled(db, deployment, false); err != nil {
-			return err
+	if daemonReachable() {
+		return errors.New("daemon is running; stop it before restoring state")
+	}
+
+	var in io.Reader
+	source := positional[0]
+	if source == "-" {
+		if stdio == nil {
+			return errors.New("restore from stdin requires running the CLI directly")
 		}
-		if err := instance.Stop(ctx, deployment, stevedore.ComposeConfig{}); err != nil {
-			if reenableErr := instance.SetDeploymentEnabled(db, deployment, true); reenableErr != nil {
-				return fmt.Errorf("stop failed: %w (failed to re-enable deployment: %v)", err, reenableErr)
-			}
+		in = stdio
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
 			return err
 		}
-		_, _ = fmt.Fprintf(w, "Stopped: %s\n", deployment)
-		return nil
+		defer func() { _ = f.Close() }()
+		in = f
+	}
 
-	default:
-		return fmt.Errorf("deploy: unknown subcommand: %s", args[0])
+	summary, err := instance.Restore(in, opts)
+	if err != nil {
+		return err
 	}
+	_, _ = fmt.Fprintf(w, "Restored %d files (%s) into %s\n", summary.Files, stevedore.FormatBytes(uint64(summary.Bytes)), instance.Root)
+	_, _ = fmt.Fprintln(w, "Run `stevedore deploy sync <deployment>` to re-clone checkouts that were not archived.")
+	return nil
 }
 
-func runStatusTo(instance *stevedore.Instance, args []string, w io.Writer) error {
-	ctx := context.Background()
+func runDBStatusTo(instance *stevedore.Instance, w io.Writer) error {
+	status, err := instance.GetDBStatus()
+	if err != nil {
+		return err
+	}
 
-	if len(args) == 0 {
-		// List all deployments with status
-		deployments, err := instance.ListDeployments()
-		if err != nil {
-			return err
+	_, _ = fmt.Fprintf(w, "Database:       %s\n", status.Path)
+	if status.UpToDate() {
+		_, _ = fmt.Fprintf(w, "Schema version: %d (latest) ✓\n", status.SchemaVersion)
+	} else {
+		_, _ = fmt.Fprintf(w, "Schema version: %d (latest: %d) ✗\n", status.SchemaVersion, status.LatestVersion)
+	}
+
+	_, _ = fmt.Fprintln(w, "\nApplied migrations:")
+	if len(status.Applied) == 0 {
+		_, _ = fmt.Fprintln(w, "  (none)")
+	}
+	for _, m := range status.Applied {
+		_, _ = fmt.Fprintf(w, "  v%-3d  %s  %s\n", m.Version, m.AppliedAt.UTC().Format(time.RFC3339), m.Description)
+	}
+	if len(status.Pending) > 0 {
+		_, _ = fmt.Fprintln(w, "\nPending migrations:")
+		for _, m := range status.Pending {
+			_, _ = fmt.Fprintf(w, "  v%-3d  %s\n", m.Version, m.Description)
 		}
-		if len(deployments) == 0 {
-			_, _ = fmt.Fprintln(w, "No deployments found")
-			return nil
+	}
+
+	if status.IntegrityOK() {
+		_, _ = fmt.Fprintln(w, "\nIntegrity:      ok ✓")
+	} else {
+		_, _ = fmt.Fprintln(w, "\nIntegrity:      FAILED ✗")
+		for _, line := range status.Integrity {
+			_, _ = fmt.Fprintf(w, "  %s\n", line)
 		}
+	}
 
-		for _, d := range deployments {
-			status, err := instance.GetDeploymentStatus(ctx, d)
-			if err != nil {
-				_, _ = fmt.Fprintf(w, "%-20s  ERROR: %v\n", d, err)
-				continue
-			}
-			healthMark := "✓"
-			if !status.Healthy {
-				healthMark = "✗"
-			}
-			_, _ = fmt.Fprintf(w, "%-20s  %s  %s\n", d, healthMark, status.Message)
+	switch {
+	case !status.IntegrityOK():
+		return errors.New("database integrity check failed")
+	case !status.UpToDate():
+		return fmt.Errorf("database schema is behind: %d pending migration(s)", len(status.Pending))
+	}
+	return nil
+}
+
+// checkAllEntry is one row of `check --all`.
+type checkAllEntry struct {
+	Deployment    string `json:"deployment"`
+	Ref           string `json:"ref,omitempty"`
+	CurrentCommit string `json:"currentCommit,omitempty"`
+	RemoteCommit  string `json:"remoteCommit,omitempty"`
+	RemoteTag     string `json:"remoteTag,omitempty"`
+	HasChanges    bool   `json:"hasChanges"`
+	Error         string `json:"error,omitempty"`
+}
+
+// checkAll runs the remote check for every deployment and returns one entry
+// per deployment along with the number of deployments that failed.
+func checkAll(instance *stevedore.Instance) ([]checkAllEntry, int, error) {
+	deployments, err := instance.ListDeployments()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx := context.Background()
+	entries := make([]checkAllEntry, 0, len(deployments))
+	failed := 0
+	for _, deployment := range deployments {
+		entry := checkAllEntry{Deployment: deployment}
+		result, err := instance.GitCheckRemote(ctx, deployment)
+		if err != nil {
+			entry.Error = err.Error()
+			failed++
+		} else {
+			entry.Ref = result.Ref()
+			entry.CurrentCommit = result.CurrentCommit
+			entry.RemoteCommit = result.RemoteCommit
+			entry.RemoteTag = result.RemoteTag
+			entry.HasChanges = result.HasChanges
 		}
-		return nil
+		entries = append(entries, entry)
 	}
+	return entries, failed, nil
+}
 
-	// Show detailed status for specific deployment
-	deployment := args[0]
-	status, err := instance.GetDeploymentStatus(ctx, deployment)
+// runCheckAllTo checks every deployment, continuing past failures, and
+// returns an error at the end if any deployment could not be checked.
+func runCheckAllTo(instance *stevedore.Instance, jsonOutput bool, pal palette, w io.Writer) error {
+	entries, failed, err := checkAll(instance)
 	if err != nil {
 		return err
 	}
 
-	_, _ = fmt.Fprintf(w, "Deployment: %s\n", status.Deployment)
-	_, _ = fmt.Fprintf(w, "Project:    %s\n", status.ProjectName)
-	_, _ = fmt.Fprintf(w, "Healthy:    %v\n", status.Healthy)
-	_, _ = fmt.Fprintf(w, "Status:     %s\n", status.Message)
-
-	if len(status.Containers) > 0 {
-		_, _ = fmt.Fprintln(w, "\nContainers:")
-		for _, c := range status.Containers {
-			healthInfo := ""
-			if c.Health != stevedore.HealthNone {
-				healthInfo = fmt.Sprintf(" [%s]", c.Health)
+	if jsonOutput {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(w, string(data))
+	} else if len(entries) == 0 {
+		_, _ = fmt.Fprintln(w, "No deployments found")
+	} else {
+		_, _ = fmt.Fprintf(w, "%-20s  %-15s  %-12s  %-12s  %s\n", "DEPLOYMENT", "REF", "CURRENT", "REMOTE", "STATUS")
+		for _, e := range entries {
+			status := pal.ok("Up to date")
+			switch {
+			case e.Error != "":
+				status = pal.bad("ERROR: " + e.Error)
+			case e.HasChanges && e.RemoteTag != "":
+				status = pal.warn("Newer tag available: " + e.RemoteTag)
+			case e.HasChanges:
+				status = pal.warn("Updates available")
 			}
-			_, _ = fmt.Fprintf(w, "  %-20s  %-12s  %s%s\n", c.Service, c.ID, c.Status, healthInfo)
+			_, _ = fmt.Fprintf(w, "%-20s  %-15s  %-12s  %-12s  %s\n",
+				e.Deployment, e.Ref, shortCommit(e.CurrentCommit), shortCommit(e.RemoteCommit), status)
 		}
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deployments could not be checked", failed, len(entries))
+	}
 	return nil
 }
 
 func runCheckTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	pal, args := newPalette(args)
+	if hasFlag(args, "--all") {
+		jsonOutput := false
+		for _, arg := range args {
+			switch arg {
+			case "--all":
+			case "--json":
+				jsonOutput = true
+			default:
+				return errors.New("usage: check --all [--json]")
+			}
+		}
+		return runCheckAllTo(instance, jsonOutput, pal, w)
+	}
+
 	if len(args) != 1 {
-		return errors.New("usage: check <deployment>")
+		return errors.New("usage: check <deployment> | check --all [--json]")
 	}
 
 	ctx := context.Background()
@@ -516,19 +3401,55 @@ func runCheckTo(instance *stevedore.Instance, args []string, w io.Writer) error
 	}
 
 	_, _ = fmt.Fprintf(w, "Deployment: %s\n", deployment)
-	_, _ = fmt.Fprintf(w, "Branch:     %s\n", result.Branch)
-	_, _ = fmt.Fprintf(w, "Current:    %s\n", shortCommit(result.CurrentCommit))
-	_, _ = fmt.Fprintf(w, "Remote:     %s\n", shortCommit(result.RemoteCommit))
-	if result.HasChanges {
-		_, _ = fmt.Fprintln(w, "Status:     Updates available")
+	if result.TagPattern != "" {
+		_, _ = fmt.Fprintf(w, "Tag:        %s\n", result.TagPattern)
+		_, _ = fmt.Fprintf(w, "Current:    %s\n", withTag(shortCommit(result.CurrentCommit), result.CurrentTag))
+		_, _ = fmt.Fprintf(w, "Remote:     %s\n", withTag(shortCommit(result.RemoteCommit), result.RemoteTag))
 	} else {
-		_, _ = fmt.Fprintln(w, "Status:     Up to date")
+		_, _ = fmt.Fprintf(w, "Branch:     %s\n", result.Branch)
+		_, _ = fmt.Fprintf(w, "Current:    %s\n", shortCommit(result.CurrentCommit))
+		_, _ = fmt.Fprintf(w, "Remote:     %s\n", shortCommit(result.RemoteCommit))
+	}
+	if result.HasChanges && result.RemoteTag != "" {
+		_, _ = fmt.Fprintf(w, "Status:     %s\n", pal.warn("Newer tag available: "+result.RemoteTag))
+	} else if result.HasChanges && result.CommitsBehind > 0 {
+		_, _ = fmt.Fprintf(w, "Status:     %s\n", pal.warn(fmt.Sprintf("Updates available: %d commit(s) behind", result.CommitsBehind)))
+	} else if result.HasChanges {
+		_, _ = fmt.Fprintf(w, "Status:     %s\n", pal.warn("Updates available"))
+	} else {
+		_, _ = fmt.Fprintf(w, "Status:     %s\n", pal.ok("Up to date"))
+	}
+	if result.CommitsAhead > 0 {
+		_, _ = fmt.Fprintf(w, "Ahead:      %s\n", pal.warn(fmt.Sprintf("%d local commit(s) not on the remote branch (force push?)", result.CommitsAhead)))
+	}
+	if len(result.PendingCommits) > 0 {
+		_, _ = fmt.Fprintln(w, "Incoming:")
+		for _, commit := range result.PendingCommits {
+			_, _ = fmt.Fprintf(w, "  %s\n", commit)
+		}
+		if more := result.CommitsBehind - len(result.PendingCommits); more > 0 {
+			_, _ = fmt.Fprintf(w, "  ... and %d more\n", more)
+		}
 	}
 
 	return nil
 }
 
-func runSelfUpdateTo(instance *stevedore.Instance, w io.Writer) error {
+func runSelfUpdateTo(instance *stevedore.Instance, args []string, w io.Writer) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "check-env":
+			return runSelfUpdateCheckEnvTo(instance, w)
+		case "history":
+			if len(args) != 1 {
+				return errors.New("usage: self-update history")
+			}
+			return runSelfUpdateHistoryTo(instance, w)
+		default:
+			return fmt.Errorf("self-update: unknown subcommand: %s", args[0])
+		}
+	}
+
 	ctx := context.Background()
 
 	_, _ = fmt.Fprintln(w, "Starting self-update...")
@@ -547,22 +3468,196 @@ func runSelfUpdateTo(instance *stevedore.Instance, w io.Writer) error {
 	return nil
 }
 
+// runSelfUpdateHistoryTo lists the backup images self-update kept, newest
+// first, with the commit each was built from when its labels record it.
+func runSelfUpdateHistoryTo(instance *stevedore.Instance, w io.Writer) error {
+	su := stevedore.NewSelfUpdate(instance, stevedore.SelfUpdateConfig{})
+	images, err := su.BackupImages(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		_, _ = fmt.Fprintln(w, "No backup images found")
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(w, "%-36s  %-20s  %-12s  %s\n", "IMAGE", "BACKED UP", "COMMIT", "BUILT")
+	for _, image := range images {
+		commit := "(unknown)"
+		if image.Commit != "" {
+			commit = shortCommit(image.Commit)
+		}
+		builtAt := image.BuiltAt
+		if builtAt == "" {
+			builtAt = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%-36s  %-20s  %-12s  %s\n", image.Ref, image.BackedUpAt.Format("2006-01-02 15:04:05"), commit, builtAt)
+	}
+	return nil
+}
+
+// runSelfUpdateCheckEnvTo prints the container env the update worker would
+// start the new stevedore container with, and validates it.
+func runSelfUpdateCheckEnvTo(instance *stevedore.Instance, w io.Writer) error {
+	su := stevedore.NewSelfUpdate(instance, stevedore.SelfUpdateConfig{})
+	env, image, checkErr := su.CheckContainerEnv(context.Background())
+	if env == nil {
+		return checkErr
+	}
+
+	mode := "update worker"
+	if su.IsManagedBySystemd() {
+		mode = "systemd restart"
+	}
+	if image == "" {
+		image = "(unknown)"
+	}
+
+	_, _ = fmt.Fprintf(w, "Env file: %s\n", env.Path)
+	_, _ = fmt.Fprintf(w, "Image:    %s\n", image)
+	_, _ = fmt.Fprintf(w, "Restart:  %s\n", mode)
+	_, _ = fmt.Fprintf(w, "Entries:  %d\n", len(env.Entries))
+	for _, entry := range env.Entries {
+		value := entry.Value
+		if stevedore.IsSecretEnvKey(entry.Key) && value != "" {
+			value = "********"
+		}
+		_, _ = fmt.Fprintf(w, "  %s=%s\n", entry.Key, value)
+	}
+
+	if checkErr != nil {
+		return checkErr
+	}
+	_, _ = fmt.Fprintln(w, "Container env OK")
+	return nil
+}
+
+// runtimeSummary describes the container CLI stevedore runs, for doctor.
+func runtimeSummary() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	runtime, err := stevedore.DetectContainerRuntime(ctx)
+	if err != nil {
+		return "not found (" + err.Error() + ")"
+	}
+	summary := runtime.Name + " " + runtime.Version
+	if runtime.Binary != stevedore.DefaultDockerBinary {
+		summary += " (STEVEDORE_DOCKER_BIN=" + runtime.Binary + ")"
+	}
+	return summary
+}
+
+// composeSummary describes the Compose CLI deploys use, for doctor.
+func composeSummary() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cli, err := stevedore.DetectComposeCLI(ctx)
+	if err != nil {
+		return "not found (" + err.Error() + ")"
+	}
+	summary := cli.String() + " " + cli.Version
+	if cli.Legacy {
+		summary += " (legacy v1)"
+	}
+	return summary
+}
+
+// printServiceTimings lists the containers of a deploy in the order they
+// started, with times since `docker compose up` began.
+func printServiceTimings(w io.Writer, timings []stevedore.ServiceTiming) {
+	if len(timings) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintln(w, "Start order:")
+	for n, t := range timings {
+		if t.Unchanged {
+			_, _ = fmt.Fprintf(w, "  -  %s: unchanged\n", t.Container)
+			continue
+		}
+		line := fmt.Sprintf("started +%s", t.Started.Round(100*time.Millisecond))
+		if t.Healthy > 0 {
+			line += fmt.Sprintf(", healthy +%s", t.Healthy.Round(100*time.Millisecond))
+		}
+		_, _ = fmt.Fprintf(w, "  %d. %s: %s\n", n+1, t.Container, line)
+	}
+}
+
+// printHookResults prints the outcome and output of lifecycle hooks.
+func printHookResults(w io.Writer, pal palette, hooks []stevedore.HookResult) {
+	for _, h := range hooks {
+		outcome := pal.ok("ok")
+		if h.Error != "" {
+			outcome = pal.bad("FAILED: " + h.Error)
+		}
+		_, _ = fmt.Fprintf(w, "Hook %s: %s (%s)\n", h.Name, outcome, h.Duration.Round(time.Millisecond))
+		for _, line := range strings.Split(strings.TrimRight(h.Output, "\n"), "\n") {
+			if line != "" {
+				_, _ = fmt.Fprintf(w, "  %s\n", line)
+			}
+		}
+	}
+}
+
+// profileParameterNames returns the profile of a deployment and the names of
+// that profile's parameters, to tell them apart from global ones.
+func profileParameterNames(instance *stevedore.Instance, deployment string) (string, map[string]bool, error) {
+	profile, err := instance.DeploymentProfile(deployment)
+	if err != nil || profile == "" {
+		return "", nil, err
+	}
+	names, err := instance.ListProfileParameters(profile)
+	if err != nil {
+		return "", nil, err
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return profile, set, nil
+}
+
 func runParamTo(instance *stevedore.Instance, args []string, w io.Writer) error {
 	if len(args) == 0 {
-		return errors.New("param: missing subcommand (set|get|list)")
+		return errors.New("param: missing subcommand (set|get|list|history|rollback)")
+	}
+
+	// --global addresses the parameters every deployment inherits
+	global := hasFlag(args[1:], "--global")
+	includeGlobal := hasFlag(args[1:], "--include-global")
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "--global" && arg != "--include-global" {
+			rest = append(rest, arg)
+		}
+	}
+	// --profile addresses the parameters of the deployments with the profile
+	profile, args, err := consumeStringFlag(rest, "--profile", "")
+	if err != nil {
+		return err
+	}
+	if profile != "" && (global || includeGlobal) {
+		return errors.New("param: --profile and --global are mutually exclusive")
+	}
+	if len(args) == 0 {
+		return errors.New("param: missing subcommand (set|get|list|history|rollback)")
 	}
+	scoped := global || profile != ""
 
 	switch args[0] {
 	case "set":
-		if len(args) < 3 {
-			return errors.New("usage: param set <deployment> <name> <value> | param set <deployment> <name> --stdin")
+		// Without --global or --profile the first argument is the deployment
+		scope := 1
+		if scoped {
+			scope = 0
 		}
-		deployment := args[1]
-		name := args[2]
+		if len(args) < 2+scope {
+			return errors.New("usage: param set <deployment> <name> <value> | param set <deployment> <name> --stdin | param set --global | --profile <profile> <name> <value>")
+		}
+		name := args[1+scope]
 
 		var value []byte
-		if len(args) >= 4 && args[3] != "--stdin" {
-			value = []byte(strings.Join(args[3:], " "))
+		if len(args) >= 3+scope && args[2+scope] != "--stdin" {
+			value = []byte(strings.Join(args[2+scope:], " "))
 		} else {
 			b, err := io.ReadAll(os.Stdin)
 			if err != nil {
@@ -571,16 +3666,36 @@ func runParamTo(instance *stevedore.Instance, args []string, w io.Writer) error
 			value = []byte(strings.TrimRight(string(b), "\n"))
 		}
 
-		if err := instance.SetParameter(deployment, name, value); err != nil {
+		if warning := stevedore.ParameterNameWarning(name); warning != "" {
+			_, _ = fmt.Fprintf(w, "Warning: %s\n", warning)
+		}
+		if note := stevedore.ParameterReferenceWarning(name, string(value)); note != "" {
+			_, _ = fmt.Fprintf(w, "Note: %s\n", note)
+		}
+		if global {
+			return instance.SetGlobalParameter(name, value)
+		}
+		if profile != "" {
+			return instance.SetProfileParameter(profile, name, value)
+		}
+		if err := instance.SetParameter(args[1], name, value); err != nil {
 			return err
 		}
 		return nil
 
 	case "get":
-		if len(args) != 3 {
-			return errors.New("usage: param get <deployment> <name>")
+		var value []byte
+		var err error
+		switch {
+		case global && len(args) == 2:
+			value, err = instance.GetGlobalParameter(args[1])
+		case profile != "" && len(args) == 2:
+			value, err = instance.GetProfileParameter(profile, args[1])
+		case !scoped && len(args) == 3:
+			value, err = instance.GetParameter(args[1], args[2])
+		default:
+			return errors.New("usage: param get <deployment> <name> | param get --global | --profile <profile> <name>")
 		}
-		value, err := instance.GetParameter(args[1], args[2])
 		if err != nil {
 			return err
 		}
@@ -588,8 +3703,26 @@ func runParamTo(instance *stevedore.Instance, args []string, w io.Writer) error
 		return nil
 
 	case "list":
+		if scoped {
+			if len(args) != 1 {
+				return errors.New("usage: param list --global | --profile <profile>")
+			}
+			var names []string
+			if global {
+				names, err = instance.ListGlobalParameters()
+			} else {
+				names, err = instance.ListProfileParameters(profile)
+			}
+			if err != nil {
+				return err
+			}
+			for _, n := range names {
+				_, _ = fmt.Fprintln(w, n)
+			}
+			return nil
+		}
 		if len(args) != 2 {
-			return errors.New("usage: param list <deployment>")
+			return errors.New("usage: param list <deployment> [--include-global]")
 		}
 		names, err := instance.ListParameters(args[1])
 		if err != nil {
@@ -598,6 +3731,80 @@ func runParamTo(instance *stevedore.Instance, args []string, w io.Writer) error
 		for _, n := range names {
 			_, _ = fmt.Fprintln(w, n)
 		}
+		if includeGlobal {
+			effective, err := instance.ListEffectiveParameters(args[1])
+			if err != nil {
+				return err
+			}
+			own := make(map[string]bool, len(names))
+			for _, n := range names {
+				own[n] = true
+			}
+			deploymentProfile, fromProfile, err := profileParameterNames(instance, args[1])
+			if err != nil {
+				return err
+			}
+			for _, n := range effective {
+				switch {
+				case own[n]:
+				case fromProfile[n]:
+					_, _ = fmt.Fprintf(w, "%s (profile %s)\n", n, deploymentProfile)
+				default:
+					_, _ = fmt.Fprintf(w, "%s (global)\n", n)
+				}
+			}
+		}
+		return nil
+
+	case "history":
+		var versions []stevedore.ParameterVersion
+		var err error
+		switch {
+		case global && len(args) == 2:
+			versions, err = instance.GlobalParameterHistory(args[1])
+		case profile != "" && len(args) == 2:
+			versions, err = instance.ProfileParameterHistory(profile, args[1])
+		case !scoped && len(args) == 3:
+			versions, err = instance.ParameterHistory(args[1], args[2])
+		default:
+			return errors.New("usage: param history <deployment> <name> | param history --global | --profile <profile> <name>")
+		}
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			_, _ = fmt.Fprintln(w, "No previous values")
+			return nil
+		}
+		// Values are secrets: show a fingerprint to tell them apart
+		_, _ = fmt.Fprintf(w, "%-4s  %-25s  %-25s  %6s  %s\n", "#", "SET AT", "REPLACED AT", "BYTES", "FINGERPRINT")
+		for idx, v := range versions {
+			_, _ = fmt.Fprintf(w, "%-4d  %-25s  %-25s  %6d  %s\n", idx+1,
+				v.SetAt.Format(time.RFC3339), v.ReplacedAt.Format(time.RFC3339), len(v.Value), v.Fingerprint())
+		}
+		return nil
+
+	case "rollback":
+		var restored *stevedore.ParameterVersion
+		var err error
+		var name string
+		switch {
+		case global && len(args) == 2:
+			name = args[1]
+			restored, err = instance.RollbackGlobalParameter(name)
+		case profile != "" && len(args) == 2:
+			name = args[1]
+			restored, err = instance.RollbackProfileParameter(profile, name)
+		case !scoped && len(args) == 3:
+			name = args[2]
+			restored, err = instance.RollbackParameter(args[1], name)
+		default:
+			return errors.New("usage: param rollback <deployment> <name> | param rollback --global | --profile <profile> <name>")
+		}
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "Restored %s to the value set at %s (%s)\n", name, restored.SetAt.Format(time.RFC3339), restored.Fingerprint())
 		return nil
 
 	default:
@@ -743,7 +3950,7 @@ func runTokenTo(instance *stevedore.Instance, args []string, w io.Writer) error
 			return errors.New("usage: token list")
 		}
 
-		tokens, err := instance.ListQueryTokens()
+		tokens, err := instance.QueryTokenInfos()
 		if err != nil {
 			return err
 		}
@@ -753,8 +3960,19 @@ func runTokenTo(instance *stevedore.Instance, args []string, w io.Writer) error
 			return nil
 		}
 
-		for deployment := range tokens {
-			_, _ = fmt.Fprintln(w, deployment)
+		const timeFormat = "2006-01-02 15:04"
+		_, _ = fmt.Fprintf(w, "%-20s  %-6s  %-16s  %-7s  %s\n", "DEPLOYMENT", "SCOPE", "CREATED", "EXPIRES", "LAST USED")
+		for _, token := range tokens {
+			expires := "never"
+			if token.ExpiresAt != nil {
+				expires = token.ExpiresAt.Format(timeFormat)
+			}
+			lastUsed := "never"
+			if token.LastUsedAt != nil {
+				lastUsed = token.LastUsedAt.Format(timeFormat)
+			}
+			_, _ = fmt.Fprintf(w, "%-20s  %-6s  %-16s  %-7s  %s\n",
+				token.Deployment, token.Scope, token.CreatedAt.Format(timeFormat), expires, lastUsed)
 		}
 		return nil
 
@@ -875,6 +4093,24 @@ func consumeStringFlag(args []string, flagName string, defaultValue string) (str
 	return value, remaining, nil
 }
 
+// hasFlag reports whether flagName appears in args.
+func hasFlag(args []string, flagName string) bool {
+	for _, arg := range args {
+		if arg == flagName {
+			return true
+		}
+	}
+	return false
+}
+
+// withTag appends a tag name in parentheses when one is known.
+func withTag(commit string, tag string) string {
+	if tag == "" {
+		return commit
+	}
+	return fmt.Sprintf("%s (%s)", commit, tag)
+}
+
 func getEnvDefault(name string, defaultValue string) string {
 	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
 		return v
@@ -908,6 +4144,19 @@ func getEnvFloat(name string, defaultValue float64) float64 {
 	return f
 }
 
+func getEnvBool(name string, defaultValue bool) bool {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("WARNING: invalid %s=%q, using %t", name, v, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
 func getEnvInt(name string, defaultValue int) int {
 	v := strings.TrimSpace(os.Getenv(name))
 	if v == "" {
@@ -923,28 +4172,67 @@ func getEnvInt(name string, defaultValue int) int {
 
 func printUsageTo(w io.Writer) {
 	_, _ = fmt.Fprintln(w, "Usage:")
-	_, _ = fmt.Fprintln(w, "  stevedore -d              # run daemon")
-	_, _ = fmt.Fprintln(w, "  stevedore doctor")
+	_, _ = fmt.Fprintln(w, "  stevedore -d [--listen <addr>|none] [--tls-cert <file> --tls-key <file>] [--socket <path>]  # run daemon (API on 127.0.0.1:42107 by default)")
+	_, _ = fmt.Fprintln(w, "  stevedore doctor [--fix]        # --fix repairs layout, admin key, stopped daemon")
+	_, _ = fmt.Fprintln(w, "  stevedore ready                 # exit 0 once the daemon answers /readyz as ready")
 	_, _ = fmt.Fprintln(w, "  stevedore version")
-	_, _ = fmt.Fprintln(w, "  stevedore status [<deployment>]")
+	_, _ = fmt.Fprintln(w, "  stevedore backup <out.tar.gz|-> [--include-checkouts] [--passphrase-file <path>]")
+	_, _ = fmt.Fprintln(w, "  stevedore restore <in.tar.gz|-> [--force] [--passphrase-file <path>]")
+	_, _ = fmt.Fprintln(w, "  stevedore db status            # schema version, migrations, integrity")
+	_, _ = fmt.Fprintln(w, "  stevedore db rekey --stdin     # re-encrypt the database with a new key (daemon stopped)")
+	_, _ = fmt.Fprintln(w, "  stevedore status [<deployment> | --tag <tag>] [--stats] [--env] [--watch [--interval 2s]]")
 	_, _ = fmt.Fprintln(w, "  stevedore check <deployment>   # check for git updates")
+	_, _ = fmt.Fprintln(w, "  stevedore check --all [--json] # check every deployment")
 	_, _ = fmt.Fprintln(w, "  stevedore self-update          # update stevedore itself")
-	_, _ = fmt.Fprintln(w, "  stevedore repo add <deployment> <git-url> [--branch <branch>]")
+	_, _ = fmt.Fprintln(w, "  stevedore self-update check-env  # show and validate the env the update would use")
+	_, _ = fmt.Fprintln(w, "  stevedore self-update history    # list backup images with the commit each was built from")
+	_, _ = fmt.Fprintln(w, "  stevedore repo add <deployment> <git-url> [--branch <branch> | --tag <glob>] [--subdir <path>] [--depth <n> | --full] [--key-type ed25519|rsa] [--profile <name>] [--no-verify]")
+	_, _ = fmt.Fprintln(w, "  stevedore repo add --from <manifest.yaml|-> [--update]  # add (or update) many deployments")
 	_, _ = fmt.Fprintln(w, "  stevedore repo key <deployment>")
-	_, _ = fmt.Fprintln(w, "  stevedore repo list")
-	_, _ = fmt.Fprintln(w, "  stevedore deploy sync <deployment> [--no-clean]")
-	_, _ = fmt.Fprintln(w, "  stevedore deploy up <deployment>")
-	_, _ = fmt.Fprintln(w, "  stevedore deploy down <deployment>")
+	_, _ = fmt.Fprintln(w, "  stevedore repo keys [--json]    # public deploy keys of all deployments")
+	_, _ = fmt.Fprintln(w, "  stevedore repo verify <deployment>  # check the deploy key and branch with git ls-remote")
+	_, _ = fmt.Fprintln(w, "  stevedore repo rotate-key <deployment> [--rollback]  # replace the SSH deploy key")
+	_, _ = fmt.Fprintln(w, "  stevedore repo change-branch <deployment> <branch> --yes  # track another branch")
+	_, _ = fmt.Fprintln(w, "  stevedore repo list [--tag <tag>]")
+	_, _ = fmt.Fprintln(w, "  stevedore repo set-depends <deployment> [<dependency>...]")
+	_, _ = fmt.Fprintln(w, "  stevedore repo tag <deployment> [<tag>...] [--remove]  # group deployments for --tag")
+	_, _ = fmt.Fprintln(w, "  stevedore repo set-schedule <deployment> \"0 3 * * *\" | --clear  # cron schedule for update checks")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy sync <deployment> [--no-clean] [--json] [--verbose]")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy sync <deployment> --dry-run-clean [--json]  # list the untracked files a clean sync would remove")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy up <deployment> [--with-deps] [--force] [--no-cache] [--force-recreate | --no-recreate] [--no-repo-env] [--include-self]  # stevedore itself needs --include-self; use self-update")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy up --all | --tag <tag> [--force] [--no-cache] [--force-recreate | --no-recreate] [--no-repo-env] [--include-self]  # every (tagged) deployment, dependencies first")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy down <deployment> [--timeout <duration>] [--volumes] [--rmi local|all]  # --volumes deletes named volumes")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy down --all | --tag <tag> [--include-self] [--timeout <duration>]  # dependents first, skips stevedore itself")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy archive <deployment>    # stop and stop polling; keeps checkout, key and parameters")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy unarchive <deployment>  # poll an archived deployment again")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy scale <deployment> <service>=<n>... | --reset  # replica overrides kept across deploys")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy validate <deployment>  # check the compose file without deploying")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy drift <deployment> [--apply]  # compare containers with the compose file")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy describe <deployment> [--json]  # configuration without secrets, safe to share")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy cancel <deployment>  # cancel the daemon's in-progress sync or deploy")
+	_, _ = fmt.Fprintln(w, "  stevedore deploy history <deployment> [--limit <n>]  # recent deploys with commit, duration and outcome")
+	_, _ = fmt.Fprintln(w, "  stevedore logs <deployment> [--follow] [--since <duration>] [--tail <n>] [--no-color]")
+	_, _ = fmt.Fprintln(w, "  stevedore logs daemon [--follow] [--tail <n>]  # the daemon's own log (system/logs/daemon.log)")
+	_, _ = fmt.Fprintln(w, "  stevedore exec [-it] <deployment> <service> -- <command> [args...]")
 	_, _ = fmt.Fprintln(w, "  stevedore param set <deployment> <name> <value> | ... --stdin")
 	_, _ = fmt.Fprintln(w, "  stevedore param get <deployment> <name>")
-	_, _ = fmt.Fprintln(w, "  stevedore param list <deployment>")
+	_, _ = fmt.Fprintln(w, "  stevedore param list <deployment> [--include-global]")
+	_, _ = fmt.Fprintln(w, "  stevedore param history <deployment> <name>   # previous values (fingerprints only)")
+	_, _ = fmt.Fprintln(w, "  stevedore param rollback <deployment> <name>  # restore the previous value")
+	_, _ = fmt.Fprintln(w, "  stevedore param set|get|list|history|rollback --global ...  # parameters inherited by every deployment")
+	_, _ = fmt.Fprintln(w, "  stevedore param set|get|list|history|rollback --profile <profile> ...  # parameters of the deployments with the profile")
 	_, _ = fmt.Fprintln(w, "  stevedore shared list")
 	_, _ = fmt.Fprintln(w, "  stevedore shared read <namespace> [key]")
 	_, _ = fmt.Fprintln(w, "  stevedore shared write <namespace> <key> <value>")
 	_, _ = fmt.Fprintln(w, "  stevedore services list [--ingress] [--json]")
 	_, _ = fmt.Fprintln(w, "  stevedore token get <deployment>       # get/create query token")
 	_, _ = fmt.Fprintln(w, "  stevedore token regenerate <deployment># regenerate query token")
-	_, _ = fmt.Fprintln(w, "  stevedore token list                   # list deployments with tokens")
+	_, _ = fmt.Fprintln(w, "  stevedore token list                   # list tokens with scope, expiry and last use")
+	_, _ = fmt.Fprintln(w, "  stevedore completion bash|zsh|fish     # print a shell completion script")
+	_, _ = fmt.Fprintln(w, "  stevedore maintenance on [--until <time>] | off | status  # pause automatic syncs and deploys")
+	_, _ = fmt.Fprintln(w, "")
+	_, _ = fmt.Fprintln(w, "status, check and deploy color their output on a terminal; --no-color or NO_COLOR=1 disables it.")
+	_, _ = fmt.Fprintln(w, "--json makes any command print JSON: its result, {\"output\": ...} or {\"error\": ...}.")
 }
 
 func buildInfoSummary() string {
@@ -989,8 +4277,8 @@ func shortCommit(hash string) string {
 	return hash
 }
 
-// githubDeployKeyURL extracts the GitHub repository path from various URL formats
-// and returns the deploy keys settings URL, or empty string if not a GitHub URL.
+// githubRepoSlug extracts the owner/repo path of a GitHub repository from
+// various URL formats, or returns empty string if not a GitHub URL.
 func githubRepoSlug(repoURL string) string {
 	repoURL = strings.TrimSpace(repoURL)
 
@@ -1043,3 +4331,75 @@ func githubDeployKeyURLFromSlug(repoSlug string) string {
 func githubDeployKeyURL(repoURL string) string {
 	return githubDeployKeyURLFromSlug(githubRepoSlug(repoURL))
 }
+
+// Git hosts with known deploy key settings pages.
+const (
+	providerGitHub    = "GitHub"
+	providerGitLab    = "GitLab"
+	providerBitbucket = "Bitbucket"
+)
+
+// deployKeyURL detects the git host of repoURL and returns its name with the
+// URL of the repository's deploy keys settings, or empty strings for other
+// hosts.
+func deployKeyURL(repoURL string) (provider string, url string) {
+	if url := githubDeployKeyURL(repoURL); url != "" {
+		return providerGitHub, url
+	}
+	if url := gitlabDeployKeyURL(repoURL); url != "" {
+		return providerGitLab, url
+	}
+	if url := bitbucketDeployKeyURL(repoURL); url != "" {
+		return providerBitbucket, url
+	}
+	return "", ""
+}
+
+// gitlabDeployKeyURL returns the deploy keys section of the repository
+// settings for gitlab.com and self-hosted gitlab.* repositories, including
+// ones in nested groups, or empty string if not a GitLab URL.
+func gitlabDeployKeyURL(repoURL string) string {
+	host, path := repoHostPath(repoURL)
+	if host != "gitlab.com" && !strings.HasPrefix(host, "gitlab.") {
+		return ""
+	}
+	return fmt.Sprintf("https://%s/%s/-/settings/repository#js-deploy-keys-settings", host, path)
+}
+
+// bitbucketDeployKeyURL returns the access keys settings of a Bitbucket Cloud
+// repository, or empty string if not a Bitbucket URL.
+func bitbucketDeployKeyURL(repoURL string) string {
+	host, path := repoHostPath(repoURL)
+	if host != "bitbucket.org" || strings.Count(path, "/") != 1 {
+		return ""
+	}
+	return fmt.Sprintf("https://bitbucket.org/%s/admin/access-keys/", path)
+}
+
+// repoHostPath splits an scp-like (user@host:path), ssh:// or https:// git
+// URL into its lowercase host, without user and port, and its repository
+// path without the .git suffix. Both are empty for other URLs or a path
+// without an owner.
+func repoHostPath(repoURL string) (host string, path string) {
+	repoURL = strings.TrimSpace(repoURL)
+	if scheme, rest, ok := strings.Cut(repoURL, "://"); ok {
+		if scheme != "ssh" && scheme != "https" && scheme != "http" {
+			return "", ""
+		}
+		host, path, _ = strings.Cut(rest, "/")
+		host = host[strings.LastIndex(host, "@")+1:]
+		host, _, _ = strings.Cut(host, ":")
+	} else {
+		userHost, rest, ok := strings.Cut(repoURL, ":")
+		if !ok || !strings.Contains(userHost, "@") {
+			return "", ""
+		}
+		host, path = userHost[strings.LastIndex(userHost, "@")+1:], rest
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return "", ""
+	}
+	return strings.ToLower(host), path
+}
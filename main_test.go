@@ -1,6 +1,21 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore/internal/stevedore"
+)
 
 func TestGithubDeployKeyURL(t *testing.T) {
 	tests := []struct {
@@ -64,3 +79,1154 @@ func TestGithubDeployKeyURL(t *testing.T) {
 		})
 	}
 }
+
+func TestDeployKeyURL(t *testing.T) {
+	tests := []struct {
+		repoURL  string
+		provider string
+		expected string
+	}{
+		{"git@github.com:owner/repo.git", "GitHub", "https://github.com/owner/repo/settings/keys"},
+		{"git@gitlab.com:group/sub/repo.git", "GitLab", "https://gitlab.com/group/sub/repo/-/settings/repository#js-deploy-keys-settings"},
+		{"ssh://git@gitlab.example.com:2222/team/repo.git", "GitLab", "https://gitlab.example.com/team/repo/-/settings/repository#js-deploy-keys-settings"},
+		{"https://gitlab.com/owner/repo", "GitLab", "https://gitlab.com/owner/repo/-/settings/repository#js-deploy-keys-settings"},
+		{"git@bitbucket.org:workspace/repo.git", "Bitbucket", "https://bitbucket.org/workspace/repo/admin/access-keys/"},
+		{"https://user@bitbucket.org/workspace/repo.git", "Bitbucket", "https://bitbucket.org/workspace/repo/admin/access-keys/"},
+		{"git@bitbucket.org:repo.git", "", ""},
+		{"git@git.example.com:owner/repo.git", "", ""},
+		{"/srv/git/repo.git", "", ""},
+	}
+
+	for _, tt := range tests {
+		provider, url := deployKeyURL(tt.repoURL)
+		if provider != tt.provider || url != tt.expected {
+			t.Errorf("deployKeyURL(%q) = %q, %q, want %q, %q", tt.repoURL, provider, url, tt.provider, tt.expected)
+		}
+	}
+}
+
+func TestPrintDeployKeyInstructions_Providers(t *testing.T) {
+	var out strings.Builder
+	printDeployKeyInstructions(&out, "web", "git@gitlab.com:acme/web.git", "ssh-ed25519 AAAA")
+	for _, want := range []string{"GitLab Deploy Keys URL:", "Grant write permissions to this key", "Title: stevedore-web"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("GitLab instructions missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "gh api") {
+		t.Errorf("GitLab instructions must not suggest the GitHub CLI:\n%s", out.String())
+	}
+
+	out.Reset()
+	printDeployKeyInstructions(&out, "web", "git@bitbucket.org:acme/web.git", "ssh-ed25519 AAAA")
+	for _, want := range []string{"Bitbucket Deploy Keys URL:", "https://bitbucket.org/acme/web/admin/access-keys/", "Label: stevedore-web"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Bitbucket instructions missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	printDeployKeyInstructions(&out, "web", "git@github.com:acme/web.git", "ssh-rsa AAAB stevedore:web")
+	for _, want := range []string{"Add this RSA public key", `-f key="ssh-rsa AAAB stevedore:web"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("GitHub instructions for an RSA key missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunStatusWatch_RerendersUntilCancelled(t *testing.T) {
+	instance := stevedore.NewInstance(t.TempDir())
+	if err := instance.EnsureLayout(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+
+	var out strings.Builder
+	if err := runStatusWatch(ctx, instance, []string{"--watch", "--interval", "20ms"}, &out); err != nil {
+		t.Fatalf("runStatusWatch: %v", err)
+	}
+
+	renders := strings.Count(out.String(), "No deployments found")
+	if renders < 2 {
+		t.Errorf("expected at least 2 renders, got %d:\n%s", renders, out.String())
+	}
+	if !strings.Contains(out.String(), "\033[H\033[2J") {
+		t.Error("expected screen clear sequence")
+	}
+}
+
+func TestRunStatusWatch_InvalidInterval(t *testing.T) {
+	instance := stevedore.NewInstance(t.TempDir())
+
+	for _, interval := range []string{"soon", "0s", "-1s"} {
+		var out strings.Builder
+		if err := runStatusWatch(context.Background(), instance, []string{"--interval", interval}, &out); err == nil {
+			t.Errorf("expected error for --interval %q", interval)
+		}
+	}
+}
+
+func TestExecuteCommand_StatusWatchRequiresTerminal(t *testing.T) {
+	instance := stevedore.NewInstance(t.TempDir())
+
+	output, exitCode := executeCommand(instance, []string{"status", "--watch"})
+	if exitCode != 1 {
+		t.Errorf("exitCode = %d, want 1", exitCode)
+	}
+	if !strings.Contains(output, "interactive terminal") {
+		t.Errorf("unexpected output: %q", output)
+	}
+}
+
+func TestParseExecArgs(t *testing.T) {
+	req, err := parseExecArgs([]string{"-it", "app", "web", "--", "sh", "-c", "echo hi"})
+	if err != nil {
+		t.Fatalf("parseExecArgs: %v", err)
+	}
+	if req.deployment != "app" || req.service != "web" {
+		t.Errorf("deployment/service = %q/%q", req.deployment, req.service)
+	}
+	if !req.opts.Interactive || !req.opts.TTY {
+		t.Errorf("expected -it to set interactive and tty: %+v", req.opts)
+	}
+	if strings.Join(req.command, " ") != "sh -c echo hi" {
+		t.Errorf("command = %q", req.command)
+	}
+
+	// Flags after the service belong to the command, even without "--"
+	req, err = parseExecArgs([]string{"app", "web", "ls", "-la"})
+	if err != nil {
+		t.Fatalf("parseExecArgs without --: %v", err)
+	}
+	if strings.Join(req.command, " ") != "ls -la" || req.opts.Interactive {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	for _, bad := range [][]string{
+		{},
+		{"app"},
+		{"app", "web"},
+		{"app", "web", "--"},
+		{"--bogus", "app", "web", "--", "ls"},
+	} {
+		if _, err := parseExecArgs(bad); err == nil {
+			t.Errorf("parseExecArgs(%q) expected error", bad)
+		}
+	}
+}
+
+func TestExecuteCommand_ExecInteractiveRequiresTerminal(t *testing.T) {
+	instance := stevedore.NewInstance(t.TempDir())
+
+	output, exitCode := executeCommand(instance, []string{"exec", "-it", "app", "web", "--", "sh"})
+	if exitCode != 1 {
+		t.Errorf("exitCode = %d, want 1", exitCode)
+	}
+	if !strings.Contains(output, "interactive terminal") {
+		t.Errorf("unexpected output: %q", output)
+	}
+}
+
+func TestRunLogsTo_Validation(t *testing.T) {
+	instance := stevedore.NewInstance(t.TempDir())
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"app", "--follow"}, "interactive terminal"},
+		{[]string{}, "usage: logs"},
+		{[]string{"app", "other"}, "usage: logs"},
+		{[]string{"app", "--bogus"}, "unknown flag"},
+		{[]string{"app", "--tail"}, "requires a value"},
+		{[]string{"app", "--tail", "lots"}, "invalid tail"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		err := runLogsTo(instance, tt.args, &out)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("runLogsTo(%q) error = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestBackupRestoreCommands_RoundTrip(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	t.Setenv("STEVEDORE_BACKUP_PASSPHRASE", "")
+
+	source := stevedore.NewInstance(t.TempDir())
+	if _, err := source.AddRepo("app", stevedore.RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	// Writing the archive inside the state directory must not archive itself
+	archive := filepath.Join(source.Root, "state.tar.gz")
+	output, exitCode := executeCommand(source, []string{"backup", archive})
+	if exitCode != 0 {
+		t.Fatalf("backup failed: %s", output)
+	}
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatalf("archive missing: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("archive mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	target := stevedore.NewInstance(t.TempDir())
+	output, exitCode = executeCommand(target, []string{"restore", archive})
+	if exitCode != 0 {
+		t.Fatalf("restore failed: %s", output)
+	}
+	if _, err := os.Stat(filepath.Join(target.Root, "state.tar.gz")); !os.IsNotExist(err) {
+		t.Error("archive should not contain itself")
+	}
+	if _, err := target.RepoPublicKey("app"); err != nil {
+		t.Errorf("restored deployment key unreadable: %v", err)
+	}
+
+	output, exitCode = executeCommand(target, []string{"backup", "-"})
+	if exitCode != 1 || !strings.Contains(output, "requires running the CLI directly") {
+		t.Errorf("buffered backup to stdout should be rejected, got %d: %s", exitCode, output)
+	}
+}
+
+func TestCheckAll_ReportsErrorsInline(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	for _, name := range []string{"alpha", "beta"} {
+		if _, err := instance.AddRepo(name, stevedore.RepoSpec{URL: "git@github.com:acme/" + name + ".git", Branch: "main"}); err != nil {
+			t.Fatalf("AddRepo: %v", err)
+		}
+	}
+
+	// Break beta: the failure is reported inline and alpha is still checked
+	if err := os.Remove(filepath.Join(instance.DeploymentDir("beta"), "repo", "url.txt")); err != nil {
+		t.Fatalf("remove url.txt: %v", err)
+	}
+
+	output, exitCode := executeCommand(instance, []string{"check", "--all"})
+	if exitCode != 1 {
+		t.Errorf("exitCode = %d, want 1", exitCode)
+	}
+	for _, want := range []string{"DEPLOYMENT", "alpha", "Updates available", "beta", "ERROR:", "1 of 2 deployments could not be checked"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+
+	var out strings.Builder
+	_ = runCheckTo(instance, []string{"--all", "--json"}, &out)
+	var entries []checkAllEntry
+	if err := json.Unmarshal([]byte(out.String()), &entries); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if len(entries) != 2 || entries[0].Error != "" || !entries[0].HasChanges || entries[1].Error == "" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+
+	if err := runCheckTo(instance, []string{"--all", "extra"}, &out); err == nil {
+		t.Error("expected usage error for unexpected argument")
+	}
+}
+
+func TestDeployDrift_Usage(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", stevedore.RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	var out strings.Builder
+	if err := runDeployTo(instance, []string{"drift"}, &out); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("expected usage error, got %v", err)
+	}
+	err := runDeployTo(instance, []string{"drift", "app", "--apply"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "no compose entrypoint") {
+		t.Errorf("expected error for missing compose file, got %v", err)
+	}
+}
+
+func TestDeployDescribe(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", stevedore.RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if err := instance.SetParameter("app", "API_TOKEN", []byte("tok-1234567890")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+
+	output, exitCode := executeCommand(instance, []string{"deploy", "describe", "app"})
+	if exitCode != 0 {
+		t.Fatalf("deploy describe exit code %d:\n%s", exitCode, output)
+	}
+	for _, want := range []string{"URL:        git@github.com:acme/app.git", "Branch:     main", "Parameters: API_TOKEN"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+
+	output, exitCode = executeCommand(instance, []string{"deploy", "describe", "app", "--json"})
+	var desc stevedore.DeploymentDescription
+	if exitCode != 0 || json.Unmarshal([]byte(output), &desc) != nil {
+		t.Fatalf("deploy describe --json exit code %d:\n%s", exitCode, output)
+	}
+	if desc.Deployment != "app" || len(desc.Parameters) != 1 || desc.Parameters[0] != "API_TOKEN" {
+		t.Errorf("unexpected description: %+v", desc)
+	}
+	if strings.Contains(output, "tok-1234567890") {
+		t.Errorf("--json output leaks the parameter value:\n%s", output)
+	}
+
+	var out strings.Builder
+	if err := runDeployTo(instance, []string{"describe"}, &out); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("expected usage error, got %v", err)
+	}
+}
+
+func TestParamCommand_Global(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", stevedore.RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"param", "set", "--global", "SMTP_HOST", "smtp.example.com"},
+		{"param", "set", "app", "DATABASE_URL", "postgres://db"},
+	} {
+		if output, exitCode := executeCommand(instance, args); exitCode != 0 {
+			t.Fatalf("%v: exit %d: %s", args, exitCode, output)
+		}
+	}
+
+	if output, _ := executeCommand(instance, []string{"param", "get", "--global", "SMTP_HOST"}); output != "smtp.example.com" {
+		t.Errorf("param get --global = %q", output)
+	}
+	if output, _ := executeCommand(instance, []string{"param", "list", "app"}); output != "DATABASE_URL\n" {
+		t.Errorf("param list = %q", output)
+	}
+	if output, _ := executeCommand(instance, []string{"param", "list", "app", "--include-global"}); output != "DATABASE_URL\nSMTP_HOST (global)\n" {
+		t.Errorf("param list --include-global = %q", output)
+	}
+}
+
+func TestParamCommand_Profile(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if output, exitCode := executeCommand(instance, []string{"repo", "add", "app", "git@github.com:acme/app.git", "--profile", "prod", "--no-verify"}); exitCode != 0 {
+		t.Fatalf("repo add --profile: exit %d: %s", exitCode, output)
+	}
+
+	for _, args := range [][]string{
+		{"param", "set", "--profile", "prod", "REPLICAS", "3"},
+		{"param", "set", "--global", "SMTP_HOST", "smtp.example.com"},
+		{"param", "set", "app", "DATABASE_URL", "postgres://db"},
+	} {
+		if output, exitCode := executeCommand(instance, args); exitCode != 0 {
+			t.Fatalf("%v: exit %d: %s", args, exitCode, output)
+		}
+	}
+
+	if output, _ := executeCommand(instance, []string{"param", "get", "--profile", "prod", "REPLICAS"}); output != "3" {
+		t.Errorf("param get --profile = %q", output)
+	}
+	if output, _ := executeCommand(instance, []string{"param", "get", "app", "REPLICAS"}); output != "3" {
+		t.Errorf("param get app REPLICAS = %q, want the profile's value", output)
+	}
+	if output, _ := executeCommand(instance, []string{"param", "list", "--profile", "prod"}); output != "REPLICAS\n" {
+		t.Errorf("param list --profile = %q", output)
+	}
+	if output, _ := executeCommand(instance, []string{"param", "list", "app", "--include-global"}); output != "DATABASE_URL\nREPLICAS (profile prod)\nSMTP_HOST (global)\n" {
+		t.Errorf("param list --include-global = %q", output)
+	}
+	if _, exitCode := executeCommand(instance, []string{"param", "list", "--profile", "prod", "--global"}); exitCode == 0 {
+		t.Error("param list with --profile and --global succeeded")
+	}
+}
+
+func TestParamCommand_HistoryRollback(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", stevedore.RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	if output, _ := executeCommand(instance, []string{"param", "history", "app", "API_KEY"}); !strings.Contains(output, "No previous values") {
+		t.Errorf("history without changes = %q", output)
+	}
+	for _, value := range []string{"good-secret", "typo"} {
+		if output, exitCode := executeCommand(instance, []string{"param", "set", "app", "API_KEY", value}); exitCode != 0 {
+			t.Fatalf("param set: exit %d: %s", exitCode, output)
+		}
+	}
+
+	output, _ := executeCommand(instance, []string{"param", "history", "app", "API_KEY"})
+	if !strings.Contains(output, "sha256:") || strings.Contains(output, "good-secret") {
+		t.Errorf("history must list fingerprints, not values:\n%s", output)
+	}
+
+	if output, exitCode := executeCommand(instance, []string{"param", "rollback", "app", "API_KEY"}); exitCode != 0 || !strings.Contains(output, "Restored API_KEY") {
+		t.Fatalf("param rollback: exit %d: %s", exitCode, output)
+	}
+	if output, _ := executeCommand(instance, []string{"param", "get", "app", "API_KEY"}); output != "good-secret" {
+		t.Errorf("param get after rollback = %q", output)
+	}
+}
+
+func TestDoctor_FixRepairsLayoutAndAdminKey(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	t.Setenv(stevedore.AdminKeyEnvVar, "")
+	t.Setenv(stevedore.AdminKeyFileEnvVar, "")
+	t.Setenv("STEVEDORE_CONTAINER_NAME", "stevedore-doctor-test-missing")
+	instance := stevedore.NewInstance(t.TempDir())
+
+	// Without --fix, the missing layout is a finding, not a failure
+	output, exitCode := executeCommand(instance, []string{"doctor"})
+	if exitCode != 0 || !strings.Contains(output, "STATE LAYOUT INCOMPLETE") || !strings.Contains(output, "stevedore doctor --fix") {
+		t.Fatalf("doctor without layout: exit %d: %s", exitCode, output)
+	}
+	if len(instance.MissingLayoutDirs()) != 2 {
+		t.Fatal("doctor without --fix must not change anything")
+	}
+
+	output, exitCode = executeCommand(instance, []string{"doctor", "--fix"})
+	if exitCode != 0 {
+		t.Fatalf("doctor --fix: exit %d: %s", exitCode, output)
+	}
+	for _, want := range []string{"fix: recreated state directories", "fix: generated a new admin key", "deployments: 0"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+	key, err := instance.GetAdminKey()
+	if err != nil || key == "" {
+		t.Fatalf("GetAdminKey after fix = %q, %v", key, err)
+	}
+
+	// A second run has nothing left to fix and keeps the key
+	output, _ = executeCommand(instance, []string{"doctor", "--fix"})
+	if strings.Contains(output, "fix: recreated") || strings.Contains(output, "fix: generated") {
+		t.Errorf("second doctor --fix should not repeat fixes:\n%s", output)
+	}
+	if again, _ := instance.GetAdminKey(); again != key {
+		t.Error("doctor --fix must not replace an existing admin key")
+	}
+
+	if _, exitCode := executeCommand(instance, []string{"doctor", "--bogus"}); exitCode == 0 {
+		t.Error("expected usage error for unknown flag")
+	}
+}
+
+func TestRepoChangeBranch_RequiresConfirmation(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", stevedore.RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	var out strings.Builder
+	err := runRepoTo(instance, []string{"change-branch", "app", "release/1.2"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "--yes") {
+		t.Fatalf("expected confirmation error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "discards its checkout") {
+		t.Errorf("expected the change to be explained, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := runRepoTo(instance, []string{"change-branch", "app", "release/1.2", "--yes"}, &out); err != nil {
+		t.Fatalf("change-branch --yes: %v", err)
+	}
+	if !strings.Contains(out.String(), "now tracks release/1.2 (was branch main)") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestRepoAdd_VerifyHint(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+
+	var out strings.Builder
+	if err := runRepoTo(instance, []string{"add", "app", "git@github.com:acme/app.git"}, &out); err != nil {
+		t.Fatalf("repo add: %v", err)
+	}
+	if !strings.Contains(out.String(), "stevedore repo verify app") {
+		t.Errorf("expected the verify hint, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := runRepoTo(instance, []string{"add", "other", "git@github.com:acme/other.git", "--no-verify"}, &out); err != nil {
+		t.Fatalf("repo add --no-verify: %v", err)
+	}
+	if strings.Contains(out.String(), "repo verify") {
+		t.Errorf("--no-verify should skip the verify hint, got %q", out.String())
+	}
+
+	// Closing the prompt (EOF) skips verification
+	out.Reset()
+	if err := runRepoAddTo(instance, []string{"third", "git@github.com:acme/third.git"}, strings.NewReader(""), &out); err != nil {
+		t.Fatalf("repo add with closed stdin: %v", err)
+	}
+	if !strings.Contains(out.String(), "Skipped verification") {
+		t.Errorf("expected verification to be skipped, got %q", out.String())
+	}
+}
+
+func TestNewPalette(t *testing.T) {
+	prev := stdoutIsTerminal
+	t.Cleanup(func() { stdoutIsTerminal = prev })
+
+	stdoutIsTerminal = false
+	pal, args := newPalette([]string{"app", "--no-color", "--stats"})
+	if pal.enabled || !reflect.DeepEqual(args, []string{"app", "--stats"}) {
+		t.Errorf("newPalette = %v, %v; want disabled without --no-color", pal, args)
+	}
+	if got := pal.bad("ERROR"); got != "ERROR" {
+		t.Errorf("plain palette changed the text: %q", got)
+	}
+
+	stdoutIsTerminal = true
+	t.Setenv("NO_COLOR", "")
+	if pal, _ := newPalette([]string{"app"}); !pal.enabled {
+		t.Error("expected colors on a terminal")
+	} else if got := pal.ok("✓"); got != "\033[32m✓\033[0m" {
+		t.Errorf("ok = %q", got)
+	}
+	if pal, _ := newPalette([]string{"app", "--no-color"}); pal.enabled {
+		t.Error("--no-color must disable colors")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if pal, _ := newPalette([]string{"app"}); pal.enabled {
+		t.Error("NO_COLOR must disable colors")
+	}
+}
+
+func TestExecuteCommand_JSON(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", stevedore.RepoSpec{URL: "git@github.com:acme/app.git", Branch: "main"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	if err := instance.SetParameter("app", "DATABASE_URL", []byte("postgres://db")); err != nil {
+		t.Fatalf("SetParameter: %v", err)
+	}
+	if err := instance.SetGlobalParameter("SMTP_HOST", []byte("smtp")); err != nil {
+		t.Fatalf("SetGlobalParameter: %v", err)
+	}
+
+	output, exitCode := executeCommand(instance, []string{"repo", "list", "--json"})
+	var deployments []string
+	if exitCode != 0 || json.Unmarshal([]byte(output), &deployments) != nil || !reflect.DeepEqual(deployments, []string{"app"}) {
+		t.Errorf("repo list --json = %d %q", exitCode, output)
+	}
+
+	output, exitCode = executeCommand(instance, []string{"--json", "param", "list", "app", "--include-global"})
+	var params []paramEntry
+	if err := json.Unmarshal([]byte(output), &params); exitCode != 0 || err != nil {
+		t.Fatalf("param list --json = %d %q (%v)", exitCode, output, err)
+	}
+	if want := []paramEntry{{Name: "DATABASE_URL"}, {Name: "SMTP_HOST", Global: true}}; !reflect.DeepEqual(params, want) {
+		t.Errorf("param list --json = %+v, want %+v", params, want)
+	}
+
+	// Commands without a structured result wrap their text output
+	output, exitCode = executeCommand(instance, []string{"param", "get", "app", "DATABASE_URL", "--json"})
+	var text jsonText
+	if exitCode != 0 || json.Unmarshal([]byte(output), &text) != nil || text.Output != "postgres://db" {
+		t.Errorf("param get --json = %d %q", exitCode, output)
+	}
+
+	// Errors share one shape
+	for _, args := range [][]string{
+		{"--json", "param", "get", "app", "MISSING"},
+		{"--json", "status", "app", "extra"},
+		{"--json", "bogus"},
+	} {
+		output, exitCode := executeCommand(instance, args)
+		var jerr jsonError
+		if exitCode == 0 || json.Unmarshal([]byte(output), &jerr) != nil || jerr.Error == "" {
+			t.Errorf("%v = %d %q, want a JSON error", args, exitCode, output)
+		}
+	}
+
+	// Without --json the output stays human-readable
+	if output, _ := executeCommand(instance, []string{"repo", "list"}); output != "app\n" {
+		t.Errorf("repo list = %q", output)
+	}
+}
+
+func TestConsumeJSONFlag_StopsAtDoubleDash(t *testing.T) {
+	found, rest := consumeJSONFlag([]string{"exec", "app", "web", "--", "jq", "--json"})
+	if found || !reflect.DeepEqual(rest, []string{"exec", "app", "web", "--", "jq", "--json"}) {
+		t.Errorf("consumeJSONFlag = %v, %v", found, rest)
+	}
+	found, rest = consumeJSONFlag([]string{"--json", "status"})
+	if !found || !reflect.DeepEqual(rest, []string{"status"}) {
+		t.Errorf("consumeJSONFlag = %v, %v", found, rest)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var out strings.Builder
+		if err := runCompletionTo(instance, []string{shell}, &out); err != nil {
+			t.Fatalf("completion %s: %v", shell, err)
+		}
+		for _, want := range []string{"repo", "deploy", "change-branch", "stevedore completion deployments"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("completion %s: expected %q in script", shell, want)
+			}
+		}
+	}
+
+	for _, name := range []string{"web", "api"} {
+		if _, err := instance.AddRepo(name, stevedore.RepoSpec{URL: "git@github.com:acme/" + name + ".git"}); err != nil {
+			t.Fatalf("AddRepo: %v", err)
+		}
+	}
+	var out strings.Builder
+	if err := runCompletionTo(instance, []string{"deployments"}, &out); err != nil {
+		t.Fatalf("completion deployments: %v", err)
+	}
+	if out.String() != "api\nweb\n" {
+		t.Errorf("completion deployments = %q, want sorted names", out.String())
+	}
+
+	if err := runCompletionTo(instance, []string{"powershell"}, &out); err == nil {
+		t.Error("expected error for unsupported shell")
+	}
+}
+
+func TestDaemonListenConfig(t *testing.T) {
+	t.Setenv(stevedore.ListenAddrEnvVar, ":42107")
+	t.Setenv(stevedore.TLSCertEnvVar, "")
+	t.Setenv(stevedore.TLSKeyEnvVar, "")
+	t.Setenv(stevedore.APISocketEnvVar, "")
+
+	config, err := daemonListenConfig(nil)
+	if err != nil {
+		t.Fatalf("daemonListenConfig: %v", err)
+	}
+	if config.ListenAddr != ":42107" || config.TLSCertFile != "" {
+		t.Errorf("expected the environment to apply, got %+v", config)
+	}
+
+	config, err = daemonListenConfig([]string{"--listen", "0.0.0.0:8443", "--tls-cert", "/certs/api.crt", "--tls-key", "/certs/api.key"})
+	if err != nil {
+		t.Fatalf("daemonListenConfig with flags: %v", err)
+	}
+	if config.ListenAddr != "0.0.0.0:8443" || config.TLSCertFile != "/certs/api.crt" || config.TLSKeyFile != "/certs/api.key" {
+		t.Errorf("expected flags to override the environment, got %+v", config)
+	}
+
+	// CLI commands the daemon runs itself reach it over HTTPS on the new address
+	client, err := newDaemonClient("")
+	if err == nil || !strings.Contains(err.Error(), "api.crt") {
+		t.Errorf("expected the client to load the configured certificate, got client=%v err=%v", client, err)
+	}
+
+	config, err = daemonListenConfig([]string{"--listen", "none", "--socket", "/run/stevedore-admin/api.sock"})
+	if err != nil {
+		t.Fatalf("daemonListenConfig with a socket: %v", err)
+	}
+	if config.ListenAddr != stevedore.ListenAddrNone || config.SocketPath != "/run/stevedore-admin/api.sock" {
+		t.Errorf("expected the socket to apply, got %+v", config)
+	}
+	client, err = newDaemonClient("")
+	if err != nil || client.Endpoint() != "unix:///run/stevedore-admin/api.sock" {
+		t.Errorf("expected the client to dial the socket, got client=%v err=%v", client, err)
+	}
+
+	t.Setenv(stevedore.TLSKeyEnvVar, "")
+	t.Setenv(stevedore.APISocketEnvVar, "")
+	for _, args := range [][]string{
+		{"--tls-cert", "/certs/api.crt"},
+		{"--listen", "none"},
+		{"--listen"},
+		{"--verbose"},
+	} {
+		if _, err := daemonListenConfig(args); err == nil {
+			t.Errorf("daemonListenConfig(%v): expected error", args)
+		}
+	}
+}
+
+func TestRepoSetSchedule(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("app", stevedore.RepoSpec{URL: "git@github.com:acme/app.git"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	// An unquoted expression arrives as separate arguments
+	var out strings.Builder
+	if err := runRepoTo(instance, []string{"set-schedule", "app", "0", "3", "*", "*", "*"}, &out); err != nil {
+		t.Fatalf("repo set-schedule: %v", err)
+	}
+	if !strings.Contains(out.String(), `"0 3 * * *"`) || !strings.Contains(out.String(), "Next check:") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	out.Reset()
+	if err := runRepoTo(instance, []string{"set-schedule", "app", "--clear"}, &out); err != nil {
+		t.Fatalf("repo set-schedule --clear: %v", err)
+	}
+	if !strings.Contains(out.String(), "polling every 5m0s") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestParseMaintenanceUntil(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2h", now.Add(2 * time.Hour)},
+		{"2026-03-11T06:00:00Z", time.Date(2026, 3, 11, 6, 0, 0, 0, time.UTC)},
+		{"2026-03-11 06:00", time.Date(2026, 3, 11, 6, 0, 0, 0, time.UTC)},
+		{"18:00", time.Date(2026, 3, 10, 18, 0, 0, 0, time.UTC)},
+		{"06:00", time.Date(2026, 3, 11, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseMaintenanceUntil(tt.value, now)
+		if err != nil {
+			t.Errorf("parseMaintenanceUntil(%q): %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseMaintenanceUntil(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"-1h", "tomorrow", "25:00"} {
+		if _, err := parseMaintenanceUntil(value, now); err == nil {
+			t.Errorf("parseMaintenanceUntil(%q) should fail", value)
+		}
+	}
+}
+
+func TestMaintenanceCommand(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+
+	var out strings.Builder
+	if err := runMaintenanceTo(instance, []string{"on", "--until", "2h"}, &out); err != nil {
+		t.Fatalf("maintenance on: %v", err)
+	}
+	if !strings.Contains(out.String(), "Maintenance: on since") || !strings.Contains(out.String(), "until") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	out.Reset()
+	if err := runStatusTo(instance, nil, &out); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if !strings.Contains(out.String(), "automatic deploys paused") {
+		t.Errorf("status does not show maintenance: %q", out.String())
+	}
+
+	out.Reset()
+	if err := runMaintenanceTo(instance, []string{"off"}, &out); err != nil {
+		t.Fatalf("maintenance off: %v", err)
+	}
+	out.Reset()
+	if err := runMaintenanceTo(instance, nil, &out); err != nil {
+		t.Fatalf("maintenance: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "Maintenance: off" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	if err := runMaintenanceTo(instance, []string{"off", "--until", "2h"}, &out); err == nil {
+		t.Error("maintenance off --until should fail")
+	}
+}
+
+func TestDeployDownAll_ContinuesPastFailures(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	for _, name := range []string{"api", "db", "stevedore"} {
+		if _, err := instance.AddRepo(name, stevedore.RepoSpec{URL: "git@github.com:acme/" + name + ".git"}); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+	var out strings.Builder
+	if err := runRepoTo(instance, []string{"set-depends", "api", "db"}, &out); err != nil {
+		t.Fatalf("repo set-depends: %v", err)
+	}
+
+	t.Setenv("PATH", t.TempDir()) // no docker: every stop fails
+	out.Reset()
+	err := runDeployTo(instance, []string{"down", "--all"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "2 deployment(s) failed: api, db") {
+		t.Fatalf("deploy down --all error = %v, want both deployments failed", err)
+	}
+	output := out.String()
+	api, db := strings.Index(output, "Stopping api"), strings.Index(output, "Stopping db")
+	if api < 0 || db < 0 || api > db {
+		t.Errorf("dependents should stop first: %q", output)
+	}
+	if !strings.Contains(output, "Skipping stevedore") || strings.Contains(output, "Stopping stevedore") {
+		t.Errorf("self-deployment should be skipped: %q", output)
+	}
+	if !strings.Contains(output, "0 succeeded, 2 failed") {
+		t.Errorf("missing summary: %q", output)
+	}
+
+	if err := runDeployTo(instance, []string{"down", "--all", "api"}, &out); err == nil {
+		t.Error("deploy down --all with a deployment name should fail")
+	}
+}
+
+func TestDeployUpAll_SkippedDependencyIsNotWaitedFor(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	for _, name := range []string{"api", "db"} {
+		if _, err := instance.AddRepo(name, stevedore.RepoSpec{URL: "git@github.com:acme/" + name + ".git"}); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+	var out strings.Builder
+	if err := runRepoTo(instance, []string{"set-depends", "api", "db"}, &out); err != nil {
+		t.Fatalf("repo set-depends: %v", err)
+	}
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	err = instance.SetDeploymentArchived(db, "db", true)
+	_ = db.Close()
+	if err != nil {
+		t.Fatalf("SetDeploymentArchived: %v", err)
+	}
+
+	t.Setenv("PATH", t.TempDir()) // no docker: waiting for db would never succeed
+	out.Reset()
+	start := time.Now()
+	err = runDeployTo(instance, []string{"up", "--all"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "1 deployment(s) failed: api") {
+		t.Fatalf("deploy up --all error = %v, want api failed", err)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("deploy up --all took %s, should not wait for the skipped dependency", elapsed)
+	}
+	output := out.String()
+	if !strings.Contains(output, "Skipping db (archived)") || !strings.Contains(output, "dependency db skipped") {
+		t.Errorf("api should be reported as depending on the skipped db: %q", output)
+	}
+}
+
+func TestDeploymentTags_SelectBulkOperations(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	for _, name := range []string{"api", "db", "web"} {
+		if _, err := instance.AddRepo(name, stevedore.RepoSpec{URL: "git@github.com:acme/" + name + ".git"}); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+	var out strings.Builder
+	for _, name := range []string{"web", "api"} {
+		out.Reset()
+		if err := runRepoTo(instance, []string{"tag", name, "frontend"}, &out); err != nil {
+			t.Fatalf("repo tag %s: %v", name, err)
+		}
+	}
+	if got := out.String(); got != "api tags: frontend\n" {
+		t.Errorf("repo tag output = %q", got)
+	}
+
+	out.Reset()
+	if err := runRepoTo(instance, []string{"list", "--tag", "frontend"}, &out); err != nil {
+		t.Fatalf("repo list --tag: %v", err)
+	}
+	if got := out.String(); got != "api\nweb\n" {
+		t.Errorf("repo list --tag = %q, want api and web", got)
+	}
+
+	t.Setenv("PATH", t.TempDir()) // no docker: every stop fails
+	out.Reset()
+	err := runDeployTo(instance, []string{"down", "--tag", "frontend"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "2 deployment(s) failed: web, api") {
+		t.Fatalf("deploy down --tag error = %v, want both tagged deployments failed", err)
+	}
+	if strings.Contains(out.String(), "Stopping db") {
+		t.Errorf("untagged deployment should not be stopped: %q", out.String())
+	}
+	if err := runDeployTo(instance, []string{"up", "--all", "--tag", "frontend"}, &out); err == nil {
+		t.Error("deploy up with both --all and --tag should fail")
+	}
+
+	out.Reset()
+	if err := runRepoTo(instance, []string{"tag", "api", "frontend", "--remove"}, &out); err != nil {
+		t.Fatalf("repo tag --remove: %v", err)
+	}
+	if got := out.String(); got != "api has no tags\n" {
+		t.Errorf("repo tag --remove output = %q", got)
+	}
+	out.Reset()
+	if err := runDeployTo(instance, []string{"up", "--tag", "backend"}, &out); err != nil || out.String() != "No deployments tagged backend\n" {
+		t.Errorf("deploy up --tag backend = %v, %q", err, out.String())
+	}
+}
+
+func TestDeployUp_RefusesSelfDeployment(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	for _, name := range []string{"api", "stevedore"} {
+		if _, err := instance.AddRepo(name, stevedore.RepoSpec{URL: "git@github.com:acme/" + name + ".git"}); err != nil {
+			t.Fatalf("AddRepo %s: %v", name, err)
+		}
+	}
+	var out strings.Builder
+	if err := runRepoTo(instance, []string{"set-depends", "api", "stevedore"}, &out); err != nil {
+		t.Fatalf("repo set-depends: %v", err)
+	}
+
+	t.Setenv("PATH", t.TempDir()) // no docker
+	for _, args := range [][]string{
+		{"up", "stevedore"},
+		{"up", "api", "--with-deps"},
+	} {
+		out.Reset()
+		err := runDeployTo(instance, args, &out)
+		if !errors.Is(err, stevedore.ErrSelfDeployment) || !strings.Contains(err.Error(), "stevedore self-update") {
+			t.Errorf("deploy %v = %v, want ErrSelfDeployment pointing to self-update", args, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("deploy %v should not deploy anything: %q", args, out.String())
+		}
+	}
+
+	if err := runDeployTo(instance, []string{"up", "stevedore", "--include-self"}, &out); err == nil || errors.Is(err, stevedore.ErrSelfDeployment) {
+		t.Errorf("deploy up --include-self = %v, want the compose deploy to be attempted", err)
+	}
+}
+
+func TestDeploySync_Usage(t *testing.T) {
+	instance := stevedore.NewInstance(t.TempDir())
+	var out strings.Builder
+	for _, args := range [][]string{
+		{"sync"},
+		{"sync", "app", "--no-clean", "--dry-run-clean"},
+	} {
+		if err := runDeployTo(instance, args, &out); err == nil || !strings.Contains(err.Error(), "usage: deploy sync") {
+			t.Errorf("deploy %v = %v, want usage", args, err)
+		}
+	}
+}
+
+func TestDeploy_RejectsFlagLikeArguments(t *testing.T) {
+	instance := stevedore.NewInstance(t.TempDir())
+	var out strings.Builder
+	for _, args := range [][]string{
+		{"sync", "--typo", "app"},
+		{"sync", "--app"},
+		{"up", "app", "--with-dep"},
+		{"down", "-app"},
+		{"archive", "--app"},
+		{"scale", "app", "--rest"},
+		{"validate", "--app"},
+		{"drift", "app", "--aply"},
+		{"cancel", "--app"},
+		{"history", "app", "--limt", "5"},
+	} {
+		err := runDeployTo(instance, args, &out)
+		if err == nil || !strings.Contains(err.Error(), "deploy "+args[0]+": unknown flag") {
+			t.Errorf("deploy %v = %v, want an unknown flag error", args, err)
+		}
+	}
+
+	// A second deployment name is no longer silently preferred over the first
+	if err := runDeployTo(instance, []string{"sync", "app", "web"}, &out); err == nil || !strings.Contains(err.Error(), "usage: deploy sync") {
+		t.Errorf("deploy sync app web = %v, want usage", err)
+	}
+}
+
+func TestDeployUnarchive(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("seasonal", stevedore.RepoSpec{URL: "git@github.com:acme/seasonal.git"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+	var out strings.Builder
+	if err := runDeployTo(instance, []string{"unarchive", "seasonal"}, &out); err == nil {
+		t.Error("unarchive of a deployment that is not archived should fail")
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+	if err := instance.SetDeploymentArchived(db, "seasonal", true); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	if err := runDeployTo(instance, []string{"up", "seasonal"}, &out); !errors.Is(err, stevedore.ErrDeploymentArchived) {
+		t.Errorf("deploy up of an archived deployment = %v, want ErrDeploymentArchived", err)
+	}
+
+	out.Reset()
+	if err := runDeployTo(instance, []string{"unarchive", "seasonal"}, &out); err != nil {
+		t.Fatalf("deploy unarchive: %v", err)
+	}
+	if !strings.Contains(out.String(), "Unarchived: seasonal") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	if config, err := instance.GetRepoConfig(db, "seasonal"); err != nil || config.Archived || !config.Enabled {
+		t.Errorf("after unarchive: %+v, %v", config, err)
+	}
+}
+
+func TestRepoKeys(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	apiKey, err := instance.AddRepo("api", stevedore.RepoSpec{URL: "git@github.com:acme/api.git"})
+	if err != nil {
+		t.Fatalf("AddRepo api: %v", err)
+	}
+	if _, err := instance.AddRepo("web", stevedore.RepoSpec{URL: "git@gitlab.com:acme/web.git"}); err != nil {
+		t.Fatalf("AddRepo web: %v", err)
+	}
+
+	var out strings.Builder
+	if err := runRepoTo(instance, []string{"keys"}, &out); err != nil {
+		t.Fatalf("repo keys: %v", err)
+	}
+	output := out.String()
+	for _, want := range []string{
+		"api (git@github.com:acme/api.git)",
+		apiKey,
+		"GitHub Deploy Keys URL: https://github.com/acme/api/settings/keys",
+		"web (git@gitlab.com:acme/web.git)",
+		"GitLab Deploy Keys URL: https://gitlab.com/acme/web/-/settings/repository#js-deploy-keys-settings",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+
+	jsonOut, code := executeCommand(instance, []string{"repo", "keys", "--json"})
+	if code != 0 {
+		t.Fatalf("repo keys --json exit code %d: %s", code, jsonOut)
+	}
+	var entries []repoKeyEntry
+	if err := json.Unmarshal([]byte(jsonOut), &entries); err != nil {
+		t.Fatalf("parse %q: %v", jsonOut, err)
+	}
+	if len(entries) != 2 || entries[0].Deployment != "api" || entries[0].PublicKey != apiKey ||
+		entries[0].Provider != "GitHub" || entries[1].Provider != "GitLab" || entries[1].DeployKeyURL == "" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestRepoAddFromManifest(t *testing.T) {
+	t.Setenv("STEVEDORE_DB_KEY", "test-key")
+	instance := stevedore.NewInstance(t.TempDir())
+	if _, err := instance.AddRepo("api", stevedore.RepoSpec{URL: "git@github.com:acme/api.git", Branch: "dev"}); err != nil {
+		t.Fatalf("AddRepo: %v", err)
+	}
+
+	manifest := filepath.Join(t.TempDir(), "manifest.yaml")
+	if err := os.WriteFile(manifest, []byte(`deployments:
+  - name: api
+    url: git@github.com:acme/api.git
+    interval: 15m
+  - name: homepage
+    url: git@github.com:acme/homepage.git
+    interval: 10m
+`), 0o644); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+
+	var out strings.Builder
+	if err := runRepoTo(instance, []string{"add", "--from", manifest}, &out); err != nil {
+		t.Fatalf("repo add --from: %v\n%s", err, out.String())
+	}
+	output := out.String()
+	for _, want := range []string{
+		"Skipped: api already exists",
+		"Added: homepage (branch main)",
+		"https://github.com/acme/homepage/settings/keys",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "acme/api/settings") {
+		t.Errorf("only new deployments' keys should be printed:\n%s", output)
+	}
+
+	out.Reset()
+	if err := runRepoTo(instance, []string{"add", "--from", manifest, "--update"}, &out); err != nil {
+		t.Fatalf("repo add --from --update: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Updated: api: branch main (next sync clones it), interval 15m0s") ||
+		!strings.Contains(out.String(), "Unchanged: homepage") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	db, err := instance.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+	config, err := instance.GetRepoConfig(db, "api")
+	if err != nil {
+		t.Fatalf("GetRepoConfig: %v", err)
+	}
+	if config.Branch != "main" || config.PollIntervalSeconds != 900 {
+		t.Errorf("api config = %+v, want branch main every 900s", config)
+	}
+
+	if err := runRepoTo(instance, []string{"add", "app", "git@github.com:acme/app.git", "--update"}, &out); err == nil {
+		t.Error("--update without --from should fail")
+	}
+}
+
+func TestReady_FollowsTLSConfig(t *testing.T) {
+	ready := false
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			http.NotFound(w, r)
+			return
+		}
+		status, code := "not_ready", http.StatusServiceUnavailable
+		if ready {
+			status, code = "ready", http.StatusOK
+		}
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(map[string]any{"status": status, "subsystems": map[string]bool{"pollLoop": ready}})
+	}))
+	defer server.Close()
+
+	// The daemon serves HTTPS on a non-default port, as with --tls-cert and --listen
+	certFile := filepath.Join(t.TempDir(), "api.crt")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(certFile, cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(stevedore.APISocketEnvVar, "")
+	t.Setenv(stevedore.ListenAddrEnvVar, strings.TrimPrefix(server.URL, "https://"))
+	t.Setenv(stevedore.TLSCertEnvVar, certFile)
+	t.Setenv(stevedore.AdminKeyEnvVar, "test-admin-key")
+	instance := stevedore.NewInstance(t.TempDir())
+
+	output, exitCode := executeCommand(instance, []string{"ready"})
+	if exitCode == 0 || !strings.Contains(output, "waiting for: pollLoop") {
+		t.Errorf("ready before the poll loop: exit %d: %s", exitCode, output)
+	}
+
+	ready = true
+	if output, exitCode := executeCommand(instance, []string{"ready"}); exitCode != 0 {
+		t.Errorf("ready: exit %d: %s", exitCode, output)
+	}
+}
@@ -192,6 +192,7 @@ STEVEDORE_ADMIN_KEY_FILE=/opt/stevedore/system/admin.key
 STEVEDORE_CONTAINER_NAME=${STEVEDORE_CONTAINER_NAME}
 STEVEDORE_SOURCE_REPO=${git_repo}
 STEVEDORE_SOURCE_REF=${git_branch}
+STEVEDORE_LISTEN_ADDR=${STEVEDORE_LISTEN_ADDR:-0.0.0.0:42107}
 ${STEVEDORE_RECONCILE_INTERVAL:+STEVEDORE_RECONCILE_INTERVAL=${STEVEDORE_RECONCILE_INTERVAL}}
 EOF
 }
@@ -240,7 +241,7 @@ Restart=always
 RestartSec=2
 ExecStartPre=-${docker_bin} rm -f ${STEVEDORE_CONTAINER_NAME}
 ExecStartPre=-/bin/mkdir -p /var/run/stevedore
-ExecStart=${docker_bin} run --name ${STEVEDORE_CONTAINER_NAME} --cgroupns=host --env-file ${STEVEDORE_CONTAINER_ENV} -p 42107:42107 -v /var/run/docker.sock:/var/run/docker.sock -v /sys/fs/cgroup:/sys/fs/cgroup:ro -v /var/run/stevedore:/var/run/stevedore -v ${STEVEDORE_HOST_ROOT}:/opt/stevedore ${STEVEDORE_IMAGE}
+ExecStart=${docker_bin} run --name ${STEVEDORE_CONTAINER_NAME} --cgroupns=host --env-file ${STEVEDORE_CONTAINER_ENV} -p 42107:42107 --label com.stevedore.managed=true --label com.stevedore.role=daemon -v /var/run/docker.sock:/var/run/docker.sock -v /sys/fs/cgroup:/sys/fs/cgroup:ro -v /var/run/stevedore:/var/run/stevedore -v ${STEVEDORE_HOST_ROOT}:/opt/stevedore ${STEVEDORE_IMAGE}
 ExecStop=-${docker_bin} stop ${STEVEDORE_CONTAINER_NAME}
 TimeoutStopSec=30
 
@@ -268,6 +269,8 @@ start_container_without_systemd() {
     --cgroupns=host \
     --env-file "${STEVEDORE_CONTAINER_ENV}" \
     -p 42107:42107 \
+    --label com.stevedore.managed=true \
+    --label com.stevedore.role=daemon \
     -v /var/run/docker.sock:/var/run/docker.sock \
     -v /sys/fs/cgroup:/sys/fs/cgroup:ro \
     -v /var/run/stevedore:/var/run/stevedore \